@@ -0,0 +1,232 @@
+// Command cleanse runs a single cleansing synchronously, without going through NSQ, and prints its result as JSON.
+// With -dry-run it deletes nothing and prints the diff of the database and S3 views of a site or project instead.
+// A cleansing that leaves a follow-up message, such as a paused contractor or an expiring bucket, exits with
+// exitPending and prints the arguments that run the follow-up to standard error.
+//
+//	go run ./cmd/cleanse -type site -id 42
+//	go run ./cmd/cleanse -type project -id 7 -dry-run
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"github.com/denys89/wadugs-worker-cleansing/src/resolver"
+	"github.com/denys89/wadugs-worker-cleansing/src/service"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	exitSuccess = 0 // the cleansing succeeded
+	exitFailure = 1 // the cleansing failed or reported no success
+	exitUsage   = 2 // the arguments were invalid; nothing was run
+	exitPending = 3 // the cleansing succeeded so far but left a follow-up message that must be run to finish it
+)
+
+func main() {
+	message, dryRun, err := parseArgs(os.Args[1:], os.Stderr)
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(exitUsage)
+	}
+
+	log.SetFormatter(&log.JSONFormatter{TimestampFormat: time.RFC3339})
+
+	correlationID := message.CorrelationID
+	if correlationID == "" {
+		correlationID = fmt.Sprintf("cleansing-%d", time.Now().UnixNano())
+	}
+	ctx := workerLog.WithLogger(context.Background(), correlationID)
+
+	if dryRun {
+		os.Exit(runDiff(ctx, config.Get(), message))
+	}
+
+	cleansingService, err := resolveCleansingService(ctx, config.Get())
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize cleansing service")
+	}
+
+	result, err := cleansingService.ProcessCleansingMessage(ctx, message)
+	if err != nil {
+		workerLog.GetLoggerFromContext(ctx).WithError(err).Error("Cleansing failed")
+	}
+	if err := writeResult(os.Stdout, result, err); err != nil {
+		log.WithError(err).Error("Failed to write cleansing result")
+	}
+	if err == nil && result != nil && result.FollowUp != nil {
+		writeFollowUp(os.Stderr, *result.FollowUp)
+	}
+	os.Exit(exitCode(result, err))
+}
+
+// parseArgs builds the cleansing message described by the command line arguments, and reports whether only
+// its dry-run diff was asked for
+func parseArgs(args []string, output io.Writer) (dto.CleansingMessage, bool, error) {
+	var message dto.CleansingMessage
+	var dryRun bool
+
+	flags := flag.NewFlagSet("cleanse", flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.StringVar(&message.Type, "type", "", "cleansing type: contractor, project, site, expired_bucket or manifest")
+	flags.Int64Var(&message.ID, "id", 0, "ID of the contractor, project or site to cleanse")
+	flags.StringVar(&message.Category, "category", "", "only cleanse files of document groups in this category")
+	flags.StringVar(&message.Scope, "scope", "", "raw, processed or all (default) site files")
+	flags.StringVar(&message.BucketName, "bucket-name", "", "expired_bucket only: the bucket to delete")
+	flags.StringVar(&message.BucketRegion, "bucket-region", "", "expired_bucket only: the region of the bucket (default AWS_REGION)")
+	flags.StringVar(&message.ResumeAfter, "resume-after", "", "contractor only: continue emptying the bucket after this key, as printed for a paused run")
+	flags.StringVar(&message.ManifestBucket, "manifest-bucket", "", "manifest only: the bucket holding the manifest")
+	flags.StringVar(&message.ManifestKey, "manifest-key", "", "manifest only: the key of the manifest")
+	flags.StringVar(&message.CorrelationID, "correlation-id", "", "correlation ID to log with (default generated)")
+	flags.BoolVar(&message.Quarantine, "quarantine", false, "tag files as quarantined instead of deleting them")
+	flags.BoolVar(&message.PreserveEntity, "preserve-entity", false, "contractor only: purge all data but keep the contractor record and bucket")
+	flags.StringVar(&message.ConfirmToken, "confirm-token", "", "contractor only: token confirming the deletion when CONTRACTOR_CONFIRM_SECRET is set")
+	flags.BoolVar(&message.SkipS3, "skip-s3", false, "only delete the database records, without any S3 call")
+	flags.BoolVar(&message.OverrideObjectLimit, "override-object-limit", false, "allow deleting more objects than MAX_OBJECTS_PER_OPERATION")
+	flags.BoolVar(&dryRun, "dry-run", false, "site or project only: print the expected, present, planned and orphaned keys without deleting anything")
+	if err := flags.Parse(args); err != nil {
+		return dto.CleansingMessage{}, false, err
+	}
+
+	if flags.NArg() > 0 {
+		return dto.CleansingMessage{}, false, fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+	if !message.IsValidType() {
+		return dto.CleansingMessage{}, false, fmt.Errorf("invalid cleansing type: %q", message.Type)
+	}
+	if message.ID <= 0 {
+		return dto.CleansingMessage{}, false, fmt.Errorf("invalid cleansing id: %d", message.ID)
+	}
+	if !message.IsValidScope() {
+		return dto.CleansingMessage{}, false, fmt.Errorf("invalid cleansing scope: %q", message.Scope)
+	}
+	if !message.IsValidSkipS3() {
+		return dto.CleansingMessage{}, false, errors.New("-skip-s3 only applies to a full contractor, project or site cleansing")
+	}
+	if dryRun && message.Type != dto.CleansingTypeSite && message.Type != dto.CleansingTypeProject {
+		return dto.CleansingMessage{}, false, errors.New("-dry-run only applies to a site or project")
+	}
+	return message, dryRun, nil
+}
+
+// runDiff prints the dry-run diff of the site or project named by message and returns the exit code
+func runDiff(ctx context.Context, cfg *config.Config, message dto.CleansingMessage) int {
+	reconciler, err := resolver.NewResolver(cfg).ResolveReconciler(ctx)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize reconciler")
+	}
+
+	diff, err := reconciler.Diff(ctx, message)
+	if err != nil {
+		workerLog.GetLoggerFromContext(ctx).WithError(err).Error("Diff failed")
+		return exitFailure
+	}
+	if err := writeJSON(os.Stdout, diff); err != nil {
+		log.WithError(err).Error("Failed to write cleansing diff")
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+// resolveCleansingService builds the cleansing service the worker uses. The resolver falls back to a no-op
+// service when a dependency is unavailable, which would report success without cleansing anything, so the
+// configuration is validated and the database and S3 are resolved first to surface their errors.
+func resolveCleansingService(ctx context.Context, cfg *config.Config) (service.CleansingService, error) {
+	r := resolver.NewResolver(cfg)
+	if err := r.ValidateConfiguration(); err != nil {
+		return nil, err
+	}
+	if _, err := r.ResolveDatabase(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := r.ResolveS3Service(ctx); err != nil {
+		return nil, err
+	}
+
+	cleansingService := r.ResolveCleansingService(ctx)
+	if _, ok := cleansingService.(*service.NullCleansingService); ok {
+		return nil, errors.New("cleansing service is unavailable")
+	}
+	return cleansingService, nil
+}
+
+// writeResult prints the result as indented JSON. A failure without a result is reported as an unsuccessful one.
+func writeResult(w io.Writer, result *dto.CleansingResult, err error) error {
+	if result == nil && err != nil {
+		result = &dto.CleansingResult{Error: err.Error()}
+	}
+	return writeJSON(w, result)
+}
+
+// writeJSON prints v as indented JSON
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// writeFollowUp prints the arguments that run a result's follow-up message. The confirm token is left out,
+// so a contractor's has to be given again.
+func writeFollowUp(w io.Writer, followUp dto.CleansingMessage) {
+	fmt.Fprintf(w, "The cleansing is not finished; run it again with: %s\n", strings.Join(followUpArgs(followUp), " "))
+	if followUp.ConfirmToken != "" {
+		fmt.Fprintln(w, "Pass the same -confirm-token as before.")
+	}
+}
+
+// followUpArgs returns the command line arguments describing a follow-up message, the inverse of parseArgs
+func followUpArgs(message dto.CleansingMessage) []string {
+	args := []string{"-type", message.Type, "-id", strconv.FormatInt(message.ID, 10)}
+	for _, option := range []struct{ name, value string }{
+		{"-category", message.Category},
+		{"-scope", message.Scope},
+		{"-bucket-name", message.BucketName},
+		{"-bucket-region", message.BucketRegion},
+		{"-resume-after", message.ResumeAfter},
+		{"-manifest-bucket", message.ManifestBucket},
+		{"-manifest-key", message.ManifestKey},
+		{"-correlation-id", message.CorrelationID},
+	} {
+		if option.value != "" {
+			args = append(args, option.name, strconv.Quote(option.value))
+		}
+	}
+	for _, option := range []struct {
+		name string
+		set  bool
+	}{
+		{"-quarantine", message.Quarantine},
+		{"-preserve-entity", message.PreserveEntity},
+		{"-skip-s3", message.SkipS3},
+		{"-override-object-limit", message.OverrideObjectLimit},
+	} {
+		if option.set {
+			args = append(args, option.name)
+		}
+	}
+	return args
+}
+
+// exitCode maps the outcome of a cleansing to the process exit code
+func exitCode(result *dto.CleansingResult, err error) int {
+	if err != nil || result == nil || !result.Success {
+		return exitFailure
+	}
+	if result.FollowUp != nil {
+		return exitPending
+	}
+	return exitSuccess
+}
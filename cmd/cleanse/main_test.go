@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    dto.CleansingMessage
+		wantDry bool
+		wantErr bool
+	}{
+		{
+			name: "site",
+			args: []string{"-type", "site", "-id", "42"},
+			want: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: 42},
+		},
+		{
+			name: "double dash flags and options",
+			args: []string{"--type=site", "--id=42", "--scope", "raw", "--quarantine", "--correlation-id", "cleansing-1"},
+			want: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: 42, Scope: dto.ScopeRaw, Quarantine: true, CorrelationID: "cleansing-1"},
+		},
+		{
+			name: "contractor purge",
+			args: []string{"-type", "contractor", "-id", "7", "-preserve-entity", "-override-object-limit"},
+			want: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 7, PreserveEntity: true, OverrideObjectLimit: true},
+		},
+		{
+			name: "database records only",
+			args: []string{"-type", "project", "-id", "10", "-skip-s3"},
+			want: dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: 10, SkipS3: true},
+		},
+		{
+			name:    "dry run",
+			args:    []string{"-type", "project", "-id", "10", "-scope", "raw", "-dry-run"},
+			want:    dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: 10, Scope: dto.ScopeRaw},
+			wantDry: true,
+		},
+		{
+			name: "paused contractor continued",
+			args: []string{"-type", "contractor", "-id", "7", "-resume-after", "P1/S1/00_Upload/a.txt"},
+			want: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 7, ResumeAfter: "P1/S1/00_Upload/a.txt"},
+		},
+		{name: "dry run of contractor", args: []string{"-type", "contractor", "-id", "7", "-dry-run"}, wantErr: true},
+		{name: "skip s3 with scope", args: []string{"-type", "site", "-id", "42", "-scope", "raw", "-skip-s3"}, wantErr: true},
+		{name: "missing type", args: []string{"-id", "42"}, wantErr: true},
+		{name: "invalid type", args: []string{"-type", "document", "-id", "42"}, wantErr: true},
+		{name: "missing id", args: []string{"-type", "site"}, wantErr: true},
+		{name: "non-numeric id", args: []string{"-type", "site", "-id", "abc"}, wantErr: true},
+		{name: "negative id", args: []string{"-type", "site", "-id", "-1"}, wantErr: true},
+		{name: "invalid scope", args: []string{"-type", "site", "-id", "42", "-scope", "thumbnails"}, wantErr: true},
+		{name: "unknown flag", args: []string{"-type", "site", "-id", "42", "-force"}, wantErr: true},
+		{name: "extra arguments", args: []string{"-type", "site", "-id", "42", "now"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, dryRun, err := parseArgs(tt.args, io.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+			if dryRun != tt.wantDry {
+				t.Errorf("Expected dry run %v, got %v", tt.wantDry, dryRun)
+			}
+		})
+	}
+}
+
+func TestParseArgs_Help(t *testing.T) {
+	var usage bytes.Buffer
+	if _, _, err := parseArgs([]string{"-h"}, &usage); !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("Expected flag.ErrHelp, got %v", err)
+	}
+	if !bytes.Contains(usage.Bytes(), []byte("-type")) {
+		t.Errorf("Expected usage to describe -type, got %q", usage.String())
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *dto.CleansingResult
+		err    error
+		want   int
+	}{
+		{name: "success", result: &dto.CleansingResult{Success: true}, want: exitSuccess},
+		{name: "error", err: errors.New("boom"), want: exitFailure},
+		{name: "error with result", result: &dto.CleansingResult{Success: true}, err: errors.New("boom"), want: exitFailure},
+		{name: "unsuccessful result", result: &dto.CleansingResult{Success: false}, want: exitFailure},
+		{name: "no result", want: exitFailure},
+		{name: "follow-up left", result: &dto.CleansingResult{Success: true, FollowUp: &dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 7}}, want: exitPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.result, tt.err); got != tt.want {
+				t.Errorf("Expected exit code %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWriteResult(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeResult(&buf, nil, errors.New("site 42 not found")); err != nil {
+		t.Fatalf("writeResult() unexpected error: %v", err)
+	}
+
+	var result dto.CleansingResult
+	if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+	if result.Success || result.Error != "site 42 not found" {
+		t.Errorf("Expected an unsuccessful result carrying the error, got %+v", result)
+	}
+}
+
+func TestFollowUpArgs(t *testing.T) {
+	// A follow-up printed by the command parses back to the same message
+	tests := []dto.CleansingMessage{
+		{Type: dto.CleansingTypeContractor, ID: 7, ResumeAfter: "PRJA/S100/00_Upload/a b.xtf", OverrideObjectLimit: true, CorrelationID: "cleansing-1"},
+		{Type: dto.CleansingTypeExpiredBucket, ID: 7, BucketName: "contractor-bucket", BucketRegion: "eu-west-1"},
+	}
+
+	for _, want := range tests {
+		t.Run(want.Type, func(t *testing.T) {
+			var args []string
+			for _, arg := range followUpArgs(want) {
+				if unquoted, err := strconv.Unquote(arg); err == nil {
+					arg = unquoted
+				}
+				args = append(args, arg)
+			}
+			got, _, err := parseArgs(args, io.Discard)
+			if err != nil {
+				t.Fatalf("parseArgs(%v) unexpected error: %v", args, err)
+			}
+			if got != want {
+				t.Errorf("Expected %+v, got %+v", want, got)
+			}
+		})
+	}
+}
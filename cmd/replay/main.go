@@ -0,0 +1,56 @@
+// Command replay republishes a failed cleansing message to the worker topic.
+//
+//	echo '{"type":"site","id":42}' | go run ./cmd/replay -correlation-id cleansing-1700000000
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/handlers"
+	"github.com/nsqio/go-nsq"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	cfg := config.Get()
+
+	nsqd := flag.String("nsqd", cfg.NsqServer, "nsqd TCP address to publish to")
+	topic := flag.String("topic", cfg.TopicName, "topic the worker consumes")
+	file := flag.String("file", "", "file holding the message payload (default stdin)")
+	correlationID := flag.String("correlation-id", "", "correlation ID to add when the payload has none")
+	flag.Parse()
+
+	payload, err := readPayload(*file)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to read message payload")
+	}
+
+	producer, err := nsq.NewProducer(*nsqd, nsq.NewConfig())
+	if err != nil {
+		log.WithError(err).Fatal("Failed to create NSQ producer")
+	}
+	defer producer.Stop()
+
+	message, err := handlers.ReplayMessage(producer, *topic, payload, *correlationID)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to replay cleansing message")
+	}
+
+	log.WithFields(log.Fields{
+		"topic":          *topic,
+		"type":           message.Type,
+		"id":             message.ID,
+		"correlation_id": message.CorrelationID,
+	}).Info("Replayed cleansing message")
+}
+
+// readPayload reads the message from path, or from stdin when path is empty
+func readPayload(path string) ([]byte, error) {
+	if path == "" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
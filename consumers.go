@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/nsqio/go-nsq"
+	log "github.com/sirupsen/logrus"
+)
+
+// topicConsumer is an NSQ consumer of one topic with its own pool of handlers
+type topicConsumer struct {
+	topic       string
+	concurrency int
+	handler     nsq.Handler
+	consumer    *nsq.Consumer
+}
+
+// newNsqConfig builds the consumer configuration from cfg. A heartbeat interval at or above the message timeout
+// would let nsqd time out a healthy connection's messages, so it is rejected along with values go-nsq refuses.
+func newNsqConfig(cfg *config.Config) (*nsq.Config, error) {
+	nsqConfig := nsq.NewConfig()
+	nsqConfig.MaxAttempts = cfg.MaxRequeueAttempt
+	if cfg.NsqMsgTimeout > 0 {
+		nsqConfig.MsgTimeout = cfg.NsqMsgTimeout
+	}
+	if cfg.NsqHeartbeatInterval > 0 {
+		nsqConfig.HeartbeatInterval = cfg.NsqHeartbeatInterval
+	}
+
+	if nsqConfig.MsgTimeout > 0 && nsqConfig.HeartbeatInterval >= nsqConfig.MsgTimeout {
+		return nil, fmt.Errorf("NSQ_HEARTBEAT_INTERVAL (%s) must be less than NSQ_MSG_TIMEOUT (%s)",
+			nsqConfig.HeartbeatInterval, nsqConfig.MsgTimeout)
+	}
+	if err := nsqConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid NSQ config: %w", err)
+	}
+	return nsqConfig, nil
+}
+
+// newConsumers creates the consumer of TopicName and, when configured, those of the low priority topic and of the
+// site-only topic. Site messages are handled by handler like those of TopicName, sharing its services and
+// statistics, while their own pool of SiteConcurrency handlers lets high-volume site cleanups scale independently
+// of contractor and project deletions. lowPriorityHandler is only used when LowPriorityTopic is set.
+func newConsumers(cfg *config.Config, nsqConfig *nsq.Config, handler, lowPriorityHandler nsq.Handler) ([]*topicConsumer, error) {
+	if cfg.SiteTopicName != "" && (cfg.SiteTopicName == cfg.TopicName || cfg.SiteTopicName == cfg.LowPriorityTopic) {
+		return nil, fmt.Errorf("SITE_TOPIC_NAME (%s) must differ from TOPIC_NAME and LOW_PRIORITY_TOPIC", cfg.SiteTopicName)
+	}
+
+	consumers := []*topicConsumer{{topic: cfg.TopicName, concurrency: cfg.NsqConcurrency, handler: handler}}
+	// Low priority messages are routed by the main handler to their own topic and handler pool
+	if cfg.LowPriorityTopic != "" {
+		consumers = append(consumers, &topicConsumer{topic: cfg.LowPriorityTopic, concurrency: max(cfg.LowPriorityConcurrency, 1), handler: lowPriorityHandler})
+	}
+	if cfg.SiteTopicName != "" {
+		consumers = append(consumers, &topicConsumer{topic: cfg.SiteTopicName, concurrency: max(cfg.SiteConcurrency, 1), handler: handler})
+	}
+
+	for i, c := range consumers {
+		consumer, err := nsq.NewConsumer(c.topic, cfg.ConsumerChannelName, nsqConfig)
+		if err != nil {
+			stopConsumers(consumers[:i])
+			return nil, fmt.Errorf("failed to create consumer for topic %s: %w", c.topic, err)
+		}
+		maxInFlight := c.concurrency
+		if c.topic == cfg.TopicName {
+			maxInFlight = cfg.MaxInflight
+		}
+		consumer.ChangeMaxInFlight(maxInFlight)
+		consumer.AddConcurrentHandlers(c.handler, c.concurrency)
+		c.consumer = consumer
+	}
+	return consumers, nil
+}
+
+// connectConsumers connects every consumer to nsqd
+func connectConsumers(consumers []*topicConsumer, nsqServer string) error {
+	for _, c := range consumers {
+		if err := c.consumer.ConnectToNSQD(nsqServer); err != nil {
+			return fmt.Errorf("failed to connect consumer for topic %s: %w", c.topic, err)
+		}
+		log.WithFields(log.Fields{
+			"topic":       c.topic,
+			"concurrency": c.concurrency,
+		}).Info("Consuming cleansing messages")
+	}
+	return nil
+}
+
+// stopConsumers stops every consumer that was created. It only starts their shutdown: in-flight messages are still
+// being handled when it returns.
+func stopConsumers(consumers []*topicConsumer) {
+	for _, c := range consumers {
+		if c.consumer != nil {
+			c.consumer.Stop()
+		}
+	}
+}
+
+// waitForConsumers waits until every stopped consumer has finished its in-flight messages, or timeout passes when it
+// is not 0, and reports whether they all finished
+func waitForConsumers(consumers []*topicConsumer, timeout time.Duration) bool {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for _, c := range consumers {
+		if c.consumer == nil {
+			continue
+		}
+		select {
+		case <-c.consumer.StopChan:
+		case <-deadline:
+			return false
+		}
+	}
+	return true
+}
+
+// stopper stops the producers of a message handler
+type stopper interface {
+	Stop()
+}
+
+// shutdownConsumers stops the consumers and, once their in-flight messages have finished or timeout has passed,
+// the producers those messages publish follow-ups and results with
+func shutdownConsumers(consumers []*topicConsumer, timeout time.Duration, producers ...stopper) {
+	stopConsumers(consumers)
+	if !waitForConsumers(consumers, timeout) {
+		log.WithField("timeout", timeout).Warn("Messages still in flight after the shutdown timeout, stopping producers anyway")
+	}
+	for _, p := range producers {
+		p.Stop()
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/nsqio/go-nsq"
+)
+
+// testHandler is a distinct nsq.Handler so tests can tell which handler a consumer was given
+type testHandler struct{ name string }
+
+func (h *testHandler) HandleMessage(message *nsq.Message) error { return nil }
+
+func TestNewConsumers(t *testing.T) {
+	handler := &testHandler{name: "main"}
+	lowPriorityHandler := &testHandler{name: "low"}
+
+	type want struct {
+		topic       string
+		concurrency int
+		handler     nsq.Handler
+	}
+	tests := []struct {
+		name string
+		cfg  config.Config
+		want []want
+	}{
+		{
+			name: "main topic only",
+			cfg:  config.Config{TopicName: "data-cleansing", NsqConcurrency: 2, MaxInflight: 5},
+			want: []want{{topic: "data-cleansing", concurrency: 2, handler: handler}},
+		},
+		{
+			name: "site topic shares the main handler",
+			cfg:  config.Config{TopicName: "data-cleansing", NsqConcurrency: 2, MaxInflight: 5, SiteTopicName: "data-cleansing-sites", SiteConcurrency: 8},
+			want: []want{
+				{topic: "data-cleansing", concurrency: 2, handler: handler},
+				{topic: "data-cleansing-sites", concurrency: 8, handler: handler},
+			},
+		},
+		{
+			name: "all topics",
+			cfg: config.Config{TopicName: "data-cleansing", NsqConcurrency: 1, MaxInflight: 1,
+				LowPriorityTopic: "data-cleansing-low", LowPriorityConcurrency: 1, SiteTopicName: "data-cleansing-sites"},
+			want: []want{
+				{topic: "data-cleansing", concurrency: 1, handler: handler},
+				{topic: "data-cleansing-low", concurrency: 1, handler: lowPriorityHandler},
+				{topic: "data-cleansing-sites", concurrency: 1, handler: handler},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.ConsumerChannelName = "test-channel"
+			consumers, err := newConsumers(&tt.cfg, nsq.NewConfig(), handler, lowPriorityHandler)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer stopConsumers(consumers)
+
+			if len(consumers) != len(tt.want) {
+				t.Fatalf("Expected %d consumers, got %d", len(tt.want), len(consumers))
+			}
+			for i, w := range tt.want {
+				c := consumers[i]
+				if c.topic != w.topic || c.concurrency != w.concurrency || c.handler != w.handler {
+					t.Errorf("Expected consumer %d for %s with %d %v handlers, got %s with %d %v", i, w.topic, w.concurrency, w.handler, c.topic, c.concurrency, c.handler)
+				}
+				if c.consumer == nil {
+					t.Errorf("Expected consumer %d to be created", i)
+				}
+			}
+		})
+	}
+}
+
+func TestNewConsumers_SiteTopicClash(t *testing.T) {
+	for _, cfg := range []config.Config{
+		{TopicName: "data-cleansing", SiteTopicName: "data-cleansing", ConsumerChannelName: "test-channel"},
+		{TopicName: "data-cleansing", LowPriorityTopic: "low", SiteTopicName: "low", ConsumerChannelName: "test-channel"},
+	} {
+		if _, err := newConsumers(&cfg, nsq.NewConfig(), &testHandler{}, &testHandler{}); err == nil {
+			t.Errorf("Expected error for site topic %s", cfg.SiteTopicName)
+		}
+	}
+}
+
+func TestNewConsumers_InvalidTopic(t *testing.T) {
+	cfg := config.Config{TopicName: "data-cleansing", SiteTopicName: "not a valid topic!", ConsumerChannelName: "test-channel"}
+	if _, err := newConsumers(&cfg, nsq.NewConfig(), &testHandler{}, &testHandler{}); err == nil {
+		t.Error("Expected error for an invalid site topic name")
+	}
+}
+
+func TestNewNsqConfig(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           config.Config
+		wantErr       bool
+		wantTimeout   time.Duration
+		wantHeartbeat time.Duration
+	}{
+		{name: "defaults", cfg: config.Config{MaxRequeueAttempt: 5}, wantHeartbeat: 30 * time.Second},
+		{name: "long message timeout", cfg: config.Config{MaxRequeueAttempt: 5, NsqMsgTimeout: 10 * time.Minute}, wantTimeout: 10 * time.Minute, wantHeartbeat: 30 * time.Second},
+		{name: "aligned heartbeat", cfg: config.Config{MaxRequeueAttempt: 5, NsqMsgTimeout: 10 * time.Minute, NsqHeartbeatInterval: 20 * time.Second}, wantTimeout: 10 * time.Minute, wantHeartbeat: 20 * time.Second},
+		{name: "heartbeat at timeout", cfg: config.Config{MaxRequeueAttempt: 5, NsqMsgTimeout: 20 * time.Second, NsqHeartbeatInterval: 20 * time.Second}, wantErr: true},
+		{name: "default heartbeat above timeout", cfg: config.Config{MaxRequeueAttempt: 5, NsqMsgTimeout: 10 * time.Second}, wantErr: true},
+		{name: "heartbeat above read timeout", cfg: config.Config{MaxRequeueAttempt: 5, NsqHeartbeatInterval: 2 * time.Minute}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nsqConfig, err := newNsqConfig(&tt.cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if nsqConfig.MaxAttempts != tt.cfg.MaxRequeueAttempt {
+				t.Errorf("Expected max attempts %d, got %d", tt.cfg.MaxRequeueAttempt, nsqConfig.MaxAttempts)
+			}
+			if nsqConfig.MsgTimeout != tt.wantTimeout {
+				t.Errorf("Expected message timeout %s, got %s", tt.wantTimeout, nsqConfig.MsgTimeout)
+			}
+			if nsqConfig.HeartbeatInterval != tt.wantHeartbeat {
+				t.Errorf("Expected heartbeat interval %s, got %s", tt.wantHeartbeat, nsqConfig.HeartbeatInterval)
+			}
+		})
+	}
+}
+
+// fakeNsqd speaks just enough of the nsqd protocol to deliver one message to a consumer and let it shut down
+type fakeNsqd struct {
+	listener net.Listener
+	closing  chan struct{} // closed when the consumer asks to close its connection
+	finished chan struct{} // closed when the consumer finishes the message
+}
+
+func newFakeNsqd(t *testing.T) *fakeNsqd {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	n := &fakeNsqd{listener: listener, closing: make(chan struct{}), finished: make(chan struct{})}
+	t.Cleanup(func() { listener.Close() })
+	go n.serve()
+	return n
+}
+
+func (n *fakeNsqd) serve() {
+	conn, err := n.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	if _, err := io.ReadFull(reader, make([]byte, len(nsq.MagicV2))); err != nil {
+		return
+	}
+
+	delivered := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch params := strings.Fields(line); params[0] {
+		case "IDENTIFY":
+			// An OK instead of a JSON response turns feature negotiation off
+			var size uint32
+			if binary.Read(reader, binary.BigEndian, &size) != nil {
+				return
+			}
+			if _, err := io.ReadFull(reader, make([]byte, size)); err != nil {
+				return
+			}
+			writeFrame(conn, nsq.FrameTypeResponse, []byte("OK"))
+		case "SUB":
+			writeFrame(conn, nsq.FrameTypeResponse, []byte("OK"))
+		case "RDY":
+			if !delivered && params[1] != "0" {
+				delivered = true
+				body := make([]byte, 26, 26+len("cleanse"))
+				binary.BigEndian.PutUint64(body, uint64(time.Now().UnixNano()))
+				binary.BigEndian.PutUint16(body[8:], 1)
+				copy(body[10:], "0000000000000001")
+				writeFrame(conn, nsq.FrameTypeMessage, append(body, "cleanse"...))
+			}
+		case "FIN":
+			close(n.finished)
+		case "CLS":
+			close(n.closing)
+			writeFrame(conn, nsq.FrameTypeResponse, []byte("CLOSE_WAIT"))
+		}
+	}
+}
+
+// writeFrame writes an nsqd frame: its size, type and data
+func writeFrame(w io.Writer, frameType int32, data []byte) {
+	frame := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)+4))
+	binary.BigEndian.PutUint32(frame[4:], uint32(frameType))
+	w.Write(append(frame, data...))
+}
+
+// shutdownProducer fails publishes once it is stopped, like an nsq.Producer
+type shutdownProducer struct {
+	stopped atomic.Bool
+}
+
+func (p *shutdownProducer) Stop() { p.stopped.Store(true) }
+
+func (p *shutdownProducer) Publish() error {
+	if p.stopped.Load() {
+		return nsq.ErrStopped
+	}
+	return nil
+}
+
+func TestShutdownConsumers(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeout     time.Duration
+		finishAfter time.Duration // How long the in-flight message keeps running once the shutdown started
+		wantPublish bool
+	}{
+		{name: "in-flight message publishes before producers stop", timeout: 5 * time.Second, finishAfter: 100 * time.Millisecond, wantPublish: true},
+		{name: "unbounded wait", finishAfter: 100 * time.Millisecond, wantPublish: true},
+		{name: "producers stop at the timeout", timeout: 50 * time.Millisecond, finishAfter: 500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nsqd := newFakeNsqd(t)
+			producer := &shutdownProducer{}
+			inFlight := make(chan struct{})
+			published := make(chan error, 1)
+
+			// The handler publishes its result only after the shutdown has started
+			handler := nsq.HandlerFunc(func(message *nsq.Message) error {
+				close(inFlight)
+				<-nsqd.closing
+				time.Sleep(tt.finishAfter)
+				published <- producer.Publish()
+				return nil
+			})
+
+			cfg := config.Config{TopicName: "data-cleansing", ConsumerChannelName: "test-channel", NsqConcurrency: 1, MaxInflight: 1}
+			consumers, err := newConsumers(&cfg, nsq.NewConfig(), handler, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			consumers[0].consumer.SetLoggerLevel(nsq.LogLevelError)
+			if err := connectConsumers(consumers, nsqd.listener.Addr().String()); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			select {
+			case <-inFlight:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Expected the message to be delivered")
+			}
+			shutdownConsumers(consumers, tt.timeout, producer)
+
+			if !producer.stopped.Load() {
+				t.Error("Expected the producers to be stopped")
+			}
+			err = <-published
+			if tt.wantPublish && err != nil {
+				t.Errorf("Expected the in-flight message to publish, got %v", err)
+			}
+			if !tt.wantPublish && !errors.Is(err, nsq.ErrStopped) {
+				t.Errorf("Expected the publish to fail once the timeout stopped the producers, got %v", err)
+			}
+			if tt.wantPublish {
+				select {
+				case <-nsqd.finished:
+				default:
+					t.Error("Expected the message to be finished before the shutdown returned")
+				}
+			}
+		})
+	}
+}
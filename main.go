@@ -4,7 +4,9 @@ import (
 	"context"
 	"github.com/denys89/wadugs-worker-cleansing/src/config"
 	"github.com/denys89/wadugs-worker-cleansing/src/handlers"
+	"github.com/denys89/wadugs-worker-cleansing/src/metrics"
 	"github.com/denys89/wadugs-worker-cleansing/src/resolver"
+	"github.com/denys89/wadugs-worker-cleansing/src/tracing"
 	"github.com/nsqio/go-nsq"
 	log "github.com/sirupsen/logrus"
 	"os"
@@ -21,19 +23,44 @@ func main() {
 	log.SetLevel(log.InfoLevel)
 
 	cfg := config.Get()
+	if err := cfg.ReconcileNsqLimits(); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"max_inflight":    cfg.MaxInflight,
+			"nsq_concurrency": cfg.NsqConcurrency,
+		}).Warn("Adjusted misconfigured NSQ limits")
+	}
 
-	nsqConfig := nsq.NewConfig()
-	nsqConfig.MaxAttempts = cfg.MaxRequeueAttempt
-	consumer, err := nsq.NewConsumer(cfg.TopicName, cfg.ConsumerChannelName, nsqConfig)
+	nsqConfig, err := newNsqConfig(cfg)
 	if err != nil {
-		panic(err)
+		log.WithError(err).Fatal("Invalid NSQ configuration")
 	}
-	consumer.ChangeMaxInFlight(cfg.MaxInflight)
 	
 	// Create resolver and resolve services
 	ctx := context.Background()
 	r := resolver.NewResolver(cfg)
+
+	// Malformed settings such as key templates must stop the worker before it deletes under the wrong keys
+	if err := r.ValidateConfiguration(); err != nil {
+		log.WithError(err).Fatal("Invalid configuration")
+	}
+
+	// Spans are only exported when an OTLP endpoint is configured
+	shutdownTracing, err := tracing.Setup(ctx, cfg)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize tracing")
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.WithError(err).Warn("Failed to flush tracing spans")
+		}
+	}()
 	
+	// The collectors can only be scraped when a listener address is configured
+	if cfg.MetricsAddr != "" {
+		stopMetrics := metrics.Serve(cfg.MetricsAddr)
+		defer stopMetrics()
+	}
+
 	// Initialize database connection
 	db, err := r.ResolveDatabase(ctx)
 	if err != nil {
@@ -90,11 +117,29 @@ func main() {
 		"file_repo":           fileRepo != nil,
 	}).Info("Repository status check")
 	
-	handler := handlers.NewMessageHandler(cleansingService, s3Service)
+	handler := handlers.NewMessageHandlerWithConfig(cfg, cleansingService, s3Service)
 	
+	// The main topic, and the low priority and site-only topics when configured, each get their own handler pool
+	var lowPriorityHandler nsq.Handler
+	var lowPriority *handlers.MessageHandler
+	if cfg.LowPriorityTopic != "" {
+		lowPriority = handlers.NewLowPriorityMessageHandler(cfg, cleansingService, s3Service)
+		lowPriorityHandler = lowPriority
+	}
+	consumers, err := newConsumers(cfg, nsqConfig, handler, lowPriorityHandler)
+	if err != nil {
+		panic(err)
+	}
+
 	defer func() {
 		log.Info("shutting down gracefully")
-		consumer.Stop()
+
+		// Only once no message is in flight can the producers publishing follow-ups and results be stopped
+		producers := []stopper{handler}
+		if lowPriority != nil {
+			producers = append(producers, lowPriority)
+		}
+		shutdownConsumers(consumers, cfg.ShutdownTimeout, producers...)
 		
 		// Close database connection
 		if db != nil {
@@ -106,13 +151,18 @@ func main() {
 		}
 	}()
 	
-	consumer.AddConcurrentHandlers(
-		handler,
-		cfg.NsqConcurrency,
-	)
+	// Periodically report handler statistics
+	if cfg.StatsInterval > 0 {
+		ticker := time.NewTicker(cfg.StatsInterval)
+		defer ticker.Stop()
+		go func() {
+			for range ticker.C {
+				handler.LogStats()
+			}
+		}()
+	}
 
-	err = consumer.ConnectToNSQD(cfg.NsqServer)
-	if err != nil {
+	if err := connectConsumers(consumers, cfg.NsqServer); err != nil {
 		panic(err)
 	}
 
@@ -1,6 +1,10 @@
 package config
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 )
 
@@ -16,17 +20,220 @@ type Config struct {
 	TopicName           string `envconfig:"TOPIC_NAME" default:"data-cleansing"`
 	ConsumerChannelName string `envconfig:"CONSUMER_CHANNEL_NAME" default:"server-cleansing-consumer-channel"`
 
+	// nsqd requeues a message it has not heard about for NsqMsgTimeout, so long cleanses need more than its default;
+	// the value must not exceed nsqd's --max-msg-timeout. NsqHeartbeatInterval must stay below it. Zero leaves
+	// nsqd's message timeout and go-nsq's 30s heartbeat in place
+	NsqMsgTimeout        time.Duration `envconfig:"NSQ_MSG_TIMEOUT" default:"0"`
+	NsqHeartbeatInterval time.Duration `envconfig:"NSQ_HEARTBEAT_INTERVAL" default:"0"`
+
+	// On shutdown the worker waits up to ShutdownTimeout for in-flight messages to finish before stopping the
+	// producers they publish follow-ups and results with; 0 waits however long they take
+	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"30s"`
+
+	// A message failing with a retryable error is requeued after RequeueBaseDelay, doubled for every earlier attempt
+	// and capped at RequeueMaxDelay, which must not exceed nsqd's --max-req-timeout; a zero base delay leaves the
+	// requeue delay to NSQ
+	RequeueBaseDelay time.Duration `envconfig:"REQUEUE_BASE_DELAY" default:"5s"`
+	RequeueMaxDelay  time.Duration `envconfig:"REQUEUE_MAX_DELAY" default:"5m"`
+
+	// Messages of a disabled type (expired bucket follow-ups count as contractor messages) are neither processed nor
+	// dropped: they are republished to TopicName as new messages delivered after DisabledTypeDelay, so waiting out an
+	// incident does not use up their attempts. The delay must not exceed nsqd's --max-req-timeout. A nil flag, as
+	// in a Config built in code, leaves the type enabled.
+	EnableContractor  *bool         `envconfig:"ENABLE_CONTRACTOR" default:"true"`
+	EnableProject     *bool         `envconfig:"ENABLE_PROJECT" default:"true"`
+	EnableSite        *bool         `envconfig:"ENABLE_SITE" default:"true"`
+	DisabledTypeDelay time.Duration `envconfig:"DISABLED_TYPE_DELAY" default:"5m"`
+
+	// When set, low priority messages (contractor-wide deletions by default) received on TopicName are moved to this
+	// topic, consumed by a separate pool of LowPriorityConcurrency handlers, so they cannot hold up site cleanups
+	LowPriorityTopic       string `envconfig:"LOW_PRIORITY_TOPIC"`
+	LowPriorityConcurrency int    `envconfig:"LOW_PRIORITY_CONCURRENCY" default:"1"`
+
+	// When set, the result of every message, including those rejected as invalid, is published to this topic
+	ResultsTopic string `envconfig:"RESULTS_TOPIC"`
+
+	// When set, site messages are also consumed from this topic by a separate pool of SiteConcurrency handlers sharing
+	// the main handler, so high-volume site cleanups scale independently of contractor and project deletions
+	SiteTopicName   string `envconfig:"SITE_TOPIC_NAME"`
+	SiteConcurrency int    `envconfig:"SITE_CONCURRENCY" default:"1"`
+
+	// Interval between handler statistics log lines; 0 disables them
+	StatsInterval time.Duration `envconfig:"STATS_INTERVAL" default:"1m"`
+
+	// Messages whose processing takes at least SlowThreshold are logged as a warning and counted; 0 disables this
+	SlowThreshold time.Duration `envconfig:"SLOW_THRESHOLD" default:"5m"`
+
+	// Received message bodies are logged at info level up to LogBodyLimit bytes, marked as truncated beyond it, and
+	// in full only at debug level; 0 logs every body in full at info level
+	LogBodyLimit int `envconfig:"LOG_BODY_LIMIT" default:"1024"`
+
+	// With LogKeyPlan set, every S3 key computed from the database is logged at debug level with its bucket and the
+	// file or document group it comes from, so a deletion plan can be diffed against S3
+	LogKeyPlan bool `envconfig:"LOG_KEY_PLAN" default:"false"`
+
+	// The completion log of a message summarizes its removed objects per bucket and document group category, keeping
+	// the LogSummaryLimit largest entries; 0 logs every entry
+	LogSummaryLimit int `envconfig:"LOG_SUMMARY_LIMIT" default:"20"`
+
+	// Optional HTTP endpoint that receives every cleansing result as a JSON POST; each attempt (one retry) times out after WebhookTimeout
+	WebhookURL     string        `envconfig:"WEBHOOK_URL"`
+	WebhookTimeout time.Duration `envconfig:"WEBHOOK_TIMEOUT" default:"5s"`
+
+	// Renames top-level result fields in webhook payloads and on the results topic for consumers expecting another
+	// schema, as "field:name,field:name" pairs of CleansingResult JSON names (e.g. "files_deleted:deletedCount"); empty
+	// keeps the DTO's
+	ResultFieldNames map[string]string `envconfig:"RESULT_FIELD_NAMES"`
+
+	// Address, e.g. ":9090", on which the Prometheus collectors are served at /metrics; empty disables the listener
+	MetricsAddr string `envconfig:"METRICS_ADDR"`
+
+	// OTLP/HTTP endpoint URL (e.g. http://collector:4318) that tracing spans are exported to; empty disables tracing
+	OTLPEndpoint string `envconfig:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+
 	// AWS Configuration
 	AWSRegion          string `envconfig:"AWS_REGION" default:"ap-southeast-1"`
 	AWSAccessKeyID     string `envconfig:"AWS_ACCESS_KEY_ID" default:"key" required:"true"`
 	AWSSecretAccessKey string `envconfig:"AWS_SECRET_ACCESS_KEY" default:"secret" required:"true"`
 
+	// Every S3 request made for a contractor, from listing to deleting its buckets, uses the role
+	// ContractorRoleARNPattern names for it (through the {contractor_id} placeholder) when set, else its stored IAM
+	// access key when UseContractorCredentials is set; a contractor without a key falls back to the worker's
+	// credentials above, which also write the audit manifests and read key manifests
+	ContractorRoleARNPattern string `envconfig:"CONTRACTOR_ROLE_ARN_PATTERN"`
+	UseContractorCredentials bool   `envconfig:"USE_CONTRACTOR_CREDENTIALS" default:"false"`
+
+	// Cleansing
+	ProtectedPrefixes []string `envconfig:"PROTECTED_PREFIXES"` // Comma-separated key prefixes that are never deleted
+
+	// Comma-separated buckets the worker may delete from, quarantine in or expire (empty allows every bucket) and
+	// buckets it must never touch, whatever the allowlist says; an operation on any other bucket is refused
+	S3AllowedBuckets []string `envconfig:"S3_ALLOWED_BUCKETS"`
+	S3DeniedBuckets  []string `envconfig:"S3_DENIED_BUCKETS"`
+
+	// Most S3 delete (and quarantine tag) requests in flight at once, shared by all messages processed concurrently
+	S3DeleteConcurrency int `envconfig:"S3_DELETE_CONCURRENCY" default:"3"`
+
+	// By default the first bucket that fails to delete cancels the deletion of the others; in best-effort mode every
+	// bucket is attempted and the failures are returned together, along with the number of objects deleted
+	S3DeleteBestEffort bool `envconfig:"S3_DELETE_BEST_EFFORT" default:"false"`
+
+	// Delete batches of at least this many objects are sent in quiet mode, so S3 only reports the keys it failed to
+	// delete instead of echoing every deleted key; 0 keeps every batch verbose
+	S3DeleteQuietThreshold int `envconfig:"S3_DELETE_QUIET_THRESHOLD" default:"100"`
+
+	// When some keys of a delete batch fail with a retryable per-key error (e.g. SlowDown), only those keys are sent
+	// again, up to S3DeleteKeyRetries more times with backoff, whole-bucket wipes included; 0 leaves them to the
+	// retry of the whole message
+	S3DeleteKeyRetries int `envconfig:"S3_DELETE_KEY_RETRIES" default:"2"`
+
+	// A single DeleteObjects call handed more than S3DeleteWarnThreshold objects logs a warning, and one handed more
+	// than S3DeleteHardMax is rejected unless the message overrides the object limit; 0 disables either check
+	S3DeleteWarnThreshold int `envconfig:"S3_DELETE_WARN_THRESHOLD" default:"50000"`
+	S3DeleteHardMax       int `envconfig:"S3_DELETE_HARD_MAX" default:"0"`
+
+	// With S3DeleteVerify, after each bucket's delete, or each page of a whole-bucket wipe, a HeadObject call per key
+	// checks that the deleted keys are gone, failing the delete for any that still exist; S3DeleteVerifySample caps
+	// the keys checked per bucket or page, 0 checks all. The credentials need s3:ListBucket on the bucket, without
+	// which S3 answers HeadObject for a missing key with 403 instead of 404 and every check fails
+	S3DeleteVerify       bool `envconfig:"S3_DELETE_VERIFY" default:"false"`
+	S3DeleteVerifySample int  `envconfig:"S3_DELETE_VERIFY_SAMPLE" default:"0"`
+
+	// After S3BreakerThreshold consecutive transient failures of S3 delete and list calls, those calls fail at once
+	// with a retryable error for S3BreakerCooldown, then a single probe call decides whether S3 is back; 0 disables it
+	S3BreakerThreshold int           `envconfig:"S3_BREAKER_THRESHOLD" default:"5"`
+	S3BreakerCooldown  time.Duration `envconfig:"S3_BREAKER_COOLDOWN" default:"30s"`
+
+	// At startup the S3 connection is tested by listing buckets, bounded by S3HealthCheckTimeout (0 leaves it unbounded);
+	// a failure only warns. Credentials without s3:ListAllMyBuckets can skip the check with SkipS3HealthCheck.
+	SkipS3HealthCheck    bool          `envconfig:"SKIP_S3_HEALTH_CHECK" default:"false"`
+	S3HealthCheckTimeout time.Duration `envconfig:"S3_HEALTH_CHECK_TIMEOUT" default:"5s"`
+
+	// At startup a non-existent key under S3DeleteCheckPrefix is deleted from S3DeleteCheckBucket to verify the
+	// delete permission, warning when it is denied; leaving the bucket empty skips the check
+	S3DeleteCheckBucket string `envconfig:"S3_DELETE_CHECK_BUCKET"`
+	S3DeleteCheckPrefix string `envconfig:"S3_DELETE_CHECK_PREFIX" default:".wadugs-cleansing/"`
+
+	// When AuditBucket is set, a manifest of the objects each operation is about to delete is uploaded to it under
+	// AuditPrefix, as "json" or "csv", and the deletion only goes ahead once the upload succeeded. Whole buckets
+	// emptied, deleted or left to expire are not listed in a manifest
+	AuditBucket         string `envconfig:"AUDIT_BUCKET"`
+	AuditPrefix         string `envconfig:"AUDIT_PREFIX" default:"deletion-manifests/"`
+	AuditManifestFormat string `envconfig:"AUDIT_MANIFEST_FORMAT" default:"json"`
+
+	// Quarantine mode tags matched objects with QuarantineTag ("key=value") instead of deleting them, so a bucket
+	// lifecycle rule can expire them after a retention window; messages can also request it individually
+	QuarantineMode bool   `envconfig:"QUARANTINE_MODE" default:"false"`
+	QuarantineTag  string `envconfig:"QUARANTINE_TAG" default:"status=quarantined"`
+
+	// How a contractor's dedicated bucket is removed: "delete" empties and deletes it synchronously, "lifecycle" adds a
+	// 1-day expiration rule so S3 empties it asynchronously, and deletes the bucket from a message deferred by
+	// BucketDeleteDelay (repeated until the bucket is empty). The delay must not exceed nsqd's --max-req-timeout.
+	BucketCleanupStrategy string        `envconfig:"BUCKET_CLEANUP_STRATEGY" default:"delete"`
+	BucketDeleteDelay     time.Duration `envconfig:"BUCKET_DELETE_DELAY" default:"1h"`
+
+	// Contractor cleansing aborts when more objects than this are discovered, or a dedicated bucket holds more, unless the
+	// message overrides it; 0 disables the limit
+	MaxObjectsPerOperation int `envconfig:"MAX_OBJECTS_PER_OPERATION" default:"100000"`
+
+	// Runtime after which a contractor cleansing stops emptying its dedicated bucket and republishes the remainder as
+	// a continuation message; 0 lets it run to completion. Only that bucket wipe pauses: key-by-key deletes, lambda
+	// logs, extra buckets and the database cascade always complete
+	MaxOperationRuntime time.Duration `envconfig:"MAX_OPERATION_RUNTIME" default:"0"`
+
+	// With ContractorLockTTL set, a message holds a lease on its contractor in the contractor_lock table, so worker
+	// instances sharing the database never cleanse the same contractor at once. The lease is renewed while the
+	// message is processed and lapses ContractorLockTTL after a crash, timed by the database's clock; a renewal that
+	// fails or finds the lease taken over stops the message, which is retried. A message waits up to
+	// ContractorLockWait for another instance's lease before it is retried. 0 keeps the lock within this instance
+	ContractorLockTTL  time.Duration `envconfig:"CONTRACTOR_LOCK_TTL" default:"0"`
+	ContractorLockWait time.Duration `envconfig:"CONTRACTOR_LOCK_WAIT" default:"30s"`
+
+	// Site reconciliation only deletes S3-only objects last modified at least OrphanMinAge ago, so an upload whose
+	// database row is not committed yet is not taken for an orphan; 0 disables the guard
+	OrphanMinAge time.Duration `envconfig:"ORPHAN_MIN_AGE" default:"24h"`
+
+	// Secret confirming contractor messages: when set, a contractor message is only processed when its confirm_token
+	// is the hex HMAC-SHA256 of "contractor:<id>" keyed with it, so a misrouted message cannot wipe a contractor
+	ContractorConfirmSecret string `envconfig:"CONTRACTOR_CONFIRM_SECRET"`
+
+	// A contractor without a bucket name has no files the worker can address. By default cleansing it, or one of its
+	// projects or sites, fails without a retry; with EmptyBucketRecordsOnly only its database records are deleted
+	EmptyBucketRecordsOnly bool `envconfig:"EMPTY_BUCKET_RECORDS_ONLY" default:"false"`
+
+	// text/template key prefixes for a site's uploaded and processed files; fields: .ProjectCode, .SiteCode, .ProjectID, .SiteID
+	UploadKeyTemplate    string `envconfig:"UPLOAD_KEY_TEMPLATE" default:"{{.ProjectCode}}/{{.SiteCode}}/00_Upload/"`
+	ProcessedKeyTemplate string `envconfig:"PROCESSED_KEY_TEMPLATE" default:"{{.ProjectCode}}/{{.SiteCode}}/01_Processed/"`
+
+	// Project and site codes are trimmed before they go into keys; a "/" or "\\" in a code is rejected ("reject") or
+	// percent-encoded ("encode")
+	KeyCodeSeparators string `envconfig:"KEY_CODE_SEPARATORS" default:"reject"`
+
+	// Number of sites whose files are read from the database concurrently; values below 1 read sites one at a time
+	SiteListConcurrency int `envconfig:"SITE_LIST_CONCURRENCY" default:"4"`
+
+	// Number of documents whose files are read in one query, both when a document group's files are read on their
+	// own and in the bulk read of a whole project or site; values below 1 read one document per query
+	FileReadBatchSize int `envconfig:"FILE_READ_BATCH_SIZE" default:"500"`
+
+	// Number of S3 prefixes listed concurrently, e.g. the upload and processed prefixes of a site being reconciled;
+	// every page request still waits on the shared S3 rate limiter. Values below 1 list one prefix at a time
+	S3ListConcurrency int `envconfig:"S3_LIST_CONCURRENCY" default:"4"`
+
+	// Number of document groups whose files and documents are deleted concurrently, each in its own transaction,
+	// when cascading a project or contractor; values below 1 delete one group at a time
+	CascadeDeleteConcurrency int `envconfig:"CASCADE_DELETE_CONCURRENCY" default:"4"`
+
 	// Database Configuration
 	DBHost     string `envconfig:"DB_HOST" default:"localhost"`
 	DBPort     string `envconfig:"DB_PORT" default:"4306"`
 	DBUser     string `envconfig:"DB_USER" default:"root"`
 	DBPassword string `envconfig:"DB_PASSWORD" default:"password12345"`
 	DBName     string `envconfig:"DB_NAME" default:"wadugsapp"`
+
+	// Transient read errors (e.g. connection resets during failover) are retried with exponential backoff
+	DBReadRetries    int           `envconfig:"DB_READ_RETRIES" default:"3"`
+	DBReadRetryDelay time.Duration `envconfig:"DB_READ_RETRY_DELAY" default:"200ms"`
 }
 
 // Get ...
@@ -36,3 +243,24 @@ func Get() *Config {
 
 	return &cfg
 }
+
+// ReconcileNsqLimits ensures MaxInflight >= NsqConcurrency >= 1, adjusting the values in place.
+// Each handler goroutine needs an in-flight slot, so any handler beyond MaxInflight would never receive
+// a message. The returned error describes what was corrected, or is nil when the config was consistent.
+func (c *Config) ReconcileNsqLimits() error {
+	var problems []string
+	if c.NsqConcurrency < 1 {
+		problems = append(problems, fmt.Sprintf("NSQ_CONCURRENCY (%d) must be at least 1, using 1", c.NsqConcurrency))
+		c.NsqConcurrency = 1
+	}
+	if c.MaxInflight < c.NsqConcurrency {
+		problems = append(problems, fmt.Sprintf("MAX_INFLIGHT (%d) must be >= NSQ_CONCURRENCY (%d) or extra handlers starve, using %d",
+			c.MaxInflight, c.NsqConcurrency, c.NsqConcurrency))
+		c.MaxInflight = c.NsqConcurrency
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid NSQ limits: %s", strings.Join(problems, "; "))
+}
@@ -0,0 +1,49 @@
+package config
+
+import "testing"
+
+func TestConfig_ReconcileNsqLimits(t *testing.T) {
+	tests := []struct {
+		name            string
+		maxInflight     int
+		concurrency     int
+		wantMaxInflight int
+		wantConcurrency int
+		wantErr         bool
+	}{
+		{name: "consistent", maxInflight: 5, concurrency: 2, wantMaxInflight: 5, wantConcurrency: 2},
+		{name: "equal", maxInflight: 3, concurrency: 3, wantMaxInflight: 3, wantConcurrency: 3},
+		{name: "concurrency above max in flight", maxInflight: 2, concurrency: 4, wantMaxInflight: 4, wantConcurrency: 4, wantErr: true},
+		{name: "zero concurrency", maxInflight: 5, concurrency: 0, wantMaxInflight: 5, wantConcurrency: 1, wantErr: true},
+		{name: "zero max in flight and concurrency", maxInflight: 0, concurrency: 0, wantMaxInflight: 1, wantConcurrency: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{MaxInflight: tt.maxInflight, NsqConcurrency: tt.concurrency}
+
+			err := cfg.ReconcileNsqLimits()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReconcileNsqLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if cfg.MaxInflight != tt.wantMaxInflight {
+				t.Errorf("Expected MaxInflight %d, got %d", tt.wantMaxInflight, cfg.MaxInflight)
+			}
+			if cfg.NsqConcurrency != tt.wantConcurrency {
+				t.Errorf("Expected NsqConcurrency %d, got %d", tt.wantConcurrency, cfg.NsqConcurrency)
+			}
+		})
+	}
+}
+
+func TestGet_EnableTypes(t *testing.T) {
+	t.Setenv("ENABLE_PROJECT", "false")
+
+	cfg := Get()
+	if cfg.EnableContractor == nil || !*cfg.EnableContractor || cfg.EnableSite == nil || !*cfg.EnableSite {
+		t.Errorf("Expected contractor and site messages to be enabled by default, got %v and %v", cfg.EnableContractor, cfg.EnableSite)
+	}
+	if cfg.EnableProject == nil || *cfg.EnableProject {
+		t.Errorf("Expected ENABLE_PROJECT=false to disable project messages, got %v", cfg.EnableProject)
+	}
+}
@@ -1,17 +1,97 @@
 package dto
 
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
 const (
 	// CleansingType constants for different deletion types
 	CleansingTypeContractor = "contractor"
 	CleansingTypeProject    = "project"
 	CleansingTypeSite       = "site"
+
+	// CleansingTypeExpiredBucket deletes a contractor bucket once its expiration lifecycle rule has emptied it.
+	// The worker schedules it itself when BUCKET_CLEANUP_STRATEGY is lifecycle; the ID is the contractor's.
+	CleansingTypeExpiredBucket = "expired_bucket"
+
+	// CleansingTypeManifest deletes the keys listed in a manifest object, e.g. one produced by an external audit,
+	// from a contractor's bucket; the ID is the contractor's
+	CleansingTypeManifest = "manifest"
+
+	// Scope constants select which of a site's S3 objects a cleansing covers
+	ScopeAll       = "all"       // raw uploads and processed outputs (the default)
+	ScopeRaw       = "raw"       // only uploaded files under 00_Upload
+	ScopeProcessed = "processed" // only derived outputs under 01_Processed
+
+	// Priority constants rank how urgently a message is processed; see EffectivePriority for the defaults
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+
+	// SkipReason constants for objects deliberately left in place, as counted in CleansingResult.SkippedReasons
+	SkipReasonProtected  = "protected"   // key matches a protected prefix
+	SkipReasonUnsafeKey  = "unsafe_key"  // key is empty or looks like a directory
+	SkipReasonInvalidKey = "invalid_key" // key is longer than S3 allows
+	SkipReasonDuplicate  = "duplicate"   // the same bucket and key was already listed
+
+	// SummaryUncategorized is the category CleansingResult.Summary counts objects not built from a document group under
+	SummaryUncategorized = "uncategorized"
+
+	// BucketOutcome constants record what a contractor cleanse did with each of the contractor's buckets
+	BucketOutcomeDeleted  = "deleted"  // the bucket was emptied and removed
+	BucketOutcomeEmptied  = "emptied"  // the bucket was emptied but kept, as the contractor record is preserved
+	BucketOutcomeMissing  = "missing"  // the bucket no longer existed, e.g. removed by an earlier delivery
+	BucketOutcomeShared   = "shared"   // another contractor references the bucket, so only the contractor's keys went
+	BucketOutcomeKept     = "kept"     // quarantined objects must outlive the cleanse, so the bucket was left alone
+	BucketOutcomeExpiring = "expiring" // a lifecycle rule empties the bucket; FollowUp deletes it afterwards
+	BucketOutcomePaused   = "paused"   // emptying the bucket ran out of runtime; FollowUp continues it
+	BucketOutcomeFailed   = "failed"   // the bucket could not be cleaned up; see the outcome's Error
+
+	// ErrorCode constants classify a failed CleansingResult for callers that act on the cause, e.g. in a sweep
+	ErrorCodeNoBucket = "NO_BUCKET" // the owning contractor has no bucket name, so its files cannot be addressed
+
+	// ErrorCode constants of a message rejected before processing, published so its producer learns why
+	ErrorCodeBadJSON      = "BAD_JSON"      // the payload is not a well-formed cleansing message
+	ErrorCodeInvalidID    = "INVALID_ID"    // the id is not a positive integer
+	ErrorCodeInvalidType  = "INVALID_TYPE"  // the type is unknown, or expired_bucket or manifest without its object
+	ErrorCodeInvalidField = "INVALID_FIELD" // another field (scope, priority, skip_s3, created window) holds an invalid value
 )
 
 type (
 	// CleansingMessage represents the message payload for data cleansing operations
 	CleansingMessage struct {
-		Type string `json:"type"` // contractor, project, or site
-		ID   int64  `json:"id"`   // corresponding ID: contractor_id, project_id, or site_id
+		Type     string `json:"type"`               // contractor, project, or site
+		ID       int64  `json:"id"`                 // corresponding ID: contractor_id, project_id, or site_id
+		Category string `json:"category,omitempty"` // optional document group category; restricts deletion to matching files only
+		Scope    string `json:"scope,omitempty"`    // raw, processed or all (default); raw and processed restrict deletion to those files only
+		Priority string `json:"priority,omitempty"` // high, normal or low; defaults by type, see EffectivePriority
+
+		OverrideObjectLimit bool   `json:"override_object_limit,omitempty"` // explicitly allows deleting more objects than MaxObjectsPerOperation
+		CorrelationID       string `json:"correlation_id,omitempty"`        // optional tracing id; set when a failed message is replayed
+		PreserveEntity      bool   `json:"preserve_entity,omitempty"`       // contractor only: purge all data but keep the contractor record and bucket
+		Quarantine          bool   `json:"quarantine,omitempty"`            // tag files as quarantined instead of deleting them
+		BucketName          string `json:"bucket_name,omitempty"`           // expired_bucket only: the bucket to delete
+		BucketRegion        string `json:"bucket_region,omitempty"`         // expired_bucket only: the region of the bucket; empty for AWS_REGION
+		ResumeAfter         string `json:"resume_after,omitempty"`          // contractor only: continue emptying the bucket after this key
+		SkipS3              bool   `json:"skip_s3,omitempty"`               // only delete the database records, e.g. once S3 was purged out of band
+		ConfirmToken        string `json:"confirm_token,omitempty"`         // contractor only: confirms the deletion when a confirmation secret is configured
+		ManifestBucket      string `json:"manifest_bucket,omitempty"`       // manifest only: the bucket holding the manifest
+		ManifestKey         string `json:"manifest_key,omitempty"`          // manifest only: the key of the manifest
+
+		// CreatedAfter and CreatedBefore restrict the cleanse to files created strictly within them, in Unix
+		// seconds like the file records' created_at, e.g. to undo a bad import; 0 leaves a bound open. Processed
+		// outputs have no file record, so their S3 last modified time is compared instead.
+		CreatedAfter  int64 `json:"created_after,omitempty"`
+		CreatedBefore int64 `json:"created_before,omitempty"`
 	}
 
 	// CleansingResult represents the result of a cleansing operation
@@ -21,15 +101,55 @@ type (
 		Success      bool   `json:"success"`
 		Message      string `json:"message"`
 		FilesDeleted int    `json:"files_deleted"`
+		FilesSkipped int    `json:"files_skipped"` // total of SkippedReasons
 		Error        string `json:"error,omitempty"`
+		ErrorCode    string `json:"error_code,omitempty"` // ErrorCode constant classifying Error, when known
+		Payload      string `json:"payload,omitempty"`    // original body of a message rejected as invalid
+
+		// IdempotencyKey is the same for every result of one message, however often it is delivered; see
+		// CleansingMessage.IdempotencyKey
+		IdempotencyKey string `json:"idempotency_key,omitempty"`
+
+		EntityPreserved bool `json:"entity_preserved,omitempty"` // the entity's own record was kept while its data was purged
+		Quarantined     bool `json:"quarantined,omitempty"`      // files were tagged as quarantined rather than deleted
+		Paused          bool `json:"paused,omitempty"`           // the operation ran out of runtime; FollowUp continues it
+		S3Skipped       bool `json:"s3_skipped,omitempty"`       // only database records were deleted; S3 was not called
+
+		SkippedReasons map[string]int `json:"skipped_reasons,omitempty"` // SkipReason → number of files skipped for it
+
+		// Summary counts the objects sent for deletion, or quarantine, per bucket and document group category; it is
+		// only filled in once all of them were removed
+		Summary map[string]map[string]int `json:"summary,omitempty"`
+
+		Buckets []BucketOutcome `json:"buckets,omitempty"` // contractor only: what happened to each of its buckets
+
+		FollowUp *CleansingMessage `json:"follow_up,omitempty"` // message to publish, deferred, to finish the operation later
+	}
+
+	// BucketOutcome is what a contractor cleanse did with one of the contractor's buckets
+	BucketOutcome struct {
+		Bucket  string `json:"bucket"`
+		Outcome string `json:"outcome"`         // BucketOutcome constant
+		Error   string `json:"error,omitempty"` // Why the bucket failed, if it did
 	}
 
 	// S3Object represents an S3 object to be deleted
 	S3Object struct {
-		Bucket string `json:"bucket"`
-		Key    string `json:"key"`
-		Size   int64  `json:"size"`
-		Region string `json:"region"` // AWS region where the bucket is located
+		Bucket       string    `json:"bucket"`
+		Key          string    `json:"key"`
+		Size         int64     `json:"size"`
+		Region       string    `json:"region"`                 // AWS region where the bucket is located
+		LastModified time.Time `json:"last_modified,omitzero"` // Only populated when listed from S3
+		Category     string    `json:"category,omitempty"`     // Document group category, when the key was built from the database
+	}
+
+	// BucketDeleteResult is the outcome of deleting the objects of one bucket
+	BucketDeleteResult struct {
+		Bucket  string `json:"bucket"`
+		Region  string `json:"region"`
+		Deleted int    `json:"deleted"`
+		Failed  int    `json:"failed"`          // Objects of the bucket that were not deleted
+		Error   string `json:"error,omitempty"` // Why the bucket failed, if it did
 	}
 
 	// DeletionContext contains information needed for file deletion operations
@@ -39,20 +159,252 @@ type (
 		S3Objects   []S3Object `json:"s3_objects"`
 		Description string     `json:"description"`
 	}
+
+	// SiteReconciliation is the difference between the files the database records for a site and the objects
+	// S3 holds under the site's prefixes
+	SiteReconciliation struct {
+		SiteID         int64      `json:"site_id"`
+		Bucket         string     `json:"bucket"`
+		Prefixes       []string   `json:"prefixes"`
+		Matched        int        `json:"matched"`         // Keys both expected and present
+		MissingInS3    []S3Object `json:"missing_in_s3"`   // Expected by the database but absent from S3
+		OrphanedInS3   []S3Object `json:"orphaned_in_s3"`  // Present in S3 but unknown to the database
+		OrphansDeleted int        `json:"orphans_deleted"` // Orphans removed when deletion was requested
+		OrphansKept    int        `json:"orphans_kept"`    // Orphans too recent, or of a group still processing, to delete
+	}
+
+	// OrphanPurge reports the S3 objects under a site's prefixes that no database row maps to, and how many of them
+	// were deleted; nothing is deleted in a dry run
+	OrphanPurge struct {
+		SiteID         int64      `json:"site_id"`
+		Bucket         string     `json:"bucket"`
+		DryRun         bool       `json:"dry_run"`
+		Orphans        []S3Object `json:"orphans"`
+		OrphansFound   int        `json:"orphans_found"`
+		OrphansDeleted int        `json:"orphans_deleted"`
+		OrphansKept    int        `json:"orphans_kept"`
+	}
+
+	// CleansingDiff is a dry run of a site or project cleanse: the keys the database expects, the objects S3
+	// holds under the entity's prefixes, and which of those a cleanse would delete or leave behind
+	CleansingDiff struct {
+		Type           string     `json:"type"`
+		ID             int64      `json:"id"`
+		Bucket         string     `json:"bucket"`
+		Prefixes       []string   `json:"prefixes"`
+		Expected       []S3Object `json:"expected"`        // Keys built from the database rows, inactive groups included
+		Present        []S3Object `json:"present"`         // Objects S3 holds under the prefixes
+		PlannedDeletes []S3Object `json:"planned_deletes"` // Present objects the cleanse would delete
+		Orphans        []S3Object `json:"orphans"`         // Present objects unknown to the database, left behind by the cleanse
+	}
 )
 
-// IsValidType checks if the cleansing type is valid
+// ErrInvalidID is returned by DecodeCleansingMessage for a well-formed message whose id is missing or not positive
+var ErrInvalidID = errors.New("invalid id")
+
+// DecodeCleansingMessage strictly decodes a cleansing message payload. Unlike json.Unmarshal it rejects
+// unknown fields, trailing data after the message and a missing or non-positive id; values of the wrong
+// JSON type (e.g. a quoted or fractional id) are rejected as well. The type itself is checked by IsValidType.
+func DecodeCleansingMessage(data []byte) (CleansingMessage, error) {
+	var message CleansingMessage
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&message); err != nil {
+		return message, err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return message, errors.New("unexpected data after message")
+	}
+	if message.ID <= 0 {
+		return message, fmt.Errorf("%w: must be a positive integer, got %d", ErrInvalidID, message.ID)
+	}
+	return message, nil
+}
+
+// AddSkipped records that n files were deliberately not deleted for reason
+func (cr *CleansingResult) AddSkipped(reason string, n int) {
+	if n <= 0 {
+		return
+	}
+	if cr.SkippedReasons == nil {
+		cr.SkippedReasons = make(map[string]int)
+	}
+	cr.SkippedReasons[reason] += n
+	cr.FilesSkipped += n
+}
+
+// AddBucketOutcome records what happened to one of a contractor's buckets, with the error of a failed one
+func (cr *CleansingResult) AddBucketOutcome(bucket, outcome string, err error) {
+	entry := BucketOutcome{Bucket: bucket, Outcome: outcome}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	cr.Buckets = append(cr.Buckets, entry)
+}
+
+// AddRemoved counts the removed objects in Summary under their bucket and category
+func (cr *CleansingResult) AddRemoved(objects []S3Object) {
+	for _, object := range objects {
+		if cr.Summary == nil {
+			cr.Summary = make(map[string]map[string]int)
+		}
+		if cr.Summary[object.Bucket] == nil {
+			cr.Summary[object.Bucket] = make(map[string]int)
+		}
+		category := object.Category
+		if category == "" {
+			category = SummaryUncategorized
+		}
+		cr.Summary[object.Bucket][category]++
+	}
+}
+
+// IsValidType checks if the cleansing type is valid; an expired_bucket message must also name its bucket, and a
+// manifest message the bucket and key of its manifest
 func (cm *CleansingMessage) IsValidType() bool {
 	switch cm.Type {
 	case CleansingTypeContractor, CleansingTypeProject, CleansingTypeSite:
 		return true
+	case CleansingTypeExpiredBucket:
+		return cm.BucketName != ""
+	case CleansingTypeManifest:
+		return cm.ManifestBucket != "" && cm.ManifestKey != ""
 	default:
 		return false
 	}
 }
 
+// IsValidScope checks if the scope is valid; an empty scope means ScopeAll
+func (cm *CleansingMessage) IsValidScope() bool {
+	switch cm.Scope {
+	case "", ScopeAll, ScopeRaw, ScopeProcessed:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidPriority checks if the priority is valid; an empty priority means the default of the message type
+func (cm *CleansingMessage) IsValidPriority() bool {
+	switch cm.Priority {
+	case "", PriorityHigh, PriorityNormal, PriorityLow:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidSkipS3 checks that SkipS3 is only set on a full contractor, project or site cleansing. Only those have
+// database records to delete; a partial, quarantining, resumed or bucket cleansing is S3 work alone.
+func (cm *CleansingMessage) IsValidSkipS3() bool {
+	if !cm.SkipS3 {
+		return true
+	}
+	switch cm.Type {
+	case CleansingTypeContractor, CleansingTypeProject, CleansingTypeSite:
+		return !cm.IsPartial() && !cm.Quarantine && cm.ResumeAfter == ""
+	default:
+		return false
+	}
+}
+
+// IsValidCreatedWindow checks that CreatedAfter and CreatedBefore are not negative, that CreatedAfter is earlier
+// than CreatedBefore when both are set, and that they are only set on a contractor, project or site cleansing
+func (cm *CleansingMessage) IsValidCreatedWindow() bool {
+	if !cm.HasCreatedWindow() {
+		return true
+	}
+	if cm.CreatedAfter < 0 || cm.CreatedBefore < 0 {
+		return false
+	}
+	if cm.CreatedAfter != 0 && cm.CreatedBefore != 0 && cm.CreatedAfter >= cm.CreatedBefore {
+		return false
+	}
+	switch cm.Type {
+	case CleansingTypeContractor, CleansingTypeProject, CleansingTypeSite:
+		return true
+	default:
+		return false
+	}
+}
+
+// HasCreatedWindow reports whether CreatedAfter or CreatedBefore restricts the cleanse by creation time
+func (cm *CleansingMessage) HasCreatedWindow() bool {
+	return cm.CreatedAfter != 0 || cm.CreatedBefore != 0
+}
+
+// EffectivePriority returns the priority set by the producer or, when none is set, the default of the message
+// type: site cleanups are high priority, while contractor-wide deletions and bucket removals are heavy and can
+// wait, so they are low priority
+func (cm *CleansingMessage) EffectivePriority() string {
+	if cm.Priority != "" {
+		return cm.Priority
+	}
+	switch cm.Type {
+	case CleansingTypeSite:
+		return PriorityHigh
+	case CleansingTypeContractor, CleansingTypeExpiredBucket:
+		return PriorityLow
+	default:
+		return PriorityNormal
+	}
+}
+
+// IdempotencyKey returns the key of the results of this message when processed under correlationID: the hex
+// SHA-256 of the correlation ID, type, id, bucket name and resume key. A redelivery keeps its correlation ID, so
+// every attempt at a message yields the same key, and the last result published under a key is the final outcome.
+// A continuation resumes after another key and a follow-up has another type, so their results get keys of their own.
+func (cm *CleansingMessage) IdempotencyKey(correlationID string) string {
+	hash := sha256.New()
+	for _, part := range []string{correlationID, cm.Type, strconv.FormatInt(cm.ID, 10), cm.BucketName, cm.ResumeAfter} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// IsPartial reports whether the message selects only some of the entity's files, by category, scope or creation time.
+// A partial cleansing deletes the selected files but keeps the entity and its database records.
+func (cm *CleansingMessage) IsPartial() bool {
+	return cm.Category != "" || (cm.Scope != "" && cm.Scope != ScopeAll) || cm.HasCreatedWindow()
+}
+
+// Selection describes the files a partial cleansing covers, e.g. "processed RasterD category files" or
+// "files created after 2026-01-02T15:04:05Z"
+func (cm *CleansingMessage) Selection() string {
+	var parts []string
+	if cm.Scope != "" && cm.Scope != ScopeAll {
+		parts = append(parts, cm.Scope)
+	}
+	if cm.Category != "" {
+		parts = append(parts, cm.Category+" category")
+	}
+	parts = append(parts, "files")
+	if cm.CreatedAfter != 0 {
+		parts = append(parts, "created after "+formatUnix(cm.CreatedAfter))
+	}
+	if cm.CreatedBefore != 0 {
+		if cm.CreatedAfter != 0 {
+			parts = append(parts, "and before "+formatUnix(cm.CreatedBefore))
+		} else {
+			parts = append(parts, "created before "+formatUnix(cm.CreatedBefore))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatUnix formats a Unix timestamp as an RFC 3339 UTC time
+func formatUnix(timestamp int64) string {
+	return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+}
+
 // GetDescription returns a human-readable description of the cleansing operation
 func (cm *CleansingMessage) GetDescription() string {
+	if cm.IsPartial() && cm.IsValidType() {
+		return fmt.Sprintf("Deleting %s for %s", cm.Selection(), cm.Type)
+	}
+
 	switch cm.Type {
 	case CleansingTypeContractor:
 		return "Deleting all files for contractor and its related projects and sites"
@@ -60,6 +412,10 @@ func (cm *CleansingMessage) GetDescription() string {
 		return "Deleting all files for project and its related sites"
 	case CleansingTypeSite:
 		return "Deleting all files for site"
+	case CleansingTypeExpiredBucket:
+		return "Deleting expired contractor bucket"
+	case CleansingTypeManifest:
+		return "Deleting the keys listed in a manifest"
 	default:
 		return "Unknown cleansing operation"
 	}
@@ -2,6 +2,9 @@ package dto
 
 import (
 	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -26,6 +29,26 @@ func TestCleansingMessage_IsValidType(t *testing.T) {
 			message:  CleansingMessage{Type: "site", ID: 1},
 			expected: true,
 		},
+		{
+			name:     "Valid expired bucket type",
+			message:  CleansingMessage{Type: "expired_bucket", ID: 1, BucketName: "contractor-bucket"},
+			expected: true,
+		},
+		{
+			name:     "Invalid type - expired bucket without bucket",
+			message:  CleansingMessage{Type: "expired_bucket", ID: 1},
+			expected: false,
+		},
+		{
+			name:     "Valid manifest type",
+			message:  CleansingMessage{Type: "manifest", ID: 1, ManifestBucket: "audit-bucket", ManifestKey: "keys.csv"},
+			expected: true,
+		},
+		{
+			name:     "Invalid type - manifest without key",
+			message:  CleansingMessage{Type: "manifest", ID: 1, ManifestBucket: "audit-bucket"},
+			expected: false,
+		},
 		{
 			name:     "Invalid type - empty",
 			message:  CleansingMessage{Type: "", ID: 1},
@@ -58,6 +81,95 @@ func TestCleansingMessage_IsValidType(t *testing.T) {
 	}
 }
 
+func TestCleansingMessage_Scope(t *testing.T) {
+	tests := []struct {
+		scope       string
+		category    string
+		wantValid   bool
+		wantPartial bool
+	}{
+		{scope: "", wantValid: true},
+		{scope: ScopeAll, wantValid: true},
+		{scope: ScopeRaw, wantValid: true, wantPartial: true},
+		{scope: ScopeProcessed, wantValid: true, wantPartial: true},
+		{scope: ScopeAll, category: "SSS", wantValid: true, wantPartial: true},
+		{scope: "Processed", wantValid: false, wantPartial: true},
+		{scope: "uploads", wantValid: false, wantPartial: true},
+	}
+
+	for _, tt := range tests {
+		message := CleansingMessage{Type: "site", ID: 1, Scope: tt.scope, Category: tt.category}
+		if got := message.IsValidScope(); got != tt.wantValid {
+			t.Errorf("IsValidScope(%q) = %v, expected %v", tt.scope, got, tt.wantValid)
+		}
+		if got := message.IsPartial(); got != tt.wantPartial {
+			t.Errorf("IsPartial(%q, %q) = %v, expected %v", tt.scope, tt.category, got, tt.wantPartial)
+		}
+	}
+}
+
+func TestCleansingMessage_Priority(t *testing.T) {
+	tests := []struct {
+		typ           string
+		priority      string
+		wantValid     bool
+		wantEffective string
+	}{
+		{typ: CleansingTypeSite, wantValid: true, wantEffective: PriorityHigh},
+		{typ: CleansingTypeProject, wantValid: true, wantEffective: PriorityNormal},
+		{typ: CleansingTypeContractor, wantValid: true, wantEffective: PriorityLow},
+		{typ: CleansingTypeExpiredBucket, wantValid: true, wantEffective: PriorityLow},
+		{typ: CleansingTypeContractor, priority: PriorityHigh, wantValid: true, wantEffective: PriorityHigh},
+		{typ: CleansingTypeSite, priority: PriorityLow, wantValid: true, wantEffective: PriorityLow},
+		{typ: CleansingTypeProject, priority: PriorityNormal, wantValid: true, wantEffective: PriorityNormal},
+		{typ: CleansingTypeSite, priority: "urgent", wantValid: false, wantEffective: "urgent"},
+		{typ: CleansingTypeSite, priority: "High", wantValid: false, wantEffective: "High"},
+	}
+
+	for _, tt := range tests {
+		message := CleansingMessage{Type: tt.typ, ID: 1, Priority: tt.priority}
+		if got := message.IsValidPriority(); got != tt.wantValid {
+			t.Errorf("IsValidPriority(%q) = %v, expected %v", tt.priority, got, tt.wantValid)
+		}
+		if got := message.EffectivePriority(); got != tt.wantEffective {
+			t.Errorf("EffectivePriority(%q, %q) = %q, expected %q", tt.typ, tt.priority, got, tt.wantEffective)
+		}
+	}
+}
+
+func TestCleansingMessage_IsValidSkipS3(t *testing.T) {
+	tests := []struct {
+		name    string
+		message CleansingMessage
+		want    bool
+	}{
+		{name: "not set", message: CleansingMessage{Type: CleansingTypeSite, Scope: ScopeRaw}, want: true},
+		{name: "contractor", message: CleansingMessage{Type: CleansingTypeContractor, SkipS3: true}, want: true},
+		{name: "project", message: CleansingMessage{Type: CleansingTypeProject, SkipS3: true}, want: true},
+		{name: "site with all scope", message: CleansingMessage{Type: CleansingTypeSite, Scope: ScopeAll, SkipS3: true}, want: true},
+		{name: "partial", message: CleansingMessage{Type: CleansingTypeSite, Category: "SSS", SkipS3: true}, want: false},
+		{name: "quarantine", message: CleansingMessage{Type: CleansingTypeProject, Quarantine: true, SkipS3: true}, want: false},
+		{name: "resumed", message: CleansingMessage{Type: CleansingTypeContractor, ResumeAfter: "P1/a.txt", SkipS3: true}, want: false},
+		{name: "expired bucket", message: CleansingMessage{Type: CleansingTypeExpiredBucket, BucketName: "b", SkipS3: true}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.message.IsValidSkipS3(); got != tt.want {
+			t.Errorf("%s: IsValidSkipS3() = %v, expected %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeCleansingMessage_Priority(t *testing.T) {
+	message, err := DecodeCleansingMessage([]byte(`{"type":"contractor","id":1,"priority":"high"}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if message.Priority != PriorityHigh {
+		t.Errorf("Expected priority %q, got %q", PriorityHigh, message.Priority)
+	}
+}
+
 func TestCleansingMessage_GetDescription(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -99,6 +211,31 @@ func TestCleansingMessage_GetDescription(t *testing.T) {
 			message:  CleansingMessage{Type: "contractor", ID: -1},
 			expected: "Deleting all files for contractor and its related projects and sites",
 		},
+		{
+			name:     "Category description",
+			message:  CleansingMessage{Type: "site", ID: 789, Category: "RasterD"},
+			expected: "Deleting RasterD category files for site",
+		},
+		{
+			name:     "Processed scope description",
+			message:  CleansingMessage{Type: "project", ID: 456, Scope: ScopeProcessed},
+			expected: "Deleting processed files for project",
+		},
+		{
+			name:     "Raw scope with category description",
+			message:  CleansingMessage{Type: "site", ID: 789, Scope: ScopeRaw, Category: "SSS"},
+			expected: "Deleting raw SSS category files for site",
+		},
+		{
+			name:     "All scope description",
+			message:  CleansingMessage{Type: "site", ID: 789, Scope: ScopeAll},
+			expected: "Deleting all files for site",
+		},
+		{
+			name:     "Category with invalid type description",
+			message:  CleansingMessage{Type: "invalid", ID: 1, Category: "RasterD"},
+			expected: "Unknown cleansing operation",
+		},
 	}
 
 	for _, tt := range tests {
@@ -300,6 +437,83 @@ func TestCleansingResult_JSONSerialization(t *testing.T) {
 	}
 }
 
+func TestDecodeCleansingMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    CleansingMessage
+		wantErr bool
+	}{
+		{
+			name:    "documented fields",
+			payload: `{"type":"contractor","id":3,"category":"SSS","override_object_limit":true,"correlation_id":"c-1","preserve_entity":true,"quarantine":true}`,
+			want:    CleansingMessage{Type: "contractor", ID: 3, Category: "SSS", OverrideObjectLimit: true, CorrelationID: "c-1", PreserveEntity: true, Quarantine: true},
+		},
+		{
+			name:    "minimal message",
+			payload: `{"type":"site","id":42}`,
+			want:    CleansingMessage{Type: "site", ID: 42},
+		},
+		{name: "unknown field", payload: `{"type":"site","id":42,"bucket":"x"}`, wantErr: true},
+		{name: "quoted id", payload: `{"type":"site","id":"42"}`, wantErr: true},
+		{name: "fractional id", payload: `{"type":"site","id":4.2}`, wantErr: true},
+		{name: "exponent id", payload: `{"type":"site","id":1e3}`, wantErr: true},
+		{name: "boolean type", payload: `{"type":true,"id":42}`, wantErr: true},
+		{name: "missing id", payload: `{"type":"site"}`, wantErr: true},
+		{name: "negative id", payload: `{"type":"site","id":-1}`, wantErr: true},
+		{name: "trailing data", payload: `{"type":"site","id":42}{"type":"site","id":43}`, wantErr: true},
+		{name: "invalid json", payload: `{"type":"site","id":}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := DecodeCleansingMessage([]byte(tt.payload))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got message %+v", message)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if message != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, message)
+			}
+		})
+	}
+}
+
+func TestCleansingResult_AddSkipped(t *testing.T) {
+	var result CleansingResult
+	result.AddSkipped(SkipReasonProtected, 2)
+	result.AddSkipped(SkipReasonUnsafeKey, 1)
+	result.AddSkipped(SkipReasonProtected, 3)
+	result.AddSkipped(SkipReasonDuplicate, 0)
+
+	if result.FilesSkipped != 6 {
+		t.Errorf("Expected 6 files skipped, got %d", result.FilesSkipped)
+	}
+	want := map[string]int{SkipReasonProtected: 5, SkipReasonUnsafeKey: 1}
+	if len(result.SkippedReasons) != len(want) {
+		t.Fatalf("Expected skipped reasons %v, got %v", want, result.SkippedReasons)
+	}
+	for reason, n := range want {
+		if result.SkippedReasons[reason] != n {
+			t.Errorf("Expected %d skipped for %s, got %d", n, reason, result.SkippedReasons[reason])
+		}
+	}
+
+	// Reasons are omitted from the JSON of a result that skipped nothing
+	data, err := json.Marshal(CleansingResult{Type: "site", ID: 1})
+	if err != nil {
+		t.Fatalf("Failed to marshal CleansingResult: %v", err)
+	}
+	if strings.Contains(string(data), "skipped_reasons") {
+		t.Errorf("Expected no skipped_reasons in %s", data)
+	}
+}
+
 // Benchmark tests
 func BenchmarkCleansingMessage_IsValidType(b *testing.B) {
 	message := CleansingMessage{Type: "contractor", ID: 1}
@@ -317,4 +531,154 @@ func BenchmarkCleansingMessage_GetDescription(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		_ = message.GetDescription()
 	}
-}
\ No newline at end of file
+}
+func TestCleansingResult_AddRemoved(t *testing.T) {
+	var result CleansingResult
+	result.AddRemoved([]S3Object{
+		{Bucket: "bucket-a", Key: "P1/S1/00_Upload/a.xtf", Category: "SSS"},
+		{Bucket: "bucket-a", Key: "P1/S1/00_Upload/b.xtf", Category: "SSS"},
+		{Bucket: "bucket-a", Key: "P1/S1/01_Processed/depth.geojson", Category: "RasterD"},
+		{Bucket: "bucket-b", Key: "lambda/P1.log"},
+	})
+	result.AddRemoved([]S3Object{{Bucket: "bucket-a", Key: "P1/S2/00_Upload/c.xtf", Category: "SSS"}})
+	result.AddRemoved(nil)
+
+	want := map[string]map[string]int{
+		"bucket-a": {"SSS": 3, "RasterD": 1},
+		"bucket-b": {SummaryUncategorized: 1},
+	}
+	if !reflect.DeepEqual(result.Summary, want) {
+		t.Errorf("Expected summary %v, got %v", want, result.Summary)
+	}
+
+	// The summary is omitted from the JSON of a result that removed nothing
+	data, err := json.Marshal(CleansingResult{Type: "site", ID: 1})
+	if err != nil {
+		t.Fatalf("Failed to marshal CleansingResult: %v", err)
+	}
+	if strings.Contains(string(data), "summary") {
+		t.Errorf("Expected no summary in %s", data)
+	}
+}
+
+func TestCleansingResult_AddBucketOutcome(t *testing.T) {
+	var result CleansingResult
+	result.AddBucketOutcome("active-bucket", BucketOutcomeDeleted, nil)
+	result.AddBucketOutcome("archive-bucket", BucketOutcomeFailed, errors.New("AccessDenied"))
+
+	want := []BucketOutcome{
+		{Bucket: "active-bucket", Outcome: BucketOutcomeDeleted},
+		{Bucket: "archive-bucket", Outcome: BucketOutcomeFailed, Error: "AccessDenied"},
+	}
+	if !reflect.DeepEqual(result.Buckets, want) {
+		t.Errorf("Expected bucket outcomes %+v, got %+v", want, result.Buckets)
+	}
+}
+
+func TestCleansingMessage_IdempotencyKey(t *testing.T) {
+	base := CleansingMessage{Type: CleansingTypeContractor, ID: 12, BucketName: "archive-bucket", ResumeAfter: "P1/S1/a.xtf"}
+	key := base.IdempotencyKey("cleansing-1")
+
+	if again := base.IdempotencyKey("cleansing-1"); again != key {
+		t.Errorf("Expected the same message to yield key %s, got %s", key, again)
+	}
+	// Fields that do not identify the operation leave the key alone
+	withOptions := base
+	withOptions.Priority = PriorityLow
+	withOptions.CorrelationID = "cleansing-other"
+	if got := withOptions.IdempotencyKey("cleansing-1"); got != key {
+		t.Errorf("Expected options to keep key %s, got %s", key, got)
+	}
+
+	tests := []struct {
+		name          string
+		correlationID string
+		modify        func(m *CleansingMessage)
+	}{
+		{name: "correlation id", correlationID: "cleansing-2", modify: func(m *CleansingMessage) {}},
+		{name: "type", correlationID: "cleansing-1", modify: func(m *CleansingMessage) { m.Type = CleansingTypeExpiredBucket }},
+		{name: "id", correlationID: "cleansing-1", modify: func(m *CleansingMessage) { m.ID = 13 }},
+		{name: "bucket", correlationID: "cleansing-1", modify: func(m *CleansingMessage) { m.BucketName = "active-bucket" }},
+		{name: "resume key", correlationID: "cleansing-1", modify: func(m *CleansingMessage) { m.ResumeAfter = "P1/S1/b.xtf" }},
+		{name: "field boundaries", correlationID: "cleansing-1contractor", modify: func(m *CleansingMessage) { m.Type = "" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := base
+			tt.modify(&message)
+			if got := message.IdempotencyKey(tt.correlationID); got == key {
+				t.Errorf("Expected a different key than %s", key)
+			}
+		})
+	}
+}
+
+func TestCleansingMessage_CreatedWindow(t *testing.T) {
+	tests := []struct {
+		name            string
+		message         CleansingMessage
+		wantValid       bool
+		wantPartial     bool
+		wantDescription string
+	}{
+		{
+			name:            "no bounds",
+			message:         CleansingMessage{Type: CleansingTypeSite, ID: 1},
+			wantValid:       true,
+			wantDescription: "Deleting all files for site",
+		},
+		{
+			name:            "created after",
+			message:         CleansingMessage{Type: CleansingTypeSite, ID: 1, CreatedAfter: 1767225600},
+			wantValid:       true,
+			wantPartial:     true,
+			wantDescription: "Deleting files created after 2026-01-01T00:00:00Z for site",
+		},
+		{
+			name:            "created between with scope",
+			message:         CleansingMessage{Type: CleansingTypeProject, ID: 1, Scope: ScopeRaw, CreatedAfter: 1767225600, CreatedBefore: 1767312000},
+			wantValid:       true,
+			wantPartial:     true,
+			wantDescription: "Deleting raw files created after 2026-01-01T00:00:00Z and before 2026-01-02T00:00:00Z for project",
+		},
+		{
+			name:            "created before",
+			message:         CleansingMessage{Type: CleansingTypeContractor, ID: 1, CreatedBefore: 1767312000},
+			wantValid:       true,
+			wantPartial:     true,
+			wantDescription: "Deleting files created before 2026-01-02T00:00:00Z for contractor",
+		},
+		{
+			name:        "empty window",
+			message:     CleansingMessage{Type: CleansingTypeSite, ID: 1, CreatedAfter: 1767312000, CreatedBefore: 1767312000},
+			wantPartial: true,
+		},
+		{
+			name:        "negative bound",
+			message:     CleansingMessage{Type: CleansingTypeSite, ID: 1, CreatedAfter: -1},
+			wantPartial: true,
+		},
+		{
+			name:        "manifest",
+			message:     CleansingMessage{Type: CleansingTypeManifest, ID: 1, ManifestBucket: "b", ManifestKey: "k", CreatedAfter: 1767225600},
+			wantPartial: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.message.IsValidCreatedWindow(); got != tt.wantValid {
+				t.Errorf("IsValidCreatedWindow() = %v, expected %v", got, tt.wantValid)
+			}
+			if got := tt.message.IsPartial(); got != tt.wantPartial {
+				t.Errorf("IsPartial() = %v, expected %v", got, tt.wantPartial)
+			}
+			if tt.wantDescription != "" {
+				if got := tt.message.GetDescription(); got != tt.wantDescription {
+					t.Errorf("GetDescription() = %q, expected %q", got, tt.wantDescription)
+				}
+			}
+		})
+	}
+}
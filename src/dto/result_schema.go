@@ -0,0 +1,79 @@
+package dto
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// cleansingResultFields returns the JSON names of the top-level CleansingResult fields
+func cleansingResultFields() map[string]bool {
+	fields := make(map[string]bool)
+	resultType := reflect.TypeOf(CleansingResult{})
+	for i := 0; i < resultType.NumField(); i++ {
+		name, _, _ := strings.Cut(resultType.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// ValidateResultFieldNames checks a mapping from CleansingResult JSON field names to the names a consumer expects:
+// every source must be a field of the result, and no two fields may end up with the same name
+func ValidateResultFieldNames(fieldNames map[string]string) error {
+	fields := cleansingResultFields()
+
+	sources := make([]string, 0, len(fieldNames))
+	for source := range fieldNames {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	published := make(map[string]string, len(fields))
+	for field := range fields {
+		if _, renamed := fieldNames[field]; !renamed {
+			published[field] = field
+		}
+	}
+	for _, source := range sources {
+		target := strings.TrimSpace(fieldNames[source])
+		if !fields[source] {
+			return fmt.Errorf("invalid result field mapping: %q is not a cleansing result field", source)
+		}
+		if target == "" {
+			return fmt.Errorf("invalid result field mapping: %q is mapped to an empty name", source)
+		}
+		if other, taken := published[target]; taken {
+			return fmt.Errorf("invalid result field mapping: %q and %q would both be published as %q", other, source, target)
+		}
+		published[target] = source
+	}
+	return nil
+}
+
+// MarshalCleansingResult encodes result as JSON with its top-level fields renamed by fieldNames, a mapping from
+// the DTO's JSON field names to the names a consumer expects. Fields without a mapping keep their name, and nested
+// values such as the follow-up message keep the DTO's schema. Without a mapping the regular JSON of the DTO is
+// returned; with one the fields are ordered by name.
+func MarshalCleansingResult(result *CleansingResult, fieldNames map[string]string) ([]byte, error) {
+	body, err := json.Marshal(result)
+	if err != nil || len(fieldNames) == 0 || result == nil {
+		return body, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	renamed := make(map[string]json.RawMessage, len(fields))
+	for name, value := range fields {
+		if target, ok := fieldNames[name]; ok {
+			name = strings.TrimSpace(target)
+		}
+		renamed[name] = value
+	}
+	return json.Marshal(renamed)
+}
@@ -0,0 +1,90 @@
+package dto
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMarshalCleansingResult(t *testing.T) {
+	result := &CleansingResult{
+		Type:         "site",
+		ID:           7,
+		Success:      true,
+		Message:      "done",
+		FilesDeleted: 3,
+		FollowUp:     &CleansingMessage{Type: "site", ID: 7},
+	}
+
+	// Without a mapping the result keeps the DTO's schema, byte for byte
+	current, err := MarshalCleansingResult(result, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want, _ := json.Marshal(result)
+	if string(current) != string(want) {
+		t.Errorf("Expected %s, got %s", want, current)
+	}
+
+	mapped, err := MarshalCleansingResult(result, map[string]string{
+		"files_deleted": "deletedCount",
+		"success":       "ok",
+		"follow_up":     "next",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wantMapped := `{"deletedCount":3,"files_skipped":0,"id":7,"message":"done","next":{"type":"site","id":7},"ok":true,"type":"site"}`
+	if string(mapped) != wantMapped {
+		t.Errorf("Expected %s, got %s", wantMapped, mapped)
+	}
+
+	// Both schemas carry the same values
+	var currentFields, mappedFields map[string]json.RawMessage
+	if err := json.Unmarshal(current, &currentFields); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := json.Unmarshal(mapped, &mappedFields); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(currentFields) != len(mappedFields) {
+		t.Errorf("Expected %d fields, got %d", len(currentFields), len(mappedFields))
+	}
+	for field, name := range map[string]string{"files_deleted": "deletedCount", "success": "ok", "follow_up": "next", "id": "id"} {
+		if string(currentFields[field]) != string(mappedFields[name]) {
+			t.Errorf("Expected %s to be published as %s with %s, got %s", field, name, currentFields[field], mappedFields[name])
+		}
+	}
+
+	// A mapping for a field omitted from the result publishes nothing for it
+	if mapped, _ := MarshalCleansingResult(result, map[string]string{"error": "failure"}); string(mapped) != `{"files_deleted":3,"files_skipped":0,"follow_up":{"type":"site","id":7},"id":7,"message":"done","success":true,"type":"site"}` {
+		t.Errorf("Expected no failure field, got %s", mapped)
+	}
+}
+
+func TestValidateResultFieldNames(t *testing.T) {
+	tests := []struct {
+		name       string
+		fieldNames map[string]string
+		wantErr    bool
+	}{
+		{name: "empty", fieldNames: nil},
+		{name: "renames", fieldNames: map[string]string{"files_deleted": "deletedCount", "success": "ok"}},
+		{name: "swap", fieldNames: map[string]string{"type": "id", "id": "type"}},
+		{name: "unknown field", fieldNames: map[string]string{"deleted": "deletedCount"}, wantErr: true},
+		{name: "empty name", fieldNames: map[string]string{"success": " "}, wantErr: true},
+		{name: "two fields with one name", fieldNames: map[string]string{"files_deleted": "count", "files_skipped": "count"}, wantErr: true},
+		{name: "name of an unmapped field", fieldNames: map[string]string{"success": "message"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateResultFieldNames(tt.fieldNames)
+			if tt.wantErr && err == nil {
+				t.Error("Expected error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
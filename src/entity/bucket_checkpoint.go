@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+type (
+	// BucketCheckpoint records how far emptying a bucket has progressed for one cleansing message, so a retry of
+	// the message resumes after StartAfter instead of listing the bucket from the start
+	BucketCheckpoint struct {
+		Bucket        string    `json:"bucket" gorm:"column:bucket;size:63;primaryKey"`
+		CorrelationId string    `json:"correlation_id" gorm:"column:correlation_id;size:128;primaryKey"`
+		StartAfter    string    `json:"start_after" gorm:"column:start_after;size:1024;not null"`
+		Deleted       int       `json:"deleted" gorm:"column:deleted;not null"`
+		Protected     int       `json:"protected" gorm:"column:protected;not null"`
+		UpdatedAt     time.Time `json:"updated_at" gorm:"column:updated_at;not null"`
+	}
+)
+
+func (c BucketCheckpoint) TableName() string {
+	return "bucket_checkpoint"
+}
@@ -1,5 +1,12 @@
 package entity
 
+import "strings"
+
+const (
+	ContractorStatusInactive = int8(0)
+	ContractorStatusActive   = int8(1)
+)
+
 type (
 	Contractors []Contractor
 
@@ -21,6 +28,10 @@ type (
 		LambdaUrl             string `json:"lambda_url" gorm:"column:lambda_url"`
 		LambdaLog             string `json:"lambda_log" gorm:"column:lambda_log"`
 		ViewerNumber          uint8  `json:"viewer_number" gorm:"column:viewer_number"`
+
+		// Comma-separated further buckets of the contractor (e.g. an archive), in the region of AwsBucketName
+		AwsExtraBuckets string `json:"aws_extra_buckets" gorm:"column:aws_extra_buckets"`
+
 		MetaData
 	}
 )
@@ -33,6 +44,21 @@ func (c Contractor) PrimaryKey() string {
 	return "id"
 }
 
+// ExtraBuckets returns the names listed in AwsExtraBuckets, trimmed and without duplicates or AwsBucketName itself
+func (c Contractor) ExtraBuckets() []string {
+	var buckets []string
+	seen := map[string]bool{strings.TrimSpace(c.AwsBucketName): true}
+	for _, name := range strings.Split(c.AwsExtraBuckets, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		buckets = append(buckets, name)
+	}
+	return buckets
+}
+
 func (c Contractor) GetAllowedOrderFields() []string {
 	return []string{"id", "name", "status", "country_code", "created_at", "updated_at"}
 }
@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+type (
+	// ContractorLock is a lease on a contractor held by one worker instance, so instances sharing the database
+	// never cleanse the same contractor at once. A lease past ExpiresAt is free to take over.
+	ContractorLock struct {
+		ContractorId int64     `json:"contractor_id" gorm:"column:contractor_id;primaryKey;autoIncrement:false"`
+		Owner        string    `json:"owner" gorm:"column:owner;size:128;not null"`
+		ExpiresAt    time.Time `json:"expires_at" gorm:"column:expires_at;not null"`
+	}
+)
+
+func (c ContractorLock) TableName() string {
+	return "contractor_lock"
+}
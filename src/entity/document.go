@@ -1,8 +1,9 @@
 package entity
 
 type (
-	Documents   []Document
-	DocumentsV2 []DocumentV2
+	Documents         []Document
+	DocumentsV2       []DocumentV2
+	DocumentProcesses []DocumentProcess
 
 	DocumentV2 struct {
 		Id        int64  `json:"id" gorm:"column:id;primaryKey"`
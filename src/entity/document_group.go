@@ -1,5 +1,10 @@
 package entity
 
+const (
+	DocumentGroupStatusInactive = int8(0)
+	DocumentGroupStatusActive   = int8(1)
+)
+
 type (
 	DocumentGroups []DocumentGroup
 
@@ -12,7 +17,7 @@ type (
 		ProcessedErrCode string `json:"processed_err_code" gorm:"column:processed_err_code"`
 		ProcessedRemarks string `json:"processed_remarks" gorm:"column:processed_remarks"`
 		Category         string `json:"category" gorm:"column:category"`
-		Status           int8   `json:"status" gorm:"column:status"`
+		Status           int8   `json:"status" gorm:"column:status"` // 0: NOT ACTIVE, 1: ACTIVE
 		Showed           int8   `json:"showed" gorm:"column:showed"`
 		Progress         int8   `json:"progress" gorm:"column:progress"`
 		MetaData
@@ -45,6 +45,10 @@ type (
 	}
 )
 
+func (u UploaderContractorUsage) TableName() string {
+	return "uploader_contractor_usage"
+}
+
 func (f File) TableName() string {
 	return "file"
 }
@@ -1,5 +1,6 @@
 package entity
 
+// MetaData holds the audit columns shared by the tables; CreatedAt and UpdatedAt are Unix timestamps in seconds
 type MetaData struct {
 	CreatedAt int64 `json:"created_at" gorm:"column:created_at"`
 	UpdatedAt int64 `json:"updated_at" gorm:"column:updated_at"`
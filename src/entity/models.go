@@ -0,0 +1,19 @@
+package entity
+
+// Models returns the entities owned by this worker in dependency order, suitable for gorm AutoMigrate
+func Models() []interface{} {
+	return []interface{}{
+		&Contractor{},
+		&Project{},
+		&ContractorProject{},
+		&UserContractor{},
+		&ViewerContractor{},
+		&UploaderContractorUsage{},
+		&Site{},
+		&DocumentGroup{},
+		&Document{},
+		&File{},
+		&ContractorLock{},
+		&BucketCheckpoint{},
+	}
+}
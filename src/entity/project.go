@@ -7,6 +7,11 @@ const (
 	DefaultPCRSID   = int64(0)
 )
 
+const (
+	ProjectStatusInactive = int8(0)
+	ProjectStatusActive   = int8(1)
+)
+
 type (
 	Projects []Project
 
@@ -1,5 +1,10 @@
 package entity
 
+const (
+	SiteStatusInactive = int8(0)
+	SiteStatusActive   = int8(1)
+)
+
 type (
 	Sites   []Site
 	SitesV2 []SiteV2
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// truncateBody returns body for logging, cut to at most limit bytes without splitting a UTF-8 character and marked
+// with the number of bytes left out, and whether it was cut. A limit of 0 or less keeps the whole body.
+func truncateBody(body []byte, limit int) (string, bool) {
+	if limit <= 0 || len(body) <= limit {
+		return string(body), false
+	}
+
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s...(%d more bytes truncated)", body[:cut], len(body)-cut), true
+}
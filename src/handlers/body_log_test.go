@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nsqio/go-nsq"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestTruncateBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		limit         int
+		want          string
+		wantTruncated bool
+	}{
+		{name: "under the limit", body: `{"id":1}`, limit: 20, want: `{"id":1}`},
+		{name: "at the limit", body: `{"id":1}`, limit: 8, want: `{"id":1}`},
+		{name: "beyond the limit", body: `{"ids":[1,2,3,4,5]}`, limit: 10, want: `{"ids":[1,...(9 more bytes truncated)`, wantTruncated: true},
+		{name: "multibyte character kept whole", body: `{"code":"站点"}`, limit: 11, want: `{"code":"...(8 more bytes truncated)`, wantTruncated: true},
+		{name: "disabled", body: strings.Repeat("x", 5000), limit: 0, want: strings.Repeat("x", 5000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := truncateBody([]byte(tt.body), tt.limit)
+			if got != tt.want || truncated != tt.wantTruncated {
+				t.Errorf("Expected (%q, %v), got (%q, %v)", tt.want, tt.wantTruncated, got, truncated)
+			}
+		})
+	}
+}
+
+func TestMessageHandler_HandleMessage_TruncatesLoggedBody(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	level := log.GetLevel()
+	log.SetLevel(log.DebugLevel)
+	defer log.SetLevel(level)
+
+	ids := make([]string, 2000)
+	for i := range ids {
+		ids[i] = fmt.Sprint(i + 1)
+	}
+	body := `{"type":"site","id":7,"reason":"` + strings.Join(ids, ",") + `"}`
+
+	handler := NewMessageHandler(&mockCleansingService{}, &mockS3Service{})
+	handler.logBodyLimit = 64
+	if err := handler.HandleMessage(&nsq.Message{Body: []byte(body)}); err != nil {
+		t.Fatalf("HandleMessage() unexpected error: %v", err)
+	}
+
+	var received, full *log.Entry
+	for _, entry := range hook.AllEntries() {
+		switch entry.Message {
+		case "Received cleansing message":
+			received = entry
+		case "Full cleansing message body":
+			full = entry
+		}
+	}
+	if received == nil || full == nil {
+		t.Fatalf("Expected the received and full body log entries, got %+v and %+v", received, full)
+	}
+
+	logged, _ := received.Data["message_body"].(string)
+	if !strings.HasPrefix(logged, body[:64]) || !strings.HasSuffix(logged, fmt.Sprintf("...(%d more bytes truncated)", len(body)-64)) {
+		t.Errorf("Expected the info body truncated to 64 bytes, got %q", logged)
+	}
+	if received.Level != log.InfoLevel {
+		t.Errorf("Expected the truncated body at info level, got %s", received.Level)
+	}
+	if full.Level != log.DebugLevel || full.Data["message_body"] != body {
+		t.Errorf("Expected the full body at debug level only, got %s %v", full.Level, full.Data["message_body"])
+	}
+}
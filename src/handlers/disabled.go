@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"github.com/nsqio/go-nsq"
+	log "github.com/sirupsen/logrus"
+)
+
+// disabledTypes returns the message types cfg disables. Expired bucket follow-ups finish a contractor cleansing and
+// manifests delete from a contractor's bucket, so they stop along with contractor messages.
+func disabledTypes(cfg *config.Config) map[string]bool {
+	disabled := make(map[string]bool)
+	if isDisabled(cfg.EnableContractor) {
+		disabled[dto.CleansingTypeContractor] = true
+		disabled[dto.CleansingTypeExpiredBucket] = true
+		disabled[dto.CleansingTypeManifest] = true
+	}
+	if isDisabled(cfg.EnableProject) {
+		disabled[dto.CleansingTypeProject] = true
+	}
+	if isDisabled(cfg.EnableSite) {
+		disabled[dto.CleansingTypeSite] = true
+	}
+	return disabled
+}
+
+// isDisabled reports whether an enable flag is explicitly false; an unset flag enables its type
+func isDisabled(enabled *bool) bool {
+	return enabled != nil && !*enabled
+}
+
+// deferDisabled holds back a message of a disabled type without processing or dropping it. It is republished to
+// the worker topic as a new message delivered after disabledTypeDelay, so however long the type stays disabled the
+// message never runs out of attempts; should that fail, this delivery is requeued with the same delay instead.
+func (h *MessageHandler) deferDisabled(ctx context.Context, message *nsq.Message, cleansingMsg dto.CleansingMessage, correlationID string) error {
+	logger := workerLog.GetLoggerFromContext(ctx).WithFields(log.Fields{
+		"type":  cleansingMsg.Type,
+		"id":    cleansingMsg.ID,
+		"delay": h.disabledTypeDelay.String(),
+	})
+
+	if err := h.republishDeferred(cleansingMsg, correlationID); err != nil {
+		logger.WithError(err).Warn("Failed to republish message of a disabled type, requeueing it")
+		message.RequeueWithoutBackoff(h.disabledTypeDelay)
+		return nil
+	}
+	logger.WithField("topic", h.topic).Info("Cleansing type is disabled, deferred message")
+	return nil
+}
+
+// republishDeferred publishes message to the worker topic for delivery after disabledTypeDelay, keeping the
+// correlation ID of this attempt
+func (h *MessageHandler) republishDeferred(message dto.CleansingMessage, correlationID string) error {
+	if h.followUps == nil || h.topic == "" {
+		return errors.New("no publisher configured for the worker topic")
+	}
+
+	if message.CorrelationID == "" {
+		message.CorrelationID = correlationID
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	if err := h.followUps.DeferredPublish(h.topic, h.disabledTypeDelay, body); err != nil {
+		return fmt.Errorf("failed to publish message to %s: %w", h.topic, err)
+	}
+	return nil
+}
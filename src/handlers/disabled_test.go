@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/nsqio/go-nsq"
+)
+
+func TestMessageHandler_HandleMessage_DisabledTypes(t *testing.T) {
+	enabled, disabled := true, false
+	bodies := map[string]string{
+		dto.CleansingTypeContractor:    `{"type":"contractor","id":1}`,
+		dto.CleansingTypeExpiredBucket: `{"type":"expired_bucket","id":1,"bucket_name":"test-bucket"}`,
+		dto.CleansingTypeManifest:      `{"type":"manifest","id":1,"manifest_bucket":"audit-bucket","manifest_key":"keys.txt"}`,
+		dto.CleansingTypeProject:       `{"type":"project","id":2}`,
+		dto.CleansingTypeSite:          `{"type":"site","id":3}`,
+	}
+
+	tests := []struct {
+		name         string
+		cfg          config.Config
+		wantDeferred []string
+	}{
+		{name: "unset flags enable every type"},
+		{name: "every type enabled", cfg: config.Config{EnableContractor: &enabled, EnableProject: &enabled, EnableSite: &enabled}},
+		{name: "contractor disabled", cfg: config.Config{EnableContractor: &disabled},
+			wantDeferred: []string{dto.CleansingTypeContractor, dto.CleansingTypeExpiredBucket, dto.CleansingTypeManifest}},
+		{name: "project disabled", cfg: config.Config{EnableProject: &disabled}, wantDeferred: []string{dto.CleansingTypeProject}},
+		{name: "site disabled", cfg: config.Config{EnableSite: &disabled}, wantDeferred: []string{dto.CleansingTypeSite}},
+	}
+
+	for _, tt := range tests {
+		for msgType, body := range bodies {
+			t.Run(fmt.Sprintf("%s/%s", tt.name, msgType), func(t *testing.T) {
+				cfg := tt.cfg
+				cfg.TopicName = "data-cleansing"
+				cfg.DisabledTypeDelay = 10 * time.Minute
+				publisher := &mockDeferredPublisher{}
+				handler := NewMessageHandlerWithConfig(&cfg, &mockCleansingService{}, &mockS3Service{})
+				handler.followUps = publisher
+
+				wantDeferred := false
+				for _, deferred := range tt.wantDeferred {
+					wantDeferred = wantDeferred || deferred == msgType
+				}
+
+				if err := handler.HandleMessage(&nsq.Message{Body: []byte(body)}); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				if !wantDeferred {
+					if handler.messagesSucceeded.Load() != 1 || len(publisher.bodies) != 0 {
+						t.Errorf("Expected the message to be processed, got %d succeeded and %d deferred",
+							handler.messagesSucceeded.Load(), len(publisher.bodies))
+					}
+					return
+				}
+
+				if handler.messagesSucceeded.Load() != 0 || handler.messagesFailed.Load() != 0 {
+					t.Errorf("Expected the message not to be processed, got %d succeeded and %d failed",
+						handler.messagesSucceeded.Load(), handler.messagesFailed.Load())
+				}
+				if len(publisher.bodies) != 1 || publisher.topics[0] != "data-cleansing" || publisher.delays[0] != 10*time.Minute {
+					t.Fatalf("Expected the message to be deferred 10m on data-cleansing, got %v %v", publisher.topics, publisher.delays)
+				}
+				var deferred dto.CleansingMessage
+				if err := json.Unmarshal(publisher.bodies[0], &deferred); err != nil {
+					t.Fatalf("Deferred message is not JSON: %v", err)
+				}
+				if deferred.Type != msgType || deferred.CorrelationID == "" {
+					t.Errorf("Expected the %s message with a correlation ID, got %+v", msgType, deferred)
+				}
+			})
+		}
+	}
+}
+
+func TestMessageHandler_HandleMessage_DisabledTypeRequeued(t *testing.T) {
+	disabled := false
+	cfg := &config.Config{TopicName: "data-cleansing", EnableSite: &disabled, DisabledTypeDelay: 10 * time.Minute}
+	handler := NewMessageHandlerWithConfig(cfg, &mockCleansingService{}, &mockS3Service{})
+	handler.followUps = &mockDeferredPublisher{err: errors.New("connection refused")}
+
+	delegate := &recordingDelegate{}
+	message := nsq.NewMessage(nsq.MessageID{}, []byte(`{"type":"site","id":3}`))
+	message.Delegate = delegate
+
+	if err := handler.HandleMessage(message); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !delegate.requeued || delegate.delay != 10*time.Minute || delegate.backoff {
+		t.Errorf("Expected the message to be requeued after 10m without backoff, got %+v", delegate)
+	}
+	if handler.messagesSucceeded.Load() != 0 || handler.messagesFailed.Load() != 0 {
+		t.Error("Expected the message not to be processed")
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	log "github.com/sirupsen/logrus"
+)
+
+// DeferredPublisher is the subset of *nsq.Producer used to schedule follow-up messages, allowing it to be mocked
+type DeferredPublisher interface {
+	DeferredPublish(topic string, delay time.Duration, body []byte) error
+}
+
+// scheduleFollowUp publishes a follow-up message to the worker topic. The follow-up of a bucket left to expire
+// is delivered after the follow-up delay, giving S3 time to empty it; the continuation of a paused operation
+// is delivered straight away.
+func (h *MessageHandler) scheduleFollowUp(ctx context.Context, message dto.CleansingMessage) error {
+	if h.followUps == nil {
+		return errors.New("no publisher configured for follow-up messages")
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode follow-up message: %w", err)
+	}
+	delay := h.followUpDelay
+	if message.Type != dto.CleansingTypeExpiredBucket {
+		delay = 0
+	}
+	if err := h.followUps.DeferredPublish(h.topic, delay, body); err != nil {
+		return fmt.Errorf("failed to publish follow-up message to %s: %w", h.topic, err)
+	}
+
+	workerLog.GetLoggerFromContext(ctx).WithFields(log.Fields{
+		"type":  message.Type,
+		"id":    message.ID,
+		"delay": delay,
+	}).Info("Scheduled follow-up message")
+	return nil
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/nsqio/go-nsq"
+)
+
+// mockDeferredPublisher records deferred publishes and fails with err when set
+type mockDeferredPublisher struct {
+	topics []string
+	delays []time.Duration
+	bodies [][]byte
+	err    error
+}
+
+func (m *mockDeferredPublisher) DeferredPublish(topic string, delay time.Duration, body []byte) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.topics = append(m.topics, topic)
+	m.delays = append(m.delays, delay)
+	m.bodies = append(m.bodies, body)
+	return nil
+}
+
+func TestMessageHandler_HandleMessage_FollowUp(t *testing.T) {
+	followUp := &dto.CleansingMessage{Type: dto.CleansingTypeExpiredBucket, ID: 1, BucketName: "test-bucket", CorrelationID: "cleansing-1"}
+
+	tests := []struct {
+		name        string
+		followUp    *dto.CleansingMessage
+		publishErr  error
+		wantPublish bool
+	}{
+		{name: "follow-up is scheduled", followUp: followUp, wantPublish: true},
+		{name: "no follow-up", followUp: nil},
+		{name: "publish failure does not fail the message", followUp: followUp, publishErr: errors.New("connection refused")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &mockDeferredPublisher{err: tt.publishErr}
+			handler := NewMessageHandler(&mockCleansingService{followUp: tt.followUp}, &mockS3Service{})
+			handler.followUps = publisher
+			handler.topic = "data-cleansing"
+			handler.followUpDelay = time.Hour
+
+			if err := handler.HandleMessage(&nsq.Message{Body: []byte(`{"type":"contractor","id":1}`)}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if handler.messagesSucceeded.Load() != 1 {
+				t.Errorf("Expected the message to succeed, got %d succeeded", handler.messagesSucceeded.Load())
+			}
+
+			if !tt.wantPublish {
+				if len(publisher.bodies) != 0 {
+					t.Errorf("Expected nothing published, got %d messages", len(publisher.bodies))
+				}
+				return
+			}
+			if len(publisher.bodies) != 1 {
+				t.Fatalf("Expected one follow-up published, got %d", len(publisher.bodies))
+			}
+			if publisher.topics[0] != "data-cleansing" || publisher.delays[0] != time.Hour {
+				t.Errorf("Expected a 1h deferred publish to data-cleansing, got %s after %v", publisher.topics[0], publisher.delays[0])
+			}
+
+			published, err := dto.DecodeCleansingMessage(publisher.bodies[0])
+			if err != nil {
+				t.Fatalf("Follow-up is not a valid cleansing message: %v", err)
+			}
+			if published != *tt.followUp || !published.IsValidType() {
+				t.Errorf("Expected follow-up %+v, got %+v", *tt.followUp, published)
+			}
+		})
+	}
+}
+
+func TestMessageHandler_ScheduleFollowUp_NoPublisher(t *testing.T) {
+	handler := NewMessageHandler(&mockCleansingService{}, &mockS3Service{})
+
+	if err := handler.scheduleFollowUp(t.Context(), dto.CleansingMessage{Type: dto.CleansingTypeExpiredBucket, ID: 1, BucketName: "test-bucket"}); err == nil {
+		t.Error("Expected error without a publisher")
+	}
+}
+
+func TestNewMessageHandlerWithConfig_FollowUps(t *testing.T) {
+	handler := NewMessageHandlerWithConfig(&config.Config{NsqServer: "127.0.0.1:4150", TopicName: "data-cleansing", BucketDeleteDelay: time.Hour}, &mockCleansingService{}, &mockS3Service{})
+	if handler.followUps == nil {
+		t.Error("Expected an NSQ producer for follow-up messages")
+	}
+	if handler.topic != "data-cleansing" || handler.followUpDelay != time.Hour {
+		t.Errorf("Expected follow-ups to data-cleansing after 1h, got %s after %v", handler.topic, handler.followUpDelay)
+	}
+}
+
+func TestMessageHandler_HandleMessage_ContinuationPublishedImmediately(t *testing.T) {
+	continuation := &dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 1, CorrelationID: "cleansing-1", ResumeAfter: "P1/S1/00_Upload/z.txt"}
+	publisher := &mockDeferredPublisher{}
+	handler := NewMessageHandler(&mockCleansingService{followUp: continuation}, &mockS3Service{})
+	handler.followUps = publisher
+	handler.topic = "data-cleansing"
+	handler.followUpDelay = time.Hour
+
+	if err := handler.HandleMessage(&nsq.Message{Body: []byte(`{"type":"contractor","id":1}`)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(publisher.bodies) != 1 {
+		t.Fatalf("Expected the continuation published, got %d messages", len(publisher.bodies))
+	}
+	if publisher.topics[0] != "data-cleansing" || publisher.delays[0] != 0 {
+		t.Errorf("Expected an immediate publish to data-cleansing, got %s after %v", publisher.topics[0], publisher.delays[0])
+	}
+
+	published, err := dto.DecodeCleansingMessage(publisher.bodies[0])
+	if err != nil {
+		t.Fatalf("Continuation is not a valid cleansing message: %v", err)
+	}
+	if published != *continuation {
+		t.Errorf("Expected continuation %+v, got %+v", *continuation, published)
+	}
+}
@@ -3,12 +3,18 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
 	"github.com/denys89/wadugs-worker-cleansing/src/dto"
 	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"github.com/denys89/wadugs-worker-cleansing/src/metrics"
 	"github.com/denys89/wadugs-worker-cleansing/src/service"
+	"github.com/denys89/wadugs-worker-cleansing/src/tracing"
 	"github.com/nsqio/go-nsq"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,6 +23,51 @@ type (
 	MessageHandler struct {
 		cleansingService service.CleansingService
 		s3Service        service.S3Service
+		maxAttempts      uint16   // NSQ max attempts; the final attempt is dropped instead of processed. 0 disables the check
+		notifier         Notifier // Told about every processed message's result; nil disables notifications
+
+		// Follow-up messages of a result are published to topic, delivered after followUpDelay
+		followUps     DeferredPublisher
+		topic         string
+		followUpDelay time.Duration
+
+		// Low priority messages are republished to lowPriorityTopic, when set, for a separate handler pool
+		router           Publisher
+		lowPriorityTopic string
+
+		// Every result, including that of a message rejected as invalid, is published to resultsTopic when set,
+		// with its top-level fields renamed by resultFieldNames as for the webhook
+		results          Publisher
+		resultsTopic     string
+		resultFieldNames map[string]string
+
+		// producer backs followUps, router and results when created by NewMessageHandlerWithConfig; Stop stops it
+		producer *nsq.Producer
+
+		// Retryable failures are requeued after requeueBaseDelay, doubled per earlier attempt up to requeueMaxDelay;
+		// a zero base delay leaves the delay to NSQ
+		requeueBaseDelay time.Duration
+		requeueMaxDelay  time.Duration
+
+		// Messages processed in slowThreshold or longer are logged as a warning and counted; 0 disables this
+		slowThreshold time.Duration
+
+		// Message bodies are logged at info level up to logBodyLimit bytes, in full at debug level; 0 disables the limit
+		logBodyLimit int
+
+		// The completion log keeps the logSummaryLimit largest entries of a result's summary; 0 disables the limit
+		logSummaryLimit int
+
+		// Messages of a type in disabledTypes are deferred by disabledTypeDelay instead of being processed
+		disabledTypes     map[string]bool
+		disabledTypeDelay time.Duration
+
+		// Counters reported by LogStats and Snapshot
+		messagesProcessed atomic.Int64
+		messagesSucceeded atomic.Int64
+		messagesFailed    atomic.Int64
+		messagesRouted    atomic.Int64
+		filesDeleted      atomic.Int64
 	}
 )
 
@@ -28,56 +79,233 @@ func NewMessageHandler(cleansingService service.CleansingService, s3Service serv
 	}
 }
 
+// NewMessageHandlerWithConfig creates a new message handler instance configured from cfg
+func NewMessageHandlerWithConfig(cfg *config.Config, cleansingService service.CleansingService, s3Service service.S3Service) *MessageHandler {
+	handler := NewMessageHandler(cleansingService, s3Service)
+	handler.maxAttempts = cfg.MaxRequeueAttempt
+	if cfg.WebhookURL != "" {
+		notifier := NewWebhookNotifier(cfg.WebhookURL, cfg.WebhookTimeout)
+		notifier.fieldNames = cfg.ResultFieldNames
+		handler.notifier = notifier
+	}
+
+	// The producer only connects on its first publish; follow-ups may still arrive after the bucket cleanup
+	// strategy is switched back, so it is created whatever the strategy
+	producer, err := nsq.NewProducer(cfg.NsqServer, nsq.NewConfig())
+	if err != nil {
+		log.WithError(err).Error("Failed to create NSQ producer, follow-up messages cannot be scheduled")
+	} else {
+		handler.producer = producer
+		handler.followUps = producer
+		handler.router = producer
+		handler.results = producer
+	}
+	handler.topic = cfg.TopicName
+	handler.followUpDelay = cfg.BucketDeleteDelay
+	handler.lowPriorityTopic = cfg.LowPriorityTopic
+	handler.resultsTopic = cfg.ResultsTopic
+	handler.resultFieldNames = cfg.ResultFieldNames
+	handler.requeueBaseDelay = cfg.RequeueBaseDelay
+	handler.requeueMaxDelay = cfg.RequeueMaxDelay
+	handler.slowThreshold = cfg.SlowThreshold
+	handler.logBodyLimit = cfg.LogBodyLimit
+	handler.logSummaryLimit = cfg.LogSummaryLimit
+	handler.disabledTypes = disabledTypes(cfg)
+	handler.disabledTypeDelay = cfg.DisabledTypeDelay
+	return handler
+}
+
+// Stop stops the handler's NSQ producer, if it created one, once its pending publishes are done.
+// It must only be called after the consumers feeding the handler have stopped.
+func (h *MessageHandler) Stop() {
+	if h.producer != nil {
+		h.producer.Stop()
+	}
+}
+
 // HandleMessage processes incoming NSQ messages for cleansing operations
 func (h *MessageHandler) HandleMessage(message *nsq.Message) error {
-	// Create context with correlation ID for tracing
+	// Create context with correlation ID for tracing; redeliveries share the NSQ message ID,
+	// so retries keep the correlation ID (and can resume checkpointed work)
 	correlationID := fmt.Sprintf("cleansing-%d", time.Now().UnixNano())
+	if message.ID != (nsq.MessageID{}) {
+		correlationID = "cleansing-" + string(message.ID[:])
+	}
 	ctx := context.Background()
 	ctx = workerLog.WithLogger(ctx, correlationID)
+	h.messagesProcessed.Add(1)
+
+	// Every span of this message descends from this one
+	ctx, span := tracing.Start(ctx, "cleansing.message", attribute.Int("nsq.attempts", int(message.Attempts)))
+	defer span.End()
 	
 	logger := workerLog.GetLoggerFromContext(ctx)
+	body, truncated := truncateBody(message.Body, h.logBodyLimit)
 	logger.WithFields(log.Fields{
 		"message_id":      string(message.ID[:]),
-		"message_body":    string(message.Body),
+		"message_body":    body,
 		"correlation_id":  correlationID,
 		"attempts":        message.Attempts,
 	}).Info("Received cleansing message")
+	if truncated {
+		logger.WithField("message_body", string(message.Body)).Debug("Full cleansing message body")
+	}
+
+	// Every earlier attempt failed, and NSQ drops the message after this one whatever its outcome,
+	// so rather than run the whole traversal once more the message is acknowledged and logged
+	if h.isFinalRetry(message) {
+		logger.WithFields(log.Fields{
+			"attempts":     message.Attempts,
+			"max_attempts": h.maxAttempts,
+		}).Error("Final attempt reached, dropping cleansing message without reprocessing")
+		return h.handleError(ctx, errors.New("max attempts reached"), false)
+	}
 
 	// Parse the message payload
-	var cleansingMsg dto.CleansingMessage
-	if err := json.Unmarshal(message.Body, &cleansingMsg); err != nil {
+	cleansingMsg, err := dto.DecodeCleansingMessage(message.Body)
+	if err != nil {
 		logger.WithError(err).Error("Failed to unmarshal cleansing message")
-		return h.handleError(ctx, fmt.Errorf("invalid message format: %w", err), false)
+		return h.rejectMessage(ctx, message, cleansingMsg, decodeErrorCode(err), fmt.Errorf("invalid message format: %w", err))
+	}
+
+	// A replayed message keeps the correlation ID of its original attempt
+	if cleansingMsg.CorrelationID != "" {
+		ctx = workerLog.WithLogger(ctx, cleansingMsg.CorrelationID)
+		logger = workerLog.GetLoggerFromContext(ctx)
+		span.SetAttributes(attribute.String("correlation_id", cleansingMsg.CorrelationID))
 	}
+	span.SetAttributes(
+		attribute.String("cleansing.type", cleansingMsg.Type),
+		attribute.Int64("cleansing.id", cleansingMsg.ID),
+	)
 
 	// Validate message type
 	if !cleansingMsg.IsValidType() {
 		logger.WithField("type", cleansingMsg.Type).Error("Invalid cleansing message type")
-		return h.handleError(ctx, fmt.Errorf("invalid message type: %s", cleansingMsg.Type), false)
+		return h.rejectMessage(ctx, message, cleansingMsg, dto.ErrorCodeInvalidType, fmt.Errorf("invalid message type: %s", cleansingMsg.Type))
+	}
+	if !cleansingMsg.IsValidScope() {
+		logger.WithField("scope", cleansingMsg.Scope).Error("Invalid cleansing message scope")
+		return h.rejectMessage(ctx, message, cleansingMsg, dto.ErrorCodeInvalidField, fmt.Errorf("invalid message scope: %s", cleansingMsg.Scope))
+	}
+	if !cleansingMsg.IsValidPriority() {
+		logger.WithField("priority", cleansingMsg.Priority).Error("Invalid cleansing message priority")
+		return h.rejectMessage(ctx, message, cleansingMsg, dto.ErrorCodeInvalidField, fmt.Errorf("invalid message priority: %s", cleansingMsg.Priority))
+	}
+	if !cleansingMsg.IsValidSkipS3() {
+		logger.WithField("type", cleansingMsg.Type).Error("Invalid cleansing message skip_s3")
+		return h.rejectMessage(ctx, message, cleansingMsg, dto.ErrorCodeInvalidField, errors.New("skip_s3 only applies to a full contractor, project or site cleansing"))
+	}
+	if !cleansingMsg.IsValidCreatedWindow() {
+		logger.WithFields(log.Fields{
+			"created_after":  cleansingMsg.CreatedAfter,
+			"created_before": cleansingMsg.CreatedBefore,
+		}).Error("Invalid cleansing message created window")
+		return h.rejectMessage(ctx, message, cleansingMsg, dto.ErrorCodeInvalidField, errors.New("created_after must be earlier than created_before, on a contractor, project or site cleansing"))
+	}
+	priority := cleansingMsg.EffectivePriority()
+
+	// A disabled type waits for the type to be enabled again
+	if h.disabledTypes[cleansingMsg.Type] {
+		metrics.CleansingMessages.WithLabelValues(priority, "deferred").Inc()
+		return h.deferDisabled(ctx, message, cleansingMsg, correlationID)
+	}
+
+	// Heavy low priority work is handed to its own pool so it cannot hold up the messages behind it here;
+	// should that fail the message is processed in this pool instead
+	if h.routesToLowPriority(priority) {
+		if err := h.routeToLowPriority(cleansingMsg, correlationID); err != nil {
+			logger.WithError(err).Warn("Failed to route low priority message, processing it here")
+		} else {
+			h.messagesRouted.Add(1)
+			metrics.CleansingMessages.WithLabelValues(priority, "routed").Inc()
+			logger.WithFields(log.Fields{
+				"type":  cleansingMsg.Type,
+				"id":    cleansingMsg.ID,
+				"topic": h.lowPriorityTopic,
+			}).Info("Routed low priority cleansing message")
+			return nil
+		}
 	}
 
 	logger.WithFields(log.Fields{
-		"type": cleansingMsg.Type,
-		"id":   cleansingMsg.ID,
+		"type":     cleansingMsg.Type,
+		"id":       cleansingMsg.ID,
+		"priority": priority,
 	}).Info("Processing cleansing request")
 
 	// Process the cleansing operation
+	started := time.Now()
 	result, err := h.processCleansingMessage(ctx, cleansingMsg)
+	elapsed := time.Since(started)
+	h.reportSlow(ctx, cleansingMsg, result, elapsed)
+	if result != nil {
+		h.filesDeleted.Add(int64(result.FilesDeleted))
+		result.IdempotencyKey = cleansingMsg.IdempotencyKey(workerLog.CorrelationIDFromContext(ctx))
+		h.notify(ctx, result)
+	}
 	if err != nil {
 		logger.WithError(err).Error("Failed to process cleansing message")
-		return h.handleError(ctx, err, true) // Retry on processing errors
+		metrics.CleansingMessages.WithLabelValues(priority, "failed").Inc()
+		// Retry on processing errors, except refusals that would fail the same way again
+		if !errors.Is(err, service.ErrObjectLimitExceeded) && !errors.Is(err, service.ErrBucketNotOwned) &&
+			!errors.Is(err, service.ErrInvalidBucketName) && !errors.Is(err, service.ErrOrphanedRecords) &&
+			!errors.Is(err, service.ErrContractorNotFound) && !errors.Is(err, service.ErrConfirmationRequired) &&
+			!errors.Is(err, service.ErrS3Permanent) && !errors.Is(err, service.ErrNoBucket) &&
+			!errors.Is(err, service.ErrDeleteInputTooLarge) && !errors.Is(err, service.ErrUnusableKeyCode) &&
+			!errors.Is(err, service.ErrInvalidManifest) && !errors.Is(err, service.ErrBucketNotAllowed) {
+			return h.retry(ctx, message, err)
+		}
+		return h.handleError(ctx, err, false)
+	}
+
+	// Retrying would not help once the operation itself succeeded, so a follow-up that cannot be scheduled is
+	// logged with its payload for a manual replay instead
+	if result.FollowUp != nil {
+		if err := h.scheduleFollowUp(ctx, *result.FollowUp); err != nil {
+			followUp, _ := json.Marshal(result.FollowUp)
+			logger.WithError(err).WithField("follow_up", string(followUp)).Error("Failed to schedule follow-up message")
+		}
 	}
 
 	// Log the result
+	summary, omitted := limitSummary(result.Summary, h.logSummaryLimit)
 	logger.WithFields(log.Fields{
-		"success":       result.Success,
-		"files_deleted": result.FilesDeleted,
-		"message":       result.Message,
+		"success":         result.Success,
+		"files_deleted":   result.FilesDeleted,
+		"files_skipped":   result.FilesSkipped,
+		"skipped_reasons": result.SkippedReasons,
+		"summary":         summary,
+		"summary_omitted": omitted,
+		"message":         result.Message,
+		"duration_ms":     elapsed.Milliseconds(),
 	}).Info("Completed cleansing operation")
 
+	h.messagesSucceeded.Add(1)
+	metrics.CleansingMessages.WithLabelValues(priority, "succeeded").Inc()
 	return nil
 }
 
+// notify passes result to the notifier and the results topic, if any. A failing notification is only logged; it
+// never fails the message.
+func (h *MessageHandler) notify(ctx context.Context, result *dto.CleansingResult) {
+	if err := h.publishResult(result); err != nil {
+		workerLog.GetLoggerFromContext(ctx).WithError(err).Warn("Failed to publish cleansing result")
+	}
+	if h.notifier == nil {
+		return
+	}
+	if err := h.notifier.Notify(ctx, result); err != nil {
+		workerLog.GetLoggerFromContext(ctx).WithError(err).Warn("Failed to send cleansing notification")
+	}
+}
+
+// isFinalRetry reports whether a redelivered message is on its last allowed attempt. A first delivery is
+// always processed, even when only one attempt is allowed.
+func (h *MessageHandler) isFinalRetry(message *nsq.Message) bool {
+	return h.maxAttempts > 1 && message.Attempts >= h.maxAttempts
+}
+
 // processCleansingMessage processes a cleansing message and returns the result
 func (h *MessageHandler) processCleansingMessage(ctx context.Context, msg dto.CleansingMessage) (*dto.CleansingResult, error) {
 	logger := workerLog.GetLoggerFromContext(ctx)
@@ -112,6 +340,8 @@ func (h *MessageHandler) processCleansingMessage(ctx context.Context, msg dto.Cl
 // handleError handles errors during message processing
 func (h *MessageHandler) handleError(ctx context.Context, err error, shouldRetry bool) error {
 	logger := workerLog.GetLoggerFromContext(ctx)
+	h.messagesFailed.Add(1)
+	tracing.RecordError(ctx, err)
 	
 	if shouldRetry {
 		logger.WithError(err).Error("Retryable error occurred during message processing")
@@ -126,8 +356,14 @@ func (h *MessageHandler) handleError(ctx context.Context, err error, shouldRetry
 
 // LogStats logs handler statistics (can be called periodically)
 func (h *MessageHandler) LogStats() {
+	stats := h.Snapshot()
 	log.WithFields(log.Fields{
-		"handler": "cleansing",
-		"status":  "active",
+		"handler":            "cleansing",
+		"status":             "active",
+		"messages_processed": stats.MessagesProcessed,
+		"messages_succeeded": stats.MessagesSucceeded,
+		"messages_failed":    stats.MessagesFailed,
+		"messages_routed":    stats.MessagesRouted,
+		"files_deleted":      stats.FilesDeleted,
 	}).Info("Message handler statistics")
 }
\ No newline at end of file
@@ -4,20 +4,40 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
 	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/service"
 	"github.com/nsqio/go-nsq"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 // Mock services for testing
 type mockCleansingService struct {
 	shouldError   bool
 	errorMsg      string
+	err           error // Returned instead of errorMsg when set
 	filesDeleted  int
+	skipped       map[string]int         // Added to successful results as skipped files
+	followUp      *dto.CleansingMessage // Set as the follow-up of successful results
+	delay         time.Duration         // Slept before returning, to simulate a slow operation
+
+	removed []dto.S3Object // Counted in the summary of successful results
 }
 
 func (m *mockCleansingService) ProcessCleansingMessage(ctx context.Context, message dto.CleansingMessage) (*dto.CleansingResult, error) {
+	time.Sleep(m.delay)
+	if m.err != nil {
+		return &dto.CleansingResult{Type: message.Type, ID: message.ID, Error: m.err.Error()}, m.err
+	}
 	if m.shouldError {
 		return &dto.CleansingResult{
 			Type:    message.Type,
@@ -26,13 +46,26 @@ func (m *mockCleansingService) ProcessCleansingMessage(ctx context.Context, mess
 			Error:   m.errorMsg,
 		}, errors.New(m.errorMsg)
 	}
-	return &dto.CleansingResult{
+	result := &dto.CleansingResult{
 		Type:         message.Type,
 		ID:           message.ID,
 		Success:      true,
 		Message:      "Cleansing completed successfully",
 		FilesDeleted: m.filesDeleted,
-	}, nil
+		FollowUp:     m.followUp,
+	}
+	for reason, n := range m.skipped {
+		result.AddSkipped(reason, n)
+	}
+	result.AddRemoved(m.removed)
+	return result, nil
+}
+
+func (m *mockCleansingService) BuildDeletionContext(ctx context.Context, message dto.CleansingMessage) (*dto.DeletionContext, error) {
+	if m.shouldError {
+		return nil, errors.New(m.errorMsg)
+	}
+	return &dto.DeletionContext{Type: message.Type, ID: message.ID, Description: message.GetDescription()}, nil
 }
 
 // Add the missing methods to match the CleansingService interface
@@ -48,6 +81,14 @@ func (m *mockCleansingService) DeleteSiteFiles(ctx context.Context, siteID int64
 	return m.ProcessCleansingMessage(ctx, dto.CleansingMessage{Type: "site", ID: siteID})
 }
 
+func (m *mockCleansingService) DeleteObjectsDirect(ctx context.Context, bucket string, keys []string) (*dto.CleansingResult, error) {
+	return m.ProcessCleansingMessage(ctx, dto.CleansingMessage{Type: "contractor"})
+}
+
+func (m *mockCleansingService) SweepInactive(ctx context.Context, cleansingType string, olderThan int64) ([]*dto.CleansingResult, error) {
+	return nil, nil
+}
+
 type mockS3Service struct {
 	shouldError   bool
 	errorMsg      string
@@ -55,27 +96,52 @@ type mockS3Service struct {
 	deleteCount   int
 }
 
-func (m *mockS3Service) ListContractorFiles(ctx context.Context, contractorID int64) ([]dto.S3Object, error) {
+func (m *mockS3Service) ListContractorFiles(ctx context.Context, contractorID int64, opts ...service.FileOption) ([]dto.S3Object, error) {
 	if m.shouldError {
 		return nil, errors.New(m.errorMsg)
 	}
 	return m.filesToReturn, nil
 }
 
-func (m *mockS3Service) ListProjectFiles(ctx context.Context, projectID int64) ([]dto.S3Object, error) {
+func (m *mockS3Service) ListProjectFiles(ctx context.Context, projectID int64, opts ...service.FileOption) ([]dto.S3Object, error) {
 	if m.shouldError {
 		return nil, errors.New(m.errorMsg)
 	}
 	return m.filesToReturn, nil
 }
 
-func (m *mockS3Service) ListSiteFiles(ctx context.Context, siteID int64) ([]dto.S3Object, error) {
+func (m *mockS3Service) ListSiteFiles(ctx context.Context, siteID int64, opts ...service.FileOption) ([]dto.S3Object, error) {
 	if m.shouldError {
 		return nil, errors.New(m.errorMsg)
 	}
 	return m.filesToReturn, nil
 }
 
+func (m *mockS3Service) ListObjectsWithPrefix(ctx context.Context, bucket, prefix string) ([]dto.S3Object, error) {
+	if m.shouldError {
+		return nil, errors.New(m.errorMsg)
+	}
+	return m.filesToReturn, nil
+}
+
+func (m *mockS3Service) ListObjectsWithPrefixes(ctx context.Context, prefixes []service.BucketPrefix) ([]dto.S3Object, error) {
+	if m.shouldError {
+		return nil, errors.New(m.errorMsg)
+	}
+	return m.filesToReturn, nil
+}
+
+func (m *mockS3Service) BucketExists(ctx context.Context, bucket, region string) (bool, error) {
+	if m.shouldError {
+		return false, errors.New(m.errorMsg)
+	}
+	return true, nil
+}
+
+func (m *mockS3Service) FilterProtected(objects []dto.S3Object) (deletable, protected []dto.S3Object) {
+	return objects, nil
+}
+
 func (m *mockS3Service) DeleteObjects(ctx context.Context, objects []dto.S3Object) (int, error) {
 	if m.shouldError {
 		return 0, errors.New(m.errorMsg)
@@ -83,14 +149,76 @@ func (m *mockS3Service) DeleteObjects(ctx context.Context, objects []dto.S3Objec
 	return m.deleteCount, nil
 }
 
+func (m *mockS3Service) DeleteObjectsByBucket(ctx context.Context, objects []dto.S3Object) ([]dto.BucketDeleteResult, error) {
+	if m.shouldError {
+		return nil, errors.New(m.errorMsg)
+	}
+	return []dto.BucketDeleteResult{{Deleted: m.deleteCount}}, nil
+}
+
+func (m *mockS3Service) DeleteObjectsStream(ctx context.Context, objects <-chan dto.S3Object) (int, error) {
+	for range objects {
+	}
+	if m.shouldError {
+		return 0, errors.New(m.errorMsg)
+	}
+	return m.deleteCount, nil
+}
+
+func (m *mockS3Service) VerifyBucketOwner(ctx context.Context, bucketName, region string, contractorID int64) error {
+	return nil
+}
+
 // Add the missing DeleteBucket method to match the S3Service interface
-func (m *mockS3Service) DeleteBucket(ctx context.Context, bucketName string) error {
+func (m *mockS3Service) DeleteBucket(ctx context.Context, bucketName, region string, contractorID int64) error {
+	if m.shouldError {
+		return errors.New(m.errorMsg)
+	}
+	return nil
+}
+
+func (m *mockS3Service) QuarantineObjects(ctx context.Context, objects []dto.S3Object) (int, error) {
+	if m.shouldError {
+		return 0, errors.New(m.errorMsg)
+	}
+	return len(objects), nil
+}
+
+func (m *mockS3Service) EmptyBucket(ctx context.Context, bucketName, region string, contractorID int64) error {
 	if m.shouldError {
 		return errors.New(m.errorMsg)
 	}
 	return nil
 }
 
+func (m *mockS3Service) PutObject(ctx context.Context, bucket, key string, body []byte, contentType string) error {
+	if m.shouldError {
+		return errors.New(m.errorMsg)
+	}
+	return nil
+}
+
+func (m *mockS3Service) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	if m.shouldError {
+		return nil, errors.New(m.errorMsg)
+	}
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+func (m *mockS3Service) ExpireBucket(ctx context.Context, bucketName, region string, contractorID int64) error {
+	if m.shouldError {
+		return errors.New(m.errorMsg)
+	}
+	return nil
+}
+
+func (m *mockS3Service) DeleteExpiredBucket(ctx context.Context, bucketName, region string, contractorID int64) (bool, error) {
+	if m.shouldError {
+		return false, errors.New(m.errorMsg)
+	}
+	return true, nil
+}
+
 func TestMessageHandler_HandleMessage_ValidMessages(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -153,6 +281,21 @@ func TestMessageHandler_HandleMessage_InvalidMessages(t *testing.T) {
 			messageBody: `{"type": "invalid", "id": 1}`,
 			expectError: false, // Non-retryable error, returns nil
 		},
+		{
+			name:        "Invalid scope",
+			messageBody: `{"type": "site", "id": 1, "scope": "derived"}`,
+			expectError: false, // Non-retryable error, returns nil
+		},
+		{
+			name:        "Invalid priority",
+			messageBody: `{"type": "site", "id": 1, "priority": "urgent"}`,
+			expectError: false, // Non-retryable error, returns nil
+		},
+		{
+			name:        "Skip S3 on a partial cleansing",
+			messageBody: `{"type": "site", "id": 1, "scope": "raw", "skip_s3": true}`,
+			expectError: false, // Non-retryable error, returns nil
+		},
 		{
 			name:        "Missing type field",
 			messageBody: `{"id": 1}`,
@@ -163,6 +306,21 @@ func TestMessageHandler_HandleMessage_InvalidMessages(t *testing.T) {
 			messageBody: `{"type": "contractor"}`,
 			expectError: false, // Non-retryable error, returns nil
 		},
+		{
+			name:        "Unknown field",
+			messageBody: `{"type": "site", "id": 1, "force": true}`,
+			expectError: false, // Non-retryable error, returns nil
+		},
+		{
+			name:        "Quoted id",
+			messageBody: `{"type": "site", "id": "1"}`,
+			expectError: false, // Non-retryable error, returns nil
+		},
+		{
+			name:        "Fractional id",
+			messageBody: `{"type": "site", "id": 1.5}`,
+			expectError: false, // Non-retryable error, returns nil
+		},
 	}
 
 	for _, tt := range tests {
@@ -186,6 +344,9 @@ func TestMessageHandler_HandleMessage_InvalidMessages(t *testing.T) {
 			if !tt.expectError && err != nil {
 				t.Errorf("Expected no error but got: %v", err)
 			}
+			if succeeded := handler.messagesSucceeded.Load(); succeeded != 0 {
+				t.Errorf("Expected the message to be rejected, got %d processed", succeeded)
+			}
 		})
 	}
 }
@@ -196,6 +357,7 @@ func TestMessageHandler_HandleMessage_ServiceErrors(t *testing.T) {
 		message                  dto.CleansingMessage
 		cleansingServiceError    bool
 		cleansingServiceErrorMsg string
+		cleansingServiceErr      error
 		expectRetryableError     bool
 	}{
 		{
@@ -205,6 +367,96 @@ func TestMessageHandler_HandleMessage_ServiceErrors(t *testing.T) {
 			cleansingServiceErrorMsg: "Database connection failed",
 			expectRetryableError:     true,
 		},
+		{
+			name:                 "Object limit exceeded is not retried",
+			message:              dto.CleansingMessage{Type: "contractor", ID: 1},
+			cleansingServiceErr:  fmt.Errorf("%w: contractor 1 has 10 objects, limit is 5", service.ErrObjectLimitExceeded),
+			expectRetryableError: false,
+		},
+		{
+			name:                 "Bucket not owned is not retried",
+			message:              dto.CleansingMessage{Type: "contractor", ID: 1},
+			cleansingServiceErr:  fmt.Errorf("%w: bucket test-bucket has no tags", service.ErrBucketNotOwned),
+			expectRetryableError: false,
+		},
+		{
+			name:                 "Invalid bucket name is not retried",
+			message:              dto.CleansingMessage{Type: "contractor", ID: 1},
+			cleansingServiceErr:  fmt.Errorf("%w \"Test_Bucket\": contains '_'", service.ErrInvalidBucketName),
+			expectRetryableError: false,
+		},
+		{
+			name:                 "Orphaned records are not retried",
+			message:              dto.CleansingMessage{Type: "project", ID: 1},
+			cleansingServiceErr:  fmt.Errorf("%w: 1 documents of site 100", service.ErrOrphanedRecords),
+			expectRetryableError: false,
+		},
+		{
+			name:                 "Missing contractor is not retried",
+			message:              dto.CleansingMessage{Type: "project", ID: 1},
+			cleansingServiceErr:  fmt.Errorf("%w: project 1 references contractor 7", service.ErrContractorNotFound),
+			expectRetryableError: false,
+		},
+		{
+			name:                 "Unconfirmed contractor is not retried",
+			message:              dto.CleansingMessage{Type: "contractor", ID: 1},
+			cleansingServiceErr:  fmt.Errorf("%w: contractor 1 has no confirm_token", service.ErrConfirmationRequired),
+			expectRetryableError: false,
+		},
+		{
+			name:                 "Permanent S3 error is not retried",
+			message:              dto.CleansingMessage{Type: "site", ID: 1},
+			cleansingServiceErr:  fmt.Errorf("batch delete failed: %w: api error AccessDenied", service.ErrS3Permanent),
+			expectRetryableError: false,
+		},
+		{
+			name:                 "Contractor without a bucket is not retried",
+			message:              dto.CleansingMessage{Type: "project", ID: 1},
+			cleansingServiceErr:  fmt.Errorf("%w: contractor 7", service.ErrNoBucket),
+			expectRetryableError: false,
+		},
+		{
+			name:                 "Oversized delete input is not retried",
+			message:              dto.CleansingMessage{Type: "project", ID: 1},
+			cleansingServiceErr:  fmt.Errorf("failed to delete project files: %w: 200000 objects, hard maximum is 100000", service.ErrDeleteInputTooLarge),
+			expectRetryableError: false,
+		},
+		{
+			name:                 "Unusable site code is not retried",
+			message:              dto.CleansingMessage{Type: "site", ID: 1},
+			cleansingServiceErr:  fmt.Errorf("failed to render upload key for site 1: site 1 code \"A/B\": %w: contains a path separator", service.ErrUnusableKeyCode),
+			expectRetryableError: false,
+		},
+		{
+			name:                 "Invalid key manifest is not retried",
+			message:              dto.CleansingMessage{Type: "manifest", ID: 1, ManifestBucket: "audit-bucket", ManifestKey: "keys.txt"},
+			cleansingServiceErr:  fmt.Errorf("%w: line 3: \"P1/\" is not a file key", service.ErrInvalidManifest),
+			expectRetryableError: false,
+		},
+		{
+			name:                 "Bucket outside the allowlist is not retried",
+			message:              dto.CleansingMessage{Type: "project", ID: 1},
+			cleansingServiceErr:  fmt.Errorf("failed to delete S3 objects: %w: bucket contractor-bucket is not in the allowlist", service.ErrBucketNotAllowed),
+			expectRetryableError: false,
+		},
+		{
+			name:                 "Incomplete database traversal is retried",
+			message:              dto.CleansingMessage{Type: "project", ID: 1},
+			cleansingServiceErr:  fmt.Errorf("%w: 1 records of project 1 could not be read", service.ErrIncompleteTraversal),
+			expectRetryableError: true,
+		},
+		{
+			name:                 "Contractor locked by another worker is retried",
+			message:              dto.CleansingMessage{Type: "site", ID: 1},
+			cleansingServiceErr:  fmt.Errorf("%w: contractor 1, waited 30s", service.ErrContractorLocked),
+			expectRetryableError: true,
+		},
+		{
+			name:                 "Open S3 circuit breaker is retried",
+			message:              dto.CleansingMessage{Type: "site", ID: 1},
+			cleansingServiceErr:  fmt.Errorf("failed to delete objects: %w: retrying in 30s", service.ErrS3CircuitOpen),
+			expectRetryableError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -213,6 +465,7 @@ func TestMessageHandler_HandleMessage_ServiceErrors(t *testing.T) {
 			cleansingService := &mockCleansingService{
 				shouldError: tt.cleansingServiceError,
 				errorMsg:    tt.cleansingServiceErrorMsg,
+				err:         tt.cleansingServiceErr,
 			}
 			s3Service := &mockS3Service{
 				shouldError:   false,
@@ -370,4 +623,166 @@ func TestMessageHandler_LogStats(t *testing.T) {
 	
 	// This should not panic or error
 	handler.LogStats()
-}
\ No newline at end of file
+}
+func TestMessageHandler_LogStats_ReportsCounters(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	handler := NewMessageHandler(&mockCleansingService{filesDeleted: 3}, &mockS3Service{})
+
+	bodies := []string{
+		`{"type":"contractor","id":1}`,
+		`{"type":"site","id":2}`,
+		`{"type":"invalid","id":3}`,
+		`not json`,
+	}
+	for _, body := range bodies {
+		if err := handler.HandleMessage(&nsq.Message{Body: []byte(body)}); err != nil {
+			t.Fatalf("HandleMessage(%s) unexpected error: %v", body, err)
+		}
+	}
+
+	handler.LogStats()
+
+	entry := hook.LastEntry()
+	if entry == nil || entry.Message != "Message handler statistics" {
+		t.Fatalf("Expected statistics log entry, got %+v", entry)
+	}
+
+	want := map[string]int64{
+		"messages_processed": 4,
+		"messages_succeeded": 2,
+		"messages_failed":    2,
+		"files_deleted":      6,
+	}
+	for field, value := range want {
+		if got := entry.Data[field]; got != value {
+			t.Errorf("Expected %s = %d, got %v", field, value, got)
+		}
+	}
+}
+
+func TestMessageHandler_HandleMessage_UsesMessageCorrelationID(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	handler := NewMessageHandler(&mockCleansingService{}, &mockS3Service{})
+	body := `{"type":"site","id":2,"correlation_id":"cleansing-replayed"}`
+	if err := handler.HandleMessage(&nsq.Message{Body: []byte(body)}); err != nil {
+		t.Fatalf("HandleMessage() unexpected error: %v", err)
+	}
+
+	entry := hook.LastEntry()
+	if entry == nil || entry.Message != "Completed cleansing operation" {
+		t.Fatalf("Expected completion log entry, got %+v", entry)
+	}
+	if got := entry.Data["correlation_id"]; got != "cleansing-replayed" {
+		t.Errorf("Expected correlation_id cleansing-replayed, got %v", got)
+	}
+}
+
+func TestMessageHandler_HandleMessage_CorrelationIDFromMessageID(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	handler := NewMessageHandler(&mockCleansingService{}, &mockS3Service{})
+	message := &nsq.Message{ID: nsq.MessageID{'0', 'a', '1', 'b'}, Body: []byte(`{"type":"site","id":2}`)}
+
+	// Every delivery of the same message is traced under the same correlation ID
+	for attempt := 0; attempt < 2; attempt++ {
+		if err := handler.HandleMessage(message); err != nil {
+			t.Fatalf("HandleMessage() unexpected error: %v", err)
+		}
+		entry := hook.LastEntry()
+		if entry == nil {
+			t.Fatal("Expected a log entry")
+		}
+		if got, want := entry.Data["correlation_id"], "cleansing-"+string(message.ID[:]); got != want {
+			t.Errorf("Expected correlation_id %q, got %q", want, got)
+		}
+	}
+}
+
+func TestMessageHandler_HandleMessage_FinalAttempt(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts uint16
+		attempts    uint16
+		wantSkipped bool
+	}{
+		{name: "final retry is dropped", maxAttempts: 5, attempts: 5, wantSkipped: true},
+		{name: "earlier retry is processed", maxAttempts: 5, attempts: 4},
+		{name: "single allowed attempt is processed", maxAttempts: 1, attempts: 1},
+		{name: "unlimited attempts", maxAttempts: 0, attempts: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A failing service would make any real processing run observable as a retryable error
+			cleansingService := &mockCleansingService{shouldError: true, errorMsg: "database unavailable"}
+			handler := NewMessageHandlerWithConfig(&config.Config{MaxRequeueAttempt: tt.maxAttempts}, cleansingService, &mockS3Service{})
+
+			err := handler.HandleMessage(&nsq.Message{Attempts: tt.attempts, Body: []byte(`{"type":"site","id":2}`)})
+			if tt.wantSkipped {
+				if err != nil {
+					t.Errorf("Expected the final attempt to be acknowledged, got %v", err)
+				}
+			} else if err == nil {
+				t.Error("Expected the message to be processed and fail with a retryable error")
+			}
+			if failed := handler.messagesFailed.Load(); failed != 1 {
+				t.Errorf("Expected 1 failed message, got %d", failed)
+			}
+		})
+	}
+}
+
+func TestMessageHandler_HandleMessage_LogsSkippedReasons(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	skipped := map[string]int{dto.SkipReasonProtected: 2, dto.SkipReasonDuplicate: 1}
+	handler := NewMessageHandler(&mockCleansingService{filesDeleted: 4, skipped: skipped}, &mockS3Service{})
+	if err := handler.HandleMessage(&nsq.Message{Body: []byte(`{"type":"site","id":2}`)}); err != nil {
+		t.Fatalf("HandleMessage() unexpected error: %v", err)
+	}
+
+	entry := hook.LastEntry()
+	if entry == nil || entry.Message != "Completed cleansing operation" {
+		t.Fatalf("Expected completion log entry, got %+v", entry)
+	}
+	if got := entry.Data["files_skipped"]; got != 3 {
+		t.Errorf("Expected files_skipped 3, got %v", got)
+	}
+	if got := fmt.Sprint(entry.Data["skipped_reasons"]); got != fmt.Sprint(skipped) {
+		t.Errorf("Expected skipped_reasons %v, got %v", skipped, got)
+	}
+}
+
+func TestMessageHandler_HandleMessage_Span(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	handler := NewMessageHandler(&mockCleansingService{}, &mockS3Service{})
+	body := `{"type":"site","id":2,"correlation_id":"cleansing-replayed"}`
+	if err := handler.HandleMessage(&nsq.Message{Attempts: 2, Body: []byte(body)}); err != nil {
+		t.Fatalf("HandleMessage() unexpected error: %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != "cleansing.message" {
+		t.Fatalf("Expected one cleansing.message span, got %v", spans)
+	}
+	want := map[string]string{"correlation_id": "cleansing-replayed", "cleansing.type": "site", "cleansing.id": "2", "nsq.attempts": "2"}
+	got := make(map[string]string)
+	for _, attr := range spans[0].Attributes() {
+		got[string(attr.Key)] = attr.Value.Emit()
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("Expected span attribute %s=%s, got %q", key, value, got[key])
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/service"
+)
+
+// NewLowPriorityMessageHandler creates a handler for the low priority topic's separate pool. It processes every
+// message it receives rather than routing low priority messages once more.
+func NewLowPriorityMessageHandler(cfg *config.Config, cleansingService service.CleansingService, s3Service service.S3Service) *MessageHandler {
+	handler := NewMessageHandlerWithConfig(cfg, cleansingService, s3Service)
+	handler.lowPriorityTopic = ""
+	return handler
+}
+
+// routesToLowPriority reports whether a message of the given effective priority is moved to the low priority topic
+func (h *MessageHandler) routesToLowPriority(priority string) bool {
+	return h.lowPriorityTopic != "" && priority == dto.PriorityLow
+}
+
+// routeToLowPriority republishes message to the low priority topic, keeping the correlation ID of this attempt so
+// both halves of its handling can be traced together
+func (h *MessageHandler) routeToLowPriority(message dto.CleansingMessage, correlationID string) error {
+	if h.router == nil {
+		return errors.New("no publisher configured for the low priority topic")
+	}
+
+	if message.CorrelationID == "" {
+		message.CorrelationID = correlationID
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	if err := h.router.Publish(h.lowPriorityTopic, body); err != nil {
+		return fmt.Errorf("failed to publish message to %s: %w", h.lowPriorityTopic, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/nsqio/go-nsq"
+)
+
+func TestMessageHandler_HandleMessage_PriorityRouting(t *testing.T) {
+	tests := []struct {
+		name             string
+		body             string
+		lowPriorityTopic string
+		publishErr       error
+		wantRouted       bool
+	}{
+		{name: "contractor is routed", body: `{"type":"contractor","id":1}`, lowPriorityTopic: "data-cleansing-low", wantRouted: true},
+		{name: "expired bucket is routed", body: `{"type":"expired_bucket","id":1,"bucket_name":"test-bucket"}`, lowPriorityTopic: "data-cleansing-low", wantRouted: true},
+		{name: "explicitly low site is routed", body: `{"type":"site","id":1,"priority":"low"}`, lowPriorityTopic: "data-cleansing-low", wantRouted: true},
+		{name: "site is processed", body: `{"type":"site","id":1}`, lowPriorityTopic: "data-cleansing-low"},
+		{name: "project is processed", body: `{"type":"project","id":1}`, lowPriorityTopic: "data-cleansing-low"},
+		{name: "explicitly high contractor is processed", body: `{"type":"contractor","id":1,"priority":"high"}`, lowPriorityTopic: "data-cleansing-low"},
+		{name: "routing disabled", body: `{"type":"contractor","id":1}`},
+		{name: "publish failure falls back to processing", body: `{"type":"contractor","id":1}`, lowPriorityTopic: "data-cleansing-low", publishErr: errors.New("connection refused")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &mockPublisher{err: tt.publishErr}
+			handler := NewMessageHandler(&mockCleansingService{}, &mockS3Service{})
+			handler.router = publisher
+			handler.lowPriorityTopic = tt.lowPriorityTopic
+
+			message := &nsq.Message{Body: []byte(tt.body)}
+			message.ID = nsq.MessageID{'a', 'b', 'c'}
+			if err := handler.HandleMessage(message); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !tt.wantRouted {
+				if len(publisher.bodies) != 0 {
+					t.Errorf("Expected nothing routed, got %d messages", len(publisher.bodies))
+				}
+				if handler.messagesSucceeded.Load() != 1 {
+					t.Errorf("Expected the message to be processed here, got %d succeeded", handler.messagesSucceeded.Load())
+				}
+				return
+			}
+
+			if handler.messagesSucceeded.Load() != 0 || handler.messagesRouted.Load() != 1 {
+				t.Errorf("Expected the message to be routed only, got %d succeeded and %d routed",
+					handler.messagesSucceeded.Load(), handler.messagesRouted.Load())
+			}
+			if len(publisher.bodies) != 1 || publisher.topics[0] != tt.lowPriorityTopic {
+				t.Fatalf("Expected one message published to %s, got %v", tt.lowPriorityTopic, publisher.topics)
+			}
+			routed, err := dto.DecodeCleansingMessage(publisher.bodies[0])
+			if err != nil {
+				t.Fatalf("Routed message is not a valid cleansing message: %v", err)
+			}
+			if routed.CorrelationID != "cleansing-"+string(message.ID[:]) {
+				t.Errorf("Expected the routed message to keep the correlation ID, got %q", routed.CorrelationID)
+			}
+		})
+	}
+}
+
+func TestNewLowPriorityMessageHandler(t *testing.T) {
+	cfg := &config.Config{NsqServer: "127.0.0.1:4150", TopicName: "data-cleansing", LowPriorityTopic: "data-cleansing-low"}
+
+	if handler := NewMessageHandlerWithConfig(cfg, &mockCleansingService{}, &mockS3Service{}); !handler.routesToLowPriority(dto.PriorityLow) {
+		t.Error("Expected the main handler to route low priority messages")
+	}
+
+	handler := NewLowPriorityMessageHandler(cfg, &mockCleansingService{}, &mockS3Service{})
+	for _, priority := range []string{dto.PriorityHigh, dto.PriorityNormal, dto.PriorityLow} {
+		if handler.routesToLowPriority(priority) {
+			t.Errorf("Expected the low priority handler to process %s priority messages itself", priority)
+		}
+	}
+}
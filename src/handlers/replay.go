@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+)
+
+// Publisher is the subset of *nsq.Producer used to republish messages, allowing it to be mocked
+type Publisher interface {
+	Publish(topic string, body []byte) error
+}
+
+// ReplayMessage republishes a failed cleansing message to topic so the worker processes it again.
+// payload is the original message body, e.g. as read from a dead-letter channel. A correlation ID already
+// in the payload is kept; otherwise correlationID (if any) is added so the replay can be traced back to
+// the original attempt's logs.
+func ReplayMessage(publisher Publisher, topic string, payload []byte, correlationID string) (dto.CleansingMessage, error) {
+	message, err := dto.DecodeCleansingMessage(payload)
+	if err != nil {
+		return message, fmt.Errorf("invalid message format: %w", err)
+	}
+	if !message.IsValidType() {
+		return message, fmt.Errorf("invalid message type: %s", message.Type)
+	}
+	if !message.IsValidScope() {
+		return message, fmt.Errorf("invalid message scope: %s", message.Scope)
+	}
+	if !message.IsValidPriority() {
+		return message, fmt.Errorf("invalid message priority: %s", message.Priority)
+	}
+
+	if message.CorrelationID == "" {
+		message.CorrelationID = correlationID
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return message, fmt.Errorf("failed to encode message: %w", err)
+	}
+	if err := publisher.Publish(topic, body); err != nil {
+		return message, fmt.Errorf("failed to publish message to %s: %w", topic, err)
+	}
+	return message, nil
+}
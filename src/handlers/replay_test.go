@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+)
+
+// mockPublisher records every published message
+type mockPublisher struct {
+	topics []string
+	bodies [][]byte
+	err    error
+}
+
+func (m *mockPublisher) Publish(topic string, body []byte) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.topics = append(m.topics, topic)
+	m.bodies = append(m.bodies, body)
+	return nil
+}
+
+func TestReplayMessage(t *testing.T) {
+	tests := []struct {
+		name          string
+		payload       string
+		correlationID string
+		want          dto.CleansingMessage
+	}{
+		{
+			name:          "keeps correlation id from payload",
+			payload:       `{"type":"site","id":7,"category":"SSS","correlation_id":"cleansing-1"}`,
+			correlationID: "ignored",
+			want:          dto.CleansingMessage{Type: "site", ID: 7, Category: "SSS", CorrelationID: "cleansing-1"},
+		},
+		{
+			name:          "adds given correlation id",
+			payload:       `{"type":"contractor","id":3,"override_object_limit":true}`,
+			correlationID: "cleansing-2",
+			want:          dto.CleansingMessage{Type: "contractor", ID: 3, OverrideObjectLimit: true, CorrelationID: "cleansing-2"},
+		},
+		{
+			name:    "without correlation id",
+			payload: `{"type":"project","id":5}`,
+			want:    dto.CleansingMessage{Type: "project", ID: 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &mockPublisher{}
+
+			replayed, err := ReplayMessage(publisher, "data-cleansing", []byte(tt.payload), tt.correlationID)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if replayed != tt.want {
+				t.Errorf("Expected replayed message %+v, got %+v", tt.want, replayed)
+			}
+
+			if len(publisher.bodies) != 1 || publisher.topics[0] != "data-cleansing" {
+				t.Fatalf("Expected one message on data-cleansing, got topics %v", publisher.topics)
+			}
+			var published dto.CleansingMessage
+			if err := json.Unmarshal(publisher.bodies[0], &published); err != nil {
+				t.Fatalf("Published payload is not a cleansing message: %v", err)
+			}
+			if published != tt.want {
+				t.Errorf("Expected published message %+v, got %+v", tt.want, published)
+			}
+		})
+	}
+}
+
+func TestReplayMessage_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		payload    string
+		publishErr error
+	}{
+		{name: "invalid json", payload: `{"type":`},
+		{name: "invalid type", payload: `{"type":"bucket","id":1}`},
+		{name: "invalid scope", payload: `{"type":"site","id":1,"scope":"derived"}`},
+		{name: "invalid priority", payload: `{"type":"site","id":1,"priority":"urgent"}`},
+		{name: "publish failure", payload: `{"type":"site","id":1}`, publishErr: errors.New("connection refused")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &mockPublisher{err: tt.publishErr}
+
+			if _, err := ReplayMessage(publisher, "data-cleansing", []byte(tt.payload), ""); err == nil {
+				t.Fatal("Expected error")
+			}
+			if len(publisher.bodies) != 0 {
+				t.Errorf("Expected nothing published, got %d messages", len(publisher.bodies))
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"github.com/nsqio/go-nsq"
+	log "github.com/sirupsen/logrus"
+)
+
+// requeueDelay returns the delay before the next delivery of a message on its attempts-th delivery: the base delay
+// doubled for every earlier attempt, capped at the maximum delay
+func (h *MessageHandler) requeueDelay(attempts uint16) time.Duration {
+	delay := h.requeueBaseDelay
+	for i := uint16(1); i < attempts && delay < h.requeueMaxDelay; i++ {
+		delay *= 2
+	}
+	if h.requeueMaxDelay > 0 && delay > h.requeueMaxDelay {
+		delay = h.requeueMaxDelay
+	}
+	return delay
+}
+
+// retry hands a retryable failure back to NSQ. With a requeue base delay configured the message is requeued here,
+// backing off exponentially with its attempts so a struggling database or S3 is not hit again straight away, and
+// nil is returned; otherwise the error is returned and NSQ requeues the message with its default delay.
+func (h *MessageHandler) retry(ctx context.Context, message *nsq.Message, err error) error {
+	err = h.handleError(ctx, err, true)
+	if h.requeueBaseDelay <= 0 {
+		return err
+	}
+
+	delay := h.requeueDelay(message.Attempts)
+	workerLog.GetLoggerFromContext(ctx).WithFields(log.Fields{
+		"attempts":      message.Attempts,
+		"requeue_delay": delay.String(),
+	}).Info("Requeueing cleansing message")
+	// The consumer-wide backoff would pause every other message as well, so only this message is delayed
+	message.RequeueWithoutBackoff(delay)
+	return nil
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/service"
+	"github.com/nsqio/go-nsq"
+)
+
+// recordingDelegate records how a message was responded to instead of talking to nsqd
+type recordingDelegate struct {
+	finished bool
+	requeued bool
+	delay    time.Duration
+	backoff  bool
+}
+
+func (d *recordingDelegate) OnFinish(m *nsq.Message) { d.finished = true }
+
+func (d *recordingDelegate) OnRequeue(m *nsq.Message, delay time.Duration, backoff bool) {
+	d.requeued = true
+	d.delay = delay
+	d.backoff = backoff
+}
+
+func (d *recordingDelegate) OnTouch(m *nsq.Message) {}
+
+func TestMessageHandler_RequeueDelay(t *testing.T) {
+	handler := NewMessageHandlerWithConfig(&config.Config{RequeueBaseDelay: time.Second, RequeueMaxDelay: 10 * time.Second}, &mockCleansingService{}, &mockS3Service{})
+
+	tests := []struct {
+		attempts uint16
+		want     time.Duration
+	}{
+		{attempts: 0, want: time.Second},
+		{attempts: 1, want: time.Second},
+		{attempts: 2, want: 2 * time.Second},
+		{attempts: 3, want: 4 * time.Second},
+		{attempts: 4, want: 8 * time.Second},
+		{attempts: 5, want: 10 * time.Second},
+		{attempts: 60000, want: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := handler.requeueDelay(tt.attempts); got != tt.want {
+			t.Errorf("requeueDelay(%d): Expected %s, got %s", tt.attempts, tt.want, got)
+		}
+	}
+}
+
+func TestMessageHandler_HandleMessage_RequeuesWithDelay(t *testing.T) {
+	tests := []struct {
+		name        string
+		baseDelay   time.Duration
+		err         error
+		attempts    uint16
+		wantErr     bool
+		wantRequeue bool
+		wantDelay   time.Duration
+	}{
+		{name: "retryable error is requeued with backoff", baseDelay: time.Second, err: errors.New("database unavailable"), attempts: 3, wantRequeue: true, wantDelay: 4 * time.Second},
+		{name: "non-retryable error is not requeued", baseDelay: time.Second, err: service.ErrObjectLimitExceeded, attempts: 3},
+		{name: "no base delay leaves the requeue to NSQ", err: errors.New("database unavailable"), attempts: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleansingService := &mockCleansingService{shouldError: true, err: tt.err}
+			cfg := &config.Config{RequeueBaseDelay: tt.baseDelay, RequeueMaxDelay: time.Minute}
+			handler := NewMessageHandlerWithConfig(cfg, cleansingService, &mockS3Service{})
+
+			delegate := &recordingDelegate{}
+			message := &nsq.Message{Attempts: tt.attempts, Body: []byte(`{"type":"site","id":2}`), Delegate: delegate}
+			err := handler.HandleMessage(message)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("HandleMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if delegate.requeued != tt.wantRequeue {
+				t.Fatalf("Expected requeued %v, got %v", tt.wantRequeue, delegate.requeued)
+			}
+			if delegate.delay != tt.wantDelay {
+				t.Errorf("Expected requeue delay %s, got %s", tt.wantDelay, delegate.delay)
+			}
+			if delegate.backoff {
+				t.Error("Expected the requeue not to trigger the consumer backoff")
+			}
+			if tt.wantRequeue && !message.HasResponded() {
+				t.Error("Expected the message to be responded to")
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"github.com/nsqio/go-nsq"
+)
+
+// publishResult publishes result to the results topic so the producer's consumers learn the outcome of a message
+func (h *MessageHandler) publishResult(result *dto.CleansingResult) error {
+	if h.resultsTopic == "" {
+		return nil
+	}
+	if h.results == nil {
+		return errors.New("no publisher configured for the results topic")
+	}
+
+	body, err := dto.MarshalCleansingResult(result, h.resultFieldNames)
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+	if err := h.results.Publish(h.resultsTopic, body); err != nil {
+		return fmt.Errorf("failed to publish result to %s: %w", h.resultsTopic, err)
+	}
+	return nil
+}
+
+// rejectMessage drops a message that failed validation without a retry, after reporting it like any other
+// result: failed, classified by code and carrying the original payload, since the message may not even name
+// its type and id. The payload's confirm token is redacted, as results leave the worker.
+func (h *MessageHandler) rejectMessage(ctx context.Context, message *nsq.Message, parsed dto.CleansingMessage, code string, err error) error {
+	h.notify(ctx, &dto.CleansingResult{
+		Type:      parsed.Type,
+		ID:        parsed.ID,
+		Success:   false,
+		Message:   "Message rejected as invalid",
+		Error:     err.Error(),
+		ErrorCode: code,
+		Payload:   redactPayload(message.Body),
+
+		IdempotencyKey: parsed.IdempotencyKey(workerLog.CorrelationIDFromContext(ctx)),
+	})
+	return h.handleError(ctx, err, false)
+}
+
+// confirmTokenPattern matches the confirm token of a message body, even one that is not valid JSON. JSON field
+// names are matched case-insensitively when decoding, so they are here too.
+var confirmTokenPattern = regexp.MustCompile(`(?i)("confirm_token"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// redactPayload returns a message body with the value of its confirm token replaced
+func redactPayload(body []byte) string {
+	return confirmTokenPattern.ReplaceAllString(string(body), `${1}"[REDACTED]"`)
+}
+
+// decodeErrorCode classifies a DecodeCleansingMessage error
+func decodeErrorCode(err error) string {
+	if errors.Is(err, dto.ErrInvalidID) {
+		return dto.ErrorCodeInvalidID
+	}
+	return dto.ErrorCodeBadJSON
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/nsqio/go-nsq"
+)
+
+func TestMessageHandler_HandleMessage_PublishesRejections(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode string
+		wantType string
+		wantID   int64
+	}{
+		{name: "malformed JSON", body: `{"type":"site",`, wantCode: dto.ErrorCodeBadJSON},
+		{name: "unknown field", body: `{"type":"site","id":1,"site_id":1}`, wantCode: dto.ErrorCodeBadJSON, wantType: "site", wantID: 1},
+		{name: "quoted id", body: `{"type":"site","id":"1"}`, wantCode: dto.ErrorCodeBadJSON, wantType: "site"},
+		{name: "missing id", body: `{"type":"site"}`, wantCode: dto.ErrorCodeInvalidID, wantType: "site"},
+		{name: "negative id", body: `{"type":"site","id":-4}`, wantCode: dto.ErrorCodeInvalidID, wantType: "site", wantID: -4},
+		{name: "unknown type", body: `{"type":"tenant","id":3}`, wantCode: dto.ErrorCodeInvalidType, wantType: "tenant", wantID: 3},
+		{name: "expired bucket without bucket", body: `{"type":"expired_bucket","id":3}`, wantCode: dto.ErrorCodeInvalidType, wantType: "expired_bucket", wantID: 3},
+		{name: "invalid scope", body: `{"type":"site","id":3,"scope":"thumbnails"}`, wantCode: dto.ErrorCodeInvalidField, wantType: "site", wantID: 3},
+		{name: "invalid priority", body: `{"type":"site","id":3,"priority":"urgent"}`, wantCode: dto.ErrorCodeInvalidField, wantType: "site", wantID: 3},
+		{name: "invalid skip_s3", body: `{"type":"site","id":3,"skip_s3":true,"category":"SSS"}`, wantCode: dto.ErrorCodeInvalidField, wantType: "site", wantID: 3},
+		{name: "inverted created window", body: `{"type":"site","id":3,"created_after":200,"created_before":100}`, wantCode: dto.ErrorCodeInvalidField, wantType: "site", wantID: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &mockPublisher{}
+			notifier := &mockNotifier{}
+			handler := NewMessageHandler(&mockCleansingService{}, &mockS3Service{})
+			handler.results = publisher
+			handler.resultsTopic = "data-cleansing-results"
+			handler.notifier = notifier
+
+			if err := handler.HandleMessage(&nsq.Message{Body: []byte(tt.body)}); err != nil {
+				t.Fatalf("Expected the invalid message to be dropped without a retry, got %v", err)
+			}
+			if handler.messagesSucceeded.Load() != 0 || handler.messagesFailed.Load() != 1 {
+				t.Errorf("Expected the invalid message to fail unprocessed, got %d succeeded and %d failed",
+					handler.messagesSucceeded.Load(), handler.messagesFailed.Load())
+			}
+
+			if len(publisher.bodies) != 1 || publisher.topics[0] != "data-cleansing-results" {
+				t.Fatalf("Expected one result published to data-cleansing-results, got %v", publisher.topics)
+			}
+			var result dto.CleansingResult
+			if err := json.Unmarshal(publisher.bodies[0], &result); err != nil {
+				t.Fatalf("Published result is not JSON: %v", err)
+			}
+			if result.Success || result.ErrorCode != tt.wantCode || result.Error == "" {
+				t.Errorf("Expected a failed result with code %s, got %+v", tt.wantCode, result)
+			}
+			if result.Payload != tt.body {
+				t.Errorf("Expected the original payload %s, got %s", tt.body, result.Payload)
+			}
+			if result.Type != tt.wantType || result.ID != tt.wantID {
+				t.Errorf("Expected %s %d, got %s %d", tt.wantType, tt.wantID, result.Type, result.ID)
+			}
+
+			// The webhook learns about the rejection too
+			if len(notifier.results) != 1 || notifier.results[0].ErrorCode != tt.wantCode {
+				t.Errorf("Expected the rejection to be notified, got %+v", notifier.results)
+			}
+		})
+	}
+}
+
+func TestMessageHandler_HandleMessage_PublishesResults(t *testing.T) {
+	tests := []struct {
+		name         string
+		resultsTopic string
+		publishErr   error
+		wantResults  int
+	}{
+		{name: "processed result", resultsTopic: "data-cleansing-results", wantResults: 1},
+		{name: "no results topic", wantResults: 0},
+		{name: "publish failure does not fail the message", resultsTopic: "data-cleansing-results", publishErr: errors.New("connection refused")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &mockPublisher{err: tt.publishErr}
+			handler := NewMessageHandler(&mockCleansingService{}, &mockS3Service{})
+			handler.results = publisher
+			handler.resultsTopic = tt.resultsTopic
+
+			if err := handler.HandleMessage(&nsq.Message{Body: []byte(`{"type":"site","id":2}`)}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(publisher.bodies) != tt.wantResults {
+				t.Fatalf("Expected %d published results, got %d", tt.wantResults, len(publisher.bodies))
+			}
+			if tt.wantResults == 0 {
+				return
+			}
+			var result dto.CleansingResult
+			if err := json.Unmarshal(publisher.bodies[0], &result); err != nil {
+				t.Fatalf("Published result is not JSON: %v", err)
+			}
+			if !result.Success || result.ID != 2 || result.ErrorCode != "" || result.Payload != "" {
+				t.Errorf("Expected the successful result of site 2, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestMessageHandler_HandleMessage_PublishesRenamedFields(t *testing.T) {
+	publisher := &mockPublisher{}
+	handler := NewMessageHandler(&mockCleansingService{}, &mockS3Service{})
+	handler.results = publisher
+	handler.resultsTopic = "data-cleansing-results"
+	handler.resultFieldNames = map[string]string{"success": "ok", "id": "entity_id"}
+
+	if err := handler.HandleMessage(&nsq.Message{Body: []byte(`{"type":"site","id":2}`)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(publisher.bodies) != 1 {
+		t.Fatalf("Expected one published result, got %d", len(publisher.bodies))
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(publisher.bodies[0], &fields); err != nil {
+		t.Fatalf("Published result is not JSON: %v", err)
+	}
+	if fields["ok"] != true || fields["entity_id"] != float64(2) {
+		t.Errorf("Expected the renamed fields ok and entity_id, got %v", fields)
+	}
+	if _, ok := fields["success"]; ok {
+		t.Errorf("Expected success to be renamed, got %v", fields)
+	}
+}
+
+func TestRedactPayload(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "no token", body: `{"type":"site","id":1}`, want: `{"type":"site","id":1}`},
+		{
+			name: "token",
+			body: `{"type":"contractor","id":1,"confirm_token":"abc\"def","x":1}`,
+			want: `{"type":"contractor","id":1,"confirm_token":"[REDACTED]","x":1}`,
+		},
+		{name: "spaced and cased", body: `{"Confirm_Token" : "abc"}`, want: `{"Confirm_Token" : "[REDACTED]"}`},
+		{name: "invalid JSON", body: `{"confirm_token":"abc",`, want: `{"confirm_token":"[REDACTED]",`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactPayload([]byte(tt.body)); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMessageHandler_HandleMessage_IdempotencyKey(t *testing.T) {
+	publisher := &mockPublisher{}
+	handler := NewMessageHandler(&mockCleansingService{}, &mockS3Service{})
+	handler.results = publisher
+	handler.resultsTopic = "data-cleansing-results"
+
+	publish := func(id nsq.MessageID, body string) dto.CleansingResult {
+		t.Helper()
+		publisher.bodies = nil
+		if err := handler.HandleMessage(&nsq.Message{ID: id, Body: []byte(body)}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(publisher.bodies) != 1 {
+			t.Fatalf("Expected one published result, got %d", len(publisher.bodies))
+		}
+		var result dto.CleansingResult
+		if err := json.Unmarshal(publisher.bodies[0], &result); err != nil {
+			t.Fatalf("Published result is not JSON: %v", err)
+		}
+		return result
+	}
+
+	first := nsq.MessageID{'0', '1'}
+	second := nsq.MessageID{'0', '2'}
+	delivered := publish(first, `{"type":"site","id":2}`)
+	if delivered.IdempotencyKey == "" {
+		t.Fatal("Expected an idempotency key on the published result")
+	}
+
+	// A redelivery shares the NSQ message ID, so it publishes under the same key
+	if redelivered := publish(first, `{"type":"site","id":2}`); redelivered.IdempotencyKey != delivered.IdempotencyKey {
+		t.Errorf("Expected redelivery to keep key %s, got %s", delivered.IdempotencyKey, redelivered.IdempotencyKey)
+	}
+	if other := publish(second, `{"type":"site","id":2}`); other.IdempotencyKey == delivered.IdempotencyKey {
+		t.Errorf("Expected another message to get its own key, got %s for both", other.IdempotencyKey)
+	}
+
+	// A replayed message keeps the correlation ID of its original attempt, and with it the key
+	replayed := publish(first, `{"type":"site","id":2,"correlation_id":"cleansing-replayed"}`)
+	if again := publish(second, `{"type":"site","id":2,"correlation_id":"cleansing-replayed"}`); again.IdempotencyKey != replayed.IdempotencyKey {
+		t.Errorf("Expected the replay to keep key %s, got %s", replayed.IdempotencyKey, again.IdempotencyKey)
+	}
+
+	// Rejected messages are keyed too
+	rejected := publish(first, `{"type":"tenant","id":3}`)
+	if rejected.IdempotencyKey == "" || publish(first, `{"type":"tenant","id":3}`).IdempotencyKey != rejected.IdempotencyKey {
+		t.Errorf("Expected the rejection of a redelivery to keep key %s", rejected.IdempotencyKey)
+	}
+}
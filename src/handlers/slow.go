@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"github.com/denys89/wadugs-worker-cleansing/src/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// isSlow reports whether processing a message took at least slowThreshold. A zero threshold disables detection.
+func (h *MessageHandler) isSlow(elapsed time.Duration) bool {
+	return h.slowThreshold > 0 && elapsed >= h.slowThreshold
+}
+
+// reportSlow warns about a message whose processing took at least slowThreshold and counts it, successful or not,
+// so the few disproportionately long messages stand out from the usual completion logs
+func (h *MessageHandler) reportSlow(ctx context.Context, msg dto.CleansingMessage, result *dto.CleansingResult, elapsed time.Duration) {
+	if !h.isSlow(elapsed) {
+		return
+	}
+
+	fields := log.Fields{
+		"type":        msg.Type,
+		"id":          msg.ID,
+		"duration_ms": elapsed.Milliseconds(),
+		"threshold":   h.slowThreshold.String(),
+	}
+	if result != nil {
+		fields["success"] = result.Success
+		fields["files_deleted"] = result.FilesDeleted
+		fields["files_skipped"] = result.FilesSkipped
+	}
+	workerLog.GetLoggerFromContext(ctx).WithFields(fields).Warn("Slow cleansing message")
+	metrics.SlowMessages.WithLabelValues(msg.Type).Inc()
+}
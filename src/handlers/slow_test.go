@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/metrics"
+	"github.com/nsqio/go-nsq"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestMessageHandler_HandleMessage_SlowMessage(t *testing.T) {
+	tests := []struct {
+		name          string
+		delay         time.Duration
+		slowThreshold time.Duration
+		wantSlow      bool
+	}{
+		{name: "slow message warns", delay: 20 * time.Millisecond, slowThreshold: 10 * time.Millisecond, wantSlow: true},
+		{name: "fast message stays at info", slowThreshold: time.Hour, wantSlow: false},
+		{name: "disabled threshold", delay: 20 * time.Millisecond, wantSlow: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := logtest.NewGlobal()
+			defer hook.Reset()
+
+			handler := NewMessageHandler(&mockCleansingService{delay: tt.delay, filesDeleted: 3, skipped: map[string]int{"protected": 1}}, &mockS3Service{})
+			handler.slowThreshold = tt.slowThreshold
+			before := testutil.ToFloat64(metrics.SlowMessages.WithLabelValues("site"))
+
+			if err := handler.HandleMessage(&nsq.Message{Body: []byte(`{"type":"site","id":7}`)}); err != nil {
+				t.Fatalf("HandleMessage() unexpected error: %v", err)
+			}
+
+			var slow *log.Entry
+			for _, entry := range hook.AllEntries() {
+				if entry.Message == "Slow cleansing message" {
+					slow = entry
+				}
+			}
+			if (slow != nil) != tt.wantSlow {
+				t.Fatalf("Expected slow warning = %v, got %+v", tt.wantSlow, slow)
+			}
+			wantCount := 0.0
+			if tt.wantSlow {
+				wantCount = 1
+			}
+			if got := testutil.ToFloat64(metrics.SlowMessages.WithLabelValues("site")) - before; got != wantCount {
+				t.Errorf("Expected slow messages metric to grow by %v, got %v", wantCount, got)
+			}
+			if slow == nil {
+				return
+			}
+
+			if slow.Level != log.WarnLevel {
+				t.Errorf("Expected warn level, got %s", slow.Level)
+			}
+			if slow.Data["type"] != "site" || slow.Data["id"] != int64(7) {
+				t.Errorf("Expected type site and id 7, got %v and %v", slow.Data["type"], slow.Data["id"])
+			}
+			if slow.Data["files_deleted"] != 3 || slow.Data["files_skipped"] != 1 {
+				t.Errorf("Expected 3 files deleted and 1 skipped, got %v and %v", slow.Data["files_deleted"], slow.Data["files_skipped"])
+			}
+			if duration, ok := slow.Data["duration_ms"].(int64); !ok || duration < tt.delay.Milliseconds() {
+				t.Errorf("Expected duration_ms of at least %d, got %v", tt.delay.Milliseconds(), slow.Data["duration_ms"])
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package handlers
+
+// Stats is a point-in-time copy of a MessageHandler's counters
+type Stats struct {
+	MessagesProcessed int64 `json:"messages_processed"`
+	MessagesSucceeded int64 `json:"messages_succeeded"`
+	MessagesFailed    int64 `json:"messages_failed"`
+	MessagesRouted    int64 `json:"messages_routed"` // Republished to the low priority topic instead of processed
+	FilesDeleted      int64 `json:"files_deleted"`
+}
+
+// Snapshot returns a copy of the handler's counters. It is safe to call while messages are being handled;
+// each counter is read atomically, but messages in flight may be counted as processed and not yet as
+// succeeded or failed.
+func (h *MessageHandler) Snapshot() Stats {
+	return Stats{
+		MessagesProcessed: h.messagesProcessed.Load(),
+		MessagesSucceeded: h.messagesSucceeded.Load(),
+		MessagesFailed:    h.messagesFailed.Load(),
+		MessagesRouted:    h.messagesRouted.Load(),
+		FilesDeleted:      h.filesDeleted.Load(),
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/nsqio/go-nsq"
+)
+
+func TestMessageHandler_Snapshot_Concurrent(t *testing.T) {
+	handler := NewMessageHandler(&mockCleansingService{filesDeleted: 3}, &mockS3Service{})
+
+	const workers, perWorker = 8, 25
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				body := fmt.Sprintf(`{"type":"site","id":%d}`, i+1)
+				if i%5 == 0 {
+					body = `{"type":"invalid","id":1}`
+				}
+				if err := handler.HandleMessage(&nsq.Message{Body: []byte(body)}); err != nil {
+					t.Errorf("HandleMessage(%s) unexpected error: %v", body, err)
+				}
+				// Reading while other goroutines update must be safe
+				_ = handler.Snapshot()
+			}
+		}()
+	}
+	wg.Wait()
+
+	failed := int64(workers * perWorker / 5)
+	want := Stats{
+		MessagesProcessed: workers * perWorker,
+		MessagesSucceeded: workers*perWorker - failed,
+		MessagesFailed:    failed,
+		FilesDeleted:      (workers*perWorker - failed) * 3,
+	}
+	got := handler.Snapshot()
+	if got != want {
+		t.Errorf("Expected snapshot %+v, got %+v", want, got)
+	}
+	if got.MessagesProcessed != got.MessagesSucceeded+got.MessagesFailed+got.MessagesRouted {
+		t.Errorf("Expected every processed message to be counted once as succeeded, failed or routed, got %+v", got)
+	}
+}
+
+func TestMessageHandler_Snapshot_IsACopy(t *testing.T) {
+	handler := NewMessageHandler(&mockCleansingService{filesDeleted: 2}, &mockS3Service{})
+
+	before := handler.Snapshot()
+	if err := handler.HandleMessage(&nsq.Message{Body: []byte(`{"type":"site","id":1}`)}); err != nil {
+		t.Fatalf("HandleMessage() unexpected error: %v", err)
+	}
+
+	if before != (Stats{}) {
+		t.Errorf("Expected the earlier snapshot to stay zero, got %+v", before)
+	}
+	if after := handler.Snapshot(); after.MessagesSucceeded != 1 || after.FilesDeleted != 2 {
+		t.Errorf("Expected 1 message succeeded and 2 files deleted, got %+v", after)
+	}
+}
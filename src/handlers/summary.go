@@ -0,0 +1,44 @@
+package handlers
+
+import "sort"
+
+// summaryEntry is the count of one bucket and category of a result summary
+type summaryEntry struct {
+	bucket   string
+	category string
+	objects  int
+}
+
+// limitSummary returns the summary for logging, keeping its limit largest bucket and category entries, and the
+// number of entries left out. A limit of 0 or less keeps the whole summary.
+func limitSummary(summary map[string]map[string]int, limit int) (map[string]map[string]int, int) {
+	var entries []summaryEntry
+	for bucket, categories := range summary {
+		for category, objects := range categories {
+			entries = append(entries, summaryEntry{bucket: bucket, category: category, objects: objects})
+		}
+	}
+	if limit <= 0 || len(entries) <= limit {
+		return summary, 0
+	}
+
+	// Largest first; ties are broken by name so the same summary always logs the same entries
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].objects != entries[j].objects {
+			return entries[i].objects > entries[j].objects
+		}
+		if entries[i].bucket != entries[j].bucket {
+			return entries[i].bucket < entries[j].bucket
+		}
+		return entries[i].category < entries[j].category
+	})
+
+	limited := make(map[string]map[string]int)
+	for _, entry := range entries[:limit] {
+		if limited[entry.bucket] == nil {
+			limited[entry.bucket] = make(map[string]int)
+		}
+		limited[entry.bucket][entry.category] = entry.objects
+	}
+	return limited, len(entries) - limit
+}
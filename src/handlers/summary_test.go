@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/nsqio/go-nsq"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestLimitSummary(t *testing.T) {
+	summary := map[string]map[string]int{
+		"bucket-a": {"SSS": 120, "RasterD": 40, "Image": 3},
+		"bucket-b": {"SSS": 40, dto.SummaryUncategorized: 1},
+	}
+
+	tests := []struct {
+		name        string
+		limit       int
+		want        map[string]map[string]int
+		wantOmitted int
+	}{
+		{name: "no limit", limit: 0, want: summary},
+		{name: "under the limit", limit: 5, want: summary},
+		{
+			name:        "largest entries kept",
+			limit:       3,
+			want:        map[string]map[string]int{"bucket-a": {"SSS": 120, "RasterD": 40}, "bucket-b": {"SSS": 40}},
+			wantOmitted: 2,
+		},
+		{
+			name:        "ties broken by bucket",
+			limit:       2,
+			want:        map[string]map[string]int{"bucket-a": {"SSS": 120, "RasterD": 40}},
+			wantOmitted: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, omitted := limitSummary(summary, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) || omitted != tt.wantOmitted {
+				t.Errorf("Expected %v with %d omitted, got %v with %d omitted", tt.want, tt.wantOmitted, got, omitted)
+			}
+		})
+	}
+}
+
+func TestMessageHandler_HandleMessage_LogsSummary(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	cleansingService := &mockCleansingService{
+		filesDeleted: 4,
+		removed: []dto.S3Object{
+			{Bucket: "contractor-bucket", Key: "P1/S1/00_Upload/line1/Raw/a.xtf", Category: "SSS"},
+			{Bucket: "contractor-bucket", Key: "P1/S1/00_Upload/line1/Raw/b.xtf", Category: "SSS"},
+			{Bucket: "contractor-bucket", Key: "P1/S1/01_Processed/depth.geojson", Category: "RasterD"},
+			{Bucket: "logs-bucket", Key: "lambda/P1.log"},
+		},
+	}
+	handler := NewMessageHandler(cleansingService, &mockS3Service{})
+	handler.logSummaryLimit = 2
+	if err := handler.HandleMessage(&nsq.Message{Body: []byte(`{"type":"project","id":1}`)}); err != nil {
+		t.Fatalf("HandleMessage() unexpected error: %v", err)
+	}
+
+	var completed *log.Entry
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == "Completed cleansing operation" {
+			completed = entry
+		}
+	}
+	if completed == nil {
+		t.Fatal("Expected the completion log entry")
+	}
+
+	want := map[string]map[string]int{"contractor-bucket": {"SSS": 2, "RasterD": 1}}
+	if summary, _ := completed.Data["summary"].(map[string]map[string]int); !reflect.DeepEqual(summary, want) {
+		t.Errorf("Expected summary %v, got %v", want, completed.Data["summary"])
+	}
+	if completed.Data["summary_omitted"] != 1 {
+		t.Errorf("Expected 1 summary entry omitted, got %v", completed.Data["summary_omitted"])
+	}
+}
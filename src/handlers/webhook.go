@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"github.com/denys89/wadugs-worker-cleansing/src/service"
+)
+
+// webhookAttempts is how often a webhook POST is tried: the first attempt and a single retry
+const webhookAttempts = 2
+
+type (
+	// Notifier is told about every finished cleansing operation
+	Notifier interface {
+		Notify(ctx context.Context, result *dto.CleansingResult) error
+	}
+
+	// WebhookNotifier POSTs cleansing results as JSON to an HTTP endpoint, e.g. a chat or ops integration
+	WebhookNotifier struct {
+		url        string
+		client     *http.Client
+		fieldNames map[string]string // Renames top-level result fields in the payload; empty posts the DTO's schema
+	}
+)
+
+// NewWebhookNotifier creates a notifier posting to url, giving up on each attempt after timeout
+func NewWebhookNotifier(url string, timeout time.Duration) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Notify posts result to the webhook, retrying once when the endpoint is unreachable, times out or
+// responds with a non-2xx status. The error of the last attempt is returned.
+func (w *WebhookNotifier) Notify(ctx context.Context, result *dto.CleansingResult) error {
+	body, err := dto.MarshalCleansingResult(result, w.fieldNames)
+	if err != nil {
+		return fmt.Errorf("failed to encode cleansing result: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = w.post(ctx, body)
+		if err == nil || attempt == webhookAttempts || ctx.Err() != nil {
+			return err
+		}
+		workerLog.GetLoggerFromContext(ctx).WithError(err).Warn("Webhook notification failed, retrying")
+	}
+}
+
+// post sends a single webhook request
+func (w *WebhookNotifier) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if correlationID := workerLog.CorrelationIDFromContext(ctx); correlationID != "" {
+		req.Header.Set(service.CorrelationIDHeader, correlationID)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body) // let the connection be reused
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
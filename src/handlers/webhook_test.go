@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/nsqio/go-nsq"
+)
+
+func TestWebhookNotifier_Notify(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int         // Response status per request; the last one repeats
+		delay        time.Duration // Response delay per request
+		wantErr      bool
+		wantRequests int32
+	}{
+		{name: "success", statuses: []int{http.StatusNoContent}, wantRequests: 1},
+		{name: "retried once after a failure", statuses: []int{http.StatusServiceUnavailable, http.StatusOK}, wantRequests: 2},
+		{name: "non-2xx", statuses: []int{http.StatusInternalServerError}, wantErr: true, wantRequests: 2},
+		{name: "timeout", statuses: []int{http.StatusOK}, delay: 200 * time.Millisecond, wantErr: true, wantRequests: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			var mu sync.Mutex // The handler may still run after a timed out request was abandoned
+			var received dto.CleansingResult
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(requests.Add(1))
+				if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("Expected a JSON POST, got %s %s", r.Method, r.Header.Get("Content-Type"))
+				}
+				var body dto.CleansingResult
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("Webhook body is not a cleansing result: %v", err)
+				}
+				mu.Lock()
+				received = body
+				mu.Unlock()
+				time.Sleep(tt.delay)
+				w.WriteHeader(tt.statuses[min(n, len(tt.statuses))-1])
+			}))
+			defer server.Close()
+
+			result := &dto.CleansingResult{Type: "site", ID: 7, Success: true, FilesDeleted: 3}
+			err := NewWebhookNotifier(server.URL, 50*time.Millisecond).Notify(context.Background(), result)
+			if tt.wantErr && err == nil {
+				t.Error("Expected error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("Expected %d requests, got %d", tt.wantRequests, got)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if received.Type != "site" || received.ID != 7 || received.FilesDeleted != 3 {
+				t.Errorf("Expected the cleansing result to be posted, got %+v", received)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifier_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	if err := NewWebhookNotifier(url, time.Second).Notify(context.Background(), &dto.CleansingResult{}); err == nil {
+		t.Error("Expected error for an unreachable webhook")
+	}
+}
+
+// mockNotifier records notified results and fails with err when set
+type mockNotifier struct {
+	results []*dto.CleansingResult
+	err     error
+}
+
+func (m *mockNotifier) Notify(ctx context.Context, result *dto.CleansingResult) error {
+	m.results = append(m.results, result)
+	return m.err
+}
+
+func TestMessageHandler_HandleMessage_Notifies(t *testing.T) {
+	tests := []struct {
+		name        string
+		serviceErr  bool
+		notifyErr   error
+		expectError bool
+	}{
+		{name: "success"},
+		{name: "unreachable webhook does not fail the message", notifyErr: errors.New("connection refused")},
+		{name: "failed cleanse is notified", serviceErr: true, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := &mockNotifier{err: tt.notifyErr}
+			handler := NewMessageHandler(&mockCleansingService{shouldError: tt.serviceErr, errorMsg: "database unavailable"}, &mockS3Service{})
+			handler.notifier = notifier
+
+			err := handler.HandleMessage(&nsq.Message{Body: []byte(`{"type":"site","id":2}`)})
+			if tt.expectError != (err != nil) {
+				t.Errorf("Expected error %v, got %v", tt.expectError, err)
+			}
+			if len(notifier.results) != 1 || notifier.results[0].ID != 2 {
+				t.Errorf("Expected one notification for site 2, got %+v", notifier.results)
+			}
+		})
+	}
+}
+
+func TestNewMessageHandlerWithConfig_Webhook(t *testing.T) {
+	if handler := NewMessageHandlerWithConfig(&config.Config{}, &mockCleansingService{}, &mockS3Service{}); handler.notifier != nil {
+		t.Error("Expected no notifier without WEBHOOK_URL")
+	}
+	if handler := NewMessageHandlerWithConfig(&config.Config{WebhookURL: "http://hooks.example"}, &mockCleansingService{}, &mockS3Service{}); handler.notifier == nil {
+		t.Error("Expected a webhook notifier with WEBHOOK_URL")
+	}
+}
+
+func TestWebhookNotifier_Notify_FieldNames(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Webhook body is not JSON: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	handler := NewMessageHandlerWithConfig(&config.Config{
+		WebhookURL:       server.URL,
+		WebhookTimeout:   time.Second,
+		ResultFieldNames: map[string]string{"files_deleted": "deletedCount", "success": "ok"},
+	}, &mockCleansingService{}, &mockS3Service{})
+
+	result := &dto.CleansingResult{Type: "site", ID: 7, Success: true, FilesDeleted: 3}
+	if err := handler.notifier.Notify(context.Background(), result); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if body["deletedCount"] != float64(3) || body["ok"] != true || body["type"] != "site" {
+		t.Errorf("Expected the mapped schema to be posted, got %v", body)
+	}
+	if _, ok := body["files_deleted"]; ok {
+		t.Errorf("Expected files_deleted to be renamed, got %v", body)
+	}
+}
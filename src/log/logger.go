@@ -9,7 +9,8 @@ import (
 type contextKey string
 
 const (
-	loggerKey contextKey = "logger"
+	loggerKey        contextKey = "logger"
+	correlationIDKey contextKey = "correlation_id"
 )
 
 // WithLogger adds a logger with correlation ID to the context
@@ -23,9 +24,16 @@ func WithLogger(ctx context.Context, correlationID string) context.Context {
 		"service":        "wadugs-worker-cleansing",
 	})
 
+	ctx = context.WithValue(ctx, correlationIDKey, correlationID)
 	return context.WithValue(ctx, loggerKey, logger)
 }
 
+// CorrelationIDFromContext returns the correlation ID set by WithLogger, or "" if there is none
+func CorrelationIDFromContext(ctx context.Context) string {
+	correlationID, _ := ctx.Value(correlationIDKey).(string)
+	return correlationID
+}
+
 // GetLoggerFromContext retrieves the logger from context
 func GetLoggerFromContext(ctx context.Context) *log.Entry {
 	if logger, ok := ctx.Value(loggerKey).(*log.Entry); ok {
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "wadugs_cleansing"
+
+var (
+	// S3ObjectsDeleted counts objects S3 reported as deleted in DeleteObjects responses
+	S3ObjectsDeleted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "s3_objects_deleted_total",
+		Help:      "Number of S3 objects successfully deleted.",
+	})
+
+	// S3DeleteErrors counts per-key errors in DeleteObjects responses, labeled by S3 error code
+	S3DeleteErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "s3_delete_errors_total",
+		Help:      "Number of S3 objects that failed to delete, by S3 error code.",
+	}, []string{"code"})
+
+	// S3BucketObjectsRemaining tracks, per bucket being emptied, the objects not yet processed. It is seeded by
+	// counting the bucket before the first delete and lowered after every verified page of deletes, protected
+	// objects included, so it falls to 0 as the bucket empties; the series is removed once the run ends.
+	S3BucketObjectsRemaining = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "s3_bucket_objects_remaining",
+		Help:      "Objects not yet processed in a bucket being emptied.",
+	}, []string{"bucket"})
+
+	// CleansingMessages counts handled cleansing messages by effective priority and outcome
+	// (succeeded, failed, routed to the low priority topic or deferred while their type is disabled)
+	CleansingMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cleansing_messages_total",
+		Help:      "Number of cleansing messages handled, by priority and outcome.",
+	}, []string{"priority", "outcome"})
+
+	// SlowMessages counts cleansing messages whose processing took at least SLOW_THRESHOLD, by cleansing type
+	SlowMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "slow_messages_total",
+		Help:      "Number of cleansing messages processed slower than the slow threshold, by type.",
+	}, []string{"type"})
+
+	// LargeDeleteInputs counts DeleteObjects calls handed more objects than the warn threshold, by outcome
+	// (warned, rejected beyond the hard maximum, or overridden past it)
+	LargeDeleteInputs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "s3_large_delete_inputs_total",
+		Help:      "Number of S3 delete calls with more objects than the warn threshold, by outcome.",
+	}, []string{"outcome"})
+
+	// S3CircuitBreakerState is the state of the circuit breaker around S3 delete and list calls:
+	// 0 closed, 1 half-open, 2 open
+	S3CircuitBreakerState = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "s3_circuit_breaker_state",
+		Help:      "State of the S3 circuit breaker: 0 closed, 1 half-open, 2 open.",
+	})
+)
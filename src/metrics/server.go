@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// MetricsPath is where Serve exposes the registered collectors for Prometheus to scrape
+const MetricsPath = "/metrics"
+
+// Serve exposes the collectors of the default registry at MetricsPath on addr in the background. The returned
+// function shuts the listener down, waiting up to five seconds for scrapes in flight.
+func Serve(addr string) func() {
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, promhttp.Handler())
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.WithError(err).WithField("addr", addr).Error("Metrics listener failed")
+		}
+	}()
+	log.WithField("addr", addr).Info("Serving metrics")
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.WithError(err).Warn("Failed to shut down metrics listener")
+		}
+	}
+}
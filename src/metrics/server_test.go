@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve a port: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	stop := Serve(addr)
+	defer stop()
+
+	S3ObjectsDeleted.Add(0)
+
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		resp, err = http.Get("http://" + addr + MetricsPath)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Expected metrics to be served, got %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read metrics: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(string(body), "wadugs_cleansing_s3_objects_deleted_total") {
+		t.Errorf("Expected the worker's collectors in the scrape, got %s", body)
+	}
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type bucketCheckpointRepository struct {
+	db *gorm.DB
+}
+
+// NewBucketCheckpointRepository creates a new bucket_checkpoint repository
+func NewBucketCheckpointRepository(db *gorm.DB) BucketCheckpointRepository {
+	return &bucketCheckpointRepository{
+		db: db,
+	}
+}
+
+// Get returns the checkpoint of a bucket for a correlation ID
+func (r *bucketCheckpointRepository) Get(ctx context.Context, bucket, correlationID string) (*entity.BucketCheckpoint, error) {
+	var checkpoint entity.BucketCheckpoint
+	err := r.db.WithContext(ctx).Where("bucket = ? AND correlation_id = ?", bucket, correlationID).First(&checkpoint).Error
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return &checkpoint, nil
+}
+
+// Save inserts the checkpoint, or replaces the progress recorded for its bucket and correlation ID
+func (r *bucketCheckpointRepository) Save(ctx context.Context, checkpoint *entity.BucketCheckpoint) error {
+	checkpoint.UpdatedAt = time.Now().UTC()
+	return wrapError(r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "bucket"}, {Name: "correlation_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"start_after", "deleted", "protected", "updated_at"}),
+	}).Create(checkpoint).Error)
+}
+
+// Delete removes the checkpoint of a bucket for a correlation ID
+func (r *bucketCheckpointRepository) Delete(ctx context.Context, bucket, correlationID string) error {
+	return wrapError(r.db.WithContext(ctx).Where("bucket = ? AND correlation_id = ?", bucket, correlationID).Delete(&entity.BucketCheckpoint{}).Error)
+}
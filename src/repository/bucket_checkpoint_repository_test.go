@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+)
+
+func TestBucketCheckpointRepository_SaveGetDelete(t *testing.T) {
+	db := newTestDB(t, &entity.BucketCheckpoint{})
+	repo := NewBucketCheckpointRepository(db)
+	ctx := context.Background()
+
+	if _, err := repo.Get(ctx, "contractor-bucket", "cleansing-1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound before the first save, got %v", err)
+	}
+
+	if err := repo.Save(ctx, &entity.BucketCheckpoint{Bucket: "contractor-bucket", CorrelationId: "cleansing-1", StartAfter: "a", Deleted: 1}); err != nil {
+		t.Fatalf("Save() unexpected error: %v", err)
+	}
+	if err := repo.Save(ctx, &entity.BucketCheckpoint{Bucket: "contractor-bucket", CorrelationId: "cleansing-1", StartAfter: "b", Deleted: 2, Protected: 1}); err != nil {
+		t.Fatalf("Save() unexpected error on update: %v", err)
+	}
+	if err := repo.Save(ctx, &entity.BucketCheckpoint{Bucket: "contractor-bucket", CorrelationId: "cleansing-2", StartAfter: "z", Deleted: 9}); err != nil {
+		t.Fatalf("Save() unexpected error: %v", err)
+	}
+
+	checkpoint, err := repo.Get(ctx, "contractor-bucket", "cleansing-1")
+	if err != nil {
+		t.Fatalf("Get() unexpected error: %v", err)
+	}
+	if checkpoint.StartAfter != "b" || checkpoint.Deleted != 2 || checkpoint.Protected != 1 {
+		t.Errorf("Expected the second save to replace the first, got %+v", checkpoint)
+	}
+
+	if err := repo.Delete(ctx, "contractor-bucket", "cleansing-1"); err != nil {
+		t.Fatalf("Delete() unexpected error: %v", err)
+	}
+	if _, err := repo.Get(ctx, "contractor-bucket", "cleansing-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+	if _, err := repo.Get(ctx, "contractor-bucket", "cleansing-2"); err != nil {
+		t.Errorf("Expected the checkpoint of another message to be kept, got %v", err)
+	}
+}
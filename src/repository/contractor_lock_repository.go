@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type contractorLockRepository struct {
+	db *gorm.DB
+}
+
+// NewContractorLockRepository creates a new contractor_lock repository
+func NewContractorLockRepository(db *gorm.DB) ContractorLockRepository {
+	return &contractorLockRepository{
+		db: db,
+	}
+}
+
+// Acquire takes or extends owner's lease on a contractor. Both statements are single-row conditional writes, so
+// two instances racing for the same contractor cannot both succeed. Leases are timed by the database's clock, so
+// skew between worker hosts cannot make one take over a lease that has not expired.
+func (r *contractorLockRepository) Acquire(ctx context.Context, contractorID int64, owner string, ttl time.Duration) (bool, error) {
+	now, err := r.now(ctx)
+	if err != nil {
+		return false, err
+	}
+	expiresAt := now.Add(ttl)
+
+	// An existing lease is ours to extend, or free to take over once its holder let it expire
+	result := r.db.WithContext(ctx).Model(&entity.ContractorLock{}).
+		Where("contractor_id = ? AND (owner = ? OR expires_at < ?)", contractorID, owner, now).
+		Updates(map[string]interface{}{"owner": owner, "expires_at": expiresAt})
+	if result.Error != nil {
+		return false, wrapError(result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	// Without a lease row the first insert wins; a concurrent one conflicts and inserts nothing
+	result = r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&entity.ContractorLock{ContractorId: contractorID, Owner: owner, ExpiresAt: expiresAt})
+	if result.Error != nil {
+		return false, wrapError(result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Release deletes owner's lease on a contractor
+func (r *contractorLockRepository) Release(ctx context.Context, contractorID int64, owner string) error {
+	return wrapError(r.db.WithContext(ctx).Where("contractor_id = ? AND owner = ?", contractorID, owner).Delete(&entity.ContractorLock{}).Error)
+}
+
+// now reads the database's clock, as seconds since the epoch so the session time zone does not matter
+func (r *contractorLockRepository) now(ctx context.Context) (time.Time, error) {
+	query := "SELECT UNIX_TIMESTAMP(NOW(6))"
+	if r.db.Dialector.Name() == "sqlite" {
+		query = "SELECT (julianday('now') - 2440587.5) * 86400.0"
+	}
+
+	var seconds float64
+	if err := r.db.WithContext(ctx).Raw(query).Row().Scan(&seconds); err != nil {
+		return time.Time{}, wrapError(err)
+	}
+	return time.UnixMicro(int64(seconds * 1e6)).UTC(), nil
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+)
+
+func TestContractorLockRepository_AcquireRelease(t *testing.T) {
+	db := newTestDB(t, &entity.ContractorLock{})
+	repo := NewContractorLockRepository(db)
+	ctx := context.Background()
+
+	acquire := func(contractorID int64, owner string, ttl time.Duration) bool {
+		t.Helper()
+		acquired, err := repo.Acquire(ctx, contractorID, owner, ttl)
+		if err != nil {
+			t.Fatalf("Acquire() unexpected error: %v", err)
+		}
+		return acquired
+	}
+
+	if !acquire(1, "worker-a", time.Minute) {
+		t.Fatal("Expected worker-a to acquire a free lock")
+	}
+	if acquire(1, "worker-b", time.Minute) {
+		t.Error("Expected worker-b to be refused while worker-a holds the lock")
+	}
+	if !acquire(2, "worker-b", time.Minute) {
+		t.Error("Expected worker-b to acquire the lock of another contractor")
+	}
+	if !acquire(1, "worker-a", time.Minute) {
+		t.Error("Expected worker-a to extend its own lock")
+	}
+
+	// Only the holder releases a lock
+	if err := repo.Release(ctx, 1, "worker-b"); err != nil {
+		t.Fatalf("Release() unexpected error: %v", err)
+	}
+	if acquire(1, "worker-b", time.Minute) {
+		t.Error("Expected worker-b's release to leave worker-a's lock in place")
+	}
+	if err := repo.Release(ctx, 1, "worker-a"); err != nil {
+		t.Fatalf("Release() unexpected error: %v", err)
+	}
+	if !acquire(1, "worker-b", time.Minute) {
+		t.Error("Expected worker-b to acquire the released lock")
+	}
+}
+
+func TestContractorLockRepository_ExpiredLock(t *testing.T) {
+	db := newTestDB(t, &entity.ContractorLock{})
+	repo := NewContractorLockRepository(db)
+	ctx := context.Background()
+
+	// A worker that crashed leaves its lock behind until it expires
+	if err := db.Create(&entity.ContractorLock{ContractorId: 1, Owner: "crashed", ExpiresAt: time.Now().UTC().Add(-time.Second)}).Error; err != nil {
+		t.Fatalf("failed to seed lock: %v", err)
+	}
+
+	acquired, err := repo.Acquire(ctx, 1, "worker-a", time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire() unexpected error: %v", err)
+	}
+	if !acquired {
+		t.Fatal("Expected an expired lock to be taken over")
+	}
+
+	var lock entity.ContractorLock
+	if err := db.First(&lock, "contractor_id = ?", 1).Error; err != nil {
+		t.Fatalf("failed to read lock: %v", err)
+	}
+	if lock.Owner != "worker-a" {
+		t.Errorf("Expected owner worker-a, got %s", lock.Owner)
+	}
+	if !lock.ExpiresAt.After(time.Now()) {
+		t.Errorf("Expected the lock to expire in the future, got %s", lock.ExpiresAt)
+	}
+}
+
+func TestContractorLockRepository_DatabaseClock(t *testing.T) {
+	db := newTestDB(t, &entity.ContractorLock{})
+	repo := NewContractorLockRepository(db).(*contractorLockRepository)
+
+	now, err := repo.now(context.Background())
+	if err != nil {
+		t.Fatalf("now() unexpected error: %v", err)
+	}
+	if drift := time.Since(now); drift < -time.Minute || drift > time.Minute {
+		t.Errorf("Expected the database clock near the local one, got %s (drift %s)", now, drift)
+	}
+}
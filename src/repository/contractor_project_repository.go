@@ -31,7 +31,7 @@ func (r *contractorProjectRepository) GetByProjectID(ctx context.Context, projec
 	var contractorProject entity.ContractorProject
 	err := r.db.WithContext(ctx).Where("project_id = ?", projectID).First(&contractorProject).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return &contractorProject, nil
 }
@@ -41,12 +41,12 @@ func (r *contractorProjectRepository) GetByContractorID(ctx context.Context, con
 	var contractorProjects entity.ContractorProjects
 	err := r.db.WithContext(ctx).Where("contractor_id = ?", contractorID).Find(&contractorProjects).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return contractorProjects, nil
 }
 
 // HardDeleteByContractorID permanently deletes all contractor_project records for a contractor
 func (r *contractorProjectRepository) HardDeleteByContractorID(ctx context.Context, contractorID int64) error {
-	return r.db.WithContext(ctx).Where("contractor_id = ?", contractorID).Delete(&entity.ContractorProject{}).Error
+	return wrapError(r.db.WithContext(ctx).Where("contractor_id = ?", contractorID).Delete(&entity.ContractorProject{}).Error)
 }
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"slices"
 	"github.com/denys89/wadugs-worker-cleansing/src/entity"
 	"gorm.io/gorm"
 )
@@ -21,16 +22,60 @@ func (r *contractorRepository) GetByID(ctx context.Context, id int64) (*entity.C
 	var contractor entity.Contractor
 	err := r.db.WithContext(ctx).Where("id = ?", id).First(&contractor).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return &contractor, nil
 }
 
+// GetByIDs returns the contractors with the given IDs in a single query, ordered by ID. When some IDs have no
+// contractor the ones found are returned together with a *MissingIDsError listing the others.
+func (r *contractorRepository) GetByIDs(ctx context.Context, ids []int64) (entity.Contractors, error) {
+	if len(ids) == 0 {
+		return entity.Contractors{}, nil
+	}
+
+	var contractors entity.Contractors
+	err := r.db.WithContext(ctx).Where("id IN ?", ids).Order("id").Find(&contractors).Error
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	found := make(map[int64]bool, len(contractors))
+	for _, contractor := range contractors {
+		found[contractor.Id] = true
+	}
+	var missing []int64
+	for _, id := range ids {
+		if !found[id] {
+			found[id] = true // report duplicates once
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return contractors, &MissingIDsError{Table: entity.Contractor{}.TableName(), IDs: missing}
+	}
+	return contractors, nil
+}
+
 func (r *contractorRepository) GetAll(ctx context.Context) (entity.Contractors, error) {
 	var contractors entity.Contractors
 	err := r.db.WithContext(ctx).Find(&contractors).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
+	}
+	return contractors, nil
+}
+
+// GetAllPaged returns up to limit contractor rows with an ID greater than lastID, ordered by ID
+func (r *contractorRepository) GetAllPaged(ctx context.Context, limit, lastID int64) (entity.Contractors, error) {
+	query, err := keysetPage(r.db.WithContext(ctx), entity.Contractor{}, limit, lastID)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	var contractors entity.Contractors
+	if err := query.Find(&contractors).Error; err != nil {
+		return nil, wrapError(err)
 	}
 	return contractors, nil
 }
@@ -39,15 +84,56 @@ func (r *contractorRepository) GetByStatus(ctx context.Context, status int8) (en
 	var contractors entity.Contractors
 	err := r.db.WithContext(ctx).Where("status = ?", status).Find(&contractors).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return contractors, nil
 }
 
+// CountByBucketName returns how many contractors reference the given S3 bucket, as their bucket or one of their
+// extra buckets
+func (r *contractorRepository) CountByBucketName(ctx context.Context, bucketName string) (int64, error) {
+	// Bucket names cannot contain LIKE wildcards; the pattern only narrows the rows, exact names are matched below
+	var contractors entity.Contractors
+	err := r.db.WithContext(ctx).Select("id", "aws_bucket_name", "aws_extra_buckets").
+		Where("aws_bucket_name = ? OR aws_extra_buckets LIKE ?", bucketName, "%"+bucketName+"%").
+		Find(&contractors).Error
+	if err != nil {
+		return 0, wrapError(err)
+	}
+
+	var count int64
+	for _, contractor := range contractors {
+		if contractor.AwsBucketName == bucketName || slices.Contains(contractor.ExtraBuckets(), bucketName) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetByBucketName returns the contractor with the lowest ID that references the given S3 bucket
+func (r *contractorRepository) GetByBucketName(ctx context.Context, bucketName string) (*entity.Contractor, error) {
+	var contractor entity.Contractor
+	err := r.db.WithContext(ctx).Where("aws_bucket_name = ?", bucketName).Order("id").First(&contractor).Error
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return &contractor, nil
+}
+
+// Update persists all fields of an existing contractor
+func (r *contractorRepository) Update(ctx context.Context, contractor *entity.Contractor) error {
+	return wrapError(r.db.WithContext(ctx).Save(contractor).Error)
+}
+
+// SetStatus updates only the status column of a contractor
+func (r *contractorRepository) SetStatus(ctx context.Context, id int64, status int8) error {
+	return wrapError(r.db.WithContext(ctx).Model(&entity.Contractor{}).Where("id = ?", id).Update("status", status).Error)
+}
+
 func (r *contractorRepository) Delete(ctx context.Context, id int64) error {
 	err := r.db.WithContext(ctx).Where("id = ?", id).Delete(&entity.Contractor{}).Error
 	if err != nil {
-		return err
+		return wrapError(err)
 	}
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"gorm.io/gorm"
+)
+
+func TestContractorRepository_Update(t *testing.T) {
+	db := newTestDB(t, &entity.Contractor{})
+	repo := NewContractorRepository(db)
+	ctx := context.Background()
+
+	contractor := &entity.Contractor{Id: 1, Name: "Old Name", Status: entity.ContractorStatusActive, AwsBucketName: "old-bucket"}
+	if err := db.Create(contractor).Error; err != nil {
+		t.Fatalf("failed to seed contractor: %v", err)
+	}
+
+	contractor.Name = "New Name"
+	contractor.AwsBucketName = "new-bucket"
+	contractor.Status = entity.ContractorStatusInactive
+	if err := repo.Update(ctx, contractor); err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+
+	got, err := repo.GetByID(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetByID() unexpected error: %v", err)
+	}
+	if got.Name != "New Name" || got.AwsBucketName != "new-bucket" {
+		t.Errorf("Update() did not persist fields, got %+v", got)
+	}
+	if got.Status != entity.ContractorStatusInactive {
+		t.Errorf("Update() did not persist zero status, got %d", got.Status)
+	}
+}
+
+func TestContractorRepository_SetStatus(t *testing.T) {
+	db := newTestDB(t, &entity.Contractor{})
+	repo := NewContractorRepository(db)
+	ctx := context.Background()
+
+	seed := entity.Contractors{
+		{Id: 1, Name: "Target", Status: entity.ContractorStatusActive},
+		{Id: 2, Name: "Other", Status: entity.ContractorStatusActive},
+	}
+	if err := db.Create(&seed).Error; err != nil {
+		t.Fatalf("failed to seed contractors: %v", err)
+	}
+
+	if err := repo.SetStatus(ctx, 1, entity.ContractorStatusInactive); err != nil {
+		t.Fatalf("SetStatus() unexpected error: %v", err)
+	}
+
+	target, err := repo.GetByID(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetByID() unexpected error: %v", err)
+	}
+	if target.Status != entity.ContractorStatusInactive {
+		t.Errorf("Expected contractor 1 to be inactive, got status %d", target.Status)
+	}
+	if target.Name != "Target" {
+		t.Errorf("SetStatus() should not touch other columns, got name %q", target.Name)
+	}
+
+	other, err := repo.GetByID(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetByID() unexpected error: %v", err)
+	}
+	if other.Status != entity.ContractorStatusActive {
+		t.Errorf("Expected contractor 2 to stay active, got status %d", other.Status)
+	}
+
+	inactive, err := repo.GetByStatus(ctx, entity.ContractorStatusInactive)
+	if err != nil {
+		t.Fatalf("GetByStatus() unexpected error: %v", err)
+	}
+	if len(inactive) != 1 || inactive[0].Id != 1 {
+		t.Errorf("Expected only contractor 1 to be inactive, got %+v", inactive)
+	}
+}
+
+func TestContractorRepository_CountByBucketName(t *testing.T) {
+	db := newTestDB(t, &entity.Contractor{})
+	repo := NewContractorRepository(db)
+	ctx := context.Background()
+
+	seed := entity.Contractors{
+		{Id: 1, Name: "Shared A", AwsBucketName: "shared-bucket"},
+		{Id: 2, Name: "Shared B", AwsBucketName: "shared-bucket"},
+		{Id: 3, Name: "Dedicated", AwsBucketName: "dedicated-bucket"},
+		{Id: 4, Name: "Archive", AwsBucketName: "active-bucket", AwsExtraBuckets: "archive-bucket, shared-bucket"},
+	}
+	if err := db.Create(&seed).Error; err != nil {
+		t.Fatalf("failed to seed contractors: %v", err)
+	}
+
+	tests := []struct {
+		bucket string
+		want   int64
+	}{
+		{bucket: "shared-bucket", want: 3},
+		{bucket: "dedicated-bucket", want: 1},
+		{bucket: "archive-bucket", want: 1},
+		{bucket: "archive", want: 0},
+		{bucket: "unknown-bucket", want: 0},
+	}
+	for _, tt := range tests {
+		got, err := repo.CountByBucketName(ctx, tt.bucket)
+		if err != nil {
+			t.Fatalf("CountByBucketName(%q) unexpected error: %v", tt.bucket, err)
+		}
+		if got != tt.want {
+			t.Errorf("CountByBucketName(%q): expected %d, got %d", tt.bucket, tt.want, got)
+		}
+	}
+}
+
+func TestContractorRepository_GetByBucketName(t *testing.T) {
+	db := newTestDB(t, &entity.Contractor{})
+	repo := NewContractorRepository(db)
+	ctx := context.Background()
+
+	seed := entity.Contractors{
+		{Id: 2, Name: "Shared B", AwsBucketName: "shared-bucket"},
+		{Id: 1, Name: "Shared A", AwsBucketName: "shared-bucket", AwsBucketRegion: "ap-southeast-1"},
+	}
+	if err := db.Create(&seed).Error; err != nil {
+		t.Fatalf("failed to seed contractors: %v", err)
+	}
+
+	contractor, err := repo.GetByBucketName(ctx, "shared-bucket")
+	if err != nil {
+		t.Fatalf("GetByBucketName() unexpected error: %v", err)
+	}
+	if contractor.Id != 1 || contractor.AwsBucketRegion != "ap-southeast-1" {
+		t.Errorf("Expected contractor 1 in ap-southeast-1, got %+v", contractor)
+	}
+
+	if _, err := repo.GetByBucketName(ctx, "unknown-bucket"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected gorm.ErrRecordNotFound for an unknown bucket, got %v", err)
+	}
+}
+
+func TestContractorRepository_GetByIDs(t *testing.T) {
+	db := newTestDB(t, &entity.Contractor{})
+	repo := NewContractorRepository(db)
+	ctx := context.Background()
+
+	seed := entity.Contractors{
+		{Id: 1, Name: "Contractor A"},
+		{Id: 2, Name: "Contractor B"},
+		{Id: 3, Name: "Contractor C"},
+	}
+	if err := db.Create(&seed).Error; err != nil {
+		t.Fatalf("failed to seed contractors: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		ids         []int64
+		wantIDs     []int64
+		wantMissing []int64
+	}{
+		{name: "all exist", ids: []int64{3, 1}, wantIDs: []int64{1, 3}},
+		{name: "some missing", ids: []int64{2, 7, 1, 9, 7}, wantIDs: []int64{1, 2}, wantMissing: []int64{7, 9}},
+		{name: "none exist", ids: []int64{8}, wantMissing: []int64{8}},
+		{name: "no ids", ids: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contractors, err := repo.GetByIDs(ctx, tt.ids)
+
+			var missing *MissingIDsError
+			if tt.wantMissing == nil {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			} else {
+				if !errors.As(err, &missing) {
+					t.Fatalf("Expected *MissingIDsError, got %v", err)
+				}
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					t.Errorf("Expected the error to match gorm.ErrRecordNotFound")
+				}
+				if fmt.Sprint(missing.IDs) != fmt.Sprint(tt.wantMissing) {
+					t.Errorf("Expected missing ids %v, got %v", tt.wantMissing, missing.IDs)
+				}
+			}
+
+			gotIDs := make([]int64, 0, len(contractors))
+			for _, contractor := range contractors {
+				gotIDs = append(gotIDs, contractor.Id)
+			}
+			if fmt.Sprint(gotIDs) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("Expected contractors %v, got %v", tt.wantIDs, gotIDs)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/denys89/wadugs-worker-cleansing/src/entity"
 	"gorm.io/gorm"
@@ -22,7 +23,7 @@ func (r *documentGroupRepository) GetByID(ctx context.Context, id int64) (*entit
 	var documentGroup entity.DocumentGroup
 	err := r.db.WithContext(ctx).Where("id = ?", id).First(&documentGroup).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return &documentGroup, nil
 }
@@ -31,7 +32,21 @@ func (r *documentGroupRepository) GetAll(ctx context.Context) (entity.DocumentGr
 	var documentGroups entity.DocumentGroups
 	err := r.db.WithContext(ctx).Find(&documentGroups).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
+	}
+	return documentGroups, nil
+}
+
+// GetAllPaged returns up to limit document group rows with an ID greater than lastID, ordered by ID
+func (r *documentGroupRepository) GetAllPaged(ctx context.Context, limit, lastID int64) (entity.DocumentGroups, error) {
+	query, err := keysetPage(r.db.WithContext(ctx), entity.DocumentGroup{}, limit, lastID)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	var documentGroups entity.DocumentGroups
+	if err := query.Find(&documentGroups).Error; err != nil {
+		return nil, wrapError(err)
 	}
 	return documentGroups, nil
 }
@@ -40,7 +55,7 @@ func (r *documentGroupRepository) GetBySiteID(ctx context.Context, siteID int64)
 	var documentGroups entity.DocumentGroups
 	err := r.db.WithContext(ctx).Where("site_id = ?", siteID).Find(&documentGroups).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return documentGroups, nil
 }
@@ -49,7 +64,7 @@ func (r *documentGroupRepository) GetByStatus(ctx context.Context, status int8)
 	var documentGroups entity.DocumentGroups
 	err := r.db.WithContext(ctx).Where("status = ?", status).Find(&documentGroups).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return documentGroups, nil
 }
@@ -58,12 +73,34 @@ func (r *documentGroupRepository) GetByProgress(ctx context.Context, progress in
 	var documentGroups entity.DocumentGroups
 	err := r.db.WithContext(ctx).Where("progress = ?", progress).Find(&documentGroups).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return documentGroups, nil
 }
 
 // HardDeleteBySiteID permanently deletes all document groups belonging to a site
 func (r *documentGroupRepository) HardDeleteBySiteID(ctx context.Context, siteID int64) error {
-	return r.db.WithContext(ctx).Where("site_id = ?", siteID).Delete(&entity.DocumentGroup{}).Error
+	return wrapError(r.db.WithContext(ctx).Where("site_id = ?", siteID).Delete(&entity.DocumentGroup{}).Error)
+}
+
+// HardDeleteContents permanently deletes a document group's files and documents, keeping the group itself.
+// Both are removed in one transaction, so a failure leaves no file without its document.
+func (r *documentGroupRepository) HardDeleteContents(ctx context.Context, groupID int64) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := NewFileRepository(tx).HardDeleteByGroupIDs(ctx, []int64{groupID}); err != nil {
+			return fmt.Errorf("failed to delete files: %w", err)
+		}
+		if err := NewDocumentRepository(tx).HardDeleteByGroupID(ctx, groupID); err != nil {
+			return fmt.Errorf("failed to delete documents: %w", err)
+		}
+		return nil
+	})
+	return wrapError(err)
+}
+
+// CountBySiteID returns the number of document groups of a site
+func (r *documentGroupRepository) CountBySiteID(ctx context.Context, siteID int64) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&entity.DocumentGroup{}).Where("site_id = ?", siteID).Count(&count).Error
+	return count, wrapError(err)
 }
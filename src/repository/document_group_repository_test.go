@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+)
+
+func TestDocumentGroupRepository_HardDeleteContents(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+
+	if err := NewDocumentGroupRepository(db).HardDeleteContents(context.Background(), 1000); err != nil {
+		t.Fatalf("HardDeleteContents() unexpected error: %v", err)
+	}
+
+	// The group's documents and files are gone, the group itself stays
+	if got := countRows(t, db, &entity.Document{}, "group_id = ?", 1000); got != 0 {
+		t.Errorf("Expected group documents to be deleted, found %d", got)
+	}
+	if got := countRows(t, db, &entity.File{}, "document_id = ?", 5000); got != 0 {
+		t.Errorf("Expected group files to be deleted, found %d", got)
+	}
+	if got := countRows(t, db, &entity.DocumentGroup{}, "id = ?", 1000); got != 1 {
+		t.Errorf("Expected the group to be kept, found %d rows", got)
+	}
+
+	// Other groups keep their contents
+	if got := countRows(t, db, &entity.Document{}, "1 = 1"); got != 3 {
+		t.Errorf("Expected 3 remaining documents, found %d", got)
+	}
+	if got := countRows(t, db, &entity.File{}, "1 = 1"); got != 3 {
+		t.Errorf("Expected 3 remaining files, found %d", got)
+	}
+}
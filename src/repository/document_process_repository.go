@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"gorm.io/gorm"
+)
+
+// documentProcessColumns maps the joined document → document_group → site → project → contractor columns onto
+// entity.DocumentProcess. UploaderId and TotalSize have no source in this join and are left zero.
+const documentProcessColumns = `document.id AS id, document.name AS name, document.group_id AS group_id,
+	document_group.category AS category, document_group.progress AS progress,
+	site.id AS site_id, site.code AS site_code, site.alias AS site_alias, site.name AS site_name,
+	project.id AS project_id, project.code AS project_code, project.alias AS project_alias, project.name AS project_name,
+	project.g_crs AS gcrs, project.p_crs AS pcrs,
+	contractor.id AS contractor_id, contractor.alias AS contractor_alias,
+	contractor.aws_iam_access_key_id AS aws_iam_access_key_id, contractor.aws_iam_secret_access_key AS aws_iam_secret_access_key,
+	contractor.aws_bucket_name AS aws_bucket_name, contractor.aws_bucket_region AS aws_bucket_region,
+	contractor.db_name AS db_name, contractor.db_user AS db_user, contractor.db_pass AS db_pass, contractor.db_host AS db_host`
+
+type documentProcessRepository struct {
+	db *gorm.DB
+}
+
+// NewDocumentProcessRepository creates a new document process repository
+func NewDocumentProcessRepository(db *gorm.DB) DocumentProcessRepository {
+	return &documentProcessRepository{
+		db: db,
+	}
+}
+
+// GetBySiteID returns every document of a site joined with its group, site, project and contractor in a single query,
+// ordered by document ID
+func (r *documentProcessRepository) GetBySiteID(ctx context.Context, siteID int64) (entity.DocumentProcesses, error) {
+	return r.find(r.db.WithContext(ctx).Where("site.id = ?", siteID))
+}
+
+// GetByProjectID returns every document of a project's sites joined with its group, site, project and contractor
+// in a single query, ordered by document ID
+func (r *documentProcessRepository) GetByProjectID(ctx context.Context, projectID int64) (entity.DocumentProcesses, error) {
+	return r.find(r.db.WithContext(ctx).Where("project.id = ?", projectID))
+}
+
+// find runs the document process join restricted by scope. Documents of a project without a contractor
+// association are not returned.
+func (r *documentProcessRepository) find(scope *gorm.DB) (entity.DocumentProcesses, error) {
+	var processes entity.DocumentProcesses
+	err := scope.Table("document").
+		Select(documentProcessColumns).
+		Joins("JOIN document_group ON document_group.id = document.group_id").
+		Joins("JOIN site ON site.id = document_group.site_id").
+		Joins("JOIN project ON project.id = site.project_id").
+		Joins("JOIN contractor_project ON contractor_project.project_id = project.id").
+		Joins("JOIN contractor ON contractor.id = contractor_project.contractor_id").
+		Order("document.id").
+		Scan(&processes).Error
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return processes, nil
+}
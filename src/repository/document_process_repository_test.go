@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+)
+
+func TestDocumentProcessRepository_GetBySiteID(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+
+	processes, err := NewDocumentProcessRepository(db).GetBySiteID(context.Background(), testutil.SiteID)
+	if err != nil {
+		t.Fatalf("GetBySiteID() unexpected error: %v", err)
+	}
+	if len(processes) != 2 {
+		t.Fatalf("Expected 2 documents, got %d", len(processes))
+	}
+
+	want := entity.DocumentProcess{
+		Id:              5000,
+		Name:            "line1",
+		GroupId:         1000,
+		Category:        "SSS",
+		SiteId:          testutil.SiteID,
+		SiteCode:        "S100",
+		SiteName:        "Site 100",
+		ProjectId:       testutil.ProjectID,
+		ProjectCode:     "PRJA",
+		ProjectName:     "Project A",
+		ContractorId:    testutil.ContractorID,
+		AwsBucketName:   testutil.Bucket,
+		AwsBucketRegion: testutil.Region,
+	}
+	if processes[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, processes[0])
+	}
+	if processes[1].Id != 5001 || processes[1].Category != "RasterD" || processes[1].Progress != 40 {
+		t.Errorf("Expected document 5001 of the processed RasterD group, got %+v", processes[1])
+	}
+}
+
+func TestDocumentProcessRepository_GetByProjectID(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	repo := NewDocumentProcessRepository(db)
+	ctx := context.Background()
+
+	// Project 10 keeps its contractor association; project 20 loses it
+	if err := db.Where("project_id = ?", testutil.OtherProjectID).Delete(&entity.ContractorProject{}).Error; err != nil {
+		t.Fatalf("failed to delete contractor association: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		projectID int64
+		wantIDs   []int64
+	}{
+		{name: "every site of the project", projectID: testutil.ProjectID, wantIDs: []int64{5000, 5001, 5010}},
+		{name: "project without sites", projectID: testutil.SecondProjectID},
+		{name: "project without contractor", projectID: testutil.OtherProjectID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processes, err := repo.GetByProjectID(ctx, tt.projectID)
+			if err != nil {
+				t.Fatalf("GetByProjectID() unexpected error: %v", err)
+			}
+			if len(processes) != len(tt.wantIDs) {
+				t.Fatalf("Expected %d documents, got %d", len(tt.wantIDs), len(processes))
+			}
+			for i, process := range processes {
+				if process.Id != tt.wantIDs[i] {
+					t.Errorf("Expected document %d, got %d", tt.wantIDs[i], process.Id)
+				}
+				if process.ProjectCode != "PRJA" || process.AwsBucketName != testutil.Bucket {
+					t.Errorf("Expected project PRJA in %s, got %s in %s", testutil.Bucket, process.ProjectCode, process.AwsBucketName)
+				}
+			}
+		})
+	}
+}
+
+func TestFileRepository_GetByDocumentIDs(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	repo := NewFileRepository(db)
+	ctx := context.Background()
+
+	files, err := repo.GetByDocumentIDs(ctx, []int64{5000, 6000}, 0, 0)
+	if err != nil {
+		t.Fatalf("GetByDocumentIDs() unexpected error: %v", err)
+	}
+	wantIDs := []int64{1, 2, 5}
+	if len(files) != len(wantIDs) {
+		t.Fatalf("Expected %d files, got %d", len(wantIDs), len(files))
+	}
+	for i, file := range files {
+		if file.Id != wantIDs[i] {
+			t.Errorf("Expected file %d, got %d", wantIDs[i], file.Id)
+		}
+	}
+
+	if files, err := repo.GetByDocumentIDs(ctx, nil, 0, 0); err != nil || len(files) != 0 {
+		t.Errorf("Expected no files for no documents, got %d (%v)", len(files), err)
+	}
+}
@@ -22,7 +22,7 @@ func (r *documentRepository) GetByID(ctx context.Context, id int64) (*entity.Doc
 	var document entity.Document
 	err := r.db.WithContext(ctx).Where("id = ?", id).First(&document).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return &document, nil
 }
@@ -31,7 +31,21 @@ func (r *documentRepository) GetAll(ctx context.Context) (entity.Documents, erro
 	var documents entity.Documents
 	err := r.db.WithContext(ctx).Find(&documents).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
+	}
+	return documents, nil
+}
+
+// GetAllPaged returns up to limit document rows with an ID greater than lastID, ordered by ID
+func (r *documentRepository) GetAllPaged(ctx context.Context, limit, lastID int64) (entity.Documents, error) {
+	query, err := keysetPage(r.db.WithContext(ctx), entity.Document{}, limit, lastID)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	var documents entity.Documents
+	if err := query.Find(&documents).Error; err != nil {
+		return nil, wrapError(err)
 	}
 	return documents, nil
 }
@@ -40,7 +54,21 @@ func (r *documentRepository) GetByGroupID(ctx context.Context, groupID int64) (e
 	var documents entity.Documents
 	err := r.db.WithContext(ctx).Where("group_id = ?", groupID).Find(&documents).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
+	}
+	return documents, nil
+}
+
+// GetByGroupIDs returns the documents of all the given document groups in a single query, ordered by ID
+func (r *documentRepository) GetByGroupIDs(ctx context.Context, groupIDs []int64) (entity.Documents, error) {
+	if len(groupIDs) == 0 {
+		return entity.Documents{}, nil
+	}
+
+	var documents entity.Documents
+	err := r.db.WithContext(ctx).Where("group_id IN ?", groupIDs).Order("id").Find(&documents).Error
+	if err != nil {
+		return nil, wrapError(err)
 	}
 	return documents, nil
 }
@@ -49,14 +77,37 @@ func (r *documentRepository) GetByStatus(ctx context.Context, status int8) (enti
 	var documents entity.Documents
 	err := r.db.WithContext(ctx).Where("status = ?", status).Find(&documents).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return documents, nil
 }
 
 // HardDeleteBySiteID permanently deletes all documents belonging to document groups of a site
 func (r *documentRepository) HardDeleteBySiteID(ctx context.Context, siteID int64) error {
-	return r.db.WithContext(ctx).
+	return wrapError(r.db.WithContext(ctx).
 		Exec("DELETE FROM document WHERE group_id IN (SELECT id FROM document_group WHERE site_id = ?)", siteID).
-		Error
+		Error)
+}
+
+// HardDeleteByGroupID permanently deletes all documents belonging to a document group
+func (r *documentRepository) HardDeleteByGroupID(ctx context.Context, groupID int64) error {
+	return wrapError(r.db.WithContext(ctx).Where("group_id = ?", groupID).Delete(&entity.Document{}).Error)
+}
+
+// HardDeleteByGroupIDs permanently deletes all documents belonging to the given document groups
+func (r *documentRepository) HardDeleteByGroupIDs(ctx context.Context, groupIDs []int64) error {
+	if len(groupIDs) == 0 {
+		return nil
+	}
+	return wrapError(r.db.WithContext(ctx).Where("group_id IN ?", groupIDs).Delete(&entity.Document{}).Error)
+}
+
+// CountByGroupIDs returns the number of documents belonging to the given document groups
+func (r *documentRepository) CountByGroupIDs(ctx context.Context, groupIDs []int64) (int64, error) {
+	if len(groupIDs) == 0 {
+		return 0, nil
+	}
+	var count int64
+	err := r.db.WithContext(ctx).Model(&entity.Document{}).Where("group_id IN ?", groupIDs).Count(&count).Error
+	return count, wrapError(err)
 }
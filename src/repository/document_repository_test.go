@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+)
+
+// seedGroupDocuments inserts documents 1-6 spread over groups 10, 20 and 30
+func seedGroupDocuments(t *testing.T) DocumentRepository {
+	t.Helper()
+
+	db := newTestDB(t, &entity.Document{})
+	seed := entity.Documents{
+		{Id: 4, GroupID: 20, Name: "d"},
+		{Id: 1, GroupID: 10, Name: "a"},
+		{Id: 2, GroupID: 10, Name: "b"},
+		{Id: 5, GroupID: 30, Name: "e"},
+		{Id: 3, GroupID: 20, Name: "c"},
+		{Id: 6, GroupID: 30, Name: "f"},
+	}
+	if err := db.Create(&seed).Error; err != nil {
+		t.Fatalf("failed to seed documents: %v", err)
+	}
+	return NewDocumentRepository(db)
+}
+
+// documentIDs returns the IDs of all remaining documents in ID order
+func documentIDs(t *testing.T, repo DocumentRepository) []int64 {
+	t.Helper()
+
+	documents, err := repo.GetAllPaged(context.Background(), 100, 0)
+	if err != nil {
+		t.Fatalf("GetAllPaged() unexpected error: %v", err)
+	}
+	ids := make([]int64, 0, len(documents))
+	for _, document := range documents {
+		ids = append(ids, document.Id)
+	}
+	return ids
+}
+
+func TestDocumentRepository_GetByGroupIDs(t *testing.T) {
+	repo := seedGroupDocuments(t)
+
+	tests := []struct {
+		name     string
+		groupIDs []int64
+		wantIDs  []int64
+	}{
+		{name: "single group", groupIDs: []int64{20}, wantIDs: []int64{3, 4}},
+		{name: "several groups", groupIDs: []int64{30, 10}, wantIDs: []int64{1, 2, 5, 6}},
+		{name: "unknown group", groupIDs: []int64{99}, wantIDs: []int64{}},
+		{name: "no groups", groupIDs: nil, wantIDs: []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			documents, err := repo.GetByGroupIDs(context.Background(), tt.groupIDs)
+			if err != nil {
+				t.Fatalf("GetByGroupIDs() unexpected error: %v", err)
+			}
+
+			ids := make([]int64, 0, len(documents))
+			for _, document := range documents {
+				ids = append(ids, document.Id)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("Expected documents %v, got %v", tt.wantIDs, ids)
+			}
+		})
+	}
+}
+
+func TestDocumentRepository_HardDeleteByGroup(t *testing.T) {
+	tests := []struct {
+		name    string
+		delete  func(repo DocumentRepository) error
+		wantIDs []int64
+	}{
+		{
+			name:    "single group",
+			delete:  func(repo DocumentRepository) error { return repo.HardDeleteByGroupID(context.Background(), 20) },
+			wantIDs: []int64{1, 2, 5, 6},
+		},
+		{
+			name: "several groups",
+			delete: func(repo DocumentRepository) error {
+				return repo.HardDeleteByGroupIDs(context.Background(), []int64{10, 30})
+			},
+			wantIDs: []int64{3, 4},
+		},
+		{
+			name:    "no groups deletes nothing",
+			delete:  func(repo DocumentRepository) error { return repo.HardDeleteByGroupIDs(context.Background(), nil) },
+			wantIDs: []int64{1, 2, 3, 4, 5, 6},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := seedGroupDocuments(t)
+
+			if err := tt.delete(repo); err != nil {
+				t.Fatalf("delete unexpected error: %v", err)
+			}
+			if ids := documentIDs(t, repo); !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("Expected remaining documents %v, got %v", tt.wantIDs, ids)
+			}
+		})
+	}
+}
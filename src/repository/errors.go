@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotFound is matched by errors returned when the requested rows do not exist
+	ErrNotFound = errors.New("record not found")
+	// ErrQuery is matched by errors returned when a query fails for any other reason
+	ErrQuery = errors.New("query failed")
+)
+
+// dbError classifies an error returned by gorm. errors.Is matches it against ErrNotFound or ErrQuery, and
+// Unwrap returns the underlying gorm or driver error, so callers can still inspect it.
+type dbError struct {
+	kind error
+	err  error
+}
+
+func (e *dbError) Error() string {
+	return e.err.Error()
+}
+
+func (e *dbError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *dbError) Unwrap() error {
+	return e.err
+}
+
+// wrapError classifies err as ErrNotFound or ErrQuery. Errors already classified, such as those of a nested
+// repository call inside a transaction, are returned unchanged.
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var classified *dbError
+	if errors.As(err, &classified) || errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &dbError{kind: ErrNotFound, err: err}
+	}
+	return &dbError{kind: ErrQuery, err: err}
+}
+
+// MissingIDsError reports the requested IDs for which a batch read found no row.
+// It matches ErrNotFound and gorm.ErrRecordNotFound, like the error of a single-row read.
+type MissingIDsError struct {
+	Table string
+	IDs   []int64
+}
+
+func (e *MissingIDsError) Error() string {
+	return fmt.Sprintf("%s: no rows for ids %v", e.Table, e.IDs)
+}
+
+func (e *MissingIDsError) Is(target error) bool {
+	return target == ErrNotFound || target == gorm.ErrRecordNotFound
+}
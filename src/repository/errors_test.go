@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"gorm.io/gorm"
+)
+
+func TestRepositories_MissingRowIsErrNotFound(t *testing.T) {
+	db := newTestDB(t, &entity.Contractor{}, &entity.ContractorProject{}, &entity.Project{}, &entity.Site{},
+		&entity.DocumentGroup{}, &entity.Document{}, &entity.File{})
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		get  func() error
+	}{
+		{"contractor", func() error { _, err := NewContractorRepository(db).GetByID(ctx, 99); return err }},
+		{"contractor by bucket", func() error { _, err := NewContractorRepository(db).GetByBucketName(ctx, "unknown-bucket"); return err }},
+		{"contractor project", func() error { _, err := NewContractorProjectRepository(db).GetByProjectID(ctx, 99); return err }},
+		{"project", func() error { _, err := NewProjectRepository(db).GetByID(ctx, 99); return err }},
+		{"site", func() error { _, err := NewSiteRepository(db).GetByID(ctx, 99); return err }},
+		{"document group", func() error { _, err := NewDocumentGroupRepository(db).GetByID(ctx, 99); return err }},
+		{"document", func() error { _, err := NewDocumentRepository(db).GetByID(ctx, 99); return err }},
+		{"file", func() error { _, err := NewFileRepository(db).GetByID(ctx, 99); return err }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.get()
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Expected ErrNotFound, got %v", err)
+			}
+			if errors.Is(err, ErrQuery) {
+				t.Errorf("Expected a missing row not to match ErrQuery")
+			}
+			if unwrapped := errors.Unwrap(err); unwrapped != gorm.ErrRecordNotFound {
+				t.Errorf("Expected Unwrap to return gorm.ErrRecordNotFound, got %v", unwrapped)
+			}
+		})
+	}
+}
+
+func TestRepositories_FailedQueryIsErrQuery(t *testing.T) {
+	// No tables are migrated, so every query fails
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	_, err := NewProjectRepository(db).GetByID(ctx, 1)
+	if !errors.Is(err, ErrQuery) {
+		t.Fatalf("Expected ErrQuery, got %v", err)
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected a failed query not to match ErrNotFound")
+	}
+	if errors.Unwrap(err) == nil {
+		t.Errorf("Expected the driver error to be reachable through Unwrap")
+	}
+
+	if err := NewSiteRepository(db).HardDeleteCascade(ctx, 1); !errors.Is(err, ErrQuery) {
+		t.Errorf("Expected ErrQuery from a failed transaction, got %v", err)
+	}
+}
+
+func TestWrapError(t *testing.T) {
+	nested := wrapError(gorm.ErrRecordNotFound)
+
+	tests := []struct {
+		name         string
+		err          error
+		wantNotFound bool
+		wantQuery    bool
+	}{
+		{name: "nil", err: nil},
+		{name: "record not found", err: gorm.ErrRecordNotFound, wantNotFound: true},
+		{name: "wrapped record not found", err: fmt.Errorf("get site: %w", gorm.ErrRecordNotFound), wantNotFound: true},
+		{name: "other error", err: errors.New("syntax error"), wantQuery: true},
+		{name: "already classified", err: fmt.Errorf("failed to delete files: %w", nested), wantNotFound: true},
+		{name: "missing ids", err: &MissingIDsError{Table: "contractor", IDs: []int64{7}}, wantNotFound: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := wrapError(tt.err)
+			if (err == nil) != (tt.err == nil) {
+				t.Fatalf("Expected nil only for a nil error, got %v", err)
+			}
+			if got := errors.Is(err, ErrNotFound); got != tt.wantNotFound {
+				t.Errorf("Expected errors.Is(err, ErrNotFound) = %v, got %v", tt.wantNotFound, got)
+			}
+			if got := errors.Is(err, ErrQuery); got != tt.wantQuery {
+				t.Errorf("Expected errors.Is(err, ErrQuery) = %v, got %v", tt.wantQuery, got)
+			}
+			if tt.err != nil && err.Error() != tt.err.Error() {
+				t.Errorf("Expected message %q, got %q", tt.err.Error(), err.Error())
+			}
+		})
+	}
+}
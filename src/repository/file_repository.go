@@ -22,7 +22,7 @@ func (r *fileRepository) GetByID(ctx context.Context, id int64) (*entity.File, e
 	var file entity.File
 	err := r.db.WithContext(ctx).Where("id = ?", id).First(&file).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return &file, nil
 }
@@ -31,32 +31,127 @@ func (r *fileRepository) GetAll(ctx context.Context) (entity.Files, error) {
 	var files entity.Files
 	err := r.db.WithContext(ctx).Find(&files).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return files, nil
 }
 
-func (r *fileRepository) GetByDocumentID(ctx context.Context, documentID int64) (entity.Files, error) {
-	var files entity.Files
-	err := r.db.WithContext(ctx).Where("document_id = ?", documentID).Find(&files).Error
+// GetAllPaged returns up to limit file rows with an ID greater than lastID, ordered by ID
+func (r *fileRepository) GetAllPaged(ctx context.Context, limit, lastID int64) (entity.Files, error) {
+	query, err := keysetPage(r.db.WithContext(ctx), entity.File{}, limit, lastID)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
+	}
+
+	var files entity.Files
+	if err := query.Find(&files).Error; err != nil {
+		return nil, wrapError(err)
+	}
+	return files, nil
+}
+
+// GetByDocumentID returns a document's files created strictly after createdAfter and before createdBefore, in
+// Unix seconds; 0 leaves a bound open
+func (r *fileRepository) GetByDocumentID(ctx context.Context, documentID, createdAfter, createdBefore int64) (entity.Files, error) {
+	var files entity.Files
+	query := createdBetween(r.db.WithContext(ctx).Where("document_id = ?", documentID), createdAfter, createdBefore)
+	if err := query.Find(&files).Error; err != nil {
+		return nil, wrapError(err)
 	}
 	return files, nil
 }
 
+// GetByDocumentIDs returns the files of all the given documents in a single query, ordered by ID, restricted to the
+// same creation window as GetByDocumentID
+func (r *fileRepository) GetByDocumentIDs(ctx context.Context, documentIDs []int64, createdAfter, createdBefore int64) (entity.Files, error) {
+	if len(documentIDs) == 0 {
+		return entity.Files{}, nil
+	}
+
+	var files entity.Files
+	query := createdBetween(r.db.WithContext(ctx).Where("document_id IN ?", documentIDs), createdAfter, createdBefore)
+	if err := query.Order("id").Find(&files).Error; err != nil {
+		return nil, wrapError(err)
+	}
+	return files, nil
+}
+
+// createdBetween restricts query to rows whose created_at lies strictly between createdAfter and createdBefore;
+// 0 leaves a bound open
+func createdBetween(query *gorm.DB, createdAfter, createdBefore int64) *gorm.DB {
+	if createdAfter != 0 {
+		query = query.Where("created_at > ?", createdAfter)
+	}
+	if createdBefore != 0 {
+		query = query.Where("created_at < ?", createdBefore)
+	}
+	return query
+}
+
 func (r *fileRepository) GetByStatus(ctx context.Context, status int8) (entity.Files, error) {
 	var files entity.Files
 	err := r.db.WithContext(ctx).Where("status = ?", status).Find(&files).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return files, nil
 }
 
 // HardDeleteBySiteID permanently deletes all files belonging to documents of a site
 func (r *fileRepository) HardDeleteBySiteID(ctx context.Context, siteID int64) error {
-	return r.db.WithContext(ctx).
+	return wrapError(r.db.WithContext(ctx).
 		Exec("DELETE FROM file WHERE document_id IN (SELECT id FROM document WHERE group_id IN (SELECT id FROM document_group WHERE site_id = ?))", siteID).
-		Error
+		Error)
+}
+
+// HardDeleteByGroupIDs permanently deletes all files belonging to documents of the given document groups
+func (r *fileRepository) HardDeleteByGroupIDs(ctx context.Context, groupIDs []int64) error {
+	if len(groupIDs) == 0 {
+		return nil
+	}
+	return wrapError(r.db.WithContext(ctx).
+		Exec("DELETE FROM file WHERE document_id IN (SELECT id FROM document WHERE group_id IN ?)", groupIDs).
+		Error)
+}
+
+// fileTotals is the result row of a file count query
+type fileTotals struct {
+	Count int64
+	Bytes int64
+}
+
+// CountByProjectID returns the number and total size in bytes of the files under a project's sites
+func (r *fileRepository) CountByProjectID(ctx context.Context, projectID int64) (int64, int64, error) {
+	return r.count(r.db.WithContext(ctx).
+		Joins("JOIN site ON site.id = document_group.site_id").
+		Where("site.project_id = ?", projectID))
+}
+
+// CountBySiteID returns the number and total size in bytes of the files under a site
+func (r *fileRepository) CountBySiteID(ctx context.Context, siteID int64) (int64, int64, error) {
+	return r.count(r.db.WithContext(ctx).Where("document_group.site_id = ?", siteID))
+}
+
+// count aggregates the files reachable from the document groups selected by scope
+func (r *fileRepository) count(scope *gorm.DB) (int64, int64, error) {
+	var totals fileTotals
+	err := scope.Table("file").
+		Select("COUNT(file.id) AS count, COALESCE(SUM(file.size), 0) AS bytes").
+		Joins("JOIN document ON document.id = file.document_id").
+		Joins("JOIN document_group ON document_group.id = document.group_id").
+		Scan(&totals).Error
+	if err != nil {
+		return 0, 0, wrapError(err)
+	}
+	return totals.Count, totals.Bytes, nil
+}
+
+// CountByDocumentIDs returns the number of files belonging to the given documents
+func (r *fileRepository) CountByDocumentIDs(ctx context.Context, documentIDs []int64) (int64, error) {
+	if len(documentIDs) == 0 {
+		return 0, nil
+	}
+	var count int64
+	err := r.db.WithContext(ctx).Model(&entity.File{}).Where("document_id IN ?", documentIDs).Count(&count).Error
+	return count, wrapError(err)
 }
@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+)
+
+func TestFileRepository_GetAllPaged(t *testing.T) {
+	db := newTestDB(t, &entity.File{})
+	repo := NewFileRepository(db)
+	ctx := context.Background()
+
+	// Insert out of ID order to make sure pages are ordered by ID, not insertion
+	seed := entity.Files{
+		{Id: 4, DocumentId: 1, Name: "d.ini"},
+		{Id: 1, DocumentId: 1, Name: "a.ini"},
+		{Id: 5, DocumentId: 2, Name: "e.ini"},
+		{Id: 2, DocumentId: 1, Name: "b.ini"},
+		{Id: 3, DocumentId: 2, Name: "c.ini"},
+	}
+	if err := db.Create(&seed).Error; err != nil {
+		t.Fatalf("failed to seed files: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		limit   int64
+		lastID  int64
+		wantIDs []int64
+	}{
+		{name: "first page", limit: 2, lastID: 0, wantIDs: []int64{1, 2}},
+		{name: "middle page", limit: 2, lastID: 2, wantIDs: []int64{3, 4}},
+		{name: "last partial page", limit: 2, lastID: 4, wantIDs: []int64{5}},
+		{name: "past the end", limit: 2, lastID: 5, wantIDs: nil},
+		{name: "limit larger than table", limit: 10, lastID: 0, wantIDs: []int64{1, 2, 3, 4, 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := repo.GetAllPaged(ctx, tt.limit, tt.lastID)
+			if err != nil {
+				t.Fatalf("GetAllPaged() unexpected error: %v", err)
+			}
+			if len(files) != len(tt.wantIDs) {
+				t.Fatalf("Expected %d files, got %d", len(tt.wantIDs), len(files))
+			}
+			for i, file := range files {
+				if file.Id != tt.wantIDs[i] {
+					t.Errorf("Expected file %d at position %d, got %d", tt.wantIDs[i], i, file.Id)
+				}
+			}
+		})
+	}
+}
+
+func TestFileRepository_GetAllPaged_WalksAllRows(t *testing.T) {
+	db := newTestDB(t, &entity.File{})
+	repo := NewFileRepository(db)
+	ctx := context.Background()
+
+	var seed entity.Files
+	for id := int64(1); id <= 7; id++ {
+		seed = append(seed, entity.File{Id: id, DocumentId: 1})
+	}
+	if err := db.Create(&seed).Error; err != nil {
+		t.Fatalf("failed to seed files: %v", err)
+	}
+
+	var seen []int64
+	var lastID int64
+	for {
+		page, err := repo.GetAllPaged(ctx, 3, lastID)
+		if err != nil {
+			t.Fatalf("GetAllPaged() unexpected error: %v", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, file := range page {
+			seen = append(seen, file.Id)
+		}
+		lastID = page[len(page)-1].Id
+	}
+
+	if len(seen) != len(seed) {
+		t.Fatalf("Expected to walk %d files, got %v", len(seed), seen)
+	}
+	for i, id := range seen {
+		if id != int64(i+1) {
+			t.Errorf("Expected file %d at position %d, got %d", i+1, i, id)
+		}
+	}
+}
+
+func TestFileRepository_GetAllPaged_InvalidLimit(t *testing.T) {
+	repo := NewFileRepository(newTestDB(t, &entity.File{}))
+
+	for _, limit := range []int64{0, -1} {
+		if _, err := repo.GetAllPaged(context.Background(), limit, 0); err == nil {
+			t.Errorf("Expected error for limit %d", limit)
+		}
+	}
+}
+
+func TestFileRepository_Count(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	repo := NewFileRepository(db)
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		count     func() (int64, int64, error)
+		wantCount int64
+		wantBytes int64
+	}{
+		{"project with two sites", func() (int64, int64, error) { return repo.CountByProjectID(ctx, testutil.ProjectID) }, 4, 1000},
+		{"project without sites", func() (int64, int64, error) { return repo.CountByProjectID(ctx, testutil.SecondProjectID) }, 0, 0},
+		{"other contractor's project", func() (int64, int64, error) { return repo.CountByProjectID(ctx, testutil.OtherProjectID) }, 1, 500},
+		{"site", func() (int64, int64, error) { return repo.CountBySiteID(ctx, testutil.SiteID) }, 3, 600},
+		{"second site", func() (int64, int64, error) { return repo.CountBySiteID(ctx, testutil.SecondSiteID) }, 1, 400},
+		{"missing site", func() (int64, int64, error) { return repo.CountBySiteID(ctx, 999) }, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, bytes, err := tt.count()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if count != tt.wantCount || bytes != tt.wantBytes {
+				t.Errorf("Expected %d files / %d bytes, got %d / %d", tt.wantCount, tt.wantBytes, count, bytes)
+			}
+		})
+	}
+}
+
+func TestFileRepository_GetByDocumentIDs_CreatedWindow(t *testing.T) {
+	db := newTestDB(t, &entity.File{})
+	repo := NewFileRepository(db)
+	ctx := context.Background()
+
+	// created_at holds Unix seconds
+	seed := entity.Files{
+		{Id: 1, DocumentId: 1, Name: "a.ini", MetaData: entity.MetaData{CreatedAt: 1767225600}},
+		{Id: 2, DocumentId: 1, Name: "b.ini", MetaData: entity.MetaData{CreatedAt: 1767229200}},
+		{Id: 3, DocumentId: 2, Name: "c.ini", MetaData: entity.MetaData{CreatedAt: 1767232800}},
+		{Id: 4, DocumentId: 3, Name: "d.ini", MetaData: entity.MetaData{CreatedAt: 1767229200}},
+	}
+	if err := db.Create(&seed).Error; err != nil {
+		t.Fatalf("failed to seed files: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		createdAfter  int64
+		createdBefore int64
+		wantIDs       []int64
+	}{
+		{name: "no bounds", wantIDs: []int64{1, 2, 3}},
+		{name: "after", createdAfter: 1767225600, wantIDs: []int64{2, 3}},
+		{name: "before", createdBefore: 1767232800, wantIDs: []int64{1, 2}},
+		{name: "bounds are exclusive", createdAfter: 1767225600, createdBefore: 1767232800, wantIDs: []int64{2}},
+		{name: "nothing within", createdAfter: 1767232800, wantIDs: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := repo.GetByDocumentIDs(ctx, []int64{1, 2}, tt.createdAfter, tt.createdBefore)
+			if err != nil {
+				t.Fatalf("GetByDocumentIDs() unexpected error: %v", err)
+			}
+			var ids []int64
+			for _, file := range files {
+				ids = append(ids, file.Id)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("Expected files %v, got %v", tt.wantIDs, ids)
+			}
+
+			single, err := repo.GetByDocumentID(ctx, 1, tt.createdAfter, tt.createdBefore)
+			if err != nil {
+				t.Fatalf("GetByDocumentID() unexpected error: %v", err)
+			}
+			for _, file := range single {
+				if file.DocumentId != 1 || !slices.Contains(tt.wantIDs, file.Id) {
+					t.Errorf("Expected only document 1 files within the window, got file %d", file.Id)
+				}
+			}
+		})
+	}
+}
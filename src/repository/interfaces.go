@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/denys89/wadugs-worker-cleansing/src/entity"
 )
@@ -9,8 +10,16 @@ import (
 // ContractorRepository defines methods for contractor data access
 type ContractorRepository interface {
 	GetByID(ctx context.Context, id int64) (*entity.Contractor, error)
+	// GetByIDs returns the contractors with the given IDs in a single query, ordered by ID, reporting the IDs
+	// without a contractor in a *MissingIDsError
+	GetByIDs(ctx context.Context, ids []int64) (entity.Contractors, error)
 	GetAll(ctx context.Context) (entity.Contractors, error)
+	GetAllPaged(ctx context.Context, limit, lastID int64) (entity.Contractors, error)
 	GetByStatus(ctx context.Context, status int8) (entity.Contractors, error)
+	CountByBucketName(ctx context.Context, bucketName string) (int64, error)
+	GetByBucketName(ctx context.Context, bucketName string) (*entity.Contractor, error)
+	Update(ctx context.Context, contractor *entity.Contractor) error
+	SetStatus(ctx context.Context, id int64, status int8) error
 	Delete(ctx context.Context, id int64) error
 }
 
@@ -28,48 +37,107 @@ type ViewerContractorRepository interface {
 type ProjectRepository interface {
 	GetByID(ctx context.Context, id int64) (*entity.Project, error)
 	GetAll(ctx context.Context) (entity.Projects, error)
-	GetByContractorID(ctx context.Context, contractorID int64) (entity.Projects, error)
+	GetAllPaged(ctx context.Context, limit, lastID int64) (entity.Projects, error)
+	// GetByContractorID returns a contractor's projects, skipping soft-deleted ones unless includeDeleted is set
+	GetByContractorID(ctx context.Context, contractorID int64, includeDeleted bool) (entity.Projects, error)
 	GetByStatus(ctx context.Context, status int8) (entity.Projects, error)
+	Update(ctx context.Context, project *entity.Project) error
 	UpdateProjectUsage(ctx context.Context, projectID int64, sizeDelta int64) error
+	ResetFileSizeUsage(ctx context.Context, projectID int64) error
 	HardDelete(ctx context.Context, id int64) error
 	HardDeleteByContractorID(ctx context.Context, contractorID int64) error
 	CleanupProjectAssociations(ctx context.Context, projectID int64) error
 }
 
+// UploaderContractorUsageRepository defines methods for uploader_contractor_usage data access
+type UploaderContractorUsageRepository interface {
+	ResetByProjectID(ctx context.Context, projectID int64) error
+}
+
 // SiteRepository defines methods for site data access
 type SiteRepository interface {
 	GetByID(ctx context.Context, id int64) (*entity.Site, error)
 	GetAll(ctx context.Context) (entity.Sites, error)
+	GetAllPaged(ctx context.Context, limit, lastID int64) (entity.Sites, error)
 	GetByProjectID(ctx context.Context, projectID int64) (entity.Sites, error)
 	GetByStatus(ctx context.Context, status int8) (entity.Sites, error)
 	HardDelete(ctx context.Context, id int64) error
+	HardDeleteCascade(ctx context.Context, id int64) error
 	HardDeleteByProjectID(ctx context.Context, projectID int64) error
+	// CountByProjectID returns the number of sites of a project
+	CountByProjectID(ctx context.Context, projectID int64) (int64, error)
 }
 
 // DocumentGroupRepository defines methods for document group data access
 type DocumentGroupRepository interface {
 	GetByID(ctx context.Context, id int64) (*entity.DocumentGroup, error)
 	GetAll(ctx context.Context) (entity.DocumentGroups, error)
+	GetAllPaged(ctx context.Context, limit, lastID int64) (entity.DocumentGroups, error)
 	GetBySiteID(ctx context.Context, siteID int64) (entity.DocumentGroups, error)
 	GetByStatus(ctx context.Context, status int8) (entity.DocumentGroups, error)
 	GetByProgress(ctx context.Context, progress int8) (entity.DocumentGroups, error)
 	HardDeleteBySiteID(ctx context.Context, siteID int64) error
+	HardDeleteContents(ctx context.Context, groupID int64) error
+	// CountBySiteID returns the number of document groups of a site
+	CountBySiteID(ctx context.Context, siteID int64) (int64, error)
 }
 
 // DocumentRepository defines methods for document data access
 type DocumentRepository interface {
 	GetByID(ctx context.Context, id int64) (*entity.Document, error)
 	GetAll(ctx context.Context) (entity.Documents, error)
+	GetAllPaged(ctx context.Context, limit, lastID int64) (entity.Documents, error)
 	GetByGroupID(ctx context.Context, groupID int64) (entity.Documents, error)
+	GetByGroupIDs(ctx context.Context, groupIDs []int64) (entity.Documents, error)
 	GetByStatus(ctx context.Context, status int8) (entity.Documents, error)
 	HardDeleteBySiteID(ctx context.Context, siteID int64) error
+	HardDeleteByGroupID(ctx context.Context, groupID int64) error
+	HardDeleteByGroupIDs(ctx context.Context, groupIDs []int64) error
+	// CountByGroupIDs returns the number of documents belonging to the given document groups
+	CountByGroupIDs(ctx context.Context, groupIDs []int64) (int64, error)
 }
 
 // FileRepository defines methods for file data access
 type FileRepository interface {
 	GetByID(ctx context.Context, id int64) (*entity.File, error)
 	GetAll(ctx context.Context) (entity.Files, error)
-	GetByDocumentID(ctx context.Context, documentID int64) (entity.Files, error)
+	GetAllPaged(ctx context.Context, limit, lastID int64) (entity.Files, error)
+	// GetByDocumentID returns a document's files created strictly after createdAfter and before createdBefore, in
+	// Unix seconds like created_at; 0 leaves a bound open
+	GetByDocumentID(ctx context.Context, documentID, createdAfter, createdBefore int64) (entity.Files, error)
+	// GetByDocumentIDs returns the files of all the given documents in a single query, ordered by ID, restricted to
+	// the same creation window as GetByDocumentID
+	GetByDocumentIDs(ctx context.Context, documentIDs []int64, createdAfter, createdBefore int64) (entity.Files, error)
 	GetByStatus(ctx context.Context, status int8) (entity.Files, error)
 	HardDeleteBySiteID(ctx context.Context, siteID int64) error
+	HardDeleteByGroupIDs(ctx context.Context, groupIDs []int64) error
+	// CountByProjectID returns the number and total size in bytes of the files under a project's sites
+	CountByProjectID(ctx context.Context, projectID int64) (int64, int64, error)
+	// CountBySiteID returns the number and total size in bytes of the files under a site
+	CountBySiteID(ctx context.Context, siteID int64) (int64, int64, error)
+	// CountByDocumentIDs returns the number of files belonging to the given documents
+	CountByDocumentIDs(ctx context.Context, documentIDs []int64) (int64, error)
+}
+
+// ContractorLockRepository defines methods for the contractor leases coordinating worker instances
+type ContractorLockRepository interface {
+	// Acquire takes the lease on a contractor for owner, or extends it when owner already holds it, until ttl from
+	// now. It reports false when another owner holds a lease that has not expired.
+	Acquire(ctx context.Context, contractorID int64, owner string, ttl time.Duration) (bool, error)
+	// Release gives up owner's lease on a contractor; a lease taken over by another owner is left alone
+	Release(ctx context.Context, contractorID int64, owner string) error
+}
+
+// BucketCheckpointRepository defines methods for the bucket-emptying progress that survives a worker restart
+type BucketCheckpointRepository interface {
+	// Get returns the checkpoint of a bucket for a correlation ID, or an error matching ErrNotFound
+	Get(ctx context.Context, bucket, correlationID string) (*entity.BucketCheckpoint, error)
+	Save(ctx context.Context, checkpoint *entity.BucketCheckpoint) error
+	Delete(ctx context.Context, bucket, correlationID string) error
+}
+
+// DocumentProcessRepository defines methods for reading documents joined with their group, site, project and contractor
+type DocumentProcessRepository interface {
+	GetBySiteID(ctx context.Context, siteID int64) (entity.DocumentProcesses, error)
+	GetByProjectID(ctx context.Context, projectID int64) (entity.DocumentProcesses, error)
 }
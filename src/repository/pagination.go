@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"fmt"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// orderableEntity is implemented by entities that declare their primary key and sortable columns
+type orderableEntity interface {
+	PrimaryKey() string
+	GetAllowedOrderFields() []string
+}
+
+// keysetPage scopes a query to the page of rows whose primary key is greater than lastID,
+// ordered by the primary key. The key must be one of the entity's allowed order fields.
+func keysetPage(db *gorm.DB, model orderableEntity, limit, lastID int64) (*gorm.DB, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("invalid page limit %d: must be positive", limit)
+	}
+
+	orderField := model.PrimaryKey()
+	if !slices.Contains(model.GetAllowedOrderFields(), orderField) {
+		return nil, fmt.Errorf("order field %q is not allowed", orderField)
+	}
+
+	return db.Where(fmt.Sprintf("%s > ?", orderField), lastID).
+		Order(fmt.Sprintf("%s ASC", orderField)).
+		Limit(int(limit)), nil
+}
@@ -23,7 +23,7 @@ func (r *projectRepository) GetByID(ctx context.Context, id int64) (*entity.Proj
 	var project entity.Project
 	err := r.db.WithContext(ctx).Where("id = ?", id).First(&project).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return &project, nil
 }
@@ -32,21 +32,40 @@ func (r *projectRepository) GetAll(ctx context.Context) (entity.Projects, error)
 	var projects entity.Projects
 	err := r.db.WithContext(ctx).Find(&projects).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return projects, nil
 }
 
-func (r *projectRepository) GetByContractorID(ctx context.Context, contractorID int64) (entity.Projects, error) {
+// GetAllPaged returns up to limit project rows with an ID greater than lastID, ordered by ID
+func (r *projectRepository) GetAllPaged(ctx context.Context, limit, lastID int64) (entity.Projects, error) {
+	query, err := keysetPage(r.db.WithContext(ctx), entity.Project{}, limit, lastID)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	var projects entity.Projects
+	if err := query.Find(&projects).Error; err != nil {
+		return nil, wrapError(err)
+	}
+	return projects, nil
+}
+
+// GetByContractorID returns the projects of a contractor. Soft-deleted projects (is_deleted) are skipped
+// unless includeDeleted is set, as a full contractor purge needs.
+func (r *projectRepository) GetByContractorID(ctx context.Context, contractorID int64, includeDeleted bool) (entity.Projects, error) {
 	var projects entity.Projects
 	// Join with contractor_project table to find projects for this contractor
-	err := r.db.WithContext(ctx).
+	query := r.db.WithContext(ctx).
 		Table("project").
 		Joins("INNER JOIN contractor_project ON contractor_project.project_id = project.id").
-		Where("contractor_project.contractor_id = ?", contractorID).
-		Find(&projects).Error
+		Where("contractor_project.contractor_id = ?", contractorID)
+	if !includeDeleted {
+		query = query.Where("project.is_deleted = ?", false)
+	}
+	err := query.Find(&projects).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return projects, nil
 }
@@ -55,33 +74,44 @@ func (r *projectRepository) GetByStatus(ctx context.Context, status int8) (entit
 	var projects entity.Projects
 	err := r.db.WithContext(ctx).Where("status = ?", status).Find(&projects).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return projects, nil
 }
 
+// Update saves all fields of an existing project
+func (r *projectRepository) Update(ctx context.Context, project *entity.Project) error {
+	return wrapError(r.db.WithContext(ctx).Save(project).Error)
+}
+
+// UpdateProjectUsage adjusts a project's file size usage by sizeDelta, never going below zero
 func (r *projectRepository) UpdateProjectUsage(ctx context.Context, projectID int64, sizeDelta int64) error {
-	// Update project usage - this could be updating a usage field in the project table
-	// For now, we'll implement a basic update that could be extended based on actual requirements
 	err := r.db.WithContext(ctx).Model(&entity.Project{}).
 		Where("id = ?", projectID).
-		Update("updated_at", "NOW()").Error
+		Update("file_size_usage", gorm.Expr("CASE WHEN file_size_usage + ? < 0 THEN 0 ELSE file_size_usage + ? END", sizeDelta, sizeDelta)).Error
 	if err != nil {
-		return err
+		return wrapError(err)
 	}
 	return nil
 }
 
+// ResetFileSizeUsage sets a project's file size usage to zero
+func (r *projectRepository) ResetFileSizeUsage(ctx context.Context, projectID int64) error {
+	return wrapError(r.db.WithContext(ctx).Model(&entity.Project{}).
+		Where("id = ?", projectID).
+		Update("file_size_usage", 0).Error)
+}
+
 // HardDelete permanently deletes a project by ID
 func (r *projectRepository) HardDelete(ctx context.Context, id int64) error {
-	return r.db.WithContext(ctx).Delete(&entity.Project{}, "id = ?", id).Error
+	return wrapError(r.db.WithContext(ctx).Delete(&entity.Project{}, "id = ?", id).Error)
 }
 
 // HardDeleteByContractorID permanently deletes all projects belonging to a contractor
 func (r *projectRepository) HardDeleteByContractorID(ctx context.Context, contractorID int64) error {
-	return r.db.WithContext(ctx).
+	return wrapError(r.db.WithContext(ctx).
 		Exec("DELETE FROM project WHERE id IN (SELECT project_id FROM contractor_project WHERE contractor_id = ?)", contractorID).
-		Error
+		Error)
 }
 
 // CleanupProjectAssociations deletes all FK-blocking association records for a project
@@ -90,22 +120,22 @@ func (r *projectRepository) HardDeleteByContractorID(ctx context.Context, contra
 func (r *projectRepository) CleanupProjectAssociations(ctx context.Context, projectID int64) error {
 	// Delete from client_project
 	if err := r.db.WithContext(ctx).Exec("DELETE FROM client_project WHERE project_id = ?", projectID).Error; err != nil {
-		return fmt.Errorf("failed to delete client_project records: %w", err)
+		return fmt.Errorf("failed to delete client_project records: %w", wrapError(err))
 	}
 
 	// Delete from uploader_project
 	if err := r.db.WithContext(ctx).Exec("DELETE FROM uploader_project WHERE project_id = ?", projectID).Error; err != nil {
-		return fmt.Errorf("failed to delete uploader_project records: %w", err)
+		return fmt.Errorf("failed to delete uploader_project records: %w", wrapError(err))
 	}
 
 	// Delete from vessel_project
 	if err := r.db.WithContext(ctx).Exec("DELETE FROM vessel_project WHERE project_id = ?", projectID).Error; err != nil {
-		return fmt.Errorf("failed to delete vessel_project records: %w", err)
+		return fmt.Errorf("failed to delete vessel_project records: %w", wrapError(err))
 	}
 
 	// Delete from contractor_project
 	if err := r.db.WithContext(ctx).Exec("DELETE FROM contractor_project WHERE project_id = ?", projectID).Error; err != nil {
-		return fmt.Errorf("failed to delete contractor_project records: %w", err)
+		return fmt.Errorf("failed to delete contractor_project records: %w", wrapError(err))
 	}
 
 	return nil
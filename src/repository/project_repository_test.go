@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+)
+
+func TestProjectRepository_UpdateProjectUsage(t *testing.T) {
+	tests := []struct {
+		name      string
+		usage     int64
+		delta     int64
+		wantUsage int64
+	}{
+		{name: "decrement", usage: 1000, delta: -400, wantUsage: 600},
+		{name: "increment", usage: 1000, delta: 250, wantUsage: 1250},
+		{name: "clamped at zero", usage: 100, delta: -400, wantUsage: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, &entity.Project{})
+			repo := NewProjectRepository(db)
+			ctx := context.Background()
+
+			if err := db.Create(&entity.Project{Id: 1, Code: "PRJ", FileSizeUsage: tt.usage}).Error; err != nil {
+				t.Fatalf("failed to seed project: %v", err)
+			}
+
+			if err := repo.UpdateProjectUsage(ctx, 1, tt.delta); err != nil {
+				t.Fatalf("UpdateProjectUsage() unexpected error: %v", err)
+			}
+
+			got, err := repo.GetByID(ctx, 1)
+			if err != nil {
+				t.Fatalf("GetByID() unexpected error: %v", err)
+			}
+			if got.FileSizeUsage != tt.wantUsage {
+				t.Errorf("Expected usage %d, got %d", tt.wantUsage, got.FileSizeUsage)
+			}
+		})
+	}
+}
+
+func TestProjectRepository_ResetFileSizeUsage(t *testing.T) {
+	db := newTestDB(t, &entity.Project{}, &entity.UploaderContractorUsage{})
+	projectRepo := NewProjectRepository(db)
+	usageRepo := NewUploaderContractorUsageRepository(db)
+	ctx := context.Background()
+
+	projects := entity.Projects{
+		{Id: 1, Code: "TARGET", FileSizeUsage: 5000, FileSizeCapacity: 10000},
+		{Id: 2, Code: "OTHER", FileSizeUsage: 3000},
+	}
+	if err := db.Create(&projects).Error; err != nil {
+		t.Fatalf("failed to seed projects: %v", err)
+	}
+	usages := []entity.UploaderContractorUsage{
+		{Id: 1, UploaderId: 10, ProjectId: 1, FileSizeUsage: 2000, FileSizeCapacity: 4000},
+		{Id: 2, UploaderId: 11, ProjectId: 1, FileSizeUsage: 3000},
+		{Id: 3, UploaderId: 10, ProjectId: 2, FileSizeUsage: 3000},
+	}
+	if err := db.Create(&usages).Error; err != nil {
+		t.Fatalf("failed to seed uploader usage: %v", err)
+	}
+
+	if err := projectRepo.ResetFileSizeUsage(ctx, 1); err != nil {
+		t.Fatalf("ResetFileSizeUsage() unexpected error: %v", err)
+	}
+	if err := usageRepo.ResetByProjectID(ctx, 1); err != nil {
+		t.Fatalf("ResetByProjectID() unexpected error: %v", err)
+	}
+
+	target, err := projectRepo.GetByID(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetByID() unexpected error: %v", err)
+	}
+	if target.FileSizeUsage != 0 || target.FileSizeCapacity != 10000 {
+		t.Errorf("Expected usage reset with capacity kept, got usage %d capacity %d", target.FileSizeUsage, target.FileSizeCapacity)
+	}
+	other, err := projectRepo.GetByID(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetByID() unexpected error: %v", err)
+	}
+	if other.FileSizeUsage != 3000 {
+		t.Errorf("Expected other project usage untouched, got %d", other.FileSizeUsage)
+	}
+
+	var gotUsages []entity.UploaderContractorUsage
+	if err := db.Order("id").Find(&gotUsages).Error; err != nil {
+		t.Fatalf("failed to read uploader usage: %v", err)
+	}
+	wantUsage := map[int64]int64{1: 0, 2: 0, 3: 3000}
+	for _, usage := range gotUsages {
+		if usage.FileSizeUsage != wantUsage[usage.Id] {
+			t.Errorf("Expected uploader usage row %d to be %d, got %d", usage.Id, wantUsage[usage.Id], usage.FileSizeUsage)
+		}
+	}
+	if gotUsages[0].FileSizeCapacity != 4000 {
+		t.Errorf("Expected uploader capacity to be kept, got %d", gotUsages[0].FileSizeCapacity)
+	}
+}
+
+func TestProjectRepository_Update(t *testing.T) {
+	db := newTestDB(t, &entity.Project{})
+	repo := NewProjectRepository(db)
+	ctx := context.Background()
+
+	project := &entity.Project{Id: 1, Name: "Old", Code: "PRJ", FileSizeUsage: 500}
+	if err := db.Create(project).Error; err != nil {
+		t.Fatalf("failed to seed project: %v", err)
+	}
+
+	project.Name = "New"
+	project.FileSizeUsage = 0
+	if err := repo.Update(ctx, project); err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+
+	got, err := repo.GetByID(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetByID() unexpected error: %v", err)
+	}
+	if got.Name != "New" || got.FileSizeUsage != 0 {
+		t.Errorf("Update() did not persist fields, got %+v", got)
+	}
+}
+
+func TestProjectRepository_GetByContractorID(t *testing.T) {
+	db := newTestDB(t, &entity.Project{}, &entity.ContractorProject{})
+	repo := NewProjectRepository(db)
+	ctx := context.Background()
+
+	projects := entity.Projects{
+		{Id: 1, Code: "ACTIVE"},
+		{Id: 2, Code: "DELETED", IsDeleted: true},
+		{Id: 3, Code: "OTHER"},
+	}
+	if err := db.Create(&projects).Error; err != nil {
+		t.Fatalf("failed to seed projects: %v", err)
+	}
+	contractorProjects := entity.ContractorProjects{
+		{Id: 1, ContractorId: 1, ProjectId: 1},
+		{Id: 2, ContractorId: 1, ProjectId: 2},
+		{Id: 3, ContractorId: 2, ProjectId: 3},
+	}
+	if err := db.Create(&contractorProjects).Error; err != nil {
+		t.Fatalf("failed to seed contractor projects: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		includeDeleted bool
+		wantIDs        []int64
+	}{
+		{name: "skips soft-deleted projects", includeDeleted: false, wantIDs: []int64{1}},
+		{name: "includes soft-deleted projects", includeDeleted: true, wantIDs: []int64{1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.GetByContractorID(ctx, 1, tt.includeDeleted)
+			if err != nil {
+				t.Fatalf("GetByContractorID() unexpected error: %v", err)
+			}
+			if len(got) != len(tt.wantIDs) {
+				t.Fatalf("Expected %d projects, got %d", len(tt.wantIDs), len(got))
+			}
+			for i, project := range got {
+				if project.Id != tt.wantIDs[i] {
+					t.Errorf("Expected project %d, got %d", tt.wantIDs[i], project.Id)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+	"gorm.io/gorm"
+)
+
+// newTestDB opens an isolated in-memory SQLite database and migrates the given models
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	return testutil.NewDB(t, models...)
+}
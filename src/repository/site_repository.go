@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/denys89/wadugs-worker-cleansing/src/entity"
 	"gorm.io/gorm"
@@ -22,7 +23,7 @@ func (r *siteRepository) GetByID(ctx context.Context, id int64) (*entity.Site, e
 	var site entity.Site
 	err := r.db.WithContext(ctx).Where("id = ?", id).First(&site).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return &site, nil
 }
@@ -31,7 +32,21 @@ func (r *siteRepository) GetAll(ctx context.Context) (entity.Sites, error) {
 	var sites entity.Sites
 	err := r.db.WithContext(ctx).Find(&sites).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
+	}
+	return sites, nil
+}
+
+// GetAllPaged returns up to limit site rows with an ID greater than lastID, ordered by ID
+func (r *siteRepository) GetAllPaged(ctx context.Context, limit, lastID int64) (entity.Sites, error) {
+	query, err := keysetPage(r.db.WithContext(ctx), entity.Site{}, limit, lastID)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	var sites entity.Sites
+	if err := query.Find(&sites).Error; err != nil {
+		return nil, wrapError(err)
 	}
 	return sites, nil
 }
@@ -40,7 +55,7 @@ func (r *siteRepository) GetByProjectID(ctx context.Context, projectID int64) (e
 	var sites entity.Sites
 	err := r.db.WithContext(ctx).Where("project_id = ?", projectID).Find(&sites).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return sites, nil
 }
@@ -49,17 +64,54 @@ func (r *siteRepository) GetByStatus(ctx context.Context, status int8) (entity.S
 	var sites entity.Sites
 	err := r.db.WithContext(ctx).Where("status = ?", status).Find(&sites).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return sites, nil
 }
 
 // HardDelete permanently deletes a site by ID
 func (r *siteRepository) HardDelete(ctx context.Context, id int64) error {
-	return r.db.WithContext(ctx).Delete(&entity.Site{}, "id = ?", id).Error
+	return wrapError(r.db.WithContext(ctx).Delete(&entity.Site{}, "id = ?", id).Error)
+}
+
+// HardDeleteCascade permanently deletes a site together with its document groups, documents and files.
+// Rows are removed children first inside one transaction, so a failure leaves no orphans behind.
+func (r *siteRepository) HardDeleteCascade(ctx context.Context, id int64) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		groups, err := NewDocumentGroupRepository(tx).GetBySiteID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to get document groups: %w", err)
+		}
+		groupIDs := make([]int64, 0, len(groups))
+		for _, group := range groups {
+			groupIDs = append(groupIDs, group.Id)
+		}
+
+		if err := NewFileRepository(tx).HardDeleteByGroupIDs(ctx, groupIDs); err != nil {
+			return fmt.Errorf("failed to delete files: %w", err)
+		}
+		if err := NewDocumentRepository(tx).HardDeleteByGroupIDs(ctx, groupIDs); err != nil {
+			return fmt.Errorf("failed to delete documents: %w", err)
+		}
+		if err := NewDocumentGroupRepository(tx).HardDeleteBySiteID(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete document groups: %w", err)
+		}
+		if err := tx.Delete(&entity.Site{}, "id = ?", id).Error; err != nil {
+			return fmt.Errorf("failed to delete site: %w", err)
+		}
+		return nil
+	})
+	return wrapError(err)
 }
 
 // HardDeleteByProjectID permanently deletes all sites belonging to a project
 func (r *siteRepository) HardDeleteByProjectID(ctx context.Context, projectID int64) error {
-	return r.db.WithContext(ctx).Where("project_id = ?", projectID).Delete(&entity.Site{}).Error
+	return wrapError(r.db.WithContext(ctx).Where("project_id = ?", projectID).Delete(&entity.Site{}).Error)
+}
+
+// CountByProjectID returns the number of sites of a project
+func (r *siteRepository) CountByProjectID(ctx context.Context, projectID int64) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&entity.Site{}).Where("project_id = ?", projectID).Count(&count).Error
+	return count, wrapError(err)
 }
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+	"gorm.io/gorm"
+)
+
+// countRows returns the number of rows of model matching the given condition
+func countRows(t *testing.T, db *gorm.DB, model interface{}, query string, args ...interface{}) int64 {
+	t.Helper()
+
+	var count int64
+	if err := db.Model(model).Where(query, args...).Count(&count).Error; err != nil {
+		t.Fatalf("failed to count %T rows: %v", model, err)
+	}
+	return count
+}
+
+func TestSiteRepository_HardDeleteCascade(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	ctx := context.Background()
+
+	if err := NewSiteRepository(db).HardDeleteCascade(ctx, testutil.SiteID); err != nil {
+		t.Fatalf("HardDeleteCascade() unexpected error: %v", err)
+	}
+
+	// Everything under the deleted site is gone
+	if got := countRows(t, db, &entity.Site{}, "id = ?", testutil.SiteID); got != 0 {
+		t.Errorf("Expected site to be deleted, found %d rows", got)
+	}
+	if got := countRows(t, db, &entity.DocumentGroup{}, "site_id = ?", testutil.SiteID); got != 0 {
+		t.Errorf("Expected site document groups to be deleted, found %d rows", got)
+	}
+
+	// No document or file is left pointing at a missing parent
+	if got := countRows(t, db, &entity.Document{}, "group_id NOT IN (SELECT id FROM document_group)"); got != 0 {
+		t.Errorf("Expected no orphan documents, found %d", got)
+	}
+	if got := countRows(t, db, &entity.File{}, "document_id NOT IN (SELECT id FROM document)"); got != 0 {
+		t.Errorf("Expected no orphan files, found %d", got)
+	}
+
+	// Sibling and unrelated sites keep their trees
+	if got := countRows(t, db, &entity.Site{}, "id IN ?", []int64{testutil.SecondSiteID, testutil.OtherSiteID}); got != 2 {
+		t.Errorf("Expected 2 remaining sites, found %d", got)
+	}
+	if got := countRows(t, db, &entity.File{}, "1 = 1"); got != 2 {
+		t.Errorf("Expected 2 remaining files, found %d", got)
+	}
+}
+
+func TestSiteRepository_HardDeleteCascade_RollsBack(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+
+	// Deleting the groups fails once the documents are gone, so the whole cascade must be undone
+	if err := db.Exec("CREATE TRIGGER fail_group_delete BEFORE DELETE ON document_group BEGIN SELECT RAISE(ABORT, 'blocked'); END").Error; err != nil {
+		t.Fatalf("failed to create trigger: %v", err)
+	}
+
+	if err := NewSiteRepository(db).HardDeleteCascade(context.Background(), testutil.SiteID); err == nil {
+		t.Fatal("Expected HardDeleteCascade() to fail")
+	}
+
+	if got := countRows(t, db, &entity.Document{}, "group_id IN ?", []int64{1000, 1001}); got != 2 {
+		t.Errorf("Expected site documents to be restored, found %d", got)
+	}
+	if got := countRows(t, db, &entity.File{}, "document_id IN ?", []int64{5000, 5001}); got != 3 {
+		t.Errorf("Expected site files to be restored, found %d", got)
+	}
+}
+
+func TestRepositories_CountChildren(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	ctx := context.Background()
+
+	sites := NewSiteRepository(db)
+	groups := NewDocumentGroupRepository(db)
+	documents := NewDocumentRepository(db)
+	files := NewFileRepository(db)
+
+	tests := []struct {
+		name  string
+		count func() (int64, error)
+		want  int64
+	}{
+		{"sites of project", func() (int64, error) { return sites.CountByProjectID(ctx, testutil.ProjectID) }, 2},
+		{"sites of project without sites", func() (int64, error) { return sites.CountByProjectID(ctx, testutil.SecondProjectID) }, 0},
+		{"groups of site", func() (int64, error) { return groups.CountBySiteID(ctx, testutil.SiteID) }, 2},
+		{"groups of missing site", func() (int64, error) { return groups.CountBySiteID(ctx, 999) }, 0},
+		{"documents of groups", func() (int64, error) { return documents.CountByGroupIDs(ctx, []int64{1000, 1001, 1010}) }, 3},
+		{"documents of no groups", func() (int64, error) { return documents.CountByGroupIDs(ctx, nil) }, 0},
+		{"files of documents", func() (int64, error) { return files.CountByDocumentIDs(ctx, []int64{5000, 5001}) }, 3},
+		{"files of no documents", func() (int64, error) { return files.CountByDocumentIDs(ctx, nil) }, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.count()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type (
+	// Repositories bundles one repository of each kind, all bound to the same database handle
+	Repositories struct {
+		Contractors        ContractorRepository
+		UserContractors    UserContractorRepository
+		ViewerContractors  ViewerContractorRepository
+		ContractorProjects ContractorProjectRepository
+		Projects           ProjectRepository
+		Sites              SiteRepository
+		DocumentGroups     DocumentGroupRepository
+		Documents          DocumentRepository
+		Files              FileRepository
+		UploaderUsage      UploaderContractorUsageRepository
+	}
+
+	// TxManager runs work spanning several repositories atomically
+	TxManager interface {
+		// WithinTransaction calls fn with repositories bound to a new transaction. The transaction is committed
+		// when fn returns nil and rolled back when it returns an error, which WithinTransaction then returns, or
+		// panics.
+		WithinTransaction(ctx context.Context, fn func(repos Repositories) error) error
+	}
+
+	txManager struct {
+		db *gorm.DB
+	}
+)
+
+// NewRepositories creates every repository on db
+func NewRepositories(db *gorm.DB) Repositories {
+	return Repositories{
+		Contractors:        NewContractorRepository(db),
+		UserContractors:    NewUserContractorRepository(db),
+		ViewerContractors:  NewViewerContractorRepository(db),
+		ContractorProjects: NewContractorProjectRepository(db),
+		Projects:           NewProjectRepository(db),
+		Sites:              NewSiteRepository(db),
+		DocumentGroups:     NewDocumentGroupRepository(db),
+		Documents:          NewDocumentRepository(db),
+		Files:              NewFileRepository(db),
+		UploaderUsage:      NewUploaderContractorUsageRepository(db),
+	}
+}
+
+// NewTxManager creates a transaction manager over db
+func NewTxManager(db *gorm.DB) TxManager {
+	return &txManager{
+		db: db,
+	}
+}
+
+func (m *txManager) WithinTransaction(ctx context.Context, fn func(repos Repositories) error) error {
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(NewRepositories(tx))
+	})
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+	"gorm.io/gorm"
+)
+
+// deleteContractorTree deletes contractor 1's projects, their associations and the contractor through repos
+func deleteContractorTree(ctx context.Context, repos Repositories) error {
+	for _, projectID := range []int64{testutil.ProjectID, testutil.SecondProjectID} {
+		if err := repos.Sites.HardDeleteByProjectID(ctx, projectID); err != nil {
+			return err
+		}
+	}
+	if err := repos.ContractorProjects.HardDeleteByContractorID(ctx, testutil.ContractorID); err != nil {
+		return err
+	}
+	if err := repos.Contractors.Delete(ctx, testutil.ContractorID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func countTree(t *testing.T, db *gorm.DB) (contractors, links, sites int64) {
+	t.Helper()
+	if err := db.Model(&entity.Contractor{}).Where("id = ?", testutil.ContractorID).Count(&contractors).Error; err != nil {
+		t.Fatalf("failed to count contractors: %v", err)
+	}
+	if err := db.Model(&entity.ContractorProject{}).Where("contractor_id = ?", testutil.ContractorID).Count(&links).Error; err != nil {
+		t.Fatalf("failed to count contractor projects: %v", err)
+	}
+	if err := db.Model(&entity.Site{}).Where("project_id = ?", testutil.ProjectID).Count(&sites).Error; err != nil {
+		t.Fatalf("failed to count sites: %v", err)
+	}
+	return contractors, links, sites
+}
+
+func TestTxManager_WithinTransaction_Commits(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+
+	err := NewTxManager(db).WithinTransaction(context.Background(), func(repos Repositories) error {
+		return deleteContractorTree(context.Background(), repos)
+	})
+	if err != nil {
+		t.Fatalf("WithinTransaction() unexpected error: %v", err)
+	}
+
+	if contractors, links, sites := countTree(t, db); contractors != 0 || links != 0 || sites != 0 {
+		t.Errorf("Expected the contractor tree to be deleted, found %d contractors, %d links and %d sites", contractors, links, sites)
+	}
+}
+
+func TestTxManager_WithinTransaction_RollsBack(t *testing.T) {
+	failure := errors.New("cascade interrupted")
+
+	tests := []struct {
+		name string
+		fn   func(ctx context.Context, repos Repositories) error
+	}{
+		{
+			name: "error after every delete",
+			fn: func(ctx context.Context, repos Repositories) error {
+				if err := deleteContractorTree(ctx, repos); err != nil {
+					return err
+				}
+				return failure
+			},
+		},
+		{
+			name: "error between repositories",
+			fn: func(ctx context.Context, repos Repositories) error {
+				if err := repos.Sites.HardDeleteByProjectID(ctx, testutil.ProjectID); err != nil {
+					return err
+				}
+				if err := repos.ContractorProjects.HardDeleteByContractorID(ctx, testutil.ContractorID); err != nil {
+					return err
+				}
+				return failure
+			},
+		},
+		{
+			name: "panic between repositories",
+			fn: func(ctx context.Context, repos Repositories) error {
+				if err := repos.Sites.HardDeleteByProjectID(ctx, testutil.ProjectID); err != nil {
+					return err
+				}
+				panic(failure)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewMigratedDB(t)
+			testutil.SeedTree(t, db)
+			ctx := context.Background()
+
+			var err error
+			func() {
+				defer func() {
+					if recovered := recover(); recovered != nil {
+						err = recovered.(error)
+					}
+				}()
+				err = NewTxManager(db).WithinTransaction(ctx, func(repos Repositories) error {
+					return tt.fn(ctx, repos)
+				})
+			}()
+			if !errors.Is(err, failure) {
+				t.Fatalf("Expected the callback's failure, got %v", err)
+			}
+
+			if contractors, links, sites := countTree(t, db); contractors != 1 || links != 2 || sites != 2 {
+				t.Errorf("Expected every delete to be rolled back, found %d contractors, %d links and %d sites", contractors, links, sites)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"gorm.io/gorm"
+)
+
+type uploaderContractorUsageRepository struct {
+	db *gorm.DB
+}
+
+// NewUploaderContractorUsageRepository creates a new uploader_contractor_usage repository
+func NewUploaderContractorUsageRepository(db *gorm.DB) UploaderContractorUsageRepository {
+	return &uploaderContractorUsageRepository{
+		db: db,
+	}
+}
+
+// ResetByProjectID sets the file size usage of every uploader usage row of a project to zero
+func (r *uploaderContractorUsageRepository) ResetByProjectID(ctx context.Context, projectID int64) error {
+	return wrapError(r.db.WithContext(ctx).Model(&entity.UploaderContractorUsage{}).
+		Where("project_id = ?", projectID).
+		Update("file_size_usage", 0).Error)
+}
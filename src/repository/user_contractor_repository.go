@@ -20,5 +20,5 @@ func NewUserContractorRepository(db *gorm.DB) UserContractorRepository {
 
 // HardDeleteByContractorID permanently deletes all user_contractor records for a contractor
 func (r *userContractorRepository) HardDeleteByContractorID(ctx context.Context, contractorID int64) error {
-	return r.db.WithContext(ctx).Where("contractor_id = ?", contractorID).Delete(&entity.UserContractor{}).Error
+	return wrapError(r.db.WithContext(ctx).Where("contractor_id = ?", contractorID).Delete(&entity.UserContractor{}).Error)
 }
@@ -20,5 +20,5 @@ func NewViewerContractorRepository(db *gorm.DB) ViewerContractorRepository {
 
 // HardDeleteByContractorID permanently deletes all viewer_contractor records for a contractor
 func (r *viewerContractorRepository) HardDeleteByContractorID(ctx context.Context, contractorID int64) error {
-	return r.db.WithContext(ctx).Where("contractor_id = ?", contractorID).Delete(&entity.ViewerContractor{}).Error
+	return wrapError(r.db.WithContext(ctx).Where("contractor_id = ?", contractorID).Delete(&entity.ViewerContractor{}).Error)
 }
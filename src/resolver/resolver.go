@@ -8,20 +8,31 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
 	workerConfig "github.com/denys89/wadugs-worker-cleansing/src/config"
 	"github.com/denys89/wadugs-worker-cleansing/src/database"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
 	"github.com/denys89/wadugs-worker-cleansing/src/repository"
 	"github.com/denys89/wadugs-worker-cleansing/src/service"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
+// awsAPIOptions are applied to every AWS client the worker creates
+var awsAPIOptions = []func(*middleware.Stack) error{service.AddCorrelationIDMiddleware}
+
 type (
 	// Resolver handles dependency injection and service initialization
 	Resolver struct {
 		config *workerConfig.Config
 		db     *gorm.DB
 	}
+
+	// bucketLister is the part of the S3 client used by the startup connection check
+	bucketLister interface {
+		ListBuckets(ctx context.Context, params *s3.ListBucketsInput, optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error)
+	}
 )
 
 // NewResolver creates a new resolver instance
@@ -57,11 +68,13 @@ func (r *Resolver) ResolveS3Client(ctx context.Context) (*s3.Client, error) {
 				r.config.AWSSecretAccessKey,
 				"", // session token
 			)),
+			config.WithAPIOptions(awsAPIOptions),
 		)
 	} else {
 		log.Info("Using default AWS credential chain")
 		cfg, err = config.LoadDefaultConfig(ctx,
 			config.WithRegion(r.config.AWSRegion),
+			config.WithAPIOptions(awsAPIOptions),
 		)
 	}
 
@@ -72,17 +85,53 @@ func (r *Resolver) ResolveS3Client(ctx context.Context) (*s3.Client, error) {
 	// Create S3 client
 	s3Client := s3.NewFromConfig(cfg)
 
-	// Test the connection by listing buckets (optional health check)
-	_, err = s3Client.ListBuckets(ctx, &s3.ListBucketsInput{})
-	if err != nil {
-		log.WithError(err).Warn("Failed to test S3 connection - continuing anyway")
-	} else {
-		log.Info("S3 client initialized and tested successfully")
-	}
+	r.checkS3Connection(ctx, s3Client)
+	r.checkDeletePermission(ctx, s3Client)
 
 	return s3Client, nil
 }
 
+// checkS3Connection tests the S3 connection by listing buckets, unless SkipS3HealthCheck is set. Least-privilege
+// credentials may lack s3:ListAllMyBuckets, so a failure only warns, and the call is bounded by S3HealthCheckTimeout
+// so an unreachable endpoint cannot hold up startup. It returns the error the check failed with, if any.
+func (r *Resolver) checkS3Connection(ctx context.Context, client bucketLister) error {
+	if r.config.SkipS3HealthCheck {
+		log.Info("S3 connection check skipped")
+		return nil
+	}
+
+	if r.config.S3HealthCheckTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.config.S3HealthCheckTimeout)
+		defer cancel()
+	}
+	if _, err := client.ListBuckets(ctx, &s3.ListBucketsInput{}); err != nil {
+		log.WithError(err).WithField("timeout", r.config.S3HealthCheckTimeout).Warn("Failed to test S3 connection - continuing anyway")
+		return err
+	}
+	log.Info("S3 client initialized and tested successfully")
+	return nil
+}
+
+// checkDeletePermission runs the startup delete permission check when a check bucket is configured.
+// A denial only warns: the worker keeps running so that other buckets can still be cleansed.
+func (r *Resolver) checkDeletePermission(ctx context.Context, client service.S3API) {
+	if r.config.S3DeleteCheckBucket == "" {
+		log.Info("S3 delete permission check skipped, no check bucket configured")
+		return
+	}
+
+	fields := log.Fields{
+		"bucket": r.config.S3DeleteCheckBucket,
+		"prefix": r.config.S3DeleteCheckPrefix,
+	}
+	if err := service.CheckDeletePermission(ctx, client, r.config.S3DeleteCheckBucket, r.config.S3DeleteCheckPrefix); err != nil {
+		log.WithError(err).WithFields(fields).Warn("S3 DELETE PERMISSION CHECK FAILED: objects cannot be deleted with the configured credentials")
+		return
+	}
+	log.WithFields(fields).Info("S3 delete permission verified")
+}
+
 // ResolveFileService creates a file service instance
 func (r *Resolver) ResolveFileService(ctx context.Context) (service.FileService, error) {
 	log.Info("Resolving file service")
@@ -123,8 +172,18 @@ func (r *Resolver) ResolveFileService(ctx context.Context) (service.FileService,
 		return nil, fmt.Errorf("failed to resolve file repository: %w", err)
 	}
 
+	documentProcessRepo, err := r.ResolveDocumentProcessRepository(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve document process repository: %w", err)
+	}
+
+	// Reject malformed key templates at startup instead of building wrong keys later
+	if _, err := service.NewKeyTemplates(r.config); err != nil {
+		return nil, err
+	}
+
 	// Create and return file service with all dependencies
-	fileService := service.NewFileService(contractorRepo, contractorProjectRepo, projectRepo, siteRepo, documentGroupRepo, documentRepo, fileRepo)
+	fileService := service.NewFileService(contractorRepo, contractorProjectRepo, projectRepo, siteRepo, documentGroupRepo, documentRepo, fileRepo, documentProcessRepo, r.config)
 	log.Info("File service resolved successfully")
 
 	return fileService, nil
@@ -150,10 +209,12 @@ func (r *Resolver) ResolveS3Service(ctx context.Context) (service.S3Service, err
 				r.config.AWSSecretAccessKey,
 				"", // session token
 			)),
+			config.WithAPIOptions(awsAPIOptions),
 		)
 	} else {
 		awsConfig, err = config.LoadDefaultConfig(ctx,
 			config.WithRegion(r.config.AWSRegion),
+			config.WithAPIOptions(awsAPIOptions),
 		)
 	}
 	if err != nil {
@@ -166,13 +227,49 @@ func (r *Resolver) ResolveS3Service(ctx context.Context) (service.S3Service, err
 		return nil, fmt.Errorf("failed to resolve file service: %w", err)
 	}
 
+	// Bucket checkpoints outlive a crash in a table this worker owns, so it is created when missing
+	var checkpoints service.CheckpointStore = service.NewMemoryCheckpointStore()
+	db, err := r.ResolveDatabase(ctx)
+	if err != nil {
+		log.WithError(err).Error("Failed to resolve database, keeping bucket checkpoints in memory")
+	} else if err := db.WithContext(ctx).AutoMigrate(&entity.BucketCheckpoint{}); err != nil {
+		log.WithError(err).Error("Failed to create bucket checkpoint table, keeping bucket checkpoints in memory")
+	} else {
+		checkpoints = service.NewDBCheckpointStore(repository.NewBucketCheckpointRepository(db))
+	}
+
 	// Create and return S3 service with multi-region support
-	s3Service := service.NewS3Service(s3Client, awsConfig, r.config.AWSAccessKeyID, r.config.AWSSecretAccessKey, fileService)
+	s3Service := service.NewS3ServiceWithCheckpoints(s3Client, awsConfig, r.config, fileService, checkpoints)
 	log.Info("S3 service resolved successfully with multi-region support")
 
 	return s3Service, nil
 }
 
+// addContractorExtraBucketsColumn adds the aws_extra_buckets column to the contractor table when it is missing,
+// leaving every other column of the shared table alone
+func addContractorExtraBucketsColumn(ctx context.Context, db *gorm.DB) error {
+	migrator := db.WithContext(ctx).Migrator()
+	if migrator.HasColumn(&entity.Contractor{}, "AwsExtraBuckets") {
+		return nil
+	}
+	return migrator.AddColumn(&entity.Contractor{}, "AwsExtraBuckets")
+}
+
+// ResolveReconciler creates a reconciler comparing database and S3 file sets
+func (r *Resolver) ResolveReconciler(ctx context.Context) (*service.Reconciler, error) {
+	fileService, err := r.ResolveFileService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve file service: %w", err)
+	}
+
+	s3Service, err := r.ResolveS3Service(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve S3 service: %w", err)
+	}
+
+	return service.NewReconcilerWithConfig(r.config, fileService, s3Service), nil
+}
+
 // ResolveCleansingService creates a cleansing service instance
 func (r *Resolver) ResolveCleansingService(ctx context.Context) service.CleansingService {
 	log.Info("Resolving cleansing service")
@@ -247,8 +344,38 @@ func (r *Resolver) ResolveCleansingService(ctx context.Context) service.Cleansin
 		return service.NewNullCleansingService()
 	}
 
+	// Create uploader_contractor_usage repository
+	uploaderUsageRepo, err := r.ResolveUploaderContractorUsageRepository(ctx)
+	if err != nil {
+		log.WithError(err).Error("Failed to resolve uploader contractor usage repository, using null cleansing service")
+		return service.NewNullCleansingService()
+	}
+
+	// Multi-repository work runs in transactions on the same database
+	db, err := r.ResolveDatabase(ctx)
+	if err != nil {
+		log.WithError(err).Error("Failed to resolve database, using null cleansing service")
+		return service.NewNullCleansingService()
+	}
+
+	// Extra buckets are read from a column this worker added to the shared contractor table, so it is added when missing
+	if err := addContractorExtraBucketsColumn(ctx, db); err != nil {
+		log.WithError(err).Error("Failed to add contractor aws_extra_buckets column, contractor cleansing fails until it exists")
+	}
+
+	// Contractors are locked across instances through a table this worker owns, so it is created when missing
+	var lockRepo repository.ContractorLockRepository
+	if r.config.ContractorLockTTL > 0 {
+		if err := db.WithContext(ctx).AutoMigrate(&entity.ContractorLock{}); err != nil {
+			log.WithError(err).Error("Failed to create contractor lock table, locking contractors within this instance only")
+		} else {
+			lockRepo = repository.NewContractorLockRepository(db)
+		}
+	}
+
 	// Create and return cleansing service with all dependencies
-	cleansingService := service.NewCleansingService(
+	cleansingService := service.NewCleansingServiceWithConfig(
+		r.config,
 		s3Service,
 		contractorRepo,
 		userContractorRepo,
@@ -259,6 +386,9 @@ func (r *Resolver) ResolveCleansingService(ctx context.Context) service.Cleansin
 		documentGroupRepo,
 		documentRepo,
 		fileRepo,
+		uploaderUsageRepo,
+		repository.NewTxManager(db),
+		lockRepo,
 	)
 	log.Info("Cleansing service resolved successfully")
 
@@ -316,6 +446,38 @@ func (r *Resolver) ValidateConfiguration() error {
 		return fmt.Errorf("NSQ channel is required")
 	}
 
+	if r.config.RequeueBaseDelay > 0 && r.config.RequeueMaxDelay < r.config.RequeueBaseDelay {
+		return fmt.Errorf("requeue max delay (%s) must not be less than the base delay (%s)", r.config.RequeueMaxDelay, r.config.RequeueBaseDelay)
+	}
+
+	if _, err := service.NewKeyTemplates(r.config); err != nil {
+		return err
+	}
+
+	if _, err := service.ParseQuarantineTag(r.config.QuarantineTag); err != nil {
+		return err
+	}
+
+	if _, err := service.ParseManifestFormat(r.config.AuditManifestFormat); err != nil {
+		return err
+	}
+
+	if err := service.ValidateContractorRoleARNPattern(r.config.ContractorRoleARNPattern); err != nil {
+		return err
+	}
+
+	if err := dto.ValidateResultFieldNames(r.config.ResultFieldNames); err != nil {
+		return err
+	}
+
+	strategy, err := service.ParseBucketCleanupStrategy(r.config.BucketCleanupStrategy)
+	if err != nil {
+		return err
+	}
+	if strategy == service.BucketCleanupLifecycle && len(r.config.ProtectedPrefixes) > 0 {
+		log.Warn("Protected prefixes are configured, contractor buckets will be deleted synchronously instead of expired")
+	}
+
 	log.Info("Configuration validation completed successfully")
 	return nil
 }
@@ -395,6 +557,15 @@ func (r *Resolver) ResolveFileRepository(ctx context.Context) (repository.FileRe
 	return repository.NewFileRepository(db), nil
 }
 
+// ResolveDocumentProcessRepository creates and returns a document process repository
+func (r *Resolver) ResolveDocumentProcessRepository(ctx context.Context) (repository.DocumentProcessRepository, error) {
+	db, err := r.ResolveDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repository.NewDocumentProcessRepository(db), nil
+}
+
 // ResolveContractorProjectRepository creates and returns a contractor project repository
 func (r *Resolver) ResolveContractorProjectRepository(ctx context.Context) (repository.ContractorProjectRepository, error) {
 	db, err := r.ResolveDatabase(ctx)
@@ -421,3 +592,12 @@ func (r *Resolver) ResolveViewerContractorRepository(ctx context.Context) (repos
 	}
 	return repository.NewViewerContractorRepository(db), nil
 }
+
+// ResolveUploaderContractorUsageRepository creates and returns an uploader_contractor_usage repository
+func (r *Resolver) ResolveUploaderContractorUsageRepository(ctx context.Context) (repository.UploaderContractorUsageRepository, error) {
+	db, err := r.ResolveDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repository.NewUploaderContractorUsageRepository(db), nil
+}
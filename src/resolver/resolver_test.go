@@ -0,0 +1,120 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	workerConfig "github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+)
+
+// mockBucketLister counts ListBuckets calls, blocking until the context ends when hang is set
+type mockBucketLister struct {
+	calls int
+	hang  bool
+	err   error
+}
+
+func (m *mockBucketLister) ListBuckets(ctx context.Context, params *s3.ListBucketsInput, optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error) {
+	m.calls++
+	if m.hang {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &s3.ListBucketsOutput{}, nil
+}
+
+func TestResolver_CheckS3Connection(t *testing.T) {
+	accessDenied := errors.New("AccessDenied: not authorized to perform s3:ListAllMyBuckets")
+
+	tests := []struct {
+		name      string
+		cfg       workerConfig.Config
+		client    *mockBucketLister
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "checked by default", cfg: workerConfig.Config{S3HealthCheckTimeout: time.Second}, client: &mockBucketLister{}, wantCalls: 1},
+		{name: "opted out", cfg: workerConfig.Config{SkipS3HealthCheck: true}, client: &mockBucketLister{hang: true}, wantCalls: 0},
+		{name: "denied", cfg: workerConfig.Config{S3HealthCheckTimeout: time.Second}, client: &mockBucketLister{err: accessDenied}, wantCalls: 1, wantErr: accessDenied},
+		{name: "timed out", cfg: workerConfig.Config{S3HealthCheckTimeout: 20 * time.Millisecond}, client: &mockBucketLister{hang: true}, wantCalls: 1, wantErr: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := time.Now()
+			err := NewResolver(&tt.cfg).checkS3Connection(context.Background(), tt.client)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.client.calls != tt.wantCalls {
+				t.Errorf("Expected %d ListBuckets calls, got %d", tt.wantCalls, tt.client.calls)
+			}
+			if elapsed := time.Since(started); elapsed > time.Second {
+				t.Errorf("Expected the check not to hold up startup, took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestResolver_ValidateConfigurationRejectsInvalidKeyTemplates(t *testing.T) {
+	tests := []struct {
+		name      string
+		upload    string
+		processed string
+	}{
+		{name: "unparsable upload template", upload: "{{.ProjectCode}/00_Upload/"},
+		{name: "unknown processed field", processed: "{{.ProjectCod}}/01_Processed/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &workerConfig.Config{
+				AWSRegion:            "ap-southeast-1",
+				AWSAccessKeyID:       "key",
+				AWSSecretAccessKey:   "secret",
+				NsqServer:            "127.0.0.1:4150",
+				TopicName:            "data-cleansing",
+				ConsumerChannelName:  "channel",
+				UploadKeyTemplate:    tt.upload,
+				ProcessedKeyTemplate: tt.processed,
+			}
+			if err := NewResolver(cfg).ValidateConfiguration(); err == nil {
+				t.Fatal("Expected an invalid key template to fail validation")
+			}
+		})
+	}
+}
+
+func TestResolver_AddContractorExtraBucketsColumn(t *testing.T) {
+	db := testutil.NewDB(t)
+	if err := db.Exec("CREATE TABLE contractor (id integer PRIMARY KEY, aws_bucket_name text)").Error; err != nil {
+		t.Fatalf("failed to create contractor table: %v", err)
+	}
+	if err := db.Exec("INSERT INTO contractor (id, aws_bucket_name) VALUES (1, 'bucket')").Error; err != nil {
+		t.Fatalf("failed to seed contractor: %v", err)
+	}
+
+	// Running it twice proves an existing column is left alone
+	for i := 0; i < 2; i++ {
+		if err := addContractorExtraBucketsColumn(context.Background(), db); err != nil {
+			t.Fatalf("Expected the column to be added, got %v", err)
+		}
+	}
+
+	var count int64
+	if err := db.Model(&entity.Contractor{}).Where("aws_extra_buckets IS NULL AND aws_bucket_name = ?", "bucket").Count(&count).Error; err != nil {
+		t.Fatalf("Expected the column to be queryable, got %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected the existing contractor to keep its row, got %d", count)
+	}
+}
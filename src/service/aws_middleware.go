@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+)
+
+// CorrelationIDHeader carries the correlation ID of the cleansing that issued an AWS request
+const CorrelationIDHeader = "X-Wadugs-Correlation-Id"
+
+// correlationIDMiddleware stamps the correlation ID from the request context onto the outgoing HTTP request
+var correlationIDMiddleware = middleware.BuildMiddlewareFunc("CorrelationID", func(
+	ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler,
+) (middleware.BuildOutput, middleware.Metadata, error) {
+	if correlationID := workerLog.CorrelationIDFromContext(ctx); correlationID != "" {
+		if req, ok := in.Request.(*smithyhttp.Request); ok {
+			req.Header.Set(CorrelationIDHeader, correlationID)
+		}
+	}
+	return next.HandleBuild(ctx, in)
+})
+
+// AddCorrelationIDMiddleware is an AWS API option (see config.WithAPIOptions) that tags every request
+// with the correlation ID of the cleansing it belongs to, so SDK and access logs can be tied back to it
+func AddCorrelationIDMiddleware(stack *middleware.Stack) error {
+	return stack.Build.Add(correlationIDMiddleware, middleware.After)
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+)
+
+// recordingHTTPClient answers every request with an empty 200 response and keeps the last request
+type recordingHTTPClient struct {
+	request *http.Request
+}
+
+func (c *recordingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.request = req
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func TestAddCorrelationIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		correlationID string
+	}{
+		{name: "stamps correlation id from context", ctx: workerLog.WithLogger(context.Background(), "cleansing-42"), correlationID: "cleansing-42"},
+		{name: "no header without correlation id", ctx: context.Background()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpClient := &recordingHTTPClient{}
+			client := s3.New(s3.Options{
+				Region:      "ap-southeast-1",
+				Credentials: aws.AnonymousCredentials{},
+				HTTPClient:  httpClient,
+				APIOptions:  []func(*middleware.Stack) error{AddCorrelationIDMiddleware},
+			})
+
+			if _, err := client.HeadBucket(tt.ctx, &s3.HeadBucketInput{Bucket: aws.String("contractor-bucket")}); err != nil {
+				t.Fatalf("HeadBucket() unexpected error: %v", err)
+			}
+			if httpClient.request == nil {
+				t.Fatal("Expected a request to be sent")
+			}
+			if got := httpClient.request.Header.Get(CorrelationIDHeader); got != tt.correlationID {
+				t.Errorf("Expected %s header %q, got %q", CorrelationIDHeader, tt.correlationID, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ErrInvalidBucketName is returned for a bucket name that breaks the S3 bucket naming rules.
+// The name comes from the contractor record, so retrying cannot succeed.
+var ErrInvalidBucketName = errors.New("invalid bucket name")
+
+var (
+	// reservedBucketPrefixes and reservedBucketSuffixes are reserved by S3 for its own features
+	reservedBucketPrefixes = []string{"xn--", "sthree-", "amzn-s3-demo-"}
+	reservedBucketSuffixes = []string{"-s3alias", "--ol-s3", ".mrap", "--x-s3", "--table-s3"}
+)
+
+// NormalizeAndValidateBucketName trims surrounding whitespace from name and checks the result against the
+// S3 general purpose bucket naming rules, returning an ErrInvalidBucketName error that says which rule is
+// broken. Uppercase letters are rejected rather than lowercased: a legacy bucket may really use them, and
+// lowercasing could address another tenant's bucket.
+func NormalizeAndValidateBucketName(name string) (string, error) {
+	normalized := strings.TrimSpace(name)
+
+	invalid := func(reason string) (string, error) {
+		return "", fmt.Errorf("%w %q: %s", ErrInvalidBucketName, normalized, reason)
+	}
+
+	if len(normalized) < 3 || len(normalized) > 63 {
+		return invalid("must be between 3 and 63 characters long")
+	}
+	for _, c := range normalized {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '.' && c != '-' {
+			return invalid(fmt.Sprintf("contains %q; only lowercase letters, digits, dots and hyphens are allowed", c))
+		}
+	}
+	if !isBucketNameEdge(normalized[0]) || !isBucketNameEdge(normalized[len(normalized)-1]) {
+		return invalid("must begin and end with a letter or digit")
+	}
+	if strings.Contains(normalized, "..") {
+		return invalid("must not contain adjacent dots")
+	}
+	if _, err := netip.ParseAddr(normalized); err == nil {
+		return invalid("must not be formatted as an IP address")
+	}
+	for _, prefix := range reservedBucketPrefixes {
+		if strings.HasPrefix(normalized, prefix) {
+			return invalid(fmt.Sprintf("must not start with the reserved prefix %q", prefix))
+		}
+	}
+	for _, suffix := range reservedBucketSuffixes {
+		if strings.HasSuffix(normalized, suffix) {
+			return invalid(fmt.Sprintf("must not end with the reserved suffix %q", suffix))
+		}
+	}
+
+	return normalized, nil
+}
+
+// isBucketNameEdge reports whether c may begin or end a bucket name
+func isBucketNameEdge(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+}
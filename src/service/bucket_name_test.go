@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeAndValidateBucketName(t *testing.T) {
+	tests := []struct {
+		name    string
+		bucket  string
+		want    string
+		wantErr bool
+	}{
+		// Valid names
+		{name: "simple", bucket: "contractor-bucket", want: "contractor-bucket"},
+		{name: "dots and digits", bucket: "wadugs.contractor.42", want: "wadugs.contractor.42"},
+		{name: "shortest", bucket: "abc", want: "abc"},
+		{name: "longest", bucket: strings.Repeat("a", 63), want: strings.Repeat("a", 63)},
+
+		// Whitespace-padded names are trimmed
+		{name: "leading and trailing spaces", bucket: "  contractor-bucket  ", want: "contractor-bucket"},
+		{name: "tabs and newlines", bucket: "\tcontractor-bucket\n", want: "contractor-bucket"},
+
+		// Invalid names
+		{name: "empty", bucket: "", wantErr: true},
+		{name: "only whitespace", bucket: "   ", wantErr: true},
+		{name: "too short", bucket: "ab", wantErr: true},
+		{name: "too long", bucket: strings.Repeat("a", 64), wantErr: true},
+		{name: "uppercase", bucket: "Contractor-Bucket", wantErr: true},
+		{name: "underscore", bucket: "contractor_bucket", wantErr: true},
+		{name: "inner space", bucket: "contractor bucket", wantErr: true},
+		{name: "leading hyphen", bucket: "-contractor", wantErr: true},
+		{name: "trailing dot", bucket: "contractor.", wantErr: true},
+		{name: "adjacent dots", bucket: "contractor..bucket", wantErr: true},
+		{name: "ip address", bucket: "192.168.5.4", wantErr: true},
+		{name: "reserved prefix", bucket: "xn--contractor", wantErr: true},
+		{name: "reserved suffix", bucket: "contractor-s3alias", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeAndValidateBucketName(tt.bucket)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidBucketName) {
+					t.Errorf("Expected ErrInvalidBucketName for %q, got %v", tt.bucket, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error for %q: %v", tt.bucket, err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
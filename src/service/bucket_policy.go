@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+)
+
+// ErrBucketNotAllowed is returned for an operation on a bucket the worker is configured not to delete from.
+// The configuration decides it, so retrying cannot succeed.
+var ErrBucketNotAllowed = errors.New("bucket not allowed")
+
+// bucketPolicy limits the buckets deleted from to an allowlist, when it is not empty, minus a denylist
+type bucketPolicy struct {
+	allowed map[string]bool
+	denied  map[string]bool
+}
+
+// newBucketPolicy builds a bucketPolicy from the configured bucket names, ignoring blank entries
+func newBucketPolicy(allowed, denied []string) bucketPolicy {
+	toSet := func(names []string) map[string]bool {
+		set := make(map[string]bool)
+		for _, name := range names {
+			if name = strings.TrimSpace(name); name != "" {
+				set[name] = true
+			}
+		}
+		return set
+	}
+	return bucketPolicy{allowed: toSet(allowed), denied: toSet(denied)}
+}
+
+// check returns an ErrBucketNotAllowed error when bucket is denied, or missing from a non-empty allowlist
+func (p bucketPolicy) check(bucket string) error {
+	if p.denied[bucket] {
+		return fmt.Errorf("%w: bucket %s is denied", ErrBucketNotAllowed, bucket)
+	}
+	if len(p.allowed) > 0 && !p.allowed[bucket] {
+		return fmt.Errorf("%w: bucket %s is not in the allowlist", ErrBucketNotAllowed, bucket)
+	}
+	return nil
+}
+
+// checkObjects checks the bucket of every object, so a delete is refused before any of its buckets is touched
+func (p bucketPolicy) checkObjects(objects []dto.S3Object) error {
+	checked := make(map[string]bool)
+	for _, obj := range objects {
+		if checked[obj.Bucket] {
+			continue
+		}
+		if err := p.check(obj.Bucket); err != nil {
+			return err
+		}
+		checked[obj.Bucket] = true
+	}
+	return nil
+}
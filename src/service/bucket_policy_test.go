@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+)
+
+func TestS3Service_BucketPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowed    []string
+		denied     []string
+		wantRefuse bool
+	}{
+		{name: "no lists allow every bucket"},
+		{name: "allowed bucket", allowed: []string{"other-bucket", " contractor-bucket "}},
+		{name: "denied bucket", denied: []string{"contractor-bucket"}, wantRefuse: true},
+		{name: "denylist wins over allowlist", allowed: []string{"contractor-bucket"}, denied: []string{"contractor-bucket"}, wantRefuse: true},
+		{name: "bucket not in allowlist", allowed: []string{"other-bucket"}, wantRefuse: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{S3AllowedBuckets: tt.allowed, S3DeniedBuckets: tt.denied}
+
+			t.Run("DeleteObjects", func(t *testing.T) {
+				client := &mockS3Client{}
+				service := NewS3Service(client, aws.Config{}, cfg, nil)
+
+				deleted, err := service.DeleteObjects(context.Background(), []dto.S3Object{
+					{Bucket: "contractor-bucket", Key: "P1/S1/00_Upload/a.xtf"},
+					{Bucket: "contractor-bucket", Key: "P1/S1/00_Upload/b.xtf"},
+				})
+				if got := errors.Is(err, ErrBucketNotAllowed); got != tt.wantRefuse {
+					t.Fatalf("Expected ErrBucketNotAllowed %v, got %v", tt.wantRefuse, err)
+				}
+				if tt.wantRefuse && (deleted != 0 || len(client.deletedKeys) != 0) {
+					t.Errorf("Expected nothing deleted, got %d (keys %v)", deleted, client.deletedKeys)
+				}
+				if !tt.wantRefuse && deleted != 2 {
+					t.Errorf("Expected 2 deleted objects, got %d (err %v)", deleted, err)
+				}
+			})
+
+			t.Run("DeleteBucket", func(t *testing.T) {
+				client := &mockS3Client{listKeys: []string{"P1/S1/00_Upload/a.xtf"}, bucketTags: ownerTags("7")}
+				service := NewS3Service(client, aws.Config{}, cfg, nil)
+
+				err := service.DeleteBucket(context.Background(), "contractor-bucket", "", 7)
+				if got := errors.Is(err, ErrBucketNotAllowed); got != tt.wantRefuse {
+					t.Fatalf("Expected ErrBucketNotAllowed %v, got %v", tt.wantRefuse, err)
+				}
+				if tt.wantRefuse && (len(client.deletedKeys) != 0 || len(client.deletedBuckets) != 0) {
+					t.Errorf("Expected nothing deleted, got keys %v and buckets %v", client.deletedKeys, client.deletedBuckets)
+				}
+				if !tt.wantRefuse && len(client.deletedBuckets) != 1 {
+					t.Errorf("Expected bucket to be deleted, got %v (err %v)", client.deletedBuckets, err)
+				}
+			})
+
+			t.Run("ExpireBucket", func(t *testing.T) {
+				client := &mockS3Client{bucketTags: ownerTags("7")}
+				service := NewS3Service(client, aws.Config{}, cfg, nil)
+
+				err := service.ExpireBucket(context.Background(), "contractor-bucket", "", 7)
+				if got := errors.Is(err, ErrBucketNotAllowed); got != tt.wantRefuse {
+					t.Fatalf("Expected ErrBucketNotAllowed %v, got %v", tt.wantRefuse, err)
+				}
+				if tt.wantRefuse && len(client.lifecycleInputs) != 0 {
+					t.Errorf("Expected no lifecycle rule, got %d", len(client.lifecycleInputs))
+				}
+				if !tt.wantRefuse && len(client.lifecycleInputs) != 1 {
+					t.Errorf("Expected a lifecycle rule, got %d (err %v)", len(client.lifecycleInputs), err)
+				}
+			})
+
+			t.Run("QuarantineObjects", func(t *testing.T) {
+				client := &mockS3Client{}
+				service := NewS3Service(client, aws.Config{}, cfg, nil)
+
+				tagged, err := service.QuarantineObjects(context.Background(), []dto.S3Object{
+					{Bucket: "contractor-bucket", Key: "P1/S1/00_Upload/a.xtf"},
+				})
+				if got := errors.Is(err, ErrBucketNotAllowed); got != tt.wantRefuse {
+					t.Fatalf("Expected ErrBucketNotAllowed %v, got %v", tt.wantRefuse, err)
+				}
+				if tt.wantRefuse && (tagged != 0 || len(client.objectTags) != 0) {
+					t.Errorf("Expected nothing tagged, got %d (tags %v)", tagged, client.objectTags)
+				}
+				if !tt.wantRefuse && tagged != 1 {
+					t.Errorf("Expected 1 tagged object, got %d (err %v)", tagged, err)
+				}
+			})
+		})
+	}
+}
+
+func TestS3Service_BucketPolicy_Stream(t *testing.T) {
+	client := &mockS3Client{}
+	service := NewS3Service(client, aws.Config{}, &config.Config{S3DeniedBuckets: []string{"contractor-bucket"}}, nil)
+
+	objects := make(chan dto.S3Object, 2)
+	objects <- dto.S3Object{Bucket: "contractor-bucket", Key: "P1/S1/00_Upload/a.xtf"}
+	objects <- dto.S3Object{Bucket: "contractor-bucket", Key: "P1/S1/00_Upload/b.xtf"}
+	close(objects)
+
+	_, err := service.DeleteObjectsStream(context.Background(), objects)
+	if !errors.Is(err, ErrBucketNotAllowed) {
+		t.Fatalf("Expected ErrBucketNotAllowed, got %v", err)
+	}
+	if len(client.deletedKeys) != 0 {
+		t.Errorf("Expected nothing deleted, got %v", client.deletedKeys)
+	}
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"github.com/denys89/wadugs-worker-cleansing/src/repository"
+	"github.com/denys89/wadugs-worker-cleansing/src/tracing"
+)
+
+// ErrOrphanedRecords is returned when rows are still found under records a cascade deleted. Repeating the
+// message cannot reach them once their parents are gone, so they need to be cleaned up by hand.
+var ErrOrphanedRecords = errors.New("records remain after cascade deletion")
+
+// siteChildren holds the IDs of a site's document groups and documents, read before the cascade deletes them
+// so that verifyCascade can still find what a partial failure left behind
+type siteChildren struct {
+	siteID      int64
+	groupIDs    []int64
+	documentIDs []int64
+}
+
+// collectSiteChildren reads the IDs of the document groups and documents of a site
+func (cs *CleansingServiceImpl) collectSiteChildren(ctx context.Context, siteID int64) (siteChildren, error) {
+	children := siteChildren{siteID: siteID}
+
+	groups, err := retryRead(ctx, cs.readRetry, func() (entity.DocumentGroups, error) {
+		return cs.documentGroupRepo.GetBySiteID(ctx, siteID)
+	})
+	if err != nil {
+		return children, fmt.Errorf("failed to get document groups: %w", err)
+	}
+	for _, group := range groups {
+		children.groupIDs = append(children.groupIDs, group.Id)
+	}
+	if len(children.groupIDs) == 0 {
+		return children, nil
+	}
+
+	documents, err := retryRead(ctx, cs.readRetry, func() (entity.Documents, error) {
+		return cs.documentRepo.GetByGroupIDs(ctx, children.groupIDs)
+	})
+	if err != nil {
+		return children, fmt.Errorf("failed to get documents: %w", err)
+	}
+	for _, document := range documents {
+		children.documentIDs = append(children.documentIDs, document.Id)
+	}
+	return children, nil
+}
+
+// verifyCascade counts the sites of the deleted projects and the document groups, documents and files of the
+// deleted sites, returning an ErrOrphanedRecords error describing whatever is left. A count that cannot be read
+// is logged and does not fail the verification, since every delete it checks already reported success.
+func (cs *CleansingServiceImpl) verifyCascade(ctx context.Context, projectIDs []int64, sites []siteChildren) (err error) {
+	ctx, span := tracing.Start(ctx, "cleansing.verify_cascade")
+	defer func() { tracing.End(span, err) }()
+
+	logger := workerLog.GetLoggerFromContext(ctx)
+
+	var remaining []string
+	check := func(description string, count func() (int64, error)) {
+		n, err := retryRead(ctx, cs.readRetry, count)
+		if err != nil {
+			logger.WithError(err).Warnf("Failed to count remaining %s", description)
+			return
+		}
+		if n > 0 {
+			remaining = append(remaining, fmt.Sprintf("%d %s", n, description))
+		}
+	}
+
+	for _, projectID := range projectIDs {
+		check(fmt.Sprintf("sites of project %d", projectID), func() (int64, error) {
+			return cs.siteRepo.CountByProjectID(ctx, projectID)
+		})
+	}
+	for _, site := range sites {
+		check(fmt.Sprintf("document groups of site %d", site.siteID), func() (int64, error) {
+			return cs.documentGroupRepo.CountBySiteID(ctx, site.siteID)
+		})
+		check(fmt.Sprintf("documents of site %d", site.siteID), func() (int64, error) {
+			return cs.documentRepo.CountByGroupIDs(ctx, site.groupIDs)
+		})
+		check(fmt.Sprintf("files of site %d", site.siteID), func() (int64, error) {
+			return cs.fileRepo.CountByDocumentIDs(ctx, site.documentIDs)
+		})
+	}
+
+	if len(remaining) > 0 {
+		return fmt.Errorf("%w: %s", ErrOrphanedRecords, strings.Join(remaining, ", "))
+	}
+	return nil
+}
+
+// cascadeContractorRecords deletes a contractor's database records bottom-up, once its S3 objects are gone.
+// With message.PreserveEntity the contractor record itself is kept. A failure is also recorded in result.
+func (cs *CleansingServiceImpl) cascadeContractorRecords(ctx context.Context, message dto.CleansingMessage, result *dto.CleansingResult) error {
+	contractorID := message.ID
+	logger := workerLog.GetLoggerFromContext(ctx)
+	logger.WithField("contractor_id", contractorID).Info("Starting database cascade deletion for contractor")
+
+	// Get all projects for this contractor, soft-deleted ones included, to cascade delete their related records
+	projects, err := retryRead(ctx, cs.readRetry, func() (entity.Projects, error) {
+		return cs.projectRepo.GetByContractorID(ctx, contractorID, true)
+	})
+	if err != nil {
+		logger.WithError(err).WithField("contractor_id", contractorID).Error("Failed to get projects for contractor")
+		result.Error = fmt.Sprintf("failed to get projects for contractor: %v", err)
+		return err
+	}
+
+	// For each project, get all sites and cascade delete
+	projectIDs := make([]int64, 0, len(projects))
+	var cascaded []siteChildren
+	for _, project := range projects {
+		projectIDs = append(projectIDs, project.Id)
+		sites, err := retryRead(ctx, cs.readRetry, func() (entity.Sites, error) {
+			return cs.siteRepo.GetByProjectID(ctx, project.Id)
+		})
+		if err != nil {
+			logger.WithError(err).WithField("project_id", project.Id).Warn("Failed to get sites for project during cascade")
+			continue
+		}
+
+		for _, site := range sites {
+			// 1-3. Delete the files, documents and document groups of this site
+			cascaded = append(cascaded, cs.deleteSiteTree(ctx, site.Id))
+		}
+
+		// 4. Delete all sites of this project
+		if err := cs.siteRepo.HardDeleteByProjectID(ctx, project.Id); err != nil {
+			logger.WithError(err).WithField("project_id", project.Id).Warn("Failed to delete site records for project")
+		}
+
+		// 5. Delete FK-blocking association records for this project
+		if err := cs.projectRepo.CleanupProjectAssociations(ctx, project.Id); err != nil {
+			logger.WithError(err).WithField("project_id", project.Id).Warn("Failed to cleanup project associations")
+		}
+	}
+
+	// 6. Delete all projects of this contractor
+	for _, project := range projects {
+		if err := cs.projectRepo.HardDelete(ctx, project.Id); err != nil {
+			logger.WithError(err).WithField("project_id", project.Id).Warn("Failed to delete project record")
+		}
+	}
+
+	// 6-7. The association records and the contractor go in one transaction, so a failure never leaves the
+	// contractor without its users, viewers or project links
+	err = cs.withinTransaction(ctx, func(repos repository.Repositories) error {
+		// 6. Delete FK-blocking association records before deleting the contractor
+		// user_contractor has FK to contractor(id) without ON DELETE CASCADE
+		if err := repos.UserContractors.HardDeleteByContractorID(ctx, contractorID); err != nil {
+			logger.WithError(err).WithField("contractor_id", contractorID).Error("Failed to delete user_contractor records")
+			result.Error = fmt.Sprintf("failed to delete user_contractor records: %v", err)
+			return err
+		}
+
+		// viewer_contractor has FK to contractor(id) without ON DELETE CASCADE
+		if err := repos.ViewerContractors.HardDeleteByContractorID(ctx, contractorID); err != nil {
+			logger.WithError(err).WithField("contractor_id", contractorID).Error("Failed to delete viewer_contractor records")
+			result.Error = fmt.Sprintf("failed to delete viewer_contractor records: %v", err)
+			return err
+		}
+
+		// contractor_project has FK to contractor(id) without ON DELETE CASCADE
+		if err := repos.ContractorProjects.HardDeleteByContractorID(ctx, contractorID); err != nil {
+			logger.WithError(err).WithField("contractor_id", contractorID).Error("Failed to delete contractor_project records")
+			result.Error = fmt.Sprintf("failed to delete contractor_project records: %v", err)
+			return err
+		}
+
+		// 7. Delete the contractor itself (now safe - all FK references removed), unless it is kept for its history
+		if message.PreserveEntity {
+			return nil
+		}
+		if err := repos.Contractors.Delete(ctx, contractorID); err != nil {
+			logger.WithError(err).WithField("contractor_id", contractorID).Error("Failed to delete contractor record")
+			result.Error = fmt.Sprintf("failed to delete contractor record: %v", err)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if message.PreserveEntity {
+		logger.WithField("contractor_id", contractorID).Info("Preserving contractor record")
+		result.EntityPreserved = true
+		result.Message = "Contractor data purged, contractor record preserved"
+	}
+
+	// 8. Make sure a partial failure left nothing behind
+	if err := cs.verifyCascade(ctx, projectIDs, cascaded); err != nil {
+		logger.WithError(err).WithField("contractor_id", contractorID).Error("Cascade deletion left records behind")
+		result.Error = err.Error()
+		return err
+	}
+	return nil
+}
+
+// cascadeProjectRecords deletes a project's database records bottom-up, once its S3 objects are gone.
+// A failure is also recorded in result.
+func (cs *CleansingServiceImpl) cascadeProjectRecords(ctx context.Context, projectID int64, result *dto.CleansingResult) error {
+	logger := workerLog.GetLoggerFromContext(ctx)
+	logger.WithField("project_id", projectID).Info("Starting database cascade deletion for project")
+
+	// Get all sites for this project to cascade delete
+	sites, err := retryRead(ctx, cs.readRetry, func() (entity.Sites, error) {
+		return cs.siteRepo.GetByProjectID(ctx, projectID)
+	})
+	if err != nil {
+		logger.WithError(err).WithField("project_id", projectID).Error("Failed to get sites for project")
+		result.Error = fmt.Sprintf("failed to get sites for project: %v", err)
+		return err
+	}
+
+	var cascaded []siteChildren
+	for _, site := range sites {
+		// 1-3. Delete the files, documents and document groups of this site
+		cascaded = append(cascaded, cs.deleteSiteTree(ctx, site.Id))
+	}
+
+	// 4. Delete all sites of this project
+	if err := cs.siteRepo.HardDeleteByProjectID(ctx, projectID); err != nil {
+		logger.WithError(err).WithField("project_id", projectID).Error("Failed to delete site records for project")
+		result.Error = fmt.Sprintf("failed to delete site records: %v", err)
+		return err
+	}
+
+	// 5. Delete FK-blocking association records before deleting the project
+	// client_project, uploader_project, vessel_project, contractor_project all have FKs to project(id)
+	if err := cs.projectRepo.CleanupProjectAssociations(ctx, projectID); err != nil {
+		logger.WithError(err).WithField("project_id", projectID).Error("Failed to cleanup project associations")
+		result.Error = fmt.Sprintf("failed to cleanup project associations: %v", err)
+		return err
+	}
+
+	// 6. Delete the project itself (now safe - all FK references removed)
+	if err := cs.projectRepo.HardDelete(ctx, projectID); err != nil {
+		logger.WithError(err).WithField("project_id", projectID).Error("Failed to delete project record")
+		result.Error = fmt.Sprintf("failed to delete project record: %v", err)
+		return err
+	}
+
+	// 7. Make sure a partial failure left nothing behind
+	if err := cs.verifyCascade(ctx, []int64{projectID}, cascaded); err != nil {
+		logger.WithError(err).WithField("project_id", projectID).Error("Cascade deletion left records behind")
+		result.Error = err.Error()
+		return err
+	}
+	return nil
+}
+
+// cascadeSiteRecords deletes a site's database records, once its S3 objects are gone. A failure is also
+// recorded in result.
+func (cs *CleansingServiceImpl) cascadeSiteRecords(ctx context.Context, siteID int64, result *dto.CleansingResult) error {
+	logger := workerLog.GetLoggerFromContext(ctx)
+	logger.WithField("site_id", siteID).Info("Starting database cascade deletion for site")
+
+	children, err := cs.collectSiteChildren(ctx, siteID)
+	if err != nil {
+		logger.WithError(err).WithField("site_id", siteID).Warn("Failed to read site records, verifying document groups only")
+	}
+
+	// Files, documents, document groups and the site are removed together in one transaction
+	if err := cs.siteRepo.HardDeleteCascade(ctx, siteID); err != nil {
+		logger.WithError(err).WithField("site_id", siteID).Error("Failed to delete site records")
+		result.Error = fmt.Sprintf("failed to delete site records: %v", err)
+		return err
+	}
+
+	// Make sure a partial failure left nothing behind
+	if err := cs.verifyCascade(ctx, nil, []siteChildren{children}); err != nil {
+		logger.WithError(err).WithField("site_id", siteID).Error("Cascade deletion left records behind")
+		result.Error = err.Error()
+		return err
+	}
+	return nil
+}
+
+// withinTransaction runs fn in a transaction of the transaction manager, or directly on the service's own
+// repositories when it has none
+func (cs *CleansingServiceImpl) withinTransaction(ctx context.Context, fn func(repos repository.Repositories) error) error {
+	if cs.txManager == nil {
+		return fn(repository.Repositories{
+			Contractors:        cs.contractorRepo,
+			UserContractors:    cs.userContractorRepo,
+			ViewerContractors:  cs.viewerContractorRepo,
+			ContractorProjects: cs.contractorProjectRepo,
+			Projects:           cs.projectRepo,
+			Sites:              cs.siteRepo,
+			DocumentGroups:     cs.documentGroupRepo,
+			Documents:          cs.documentRepo,
+			Files:              cs.fileRepo,
+			UploaderUsage:      cs.uploaderUsageRepo,
+		})
+	}
+	return cs.txManager.WithinTransaction(ctx, fn)
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/repository"
+)
+
+type (
+	// BucketCheckpoint records how far emptying a bucket has progressed for one cleansing
+	BucketCheckpoint struct {
+		Bucket        string
+		CorrelationID string
+		StartAfter    string // Last key of the last fully processed listing page
+		Deleted       int    // Objects deleted so far
+		Protected     int    // Protected objects kept so far
+	}
+
+	// CheckpointStore persists bucket-emptying progress so a retried message resumes instead of starting over
+	CheckpointStore interface {
+		// Load returns the checkpoint for bucket and correlationID, or nil if there is none
+		Load(ctx context.Context, bucket, correlationID string) (*BucketCheckpoint, error)
+		Save(ctx context.Context, checkpoint BucketCheckpoint) error
+		Delete(ctx context.Context, bucket, correlationID string) error
+	}
+
+	// MemoryCheckpointStore keeps checkpoints in process memory. It covers retries handled by the same
+	// worker; resuming after a crash needs a persistent CheckpointStore such as DBCheckpointStore.
+	MemoryCheckpointStore struct {
+		mu          sync.Mutex
+		checkpoints map[checkpointKey]BucketCheckpoint
+	}
+
+	checkpointKey struct {
+		bucket        string
+		correlationID string
+	}
+
+	// DBCheckpointStore keeps checkpoints in the bucket_checkpoint table, so a message redelivered after a crash
+	// or restart resumes too, on any worker sharing the database
+	DBCheckpointStore struct {
+		repo repository.BucketCheckpointRepository
+	}
+)
+
+// NewMemoryCheckpointStore creates an empty in-memory checkpoint store
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{checkpoints: make(map[checkpointKey]BucketCheckpoint)}
+}
+
+func (s *MemoryCheckpointStore) Load(ctx context.Context, bucket, correlationID string) (*BucketCheckpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoint, ok := s.checkpoints[checkpointKey{bucket: bucket, correlationID: correlationID}]
+	if !ok {
+		return nil, nil
+	}
+	return &checkpoint, nil
+}
+
+func (s *MemoryCheckpointStore) Save(ctx context.Context, checkpoint BucketCheckpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoints[checkpointKey{bucket: checkpoint.Bucket, correlationID: checkpoint.CorrelationID}] = checkpoint
+	return nil
+}
+
+func (s *MemoryCheckpointStore) Delete(ctx context.Context, bucket, correlationID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.checkpoints, checkpointKey{bucket: bucket, correlationID: correlationID})
+	return nil
+}
+
+// NewDBCheckpointStore creates a checkpoint store backed by repo
+func NewDBCheckpointStore(repo repository.BucketCheckpointRepository) *DBCheckpointStore {
+	return &DBCheckpointStore{repo: repo}
+}
+
+func (s *DBCheckpointStore) Load(ctx context.Context, bucket, correlationID string) (*BucketCheckpoint, error) {
+	checkpoint, err := s.repo.Get(ctx, bucket, correlationID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &BucketCheckpoint{
+		Bucket:        checkpoint.Bucket,
+		CorrelationID: checkpoint.CorrelationId,
+		StartAfter:    checkpoint.StartAfter,
+		Deleted:       checkpoint.Deleted,
+		Protected:     checkpoint.Protected,
+	}, nil
+}
+
+func (s *DBCheckpointStore) Save(ctx context.Context, checkpoint BucketCheckpoint) error {
+	return s.repo.Save(ctx, &entity.BucketCheckpoint{
+		Bucket:        checkpoint.Bucket,
+		CorrelationId: checkpoint.CorrelationID,
+		StartAfter:    checkpoint.StartAfter,
+		Deleted:       checkpoint.Deleted,
+		Protected:     checkpoint.Protected,
+	})
+}
+
+func (s *DBCheckpointStore) Delete(ctx context.Context, bucket, correlationID string) error {
+	return s.repo.Delete(ctx, bucket, correlationID)
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"github.com/denys89/wadugs-worker-cleansing/src/repository"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+)
+
+func TestDBCheckpointStore_ResumesAfterRestart(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	ctx := workerLog.WithLogger(context.Background(), "cleansing-1")
+	client := &mockS3Client{
+		bucketTags: ownerTags("7"),
+		listPages: [][]types.Object{
+			{{Key: aws.String("a")}, {Key: aws.String("b")}},
+			{{Key: aws.String("c")}, {Key: aws.String("d")}},
+		},
+	}
+
+	// The second page fails, leaving a checkpoint after the first
+	failing := true
+	client.deleteObjectsFn = func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+		if failing && aws.ToString(params.Delete.Objects[0].Key) == "c" {
+			return nil, errors.New("connection reset")
+		}
+		deleted := make([]types.DeletedObject, 0, len(params.Delete.Objects))
+		for _, obj := range params.Delete.Objects {
+			deleted = append(deleted, types.DeletedObject{Key: obj.Key})
+		}
+		return &s3.DeleteObjectsOutput{Deleted: deleted}, nil
+	}
+
+	newService := func() S3Service {
+		store := NewDBCheckpointStore(repository.NewBucketCheckpointRepository(db))
+		return NewS3ServiceWithCheckpoints(client, aws.Config{}, &config.Config{}, nil, store)
+	}
+
+	if err := newService().EmptyBucket(ctx, "contractor-bucket", "", 7); err == nil {
+		t.Fatal("Expected the first attempt to fail")
+	}
+
+	// A fresh service, as after a restart, finds the checkpoint in the database
+	failing = false
+	client.deletedKeys = nil
+	if err := newService().EmptyBucket(ctx, "contractor-bucket", "", 7); err != nil {
+		t.Fatalf("Unexpected error on retry: %v", err)
+	}
+	if got := client.startAfters[len(client.startAfters)-1]; got != "b" {
+		t.Errorf("Expected the retry to list after b, got %q", got)
+	}
+	if len(client.deletedKeys) != 2 || client.deletedKeys[0] != "c" || client.deletedKeys[1] != "d" {
+		t.Errorf("Expected only c and d to be deleted on retry, got %v", client.deletedKeys)
+	}
+
+	// A completed run clears its checkpoint
+	checkpoint, err := NewDBCheckpointStore(repository.NewBucketCheckpointRepository(db)).Load(ctx, "contractor-bucket", "cleansing-1")
+	if err != nil || checkpoint != nil {
+		t.Errorf("Expected the checkpoint to be cleared, got %+v (%v)", checkpoint, err)
+	}
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"github.com/denys89/wadugs-worker-cleansing/src/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrS3CircuitOpen is returned without calling S3 while the circuit breaker is open after consecutive S3 failures.
+// The message is requeued, so NSQ backs off instead of every message adding load to an S3 that is already failing.
+var ErrS3CircuitOpen = errors.New("S3 circuit breaker open")
+
+// breakerState is the state of a circuitBreaker; its value is what the state metric reports
+type breakerState int
+
+const (
+	breakerClosed   breakerState = iota // calls go through
+	breakerHalfOpen                     // the cooldown is over and a single probe call goes through
+	breakerOpen                         // calls fail with ErrS3CircuitOpen until the cooldown is over
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerHalfOpen:
+		return "half-open"
+	case breakerOpen:
+		return "open"
+	}
+	return "closed"
+}
+
+// circuitBreaker stops S3 delete and list calls for a cooldown once threshold of them failed in a row with a
+// transient error. After the cooldown one probe call is let through: its success closes the breaker, its failure
+// opens it again. Errors S3 returns for a request it cannot serve, such as AccessDenied, show that S3 is up and
+// count as successes. A nil breaker lets every call through.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int       // Consecutive transient failures while closed
+	openedAt time.Time // When the breaker last opened
+	probing  bool      // Whether the probe call of the half-open breaker is in flight
+}
+
+// newCircuitBreaker creates a circuit breaker, or nil when threshold is not positive, which disables it
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	metrics.S3CircuitBreakerState.Set(float64(breakerClosed))
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow returns ErrS3CircuitOpen when a call must not reach S3, moving an open breaker whose cooldown is over to
+// half-open and letting its probe through
+func (b *circuitBreaker) allow(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		remaining := b.cooldown - b.now().Sub(b.openedAt)
+		if remaining > 0 {
+			return fmt.Errorf("%w: retrying in %s", ErrS3CircuitOpen, remaining.Round(time.Millisecond))
+		}
+		b.setState(ctx, breakerHalfOpen)
+		b.probing = true
+		return nil
+	case breakerHalfOpen:
+		if b.probing {
+			return fmt.Errorf("%w: waiting for the probe call", ErrS3CircuitOpen)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record updates the breaker with the outcome of a call allow let through
+func (b *circuitBreaker) record(ctx context.Context, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	probe := b.state == breakerHalfOpen && b.probing
+	b.probing = false
+
+	// A cancelled call says nothing about S3; another call may probe instead
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	if err == nil || !isRetryableS3Error(err) {
+		b.failures = 0
+		if b.state != breakerClosed {
+			b.setState(ctx, breakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if probe || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.failures = 0
+		b.setState(ctx, breakerOpen)
+	}
+}
+
+// setState moves the breaker to state, reporting the transition; b.mu must be held
+func (b *circuitBreaker) setState(ctx context.Context, state breakerState) {
+	logger := workerLog.GetLoggerFromContext(ctx).WithFields(log.Fields{
+		"from":     b.state.String(),
+		"to":       state.String(),
+		"cooldown": b.cooldown,
+	})
+	b.state = state
+	metrics.S3CircuitBreakerState.Set(float64(state))
+
+	if state == breakerOpen {
+		logger.Warn("S3 circuit breaker opened after consecutive failures, short-circuiting S3 calls")
+		return
+	}
+	logger.Info("S3 circuit breaker state changed")
+}
+
+// callS3 runs an S3 call through breaker, failing with ErrS3CircuitOpen without calling S3 while it is open
+func callS3[T any](ctx context.Context, breaker *circuitBreaker, call func() (T, error)) (T, error) {
+	if err := breaker.allow(ctx); err != nil {
+		var zero T
+		return zero, err
+	}
+	result, err := call()
+	breaker.record(ctx, err)
+	return result, err
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testClock is a settable clock for circuit breaker tests
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func newTestCircuitBreaker(threshold int, cooldown time.Duration) (*circuitBreaker, *testClock) {
+	clock := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	breaker := newCircuitBreaker(threshold, cooldown)
+	breaker.now = clock.Now
+	return breaker, clock
+}
+
+func TestCircuitBreaker_States(t *testing.T) {
+	ctx := context.Background()
+	transient := errors.New("connection reset by peer")
+	breaker, clock := newTestCircuitBreaker(3, 30*time.Second)
+
+	expectState := func(want breakerState) {
+		t.Helper()
+		if breaker.state != want {
+			t.Fatalf("Expected breaker %s, got %s", want, breaker.state)
+		}
+		if got := testutil.ToFloat64(metrics.S3CircuitBreakerState); got != float64(want) {
+			t.Errorf("Expected state metric %v, got %v", float64(want), got)
+		}
+	}
+	call := func(err error) error {
+		_, callErr := callS3(ctx, breaker, func() (struct{}, error) { return struct{}{}, err })
+		return callErr
+	}
+
+	// A success resets the count of consecutive failures
+	call(transient)
+	call(transient)
+	call(nil)
+	call(transient)
+	call(transient)
+	expectState(breakerClosed)
+
+	// The threshold-th consecutive failure opens the breaker
+	call(transient)
+	expectState(breakerOpen)
+	if err := call(nil); !errors.Is(err, ErrS3CircuitOpen) {
+		t.Fatalf("Expected ErrS3CircuitOpen while open, got %v", err)
+	}
+
+	// After the cooldown a single probe goes through, and its failure opens the breaker again
+	clock.now = clock.now.Add(30 * time.Second)
+	if err := breaker.allow(ctx); err != nil {
+		t.Fatalf("Expected the probe to be allowed after the cooldown, got %v", err)
+	}
+	expectState(breakerHalfOpen)
+	if err := breaker.allow(ctx); !errors.Is(err, ErrS3CircuitOpen) {
+		t.Errorf("Expected a second call to wait for the probe, got %v", err)
+	}
+	breaker.record(ctx, transient)
+	expectState(breakerOpen)
+
+	// A cancelled probe leaves the breaker half-open for another probe
+	clock.now = clock.now.Add(30 * time.Second)
+	if err := call(context.Canceled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the cancelled probe to run, got %v", err)
+	}
+	expectState(breakerHalfOpen)
+
+	// A successful probe closes the breaker
+	if err := call(nil); err != nil {
+		t.Fatalf("Expected the probe to succeed, got %v", err)
+	}
+	expectState(breakerClosed)
+}
+
+func TestCircuitBreaker_PermanentErrorsAreNotFailures(t *testing.T) {
+	ctx := context.Background()
+	breaker, _ := newTestCircuitBreaker(2, time.Minute)
+	accessDenied := &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied", Fault: smithy.FaultClient}
+
+	for i := 0; i < 5; i++ {
+		breaker.record(ctx, accessDenied)
+	}
+	if breaker.state != breakerClosed {
+		t.Errorf("Expected S3 refusing requests to keep the breaker closed, got %s", breaker.state)
+	}
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	breaker := newCircuitBreaker(0, time.Minute)
+	if breaker != nil {
+		t.Fatalf("Expected no breaker for a zero threshold, got %+v", breaker)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := callS3(context.Background(), breaker, func() (int, error) { return 0, errors.New("timeout") }); errors.Is(err, ErrS3CircuitOpen) {
+			t.Fatal("Expected a disabled breaker never to open")
+		}
+	}
+}
+
+func TestS3Service_DeleteObjects_CircuitBreaker(t *testing.T) {
+	calls := 0
+	client := &mockS3Client{
+		deleteObjectsFn: func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+			calls++
+			return nil, errors.New("503 service unavailable")
+		},
+	}
+	s3s := NewS3Service(client, aws.Config{}, &config.Config{S3BreakerThreshold: 2, S3BreakerCooldown: time.Minute}, nil)
+	objects := []dto.S3Object{{Bucket: "bucket-a", Key: "P1/S1/a.txt"}}
+
+	for i := 0; i < 2; i++ {
+		if _, err := s3s.DeleteObjects(context.Background(), objects); err == nil || errors.Is(err, ErrS3CircuitOpen) {
+			t.Fatalf("Expected call %d to reach S3 and fail, got %v", i+1, err)
+		}
+	}
+
+	_, err := s3s.DeleteObjects(context.Background(), objects)
+	if !errors.Is(err, ErrS3CircuitOpen) {
+		t.Fatalf("Expected ErrS3CircuitOpen once the threshold is reached, got %v", err)
+	}
+	if errors.Is(classifyS3Error(err), ErrS3Permanent) {
+		t.Error("Expected an open breaker to stay retryable")
+	}
+	if calls != 2 {
+		t.Errorf("Expected S3 to be called twice, got %d calls", calls)
+	}
+}
@@ -2,21 +2,36 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
 
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
 	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
 	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
 	"github.com/denys89/wadugs-worker-cleansing/src/repository"
+	"github.com/denys89/wadugs-worker-cleansing/src/tracing"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
 )
 
+// maxKeyLength is the longest object key S3 accepts, in bytes
+const maxKeyLength = 1024
+
 type (
 	// CleansingService defines the interface for data cleansing operations
 	CleansingService interface {
 		ProcessCleansingMessage(ctx context.Context, message dto.CleansingMessage) (*dto.CleansingResult, error)
+		BuildDeletionContext(ctx context.Context, message dto.CleansingMessage) (*dto.DeletionContext, error)
 		DeleteContractorFiles(ctx context.Context, contractorID int64) (*dto.CleansingResult, error)
 		DeleteProjectFiles(ctx context.Context, projectID int64) (*dto.CleansingResult, error)
 		DeleteSiteFiles(ctx context.Context, siteID int64) (*dto.CleansingResult, error)
+		DeleteObjectsDirect(ctx context.Context, bucket string, keys []string) (*dto.CleansingResult, error)
+		// SweepInactive cleanses the inactive contractors, projects or sites last changed before olderThan
+		SweepInactive(ctx context.Context, cleansingType string, olderThan int64) ([]*dto.CleansingResult, error)
 	}
 
 	// CleansingServiceImpl implements the CleansingService interface
@@ -31,13 +46,45 @@ type (
 		documentGroupRepo     repository.DocumentGroupRepository
 		documentRepo          repository.DocumentRepository
 		fileRepo              repository.FileRepository
+		uploaderUsageRepo     repository.UploaderContractorUsageRepository
+		txManager             repository.TxManager // Runs multi-repository work atomically; nil runs it on the fields above
+		readRetry             readRetryPolicy
+		maxObjects            int           // Object count above which contractor cleansing aborts; 0 means unlimited
+		maxRuntime            time.Duration // Runtime after which a contractor cleansing pauses; 0 means unlimited
+		confirmSecret         string        // Key of the HMAC contractor messages must carry as confirm_token; empty disables the check
+		emptyBucketRecords    bool          // Delete only the records of entities whose contractor has no bucket, rather than failing
+		contractorCredentials bool          // Objects are removed with credentials selected for their contractor
+		contractorLocks       *keyedMutex   // Serializes operations touching the same contractor
+		cascadeConcurrency    int           // Document groups deleted concurrently during a project or contractor cascade
+		quarantine            bool          // Tag files as quarantined instead of deleting them, for every message
+		bucketCleanup         string        // BucketCleanupDelete or BucketCleanupLifecycle
+		manifests             manifestConfig
+		keyTemplates          *KeyTemplates // Render the prefixes every deleted key must fall under
+
+		lockRepo repository.ContractorLockRepository // Extends contractorLocks across instances; nil disables it
+		lockTTL  time.Duration                       // Lease of a contractor lock, renewed while the message is processed
+		lockWait time.Duration                       // Time a message waits for another instance's contractor lock
+		lockPoll time.Duration                       // Interval at which a waiting message checks the contractor lock again
 	}
 
 	// NullCleansingService is a no-op implementation for testing
 	NullCleansingService struct{}
 )
 
-// NewCleansingService creates a new cleansing service instance
+// ErrContractorNotFound is returned when the contractor owning a project is missing. The project's files cannot
+// be located without the contractor's bucket, and retrying cannot help, so the records need fixing by hand.
+var ErrContractorNotFound = errors.New("owning contractor not found")
+
+// ErrObjectLimitExceeded is returned when a cleansing would delete more objects than allowed.
+// Retrying cannot succeed, so the message must be resent with an explicit override instead.
+var ErrObjectLimitExceeded = errors.New("object limit exceeded")
+
+// ErrIncompleteTraversal is returned when some database records could not be read while resolving the files
+// to delete. Cleansing the partial key set would leave files behind once the records are gone, so nothing is
+// deleted and the message is retried.
+var ErrIncompleteTraversal = errors.New("database traversal incomplete")
+
+// NewCleansingService creates a new cleansing service instance with optional behaviour disabled
 func NewCleansingService(
 	s3Service S3Service,
 	contractorRepo repository.ContractorRepository,
@@ -49,7 +96,52 @@ func NewCleansingService(
 	documentGroupRepo repository.DocumentGroupRepository,
 	documentRepo repository.DocumentRepository,
 	fileRepo repository.FileRepository,
+	uploaderUsageRepo repository.UploaderContractorUsageRepository,
 ) CleansingService {
+	return NewCleansingServiceWithConfig(&config.Config{}, s3Service, contractorRepo, userContractorRepo, viewerContractorRepo,
+		contractorProjectRepo, projectRepo, siteRepo, documentGroupRepo, documentRepo, fileRepo, uploaderUsageRepo, nil, nil)
+}
+
+// NewCleansingServiceWithConfig creates a new cleansing service instance configured from cfg. Work spanning
+// several repositories runs in transactions of txManager; without one it runs on the given repositories directly.
+// With lockRepo and cfg.ContractorLockTTL set, contractors are also locked across worker instances.
+func NewCleansingServiceWithConfig(
+	cfg *config.Config,
+	s3Service S3Service,
+	contractorRepo repository.ContractorRepository,
+	userContractorRepo repository.UserContractorRepository,
+	viewerContractorRepo repository.ViewerContractorRepository,
+	contractorProjectRepo repository.ContractorProjectRepository,
+	projectRepo repository.ProjectRepository,
+	siteRepo repository.SiteRepository,
+	documentGroupRepo repository.DocumentGroupRepository,
+	documentRepo repository.DocumentRepository,
+	fileRepo repository.FileRepository,
+	uploaderUsageRepo repository.UploaderContractorUsageRepository,
+	txManager repository.TxManager,
+	lockRepo repository.ContractorLockRepository,
+) CleansingService {
+	// Startup validates the strategy through the resolver; this only guards direct construction
+	bucketCleanup, err := ParseBucketCleanupStrategy(cfg.BucketCleanupStrategy)
+	if err != nil {
+		log.WithError(err).Error("Invalid bucket cleanup strategy, deleting buckets synchronously")
+		bucketCleanup = BucketCleanupDelete
+	}
+	manifestFormat, err := ParseManifestFormat(cfg.AuditManifestFormat)
+	if err != nil {
+		log.WithError(err).Error("Invalid manifest format, using JSON")
+		manifestFormat = ManifestFormatJSON
+	}
+	// Startup rejects invalid templates through the resolver; this only guards direct construction
+	keyTemplates, err := NewKeyTemplates(cfg)
+	if err != nil {
+		log.WithError(err).Error("Invalid S3 key templates, using defaults")
+		keyTemplates, _ = NewKeyTemplates(&config.Config{})
+	}
+	if cfg.ContractorLockTTL <= 0 {
+		lockRepo = nil
+	}
+
 	return &CleansingServiceImpl{
 		s3Service:             s3Service,
 		contractorRepo:        contractorRepo,
@@ -61,6 +153,24 @@ func NewCleansingService(
 		documentGroupRepo:     documentGroupRepo,
 		documentRepo:          documentRepo,
 		fileRepo:              fileRepo,
+		uploaderUsageRepo:     uploaderUsageRepo,
+		txManager:             txManager,
+		readRetry:             newReadRetryPolicy(cfg),
+		maxObjects:            cfg.MaxObjectsPerOperation,
+		maxRuntime:            cfg.MaxOperationRuntime,
+		confirmSecret:         cfg.ContractorConfirmSecret,
+		emptyBucketRecords:    cfg.EmptyBucketRecordsOnly,
+		contractorCredentials: cfg.UseContractorCredentials || cfg.ContractorRoleARNPattern != "",
+		contractorLocks:       newKeyedMutex(),
+		lockRepo:              lockRepo,
+		lockTTL:               cfg.ContractorLockTTL,
+		lockWait:              cfg.ContractorLockWait,
+		lockPoll:              contractorLockPoll,
+		cascadeConcurrency:    max(cfg.CascadeDeleteConcurrency, 1),
+		quarantine:            cfg.QuarantineMode,
+		bucketCleanup:         bucketCleanup,
+		manifests:             manifestConfig{bucket: cfg.AuditBucket, prefix: cfg.AuditPrefix, format: manifestFormat},
+		keyTemplates:          keyTemplates,
 	}
 }
 
@@ -70,7 +180,10 @@ func NewNullCleansingService() CleansingService {
 }
 
 // ProcessCleansingMessage processes a cleansing message and routes to appropriate deletion method
-func (cs *CleansingServiceImpl) ProcessCleansingMessage(ctx context.Context, message dto.CleansingMessage) (*dto.CleansingResult, error) {
+func (cs *CleansingServiceImpl) ProcessCleansingMessage(ctx context.Context, message dto.CleansingMessage) (result *dto.CleansingResult, err error) {
+	ctx, span := tracing.Start(ctx, "cleansing.process", attribute.String("cleansing.type", message.Type), attribute.Int64("cleansing.id", message.ID))
+	defer func() { tracing.End(span, err) }()
+
 	logger := workerLog.GetLoggerFromContext(ctx)
 	logger.WithFields(log.Fields{
 		"type": message.Type,
@@ -85,14 +198,122 @@ func (cs *CleansingServiceImpl) ProcessCleansingMessage(ctx context.Context, mes
 			Error:   fmt.Sprintf("invalid cleansing type: %s", message.Type),
 		}, fmt.Errorf("invalid cleansing type: %s", message.Type)
 	}
+	if !message.IsValidScope() {
+		return &dto.CleansingResult{
+			Type:    message.Type,
+			ID:      message.ID,
+			Success: false,
+			Error:   fmt.Sprintf("invalid cleansing scope: %s", message.Scope),
+		}, fmt.Errorf("invalid cleansing scope: %s", message.Scope)
+	}
+	if !message.IsValidSkipS3() {
+		return &dto.CleansingResult{
+			Type:    message.Type,
+			ID:      message.ID,
+			Success: false,
+			Error:   "skip_s3 only applies to a full contractor, project or site cleansing",
+		}, errors.New("skip_s3 only applies to a full contractor, project or site cleansing")
+	}
+	if !message.IsValidCreatedWindow() {
+		return &dto.CleansingResult{
+			Type:    message.Type,
+			ID:      message.ID,
+			Success: false,
+			Error:   "created_after must be earlier than created_before, on a contractor, project or site cleansing",
+		}, errors.New("created_after must be earlier than created_before, on a contractor, project or site cleansing")
+	}
+	if err := cs.checkConfirmation(message); err != nil {
+		logger.WithError(err).WithField("contractor_id", message.ID).Error("Refusing to cleanse contractor")
+		return &dto.CleansingResult{
+			Type:    message.Type,
+			ID:      message.ID,
+			Success: false,
+			Error:   err.Error(),
+		}, err
+	}
+
+	// Operations on the same contractor run one at a time so they cannot interleave S3 and database changes
+	contractorID, ownerErr := cs.owningContractorID(ctx, message)
+	if ownerErr != nil {
+		logger.WithError(ownerErr).WithFields(log.Fields{
+			"type": message.Type,
+			"id":   message.ID,
+		}).Warn("Failed to resolve owning contractor, processing without contractor lock")
+	} else {
+		unlock := cs.contractorLocks.Lock(contractorID)
+		defer unlock()
+
+		// Other worker instances may be processing a message for the same contractor
+		lockedCtx, release, lockErr := cs.lockContractorCluster(ctx, contractorID)
+		if lockErr != nil {
+			logger.WithError(lockErr).WithField("contractor_id", contractorID).Warn("Failed to lock contractor")
+			return &dto.CleansingResult{
+				Type:    message.Type,
+				ID:      message.ID,
+				Success: false,
+				Error:   lockErr.Error(),
+			}, lockErr
+		}
+		defer release()
+		ctx = lockedCtx
+
+		// Once the lease is lost the message stops with whatever context error it hit; report why instead
+		defer func() {
+			if cause := context.Cause(lockedCtx); err != nil && errors.Is(cause, ErrContractorLockLost) && !errors.Is(err, ErrContractorLockLost) {
+				err = fmt.Errorf("%w: %w", cause, err)
+				if result != nil {
+					result.Success = false
+					result.Error = err.Error()
+				}
+			}
+		}()
+
+		// Every S3 request made for the contractor uses its credentials, from the bucket checks to the deletes
+		if ctx, err = cs.contractorContext(ctx, contractorID); err != nil {
+			logger.WithError(err).WithField("contractor_id", contractorID).Error("Failed to resolve contractor credentials")
+			return &dto.CleansingResult{
+				Type:    message.Type,
+				ID:      message.ID,
+				Success: false,
+				Error:   err.Error(),
+			}, err
+		}
+	}
+
+	// The follow-up of a lifecycle bucket cleanup only has a bucket left to delete
+	if message.Type == dto.CleansingTypeExpiredBucket {
+		return cs.deleteExpiredBucket(ctx, message)
+	}
+
+	// Without a bucket there are no files to address, so either only the records go or the message fails for good
+	if ownerErr == nil && !message.SkipS3 {
+		if err := cs.checkContractorBucket(ctx, contractorID); err != nil {
+			return cs.handleNoBucket(ctx, message, err)
+		}
+	}
+
+	// S3 was already purged out of band, so only the database records are left to delete
+	if message.SkipS3 {
+		return cs.deleteRecordsOnly(ctx, message)
+	}
+
+	// A manifest names its keys itself, so neither the database tree nor a selection applies
+	if message.Type == dto.CleansingTypeManifest {
+		return cs.deleteManifestKeys(ctx, message)
+	}
+
+	// A category or a raw/processed scope restricts the cleanse to matching files and leaves the entity itself in place
+	if message.IsPartial() {
+		return cs.deleteSelectedFiles(ctx, message)
+	}
 
 	switch message.Type {
 	case dto.CleansingTypeContractor:
-		return cs.DeleteContractorFiles(ctx, message.ID)
+		return cs.deleteContractorFiles(ctx, message)
 	case dto.CleansingTypeProject:
-		return cs.DeleteProjectFiles(ctx, message.ID)
+		return cs.deleteProjectFiles(ctx, message)
 	case dto.CleansingTypeSite:
-		return cs.DeleteSiteFiles(ctx, message.ID)
+		return cs.deleteSiteFiles(ctx, message)
 	default:
 		return &dto.CleansingResult{
 			Type:    message.Type,
@@ -103,123 +324,321 @@ func (cs *CleansingServiceImpl) ProcessCleansingMessage(ctx context.Context, mes
 	}
 }
 
+// BuildDeletionContext resolves the S3 objects a cleansing message would delete, without deleting anything.
+// This lets operators inspect or persist the plan before it is executed.
+func (cs *CleansingServiceImpl) BuildDeletionContext(ctx context.Context, message dto.CleansingMessage) (deletionContext *dto.DeletionContext, err error) {
+	ctx, span := tracing.Start(ctx, "cleansing.build_deletion_context")
+	defer func() { tracing.End(span, err) }()
+
+	logger := workerLog.GetLoggerFromContext(ctx)
+
+	var skipped atomic.Int64
+	opts := []FileOption{
+		WithCategory(message.Category),
+		WithScope(message.Scope),
+		WithCreatedWindow(message.CreatedAfter, message.CreatedBefore),
+		WithFailFast(),
+		WithSkipCounter(&skipped),
+	}
+	// A full cleanse removes the records of inactive document groups too, so their files must go with them;
+	// a contractor purge removes every record, so the files of soft-deleted projects go as well
+	if !message.IsPartial() {
+		opts = append(opts, WithIncludeInactive())
+	}
+	if message.Type == dto.CleansingTypeContractor {
+		opts = append(opts, WithIncludeDeleted())
+	}
+
+	var s3Objects []dto.S3Object
+	switch message.Type {
+	case dto.CleansingTypeContractor:
+		s3Objects, err = cs.s3Service.ListContractorFiles(ctx, message.ID, opts...)
+	case dto.CleansingTypeProject:
+		s3Objects, err = cs.s3Service.ListProjectFiles(ctx, message.ID, opts...)
+	case dto.CleansingTypeSite:
+		s3Objects, err = cs.s3Service.ListSiteFiles(ctx, message.ID, opts...)
+	default:
+		return nil, fmt.Errorf("invalid cleansing type: %s", message.Type)
+	}
+	// The traversal stops at the first record it cannot read, as the cleanse would refuse the incomplete key set
+	if count := skipped.Load(); count > 0 {
+		err := fmt.Errorf("%w: %d records of %s %d could not be read: %v", ErrIncompleteTraversal, count, message.Type, message.ID, err)
+		logger.WithError(err).WithFields(log.Fields{
+			"type":          message.Type,
+			"id":            message.ID,
+			"skipped_count": count,
+			"file_count":    len(s3Objects),
+		}).Error("Refusing to cleanse with an incomplete file list")
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s files: %w", message.Type, err)
+	}
+
+	logger.WithFields(log.Fields{
+		"type":       message.Type,
+		"id":         message.ID,
+		"category":   message.Category,
+		"scope":      message.Scope,
+		"file_count": len(s3Objects),
+	}).Info("Built deletion context")
+
+	return &dto.DeletionContext{
+		Type:        message.Type,
+		ID:          message.ID,
+		S3Objects:   s3Objects,
+		Description: message.GetDescription(),
+	}, nil
+}
+
 // DeleteContractorFiles deletes all files related to a contractor (including all projects and sites)
 func (cs *CleansingServiceImpl) DeleteContractorFiles(ctx context.Context, contractorID int64) (*dto.CleansingResult, error) {
+	message := dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: contractorID}
+	ctx, err := cs.messageContractorContext(ctx, message)
+	if err != nil {
+		return &dto.CleansingResult{
+			Type:    message.Type,
+			ID:      message.ID,
+			Success: false,
+			Error:   err.Error(),
+		}, err
+	}
+	return cs.deleteContractorFiles(ctx, message)
+}
+
+// deleteContractorFiles deletes a contractor's files and records, enforcing the object limit unless the message
+// overrides it. With message.PreserveEntity the contractor record and its bucket are kept and only their contents purged.
+func (cs *CleansingServiceImpl) deleteContractorFiles(ctx context.Context, message dto.CleansingMessage) (*dto.CleansingResult, error) {
+	contractorID := message.ID
 	logger := workerLog.GetLoggerFromContext(ctx)
 	logger.WithField("contractor_id", contractorID).Info("Starting contractor file deletion")
 
 	result := &dto.CleansingResult{
-		Type:    dto.CleansingTypeContractor,
-		ID:      contractorID,
-		Success: false,
+		Type:        dto.CleansingTypeContractor,
+		ID:          contractorID,
+		Success:     false,
+		Quarantined: cs.quarantines(message),
 	}
-	// Get all S3 objects for the contractor
-	s3Objects, err := cs.s3Service.ListContractorFiles(ctx, contractorID)
+
+	// Past maxRuntime emptying the bucket pauses, and a continuation message carries on from where it stopped
+	if cs.maxRuntime > 0 {
+		ctx = withRuntimeDeadline(ctx, time.Now().Add(cs.maxRuntime))
+	}
+	if message.ResumeAfter != "" {
+		ctx = withResumeAfter(ctx, message.ResumeAfter)
+	}
+	// Emptying a dedicated bucket is held to the object limit too, unless the message overrides it
+	if message.OverrideObjectLimit {
+		ctx = withLargeDeleteAllowed(ctx)
+	}
+
+	// Resolve all S3 objects for the contractor
+	deletionContext, err := cs.BuildDeletionContext(ctx, dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: contractorID})
 	if err != nil {
-		result.Error = fmt.Sprintf("failed to list contractor files: %v", err)
+		result.Error = err.Error()
 		return result, err
 	}
 
-	logger.WithFields(log.Fields{
-		"contractor_id": contractorID,
-		"file_count":    len(s3Objects),
-	}).Info("Found files to delete for contractor")
+	// Abort before touching anything when a (possibly misrouted) id resolves to too many objects
+	if objectCount := len(deletionContext.S3Objects); cs.maxObjects > 0 && objectCount > cs.maxObjects {
+		if !message.OverrideObjectLimit {
+			err := fmt.Errorf("%w: contractor %d has %d objects, limit is %d", ErrObjectLimitExceeded, contractorID, objectCount, cs.maxObjects)
+			logger.WithError(err).WithField("contractor_id", contractorID).Error("Refusing to cleanse contractor")
+			result.Error = err.Error()
+			return result, err
+		}
+		logger.WithFields(log.Fields{
+			"contractor_id": contractorID,
+			"object_count":  objectCount,
+			"limit":         cs.maxObjects,
+		}).Warn("Object limit overridden by message")
+	}
 
-	// Delete all S3 objects
-	deletedCount, err := cs.s3Service.DeleteObjects(ctx, s3Objects)
+	contractor, err := retryRead(ctx, cs.readRetry, func() (*entity.Contractor, error) {
+		return cs.contractorRepo.GetByID(ctx, contractorID)
+	})
 	if err != nil {
-		result.Error = fmt.Sprintf("failed to delete contractor files: %v", err)
-		result.FilesDeleted = deletedCount
+		result.Error = fmt.Sprintf("failed to get contractor: %v", err)
 		return result, err
 	}
 
-	// =====================================================
-	// Database cascade deletion (bottom-up order)
-	// =====================================================
-	logger.WithField("contractor_id", contractorID).Info("Starting database cascade deletion for contractor")
-
-	// Get all projects for this contractor to cascade delete their related records
-	projects, err := cs.projectRepo.GetByContractorID(ctx, contractorID)
+	// A malformed bucket name would only surface as a confusing S3 error, so it is rejected before any AWS call
+	extraBuckets, err := normalizeContractorBuckets(contractor)
 	if err != nil {
-		logger.WithError(err).WithField("contractor_id", contractorID).Error("Failed to get projects for contractor")
-		result.Error = fmt.Sprintf("failed to get projects for contractor: %v", err)
-		result.FilesDeleted = deletedCount
+		logger.WithError(err).WithField("contractor_id", contractorID).Error("Refusing to cleanse contractor")
+		result.Error = err.Error()
 		return result, err
 	}
 
-	// For each project, get all sites and cascade delete
-	for _, project := range projects {
-		sites, err := cs.siteRepo.GetByProjectID(ctx, project.Id)
-		if err != nil {
-			logger.WithError(err).WithField("project_id", project.Id).Warn("Failed to get sites for project during cascade")
-			continue
-		}
-
-		for _, site := range sites {
-			// 1. Delete all files belonging to documents of this site
-			if err := cs.fileRepo.HardDeleteBySiteID(ctx, site.Id); err != nil {
-				logger.WithError(err).WithField("site_id", site.Id).Warn("Failed to delete file records for site")
-			}
+	// Mark the contractor inactive so concurrent uploads stop while we cleanse
+	if err := cs.contractorRepo.SetStatus(ctx, contractorID, entity.ContractorStatusInactive); err != nil {
+		logger.WithError(err).WithField("contractor_id", contractorID).Warn("Failed to mark contractor inactive before cleansing")
+	}
 
-			// 2. Delete all documents belonging to document groups of this site
-			if err := cs.documentRepo.HardDeleteBySiteID(ctx, site.Id); err != nil {
-				logger.WithError(err).WithField("site_id", site.Id).Warn("Failed to delete document records for site")
-			}
+	// A redelivered message may find the bucket already removed; its objects are then gone too
+	bucketExists, err := cs.contractorBucketExists(ctx, contractorID, contractor.AwsBucketName, contractor.AwsBucketRegion)
+	if err != nil {
+		result.Error = err.Error()
+		return result, err
+	}
+	if !bucketExists {
+		deletionContext.S3Objects = nil
+	}
 
-			// 3. Delete all document groups of this site
-			if err := cs.documentGroupRepo.HardDeleteBySiteID(ctx, site.Id); err != nil {
-				logger.WithError(err).WithField("site_id", site.Id).Warn("Failed to delete document group records for site")
-			}
+	// Only a bucket no other contractor uses may be removed (or, when preserving the contractor, emptied) as a whole
+	dedicated := false
+	if bucketExists && contractor.AwsBucketName != "" {
+		dedicated, err = cs.hasDedicatedBucket(ctx, contractorID, contractor.AwsBucketName)
+		if err != nil {
+			result.Error = err.Error()
+			return result, err
 		}
+	}
 
-		// 4. Delete all sites of this project
-		if err := cs.siteRepo.HardDeleteByProjectID(ctx, project.Id); err != nil {
-			logger.WithError(err).WithField("project_id", project.Id).Warn("Failed to delete site records for project")
+	// With the lifecycle strategy S3 empties a dedicated bucket itself, so its objects are not deleted one by one
+	expiring := false
+	if cs.expiresBucket(message) && dedicated {
+		err := cs.s3Service.ExpireBucket(ctx, contractor.AwsBucketName, contractor.AwsBucketRegion, contractorID)
+		if errors.Is(err, ErrBucketNotOwned) {
+			logger.WithError(err).WithField("contractor_id", contractorID).Error("Refusing to expire contractor bucket")
+			result.Error = err.Error()
+			return result, err
 		}
-
-		// 5. Delete FK-blocking association records for this project
-		if err := cs.projectRepo.CleanupProjectAssociations(ctx, project.Id); err != nil {
-			logger.WithError(err).WithField("project_id", project.Id).Warn("Failed to cleanup project associations")
+		if err != nil {
+			logger.WithError(err).WithFields(log.Fields{
+				"contractor_id": contractorID,
+				"bucket":        contractor.AwsBucketName,
+			}).Warn("Failed to apply bucket expiration, deleting the bucket synchronously")
+		} else {
+			expiring = true
+			deletionContext.S3Objects = nil
 		}
 	}
 
-	// 6. Delete all projects of this contractor
-	for _, project := range projects {
-		if err := cs.projectRepo.HardDelete(ctx, project.Id); err != nil {
-			logger.WithError(err).WithField("project_id", project.Id).Warn("Failed to delete project record")
+	// A bucket that is refused only after its keys were deleted would leave the contractor's records behind
+	// without their objects, so every bucket to be removed is checked first. ExpireBucket checked the main one.
+	if !cs.quarantines(message) {
+		mainBucket := ""
+		if dedicated && !expiring {
+			mainBucket = contractor.AwsBucketName
+		}
+		if err := cs.verifyBucketOwnership(ctx, contractorID, mainBucket, extraBuckets, contractor.AwsBucketRegion, result); err != nil {
+			result.Error = err.Error()
+			return result, err
 		}
 	}
 
-	// 6. Delete FK-blocking association records before deleting the contractor
-	// user_contractor has FK to contractor(id) without ON DELETE CASCADE
-	if err := cs.userContractorRepo.HardDeleteByContractorID(ctx, contractorID); err != nil {
-		logger.WithError(err).WithField("contractor_id", contractorID).Error("Failed to delete user_contractor records")
-		result.Error = fmt.Sprintf("failed to delete user_contractor records: %v", err)
-		result.FilesDeleted = deletedCount
-		return result, err
+	s3Objects := cs.deletableObjects(ctx, result, deletionContext.S3Objects)
+
+	logger.WithFields(log.Fields{
+		"contractor_id": contractorID,
+		"file_count":    len(s3Objects),
+	}).Info("Found files to delete for contractor")
+
+	// Delete all S3 objects; these keys are scoped to the contractor's projects, so this is safe in a shared bucket.
+	// A continuation only pauses while emptying the bucket, once these were already deleted.
+	deletedCount := 0
+	if message.ResumeAfter == "" {
+		deletedCount, err = cs.removeObjects(ctx, message, s3Objects)
+		if err != nil {
+			result.Error = fmt.Sprintf("failed to delete contractor files: %v", err)
+			result.FilesDeleted = deletedCount
+			return result, err
+		}
+		result.AddRemoved(s3Objects)
+
+		// The lambda logs may live outside the contractor's bucket, so they are deleted on their own; quarantined
+		// contractors keep them. Like the bucket, a failure does not hold up the database cleanup.
+		if !cs.quarantines(message) {
+			logsDeleted, err := cs.deleteLambdaLogs(ctx, message, contractor)
+			deletedCount += logsDeleted
+			if err != nil {
+				logger.WithError(err).WithField("contractor_id", contractorID).Warn("Failed to delete contractor lambda logs, continuing with cleanup")
+			}
+		}
 	}
 
-	// viewer_contractor has FK to contractor(id) without ON DELETE CASCADE
-	if err := cs.viewerContractorRepo.HardDeleteByContractorID(ctx, contractorID); err != nil {
-		logger.WithError(err).WithField("contractor_id", contractorID).Error("Failed to delete viewer_contractor records")
-		result.Error = fmt.Sprintf("failed to delete viewer_contractor records: %v", err)
-		result.FilesDeleted = deletedCount
-		return result, err
+	// Quarantined objects must outlive the cleanse, so their bucket is left in place
+	if cs.quarantines(message) {
+		logger.WithField("contractor_id", contractorID).Info("Quarantine mode, keeping contractor bucket")
+		if contractor.AwsBucketName != "" {
+			result.AddBucketOutcome(contractor.AwsBucketName, dto.BucketOutcomeKept, nil)
+		}
+	} else if expiring {
+		// The bucket can only be deleted once S3 has emptied it, which takes a day or more
+		result.FollowUp = &dto.CleansingMessage{
+			Type:          dto.CleansingTypeExpiredBucket,
+			ID:            contractorID,
+			BucketName:    contractor.AwsBucketName,
+			BucketRegion:  contractor.AwsBucketRegion,
+			CorrelationID: workerLog.CorrelationIDFromContext(ctx),
+		}
+		result.Message = fmt.Sprintf("Contractor deleted, bucket %s left to expire and scheduled for deletion", contractor.AwsBucketName)
+		result.AddBucketOutcome(contractor.AwsBucketName, dto.BucketOutcomeExpiring, nil)
+		logger.WithFields(log.Fields{
+			"contractor_id": contractorID,
+			"bucket":        contractor.AwsBucketName,
+		}).Info("Contractor bucket left to its expiration rule")
+	} else if dedicated {
+		var err error
+		outcome := dto.BucketOutcomeDeleted
+		if message.PreserveEntity {
+			err = cs.s3Service.EmptyBucket(ctx, contractor.AwsBucketName, contractor.AwsBucketRegion, contractorID)
+			outcome = dto.BucketOutcomeEmptied
+		} else {
+			err = cs.s3Service.DeleteBucket(ctx, contractor.AwsBucketName, contractor.AwsBucketRegion, contractorID)
+		}
+		// The database records are only removed once the bucket is, so the continuation can still find them.
+		// Extra buckets are only cleaned up once the main bucket is done.
+		var paused *RuntimeExceededError
+		if errors.As(err, &paused) {
+			result.AddBucketOutcome(contractor.AwsBucketName, dto.BucketOutcomePaused, nil)
+			result.Success = true
+			result.Paused = true
+			result.FilesDeleted = deletedCount
+			result.FollowUp = continuation(ctx, message, paused.ResumeAfter)
+			result.Message = fmt.Sprintf("Contractor cleansing paused after %s, continuing after key %s of bucket %s",
+				cs.maxRuntime, paused.ResumeAfter, paused.Bucket)
+			logger.WithFields(log.Fields{
+				"contractor_id": contractorID,
+				"bucket":        paused.Bucket,
+				"resume_after":  paused.ResumeAfter,
+				"max_runtime":   cs.maxRuntime.String(),
+			}).Warn("Contractor cleansing ran out of runtime, scheduling its continuation")
+			return result, nil
+		}
+		if errors.Is(err, ErrBucketNotOwned) || errors.Is(err, ErrBucketNotAllowed) || errors.Is(err, ErrObjectLimitExceeded) {
+			// The recorded bucket may belong to someone else, or hold far more than expected; stop before touching the database
+			logger.WithError(err).WithField("contractor_id", contractorID).Error("Refusing to delete contractor bucket")
+			result.AddBucketOutcome(contractor.AwsBucketName, dto.BucketOutcomeFailed, err)
+			result.Error = err.Error()
+			result.FilesDeleted = deletedCount
+			return result, err
+		}
+		if err != nil {
+			logger.WithError(err).WithFields(log.Fields{
+				"contractor_id": contractorID,
+				"bucket":        contractor.AwsBucketName,
+			}).Warn("Failed to clean up contractor bucket, continuing with database cleanup")
+			outcome = dto.BucketOutcomeFailed
+		}
+		result.AddBucketOutcome(contractor.AwsBucketName, outcome, err)
+	} else if contractor.AwsBucketName != "" {
+		outcome := dto.BucketOutcomeShared
+		if !bucketExists {
+			outcome = dto.BucketOutcomeMissing
+		}
+		result.AddBucketOutcome(contractor.AwsBucketName, outcome, nil)
 	}
 
-	// contractor_project has FK to contractor(id) without ON DELETE CASCADE
-	if err := cs.contractorProjectRepo.HardDeleteByContractorID(ctx, contractorID); err != nil {
-		logger.WithError(err).WithField("contractor_id", contractorID).Error("Failed to delete contractor_project records")
-		result.Error = fmt.Sprintf("failed to delete contractor_project records: %v", err)
+	if err := cs.cleanupExtraBuckets(ctx, message, contractorID, extraBuckets, contractor.AwsBucketRegion, result); err != nil {
+		result.Error = err.Error()
 		result.FilesDeleted = deletedCount
 		return result, err
 	}
 
-	// 7. Delete the contractor itself (now safe - all FK references removed)
-	if err := cs.contractorRepo.Delete(ctx, contractorID); err != nil {
-		logger.WithError(err).WithField("contractor_id", contractorID).Error("Failed to delete contractor record")
-		result.Error = fmt.Sprintf("failed to delete contractor record: %v", err)
-		result.FilesDeleted = deletedCount
+	result.FilesDeleted = deletedCount
+	if err := cs.cascadeContractorRecords(ctx, message, result); err != nil {
 		return result, err
 	}
 
@@ -235,21 +654,46 @@ func (cs *CleansingServiceImpl) DeleteContractorFiles(ctx context.Context, contr
 
 // DeleteProjectFiles deletes all files related to a project (including all sites)
 func (cs *CleansingServiceImpl) DeleteProjectFiles(ctx context.Context, projectID int64) (*dto.CleansingResult, error) {
+	message := dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: projectID}
+	ctx, err := cs.messageContractorContext(ctx, message)
+	if err != nil {
+		return &dto.CleansingResult{
+			Type:    message.Type,
+			ID:      message.ID,
+			Success: false,
+			Error:   err.Error(),
+		}, err
+	}
+	return cs.deleteProjectFiles(ctx, message)
+}
+
+// deleteProjectFiles deletes a project's files and records
+func (cs *CleansingServiceImpl) deleteProjectFiles(ctx context.Context, message dto.CleansingMessage) (*dto.CleansingResult, error) {
+	projectID := message.ID
 	logger := workerLog.GetLoggerFromContext(ctx)
 	logger.WithField("project_id", projectID).Info("Starting project file deletion")
 
 	result := &dto.CleansingResult{
-		Type:    dto.CleansingTypeProject,
-		ID:      projectID,
-		Success: false,
+		Type:        dto.CleansingTypeProject,
+		ID:          projectID,
+		Success:     false,
+		Quarantined: cs.quarantines(message),
 	}
 
-	// Get all S3 objects for the project
-	s3Objects, err := cs.s3Service.ListProjectFiles(ctx, projectID)
+	// A dangling contractor reference would otherwise only surface as a confusing error while building the keys
+	if _, err := cs.projectContractor(ctx, projectID); err != nil {
+		logger.WithError(err).WithField("project_id", projectID).Error("Refusing to cleanse project")
+		result.Error = err.Error()
+		return result, err
+	}
+
+	// Resolve all S3 objects for the project
+	deletionContext, err := cs.BuildDeletionContext(ctx, dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: projectID})
 	if err != nil {
-		result.Error = fmt.Sprintf("failed to list project files: %v", err)
+		result.Error = err.Error()
 		return result, err
 	}
+	s3Objects := cs.deletableObjects(ctx, result, deletionContext.S3Objects)
 
 	logger.WithFields(log.Fields{
 		"project_id": projectID,
@@ -257,7 +701,7 @@ func (cs *CleansingServiceImpl) DeleteProjectFiles(ctx context.Context, projectI
 	}).Info("Found files to delete for project")
 
 	// Delete all S3 objects
-	deletedCount, err := cs.s3Service.DeleteObjects(ctx, s3Objects)
+	deletedCount, err := cs.removeObjects(ctx, message, s3Objects)
 	if err != nil {
 		result.Error = fmt.Sprintf("failed to delete project files: %v", err)
 		result.FilesDeleted = deletedCount
@@ -280,6 +724,7 @@ func (cs *CleansingServiceImpl) DeleteProjectFiles(ctx context.Context, projectI
 		}
 		return result, err
 	}
+	result.AddRemoved(s3Objects)
 
 	// Calculate total file size for successfully deleted files
 	var totalSize int64
@@ -287,68 +732,20 @@ func (cs *CleansingServiceImpl) DeleteProjectFiles(ctx context.Context, projectI
 		totalSize += obj.Size
 	}
 
-	// Update usage metrics for successful deletion
-	if err := cs.projectRepo.UpdateProjectUsage(ctx, projectID, -totalSize); err != nil {
+	// All of the project's files are gone, so its usage and its uploaders' usage drop to zero
+	if err := cs.projectRepo.ResetFileSizeUsage(ctx, projectID); err != nil {
 		logger.WithError(err).WithFields(log.Fields{
 			"project_id": projectID,
 			"total_size": totalSize,
-		}).Error("Failed to update project usage after successful deletion")
+		}).Error("Failed to reset project usage after successful deletion")
 		// Continue with database cleanup even if usage update fails
 	}
-
-	// =====================================================
-	// Database cascade deletion (bottom-up order)
-	// =====================================================
-	logger.WithField("project_id", projectID).Info("Starting database cascade deletion for project")
-
-	// Get all sites for this project to cascade delete
-	sites, err := cs.siteRepo.GetByProjectID(ctx, projectID)
-	if err != nil {
-		logger.WithError(err).WithField("project_id", projectID).Error("Failed to get sites for project")
-		result.Error = fmt.Sprintf("failed to get sites for project: %v", err)
-		result.FilesDeleted = deletedCount
-		return result, err
-	}
-
-	for _, site := range sites {
-		// 1. Delete all files belonging to documents of this site
-		if err := cs.fileRepo.HardDeleteBySiteID(ctx, site.Id); err != nil {
-			logger.WithError(err).WithField("site_id", site.Id).Warn("Failed to delete file records for site")
-		}
-
-		// 2. Delete all documents belonging to document groups of this site
-		if err := cs.documentRepo.HardDeleteBySiteID(ctx, site.Id); err != nil {
-			logger.WithError(err).WithField("site_id", site.Id).Warn("Failed to delete document records for site")
-		}
-
-		// 3. Delete all document groups of this site
-		if err := cs.documentGroupRepo.HardDeleteBySiteID(ctx, site.Id); err != nil {
-			logger.WithError(err).WithField("site_id", site.Id).Warn("Failed to delete document group records for site")
-		}
+	if err := cs.uploaderUsageRepo.ResetByProjectID(ctx, projectID); err != nil {
+		logger.WithError(err).WithField("project_id", projectID).Error("Failed to reset uploader usage after successful deletion")
 	}
 
-	// 4. Delete all sites of this project
-	if err := cs.siteRepo.HardDeleteByProjectID(ctx, projectID); err != nil {
-		logger.WithError(err).WithField("project_id", projectID).Error("Failed to delete site records for project")
-		result.Error = fmt.Sprintf("failed to delete site records: %v", err)
-		result.FilesDeleted = deletedCount
-		return result, err
-	}
-
-	// 5. Delete FK-blocking association records before deleting the project
-	// client_project, uploader_project, vessel_project, contractor_project all have FKs to project(id)
-	if err := cs.projectRepo.CleanupProjectAssociations(ctx, projectID); err != nil {
-		logger.WithError(err).WithField("project_id", projectID).Error("Failed to cleanup project associations")
-		result.Error = fmt.Sprintf("failed to cleanup project associations: %v", err)
-		result.FilesDeleted = deletedCount
-		return result, err
-	}
-
-	// 6. Delete the project itself (now safe - all FK references removed)
-	if err := cs.projectRepo.HardDelete(ctx, projectID); err != nil {
-		logger.WithError(err).WithField("project_id", projectID).Error("Failed to delete project record")
-		result.Error = fmt.Sprintf("failed to delete project record: %v", err)
-		result.FilesDeleted = deletedCount
+	result.FilesDeleted = deletedCount
+	if err := cs.cascadeProjectRecords(ctx, projectID, result); err != nil {
 		return result, err
 	}
 
@@ -365,29 +762,49 @@ func (cs *CleansingServiceImpl) DeleteProjectFiles(ctx context.Context, projectI
 
 // DeleteSiteFiles deletes all files related to a site
 func (cs *CleansingServiceImpl) DeleteSiteFiles(ctx context.Context, siteID int64) (*dto.CleansingResult, error) {
+	message := dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: siteID}
+	ctx, err := cs.messageContractorContext(ctx, message)
+	if err != nil {
+		return &dto.CleansingResult{
+			Type:    message.Type,
+			ID:      message.ID,
+			Success: false,
+			Error:   err.Error(),
+		}, err
+	}
+	return cs.deleteSiteFiles(ctx, message)
+}
+
+// deleteSiteFiles deletes a site's files and records
+func (cs *CleansingServiceImpl) deleteSiteFiles(ctx context.Context, message dto.CleansingMessage) (*dto.CleansingResult, error) {
+	siteID := message.ID
 	logger := workerLog.GetLoggerFromContext(ctx)
 	logger.WithField("site_id", siteID).Info("Starting site file deletion")
 
 	result := &dto.CleansingResult{
-		Type:    dto.CleansingTypeSite,
-		ID:      siteID,
-		Success: false,
+		Type:        dto.CleansingTypeSite,
+		ID:          siteID,
+		Success:     false,
+		Quarantined: cs.quarantines(message),
 	}
 
 	// Get the site to obtain project ID for usage update
-	site, err := cs.siteRepo.GetByID(ctx, siteID)
+	site, err := retryRead(ctx, cs.readRetry, func() (*entity.Site, error) {
+		return cs.siteRepo.GetByID(ctx, siteID)
+	})
 	if err != nil {
 		logger.WithError(err).WithField("site_id", siteID).Error("Failed to get site information")
 		result.Error = fmt.Sprintf("failed to get site information: %v", err)
 		return result, err
 	}
 
-	// Get all S3 objects for the site
-	s3Objects, err := cs.s3Service.ListSiteFiles(ctx, siteID)
+	// Resolve all S3 objects for the site
+	deletionContext, err := cs.BuildDeletionContext(ctx, dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: siteID})
 	if err != nil {
-		result.Error = fmt.Sprintf("failed to list site files: %v", err)
+		result.Error = err.Error()
 		return result, err
 	}
+	s3Objects := cs.deletableObjects(ctx, result, deletionContext.S3Objects)
 
 	logger.WithFields(log.Fields{
 		"site_id":    siteID,
@@ -395,12 +812,13 @@ func (cs *CleansingServiceImpl) DeleteSiteFiles(ctx context.Context, siteID int6
 	}).Info("Found files to delete for site")
 
 	// Delete all S3 objects
-	deletedCount, err := cs.s3Service.DeleteObjects(ctx, s3Objects)
+	deletedCount, err := cs.removeObjects(ctx, message, s3Objects)
 	if err != nil {
 		result.Error = fmt.Sprintf("failed to delete site files: %v", err)
 		result.FilesDeleted = deletedCount
 		return result, err
 	}
+	result.AddRemoved(s3Objects)
 
 	// Calculate total file size for successfully deleted files
 	var totalSize int64
@@ -418,51 +836,87 @@ func (cs *CleansingServiceImpl) DeleteSiteFiles(ctx context.Context, siteID int6
 		// Continue with database cleanup even if usage update fails
 	}
 
-	// =====================================================
-	// Database cascade deletion (bottom-up order)
-	// =====================================================
-	logger.WithField("site_id", siteID).Info("Starting database cascade deletion for site")
-
-	// 1. Delete all files belonging to documents of this site
-	if err := cs.fileRepo.HardDeleteBySiteID(ctx, siteID); err != nil {
-		logger.WithError(err).WithField("site_id", siteID).Error("Failed to delete file records")
-		result.Error = fmt.Sprintf("failed to delete file records: %v", err)
-		result.FilesDeleted = deletedCount
+	result.FilesDeleted = deletedCount
+	if err := cs.cascadeSiteRecords(ctx, siteID, result); err != nil {
 		return result, err
 	}
 
-	// 2. Delete all documents belonging to document groups of this site
-	if err := cs.documentRepo.HardDeleteBySiteID(ctx, siteID); err != nil {
-		logger.WithError(err).WithField("site_id", siteID).Error("Failed to delete document records")
-		result.Error = fmt.Sprintf("failed to delete document records: %v", err)
-		result.FilesDeleted = deletedCount
+	result.Success = true
+	result.FilesDeleted = deletedCount
+	logger.WithFields(log.Fields{
+		"site_id":       siteID,
+		"project_id":    site.ProjectId,
+		"files_deleted": deletedCount,
+		"total_size":    totalSize,
+	}).Info("Successfully deleted site files and database records")
+
+	return result, nil
+}
+
+// DeleteObjectsDirect deletes the given keys from bucket without traversing the database, e.g. to remediate
+// the keys a prior run failed to delete. The bucket must belong to a contractor, whose ID and region the result
+// and deletion use. Duplicate keys are deleted once; empty, over-long, directory-like and protected keys are
+// skipped. No database records are touched.
+func (cs *CleansingServiceImpl) DeleteObjectsDirect(ctx context.Context, bucket string, keys []string) (*dto.CleansingResult, error) {
+	logger := workerLog.GetLoggerFromContext(ctx)
+	logger.WithFields(log.Fields{
+		"bucket":    bucket,
+		"key_count": len(keys),
+	}).Info("Starting direct object deletion")
+
+	result := &dto.CleansingResult{
+		Type:        dto.CleansingTypeContractor,
+		Success:     false,
+		Quarantined: cs.quarantine,
+	}
+
+	if bucket == "" {
+		err := errors.New("bucket is required")
+		result.Error = err.Error()
 		return result, err
 	}
 
-	// 3. Delete all document groups of this site
-	if err := cs.documentGroupRepo.HardDeleteBySiteID(ctx, siteID); err != nil {
-		logger.WithError(err).WithField("site_id", siteID).Error("Failed to delete document group records")
-		result.Error = fmt.Sprintf("failed to delete document group records: %v", err)
-		result.FilesDeleted = deletedCount
+	// Only buckets known to belong to a contractor may be touched
+	contractor, err := retryRead(ctx, cs.readRetry, func() (*entity.Contractor, error) {
+		return cs.contractorRepo.GetByBucketName(ctx, bucket)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		err = fmt.Errorf("bucket %s is not used by any contractor: %w", bucket, ErrBucketNotOwned)
+	}
+	if err != nil {
+		logger.WithError(err).WithField("bucket", bucket).Error("Failed to resolve contractor for bucket")
+		result.Error = err.Error()
 		return result, err
 	}
+	result.ID = contractor.Id
 
-	// 4. Delete the site itself
-	if err := cs.siteRepo.HardDelete(ctx, siteID); err != nil {
-		logger.WithError(err).WithField("site_id", siteID).Error("Failed to delete site record")
-		result.Error = fmt.Sprintf("failed to delete site record: %v", err)
-		result.FilesDeleted = deletedCount
+	objects := make([]dto.S3Object, 0, len(keys))
+	for _, key := range keys {
+		if len(key) > maxKeyLength {
+			logger.WithField("key_length", len(key)).Warn("Skipping key longer than S3 allows")
+			result.AddSkipped(dto.SkipReasonInvalidKey, 1)
+			continue
+		}
+		objects = append(objects, dto.S3Object{Bucket: bucket, Key: key, Region: contractor.AwsBucketRegion})
+	}
+	objects = cs.deletableObjects(ctx, result, objects)
+
+	deletedCount, err := cs.removeObjects(ctx, dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: contractor.Id}, objects)
+	result.FilesDeleted = deletedCount
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to delete objects: %v", err)
 		return result, err
 	}
+	result.AddRemoved(objects)
 
 	result.Success = true
-	result.FilesDeleted = deletedCount
+	result.Message = fmt.Sprintf("Deleted %d of %d keys from bucket %s", deletedCount, len(keys), bucket)
 	logger.WithFields(log.Fields{
-		"site_id":       siteID,
-		"project_id":    site.ProjectId,
+		"bucket":        bucket,
+		"contractor_id": contractor.Id,
 		"files_deleted": deletedCount,
-		"total_size":    totalSize,
-	}).Info("Successfully deleted site files and database records")
+		"files_skipped": result.FilesSkipped,
+	}).Info("Completed direct object deletion")
 
 	return result, nil
 }
@@ -477,6 +931,526 @@ func (ncs *NullCleansingService) ProcessCleansingMessage(ctx context.Context, me
 	}, nil
 }
 
+func (ncs *NullCleansingService) BuildDeletionContext(ctx context.Context, message dto.CleansingMessage) (*dto.DeletionContext, error) {
+	return &dto.DeletionContext{
+		Type:        message.Type,
+		ID:          message.ID,
+		S3Objects:   []dto.S3Object{},
+		Description: message.GetDescription(),
+	}, nil
+}
+
+// deleteSelectedFiles deletes only the S3 objects selected by the message category and scope, e.g. the
+// processed outputs of a site before it is reprocessed. Database records are kept so the contractor,
+// project or site stays usable.
+func (cs *CleansingServiceImpl) deleteSelectedFiles(ctx context.Context, message dto.CleansingMessage) (*dto.CleansingResult, error) {
+	logger := workerLog.GetLoggerFromContext(ctx)
+	logger.WithFields(log.Fields{
+		"type":     message.Type,
+		"id":       message.ID,
+		"category": message.Category,
+		"scope":    message.Scope,
+	}).Info("Starting partial file deletion")
+
+	result := &dto.CleansingResult{
+		Type:        message.Type,
+		ID:          message.ID,
+		Success:     false,
+		Quarantined: cs.quarantines(message),
+	}
+
+	if message.Type == dto.CleansingTypeProject {
+		if _, err := cs.projectContractor(ctx, message.ID); err != nil {
+			logger.WithError(err).WithField("project_id", message.ID).Error("Refusing to cleanse project")
+			result.Error = err.Error()
+			return result, err
+		}
+	}
+
+	deletionContext, err := cs.BuildDeletionContext(ctx, message)
+	if err != nil {
+		result.Error = err.Error()
+		return result, err
+	}
+	s3Objects := cs.deletableObjects(ctx, result, deletionContext.S3Objects)
+
+	deletedCount, err := cs.removeObjects(ctx, message, s3Objects)
+	result.FilesDeleted = deletedCount
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to delete %s: %v", message.Selection(), err)
+		return result, err
+	}
+	result.AddRemoved(s3Objects)
+
+	// Give the deleted bytes back to the owning project; a contractor spans several projects
+	// and has no single usage row to adjust
+	deletedSize := cs.calculateSizeForDeletedFiles(s3Objects, deletedCount)
+	projectID := message.ID
+	if message.Type == dto.CleansingTypeSite {
+		site, err := retryRead(ctx, cs.readRetry, func() (*entity.Site, error) {
+			return cs.siteRepo.GetByID(ctx, message.ID)
+		})
+		if err != nil {
+			logger.WithError(err).WithField("site_id", message.ID).Warn("Failed to get site for usage update")
+			projectID = 0
+		} else {
+			projectID = site.ProjectId
+		}
+	}
+	if message.Type != dto.CleansingTypeContractor && projectID != 0 && deletedSize > 0 {
+		if err := cs.projectRepo.UpdateProjectUsage(ctx, projectID, -deletedSize); err != nil {
+			logger.WithError(err).WithFields(log.Fields{
+				"project_id":   projectID,
+				"deleted_size": deletedSize,
+			}).Warn("Failed to update project usage after partial deletion")
+		}
+	}
+
+	result.Success = true
+	result.Message = fmt.Sprintf("Deleted %d %s", deletedCount, message.Selection())
+	logger.WithFields(log.Fields{
+		"type":          message.Type,
+		"id":            message.ID,
+		"category":      message.Category,
+		"scope":         message.Scope,
+		"files_deleted": deletedCount,
+	}).Info("Successfully deleted selected files")
+
+	return result, nil
+}
+
+// deleteExpiredBucket deletes a contractor bucket that deleteContractorFiles left to its expiration lifecycle rule.
+// While the bucket still holds objects the message is returned as the result's follow-up, to be checked again later.
+func (cs *CleansingServiceImpl) deleteExpiredBucket(ctx context.Context, message dto.CleansingMessage) (*dto.CleansingResult, error) {
+	logger := workerLog.GetLoggerFromContext(ctx).WithFields(log.Fields{
+		"contractor_id": message.ID,
+		"bucket":        message.BucketName,
+	})
+
+	result := &dto.CleansingResult{
+		Type:    message.Type,
+		ID:      message.ID,
+		Success: false,
+	}
+
+	deleted, err := cs.s3Service.DeleteExpiredBucket(ctx, message.BucketName, message.BucketRegion, message.ID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to delete expired bucket")
+		result.Error = err.Error()
+		return result, err
+	}
+
+	result.Success = true
+	if !deleted {
+		followUp := message
+		result.FollowUp = &followUp
+		result.Message = fmt.Sprintf("Bucket %s is not empty yet, checking again later", message.BucketName)
+		logger.Info("Expired bucket is not empty yet")
+		return result, nil
+	}
+
+	result.Message = fmt.Sprintf("Deleted expired bucket %s", message.BucketName)
+	return result, nil
+}
+
+// expiresBucket reports whether a contractor's dedicated bucket is left to an expiration lifecycle rule
+// rather than emptied synchronously. A preserved contractor keeps its bucket, which must not expire new
+// uploads, and quarantined objects must outlive the cleanse.
+func (cs *CleansingServiceImpl) expiresBucket(message dto.CleansingMessage) bool {
+	return cs.bucketCleanup == BucketCleanupLifecycle && !message.PreserveEntity && !cs.quarantines(message)
+}
+
+// owningContractorID resolves the contractor a cleansing message ultimately operates on
+func (cs *CleansingServiceImpl) owningContractorID(ctx context.Context, message dto.CleansingMessage) (int64, error) {
+	projectID := message.ID
+	switch message.Type {
+	case dto.CleansingTypeContractor, dto.CleansingTypeExpiredBucket, dto.CleansingTypeManifest:
+		return message.ID, nil
+	case dto.CleansingTypeSite:
+		site, err := retryRead(ctx, cs.readRetry, func() (*entity.Site, error) {
+			return cs.siteRepo.GetByID(ctx, message.ID)
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to get site: %w", err)
+		}
+		projectID = site.ProjectId
+	}
+
+	contractorProject, err := retryRead(ctx, cs.readRetry, func() (*entity.ContractorProject, error) {
+		return cs.contractorProjectRepo.GetByProjectID(ctx, projectID)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get contractor for project %d: %w", projectID, err)
+	}
+	return contractorProject.ContractorId, nil
+}
+
+// contractorContext returns ctx carrying the contractor when contractor credentials are configured, so the S3
+// service makes every request for it, not only deletes, with the contractor's own key or a role assumed for it.
+// A contractor whose record is already gone, as for an expired bucket, is carried by its ID, which a role needs.
+func (cs *CleansingServiceImpl) contractorContext(ctx context.Context, contractorID int64) (context.Context, error) {
+	if !cs.contractorCredentials {
+		return ctx, nil
+	}
+	if _, ok := contractorFromContext(ctx); ok {
+		return ctx, nil
+	}
+
+	contractor, err := retryRead(ctx, cs.readRetry, func() (*entity.Contractor, error) {
+		return cs.contractorRepo.GetByID(ctx, contractorID)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return withContractor(ctx, &entity.Contractor{Id: contractorID}), nil
+	}
+	if err != nil {
+		return ctx, fmt.Errorf("failed to resolve contractor credentials: failed to get contractor %d: %w", contractorID, err)
+	}
+	return withContractor(ctx, contractor), nil
+}
+
+// messageContractorContext is contractorContext for the contractor owning the message's entity
+func (cs *CleansingServiceImpl) messageContractorContext(ctx context.Context, message dto.CleansingMessage) (context.Context, error) {
+	if _, ok := contractorFromContext(ctx); !cs.contractorCredentials || ok {
+		return ctx, nil
+	}
+	contractorID, err := cs.owningContractorID(ctx, message)
+	if err != nil {
+		return ctx, fmt.Errorf("failed to resolve contractor credentials: %w", err)
+	}
+	return cs.contractorContext(ctx, contractorID)
+}
+
+// projectContractor loads the contractor owning a project, returning an ErrContractorNotFound error when the
+// project has no contractor or references one that does not exist
+func (cs *CleansingServiceImpl) projectContractor(ctx context.Context, projectID int64) (*entity.Contractor, error) {
+	contractorProject, err := retryRead(ctx, cs.readRetry, func() (*entity.ContractorProject, error) {
+		return cs.contractorProjectRepo.GetByProjectID(ctx, projectID)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("%w: project %d has no contractor", ErrContractorNotFound, projectID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contractor for project %d: %w", projectID, err)
+	}
+
+	contractor, err := retryRead(ctx, cs.readRetry, func() (*entity.Contractor, error) {
+		return cs.contractorRepo.GetByID(ctx, contractorProject.ContractorId)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("%w: project %d references contractor %d", ErrContractorNotFound, projectID, contractorProject.ContractorId)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contractor %d: %w", contractorProject.ContractorId, err)
+	}
+	return contractor, nil
+}
+
+// deleteSiteTree deletes the records under a site, logging rather than returning a failure so the cascade can
+// carry on with the other sites, and returns what the site held for verifyCascade
+func (cs *CleansingServiceImpl) deleteSiteTree(ctx context.Context, siteID int64) siteChildren {
+	ctx, span := tracing.Start(ctx, "cleansing.delete_site_records", attribute.Int64("site_id", siteID))
+	defer span.End()
+
+	logger := workerLog.GetLoggerFromContext(ctx)
+
+	children, err := cs.collectSiteChildren(ctx, siteID)
+	if err != nil {
+		logger.WithError(err).WithField("site_id", siteID).Warn("Failed to read records for site")
+		return children
+	}
+	if err := cs.deleteSiteRecords(ctx, children); err != nil {
+		logger.WithError(err).WithField("site_id", siteID).Warn("Failed to delete records for site")
+	}
+	return children
+}
+
+// deleteSiteRecords deletes a site's document groups after their files and documents. Groups are emptied
+// concurrently, up to cascadeConcurrency at a time and each in its own transaction; the groups themselves are
+// only deleted once all of them are empty, so a failure never leaves documents or files without a parent.
+func (cs *CleansingServiceImpl) deleteSiteRecords(ctx context.Context, site siteChildren) error {
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(cs.cascadeConcurrency)
+	for _, groupID := range site.groupIDs {
+		g.Go(func() error {
+			if err := cs.documentGroupRepo.HardDeleteContents(gctx, groupID); err != nil {
+				return fmt.Errorf("failed to delete contents of document group %d: %w", groupID, err)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	if err := cs.documentGroupRepo.HardDeleteBySiteID(ctx, site.siteID); err != nil {
+		return fmt.Errorf("failed to delete document groups: %w", err)
+	}
+	return nil
+}
+
+// contractorBucketExists reports whether a bucket of the contractor still exists.
+// An empty bucket name is not checked and is reported as existing.
+func (cs *CleansingServiceImpl) contractorBucketExists(ctx context.Context, contractorID int64, bucket, region string) (bool, error) {
+	logger := workerLog.GetLoggerFromContext(ctx)
+
+	if bucket == "" {
+		return true, nil
+	}
+
+	exists, err := cs.s3Service.BucketExists(ctx, bucket, region)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		logger.WithFields(log.Fields{
+			"contractor_id": contractorID,
+			"bucket":        bucket,
+		}).Info("Contractor bucket no longer exists, skipping S3 deletion")
+	}
+	return exists, nil
+}
+
+// normalizeContractorBuckets validates the contractor's bucket names, normalizing AwsBucketName in place, and
+// returns its normalized extra buckets
+func normalizeContractorBuckets(contractor *entity.Contractor) ([]string, error) {
+	if contractor.AwsBucketName != "" {
+		normalized, err := NormalizeAndValidateBucketName(contractor.AwsBucketName)
+		if err != nil {
+			return nil, err
+		}
+		contractor.AwsBucketName = normalized
+	}
+
+	extraBuckets := contractor.ExtraBuckets()
+	for i, bucket := range extraBuckets {
+		normalized, err := NormalizeAndValidateBucketName(bucket)
+		if err != nil {
+			return nil, fmt.Errorf("extra bucket: %w", err)
+		}
+		extraBuckets[i] = normalized
+	}
+	return extraBuckets, nil
+}
+
+// cleanupExtraBuckets deletes the contractor's extra buckets as a whole, or empties them when the contractor record
+// is preserved, recording each one's outcome on result. Like the main bucket, a missing or shared bucket is left
+// alone, a quarantined contractor keeps them all, and a failure does not hold up the database cleanup. Ownership
+// and the bucket lists were checked before anything was deleted, so a bucket refused here, e.g. for holding more
+// than the object limit, is kept and reported as failed rather than stopping the cleanse once the main bucket is
+// gone; only an unreadable contractor count stops it, to be retried. The runtime limit and a continuation's resume
+// key only apply to the main bucket, so extra buckets are emptied in one go.
+func (cs *CleansingServiceImpl) cleanupExtraBuckets(ctx context.Context, message dto.CleansingMessage, contractorID int64, buckets []string, region string, result *dto.CleansingResult) error {
+	logger := workerLog.GetLoggerFromContext(ctx)
+	ctx = withoutPausing(ctx)
+
+	for _, bucket := range buckets {
+		if cs.quarantines(message) {
+			result.AddBucketOutcome(bucket, dto.BucketOutcomeKept, nil)
+			continue
+		}
+
+		exists, err := cs.contractorBucketExists(ctx, contractorID, bucket, region)
+		if err != nil {
+			result.AddBucketOutcome(bucket, dto.BucketOutcomeFailed, err)
+			return err
+		}
+		if !exists {
+			result.AddBucketOutcome(bucket, dto.BucketOutcomeMissing, nil)
+			continue
+		}
+		dedicated, err := cs.hasDedicatedBucket(ctx, contractorID, bucket)
+		if err != nil {
+			result.AddBucketOutcome(bucket, dto.BucketOutcomeFailed, err)
+			return err
+		}
+		if !dedicated {
+			result.AddBucketOutcome(bucket, dto.BucketOutcomeShared, nil)
+			continue
+		}
+
+		outcome := dto.BucketOutcomeDeleted
+		if message.PreserveEntity {
+			err = cs.s3Service.EmptyBucket(ctx, bucket, region, contractorID)
+			outcome = dto.BucketOutcomeEmptied
+		} else {
+			err = cs.s3Service.DeleteBucket(ctx, bucket, region, contractorID)
+		}
+		if errors.Is(err, ErrBucketNotOwned) || errors.Is(err, ErrBucketNotAllowed) || errors.Is(err, ErrObjectLimitExceeded) {
+			logger.WithError(err).WithFields(log.Fields{
+				"contractor_id": contractorID,
+				"bucket":        bucket,
+			}).Error("Refusing to delete contractor bucket, keeping it and continuing with database cleanup")
+			outcome = dto.BucketOutcomeFailed
+		} else if err != nil {
+			logger.WithError(err).WithFields(log.Fields{
+				"contractor_id": contractorID,
+				"bucket":        bucket,
+			}).Warn("Failed to clean up contractor bucket, continuing with database cleanup")
+			outcome = dto.BucketOutcomeFailed
+		}
+		result.AddBucketOutcome(bucket, outcome, err)
+	}
+	return nil
+}
+
+// verifyBucketOwnership checks that the contractor owns mainBucket, unless empty, and each of its existing dedicated
+// extra buckets, recording a refused bucket as failed on result
+func (cs *CleansingServiceImpl) verifyBucketOwnership(ctx context.Context, contractorID int64, mainBucket string, extraBuckets []string, region string, result *dto.CleansingResult) error {
+	logger := workerLog.GetLoggerFromContext(ctx)
+
+	var buckets []string
+	if mainBucket != "" {
+		buckets = append(buckets, mainBucket)
+	}
+	for _, bucket := range extraBuckets {
+		exists, err := cs.contractorBucketExists(ctx, contractorID, bucket, region)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		dedicated, err := cs.hasDedicatedBucket(ctx, contractorID, bucket)
+		if err != nil {
+			return err
+		}
+		if dedicated {
+			buckets = append(buckets, bucket)
+		}
+	}
+
+	for _, bucket := range buckets {
+		err := cs.s3Service.VerifyBucketOwner(ctx, bucket, region, contractorID)
+		if errors.Is(err, ErrBucketNotOwned) || errors.Is(err, ErrBucketNotAllowed) {
+			logger.WithError(err).WithField("contractor_id", contractorID).Error("Refusing to delete contractor bucket")
+			result.AddBucketOutcome(bucket, dto.BucketOutcomeFailed, err)
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("failed to verify the owner of bucket %s: %w", bucket, err)
+		}
+	}
+	return nil
+}
+
+// deletableObjects drops duplicate objects, protected objects and objects with unsafe keys, recording each
+// skip and its reason on result, and returns the rest
+func (cs *CleansingServiceImpl) deletableObjects(ctx context.Context, result *dto.CleansingResult, objects []dto.S3Object) []dto.S3Object {
+	type objectKey struct{ bucket, key string }
+	seen := make(map[objectKey]struct{}, len(objects))
+	unique := make([]dto.S3Object, 0, len(objects))
+	for _, obj := range objects {
+		k := objectKey{bucket: obj.Bucket, key: obj.Key}
+		if _, ok := seen[k]; ok {
+			result.AddSkipped(dto.SkipReasonDuplicate, 1)
+			continue
+		}
+		seen[k] = struct{}{}
+		unique = append(unique, obj)
+	}
+
+	objects, protected := cs.s3Service.FilterProtected(unique)
+	result.AddSkipped(dto.SkipReasonProtected, len(protected))
+	objects, unsafe := FilterUnsafeKeys(objects)
+	logUnsafeKeys(ctx, unsafe)
+	result.AddSkipped(dto.SkipReasonUnsafeKey, len(unsafe))
+	return objects
+}
+
+// quarantines reports whether the message's files are tagged as quarantined instead of deleted
+func (cs *CleansingServiceImpl) quarantines(message dto.CleansingMessage) bool {
+	return cs.quarantine || message.Quarantine
+}
+
+// removeObjects deletes objects, or quarantines them when quarantine mode applies to the message, once their
+// manifest is uploaded to the audit bucket. Buckets removed as a whole bypass it and so have no manifest.
+func (cs *CleansingServiceImpl) removeObjects(ctx context.Context, message dto.CleansingMessage, objects []dto.S3Object) (removed int, err error) {
+	ctx, span := tracing.Start(ctx, "cleansing.remove_objects", attribute.Int("object_count", len(objects)))
+	defer func() { tracing.End(span, err) }()
+
+	if err := cs.uploadManifest(ctx, message, objects); err != nil {
+		return 0, err
+	}
+
+	// Callers that bypass ProcessCleansingMessage have not selected the contractor's credentials yet
+	if ctx, err = cs.messageContractorContext(ctx, message); err != nil {
+		return 0, err
+	}
+
+	// Every key must fall under a site prefix of the entity, so a key built for another tenant is never deleted,
+	// nor quarantined and so left to a lifecycle rule
+	allowed, err := cs.allowedPrefixes(ctx, message)
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute allowed key prefixes: %w", err)
+	}
+	ctx = withAllowedPrefixes(ctx, allowed)
+
+	if cs.quarantines(message) {
+		return cs.s3Service.QuarantineObjects(ctx, objects)
+	}
+
+	if message.OverrideObjectLimit {
+		ctx = withLargeDeleteAllowed(ctx)
+	}
+	results, err := cs.s3Service.DeleteObjectsByBucket(ctx, objects)
+	logBucketDeletes(ctx, results)
+	logFailedDeletes(ctx, err)
+	return TotalDeleted(results), err
+}
+
+// logBucketDeletes logs how many objects were deleted and how many were not in each bucket
+func logBucketDeletes(ctx context.Context, results []dto.BucketDeleteResult) {
+	logger := workerLog.GetLoggerFromContext(ctx)
+	for _, result := range results {
+		entry := logger.WithFields(log.Fields{
+			"bucket":          result.Bucket,
+			"region":          result.Region,
+			"deleted_objects": result.Deleted,
+			"failed_objects":  result.Failed,
+		})
+		if result.Failed > 0 {
+			entry.WithField("error", result.Error).Warn("Deleted bucket objects with failures")
+			continue
+		}
+		entry.Info("Deleted bucket objects")
+	}
+}
+
+// logFailedDeletes logs every object a DeleteObjects error reports as not deleted
+func logFailedDeletes(ctx context.Context, err error) {
+	logger := workerLog.GetLoggerFromContext(ctx)
+	for _, failed := range FailedDeletes(err) {
+		logger.WithError(failed.Err).WithFields(log.Fields{
+			"bucket": failed.Bucket,
+			"key":    failed.Key,
+			"code":   failed.Code,
+		}).Error("Object was not deleted")
+	}
+}
+
+// hasDedicatedBucket reports whether no other contractor references the given bucket of the contractor.
+// When that cannot be determined the error is returned, so the cleanse fails rather than silently keeping a
+// dedicated bucket as if it were shared.
+func (cs *CleansingServiceImpl) hasDedicatedBucket(ctx context.Context, contractorID int64, bucket string) (bool, error) {
+	logger := workerLog.GetLoggerFromContext(ctx).WithFields(log.Fields{
+		"contractor_id": contractorID,
+		"bucket":        bucket,
+	})
+
+	count, err := retryRead(ctx, cs.readRetry, func() (int64, error) {
+		return cs.contractorRepo.CountByBucketName(ctx, bucket)
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to count contractors sharing the bucket")
+		return false, fmt.Errorf("failed to count contractors using bucket %s: %w", bucket, err)
+	}
+	if count > 1 {
+		logger.WithField("contractor_count", count).Info("Bucket is shared with other contractors, deleting only the contractor's keys")
+		return false, nil
+	}
+	return true, nil
+}
+
 // calculateSizeForDeletedFiles calculates the total size of files that were successfully deleted
 // This assumes files are deleted in order and the first 'deletedCount' files were successfully deleted
 func (cs *CleansingServiceImpl) calculateSizeForDeletedFiles(s3Objects []dto.S3Object, deletedCount int) int64 {
@@ -517,3 +1491,11 @@ func (ncs *NullCleansingService) DeleteSiteFiles(ctx context.Context, siteID int
 		FilesDeleted: 0,
 	}, nil
 }
+
+func (ncs *NullCleansingService) DeleteObjectsDirect(ctx context.Context, bucket string, keys []string) (*dto.CleansingResult, error) {
+	return &dto.CleansingResult{
+		Type:         dto.CleansingTypeContractor,
+		Success:      true,
+		FilesDeleted: 0,
+	}, nil
+}
@@ -0,0 +1,584 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/repository"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+	"gorm.io/gorm"
+)
+
+// newDBCleansingService builds a CleansingService backed by the real repositories on db and a no-op S3 service
+func newDBCleansingService(db *gorm.DB, cfg *config.Config) CleansingService {
+	return newDBCleansingServiceWithS3(db, cfg, &NullS3Service{})
+}
+
+// newDBCleansingServiceWithS3 is newDBCleansingService with the given S3 service
+func newDBCleansingServiceWithS3(db *gorm.DB, cfg *config.Config, s3Service S3Service) CleansingService {
+	return NewCleansingServiceWithConfig(cfg, s3Service,
+		repository.NewContractorRepository(db),
+		repository.NewUserContractorRepository(db),
+		repository.NewViewerContractorRepository(db),
+		repository.NewContractorProjectRepository(db),
+		repository.NewProjectRepository(db),
+		repository.NewSiteRepository(db),
+		repository.NewDocumentGroupRepository(db),
+		repository.NewDocumentRepository(db),
+		repository.NewFileRepository(db),
+		repository.NewUploaderContractorUsageRepository(db),
+		repository.NewTxManager(db),
+		nil,
+	)
+}
+
+// countRows returns the number of rows of model matching the given condition
+func countRows(t *testing.T, db *gorm.DB, model interface{}, query string, args ...interface{}) int64 {
+	t.Helper()
+
+	var count int64
+	if err := db.Model(model).Where(query, args...).Count(&count).Error; err != nil {
+		t.Fatalf("failed to count %T rows: %v", model, err)
+	}
+	return count
+}
+
+func TestCleansingService_DB_DeleteProjectFiles_ConcurrentCascade(t *testing.T) {
+	const groupCount = 40
+
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+
+	// Give the project's first site many groups, each with a document and two files
+	var groups entity.DocumentGroups
+	var documents entity.Documents
+	var files entity.Files
+	for i := int64(0); i < groupCount; i++ {
+		groups = append(groups, entity.DocumentGroup{Id: 3000 + i, SiteId: testutil.SiteID, Name: "Extra", Category: "SSS", Status: 1})
+		documents = append(documents, entity.Document{Id: 7000 + i, GroupID: 3000 + i, Name: "doc", Attachment: "doc"})
+		files = append(files,
+			entity.File{Id: 100 + 2*i, DocumentId: 7000 + i, Name: "a.xtf"},
+			entity.File{Id: 101 + 2*i, DocumentId: 7000 + i, Name: "b.xtf"},
+		)
+	}
+	for _, records := range []interface{}{&groups, &documents, &files} {
+		if err := db.Create(records).Error; err != nil {
+			t.Fatalf("failed to seed %T: %v", records, err)
+		}
+	}
+
+	service := newDBCleansingService(db, &config.Config{CascadeDeleteConcurrency: 8})
+	result, err := service.DeleteProjectFiles(context.Background(), testutil.ProjectID)
+	if err != nil {
+		t.Fatalf("DeleteProjectFiles() unexpected error: %v", err)
+	}
+	if !result.Success {
+		t.Fatalf("Expected success, got %+v", result)
+	}
+
+	// Nothing of the project is left, and nothing is orphaned
+	if got := countRows(t, db, &entity.DocumentGroup{}, "site_id IN ?", []int64{testutil.SiteID, testutil.SecondSiteID}); got != 0 {
+		t.Errorf("Expected project document groups to be deleted, found %d", got)
+	}
+	if got := countRows(t, db, &entity.Document{}, "group_id NOT IN (SELECT id FROM document_group)"); got != 0 {
+		t.Errorf("Expected no orphan documents, found %d", got)
+	}
+	if got := countRows(t, db, &entity.File{}, "document_id NOT IN (SELECT id FROM document)"); got != 0 {
+		t.Errorf("Expected no orphan files, found %d", got)
+	}
+
+	// The other contractor's tree is untouched
+	if got := countRows(t, db, &entity.File{}, "1 = 1"); got != 1 {
+		t.Errorf("Expected only the other project's file to remain, found %d files", got)
+	}
+}
+
+// skippingDocumentGroupRepository leaves the contents of one document group in place, as a partial failure would
+type skippingDocumentGroupRepository struct {
+	repository.DocumentGroupRepository
+	skipID int64
+}
+
+func (r *skippingDocumentGroupRepository) HardDeleteContents(ctx context.Context, groupID int64) error {
+	if groupID == r.skipID {
+		return nil
+	}
+	return r.DocumentGroupRepository.HardDeleteContents(ctx, groupID)
+}
+
+// skippingSiteRepository deletes a site without its document groups, documents and files
+type skippingSiteRepository struct {
+	repository.SiteRepository
+}
+
+func (r *skippingSiteRepository) HardDeleteCascade(ctx context.Context, id int64) error {
+	return r.SiteRepository.HardDelete(ctx, id)
+}
+
+func TestCleansingService_DB_VerifiesCascade(t *testing.T) {
+	tests := []struct {
+		name      string
+		sites     func(db *gorm.DB) repository.SiteRepository
+		groups    func(db *gorm.DB) repository.DocumentGroupRepository
+		process   func(service CleansingService) (*dto.CleansingResult, error)
+		wantError string
+	}{
+		{
+			name: "project with a group left unemptied",
+			groups: func(db *gorm.DB) repository.DocumentGroupRepository {
+				return &skippingDocumentGroupRepository{DocumentGroupRepository: repository.NewDocumentGroupRepository(db), skipID: 1000}
+			},
+			process: func(service CleansingService) (*dto.CleansingResult, error) {
+				return service.DeleteProjectFiles(context.Background(), testutil.ProjectID)
+			},
+			wantError: "1 documents of site 100, 2 files of site 100",
+		},
+		{
+			name: "contractor with a group left unemptied",
+			groups: func(db *gorm.DB) repository.DocumentGroupRepository {
+				return &skippingDocumentGroupRepository{DocumentGroupRepository: repository.NewDocumentGroupRepository(db), skipID: 1010}
+			},
+			process: func(service CleansingService) (*dto.CleansingResult, error) {
+				return service.DeleteContractorFiles(context.Background(), testutil.ContractorID)
+			},
+			wantError: "1 documents of site 101, 1 files of site 101",
+		},
+		{
+			name: "site deleted without its children",
+			sites: func(db *gorm.DB) repository.SiteRepository {
+				return &skippingSiteRepository{SiteRepository: repository.NewSiteRepository(db)}
+			},
+			process: func(service CleansingService) (*dto.CleansingResult, error) {
+				return service.DeleteSiteFiles(context.Background(), testutil.SiteID)
+			},
+			wantError: "2 document groups of site 100, 2 documents of site 100, 3 files of site 100",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewMigratedDB(t)
+			testutil.SeedTree(t, db)
+
+			var sites repository.SiteRepository = repository.NewSiteRepository(db)
+			if tt.sites != nil {
+				sites = tt.sites(db)
+			}
+			var groups repository.DocumentGroupRepository = repository.NewDocumentGroupRepository(db)
+			if tt.groups != nil {
+				groups = tt.groups(db)
+			}
+			service := NewCleansingServiceWithConfig(&config.Config{}, &NullS3Service{},
+				repository.NewContractorRepository(db),
+				repository.NewUserContractorRepository(db),
+				repository.NewViewerContractorRepository(db),
+				repository.NewContractorProjectRepository(db),
+				repository.NewProjectRepository(db),
+				sites,
+				groups,
+				repository.NewDocumentRepository(db),
+				repository.NewFileRepository(db),
+				repository.NewUploaderContractorUsageRepository(db),
+				repository.NewTxManager(db),
+				nil,
+			)
+
+			result, err := tt.process(service)
+			if !errors.Is(err, ErrOrphanedRecords) {
+				t.Fatalf("Expected ErrOrphanedRecords, got %v", err)
+			}
+			if result.Success {
+				t.Error("Expected the cleansing to be reported as failed")
+			}
+			if !strings.Contains(result.Error, tt.wantError) {
+				t.Errorf("Expected error to report %q, got %q", tt.wantError, result.Error)
+			}
+		})
+	}
+}
+
+func TestCleansingService_DB_VerifiesCascade_Complete(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+
+	result, err := newDBCleansingService(db, &config.Config{}).DeleteContractorFiles(context.Background(), testutil.ContractorID)
+	if err != nil {
+		t.Fatalf("DeleteContractorFiles() unexpected error: %v", err)
+	}
+	if !result.Success || result.Error != "" {
+		t.Errorf("Expected success without error, got %+v", result)
+	}
+}
+
+// failingDeleteTxManager runs transactions whose contractor repository fails to delete
+type failingDeleteTxManager struct {
+	repository.TxManager
+}
+
+type failingDeleteContractorRepository struct {
+	repository.ContractorRepository
+}
+
+func (r *failingDeleteContractorRepository) Delete(ctx context.Context, id int64) error {
+	return errors.New("lock wait timeout")
+}
+
+func (m *failingDeleteTxManager) WithinTransaction(ctx context.Context, fn func(repos repository.Repositories) error) error {
+	return m.TxManager.WithinTransaction(ctx, func(repos repository.Repositories) error {
+		repos.Contractors = &failingDeleteContractorRepository{repos.Contractors}
+		return fn(repos)
+	})
+}
+
+func TestCleansingService_DB_ContractorDeleteRollsBackAssociations(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	users := []entity.UserContractor{{Id: 1, ContractorId: testutil.ContractorID, UserId: 5}, {Id: 2, ContractorId: testutil.ContractorID, UserId: 6}}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatalf("failed to seed user_contractor: %v", err)
+	}
+
+	service := NewCleansingServiceWithConfig(&config.Config{}, &NullS3Service{},
+		repository.NewContractorRepository(db),
+		repository.NewUserContractorRepository(db),
+		repository.NewViewerContractorRepository(db),
+		repository.NewContractorProjectRepository(db),
+		repository.NewProjectRepository(db),
+		repository.NewSiteRepository(db),
+		repository.NewDocumentGroupRepository(db),
+		repository.NewDocumentRepository(db),
+		repository.NewFileRepository(db),
+		repository.NewUploaderContractorUsageRepository(db),
+		&failingDeleteTxManager{repository.NewTxManager(db)},
+		nil,
+	)
+
+	result, err := service.DeleteContractorFiles(context.Background(), testutil.ContractorID)
+	if err == nil || result.Success {
+		t.Fatalf("Expected the contractor deletion to fail, got %+v", result)
+	}
+	if !strings.Contains(result.Error, "failed to delete contractor record") {
+		t.Errorf("Expected the contractor delete failure to be reported, got %q", result.Error)
+	}
+
+	// The association records deleted in the same transaction are back
+	if got := countRows(t, db, &entity.Contractor{}, "id = ?", testutil.ContractorID); got != 1 {
+		t.Errorf("Expected contractor %d to be kept, found %d", testutil.ContractorID, got)
+	}
+	if got := countRows(t, db, &entity.UserContractor{}, "contractor_id = ?", testutil.ContractorID); got != 2 {
+		t.Errorf("Expected the contractor's 2 users to be rolled back, found %d", got)
+	}
+}
+
+func TestCleansingService_DB_ProjectContractor(t *testing.T) {
+	tests := []struct {
+		name    string
+		project int64
+		prepare func(t *testing.T, db *gorm.DB)
+		wantErr bool
+	}{
+		{name: "present", project: testutil.ProjectID},
+		{
+			name:    "dangling contractor",
+			project: testutil.ProjectID,
+			prepare: func(t *testing.T, db *gorm.DB) {
+				if err := db.Delete(&entity.Contractor{}, testutil.ContractorID).Error; err != nil {
+					t.Fatalf("failed to delete contractor: %v", err)
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name:    "no contractor",
+			project: testutil.SecondProjectID,
+			prepare: func(t *testing.T, db *gorm.DB) {
+				if err := db.Where("project_id = ?", testutil.SecondProjectID).Delete(&entity.ContractorProject{}).Error; err != nil {
+					t.Fatalf("failed to delete contractor_project: %v", err)
+				}
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		// A partial cleanse builds the project's keys as well
+		for _, scope := range []string{dto.ScopeAll, dto.ScopeRaw} {
+			t.Run(tt.name+"/"+scope, func(t *testing.T) {
+				db := testutil.NewMigratedDB(t)
+				testutil.SeedTree(t, db)
+				if tt.prepare != nil {
+					tt.prepare(t, db)
+				}
+
+				service := newDBCleansingService(db, &config.Config{})
+				result, err := service.ProcessCleansingMessage(context.Background(), dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: tt.project, Scope: scope})
+				if !tt.wantErr {
+					if err != nil || !result.Success {
+						t.Fatalf("Expected success, got %+v, %v", result, err)
+					}
+					return
+				}
+
+				if !errors.Is(err, ErrContractorNotFound) {
+					t.Fatalf("Expected ErrContractorNotFound, got %v", err)
+				}
+				if result.Success || !strings.Contains(result.Error, "owning contractor not found") {
+					t.Errorf("Expected a failed result naming the missing contractor, got %+v", result)
+				}
+				if got := countRows(t, db, &entity.Project{}, "id = ?", tt.project); got != 1 {
+					t.Errorf("Expected project %d to be kept, found %d", tt.project, got)
+				}
+			})
+		}
+	}
+}
+
+func TestCleansingService_DB_InactiveGroupsInDeletionContext(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	// Group 1000 holds the two sonar line files of site 100
+	if err := db.Model(&entity.DocumentGroup{}).Where("id = ?", 1000).Update("status", entity.DocumentGroupStatusInactive).Error; err != nil {
+		t.Fatalf("Failed to deactivate group: %v", err)
+	}
+	s3Service := NewS3Service(&mockS3Client{}, aws.Config{}, &config.Config{}, newDBFileService(db))
+	service := NewCleansingService(s3Service,
+		repository.NewContractorRepository(db),
+		repository.NewUserContractorRepository(db),
+		repository.NewViewerContractorRepository(db),
+		repository.NewContractorProjectRepository(db),
+		repository.NewProjectRepository(db),
+		repository.NewSiteRepository(db),
+		repository.NewDocumentGroupRepository(db),
+		repository.NewDocumentRepository(db),
+		repository.NewFileRepository(db),
+		repository.NewUploaderContractorUsageRepository(db),
+	)
+
+	tests := []struct {
+		name        string
+		message     dto.CleansingMessage
+		wantSonar   bool
+		wantObjects int
+	}{
+		// A full cleanse deletes the rows of inactive groups too, so their 2 sonar files must go with them:
+		// 2 sonar files + 1 depth upload + 4 processed outputs for site 100, 1 photo for site 101
+		{name: "project includes inactive groups", message: dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: testutil.ProjectID}, wantSonar: true, wantObjects: 8},
+		{name: "site includes inactive groups", message: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: testutil.SiteID}, wantSonar: true, wantObjects: 7},
+		// A partial cleanse keeps every row, and inactive groups are left alone: only the depth upload
+		{name: "partial site cleanse skips inactive groups", message: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: testutil.SiteID, Scope: dto.ScopeRaw}, wantObjects: 1},
+		{name: "contractor purge includes inactive groups", message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: testutil.ContractorID}, wantSonar: true, wantObjects: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deletionContext, err := service.BuildDeletionContext(context.Background(), tt.message)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(deletionContext.S3Objects) != tt.wantObjects {
+				t.Errorf("Expected %d objects, got %d", tt.wantObjects, len(deletionContext.S3Objects))
+			}
+
+			var sonar bool
+			for _, obj := range deletionContext.S3Objects {
+				if strings.Contains(obj.Key, "/line1/") {
+					sonar = true
+				}
+			}
+			if sonar != tt.wantSonar {
+				t.Errorf("Expected inactive group files included = %v, got %v", tt.wantSonar, sonar)
+			}
+		})
+	}
+}
+
+// failingDocumentFileRepository fails to read the files of failDocumentID, alone or in a bulk read
+type failingDocumentFileRepository struct {
+	repository.FileRepository
+	failDocumentID int64
+}
+
+func (r *failingDocumentFileRepository) GetByDocumentID(ctx context.Context, documentID, createdAfter, createdBefore int64) (entity.Files, error) {
+	if documentID == r.failDocumentID {
+		return nil, errors.New("connection reset")
+	}
+	return r.FileRepository.GetByDocumentID(ctx, documentID, createdAfter, createdBefore)
+}
+
+func (r *failingDocumentFileRepository) GetByDocumentIDs(ctx context.Context, documentIDs []int64, createdAfter, createdBefore int64) (entity.Files, error) {
+	for _, documentID := range documentIDs {
+		if documentID == r.failDocumentID {
+			return nil, errors.New("connection reset")
+		}
+	}
+	return r.FileRepository.GetByDocumentIDs(ctx, documentIDs, createdAfter, createdBefore)
+}
+
+func TestCleansingService_DB_IncompleteTraversal(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+
+	client := &mockS3Client{}
+	// Document 5000 holds the two sonar line files of site 100
+	fileService := NewFileService(
+		repository.NewContractorRepository(db),
+		repository.NewContractorProjectRepository(db),
+		repository.NewProjectRepository(db),
+		repository.NewSiteRepository(db),
+		repository.NewDocumentGroupRepository(db),
+		repository.NewDocumentRepository(db),
+		&failingDocumentFileRepository{FileRepository: repository.NewFileRepository(db), failDocumentID: 5000},
+		repository.NewDocumentProcessRepository(db),
+		&config.Config{},
+	)
+	service := newDBCleansingServiceWithS3(db, &config.Config{}, NewS3Service(client, aws.Config{}, &config.Config{}, fileService))
+
+	tests := []struct {
+		name    string
+		message dto.CleansingMessage
+	}{
+		{name: "project", message: dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: testutil.ProjectID}},
+		{name: "site", message: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: testutil.SiteID}},
+		{name: "contractor", message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: testutil.ContractorID}},
+		{name: "category", message: dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: testutil.ProjectID, Category: "SSS"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := service.ProcessCleansingMessage(context.Background(), tt.message)
+			if !errors.Is(err, ErrIncompleteTraversal) {
+				t.Fatalf("Expected ErrIncompleteTraversal, got %v", err)
+			}
+			if result == nil || result.Success {
+				t.Errorf("Expected an unsuccessful result, got %+v", result)
+			}
+		})
+	}
+
+	// Nothing is deleted from a partial key set, so a retry still finds every record
+	if len(client.deletedKeys) != 0 {
+		t.Errorf("Expected no deleted keys, got %v", client.deletedKeys)
+	}
+	if count := countRows(t, db, &entity.Project{}, "id = ?", testutil.ProjectID); count != 1 {
+		t.Errorf("Expected project %d to remain, got %d rows", testutil.ProjectID, count)
+	}
+	if count := countRows(t, db, &entity.File{}, "document_id = ?", 5000); count != 2 {
+		t.Errorf("Expected the files of document 5000 to remain, got %d rows", count)
+	}
+}
+
+func TestCleansingService_DB_Summary(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+
+	s3s := NewS3Service(&mockS3Client{}, aws.Config{}, &config.Config{}, newDBFileService(db)).(*S3ServiceImpl)
+	s3s.regionClients[testutil.Region] = &mockS3Client{}
+	service := newDBCleansingServiceWithS3(db, &config.Config{}, s3s)
+
+	result, err := service.ProcessCleansingMessage(context.Background(), dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: testutil.ProjectID})
+	if err != nil {
+		t.Fatalf("ProcessCleansingMessage() unexpected error: %v", err)
+	}
+
+	// Two sonar lines, a raster with its four processed outputs and one image
+	want := map[string]map[string]int{testutil.Bucket: {"SSS": 2, "RasterD": 5, "Image": 1}}
+	if !reflect.DeepEqual(result.Summary, want) {
+		t.Errorf("Expected summary %v, got %v", want, result.Summary)
+	}
+}
+
+func TestCleansingService_DB_ExtraBuckets(t *testing.T) {
+	tests := []struct {
+		name         string
+		message      dto.CleansingMessage
+		deleteErrs   map[string]error
+		wantDeleted  []string
+		wantEmptied  []string
+		wantOutcomes []dto.BucketOutcome
+	}{
+		{
+			name:        "buckets are deleted",
+			message:     dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: testutil.ContractorID},
+			wantDeleted: []string{testutil.Bucket, "archive-bucket"},
+			wantOutcomes: []dto.BucketOutcome{
+				{Bucket: testutil.Bucket, Outcome: dto.BucketOutcomeDeleted},
+				{Bucket: "archive-bucket", Outcome: dto.BucketOutcomeDeleted},
+				{Bucket: "gone-bucket", Outcome: dto.BucketOutcomeMissing},
+				{Bucket: testutil.OtherBucket, Outcome: dto.BucketOutcomeShared},
+			},
+		},
+		{
+			name:        "preserved contractor keeps emptied buckets",
+			message:     dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: testutil.ContractorID, PreserveEntity: true},
+			wantEmptied: []string{testutil.Bucket, "archive-bucket"},
+			wantOutcomes: []dto.BucketOutcome{
+				{Bucket: testutil.Bucket, Outcome: dto.BucketOutcomeEmptied},
+				{Bucket: "archive-bucket", Outcome: dto.BucketOutcomeEmptied},
+				{Bucket: "gone-bucket", Outcome: dto.BucketOutcomeMissing},
+				{Bucket: testutil.OtherBucket, Outcome: dto.BucketOutcomeShared},
+			},
+		},
+		{
+			// The main bucket is already gone, so a refused extra bucket must not orphan the contractor's records
+			name:        "refused bucket is kept and records are still deleted",
+			message:     dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: testutil.ContractorID},
+			deleteErrs:  map[string]error{"archive-bucket": ErrObjectLimitExceeded},
+			wantDeleted: []string{testutil.Bucket},
+			wantOutcomes: []dto.BucketOutcome{
+				{Bucket: testutil.Bucket, Outcome: dto.BucketOutcomeDeleted},
+				{Bucket: "archive-bucket", Outcome: dto.BucketOutcomeFailed, Error: ErrObjectLimitExceeded.Error()},
+				{Bucket: "gone-bucket", Outcome: dto.BucketOutcomeMissing},
+				{Bucket: testutil.OtherBucket, Outcome: dto.BucketOutcomeShared},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewMigratedDB(t)
+			testutil.SeedTree(t, db)
+			// The other contractor's bucket is listed too, and must be left to it
+			extraBuckets := " archive-bucket,gone-bucket, " + testutil.OtherBucket
+			if err := db.Model(&entity.Contractor{}).Where("id = ?", testutil.ContractorID).Update("aws_extra_buckets", extraBuckets).Error; err != nil {
+				t.Fatalf("Failed to set extra buckets: %v", err)
+			}
+
+			s3Service := &mockS3Service{missingBuckets: []string{"gone-bucket"}, deleteBucketErrs: tt.deleteErrs}
+			service := newDBCleansingServiceWithS3(db, &config.Config{}, s3Service)
+
+			result, err := service.ProcessCleansingMessage(context.Background(), tt.message)
+			if err != nil {
+				t.Fatalf("ProcessCleansingMessage() unexpected error: %v", err)
+			}
+			if !result.Success {
+				t.Errorf("Expected success, got %+v", result)
+			}
+			if !reflect.DeepEqual(s3Service.deletedBuckets, tt.wantDeleted) {
+				t.Errorf("Expected deleted buckets %v, got %v", tt.wantDeleted, s3Service.deletedBuckets)
+			}
+			if !reflect.DeepEqual(s3Service.emptiedBuckets, tt.wantEmptied) {
+				t.Errorf("Expected emptied buckets %v, got %v", tt.wantEmptied, s3Service.emptiedBuckets)
+			}
+			if !reflect.DeepEqual(result.Buckets, tt.wantOutcomes) {
+				t.Errorf("Expected bucket outcomes %+v, got %+v", tt.wantOutcomes, result.Buckets)
+			}
+
+			var contractors int64
+			db.Model(&entity.Contractor{}).Where("id = ?", testutil.ContractorID).Count(&contractors)
+			wantContractors := int64(0)
+			if tt.message.PreserveEntity {
+				wantContractors = 1
+			}
+			if contractors != wantContractors {
+				t.Errorf("Expected %d contractor records, got %d", wantContractors, contractors)
+			}
+		})
+	}
+}
@@ -2,24 +2,57 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
 	"github.com/denys89/wadugs-worker-cleansing/src/dto"
 	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/repository"
 )
 
 // Mock contractor repository for testing
-type mockContractorRepository struct{}
+type mockContractorRepository struct {
+	statusUpdates  map[int64]int8
+	deleted        []int64
+	bucketSharedBy int64  // Returned by CountByBucketName
+	countErr       error  // Returned by CountByBucketName when set
+	bucketErr      error  // Returned by GetByBucketName when set
+	bucketName     string // Returned by GetByID as the contractor's bucket instead of test-bucket when set
+}
 
 func (m *mockContractorRepository) GetByID(ctx context.Context, id int64) (*entity.Contractor, error) {
+	bucketName := "test-bucket"
+	if m.bucketName != "" {
+		bucketName = m.bucketName
+	}
 	return &entity.Contractor{
 		Id:            id,
 		Name:          "Test Contractor",
-		AwsBucketName: "test-bucket",
+		AwsBucketName: bucketName,
 	}, nil
 }
 
+func (m *mockContractorRepository) GetByIDs(ctx context.Context, ids []int64) (entity.Contractors, error) {
+	contractors := make(entity.Contractors, 0, len(ids))
+	for _, id := range ids {
+		contractor, _ := m.GetByID(ctx, id)
+		contractors = append(contractors, *contractor)
+	}
+	return contractors, nil
+}
+
 func (m *mockContractorRepository) Delete(ctx context.Context, id int64) error {
+	m.deleted = append(m.deleted, id)
 	return nil
 }
 
@@ -31,14 +64,40 @@ func (m *mockContractorRepository) Update(ctx context.Context, contractor *entit
 	return nil
 }
 
+func (m *mockContractorRepository) SetStatus(ctx context.Context, id int64, status int8) error {
+	if m.statusUpdates == nil {
+		m.statusUpdates = make(map[int64]int8)
+	}
+	m.statusUpdates[id] = status
+	return nil
+}
+
 func (m *mockContractorRepository) GetAll(ctx context.Context) (entity.Contractors, error) {
 	return entity.Contractors{}, nil
 }
 
+func (m *mockContractorRepository) GetAllPaged(ctx context.Context, limit, lastID int64) (entity.Contractors, error) {
+	return entity.Contractors{}, nil
+}
+
 func (m *mockContractorRepository) GetByStatus(ctx context.Context, status int8) (entity.Contractors, error) {
 	return entity.Contractors{}, nil
 }
 
+func (m *mockContractorRepository) CountByBucketName(ctx context.Context, bucketName string) (int64, error) {
+	if m.countErr != nil {
+		return 0, m.countErr
+	}
+	return m.bucketSharedBy, nil
+}
+
+func (m *mockContractorRepository) GetByBucketName(ctx context.Context, bucketName string) (*entity.Contractor, error) {
+	if m.bucketErr != nil {
+		return nil, m.bucketErr
+	}
+	return &entity.Contractor{Id: 1, AwsBucketName: bucketName, AwsBucketRegion: "ap-southeast-1"}, nil
+}
+
 // Mock user_contractor repository for testing
 type mockUserContractorRepository struct{}
 
@@ -75,6 +134,7 @@ func (m *mockProjectRepository) GetByID(ctx context.Context, id int64) (*entity.
 	return &entity.Project{
 		Id:   id,
 		Name: "Test Project",
+		Code: "PRJ",
 	}, nil
 }
 
@@ -82,7 +142,11 @@ func (m *mockProjectRepository) GetAll(ctx context.Context) (entity.Projects, er
 	return entity.Projects{}, nil
 }
 
-func (m *mockProjectRepository) GetByContractorID(ctx context.Context, contractorID int64) (entity.Projects, error) {
+func (m *mockProjectRepository) GetAllPaged(ctx context.Context, limit, lastID int64) (entity.Projects, error) {
+	return entity.Projects{}, nil
+}
+
+func (m *mockProjectRepository) GetByContractorID(ctx context.Context, contractorID int64, includeDeleted bool) (entity.Projects, error) {
 	return entity.Projects{}, nil
 }
 
@@ -90,6 +154,14 @@ func (m *mockProjectRepository) GetByStatus(ctx context.Context, status int8) (e
 	return entity.Projects{}, nil
 }
 
+func (m *mockProjectRepository) Update(ctx context.Context, project *entity.Project) error {
+	return nil
+}
+
+func (m *mockProjectRepository) ResetFileSizeUsage(ctx context.Context, projectID int64) error {
+	return nil
+}
+
 func (m *mockProjectRepository) UpdateProjectUsage(ctx context.Context, projectID int64, sizeDelta int64) error {
 	return nil
 }
@@ -106,6 +178,16 @@ func (m *mockProjectRepository) CleanupProjectAssociations(ctx context.Context,
 	return nil
 }
 
+// Mock uploader_contractor_usage repository for testing
+type mockUploaderContractorUsageRepository struct {
+	resetProjectIDs []int64
+}
+
+func (m *mockUploaderContractorUsageRepository) ResetByProjectID(ctx context.Context, projectID int64) error {
+	m.resetProjectIDs = append(m.resetProjectIDs, projectID)
+	return nil
+}
+
 // Mock site repository for testing
 type mockSiteRepository struct{}
 
@@ -113,6 +195,7 @@ func (m *mockSiteRepository) GetByID(ctx context.Context, id int64) (*entity.Sit
 	return &entity.Site{
 		Id:        id,
 		Name:      "Test Site",
+		Code:      "SITE",
 		ProjectId: 1,
 	}, nil
 }
@@ -121,6 +204,10 @@ func (m *mockSiteRepository) GetAll(ctx context.Context) (entity.Sites, error) {
 	return entity.Sites{}, nil
 }
 
+func (m *mockSiteRepository) GetAllPaged(ctx context.Context, limit, lastID int64) (entity.Sites, error) {
+	return entity.Sites{}, nil
+}
+
 func (m *mockSiteRepository) GetByProjectID(ctx context.Context, projectID int64) (entity.Sites, error) {
 	return entity.Sites{}, nil
 }
@@ -133,10 +220,18 @@ func (m *mockSiteRepository) HardDelete(ctx context.Context, id int64) error {
 	return nil
 }
 
+func (m *mockSiteRepository) HardDeleteCascade(ctx context.Context, id int64) error {
+	return nil
+}
+
 func (m *mockSiteRepository) HardDeleteByProjectID(ctx context.Context, projectID int64) error {
 	return nil
 }
 
+func (m *mockSiteRepository) CountByProjectID(ctx context.Context, projectID int64) (int64, error) {
+	return 0, nil
+}
+
 // Mock document group repository for testing
 type mockDocumentGroupRepository struct{}
 
@@ -148,6 +243,10 @@ func (m *mockDocumentGroupRepository) GetAll(ctx context.Context) (entity.Docume
 	return entity.DocumentGroups{}, nil
 }
 
+func (m *mockDocumentGroupRepository) GetAllPaged(ctx context.Context, limit, lastID int64) (entity.DocumentGroups, error) {
+	return entity.DocumentGroups{}, nil
+}
+
 func (m *mockDocumentGroupRepository) GetBySiteID(ctx context.Context, siteID int64) (entity.DocumentGroups, error) {
 	return entity.DocumentGroups{}, nil
 }
@@ -160,10 +259,18 @@ func (m *mockDocumentGroupRepository) GetByProgress(ctx context.Context, progres
 	return entity.DocumentGroups{}, nil
 }
 
+func (m *mockDocumentGroupRepository) HardDeleteContents(ctx context.Context, groupID int64) error {
+	return nil
+}
+
 func (m *mockDocumentGroupRepository) HardDeleteBySiteID(ctx context.Context, siteID int64) error {
 	return nil
 }
 
+func (m *mockDocumentGroupRepository) CountBySiteID(ctx context.Context, siteID int64) (int64, error) {
+	return 0, nil
+}
+
 // Mock document repository for testing
 type mockDocumentRepository struct{}
 
@@ -175,10 +282,18 @@ func (m *mockDocumentRepository) GetAll(ctx context.Context) (entity.Documents,
 	return entity.Documents{}, nil
 }
 
+func (m *mockDocumentRepository) GetAllPaged(ctx context.Context, limit, lastID int64) (entity.Documents, error) {
+	return entity.Documents{}, nil
+}
+
 func (m *mockDocumentRepository) GetByGroupID(ctx context.Context, groupID int64) (entity.Documents, error) {
 	return entity.Documents{}, nil
 }
 
+func (m *mockDocumentRepository) GetByGroupIDs(ctx context.Context, groupIDs []int64) (entity.Documents, error) {
+	return entity.Documents{}, nil
+}
+
 func (m *mockDocumentRepository) GetByStatus(ctx context.Context, status int8) (entity.Documents, error) {
 	return entity.Documents{}, nil
 }
@@ -187,6 +302,18 @@ func (m *mockDocumentRepository) HardDeleteBySiteID(ctx context.Context, siteID
 	return nil
 }
 
+func (m *mockDocumentRepository) HardDeleteByGroupID(ctx context.Context, groupID int64) error {
+	return nil
+}
+
+func (m *mockDocumentRepository) HardDeleteByGroupIDs(ctx context.Context, groupIDs []int64) error {
+	return nil
+}
+
+func (m *mockDocumentRepository) CountByGroupIDs(ctx context.Context, groupIDs []int64) (int64, error) {
+	return 0, nil
+}
+
 // Mock file repository for testing
 type mockFileRepository struct{}
 
@@ -198,7 +325,15 @@ func (m *mockFileRepository) GetAll(ctx context.Context) (entity.Files, error) {
 	return entity.Files{}, nil
 }
 
-func (m *mockFileRepository) GetByDocumentID(ctx context.Context, documentID int64) (entity.Files, error) {
+func (m *mockFileRepository) GetAllPaged(ctx context.Context, limit, lastID int64) (entity.Files, error) {
+	return entity.Files{}, nil
+}
+
+func (m *mockFileRepository) GetByDocumentID(ctx context.Context, documentID, createdAfter, createdBefore int64) (entity.Files, error) {
+	return entity.Files{}, nil
+}
+
+func (m *mockFileRepository) GetByDocumentIDs(ctx context.Context, documentIDs []int64, createdAfter, createdBefore int64) (entity.Files, error) {
 	return entity.Files{}, nil
 }
 
@@ -210,6 +345,153 @@ func (m *mockFileRepository) HardDeleteBySiteID(ctx context.Context, siteID int6
 	return nil
 }
 
+func (m *mockFileRepository) HardDeleteByGroupIDs(ctx context.Context, groupIDs []int64) error {
+	return nil
+}
+
+func (m *mockFileRepository) CountByDocumentIDs(ctx context.Context, documentIDs []int64) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockFileRepository) CountByProjectID(ctx context.Context, projectID int64) (int64, int64, error) {
+	return 0, 0, nil
+}
+
+func (m *mockFileRepository) CountBySiteID(ctx context.Context, siteID int64) (int64, int64, error) {
+	return 0, 0, nil
+}
+
+// Mock S3 service that returns fixed objects per entity type and records deletions
+type mockS3Service struct {
+	NullS3Service
+	contractorObjects []dto.S3Object
+	projectObjects    []dto.S3Object
+	siteObjects       []dto.S3Object
+	deleted           []dto.S3Object
+	isProtected       ObjectFilter
+	bucketMissing     bool     // BucketExists reports the bucket as missing
+	missingBuckets    []string // BucketExists reports these buckets as missing
+	bucketErr         error    // Returned by BucketExists when set
+	deletedBuckets    []string
+	emptiedBuckets    []string
+	deleteBucketErr   error            // Returned by DeleteBucket when set
+	deleteBucketErrs  map[string]error // Returned by DeleteBucket for the bucket it is keyed by
+	ownerErr          error            // Returned by VerifyBucketOwner when set
+	verifiedBuckets   []string
+	quarantined       []dto.S3Object
+	expiredBuckets    []string
+	expireErr         error // Returned by ExpireBucket when set
+	bucketNotEmpty    bool  // DeleteExpiredBucket reports the bucket as not yet empty
+	putKeys           []string
+	putBodies         [][]byte
+	putErr            error // Returned by PutObject when set
+
+	getObjects map[string]string // Bodies returned by GetObject, keyed by bucket/key; other keys do not exist
+}
+
+func (m *mockS3Service) PutObject(ctx context.Context, bucket, key string, body []byte, contentType string) error {
+	if m.putErr != nil {
+		return m.putErr
+	}
+	m.putKeys = append(m.putKeys, bucket+"/"+key)
+	m.putBodies = append(m.putBodies, body)
+	return nil
+}
+
+func (m *mockS3Service) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	body, ok := m.getObjects[bucket+"/"+key]
+	if !ok {
+		return nil, fmt.Errorf("failed to get s3://%s/%s: %w", bucket, key, &types.NoSuchKey{})
+	}
+	return io.NopCloser(strings.NewReader(body)), nil
+}
+
+func (m *mockS3Service) ExpireBucket(ctx context.Context, bucket, region string, contractorID int64) error {
+	if m.expireErr != nil {
+		return m.expireErr
+	}
+	m.expiredBuckets = append(m.expiredBuckets, bucket)
+	return nil
+}
+
+func (m *mockS3Service) DeleteExpiredBucket(ctx context.Context, bucket, region string, contractorID int64) (bool, error) {
+	if m.bucketNotEmpty {
+		return false, nil
+	}
+	m.deletedBuckets = append(m.deletedBuckets, bucket)
+	return true, nil
+}
+
+func (m *mockS3Service) QuarantineObjects(ctx context.Context, objects []dto.S3Object) (int, error) {
+	m.quarantined = append(m.quarantined, objects...)
+	return len(objects), nil
+}
+
+func (m *mockS3Service) EmptyBucket(ctx context.Context, bucket, region string, contractorID int64) error {
+	m.emptiedBuckets = append(m.emptiedBuckets, bucket)
+	return nil
+}
+
+func (m *mockS3Service) VerifyBucketOwner(ctx context.Context, bucket, region string, contractorID int64) error {
+	m.verifiedBuckets = append(m.verifiedBuckets, bucket)
+	return m.ownerErr
+}
+
+func (m *mockS3Service) DeleteBucket(ctx context.Context, bucket, region string, contractorID int64) error {
+	if m.deleteBucketErr != nil {
+		return m.deleteBucketErr
+	}
+	if err := m.deleteBucketErrs[bucket]; err != nil {
+		return err
+	}
+	m.deletedBuckets = append(m.deletedBuckets, bucket)
+	return nil
+}
+
+func (m *mockS3Service) BucketExists(ctx context.Context, bucket, region string) (bool, error) {
+	if m.bucketErr != nil {
+		return false, m.bucketErr
+	}
+	return !m.bucketMissing && !slices.Contains(m.missingBuckets, bucket), nil
+}
+
+func (m *mockS3Service) ListContractorFiles(ctx context.Context, contractorID int64, opts ...FileOption) ([]dto.S3Object, error) {
+	return m.contractorObjects, nil
+}
+
+func (m *mockS3Service) ListProjectFiles(ctx context.Context, projectID int64, opts ...FileOption) ([]dto.S3Object, error) {
+	return m.projectObjects, nil
+}
+
+func (m *mockS3Service) ListSiteFiles(ctx context.Context, siteID int64, opts ...FileOption) ([]dto.S3Object, error) {
+	return m.siteObjects, nil
+}
+
+func (m *mockS3Service) FilterProtected(objects []dto.S3Object) (deletable, protected []dto.S3Object) {
+	for _, obj := range objects {
+		if m.isProtected != nil && m.isProtected(obj) {
+			protected = append(protected, obj)
+			continue
+		}
+		deletable = append(deletable, obj)
+	}
+	return deletable, protected
+}
+
+func (m *mockS3Service) DeleteObjects(ctx context.Context, objects []dto.S3Object) (int, error) {
+	results, err := m.DeleteObjectsByBucket(ctx, objects)
+	return TotalDeleted(results), err
+}
+
+func (m *mockS3Service) DeleteObjectsByBucket(ctx context.Context, objects []dto.S3Object) ([]dto.BucketDeleteResult, error) {
+	m.deleted = append(m.deleted, objects...)
+	return deletedByBucket(objects), nil
+}
+
+func newTestCleansingService(s3Service S3Service) CleansingService {
+	return NewCleansingService(s3Service, &mockContractorRepository{}, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{}, &mockProjectRepository{}, &mockSiteRepository{}, &mockDocumentGroupRepository{}, &mockDocumentRepository{}, &mockFileRepository{}, &mockUploaderContractorUsageRepository{})
+}
+
 func TestCleansingService_ProcessCleansingMessage(t *testing.T) {
 	s3Service := NewNullS3Service()
 	contractorRepo := &mockContractorRepository{}
@@ -221,7 +503,7 @@ func TestCleansingService_ProcessCleansingMessage(t *testing.T) {
 	docGroupRepo := &mockDocumentGroupRepository{}
 	docRepo := &mockDocumentRepository{}
 	fileRepo := &mockFileRepository{}
-	service := NewCleansingService(s3Service, contractorRepo, userContractorRepo, viewerContractorRepo, contractorProjectRepo, projectRepo, siteRepo, docGroupRepo, docRepo, fileRepo)
+	service := NewCleansingService(s3Service, contractorRepo, userContractorRepo, viewerContractorRepo, contractorProjectRepo, projectRepo, siteRepo, docGroupRepo, docRepo, fileRepo, &mockUploaderContractorUsageRepository{})
 
 	tests := []struct {
 		name    string
@@ -322,7 +604,159 @@ func TestNullCleansingService_ProcessCleansingMessage(t *testing.T) {
 	}
 }
 
+func TestCleansingService_DeleteContractorFiles_MarksInactive(t *testing.T) {
+	contractorRepo := &mockContractorRepository{}
+	service := NewCleansingService(NewNullS3Service(), contractorRepo, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{}, &mockProjectRepository{}, &mockSiteRepository{}, &mockDocumentGroupRepository{}, &mockDocumentRepository{}, &mockFileRepository{}, &mockUploaderContractorUsageRepository{})
+
+	result, err := service.DeleteContractorFiles(context.Background(), 42)
+	if err != nil {
+		t.Fatalf("DeleteContractorFiles() unexpected error: %v", err)
+	}
+	if !result.Success {
+		t.Errorf("DeleteContractorFiles() expected successful result")
+	}
+
+	status, ok := contractorRepo.statusUpdates[42]
+	if !ok {
+		t.Fatal("Expected contractor status to be updated before cleansing")
+	}
+	if status != entity.ContractorStatusInactive {
+		t.Errorf("Expected contractor status %d, got %d", entity.ContractorStatusInactive, status)
+	}
+}
+
+func TestCleansingService_BuildDeletionContext(t *testing.T) {
+	s3Service := &mockS3Service{
+		contractorObjects: []dto.S3Object{{Bucket: "b", Key: "P1/S1/00_Upload/c.txt"}, {Bucket: "b", Key: "P2/S2/00_Upload/c.txt"}},
+		projectObjects:    []dto.S3Object{{Bucket: "b", Key: "P1/S1/00_Upload/p.txt"}},
+		siteObjects:       []dto.S3Object{{Bucket: "b", Key: "P1/S1/00_Upload/s.txt"}, {Bucket: "b", Key: "P1/S1/01_Processed/s.geojson"}, {Bucket: "b", Key: "P1/S1/00_Upload/t.txt"}},
+	}
+	service := newTestCleansingService(s3Service)
+
+	tests := []struct {
+		name    string
+		message dto.CleansingMessage
+		want    []dto.S3Object
+	}{
+		{
+			name:    "Contractor",
+			message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 1},
+			want:    s3Service.contractorObjects,
+		},
+		{
+			name:    "Project",
+			message: dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: 2},
+			want:    s3Service.projectObjects,
+		},
+		{
+			name:    "Site",
+			message: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: 3},
+			want:    s3Service.siteObjects,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deletionContext, err := service.BuildDeletionContext(context.Background(), tt.message)
+			if err != nil {
+				t.Fatalf("BuildDeletionContext() unexpected error: %v", err)
+			}
+			if deletionContext.Type != tt.message.Type || deletionContext.ID != tt.message.ID {
+				t.Errorf("Expected type %q id %d, got type %q id %d", tt.message.Type, tt.message.ID, deletionContext.Type, deletionContext.ID)
+			}
+			if deletionContext.Description != tt.message.GetDescription() {
+				t.Errorf("Expected description %q, got %q", tt.message.GetDescription(), deletionContext.Description)
+			}
+			if len(deletionContext.S3Objects) != len(tt.want) {
+				t.Fatalf("Expected %d objects, got %d", len(tt.want), len(deletionContext.S3Objects))
+			}
+			for i, obj := range tt.want {
+				if deletionContext.S3Objects[i] != obj {
+					t.Errorf("Object %d: expected %+v, got %+v", i, obj, deletionContext.S3Objects[i])
+				}
+			}
+		})
+	}
+
+	if _, err := service.BuildDeletionContext(context.Background(), dto.CleansingMessage{Type: "invalid", ID: 1}); err == nil {
+		t.Error("Expected error for invalid message type")
+	}
+}
+
+func TestCleansingService_DeleteUsesDeletionContext(t *testing.T) {
+	s3Service := &mockS3Service{
+		siteObjects: []dto.S3Object{{Bucket: "b", Key: "P1/S1/00_Upload/a.txt", Size: 10}, {Bucket: "b", Key: "P1/S1/00_Upload/b.txt", Size: 20}},
+	}
+	service := newTestCleansingService(s3Service)
+
+	result, err := service.DeleteSiteFiles(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("DeleteSiteFiles() unexpected error: %v", err)
+	}
+	if result.FilesDeleted != 2 {
+		t.Errorf("Expected 2 files deleted, got %d", result.FilesDeleted)
+	}
+	if len(s3Service.deleted) != 2 {
+		t.Errorf("Expected the deletion context objects to be deleted, got %+v", s3Service.deleted)
+	}
+}
+
 // Remove the old test methods that don't exist in the interface
+func TestCleansingService_DeleteSiteFiles_SkipsProtected(t *testing.T) {
+	s3Service := &mockS3Service{
+		siteObjects: []dto.S3Object{
+			{Bucket: "b", Key: "P1/S1/00_Upload/s.txt"},
+			{Bucket: "b", Key: "P1/S1/legal_hold/contract.pdf"},
+			{Bucket: "b", Key: "P1/S1/legal_hold/evidence.tif"},
+		},
+		isProtected: ProtectedPrefixFilter([]string{"P1/S1/legal_hold/"}),
+	}
+	service := newTestCleansingService(s3Service)
+
+	result, err := service.DeleteSiteFiles(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.FilesDeleted != 1 {
+		t.Errorf("Expected 1 file deleted, got %d", result.FilesDeleted)
+	}
+	if result.FilesSkipped != 2 {
+		t.Errorf("Expected 2 files skipped, got %d", result.FilesSkipped)
+	}
+	for _, obj := range s3Service.deleted {
+		if strings.HasPrefix(obj.Key, "P1/S1/legal_hold/") {
+			t.Errorf("Protected object %s was deleted", obj.Key)
+		}
+	}
+}
+
+func TestCleansingService_DeleteSiteFiles_SkipsUnsafeKeys(t *testing.T) {
+	s3Service := &mockS3Service{
+		siteObjects: []dto.S3Object{
+			{Bucket: "b", Key: "P1/S1/00_Upload/a.txt"},
+			{Bucket: "b", Key: "P1/S1/00_Upload/"},
+			{Bucket: "b", Key: ""},
+			{Bucket: "b", Key: "P1/S1/00_Upload/b.txt"},
+		},
+		isProtected: func(obj dto.S3Object) bool { return obj.Key == "P1/S1/00_Upload/a.txt" },
+	}
+	service := newTestCleansingService(s3Service)
+
+	result, err := service.DeleteSiteFiles(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// One protected and two unsafe keys are skipped
+	if result.FilesSkipped != 3 {
+		t.Errorf("Expected 3 skipped files, got %d", result.FilesSkipped)
+	}
+	if len(s3Service.deleted) != 1 || s3Service.deleted[0].Key != "P1/S1/00_Upload/b.txt" {
+		t.Errorf("Expected only P1/S1/00_Upload/b.txt to be deleted, got %+v", s3Service.deleted)
+	}
+}
+
 func TestCleansingService_ValidEntityType(t *testing.T) {
 	// This test is no longer needed as validation is done in the DTO
 	t.Skip("Validation moved to DTO layer")
@@ -344,7 +778,7 @@ func TestCleansingService_ErrorHandling(t *testing.T) {
 	docGroupRepo := &mockDocumentGroupRepository{}
 	docRepo := &mockDocumentRepository{}
 	fileRepo := &mockFileRepository{}
-	service := NewCleansingService(s3Service, contractorRepo, userContractorRepo, viewerContractorRepo, contractorProjectRepo, projectRepo, siteRepo, docGroupRepo, docRepo, fileRepo)
+	service := NewCleansingService(s3Service, contractorRepo, userContractorRepo, viewerContractorRepo, contractorProjectRepo, projectRepo, siteRepo, docGroupRepo, docRepo, fileRepo, &mockUploaderContractorUsageRepository{})
 
 	ctx := context.Background()
 
@@ -373,7 +807,7 @@ func BenchmarkCleansingService_ProcessCleansingMessage(b *testing.B) {
 	docGroupRepo := &mockDocumentGroupRepository{}
 	docRepo := &mockDocumentRepository{}
 	fileRepo := &mockFileRepository{}
-	service := NewCleansingService(s3Service, contractorRepo, userContractorRepo, viewerContractorRepo, contractorProjectRepo, projectRepo, siteRepo, docGroupRepo, docRepo, fileRepo)
+	service := NewCleansingService(s3Service, contractorRepo, userContractorRepo, viewerContractorRepo, contractorProjectRepo, projectRepo, siteRepo, docGroupRepo, docRepo, fileRepo, &mockUploaderContractorUsageRepository{})
 	ctx := context.Background()
 	message := dto.CleansingMessage{Type: "contractor", ID: 123}
 
@@ -393,3 +827,895 @@ func BenchmarkNullCleansingService_ProcessCleansingMessage(b *testing.B) {
 		_, _ = service.ProcessCleansingMessage(ctx, message)
 	}
 }
+
+// usageProjectRepository records usage resets and adjustments
+type usageProjectRepository struct {
+	mockProjectRepository
+	resetProjectIDs []int64
+	usageDeltas     []int64
+}
+
+func (m *usageProjectRepository) ResetFileSizeUsage(ctx context.Context, projectID int64) error {
+	m.resetProjectIDs = append(m.resetProjectIDs, projectID)
+	return nil
+}
+
+func (m *usageProjectRepository) UpdateProjectUsage(ctx context.Context, projectID int64, sizeDelta int64) error {
+	m.usageDeltas = append(m.usageDeltas, sizeDelta)
+	return nil
+}
+
+func TestCleansingService_DeleteProjectFiles_ResetsUsage(t *testing.T) {
+	projectRepo := &usageProjectRepository{}
+	usageRepo := &mockUploaderContractorUsageRepository{}
+	s3Service := &mockS3Service{
+		projectObjects: []dto.S3Object{{Bucket: "b", Key: "P1/S1/00_Upload/a.txt", Size: 100}, {Bucket: "b", Key: "P1/S1/00_Upload/b.txt", Size: 50}},
+	}
+	service := NewCleansingService(s3Service, &mockContractorRepository{}, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{}, projectRepo, &mockSiteRepository{}, &mockDocumentGroupRepository{}, &mockDocumentRepository{}, &mockFileRepository{}, usageRepo)
+
+	result, err := service.DeleteProjectFiles(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Success {
+		t.Fatalf("Expected success, got %+v", result)
+	}
+
+	if len(projectRepo.resetProjectIDs) != 1 || projectRepo.resetProjectIDs[0] != 7 {
+		t.Errorf("Expected project 7 usage to be reset, got %v", projectRepo.resetProjectIDs)
+	}
+	if len(projectRepo.usageDeltas) != 0 {
+		t.Errorf("Expected no partial usage adjustments, got %v", projectRepo.usageDeltas)
+	}
+	if len(usageRepo.resetProjectIDs) != 1 || usageRepo.resetProjectIDs[0] != 7 {
+		t.Errorf("Expected uploader usage for project 7 to be reset, got %v", usageRepo.resetProjectIDs)
+	}
+}
+
+// categoryDocumentGroupRepository returns one processed RasterD group and one SSS group for every site
+type categoryDocumentGroupRepository struct {
+	mockDocumentGroupRepository
+}
+
+func (m *categoryDocumentGroupRepository) GetBySiteID(ctx context.Context, siteID int64) (entity.DocumentGroups, error) {
+	return entity.DocumentGroups{
+		{Id: 100, SiteId: siteID, Category: "RasterD", Status: entity.DocumentGroupStatusActive, Progress: 40, ProcessedName: "ortho"},
+		{Id: 200, SiteId: siteID, Category: "SSS", Status: entity.DocumentGroupStatusActive},
+	}, nil
+}
+
+// categoryDocumentRepository returns a single document per group, with ID groupID+1
+type categoryDocumentRepository struct {
+	mockDocumentRepository
+}
+
+func (m *categoryDocumentRepository) GetByGroupID(ctx context.Context, groupID int64) (entity.Documents, error) {
+	return entity.Documents{{Id: groupID + 1}}, nil
+}
+
+// categoryFileRepository returns a single file per document named after the document
+type categoryFileRepository struct {
+	mockFileRepository
+}
+
+func (m *categoryFileRepository) GetByDocumentID(ctx context.Context, documentID, createdAfter, createdBefore int64) (entity.Files, error) {
+	return entity.Files{{Id: documentID, DocumentId: documentID, Name: fmt.Sprintf("doc-%d.ini", documentID)}}, nil
+}
+
+func TestCleansingService_ProcessCleansingMessage_Category(t *testing.T) {
+	tests := []struct {
+		name        string
+		category    string
+		wantDeleted []string
+	}{
+		{
+			name:     "matching category only",
+			category: "RasterD",
+			wantDeleted: []string{
+				"PRJ/SITE/00_Upload/doc-101.ini",
+				"PRJ/SITE/01_Processed/ortho.geojson",
+				"PRJ/SITE/01_Processed/ortho_B01.tif",
+				"PRJ/SITE/01_Processed/ortho_B02.tif",
+				"PRJ/SITE/01_Processed/ortho_B03.tif",
+			},
+		},
+		{
+			name:        "other category",
+			category:    "SSS",
+			wantDeleted: []string{"PRJ/SITE/00_Upload/doc-201.ini"},
+		},
+		{
+			name:        "unknown category deletes nothing",
+			category:    "LineRoute",
+			wantDeleted: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockS3Client{}
+			projectRepo := &fileTreeProjectRepository{}
+			fileService := NewFileService(&mockContractorRepository{}, &mockContractorProjectRepository{}, projectRepo, &fileTreeSiteRepository{},
+				&categoryDocumentGroupRepository{}, &categoryDocumentRepository{}, &categoryFileRepository{}, nil, &config.Config{})
+			s3Service := NewS3Service(client, aws.Config{}, &config.Config{}, fileService)
+			service := NewCleansingService(s3Service, &mockContractorRepository{}, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{},
+				projectRepo, &fileTreeSiteRepository{}, &categoryDocumentGroupRepository{}, &categoryDocumentRepository{}, &categoryFileRepository{}, &mockUploaderContractorUsageRepository{})
+
+			result, err := service.ProcessCleansingMessage(context.Background(), dto.CleansingMessage{Type: "site", ID: 10, Category: tt.category})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !result.Success || result.FilesDeleted != len(tt.wantDeleted) {
+				t.Errorf("Expected success with %d files deleted, got %+v", len(tt.wantDeleted), result)
+			}
+
+			sort.Strings(client.deletedKeys)
+			if len(client.deletedKeys) != len(tt.wantDeleted) {
+				t.Fatalf("Expected deleted keys %v, got %v", tt.wantDeleted, client.deletedKeys)
+			}
+			for i, key := range client.deletedKeys {
+				if key != tt.wantDeleted[i] {
+					t.Errorf("Expected deleted key %s, got %s", tt.wantDeleted[i], key)
+				}
+			}
+		})
+	}
+}
+
+func TestCleansingService_ProcessCleansingMessage_Scope(t *testing.T) {
+	tests := []struct {
+		name        string
+		scope       string
+		category    string
+		wantErr     bool
+		wantDeleted []string
+	}{
+		{
+			name:  "processed outputs only",
+			scope: dto.ScopeProcessed,
+			wantDeleted: []string{
+				"PRJ/SITE/01_Processed/ortho.geojson",
+				"PRJ/SITE/01_Processed/ortho_B01.tif",
+				"PRJ/SITE/01_Processed/ortho_B02.tif",
+				"PRJ/SITE/01_Processed/ortho_B03.tif",
+			},
+		},
+		{
+			name:        "raw uploads only",
+			scope:       dto.ScopeRaw,
+			wantDeleted: []string{"PRJ/SITE/00_Upload/doc-101.ini", "PRJ/SITE/00_Upload/doc-201.ini"},
+		},
+		{
+			name:        "raw uploads of a category",
+			scope:       dto.ScopeRaw,
+			category:    "RasterD",
+			wantDeleted: []string{"PRJ/SITE/00_Upload/doc-101.ini"},
+		},
+		{
+			name:    "invalid scope",
+			scope:   "derived",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockS3Client{}
+			projectRepo := &fileTreeProjectRepository{}
+			fileService := NewFileService(&mockContractorRepository{}, &mockContractorProjectRepository{}, projectRepo, &fileTreeSiteRepository{},
+				&categoryDocumentGroupRepository{}, &categoryDocumentRepository{}, &categoryFileRepository{}, nil, &config.Config{})
+			s3Service := NewS3Service(client, aws.Config{}, &config.Config{}, fileService)
+			service := NewCleansingService(s3Service, &mockContractorRepository{}, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{},
+				projectRepo, &fileTreeSiteRepository{}, &categoryDocumentGroupRepository{}, &categoryDocumentRepository{}, &categoryFileRepository{}, &mockUploaderContractorUsageRepository{})
+
+			result, err := service.ProcessCleansingMessage(context.Background(), dto.CleansingMessage{Type: "site", ID: 10, Scope: tt.scope, Category: tt.category})
+			if tt.wantErr {
+				if err == nil || result.Success {
+					t.Errorf("Expected an invalid scope to be rejected, got %+v", result)
+				}
+				if len(client.deletedKeys) != 0 {
+					t.Errorf("Expected nothing deleted, got %v", client.deletedKeys)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !result.Success || result.FilesDeleted != len(tt.wantDeleted) {
+				t.Errorf("Expected success with %d files deleted, got %+v", len(tt.wantDeleted), result)
+			}
+
+			sort.Strings(client.deletedKeys)
+			if len(client.deletedKeys) != len(tt.wantDeleted) {
+				t.Fatalf("Expected deleted keys %v, got %v", tt.wantDeleted, client.deletedKeys)
+			}
+			for i, key := range client.deletedKeys {
+				if key != tt.wantDeleted[i] {
+					t.Errorf("Expected deleted key %s, got %s", tt.wantDeleted[i], key)
+				}
+			}
+		})
+	}
+}
+
+func TestCleansingService_BuildDeletionContext_EmptyCategoryKeepsAll(t *testing.T) {
+	fileService := NewFileService(&mockContractorRepository{}, &mockContractorProjectRepository{}, &fileTreeProjectRepository{}, &fileTreeSiteRepository{},
+		&categoryDocumentGroupRepository{}, &categoryDocumentRepository{}, &categoryFileRepository{}, nil, &config.Config{})
+	s3Service := NewS3Service(&mockS3Client{}, aws.Config{}, &config.Config{}, fileService)
+	service := newTestCleansingService(s3Service)
+
+	deletionContext, err := service.BuildDeletionContext(context.Background(), dto.CleansingMessage{Type: "site", ID: 10})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// 1 RasterD upload + 4 processed outputs + 1 SSS upload
+	if len(deletionContext.S3Objects) != 6 {
+		t.Errorf("Expected 6 objects across all categories, got %d", len(deletionContext.S3Objects))
+	}
+}
+
+func TestCleansingService_ContractorObjectLimit(t *testing.T) {
+	objects := []dto.S3Object{
+		{Bucket: "b", Key: "P1/S1/00_Upload/a.txt"},
+		{Bucket: "b", Key: "P1/S1/00_Upload/b.txt"},
+		{Bucket: "b", Key: "P2/S2/00_Upload/c.txt"},
+	}
+
+	tests := []struct {
+		name        string
+		limit       int
+		override    bool
+		wantErr     bool
+		wantDeleted int
+	}{
+		{name: "under limit", limit: 3, wantDeleted: 3},
+		{name: "over limit", limit: 2, wantErr: true},
+		{name: "over limit with override", limit: 2, override: true, wantDeleted: 3},
+		{name: "limit disabled", limit: 0, wantDeleted: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Service := &mockS3Service{contractorObjects: objects}
+			contractorRepo := &mockContractorRepository{}
+			service := NewCleansingServiceWithConfig(&config.Config{MaxObjectsPerOperation: tt.limit}, s3Service, contractorRepo, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{}, &mockProjectRepository{}, &mockSiteRepository{}, &mockDocumentGroupRepository{}, &mockDocumentRepository{}, &mockFileRepository{}, &mockUploaderContractorUsageRepository{}, nil, nil)
+
+			result, err := service.ProcessCleansingMessage(context.Background(), dto.CleansingMessage{
+				Type:                dto.CleansingTypeContractor,
+				ID:                  1,
+				OverrideObjectLimit: tt.override,
+			})
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrObjectLimitExceeded) {
+					t.Fatalf("Expected ErrObjectLimitExceeded, got %v", err)
+				}
+				if result.Success || result.Error == "" {
+					t.Errorf("Expected failed result with error, got %+v", result)
+				}
+				if len(s3Service.deleted) != 0 {
+					t.Errorf("Expected no deletions, got %+v", s3Service.deleted)
+				}
+				if _, ok := contractorRepo.statusUpdates[1]; ok {
+					t.Error("Expected contractor status to be left untouched")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(s3Service.deleted) != tt.wantDeleted {
+				t.Errorf("Expected %d deletions, got %d", tt.wantDeleted, len(s3Service.deleted))
+			}
+		})
+	}
+}
+
+func TestCleansingService_DeleteContractorFiles_BucketPrecheck(t *testing.T) {
+	objects := []dto.S3Object{{Bucket: "test-bucket", Key: "P1/S1/00_Upload/a.txt"}}
+
+	tests := []struct {
+		name          string
+		bucketMissing bool
+		bucketErr     error
+		wantErr       bool
+		wantDeleted   int
+	}{
+		{name: "existing bucket", wantDeleted: 1},
+		{name: "missing bucket skips S3 and cleans database", bucketMissing: true},
+		{name: "access denied fails", bucketErr: errors.New("failed to check bucket test-bucket: AccessDenied"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Service := &mockS3Service{contractorObjects: objects, bucketMissing: tt.bucketMissing, bucketErr: tt.bucketErr}
+			service := newTestCleansingService(s3Service)
+
+			result, err := service.DeleteContractorFiles(context.Background(), 1)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected error")
+				}
+				if result.Success {
+					t.Errorf("Expected failed result, got %+v", result)
+				}
+				if len(s3Service.deleted) != 0 {
+					t.Errorf("Expected no deletions, got %+v", s3Service.deleted)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !result.Success {
+				t.Errorf("Expected success, got %+v", result)
+			}
+			if len(s3Service.deleted) != tt.wantDeleted || result.FilesDeleted != tt.wantDeleted {
+				t.Errorf("Expected %d deletions, got %d (result %d)", tt.wantDeleted, len(s3Service.deleted), result.FilesDeleted)
+			}
+		})
+	}
+}
+
+func TestCleansingService_DeleteContractorFiles_SharedBucket(t *testing.T) {
+	tests := []struct {
+		name              string
+		bucketSharedBy    int64
+		countErr          error
+		wantBucketDeleted bool
+	}{
+		{name: "dedicated bucket is deleted", bucketSharedBy: 1, wantBucketDeleted: true},
+		{name: "shared bucket is kept", bucketSharedBy: 3},
+		{name: "count failure fails the message", countErr: errors.New("Error 1054: Unknown column 'aws_extra_buckets'")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Service := &mockS3Service{contractorObjects: []dto.S3Object{{Bucket: "test-bucket", Key: "P1/S1/00_Upload/a.txt"}}}
+			contractorRepo := &mockContractorRepository{bucketSharedBy: tt.bucketSharedBy, countErr: tt.countErr}
+			service := NewCleansingService(s3Service, contractorRepo, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{}, &mockProjectRepository{}, &mockSiteRepository{}, &mockDocumentGroupRepository{}, &mockDocumentRepository{}, &mockFileRepository{}, &mockUploaderContractorUsageRepository{})
+
+			result, err := service.DeleteContractorFiles(context.Background(), 1)
+			if tt.countErr != nil {
+				// A dedicated bucket must not pass for a shared one, so nothing is deleted until the count succeeds
+				if !errors.Is(err, tt.countErr) || result.Success {
+					t.Errorf("Expected the count error to fail the message, got %v and %+v", err, result)
+				}
+				if len(s3Service.deleted) != 0 || len(s3Service.deletedBuckets) != 0 {
+					t.Errorf("Expected nothing to be deleted, got keys %+v and buckets %v", s3Service.deleted, s3Service.deletedBuckets)
+				}
+				if len(contractorRepo.deleted) != 0 {
+					t.Errorf("Expected the contractor record to be kept, got %v", contractorRepo.deleted)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !result.Success {
+				t.Errorf("Expected success, got %+v", result)
+			}
+			if len(s3Service.deleted) != 1 {
+				t.Errorf("Expected contractor keys to be deleted, got %+v", s3Service.deleted)
+			}
+
+			if tt.wantBucketDeleted {
+				if len(s3Service.deletedBuckets) != 1 || s3Service.deletedBuckets[0] != "test-bucket" {
+					t.Errorf("Expected test-bucket to be deleted, got %v", s3Service.deletedBuckets)
+				}
+			} else if len(s3Service.deletedBuckets) != 0 {
+				t.Errorf("Expected bucket to be kept, got %v", s3Service.deletedBuckets)
+			}
+		})
+	}
+}
+
+func TestCleansingService_DeleteContractorFiles_LifecycleStrategy(t *testing.T) {
+	tests := []struct {
+		name           string
+		message        dto.CleansingMessage
+		bucketSharedBy int64
+		expireErr      error
+		wantExpired    bool
+		wantErr        bool
+	}{
+		{name: "dedicated bucket is left to expire", message: dto.CleansingMessage{Type: "contractor", ID: 1}, bucketSharedBy: 1, wantExpired: true},
+		{name: "shared bucket keys are deleted", message: dto.CleansingMessage{Type: "contractor", ID: 1}, bucketSharedBy: 2},
+		{name: "preserved contractor bucket is emptied", message: dto.CleansingMessage{Type: "contractor", ID: 1, PreserveEntity: true}, bucketSharedBy: 1},
+		{name: "expiration failure falls back to deletion", message: dto.CleansingMessage{Type: "contractor", ID: 1}, bucketSharedBy: 1, expireErr: ErrLifecycleUnsafe},
+		{name: "bucket of another contractor", message: dto.CleansingMessage{Type: "contractor", ID: 1}, bucketSharedBy: 1, expireErr: ErrBucketNotOwned, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Service := &mockS3Service{contractorObjects: []dto.S3Object{{Bucket: "test-bucket", Key: "P1/S1/00_Upload/a.txt"}}, expireErr: tt.expireErr}
+			contractorRepo := &mockContractorRepository{bucketSharedBy: tt.bucketSharedBy}
+			service := NewCleansingServiceWithConfig(&config.Config{BucketCleanupStrategy: BucketCleanupLifecycle}, s3Service, contractorRepo, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{}, &mockProjectRepository{}, &mockSiteRepository{}, &mockDocumentGroupRepository{}, &mockDocumentRepository{}, &mockFileRepository{}, &mockUploaderContractorUsageRepository{}, nil, nil)
+
+			result, err := service.ProcessCleansingMessage(context.Background(), tt.message)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected error")
+				}
+				if len(s3Service.deleted) != 0 || len(contractorRepo.deleted) != 0 {
+					t.Errorf("Expected nothing deleted, got objects %v contractors %v", s3Service.deleted, contractorRepo.deleted)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !result.Success {
+				t.Errorf("Expected success, got %+v", result)
+			}
+
+			if !tt.wantExpired {
+				if result.FollowUp != nil || len(s3Service.expiredBuckets) != 0 {
+					t.Errorf("Expected no bucket expiration, got follow-up %+v expired %v", result.FollowUp, s3Service.expiredBuckets)
+				}
+				if len(s3Service.deleted) != 1 {
+					t.Errorf("Expected contractor keys to be deleted, got %+v", s3Service.deleted)
+				}
+				return
+			}
+
+			if len(s3Service.expiredBuckets) != 1 || s3Service.expiredBuckets[0] != "test-bucket" {
+				t.Errorf("Expected test-bucket to expire, got %v", s3Service.expiredBuckets)
+			}
+			if len(s3Service.deleted) != 0 || len(s3Service.deletedBuckets) != 0 {
+				t.Errorf("Expected nothing deleted synchronously, got objects %v buckets %v", s3Service.deleted, s3Service.deletedBuckets)
+			}
+			if len(contractorRepo.deleted) != 1 {
+				t.Errorf("Expected the contractor record to be deleted, got %v", contractorRepo.deleted)
+			}
+			want := dto.CleansingMessage{Type: dto.CleansingTypeExpiredBucket, ID: 1, BucketName: "test-bucket"}
+			if result.FollowUp == nil || *result.FollowUp != want {
+				t.Errorf("Expected follow-up %+v, got %+v", want, result.FollowUp)
+			}
+		})
+	}
+}
+
+func TestCleansingService_ProcessCleansingMessage_ExpiredBucket(t *testing.T) {
+	message := dto.CleansingMessage{Type: dto.CleansingTypeExpiredBucket, ID: 1, BucketName: "test-bucket", CorrelationID: "cleansing-1"}
+
+	tests := []struct {
+		name         string
+		notEmpty     bool
+		wantFollowUp bool
+	}{
+		{name: "empty bucket is deleted"},
+		{name: "bucket still expiring is checked again", notEmpty: true, wantFollowUp: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Service := &mockS3Service{bucketNotEmpty: tt.notEmpty}
+			service := newTestCleansingService(s3Service)
+
+			result, err := service.ProcessCleansingMessage(context.Background(), message)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !result.Success {
+				t.Errorf("Expected success, got %+v", result)
+			}
+			if tt.wantFollowUp {
+				if result.FollowUp == nil || *result.FollowUp != message {
+					t.Errorf("Expected the message to be rescheduled, got %+v", result.FollowUp)
+				}
+				return
+			}
+			if result.FollowUp != nil {
+				t.Errorf("Expected no follow-up, got %+v", result.FollowUp)
+			}
+			if len(s3Service.deletedBuckets) != 1 {
+				t.Errorf("Expected test-bucket to be deleted, got %v", s3Service.deletedBuckets)
+			}
+		})
+	}
+}
+
+func TestCleansingService_DeleteContractorFiles_BucketName(t *testing.T) {
+	tests := []struct {
+		name       string
+		bucketName string
+		wantErr    bool
+	}{
+		{name: "padded bucket name is trimmed", bucketName: "  test-bucket\n"},
+		{name: "uppercase bucket name is rejected", bucketName: "Test-Bucket", wantErr: true},
+		{name: "underscore bucket name is rejected", bucketName: "test_bucket", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Service := &mockS3Service{contractorObjects: []dto.S3Object{{Bucket: "test-bucket", Key: "P1/S1/00_Upload/a.txt"}}}
+			contractorRepo := &mockContractorRepository{bucketSharedBy: 1, bucketName: tt.bucketName}
+			service := NewCleansingService(s3Service, contractorRepo, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{}, &mockProjectRepository{}, &mockSiteRepository{}, &mockDocumentGroupRepository{}, &mockDocumentRepository{}, &mockFileRepository{}, &mockUploaderContractorUsageRepository{})
+
+			result, err := service.DeleteContractorFiles(context.Background(), 1)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidBucketName) || result.Success {
+					t.Errorf("Expected ErrInvalidBucketName, got %v (%+v)", err, result)
+				}
+				if len(s3Service.deleted) != 0 || len(s3Service.deletedBuckets) != 0 || len(contractorRepo.deleted) != 0 || len(contractorRepo.statusUpdates) != 0 {
+					t.Errorf("Expected nothing touched, got objects %v buckets %v contractors %v status %v",
+						s3Service.deleted, s3Service.deletedBuckets, contractorRepo.deleted, contractorRepo.statusUpdates)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(s3Service.deletedBuckets) != 1 || s3Service.deletedBuckets[0] != "test-bucket" {
+				t.Errorf("Expected the trimmed test-bucket to be deleted, got %q", s3Service.deletedBuckets)
+			}
+		})
+	}
+}
+
+func TestCleansingService_DeleteContractorFiles_BucketNotOwned(t *testing.T) {
+	tests := []struct {
+		name            string
+		deleteBucketErr error
+		wantErr         bool
+	}{
+		{name: "not owned bucket stops the cleansing", deleteBucketErr: fmt.Errorf("%w: bucket test-bucket has no tags", ErrBucketNotOwned), wantErr: true},
+		{name: "other bucket failures are tolerated", deleteBucketErr: errors.New("BucketNotEmpty")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Service := &mockS3Service{
+				contractorObjects: []dto.S3Object{{Bucket: "test-bucket", Key: "P1/S1/00_Upload/a.txt"}},
+				deleteBucketErr:   tt.deleteBucketErr,
+			}
+			contractorRepo := &mockContractorRepository{bucketSharedBy: 1}
+			service := NewCleansingService(s3Service, contractorRepo, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{}, &mockProjectRepository{}, &mockSiteRepository{}, &mockDocumentGroupRepository{}, &mockDocumentRepository{}, &mockFileRepository{}, &mockUploaderContractorUsageRepository{})
+
+			result, err := service.DeleteContractorFiles(context.Background(), 1)
+			if tt.wantErr {
+				if !errors.Is(err, ErrBucketNotOwned) {
+					t.Fatalf("Expected ErrBucketNotOwned, got %v", err)
+				}
+				if result.Success {
+					t.Errorf("Expected failed result, got %+v", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !result.Success {
+				t.Errorf("Expected success, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestCleansingService_DeleteContractorFiles_OwnershipCheckedFirst(t *testing.T) {
+	s3Service := &mockS3Service{
+		contractorObjects: []dto.S3Object{{Bucket: "test-bucket", Key: "P1/S1/00_Upload/a.txt"}},
+		ownerErr:          fmt.Errorf("%w: bucket test-bucket has no tags", ErrBucketNotOwned),
+	}
+	contractorRepo := &mockContractorRepository{bucketSharedBy: 1}
+	service := NewCleansingService(s3Service, contractorRepo, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{}, &mockProjectRepository{}, &mockSiteRepository{}, &mockDocumentGroupRepository{}, &mockDocumentRepository{}, &mockFileRepository{}, &mockUploaderContractorUsageRepository{})
+
+	result, err := service.DeleteContractorFiles(context.Background(), 1)
+	if !errors.Is(err, ErrBucketNotOwned) {
+		t.Fatalf("Expected ErrBucketNotOwned, got %v", err)
+	}
+	if result.Success {
+		t.Errorf("Expected failed result, got %+v", result)
+	}
+	if len(s3Service.verifiedBuckets) != 1 || s3Service.verifiedBuckets[0] != "test-bucket" {
+		t.Errorf("Expected test-bucket to be verified, got %v", s3Service.verifiedBuckets)
+	}
+	if len(s3Service.deleted) != 0 || len(s3Service.deletedBuckets) != 0 {
+		t.Errorf("Expected nothing deleted from a bucket the contractor does not own, got %v and %v", s3Service.deleted, s3Service.deletedBuckets)
+	}
+}
+
+func TestCleansingService_ProcessCleansingMessage_PreserveEntity(t *testing.T) {
+	tests := []struct {
+		name           string
+		preserveEntity bool
+	}{
+		{name: "full delete"},
+		{name: "preserve contractor", preserveEntity: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Service := &mockS3Service{contractorObjects: []dto.S3Object{{Bucket: "test-bucket", Key: "P1/S1/00_Upload/a.txt"}}}
+			contractorRepo := &mockContractorRepository{bucketSharedBy: 1}
+			service := NewCleansingService(s3Service, contractorRepo, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{}, &mockProjectRepository{}, &mockSiteRepository{}, &mockDocumentGroupRepository{}, &mockDocumentRepository{}, &mockFileRepository{}, &mockUploaderContractorUsageRepository{})
+
+			result, err := service.ProcessCleansingMessage(context.Background(), dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 1, PreserveEntity: tt.preserveEntity})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !result.Success || result.FilesDeleted != 1 {
+				t.Errorf("Expected success with 1 deleted file, got %+v", result)
+			}
+			if result.EntityPreserved != tt.preserveEntity {
+				t.Errorf("Expected EntityPreserved %v, got %v", tt.preserveEntity, result.EntityPreserved)
+			}
+
+			if tt.preserveEntity {
+				if len(contractorRepo.deleted) != 0 {
+					t.Errorf("Expected contractor record to be kept, deleted %v", contractorRepo.deleted)
+				}
+				if len(s3Service.deletedBuckets) != 0 || len(s3Service.emptiedBuckets) != 1 {
+					t.Errorf("Expected bucket to be emptied only, deleted %v emptied %v", s3Service.deletedBuckets, s3Service.emptiedBuckets)
+				}
+				return
+			}
+
+			if len(contractorRepo.deleted) != 1 || contractorRepo.deleted[0] != 1 {
+				t.Errorf("Expected contractor 1 to be deleted, got %v", contractorRepo.deleted)
+			}
+			if len(s3Service.deletedBuckets) != 1 || len(s3Service.emptiedBuckets) != 0 {
+				t.Errorf("Expected bucket to be deleted, deleted %v emptied %v", s3Service.deletedBuckets, s3Service.emptiedBuckets)
+			}
+		})
+	}
+}
+
+// blockingS3Service signals every DeleteObjectsByBucket call on entered and holds it until release is closed
+type blockingS3Service struct {
+	NullS3Service
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (m *blockingS3Service) DeleteObjectsByBucket(ctx context.Context, objects []dto.S3Object) ([]dto.BucketDeleteResult, error) {
+	m.entered <- struct{}{}
+	<-m.release
+	return deletedByBucket(objects), nil
+}
+
+// ownedContractorProjectRepository reports every project as owned by contractorID
+type ownedContractorProjectRepository struct {
+	mockContractorProjectRepository
+	contractorID int64
+}
+
+func (m *ownedContractorProjectRepository) GetByProjectID(ctx context.Context, projectID int64) (*entity.ContractorProject, error) {
+	return &entity.ContractorProject{ContractorId: m.contractorID, ProjectId: projectID}, nil
+}
+
+func TestCleansingService_ProcessCleansingMessage_SerializesPerContractor(t *testing.T) {
+	tests := []struct {
+		name         string
+		messages     [2]dto.CleansingMessage
+		wantParallel bool
+	}{
+		{
+			name:     "same contractor",
+			messages: [2]dto.CleansingMessage{{Type: dto.CleansingTypeContractor, ID: 1}, {Type: dto.CleansingTypeContractor, ID: 1}},
+		},
+		{
+			name:     "contractor and one of its projects",
+			messages: [2]dto.CleansingMessage{{Type: dto.CleansingTypeContractor, ID: 1}, {Type: dto.CleansingTypeProject, ID: 10}},
+		},
+		{
+			name:         "different contractors",
+			messages:     [2]dto.CleansingMessage{{Type: dto.CleansingTypeContractor, ID: 1}, {Type: dto.CleansingTypeContractor, ID: 2}},
+			wantParallel: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Service := &blockingS3Service{entered: make(chan struct{}), release: make(chan struct{})}
+			service := NewCleansingService(s3Service, &mockContractorRepository{}, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &ownedContractorProjectRepository{contractorID: 1}, &mockProjectRepository{}, &mockSiteRepository{}, &mockDocumentGroupRepository{}, &mockDocumentRepository{}, &mockFileRepository{}, &mockUploaderContractorUsageRepository{})
+
+			var wg sync.WaitGroup
+			for _, message := range tt.messages {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := service.ProcessCleansingMessage(context.Background(), message); err != nil {
+						t.Errorf("Unexpected error for %+v: %v", message, err)
+					}
+				}()
+			}
+
+			// The first operation always starts
+			select {
+			case <-s3Service.entered:
+			case <-time.After(time.Second):
+				t.Fatal("Timed out waiting for the first operation")
+			}
+
+			// The second may only start while the first is still running if the contractors differ
+			select {
+			case <-s3Service.entered:
+				if !tt.wantParallel {
+					t.Fatal("Second operation started before the first finished")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.wantParallel {
+					t.Fatal("Expected operations on different contractors to run in parallel")
+				}
+				close(s3Service.release)
+				<-s3Service.entered
+			}
+
+			select {
+			case <-s3Service.release:
+			default:
+				close(s3Service.release)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestCleansingService_DeleteObjectsDirect(t *testing.T) {
+	s3Service := &mockS3Service{isProtected: func(obj dto.S3Object) bool { return obj.Key == "keep/me.txt" }}
+	service := NewCleansingService(s3Service, &mockContractorRepository{}, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{}, &mockProjectRepository{}, &mockSiteRepository{}, &mockDocumentGroupRepository{}, &mockDocumentRepository{}, &mockFileRepository{}, &mockUploaderContractorUsageRepository{})
+
+	keys := []string{
+		"P1/S1/00_Upload/a.txt",
+		"P1/S1/00_Upload/b.txt",
+		"P1/S1/00_Upload/a.txt", // duplicate
+		"",                      // empty
+		"P1/S1/00_Upload/",      // directory-like
+		strings.Repeat("k", maxKeyLength+1),
+		"keep/me.txt", // protected
+	}
+	result, err := service.DeleteObjectsDirect(context.Background(), "test-bucket", keys)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Success || result.ID != 1 {
+		t.Errorf("Expected success for contractor 1, got %+v", result)
+	}
+	if result.FilesDeleted != 2 {
+		t.Errorf("Expected 2 files deleted, got %d", result.FilesDeleted)
+	}
+	if result.FilesSkipped != 5 {
+		t.Errorf("Expected 5 files skipped, got %d", result.FilesSkipped)
+	}
+	wantReasons := map[string]int{
+		dto.SkipReasonDuplicate:  1,
+		dto.SkipReasonUnsafeKey:  2,
+		dto.SkipReasonInvalidKey: 1,
+		dto.SkipReasonProtected:  1,
+	}
+	if fmt.Sprint(result.SkippedReasons) != fmt.Sprint(wantReasons) {
+		t.Errorf("Expected skipped reasons %v, got %v", wantReasons, result.SkippedReasons)
+	}
+
+	if len(s3Service.deleted) != 2 {
+		t.Fatalf("Expected 2 objects passed to S3, got %+v", s3Service.deleted)
+	}
+	for i, want := range []string{"P1/S1/00_Upload/a.txt", "P1/S1/00_Upload/b.txt"} {
+		obj := s3Service.deleted[i]
+		if obj.Key != want || obj.Bucket != "test-bucket" || obj.Region != "ap-southeast-1" {
+			t.Errorf("Expected %s in test-bucket/ap-southeast-1, got %+v", want, obj)
+		}
+	}
+}
+
+func TestCleansingService_DeleteObjectsDirect_Refused(t *testing.T) {
+	tests := []struct {
+		name      string
+		bucket    string
+		bucketErr error
+		wantErr   error
+	}{
+		{name: "missing bucket", bucket: ""},
+		{name: "unknown bucket", bucket: "stranger-bucket", bucketErr: repository.ErrNotFound, wantErr: ErrBucketNotOwned},
+		{name: "lookup failure", bucket: "test-bucket", bucketErr: errors.New("connection reset")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Service := &mockS3Service{}
+			contractorRepo := &mockContractorRepository{bucketErr: tt.bucketErr}
+			service := NewCleansingService(s3Service, contractorRepo, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{}, &mockProjectRepository{}, &mockSiteRepository{}, &mockDocumentGroupRepository{}, &mockDocumentRepository{}, &mockFileRepository{}, &mockUploaderContractorUsageRepository{})
+
+			result, err := service.DeleteObjectsDirect(context.Background(), tt.bucket, []string{"P1/S1/00_Upload/a.txt"})
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if result.Success || result.Error == "" {
+				t.Errorf("Expected a failed result with an error, got %+v", result)
+			}
+			if len(s3Service.deleted) != 0 {
+				t.Errorf("Expected nothing deleted, got %+v", s3Service.deleted)
+			}
+		})
+	}
+}
+
+func TestCleansingService_Quarantine(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *config.Config
+		message dto.CleansingMessage
+	}{
+		{name: "requested by message", cfg: &config.Config{}, message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 1, Quarantine: true}},
+		{name: "enabled by config", cfg: &config.Config{QuarantineMode: true}, message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 1}},
+		{name: "project", cfg: &config.Config{}, message: dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: 1, Quarantine: true}},
+		{name: "site", cfg: &config.Config{}, message: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: 1, Quarantine: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := []dto.S3Object{
+				{Bucket: "test-bucket", Key: "P1/S1/00_Upload/a.txt"},
+				{Bucket: "test-bucket", Key: "P1/S1/00_Upload/b.txt"},
+			}
+			s3Service := &mockS3Service{contractorObjects: objects, projectObjects: objects, siteObjects: objects}
+			service := NewCleansingServiceWithConfig(tt.cfg, s3Service, &mockContractorRepository{bucketSharedBy: 1}, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{}, &mockProjectRepository{}, &mockSiteRepository{}, &mockDocumentGroupRepository{}, &mockDocumentRepository{}, &mockFileRepository{}, &mockUploaderContractorUsageRepository{}, nil, nil)
+
+			result, err := service.ProcessCleansingMessage(context.Background(), tt.message)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !result.Success || !result.Quarantined {
+				t.Errorf("Expected a successful quarantine, got %+v", result)
+			}
+			if result.FilesDeleted != 2 || len(s3Service.quarantined) != 2 {
+				t.Errorf("Expected 2 quarantined objects, got %d (result %d)", len(s3Service.quarantined), result.FilesDeleted)
+			}
+			if len(s3Service.deleted) != 0 {
+				t.Errorf("Expected nothing deleted, got %+v", s3Service.deleted)
+			}
+			if len(s3Service.deletedBuckets) != 0 || len(s3Service.emptiedBuckets) != 0 {
+				t.Errorf("Expected the bucket to be kept, got deleted %v, emptied %v", s3Service.deletedBuckets, s3Service.emptiedBuckets)
+			}
+		})
+	}
+}
+
+func TestCleansingService_SkippedReasons(t *testing.T) {
+	objects := []dto.S3Object{
+		{Bucket: "test-bucket", Key: "P1/S1/00_Upload/a.txt"},
+		{Bucket: "test-bucket", Key: "P1/S1/00_Upload/a.txt"},    // duplicate
+		{Bucket: "other-bucket", Key: "P1/S1/00_Upload/a.txt"},   // same key, other bucket
+		{Bucket: "test-bucket", Key: "P1/S1/01_Processed/x.tif"}, // protected
+		{Bucket: "test-bucket", Key: "P1/S1/00_Upload/"},         // unsafe
+	}
+	isProtected := func(obj dto.S3Object) bool { return strings.Contains(obj.Key, "01_Processed") }
+
+	tests := []struct {
+		name    string
+		message dto.CleansingMessage
+	}{
+		{name: "contractor", message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 1}},
+		{name: "project", message: dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: 1}},
+		{name: "site", message: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: 1}},
+		{name: "category", message: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: 1, Category: "SSS"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Service := &mockS3Service{contractorObjects: objects, projectObjects: objects, siteObjects: objects, isProtected: isProtected}
+			service := NewCleansingService(s3Service, &mockContractorRepository{bucketSharedBy: 2}, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{}, &mockProjectRepository{}, &mockSiteRepository{}, &mockDocumentGroupRepository{}, &mockDocumentRepository{}, &mockFileRepository{}, &mockUploaderContractorUsageRepository{})
+
+			result, err := service.ProcessCleansingMessage(context.Background(), tt.message)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.FilesDeleted+result.FilesSkipped != len(objects) {
+				t.Errorf("Expected deleted (%d) + skipped (%d) to cover all %d objects", result.FilesDeleted, result.FilesSkipped, len(objects))
+			}
+			want := map[string]int{dto.SkipReasonDuplicate: 1, dto.SkipReasonProtected: 1, dto.SkipReasonUnsafeKey: 1}
+			if fmt.Sprint(result.SkippedReasons) != fmt.Sprint(want) {
+				t.Errorf("Expected skipped reasons %v, got %v", want, result.SkippedReasons)
+			}
+		})
+	}
+}
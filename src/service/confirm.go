@@ -0,0 +1,40 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+)
+
+// ErrConfirmationRequired is returned when a contractor message lacks the confirmation token the configured
+// secret requires, or carries one made for another contractor. Retrying cannot help; the producer has to sign
+// the message.
+var ErrConfirmationRequired = errors.New("contractor deletion not confirmed")
+
+// ContractorConfirmToken returns the token confirming the deletion of a contractor: the hex HMAC-SHA256 of
+// "contractor:<id>" keyed with secret. A token only confirms the contractor it was made for.
+func ContractorConfirmToken(secret string, contractorID int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s:%d", dto.CleansingTypeContractor, contractorID)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkConfirmation verifies the confirmation token of a contractor message when a confirmation secret is
+// configured. Messages of other types, and all messages without a secret, need no token.
+func (cs *CleansingServiceImpl) checkConfirmation(message dto.CleansingMessage) error {
+	if cs.confirmSecret == "" || message.Type != dto.CleansingTypeContractor {
+		return nil
+	}
+	if message.ConfirmToken == "" {
+		return fmt.Errorf("%w: contractor %d has no confirm_token", ErrConfirmationRequired, message.ID)
+	}
+	want := ContractorConfirmToken(cs.confirmSecret, message.ID)
+	if !hmac.Equal([]byte(message.ConfirmToken), []byte(want)) {
+		return fmt.Errorf("%w: confirm_token does not match contractor %d", ErrConfirmationRequired, message.ID)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+)
+
+func TestContractorConfirmToken(t *testing.T) {
+	token := ContractorConfirmToken("secret", 7)
+	if len(token) != 64 {
+		t.Errorf("Expected a 64 character hex token, got %q", token)
+	}
+	if again := ContractorConfirmToken("secret", 7); again != token {
+		t.Errorf("Expected the same token for the same contractor, got %q and %q", token, again)
+	}
+	if other := ContractorConfirmToken("secret", 8); other == token {
+		t.Errorf("Expected a different token for another contractor")
+	}
+	if other := ContractorConfirmToken("other-secret", 7); other == token {
+		t.Errorf("Expected a different token for another secret")
+	}
+}
+
+func TestCleansingService_ContractorConfirmation(t *testing.T) {
+	valid := ContractorConfirmToken("secret", 7)
+
+	tests := []struct {
+		name    string
+		secret  string
+		message dto.CleansingMessage
+		wantErr bool
+	}{
+		{name: "valid token", secret: "secret", message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 7, ConfirmToken: valid}},
+		{name: "missing token", secret: "secret", message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 7}, wantErr: true},
+		{name: "invalid token", secret: "secret", message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 7, ConfirmToken: "not-a-token"}, wantErr: true},
+		{name: "token of another contractor", secret: "secret", message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 8, ConfirmToken: valid}, wantErr: true},
+		{name: "token of another secret", secret: "rotated", message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 7, ConfirmToken: valid}, wantErr: true},
+		{name: "no secret configured", message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 7}},
+		{name: "project unaffected", secret: "secret", message: dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: 10}},
+		{name: "site unaffected", secret: "secret", message: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: 100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Service := &mockS3Service{contractorObjects: []dto.S3Object{{Bucket: "test-bucket", Key: "P1/a.txt", Size: 1}}}
+			contractorRepo := &mockContractorRepository{}
+			service := NewCleansingService(s3Service, contractorRepo, &mockUserContractorRepository{}, &mockViewerContractorRepository{},
+				&mockContractorProjectRepository{}, &mockProjectRepository{}, &mockSiteRepository{}, &mockDocumentGroupRepository{},
+				&mockDocumentRepository{}, &mockFileRepository{}, &mockUploaderContractorUsageRepository{}).(*CleansingServiceImpl)
+			service.confirmSecret = tt.secret
+
+			result, err := service.ProcessCleansingMessage(context.Background(), tt.message)
+			if !tt.wantErr {
+				if errors.Is(err, ErrConfirmationRequired) {
+					t.Fatalf("Expected the message to be accepted, got %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrConfirmationRequired) {
+				t.Fatalf("Expected ErrConfirmationRequired, got %v", err)
+			}
+			if result.Success || result.Error == "" {
+				t.Errorf("Expected a failed result, got %+v", result)
+			}
+			if len(s3Service.deleted) != 0 || len(contractorRepo.deleted) != 0 {
+				t.Errorf("Expected nothing deleted, got %d objects and contractors %v", len(s3Service.deleted), contractorRepo.deleted)
+			}
+		})
+	}
+}
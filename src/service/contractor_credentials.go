@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	log "github.com/sirupsen/logrus"
+)
+
+// ContractorRoleIDPlaceholder is replaced by the contractor's ID in CONTRACTOR_ROLE_ARN_PATTERN
+const ContractorRoleIDPlaceholder = "{contractor_id}"
+
+// credentialSource is where the credentials of an S3 client come from
+type credentialSource string
+
+const (
+	credentialSourceDefault    credentialSource = "default"     // the worker's own credentials
+	credentialSourceContractor credentialSource = "contractor"  // the contractor's stored IAM access key
+	credentialSourceAssumeRole credentialSource = "assume_role" // a role assumed for the contractor
+)
+
+type (
+	// clientCredentials describes the credentials an S3 client of a contractor is built with
+	clientCredentials struct {
+		source          credentialSource
+		contractorID    int64
+		accessKeyID     string
+		secretAccessKey string
+		roleARN         string
+	}
+
+	contractorKey struct{}
+)
+
+// ValidateContractorRoleARNPattern checks CONTRACTOR_ROLE_ARN_PATTERN: empty disables assuming a role, anything
+// else must be an IAM role ARN naming the contractor through ContractorRoleIDPlaceholder
+func ValidateContractorRoleARNPattern(pattern string) error {
+	if pattern == "" {
+		return nil
+	}
+	if !strings.HasPrefix(pattern, "arn:") || !strings.Contains(pattern, ":role/") {
+		return fmt.Errorf("invalid contractor role ARN pattern %q: must be an IAM role ARN", pattern)
+	}
+	if !strings.Contains(pattern, ContractorRoleIDPlaceholder) {
+		return fmt.Errorf("invalid contractor role ARN pattern %q: must contain %s", pattern, ContractorRoleIDPlaceholder)
+	}
+	return nil
+}
+
+// withContractor returns a context under which S3 requests are made with the credentials selected for contractor
+func withContractor(ctx context.Context, contractor *entity.Contractor) context.Context {
+	return context.WithValue(ctx, contractorKey{}, contractor)
+}
+
+// contractorFromContext returns the contractor set by withContractor, if any
+func contractorFromContext(ctx context.Context) (*entity.Contractor, bool) {
+	contractor, ok := ctx.Value(contractorKey{}).(*entity.Contractor)
+	return contractor, ok && contractor != nil
+}
+
+// bucketRegion returns the region of bucket when it is the bucket of the contractor ctx carries, so requests
+// naming only a bucket reach it with a client of the right region; otherwise the default region is used
+func bucketRegion(ctx context.Context, bucket string) string {
+	if contractor, ok := contractorFromContext(ctx); ok && contractor.AwsBucketName == bucket {
+		return contractor.AwsBucketRegion
+	}
+	return ""
+}
+
+// selectCredentials picks the credentials a contractor's objects are accessed with: the role roleARNPattern names
+// for it when set, else its stored IAM access key when useContractorKeys is set and both halves are present, else
+// the worker's default credentials
+func selectCredentials(contractor *entity.Contractor, roleARNPattern string, useContractorKeys bool) clientCredentials {
+	if contractor == nil {
+		return clientCredentials{source: credentialSourceDefault}
+	}
+	if roleARNPattern != "" {
+		return clientCredentials{
+			source:       credentialSourceAssumeRole,
+			contractorID: contractor.Id,
+			roleARN:      strings.ReplaceAll(roleARNPattern, ContractorRoleIDPlaceholder, strconv.FormatInt(contractor.Id, 10)),
+		}
+	}
+	keyID := strings.TrimSpace(contractor.AwsIamAccessKeyId)
+	secret := strings.TrimSpace(contractor.AwsIamSecretAccessKey)
+	if useContractorKeys && keyID != "" && secret != "" {
+		return clientCredentials{
+			source:          credentialSourceContractor,
+			contractorID:    contractor.Id,
+			accessKeyID:     keyID,
+			secretAccessKey: secret,
+		}
+	}
+	return clientCredentials{source: credentialSourceDefault, contractorID: contractor.Id}
+}
+
+// cacheKey identifies the client built for these credentials in region; a rotated key or role gets a new client
+func (c clientCredentials) cacheKey(region string) string {
+	return fmt.Sprintf("%s/%d/%s/%s/%s", c.source, c.contractorID, c.accessKeyID, c.roleARN, region)
+}
+
+// getContractorClient gets or creates the S3 client of region using the credentials selected for contractor
+func (s3s *S3ServiceImpl) getContractorClient(ctx context.Context, creds clientCredentials, region string) (S3API, error) {
+	key := creds.cacheKey(region)
+
+	s3s.clientMutex.RLock()
+	client, exists := s3s.contractorClients[key]
+	s3s.clientMutex.RUnlock()
+	if exists {
+		return client, nil
+	}
+
+	s3s.clientMutex.Lock()
+	defer s3s.clientMutex.Unlock()
+	if client, exists := s3s.contractorClients[key]; exists {
+		return client, nil
+	}
+
+	if region == "" {
+		region = s3s.awsConfig.Region
+	}
+	var provider aws.CredentialsProvider
+	switch creds.source {
+	case credentialSourceContractor:
+		provider = credentials.NewStaticCredentialsProvider(creds.accessKeyID, creds.secretAccessKey, "")
+	case credentialSourceAssumeRole:
+		// The role is assumed with the worker's own credentials
+		baseConfig, err := config.LoadDefaultConfig(ctx,
+			config.WithRegion(region),
+			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(s3s.accessKeyID, s3s.secretAccessKey, "")),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create config for assuming role %s: %w", creds.roleARN, err)
+		}
+		provider = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(baseConfig), creds.roleARN,
+			func(o *stscreds.AssumeRoleOptions) {
+				o.RoleSessionName = fmt.Sprintf("wadugs-cleansing-%d", creds.contractorID)
+			}))
+	default:
+		return nil, errors.New("default credentials have no contractor client")
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion(region),
+		config.WithCredentialsProvider(provider),
+		config.WithAPIOptions([]func(*middleware.Stack) error{AddCorrelationIDMiddleware}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config for contractor %d in region %s: %w", creds.contractorID, region, err)
+	}
+	client = s3.NewFromConfig(cfg)
+	s3s.contractorClients[key] = client
+
+	workerLog.GetLoggerFromContext(ctx).WithFields(log.Fields{
+		"contractor_id": creds.contractorID,
+		"region":        region,
+		"credentials":   string(creds.source),
+		"role_arn":      creds.roleARN,
+	}).Info("Created S3 client with contractor credentials")
+	return client, nil
+}
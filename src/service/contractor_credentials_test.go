@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+)
+
+func TestSelectCredentials(t *testing.T) {
+	withKeys := &entity.Contractor{Id: 7, AwsIamAccessKeyId: "AKIA7", AwsIamSecretAccessKey: "secret7"}
+	withoutKeys := &entity.Contractor{Id: 8}
+	halfKeys := &entity.Contractor{Id: 9, AwsIamAccessKeyId: "AKIA9", AwsIamSecretAccessKey: " "}
+
+	tests := []struct {
+		name              string
+		contractor        *entity.Contractor
+		roleARNPattern    string
+		useContractorKeys bool
+		want              clientCredentials
+	}{
+		{name: "no contractor", contractor: nil, useContractorKeys: true, want: clientCredentials{source: credentialSourceDefault}},
+		{name: "disabled", contractor: withKeys, want: clientCredentials{source: credentialSourceDefault, contractorID: 7}},
+		{name: "contractor keys", contractor: withKeys, useContractorKeys: true,
+			want: clientCredentials{source: credentialSourceContractor, contractorID: 7, accessKeyID: "AKIA7", secretAccessKey: "secret7"}},
+		{name: "no keys falls back", contractor: withoutKeys, useContractorKeys: true, want: clientCredentials{source: credentialSourceDefault, contractorID: 8}},
+		{name: "half a key falls back", contractor: halfKeys, useContractorKeys: true, want: clientCredentials{source: credentialSourceDefault, contractorID: 9}},
+		{name: "assumed role", contractor: withoutKeys, roleARNPattern: "arn:aws:iam::123456789012:role/wadugs-contractor-{contractor_id}",
+			want: clientCredentials{source: credentialSourceAssumeRole, contractorID: 8, roleARN: "arn:aws:iam::123456789012:role/wadugs-contractor-8"}},
+		{name: "assumed role takes precedence over keys", contractor: withKeys, roleARNPattern: "arn:aws:iam::123456789012:role/c-{contractor_id}", useContractorKeys: true,
+			want: clientCredentials{source: credentialSourceAssumeRole, contractorID: 7, roleARN: "arn:aws:iam::123456789012:role/c-7"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectCredentials(tt.contractor, tt.roleARNPattern, tt.useContractorKeys); got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateContractorRoleARNPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr bool
+	}{
+		{pattern: ""},
+		{pattern: "arn:aws:iam::123456789012:role/wadugs-contractor-{contractor_id}"},
+		{pattern: "arn:aws:iam::123456789012:role/wadugs-contractor", wantErr: true},
+		{pattern: "arn:aws:iam::123456789012:user/{contractor_id}", wantErr: true},
+		{pattern: "wadugs-contractor-{contractor_id}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			err := ValidateContractorRoleARNPattern(tt.pattern)
+			if tt.wantErr && err == nil {
+				t.Error("Expected error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestS3Service_GetClientForRegion_ContractorCredentials(t *testing.T) {
+	defaultClient := &mockS3Client{}
+	service := NewS3Service(defaultClient, aws.Config{Region: "ap-southeast-1"}, &config.Config{UseContractorCredentials: true}, nil).(*S3ServiceImpl)
+	ctx := withContractor(context.Background(), &entity.Contractor{Id: 7, AwsIamAccessKeyId: "AKIA7", AwsIamSecretAccessKey: "secret7"})
+
+	client, err := service.getClientForRegion(ctx, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s3Client, ok := client.(*s3.Client)
+	if !ok {
+		t.Fatalf("Expected a client built for the contractor, got %T", client)
+	}
+	creds, err := s3Client.Options().Credentials.Retrieve(context.Background())
+	if err != nil || creds.AccessKeyID != "AKIA7" || creds.SecretAccessKey != "secret7" {
+		t.Errorf("Expected the contractor's key, got %s (%v)", creds.AccessKeyID, err)
+	}
+	if region := s3Client.Options().Region; region != "ap-southeast-1" {
+		t.Errorf("Expected the default region ap-southeast-1, got %s", region)
+	}
+
+	if again, _ := service.getClientForRegion(ctx, ""); again != client {
+		t.Error("Expected the contractor client to be cached")
+	}
+	if other, _ := service.getClientForRegion(ctx, "eu-west-1"); other == client {
+		t.Error("Expected a separate client per region")
+	}
+
+	// Without keys, or without a contractor, the worker's own client is used
+	noKeys := withContractor(context.Background(), &entity.Contractor{Id: 8})
+	if client, _ := service.getClientForRegion(noKeys, ""); client != defaultClient {
+		t.Errorf("Expected the default client for a contractor without keys, got %T", client)
+	}
+	if client, _ := service.getClientForRegion(context.Background(), ""); client != defaultClient {
+		t.Errorf("Expected the default client without a contractor, got %T", client)
+	}
+}
+
+func TestS3Service_ContractorCredentials_ListingAndBatches(t *testing.T) {
+	defaultClient := &mockS3Client{}
+	contractorClient := &mockS3Client{listKeys: []string{"p/a.tif"}}
+	service := NewS3Service(defaultClient, aws.Config{Region: "ap-southeast-1"}, &config.Config{UseContractorCredentials: true}, nil).(*S3ServiceImpl)
+	contractor := &entity.Contractor{Id: 7, AwsIamAccessKeyId: "AKIA7", AwsIamSecretAccessKey: "secret7", AwsBucketName: "contractor-7", AwsBucketRegion: "eu-west-1"}
+	service.contractorClients[selectCredentials(contractor, "", true).cacheKey("eu-west-1")] = contractorClient
+	ctx := withContractor(context.Background(), contractor)
+
+	objects, err := service.ListObjectsWithPrefix(ctx, "contractor-7", "p/")
+	if err != nil {
+		t.Fatalf("ListObjectsWithPrefix() unexpected error: %v", err)
+	}
+	if len(objects) != 1 {
+		t.Errorf("Expected the contractor client's listing, got %v", objects)
+	}
+	if _, err := service.deleteBatch(ctx, "contractor-7", objects); err != nil {
+		t.Fatalf("deleteBatch() unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(contractorClient.listedBuckets, []string{"contractor-7"}) || !reflect.DeepEqual(contractorClient.deletedKeys, []string{"p/a.tif"}) {
+		t.Errorf("Expected the contractor client to list and delete, got listed %v and deleted %v", contractorClient.listedBuckets, contractorClient.deletedKeys)
+	}
+	if len(defaultClient.listedBuckets) != 0 || len(defaultClient.deletedKeys) != 0 {
+		t.Errorf("Expected the worker's client to stay unused, got listed %v and deleted %v", defaultClient.listedBuckets, defaultClient.deletedKeys)
+	}
+}
+
+// contractorRecordingS3Service records the contractor each DeleteObjectsByBucket call, and each bucket
+// operation, is made for
+type contractorRecordingS3Service struct {
+	mockS3Service
+	contractors       []*entity.Contractor
+	bucketContractors []*entity.Contractor
+}
+
+func (m *contractorRecordingS3Service) BucketExists(ctx context.Context, bucket, region string) (bool, error) {
+	m.recordBucketCall(ctx)
+	return m.mockS3Service.BucketExists(ctx, bucket, region)
+}
+
+func (m *contractorRecordingS3Service) DeleteBucket(ctx context.Context, bucket, region string, contractorID int64) error {
+	m.recordBucketCall(ctx)
+	return m.mockS3Service.DeleteBucket(ctx, bucket, region, contractorID)
+}
+
+func (m *contractorRecordingS3Service) DeleteExpiredBucket(ctx context.Context, bucket, region string, contractorID int64) (bool, error) {
+	m.recordBucketCall(ctx)
+	return m.mockS3Service.DeleteExpiredBucket(ctx, bucket, region, contractorID)
+}
+
+func (m *contractorRecordingS3Service) recordBucketCall(ctx context.Context) {
+	contractor, _ := contractorFromContext(ctx)
+	m.bucketContractors = append(m.bucketContractors, contractor)
+}
+
+func (m *contractorRecordingS3Service) DeleteObjectsByBucket(ctx context.Context, objects []dto.S3Object) ([]dto.BucketDeleteResult, error) {
+	contractor, _ := contractorFromContext(ctx)
+	m.contractors = append(m.contractors, contractor)
+	return m.mockS3Service.DeleteObjectsByBucket(ctx, objects)
+}
+
+func TestCleansingService_DB_DeleteSiteFiles_ContractorCredentials(t *testing.T) {
+	tests := []struct {
+		name           string
+		cfg            config.Config
+		wantContractor bool
+	}{
+		{name: "disabled", cfg: config.Config{}},
+		{name: "contractor keys", cfg: config.Config{UseContractorCredentials: true}, wantContractor: true},
+		{name: "assumed role", cfg: config.Config{ContractorRoleARNPattern: "arn:aws:iam::123456789012:role/c-{contractor_id}"}, wantContractor: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewMigratedDB(t)
+			testutil.SeedTree(t, db)
+			s3Service := &contractorRecordingS3Service{mockS3Service: mockS3Service{
+				siteObjects: []dto.S3Object{{Bucket: testutil.Bucket, Key: "PRJA/S100/00_Upload/depth.tif", Region: testutil.Region}},
+			}}
+
+			if _, err := newDBCleansingServiceWithS3(db, &tt.cfg, s3Service).DeleteSiteFiles(context.Background(), testutil.SiteID); err != nil {
+				t.Fatalf("DeleteSiteFiles() unexpected error: %v", err)
+			}
+			if len(s3Service.contractors) != 1 {
+				t.Fatalf("Expected one DeleteObjectsByBucket call, got %d", len(s3Service.contractors))
+			}
+			contractor := s3Service.contractors[0]
+			if !tt.wantContractor {
+				if contractor != nil {
+					t.Errorf("Expected no contractor credentials, got contractor %d", contractor.Id)
+				}
+				return
+			}
+			if contractor == nil || contractor.Id != testutil.ContractorID {
+				t.Errorf("Expected the objects to be deleted for contractor %d, got %+v", testutil.ContractorID, contractor)
+			}
+		})
+	}
+}
+
+func TestCleansingService_DB_ContractorCredentials_BucketOperations(t *testing.T) {
+	tests := []struct {
+		name          string
+		message       dto.CleansingMessage
+		removeRecords bool
+	}{
+		{name: "contractor purge", message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: testutil.ContractorID}},
+		{
+			name:          "expired bucket of a removed contractor",
+			message:       dto.CleansingMessage{Type: dto.CleansingTypeExpiredBucket, ID: testutil.ContractorID, BucketName: testutil.Bucket},
+			removeRecords: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewMigratedDB(t)
+			testutil.SeedTree(t, db)
+			if tt.removeRecords {
+				if err := db.Delete(&entity.Contractor{}, testutil.ContractorID).Error; err != nil {
+					t.Fatalf("Failed to delete contractor: %v", err)
+				}
+			}
+			s3Service := &contractorRecordingS3Service{}
+			cfg := &config.Config{ContractorRoleARNPattern: "arn:aws:iam::123456789012:role/c-{contractor_id}"}
+
+			if _, err := newDBCleansingServiceWithS3(db, cfg, s3Service).ProcessCleansingMessage(context.Background(), tt.message); err != nil {
+				t.Fatalf("ProcessCleansingMessage() unexpected error: %v", err)
+			}
+			if len(s3Service.bucketContractors) == 0 {
+				t.Fatal("Expected bucket operations")
+			}
+			for _, contractor := range s3Service.bucketContractors {
+				if contractor == nil || contractor.Id != testutil.ContractorID {
+					t.Errorf("Expected every bucket operation to run for contractor %d, got %+v", testutil.ContractorID, contractor)
+				}
+			}
+		})
+	}
+}
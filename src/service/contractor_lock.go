@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	log "github.com/sirupsen/logrus"
+)
+
+// contractorLockPoll is how often a message waiting for another instance's contractor lease checks it again
+const contractorLockPoll = time.Second
+
+var (
+	// ErrContractorLocked is returned when another worker instance still holds a contractor's lease after the wait.
+	// That instance is working on the contractor, so the message is retried later.
+	ErrContractorLocked = errors.New("contractor locked by another worker")
+
+	// ErrContractorLockLost cancels a message whose contractor lease could not be renewed or was taken over, so two
+	// instances never go on cleansing the same contractor. Deleting is idempotent, so the message is retried later.
+	ErrContractorLockLost = errors.New("contractor lock lost")
+)
+
+// lockContractorCluster takes the database lease on a contractor, waiting up to lockWait for another instance to
+// release it, and returns the context the message must run under and the function that releases the lease. The
+// lease is renewed every third of lockTTL until then; a renewal that fails or finds the lease taken over cancels
+// the returned context with ErrContractorLockLost as its cause. Without a lock repository only the in-process lock
+// applies and release does nothing.
+func (cs *CleansingServiceImpl) lockContractorCluster(ctx context.Context, contractorID int64) (lockedCtx context.Context, release func(), err error) {
+	if cs.lockRepo == nil {
+		return ctx, func() {}, nil
+	}
+	logger := workerLog.GetLoggerFromContext(ctx)
+	owner := newLockOwner()
+
+	deadline := time.Now().Add(cs.lockWait)
+	for {
+		acquired, err := cs.lockRepo.Acquire(ctx, contractorID, owner, cs.lockTTL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to lock contractor %d: %w", contractorID, err)
+		}
+		if acquired {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			return nil, nil, fmt.Errorf("%w: contractor %d, waited %s", ErrContractorLocked, contractorID, cs.lockWait)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(cs.lockPoll):
+		}
+	}
+
+	// Renewals and the release must still reach the database when the message's context is cancelled
+	lockCtx := context.WithoutCancel(ctx)
+	lockedCtx, cancel := context.WithCancelCause(ctx)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(max(cs.lockTTL/3, time.Millisecond))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				acquired, err := cs.lockRepo.Acquire(lockCtx, contractorID, owner, cs.lockTTL)
+				if err != nil {
+					logger.WithError(err).WithField("contractor_id", contractorID).Error("Failed to renew contractor lock, stopping the message")
+					cancel(fmt.Errorf("%w: contractor %d: renewal failed: %w", ErrContractorLockLost, contractorID, err))
+					return
+				}
+				if !acquired {
+					logger.WithField("contractor_id", contractorID).Error("Contractor lock expired and was taken over by another worker, stopping the message")
+					cancel(fmt.Errorf("%w: contractor %d: taken over by another worker", ErrContractorLockLost, contractorID))
+					return
+				}
+			}
+		}
+	}()
+
+	return lockedCtx, func() {
+		close(stop)
+		<-done
+		cancel(nil)
+		if err := cs.lockRepo.Release(lockCtx, contractorID, owner); err != nil {
+			logger.WithError(err).WithFields(log.Fields{
+				"contractor_id": contractorID,
+				"lock_ttl":      cs.lockTTL.String(),
+			}).Warn("Failed to release contractor lock, it lapses once its lease expires")
+		}
+	}, nil
+}
+
+// newLockOwner identifies one lease holder: the host and process, and a random part telling apart the messages
+// of one process
+func newLockOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	suffix := make([]byte, 8)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/repository"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+	"gorm.io/gorm"
+)
+
+// newLockingCleansingService builds a database-backed CleansingService locking contractors through db
+func newLockingCleansingService(db *gorm.DB, cfg *config.Config) *CleansingServiceImpl {
+	service := NewCleansingServiceWithConfig(cfg, &NullS3Service{},
+		repository.NewContractorRepository(db),
+		repository.NewUserContractorRepository(db),
+		repository.NewViewerContractorRepository(db),
+		repository.NewContractorProjectRepository(db),
+		repository.NewProjectRepository(db),
+		repository.NewSiteRepository(db),
+		repository.NewDocumentGroupRepository(db),
+		repository.NewDocumentRepository(db),
+		repository.NewFileRepository(db),
+		repository.NewUploaderContractorUsageRepository(db),
+		repository.NewTxManager(db),
+		repository.NewContractorLockRepository(db),
+	).(*CleansingServiceImpl)
+	service.lockPoll = 5 * time.Millisecond
+	return service
+}
+
+func TestCleansingService_DB_ContractorLockContention(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	locks := repository.NewContractorLockRepository(db)
+	service := newLockingCleansingService(db, &config.Config{ContractorLockTTL: time.Minute, ContractorLockWait: 30 * time.Millisecond})
+	message := dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: testutil.SecondSiteID}
+	ctx := context.Background()
+
+	// Another instance is cleansing the contractor and holds its lock past the wait
+	if acquired, err := locks.Acquire(ctx, testutil.ContractorID, "other-worker", time.Minute); err != nil || !acquired {
+		t.Fatalf("Failed to take the lock for another worker: %v", err)
+	}
+	result, err := service.ProcessCleansingMessage(ctx, message)
+	if !errors.Is(err, ErrContractorLocked) {
+		t.Fatalf("Expected ErrContractorLocked, got %v", err)
+	}
+	if result == nil || result.Success {
+		t.Errorf("Expected an unsuccessful result, got %+v", result)
+	}
+	if count := countRows(t, db, &entity.Site{}, "id = ?", testutil.SecondSiteID); count != 1 {
+		t.Errorf("Expected the site to remain while locked, got %d rows", count)
+	}
+
+	// Once the other instance is done, the message goes through and leaves no lock behind
+	if err := locks.Release(ctx, testutil.ContractorID, "other-worker"); err != nil {
+		t.Fatalf("Failed to release the other worker's lock: %v", err)
+	}
+	result, err = service.ProcessCleansingMessage(ctx, message)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Success {
+		t.Errorf("Expected a successful result, got %+v", result)
+	}
+	if count := countRows(t, db, &entity.ContractorLock{}, "contractor_id = ?", testutil.ContractorID); count != 0 {
+		t.Errorf("Expected the contractor lock to be released, got %d rows", count)
+	}
+}
+
+func TestCleansingService_DB_ContractorLockWaits(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	locks := repository.NewContractorLockRepository(db)
+	service := newLockingCleansingService(db, &config.Config{ContractorLockTTL: time.Minute, ContractorLockWait: 5 * time.Second})
+	ctx := context.Background()
+
+	if acquired, err := locks.Acquire(ctx, testutil.ContractorID, "other-worker", time.Minute); err != nil || !acquired {
+		t.Fatalf("Failed to take the lock for another worker: %v", err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		locks.Release(ctx, testutil.ContractorID, "other-worker")
+	}()
+
+	_, release, err := service.lockContractorCluster(ctx, testutil.ContractorID)
+	if err != nil {
+		t.Fatalf("Expected the lock once the other worker released it, got %v", err)
+	}
+	release()
+}
+
+func TestCleansingService_DB_ContractorLockRenewal(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	locks := repository.NewContractorLockRepository(db)
+	service := newLockingCleansingService(db, &config.Config{ContractorLockTTL: 30 * time.Millisecond})
+	ctx := context.Background()
+
+	_, release, err := service.lockContractorCluster(ctx, testutil.ContractorID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The lease is renewed while held, so it does not lapse however long the message takes
+	time.Sleep(100 * time.Millisecond)
+	if acquired, err := locks.Acquire(ctx, testutil.ContractorID, "other-worker", time.Minute); err != nil || acquired {
+		t.Errorf("Expected a renewed lock to refuse another worker, got acquired %v, error %v", acquired, err)
+	}
+
+	release()
+	if acquired, err := locks.Acquire(ctx, testutil.ContractorID, "other-worker", time.Minute); err != nil || !acquired {
+		t.Errorf("Expected a released lock to be free, got acquired %v, error %v", acquired, err)
+	}
+}
+
+// failingRenewalLockRepository grants the first Acquire and fails every renewal
+type failingRenewalLockRepository struct {
+	repository.ContractorLockRepository
+	calls int
+}
+
+func (r *failingRenewalLockRepository) Acquire(ctx context.Context, contractorID int64, owner string, ttl time.Duration) (bool, error) {
+	r.calls++
+	if r.calls > 1 {
+		return false, errors.New("connection reset")
+	}
+	return r.ContractorLockRepository.Acquire(ctx, contractorID, owner, ttl)
+}
+
+func TestCleansingService_DB_ContractorLockLost(t *testing.T) {
+	tests := []struct {
+		name          string
+		failRenewal   bool
+		takeOverLease bool
+	}{
+		{name: "renewal fails", failRenewal: true},
+		{name: "lease taken over", takeOverLease: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewMigratedDB(t)
+			service := newLockingCleansingService(db, &config.Config{ContractorLockTTL: 30 * time.Millisecond})
+			if tt.failRenewal {
+				service.lockRepo = &failingRenewalLockRepository{ContractorLockRepository: service.lockRepo}
+			}
+
+			lockedCtx, release, err := service.lockContractorCluster(context.Background(), testutil.ContractorID)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer release()
+			if tt.takeOverLease {
+				if err := db.Model(&entity.ContractorLock{}).Where("contractor_id = ?", testutil.ContractorID).Update("owner", "other-worker").Error; err != nil {
+					t.Fatalf("Failed to hand the lease to another worker: %v", err)
+				}
+			}
+
+			// The message must stop rather than go on alongside another instance
+			select {
+			case <-lockedCtx.Done():
+			case <-time.After(time.Second):
+				t.Fatal("Expected the message context to be cancelled")
+			}
+			if cause := context.Cause(lockedCtx); !errors.Is(cause, ErrContractorLockLost) {
+				t.Errorf("Expected ErrContractorLockLost as the cause, got %v", cause)
+			}
+		})
+	}
+}
+
+func TestCleansingService_ContractorLockDisabled(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	service := newLockingCleansingService(db, &config.Config{})
+	if service.lockRepo != nil {
+		t.Error("Expected no database lock without CONTRACTOR_LOCK_TTL")
+	}
+}
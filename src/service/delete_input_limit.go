@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"github.com/denys89/wadugs-worker-cleansing/src/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrDeleteInputTooLarge is returned when DeleteObjects is handed more objects than its hard maximum. The same
+// input fails the same way again, so it is not retried; DeleteObjectsStream handles such sets without holding
+// them in memory.
+var ErrDeleteInputTooLarge = errors.New("delete input too large")
+
+type largeDeleteAllowedKey struct{}
+
+// withLargeDeleteAllowed returns a context under which DeleteObjects accepts inputs beyond its hard maximum,
+// as for a message overriding the object limit
+func withLargeDeleteAllowed(ctx context.Context) context.Context {
+	return context.WithValue(ctx, largeDeleteAllowedKey{}, true)
+}
+
+// largeDeleteAllowed reports whether withLargeDeleteAllowed was applied to ctx
+func largeDeleteAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(largeDeleteAllowedKey{}).(bool)
+	return allowed
+}
+
+// checkDeleteInputSize guards DeleteObjects against inputs too large to hold in memory comfortably: beyond the warn
+// threshold it logs a warning and counts the input, beyond the hard maximum it rejects the input unless ctx allows
+// it. A zero threshold or maximum disables that check.
+func (s3s *S3ServiceImpl) checkDeleteInputSize(ctx context.Context, count int) error {
+	logger := workerLog.GetLoggerFromContext(ctx).WithFields(log.Fields{
+		"object_count":   count,
+		"warn_threshold": s3s.deleteWarnThreshold,
+		"hard_max":       s3s.deleteHardMax,
+	})
+
+	if s3s.deleteHardMax > 0 && count > s3s.deleteHardMax {
+		if !largeDeleteAllowed(ctx) {
+			metrics.LargeDeleteInputs.WithLabelValues("rejected").Inc()
+			logger.Error("Refusing to delete more objects than the hard maximum at once, use DeleteObjectsStream")
+			return fmt.Errorf("%w: %d objects, hard maximum is %d", ErrDeleteInputTooLarge, count, s3s.deleteHardMax)
+		}
+		metrics.LargeDeleteInputs.WithLabelValues("overridden").Inc()
+		logger.Warn("Hard maximum of objects deleted at once overridden, consider DeleteObjectsStream")
+		return nil
+	}
+	if s3s.deleteWarnThreshold > 0 && count > s3s.deleteWarnThreshold {
+		metrics.LargeDeleteInputs.WithLabelValues("warned").Inc()
+		logger.Warn("Large number of objects deleted at once, consider DeleteObjectsStream")
+	}
+	return nil
+}
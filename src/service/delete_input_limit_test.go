@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestS3Service_DeleteObjects_InputSizeLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		objectCount int
+		allowLarge  bool
+		wantErr     error
+		wantDeleted int
+		wantOutcome string // LargeDeleteInputs label expected to be counted once, if any
+	}{
+		{name: "under threshold", objectCount: 3, wantDeleted: 3},
+		{name: "at threshold", objectCount: 5, wantDeleted: 5},
+		{name: "over threshold warns", objectCount: 8, wantDeleted: 8, wantOutcome: "warned"},
+		{name: "over hard max is rejected", objectCount: 12, wantErr: ErrDeleteInputTooLarge, wantOutcome: "rejected"},
+		{name: "over hard max when overridden", objectCount: 12, allowLarge: true, wantDeleted: 12, wantOutcome: "overridden"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockS3Client{}
+			service := NewS3Service(client, aws.Config{}, &config.Config{S3DeleteWarnThreshold: 5, S3DeleteHardMax: 10}, nil).(*S3ServiceImpl)
+
+			objects := make([]dto.S3Object, tt.objectCount)
+			for i := range objects {
+				objects[i] = dto.S3Object{Bucket: "test-bucket", Key: fmt.Sprintf("PRJ/SITE/00_Upload/file-%d.ini", i)}
+			}
+			ctx := context.Background()
+			if tt.allowLarge {
+				ctx = withLargeDeleteAllowed(ctx)
+			}
+
+			before := map[string]float64{}
+			for _, outcome := range []string{"warned", "rejected", "overridden"} {
+				before[outcome] = testutil.ToFloat64(metrics.LargeDeleteInputs.WithLabelValues(outcome))
+			}
+
+			deleted, err := service.DeleteObjects(ctx, objects)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if deleted != tt.wantDeleted || len(client.deletedKeys) != tt.wantDeleted {
+				t.Errorf("Expected %d deleted objects, got %d (%d sent to S3)", tt.wantDeleted, deleted, len(client.deletedKeys))
+			}
+
+			for outcome, count := range before {
+				want := 0.0
+				if outcome == tt.wantOutcome {
+					want = 1
+				}
+				if got := testutil.ToFloat64(metrics.LargeDeleteInputs.WithLabelValues(outcome)) - count; got != want {
+					t.Errorf("Expected the %s counter to increase by %v, got %v", outcome, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestS3Service_DeleteObjects_InputSizeLimitsDisabled(t *testing.T) {
+	client := &mockS3Client{}
+	objects := make([]dto.S3Object, 20)
+	for i := range objects {
+		objects[i] = dto.S3Object{Bucket: "test-bucket", Key: fmt.Sprintf("key-%d", i)}
+	}
+
+	before := testutil.ToFloat64(metrics.LargeDeleteInputs.WithLabelValues("warned"))
+	if deleted, err := newTestS3Service(client).DeleteObjects(context.Background(), objects); err != nil || deleted != 20 {
+		t.Errorf("Expected 20 deleted objects without limits, got %d (%v)", deleted, err)
+	}
+	if got := testutil.ToFloat64(metrics.LargeDeleteInputs.WithLabelValues("warned")) - before; got != 0 {
+		t.Errorf("Expected no warning without a threshold, got %v", got)
+	}
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+)
+
+func TestSampleObjects(t *testing.T) {
+	objects := make([]dto.S3Object, 10)
+	for i := range objects {
+		objects[i] = dto.S3Object{Key: fmt.Sprintf("P1/S1/%d.txt", i)}
+	}
+
+	tests := []struct {
+		size     int
+		wantKeys []string
+	}{
+		{size: 0, wantKeys: keysOf(objects)},
+		{size: 20, wantKeys: keysOf(objects)},
+		{size: 1, wantKeys: []string{"P1/S1/0.txt"}},
+		{size: 3, wantKeys: []string{"P1/S1/0.txt", "P1/S1/3.txt", "P1/S1/6.txt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.size), func(t *testing.T) {
+			got := keysOf(sampleObjects(objects, tt.size))
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantKeys) {
+				t.Errorf("Expected %v, got %v", tt.wantKeys, got)
+			}
+		})
+	}
+}
+
+// keysOf returns the keys of objects in order
+func keysOf(objects []dto.S3Object) []string {
+	keys := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	return keys
+}
+
+func TestS3Service_DeleteObjectsByBucket_Verify(t *testing.T) {
+	objects := []dto.S3Object{
+		{Bucket: "bucket-a", Key: "P1/S1/a1.txt"},
+		{Bucket: "bucket-a", Key: "P1/S1/a2.txt"},
+		{Bucket: "bucket-a", Key: "P1/S1/a3.txt"},
+		{Bucket: "bucket-a", Key: "P1/S1/a4.txt"},
+	}
+
+	tests := []struct {
+		name        string
+		cfg         config.Config
+		existing    string // Key HeadObject still finds after the delete
+		headErr     error  // Error HeadObject returns for every other key
+		wantChecked int
+		wantDeleted int
+		wantErr     error
+	}{
+		{name: "disabled", cfg: config.Config{}, existing: "P1/S1/a2.txt", wantDeleted: 4},
+		{name: "every key gone", cfg: config.Config{S3DeleteVerify: true}, wantChecked: 4, wantDeleted: 4},
+		{name: "key still exists", cfg: config.Config{S3DeleteVerify: true}, existing: "P1/S1/a2.txt", wantChecked: 4, wantDeleted: 3, wantErr: ErrDeleteNotVerified},
+		{name: "sample", cfg: config.Config{S3DeleteVerify: true, S3DeleteVerifySample: 2}, existing: "P1/S1/a3.txt", wantChecked: 2, wantDeleted: 3, wantErr: ErrDeleteNotVerified},
+		{name: "key outside the sample", cfg: config.Config{S3DeleteVerify: true, S3DeleteVerifySample: 2}, existing: "P1/S1/a2.txt", wantChecked: 2, wantDeleted: 4},
+		{name: "check fails", cfg: config.Config{S3DeleteVerify: true}, headErr: errors.New("access denied"), wantDeleted: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var checked []string
+			client := &mockS3Client{
+				headObjectFn: func(key string) (*s3.HeadObjectOutput, error) {
+					mu.Lock()
+					checked = append(checked, key)
+					mu.Unlock()
+					if key == tt.existing {
+						return &s3.HeadObjectOutput{ContentLength: aws.Int64(1)}, nil
+					}
+					if tt.headErr != nil {
+						return nil, tt.headErr
+					}
+					return nil, &types.NotFound{}
+				},
+			}
+			s3s := NewS3Service(client, aws.Config{}, &tt.cfg, nil)
+
+			results, err := s3s.DeleteObjectsByBucket(context.Background(), objects)
+			switch {
+			case tt.headErr != nil:
+				if err == nil || errors.Is(err, ErrDeleteNotVerified) {
+					t.Errorf("Expected the failed check to be returned, got %v", err)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Expected %v, got %v", tt.wantErr, err)
+				}
+			case err != nil:
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if tt.headErr == nil && len(checked) != tt.wantChecked {
+				t.Errorf("Expected %d keys checked, got %v", tt.wantChecked, checked)
+			}
+			if len(results) != 1 {
+				t.Fatalf("Expected one bucket result, got %+v", results)
+			}
+			if results[0].Deleted != tt.wantDeleted || results[0].Failed != len(objects)-tt.wantDeleted {
+				t.Errorf("Expected %d deleted and %d failed, got %+v", tt.wantDeleted, len(objects)-tt.wantDeleted, results[0])
+			}
+		})
+	}
+}
+
+func TestS3Service_EmptyBucket_Verify(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string // Key HeadObject still finds after the delete
+		wantErr  error
+	}{
+		{name: "every key gone"},
+		{name: "key still exists", existing: "P1/S1/b.txt", wantErr: ErrDeleteNotVerified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var checked []string
+			client := &mockS3Client{
+				listKeys:   []string{"P1/S1/a.txt", "P1/S1/b.txt"},
+				bucketTags: ownerTags("7"),
+				headObjectFn: func(key string) (*s3.HeadObjectOutput, error) {
+					mu.Lock()
+					checked = append(checked, key)
+					mu.Unlock()
+					if key == tt.existing {
+						return &s3.HeadObjectOutput{ContentLength: aws.Int64(1)}, nil
+					}
+					return nil, &types.NotFound{}
+				},
+			}
+			s3s := NewS3Service(client, aws.Config{}, &config.Config{S3DeleteVerify: true}, nil)
+
+			err := s3s.EmptyBucket(context.Background(), "contractor-bucket", "", 7)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Expected %v, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if len(checked) != 2 {
+				t.Errorf("Expected the wiped keys to be checked, got %v", checked)
+			}
+		})
+	}
+}
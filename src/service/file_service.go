@@ -2,22 +2,47 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync/atomic"
 
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
 	"github.com/denys89/wadugs-worker-cleansing/src/dto"
 	"github.com/denys89/wadugs-worker-cleansing/src/entity"
 	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
 	"github.com/denys89/wadugs-worker-cleansing/src/repository"
+	"github.com/denys89/wadugs-worker-cleansing/src/tracing"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
 )
 
 type (
 	// FileService defines the interface for file operations and business logic
 	FileService interface {
-		GetContractorFiles(ctx context.Context, contractorID int64) ([]dto.S3Object, error)
-		GetProjectFiles(ctx context.Context, projectID int64) ([]dto.S3Object, error)
-		GetSiteFiles(ctx context.Context, siteID int64) ([]dto.S3Object, error)
+		GetContractorFiles(ctx context.Context, contractorID int64, opts ...FileOption) ([]dto.S3Object, error)
+		GetProjectFiles(ctx context.Context, projectID int64, opts ...FileOption) ([]dto.S3Object, error)
+		GetSiteFiles(ctx context.Context, siteID int64, opts ...FileOption) ([]dto.S3Object, error)
+		// CountProjectFiles returns how many files, and how many bytes, a project cleanse would touch
+		CountProjectFiles(ctx context.Context, projectID int64) (count int, bytes int64, err error)
+		// CountSiteFiles returns how many files, and how many bytes, a site cleanse would touch
+		CountSiteFiles(ctx context.Context, siteID int64) (count int, bytes int64, err error)
+		// GetSiteLocation returns the bucket, region and key prefixes under which a site's files are stored
+		GetSiteLocation(ctx context.Context, siteID int64) (*SiteLocation, error)
+		// GetProjectLocation returns the bucket, region and key prefixes of every site of a project
+		GetProjectLocation(ctx context.Context, projectID int64) (*SiteLocation, error)
+	}
+
+	// SiteLocation is where a site's files are stored in S3
+	SiteLocation struct {
+		Bucket   string
+		Region   string
+		Prefixes []string // Upload and processed key prefixes
+
+		// Key prefixes of the processed outputs of document groups whose processing has not finished, which
+		// the database does not expect yet; only GetSiteLocation sets them
+		Pending []string
 	}
 
 	// FileServiceImpl implements the FileService interface
@@ -29,9 +54,167 @@ type (
 		documentGroupRepo     repository.DocumentGroupRepository
 		documentRepo          repository.DocumentRepository
 		fileRepo              repository.FileRepository
+		documentProcessRepo   repository.DocumentProcessRepository // Optional; nil reads documents group by group
+		readRetry             readRetryPolicy
+		keyTemplates          *KeyTemplates
+		siteConcurrency       int
+		defaultRegion         string // Region used for contractors without a bucket region
+		logKeyPlan            bool   // Log every computed key at debug level
+		fileReadBatch         int    // Documents whose files are read per query when walking a group; 0 reads one at a time
+	}
+
+	// FileOption customizes a single FileService traversal
+	FileOption func(*fileOptions)
+
+	// fileOptions holds the resolved traversal options
+	fileOptions struct {
+		failFast        bool
+		category        string
+		scope           string
+		includeInactive bool
+		includeDeleted  bool
+		createdAfter    int64 // Unix seconds; 0 leaves the bound open
+		createdBefore   int64 // Unix seconds; 0 leaves the bound open
+		skipped         *atomic.Int64
+	}
+
+	// fileTotals is the number and total size in bytes of a set of files
+	fileTotals struct {
+		count int64
+		bytes int64
+	}
+
+	// rawFileIndex holds the raw upload objects of documents read in bulk, keyed by document group ID
+	rawFileIndex map[int64][]dto.S3Object
+
+	// projectSite pairs a site with the project it belongs to
+	projectSite struct {
+		project entity.Project
+		site    entity.Site
 	}
 )
 
+// errNoContractor is returned by resolveSite for a project missing from the contractor_project table
+var errNoContractor = errors.New("project has no contractor association")
+
+// WithFailFast makes a traversal return the first per-entity read error instead of
+// logging it and continuing with a best-effort (possibly incomplete) key set. A cleanse refuses an incomplete key
+// set anyway, so it stops at the first unreadable record rather than reading the rest for nothing.
+func WithFailFast() FileOption {
+	return func(o *fileOptions) {
+		o.failFast = true
+	}
+}
+
+// WithSkipCounter makes a traversal add the number of entities it failed to read to counter: those a best-effort
+// traversal skipped, or the one a fail-fast traversal stopped at. A caller can then tell an incomplete key set from
+// a complete one, and a read failure from any other error.
+func WithSkipCounter(counter *atomic.Int64) FileOption {
+	return func(o *fileOptions) {
+		o.skipped = counter
+	}
+}
+
+// WithCategory restricts a traversal to document groups of the given category.
+// An empty category matches every group.
+func WithCategory(category string) FileOption {
+	return func(o *fileOptions) {
+		o.category = category
+	}
+}
+
+// WithScope restricts a traversal to raw uploads (dto.ScopeRaw) or processed outputs (dto.ScopeProcessed).
+// An empty scope or dto.ScopeAll includes both.
+func WithScope(scope string) FileOption {
+	return func(o *fileOptions) {
+		o.scope = scope
+	}
+}
+
+// WithIncludeInactive makes a traversal include inactive document groups, which are skipped by default
+// since business logic already considers them removed. A full contractor purge needs every group.
+func WithIncludeInactive() FileOption {
+	return func(o *fileOptions) {
+		o.includeInactive = true
+	}
+}
+
+// WithIncludeDeleted makes a contractor traversal include soft-deleted projects, which are skipped by default
+// since they were already cleansed. A full contractor purge needs every project.
+func WithIncludeDeleted() FileOption {
+	return func(o *fileOptions) {
+		o.includeDeleted = true
+	}
+}
+
+// WithCreatedWindow restricts a traversal to files created strictly after createdAfter and before createdBefore,
+// Unix seconds compared with the file records' created_at in the file queries; 0 leaves a bound open. Processed outputs have no file
+// record, so the S3 service compares their last modified time instead.
+func WithCreatedWindow(createdAfter, createdBefore int64) FileOption {
+	return func(o *fileOptions) {
+		o.createdAfter = createdAfter
+		o.createdBefore = createdBefore
+	}
+}
+
+// includesGroup reports whether the traversal covers a document group
+func (o fileOptions) includesGroup(docGroup entity.DocumentGroup) bool {
+	if !o.includeInactive && docGroup.Status != entity.DocumentGroupStatusActive {
+		return false
+	}
+	return o.category == "" || docGroup.Category == o.category
+}
+
+// skip records an entity the traversal failed to read and left out
+func (o fileOptions) skip() {
+	if o.skipped != nil {
+		o.skipped.Add(1)
+	}
+}
+
+// unreadable records an entity the traversal failed to read and reports whether the traversal stops there, as it
+// does with fail-fast or once ctx is done; otherwise the entity is left out. A read cut short by ctx is not counted.
+func (o fileOptions) unreadable(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	o.skip()
+	return o.failFast
+}
+
+// hasCreatedWindow reports whether the traversal is restricted by creation time
+func (o fileOptions) hasCreatedWindow() bool {
+	return o.createdAfter != 0 || o.createdBefore != 0
+}
+
+// createdWithin reports whether a time in Unix seconds falls within the traversal's creation window. File records
+// are restricted by their queries, so this checks the S3 last modified times of the objects built from them.
+func (o fileOptions) createdWithin(timestamp int64) bool {
+	if o.createdAfter != 0 && timestamp <= o.createdAfter {
+		return false
+	}
+	return o.createdBefore == 0 || timestamp < o.createdBefore
+}
+
+// includesRaw reports whether the traversal covers uploaded files
+func (o fileOptions) includesRaw() bool {
+	return o.scope != dto.ScopeProcessed
+}
+
+// includesProcessed reports whether the traversal covers processed outputs
+func (o fileOptions) includesProcessed() bool {
+	return o.scope != dto.ScopeRaw
+}
+
+// newFileOptions applies the given options over the best-effort defaults
+func newFileOptions(opts []FileOption) fileOptions {
+	var options fileOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
 // NewFileService creates a new file service instance
 func NewFileService(
 	contractorRepo repository.ContractorRepository,
@@ -41,7 +224,16 @@ func NewFileService(
 	documentGroupRepo repository.DocumentGroupRepository,
 	documentRepo repository.DocumentRepository,
 	fileRepo repository.FileRepository,
+	documentProcessRepo repository.DocumentProcessRepository,
+	cfg *config.Config,
 ) FileService {
+	// Startup validates the templates through the resolver; this only guards direct construction
+	keyTemplates, err := NewKeyTemplates(cfg)
+	if err != nil {
+		log.WithError(err).Error("Invalid S3 key templates, using defaults")
+		keyTemplates, _ = NewKeyTemplates(&config.Config{})
+	}
+
 	return &FileServiceImpl{
 		contractorRepo:        contractorRepo,
 		contractorProjectRepo: contractorProjectRepo,
@@ -50,86 +242,91 @@ func NewFileService(
 		documentGroupRepo:     documentGroupRepo,
 		documentRepo:          documentRepo,
 		fileRepo:              fileRepo,
+		documentProcessRepo:   documentProcessRepo,
+		readRetry:             newReadRetryPolicy(cfg),
+		keyTemplates:          keyTemplates,
+		siteConcurrency:       max(cfg.SiteListConcurrency, 1),
+		defaultRegion:         cfg.AWSRegion,
+		logKeyPlan:            cfg.LogKeyPlan,
+		fileReadBatch:         max(cfg.FileReadBatchSize, 0),
 	}
 }
 
 // GetContractorFiles gets all file information for a contractor from the database
-func (fs *FileServiceImpl) GetContractorFiles(ctx context.Context, contractorID int64) ([]dto.S3Object, error) {
+func (fs *FileServiceImpl) GetContractorFiles(ctx context.Context, contractorID int64, opts ...FileOption) (objects []dto.S3Object, err error) {
+	ctx, span := tracing.Start(ctx, "files.get_contractor_files", attribute.Int64("contractor_id", contractorID))
+	defer func() { tracing.End(span, err) }()
+
 	logger := workerLog.GetLoggerFromContext(ctx)
 	logger.WithField("contractor_id", contractorID).Info("Getting contractor files from database")
 
-	var allObjects []dto.S3Object
+	options := newFileOptions(opts)
 
 	// Get the contractor information first to access bucket details
-	contractor, err := fs.contractorRepo.GetByID(ctx, contractorID)
+	contractor, err := retryRead(ctx, fs.readRetry, func() (*entity.Contractor, error) {
+		return fs.contractorRepo.GetByID(ctx, contractorID)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get contractor %d: %w", contractorID, err)
 	}
 
 	// 1. Query the database to get all projects for this contractor
-	projects, err := fs.projectRepo.GetByContractorID(ctx, contractorID)
+	projects, err := retryRead(ctx, fs.readRetry, func() (entity.Projects, error) {
+		return fs.projectRepo.GetByContractorID(ctx, contractorID, options.includeDeleted)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get projects for contractor %d: %w", contractorID, err)
 	}
 
 	logger.WithField("project_count", len(projects)).Info("Found projects for contractor")
 
-	// Process each project
+	// Gather the sites of every project, then read them concurrently
+	var sites []projectSite
 	for _, project := range projects {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		// 2. For each project, get all sites
-		sites, err := fs.siteRepo.GetByProjectID(ctx, project.Id)
+		projectSites, err := retryRead(ctx, fs.readRetry, func() (entity.Sites, error) {
+			return fs.siteRepo.GetByProjectID(ctx, project.Id)
+		})
 		if err != nil {
+			if options.unreadable(ctx) {
+				return nil, fmt.Errorf("failed to get sites for project %d: %w", project.Id, err)
+			}
 			logger.WithError(err).WithField("project_id", project.Id).Warn("Failed to get sites for project")
 			continue
 		}
 
 		logger.WithFields(log.Fields{
 			"project_id": project.Id,
-			"site_count": len(sites),
+			"site_count": len(projectSites),
 		}).Debug("Found sites for project")
 
-		// Process each site
-		for _, site := range sites {
-			// 3. For each site, get all document groups
-			documentGroups, err := fs.documentGroupRepo.GetBySiteID(ctx, site.Id)
-			if err != nil {
-				logger.WithError(err).WithField("site_id", site.Id).Warn("Failed to get document groups for site")
-				continue
-			}
-
-			// Process each document group
-			for _, docGroup := range documentGroups {
-				// 4. For each document group, get all documents
-				documents, err := fs.documentRepo.GetByGroupID(ctx, docGroup.Id)
-				if err != nil {
-					logger.WithError(err).WithField("group_id", docGroup.Id).Warn("Failed to get documents for group")
-					continue
-				}
-
-				// Process each document
-				for _, document := range documents {
-					// 5. For each document, get all files
-					files, err := fs.fileRepo.GetByDocumentID(ctx, document.Id)
-					if err != nil {
-						logger.WithError(err).WithField("document_id", document.Id).Warn("Failed to get files for document")
-						continue
-					}
-
-					// 6. For each file, build S3 object information
-					for _, file := range files {
-						// Build S3 key based on the file path structure
-						s3Objects := fs.buildS3ObjectsFromFile(project, site, docGroup, file, *contractor)
-						allObjects = append(allObjects, s3Objects...)
-					}
-				}
+		for _, site := range projectSites {
+			sites = append(sites, projectSite{project: project, site: site})
+		}
+	}
 
-				// Handle processed files if they exist
-				if (docGroup.Progress == 40 || docGroup.Progress == 11) && docGroup.ProcessedName != "" {
-					processedObjects := fs.buildProcessedS3Objects(project, site, docGroup, *contractor)
-					allObjects = append(allObjects, processedObjects...)
-				}
+	raw := fs.readRawFileIndex(ctx, *contractor, options, func() (entity.DocumentProcesses, error) {
+		var processes entity.DocumentProcesses
+		for _, project := range projects {
+			if err := ctx.Err(); err != nil {
+				return nil, err
 			}
+			projectProcesses, err := fs.documentProcessRepo.GetByProjectID(ctx, project.Id)
+			if err != nil {
+				return nil, err
+			}
+			processes = append(processes, projectProcesses...)
 		}
+		return processes, nil
+	})
+
+	allObjects, err := fs.collectSitesFiles(ctx, sites, *contractor, options, raw)
+	if err != nil {
+		return nil, err
 	}
 
 	logger.WithFields(log.Fields{
@@ -141,20 +338,28 @@ func (fs *FileServiceImpl) GetContractorFiles(ctx context.Context, contractorID
 }
 
 // GetProjectFiles gets all file information for a project from the database
-func (fs *FileServiceImpl) GetProjectFiles(ctx context.Context, projectID int64) ([]dto.S3Object, error) {
+func (fs *FileServiceImpl) GetProjectFiles(ctx context.Context, projectID int64, opts ...FileOption) (objects []dto.S3Object, err error) {
+	ctx, span := tracing.Start(ctx, "files.get_project_files", attribute.Int64("project_id", projectID))
+	defer func() { tracing.End(span, err) }()
+
 	logger := workerLog.GetLoggerFromContext(ctx)
 	logger.WithField("project_id", projectID).Info("Getting project files from database")
 
+	options := newFileOptions(opts)
 	var allObjects []dto.S3Object
 
 	// Get the project
-	project, err := fs.projectRepo.GetByID(ctx, projectID)
+	project, err := retryRead(ctx, fs.readRetry, func() (*entity.Project, error) {
+		return fs.projectRepo.GetByID(ctx, projectID)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get project %d: %w", projectID, err)
 	}
 
 	// Get contractor_id from contractor_project join table
-	contractorProject, err := fs.contractorProjectRepo.GetByProjectID(ctx, projectID)
+	contractorProject, err := retryRead(ctx, fs.readRetry, func() (*entity.ContractorProject, error) {
+		return fs.contractorProjectRepo.GetByProjectID(ctx, projectID)
+	})
 	if err != nil {
 		logger.WithFields(log.Fields{
 			"project_id": projectID,
@@ -164,59 +369,35 @@ func (fs *FileServiceImpl) GetProjectFiles(ctx context.Context, projectID int64)
 	}
 
 	// Get the contractor information to access bucket details
-	contractor, err := fs.contractorRepo.GetByID(ctx, contractorProject.ContractorId)
+	contractor, err := retryRead(ctx, fs.readRetry, func() (*entity.Contractor, error) {
+		return fs.contractorRepo.GetByID(ctx, contractorProject.ContractorId)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get contractor %d for project %d: %w", contractorProject.ContractorId, projectID, err)
 	}
 
 	// Get all sites for this project
-	sites, err := fs.siteRepo.GetByProjectID(ctx, projectID)
+	sites, err := retryRead(ctx, fs.readRetry, func() (entity.Sites, error) {
+		return fs.siteRepo.GetByProjectID(ctx, projectID)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get sites for project %d: %w", projectID, err)
 	}
 
 	logger.WithField("site_count", len(sites)).Info("Found sites for project")
 
-	// Process each site
+	projectSites := make([]projectSite, 0, len(sites))
 	for _, site := range sites {
-		// Get all document groups for this site
-		documentGroups, err := fs.documentGroupRepo.GetBySiteID(ctx, site.Id)
-		if err != nil {
-			logger.WithError(err).WithField("site_id", site.Id).Warn("Failed to get document groups for site")
-			continue
-		}
-
-		// Process each document group
-		for _, docGroup := range documentGroups {
-			// Get all documents for this group
-			documents, err := fs.documentRepo.GetByGroupID(ctx, docGroup.Id)
-			if err != nil {
-				logger.WithError(err).WithField("group_id", docGroup.Id).Warn("Failed to get documents for group")
-				continue
-			}
-
-			// Process each document
-			for _, document := range documents {
-				// Get all files for this document
-				files, err := fs.fileRepo.GetByDocumentID(ctx, document.Id)
-				if err != nil {
-					logger.WithError(err).WithField("document_id", document.Id).Warn("Failed to get files for document")
-					continue
-				}
+		projectSites = append(projectSites, projectSite{project: *project, site: site})
+	}
 
-				// Build S3 objects from files
-				for _, file := range files {
-					s3Objects := fs.buildS3ObjectsFromFile(*project, site, docGroup, file, *contractor)
-					allObjects = append(allObjects, s3Objects...)
-				}
-			}
+	raw := fs.readRawFileIndex(ctx, *contractor, options, func() (entity.DocumentProcesses, error) {
+		return fs.documentProcessRepo.GetByProjectID(ctx, projectID)
+	})
 
-			// Handle processed files if they exist
-			if (docGroup.Progress == 40 || docGroup.Progress == 11) && docGroup.ProcessedName != "" {
-				processedObjects := fs.buildProcessedS3Objects(*project, site, docGroup, *contractor)
-				allObjects = append(allObjects, processedObjects...)
-			}
-		}
+	allObjects, err = fs.collectSitesFiles(ctx, projectSites, *contractor, options, raw)
+	if err != nil {
+		return nil, err
 	}
 
 	logger.WithFields(log.Fields{
@@ -228,91 +409,508 @@ func (fs *FileServiceImpl) GetProjectFiles(ctx context.Context, projectID int64)
 }
 
 // GetSiteFiles gets all file information for a site from the database
-func (fs *FileServiceImpl) GetSiteFiles(ctx context.Context, siteID int64) ([]dto.S3Object, error) {
+func (fs *FileServiceImpl) GetSiteFiles(ctx context.Context, siteID int64, opts ...FileOption) (objects []dto.S3Object, err error) {
+	ctx, span := tracing.Start(ctx, "files.get_site_files", attribute.Int64("site_id", siteID))
+	defer func() { tracing.End(span, err) }()
+
 	logger := workerLog.GetLoggerFromContext(ctx)
 	logger.WithField("site_id", siteID).Info("Getting site files from database")
 
+	options := newFileOptions(opts)
 	var allObjects []dto.S3Object
 
+	project, site, contractor, err := fs.resolveSite(ctx, siteID)
+	if errors.Is(err, errNoContractor) {
+		logger.WithFields(log.Fields{
+			"site_id":    siteID,
+			"project_id": site.ProjectId,
+			"error":      err.Error(),
+		}).Warn("Project has no contractor association in contractor_project table, skipping file deletion")
+		return allObjects, nil // Return empty list, no files to delete
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	raw := fs.readRawFileIndex(ctx, *contractor, options, func() (entity.DocumentProcesses, error) {
+		return fs.documentProcessRepo.GetBySiteID(ctx, siteID)
+	})
+
+	allObjects, err = fs.collectSiteFiles(ctx, *project, *site, *contractor, options, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.WithFields(log.Fields{
+		"site_id":     siteID,
+		"total_files": len(allObjects),
+	}).Info("Retrieved site files from database")
+
+	return allObjects, nil
+}
+
+// GetSiteLocation returns the contractor bucket and region of a site and the upload and processed prefixes
+// its files are stored under
+func (fs *FileServiceImpl) GetSiteLocation(ctx context.Context, siteID int64) (*SiteLocation, error) {
+	project, site, contractor, err := fs.resolveSite(ctx, siteID)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadPrefix, err := fs.keyTemplates.UploadPrefix(*project, *site)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render upload key for site %d: %w", siteID, err)
+	}
+	processedPrefix, err := fs.keyTemplates.ProcessedPrefix(*project, *site)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render processed key for site %d: %w", siteID, err)
+	}
+
+	documentGroups, err := retryRead(ctx, fs.readRetry, func() (entity.DocumentGroups, error) {
+		return fs.documentGroupRepo.GetBySiteID(ctx, siteID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document groups for site %d: %w", siteID, err)
+	}
+	var pending []string
+	for _, docGroup := range documentGroups {
+		if docGroup.ProcessedName != "" && !processingFinished(docGroup) {
+			pending = append(pending, processedPrefix+docGroup.ProcessedName)
+		}
+	}
+
+	return &SiteLocation{
+		Bucket:   contractorBucket(*contractor),
+		Region:   fs.bucketRegion(*contractor),
+		Prefixes: []string{uploadPrefix, processedPrefix},
+		Pending:  pending,
+	}, nil
+}
+
+// GetProjectLocation returns the bucket and region of a project's contractor, with the upload and processed
+// prefixes of each of the project's sites
+func (fs *FileServiceImpl) GetProjectLocation(ctx context.Context, projectID int64) (*SiteLocation, error) {
+	project, err := retryRead(ctx, fs.readRetry, func() (*entity.Project, error) {
+		return fs.projectRepo.GetByID(ctx, projectID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project %d: %w", projectID, err)
+	}
+
+	contractorProject, err := retryRead(ctx, fs.readRetry, func() (*entity.ContractorProject, error) {
+		return fs.contractorProjectRepo.GetByProjectID(ctx, projectID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: project %d: %v", errNoContractor, projectID, err)
+	}
+
+	contractor, err := retryRead(ctx, fs.readRetry, func() (*entity.Contractor, error) {
+		return fs.contractorRepo.GetByID(ctx, contractorProject.ContractorId)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contractor %d for project %d: %w", contractorProject.ContractorId, projectID, err)
+	}
+
+	sites, err := retryRead(ctx, fs.readRetry, func() (entity.Sites, error) {
+		return fs.siteRepo.GetByProjectID(ctx, projectID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sites for project %d: %w", projectID, err)
+	}
+
+	location := &SiteLocation{
+		Bucket:   contractorBucket(*contractor),
+		Region:   fs.bucketRegion(*contractor),
+		Prefixes: make([]string, 0, 2*len(sites)),
+	}
+	for _, site := range sites {
+		uploadPrefix, err := fs.keyTemplates.UploadPrefix(*project, site)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render upload key for site %d: %w", site.Id, err)
+		}
+		processedPrefix, err := fs.keyTemplates.ProcessedPrefix(*project, site)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render processed key for site %d: %w", site.Id, err)
+		}
+		location.Prefixes = append(location.Prefixes, uploadPrefix, processedPrefix)
+	}
+	return location, nil
+}
+
+// resolveSite reads a site together with its project and the project's contractor. A project without a
+// contractor association is reported as errNoContractor, with the site still returned.
+func (fs *FileServiceImpl) resolveSite(ctx context.Context, siteID int64) (*entity.Project, *entity.Site, *entity.Contractor, error) {
 	// Get the site
-	site, err := fs.siteRepo.GetByID(ctx, siteID)
+	site, err := retryRead(ctx, fs.readRetry, func() (*entity.Site, error) {
+		return fs.siteRepo.GetByID(ctx, siteID)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get site %d: %w", siteID, err)
+		return nil, nil, nil, fmt.Errorf("failed to get site %d: %w", siteID, err)
 	}
 
 	// Get the project for this site
-	project, err := fs.projectRepo.GetByID(ctx, site.ProjectId)
+	project, err := retryRead(ctx, fs.readRetry, func() (*entity.Project, error) {
+		return fs.projectRepo.GetByID(ctx, site.ProjectId)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get project %d for site %d: %w", site.ProjectId, siteID, err)
+		return nil, nil, nil, fmt.Errorf("failed to get project %d for site %d: %w", site.ProjectId, siteID, err)
 	}
 
 	// Get contractor_id from contractor_project join table
-	contractorProject, err := fs.contractorProjectRepo.GetByProjectID(ctx, project.Id)
+	contractorProject, err := retryRead(ctx, fs.readRetry, func() (*entity.ContractorProject, error) {
+		return fs.contractorProjectRepo.GetByProjectID(ctx, project.Id)
+	})
 	if err != nil {
-		logger.WithFields(log.Fields{
-			"site_id":    siteID,
-			"project_id": project.Id,
-			"error":      err.Error(),
-		}).Warn("Project has no contractor association in contractor_project table, skipping file deletion")
-		return allObjects, nil // Return empty list, no files to delete
+		return project, site, nil, fmt.Errorf("%w: project %d: %v", errNoContractor, project.Id, err)
 	}
 
 	// Get the contractor information to access bucket details
-	contractor, err := fs.contractorRepo.GetByID(ctx, contractorProject.ContractorId)
+	contractor, err := retryRead(ctx, fs.readRetry, func() (*entity.Contractor, error) {
+		return fs.contractorRepo.GetByID(ctx, contractorProject.ContractorId)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get contractor %d for project %d: %w", contractorProject.ContractorId, project.Id, err)
+		return nil, nil, nil, fmt.Errorf("failed to get contractor %d for project %d: %w", contractorProject.ContractorId, project.Id, err)
 	}
 
+	return project, site, contractor, nil
+}
+
+// CountProjectFiles returns the number and total size of the files under a project's sites. The totals
+// are aggregated in the database, so no file rows are loaded.
+func (fs *FileServiceImpl) CountProjectFiles(ctx context.Context, projectID int64) (int, int64, error) {
+	totals, err := retryRead(ctx, fs.readRetry, func() (fileTotals, error) {
+		count, bytes, err := fs.fileRepo.CountByProjectID(ctx, projectID)
+		return fileTotals{count: count, bytes: bytes}, err
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count files for project %d: %w", projectID, err)
+	}
+	return int(totals.count), totals.bytes, nil
+}
+
+// CountSiteFiles returns the number and total size of the files under a site. The totals are aggregated
+// in the database, so no file rows are loaded.
+func (fs *FileServiceImpl) CountSiteFiles(ctx context.Context, siteID int64) (int, int64, error) {
+	totals, err := retryRead(ctx, fs.readRetry, func() (fileTotals, error) {
+		count, bytes, err := fs.fileRepo.CountBySiteID(ctx, siteID)
+		return fileTotals{count: count, bytes: bytes}, err
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count files for site %d: %w", siteID, err)
+	}
+	return int(totals.count), totals.bytes, nil
+}
+
+// collectSiteFiles walks a site's document groups, documents and files and builds their S3 objects.
+// Raw uploads are taken from raw when it is set, otherwise each group's documents and files are read.
+// A failure to read the site's document groups is always returned; per-group and per-document
+// read failures are logged and skipped unless fail-fast is requested.
+func (fs *FileServiceImpl) collectSiteFiles(ctx context.Context, project entity.Project, site entity.Site, contractor entity.Contractor, options fileOptions, raw rawFileIndex) ([]dto.S3Object, error) {
+	logger := workerLog.GetLoggerFromContext(ctx)
+	var siteObjects []dto.S3Object
+
 	// Get all document groups for this site
-	documentGroups, err := fs.documentGroupRepo.GetBySiteID(ctx, siteID)
+	documentGroups, err := retryRead(ctx, fs.readRetry, func() (entity.DocumentGroups, error) {
+		return fs.documentGroupRepo.GetBySiteID(ctx, site.Id)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get document groups for site %d: %w", siteID, err)
+		return nil, fmt.Errorf("failed to get document groups for site %d: %w", site.Id, err)
 	}
 
-	logger.WithField("document_group_count", len(documentGroups)).Info("Found document groups for site")
+	logger.WithFields(log.Fields{
+		"site_id":              site.Id,
+		"document_group_count": len(documentGroups),
+	}).Debug("Found document groups for site")
 
 	// Process each document group
 	for _, docGroup := range documentGroups {
-		// Get all documents for this group
-		documents, err := fs.documentRepo.GetByGroupID(ctx, docGroup.Id)
-		if err != nil {
-			logger.WithError(err).WithField("group_id", docGroup.Id).Warn("Failed to get documents for group")
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !options.includesGroup(docGroup) {
 			continue
 		}
 
-		// Process each document
-		for _, document := range documents {
-			// Get all files for this document
-			files, err := fs.fileRepo.GetByDocumentID(ctx, document.Id)
+		// Processed outputs are derived from the group itself, so its documents are only read for raw uploads
+		if options.includesRaw() && raw != nil {
+			siteObjects = append(siteObjects, raw[docGroup.Id]...)
+		} else if options.includesRaw() {
+			rawObjects, err := fs.collectRawFiles(ctx, project, site, docGroup, contractor, options)
 			if err != nil {
-				logger.WithError(err).WithField("document_id", document.Id).Warn("Failed to get files for document")
-				continue
+				return nil, err
 			}
+			siteObjects = append(siteObjects, rawObjects...)
+		}
 
-			// Build S3 objects from files
-			for _, file := range files {
-				s3Objects := fs.buildS3ObjectsFromFile(*project, *site, docGroup, file, *contractor)
-				allObjects = append(allObjects, s3Objects...)
+		// Handle processed files if they exist
+		if options.includesProcessed() && processingFinished(docGroup) && docGroup.ProcessedName != "" {
+			processedObjects, err := fs.buildProcessedS3Objects(project, site, docGroup, contractor)
+			if err != nil {
+				return nil, err
 			}
+			fs.logKeys(ctx, processedObjects, log.Fields{"document_group_id": docGroup.Id})
+			siteObjects = append(siteObjects, processedObjects...)
 		}
+	}
 
-		// Handle processed files if they exist
-		if (docGroup.Progress == 40 || docGroup.Progress == 11) && docGroup.ProcessedName != "" {
-			processedObjects := fs.buildProcessedS3Objects(*project, *site, docGroup, *contractor)
-			allObjects = append(allObjects, processedObjects...)
+	return siteObjects, nil
+}
+
+// processingFinished reports whether a document group's processed outputs are final, so its keys can be built
+func processingFinished(docGroup entity.DocumentGroup) bool {
+	return docGroup.Progress == 40 || docGroup.Progress == 11
+}
+
+// collectRawFiles builds the S3 objects of the files uploaded to a document group, reading the files of up to
+// fileReadBatch documents per query. A failure to read the group's documents or a document's files is logged and
+// skipped unless fail-fast is requested or ctx is done.
+func (fs *FileServiceImpl) collectRawFiles(ctx context.Context, project entity.Project, site entity.Site, docGroup entity.DocumentGroup, contractor entity.Contractor, options fileOptions) ([]dto.S3Object, error) {
+	logger := workerLog.GetLoggerFromContext(ctx)
+	var objects []dto.S3Object
+
+	// Get all documents for this group
+	documents, err := retryRead(ctx, fs.readRetry, func() (entity.Documents, error) {
+		return fs.documentRepo.GetByGroupID(ctx, docGroup.Id)
+	})
+	if err != nil {
+		if options.unreadable(ctx) {
+			return nil, fmt.Errorf("failed to get documents for group %d: %w", docGroup.Id, err)
+		}
+		logger.WithError(err).WithField("group_id", docGroup.Id).Warn("Failed to get documents for group")
+		return nil, nil
+	}
+
+	batched := fs.readDocumentFiles(ctx, documents, options)
+
+	// Process each document
+	for _, document := range documents {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// Get all files for this document, unless its batch already read them
+		var err error
+		files, ok := batched[document.Id]
+		if !ok {
+			files, err = retryRead(ctx, fs.readRetry, func() (entity.Files, error) {
+				return fs.fileRepo.GetByDocumentID(ctx, document.Id, options.createdAfter, options.createdBefore)
+			})
+		}
+		if err != nil {
+			if options.unreadable(ctx) {
+				return nil, fmt.Errorf("failed to get files for document %d: %w", document.Id, err)
+			}
+			logger.WithError(err).WithField("document_id", document.Id).Warn("Failed to get files for document")
+			continue
+		}
+
+		// Build S3 objects from files
+		for _, file := range files {
+			fileObjects, err := fs.buildS3ObjectsFromFile(project, site, docGroup, file, contractor)
+			if err != nil {
+				return nil, err
+			}
+			fs.logKeys(ctx, fileObjects, log.Fields{"file_id": file.Id})
+			objects = append(objects, fileObjects...)
+		}
+	}
+
+	return objects, nil
+}
+
+// readDocumentFiles reads the files of documents created within the traversal's window with one query per
+// fileReadBatch documents and returns them by document. The documents of a batch that fails to read are left out, so they are read one by one and a single
+// unreadable document does not cost its whole batch; nil is returned when batching is disabled.
+func (fs *FileServiceImpl) readDocumentFiles(ctx context.Context, documents entity.Documents, options fileOptions) map[int64]entity.Files {
+	if fs.fileReadBatch <= 0 {
+		return nil
+	}
+	logger := workerLog.GetLoggerFromContext(ctx)
+
+	filesByDocument := make(map[int64]entity.Files, len(documents))
+	for start := 0; start < len(documents); start += fs.fileReadBatch {
+		if ctx.Err() != nil {
+			break
+		}
+
+		batch := documents[start:min(start+fs.fileReadBatch, len(documents))]
+		documentIDs := make([]int64, 0, len(batch))
+		for _, document := range batch {
+			documentIDs = append(documentIDs, document.Id)
+		}
+
+		files, err := retryRead(ctx, fs.readRetry, func() (entity.Files, error) {
+			return fs.fileRepo.GetByDocumentIDs(ctx, documentIDs, options.createdAfter, options.createdBefore)
+		})
+		if err != nil {
+			logger.WithError(err).WithField("document_count", len(batch)).Warn("Failed to read document files in batch, reading them one by one")
+			continue
+		}
+
+		// Documents without files are recorded too, so they are not read again
+		for _, documentID := range documentIDs {
+			filesByDocument[documentID] = entity.Files{}
+		}
+		for _, file := range files {
+			filesByDocument[file.DocumentId] = append(filesByDocument[file.DocumentId], file)
+		}
+	}
+	return filesByDocument
+}
+
+// readRawFileIndex builds the raw upload objects of the documents read returns, using one joined query for the
+// documents with their site, project and contractor and one per fileReadBatch documents for their files. Keys are
+// built for contractor, the one the cleanse resolved; the join also matches every other contractor a project is
+// linked to, and those rows are ignored. It returns nil, so groups are read one by one instead, when no document
+// process repository is set, raw uploads are out of scope or a bulk read fails.
+func (fs *FileServiceImpl) readRawFileIndex(ctx context.Context, contractor entity.Contractor, options fileOptions, read func() (entity.DocumentProcesses, error)) rawFileIndex {
+	if fs.documentProcessRepo == nil || !options.includesRaw() {
+		return nil
+	}
+	logger := workerLog.GetLoggerFromContext(ctx)
+
+	processes, err := retryRead(ctx, fs.readRetry, read)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to read documents in bulk, reading document groups one by one")
+		return nil
+	}
+
+	documents := make(map[int64]entity.DocumentProcess, len(processes))
+	documentIDs := make([]int64, 0, len(processes))
+	for _, process := range processes {
+		if process.ContractorId != contractor.Id {
+			continue
 		}
+		if _, seen := documents[process.Id]; seen {
+			continue
+		}
+		documents[process.Id] = process
+		documentIDs = append(documentIDs, process.Id)
+	}
+
+	files, err := fs.readFilesInBatches(ctx, documentIDs, options)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to read document files in bulk, reading document groups one by one")
+		return nil
+	}
+
+	index := make(rawFileIndex, len(processes))
+	for _, file := range files {
+		document := documents[file.DocumentId]
+		project := entity.Project{Id: document.ProjectId, Code: document.ProjectCode, Name: document.ProjectName}
+		site := entity.Site{Id: document.SiteId, Code: document.SiteCode, Name: document.SiteName, ProjectId: document.ProjectId}
+		docGroup := entity.DocumentGroup{Id: document.GroupId, Category: document.Category, SiteId: document.SiteId}
+
+		objects, err := fs.buildS3ObjectsFromFile(project, site, docGroup, file, contractor)
+		if err != nil {
+			// The group by group walk fails on the same file and reports it
+			logger.WithError(err).WithField("document_id", file.DocumentId).Warn("Failed to build keys of documents read in bulk")
+			return nil
+		}
+		fs.logKeys(ctx, objects, log.Fields{"file_id": file.Id})
+		index[document.GroupId] = append(index[document.GroupId], objects...)
 	}
 
 	logger.WithFields(log.Fields{
-		"site_id":     siteID,
-		"total_files": len(allObjects),
-	}).Info("Retrieved site files from database")
+		"document_count": len(documentIDs),
+		"file_count":     len(files),
+	}).Debug("Read document files in bulk")
+
+	return index
+}
+
+// readFilesInBatches reads the files of documentIDs created within the traversal's window with one query per
+// fileReadBatch documents, or one per document when batching is disabled, failing on the first batch that cannot
+// be read
+func (fs *FileServiceImpl) readFilesInBatches(ctx context.Context, documentIDs []int64, options fileOptions) (entity.Files, error) {
+	batchSize := max(fs.fileReadBatch, 1)
+
+	var files entity.Files
+	for start := 0; start < len(documentIDs); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		batch := documentIDs[start:min(start+batchSize, len(documentIDs))]
+		batchFiles, err := retryRead(ctx, fs.readRetry, func() (entity.Files, error) {
+			return fs.fileRepo.GetByDocumentIDs(ctx, batch, options.createdAfter, options.createdBefore)
+		})
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, batchFiles...)
+	}
+	return files, nil
+}
+
+// logKeys logs each computed object at debug level with source, the file or document group it was built from,
+// when key plan logging is enabled
+func (fs *FileServiceImpl) logKeys(ctx context.Context, objects []dto.S3Object, source log.Fields) {
+	if !fs.logKeyPlan {
+		return
+	}
+	logger := workerLog.GetLoggerFromContext(ctx).WithFields(source)
+	if !logger.Logger.IsLevelEnabled(log.DebugLevel) {
+		return
+	}
+	for _, object := range objects {
+		logger.WithFields(log.Fields{
+			"bucket": object.Bucket,
+			"region": object.Region,
+			"key":    object.Key,
+		}).Debug("Computed S3 key")
+	}
+}
+
+// collectSitesFiles collects the files of many sites, reading up to siteConcurrency sites at once.
+// Objects keep the order of sites. A failing site is logged and skipped unless options.failFast is set; once ctx
+// is done, the traversal stops with its error instead.
+func (fs *FileServiceImpl) collectSitesFiles(ctx context.Context, sites []projectSite, contractor entity.Contractor, options fileOptions, raw rawFileIndex) ([]dto.S3Object, error) {
+	logger := workerLog.GetLoggerFromContext(ctx)
+
+	// Each site writes only its own slot, so no locking is needed
+	siteObjects := make([][]dto.S3Object, len(sites))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.siteConcurrency)
+	for i, ps := range sites {
+		// Once the group stops, the sites not started yet are not read at all
+		if gctx.Err() != nil {
+			break
+		}
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			objects, err := fs.collectSiteFiles(gctx, ps.project, ps.site, contractor, options, raw)
+			if err != nil {
+				if options.failFast || gctx.Err() != nil {
+					return err
+				}
+				logger.WithError(err).WithField("site_id", ps.site.Id).Warn("Failed to get document groups for site")
+				options.skip()
+				return nil
+			}
+			siteObjects[i] = objects
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
+	var allObjects []dto.S3Object
+	for _, objects := range siteObjects {
+		allObjects = append(allObjects, objects...)
+	}
 	return allObjects, nil
 }
 
 // buildS3ObjectsFromFile builds S3 object information from a file entity
-func (fs *FileServiceImpl) buildS3ObjectsFromFile(project entity.Project, site entity.Site, docGroup entity.DocumentGroup, file entity.File, contractor entity.Contractor) []dto.S3Object {
+func (fs *FileServiceImpl) buildS3ObjectsFromFile(project entity.Project, site entity.Site, docGroup entity.DocumentGroup, file entity.File, contractor entity.Contractor) ([]dto.S3Object, error) {
 	var objects []dto.S3Object
 
 	// Determine if we need to split the file name based on document group category
@@ -326,8 +924,11 @@ func (fs *FileServiceImpl) buildS3ObjectsFromFile(project entity.Project, site e
 		needSplit = true
 	}
 
-	// Build the base path: {projectCode}/{siteCode}/00_Upload/
-	basePath := fmt.Sprintf("%s/%s/00_Upload/", project.Code, site.Code)
+	// Build the base path, by default {projectCode}/{siteCode}/00_Upload/
+	basePath, err := fs.keyTemplates.UploadPrefix(project, site)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render upload key for site %d: %w", site.Id, err)
+	}
 
 	fileName := file.Name
 	if needSplit {
@@ -341,29 +942,49 @@ func (fs *FileServiceImpl) buildS3ObjectsFromFile(project entity.Project, site e
 
 	// Create S3 object with the key structure, size, bucket, and region information
 	object := dto.S3Object{
-		Key:    s3Key,
-		Size:   file.Size,
-		Bucket: contractor.AwsBucketName,
-		Region: contractor.AwsBucketRegion,
+		Key:      s3Key,
+		Size:     file.Size,
+		Bucket:   contractorBucket(contractor),
+		Region:   fs.bucketRegion(contractor),
+		Category: docGroup.Category,
 	}
 
 	objects = append(objects, object)
-	return objects
+	return objects, nil
+}
+
+// contractorBucket returns the contractor's bucket without surrounding whitespace, matching the name the contractor
+// cleansing path validates with NormalizeAndValidateBucketName
+func contractorBucket(contractor entity.Contractor) string {
+	return strings.TrimSpace(contractor.AwsBucketName)
+}
+
+// bucketRegion returns the region of the contractor's bucket, falling back to the configured AWS region
+// so S3Service never has to guess where an object lives
+func (fs *FileServiceImpl) bucketRegion(contractor entity.Contractor) string {
+	if contractor.AwsBucketRegion == "" {
+		return fs.defaultRegion
+	}
+	return contractor.AwsBucketRegion
 }
 
 // buildProcessedS3Objects builds S3 objects for processed files
-func (fs *FileServiceImpl) buildProcessedS3Objects(project entity.Project, site entity.Site, docGroup entity.DocumentGroup, contractor entity.Contractor) []dto.S3Object {
+func (fs *FileServiceImpl) buildProcessedS3Objects(project entity.Project, site entity.Site, docGroup entity.DocumentGroup, contractor entity.Contractor) ([]dto.S3Object, error) {
 	var objects []dto.S3Object
 
-	// Build the processed files path: {projectCode}/{siteCode}/01_Processed/
-	basePath := fmt.Sprintf("%s/%s/01_Processed/", project.Code, site.Code)
+	// Build the processed files path, by default {projectCode}/{siteCode}/01_Processed/
+	basePath, err := fs.keyTemplates.ProcessedPrefix(project, site)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render processed key for site %d: %w", site.Id, err)
+	}
 
 	// Add the main geojson file
 	mainKey := fmt.Sprintf("%s%s.geojson", basePath, docGroup.ProcessedName)
 	objects = append(objects, dto.S3Object{
-		Key:    mainKey,
-		Bucket: contractor.AwsBucketName,
-		Region: contractor.AwsBucketRegion,
+		Key:      mainKey,
+		Bucket:   contractorBucket(contractor),
+		Region:   fs.bucketRegion(contractor),
+		Category: docGroup.Category,
 	})
 
 	// Add additional files for raster types
@@ -372,12 +993,13 @@ func (fs *FileServiceImpl) buildProcessedS3Objects(project entity.Project, site
 		for _, fileType := range fileTypes {
 			key := fmt.Sprintf("%s%s%s", basePath, docGroup.ProcessedName, fileType)
 			objects = append(objects, dto.S3Object{
-				Key:    key,
-				Bucket: contractor.AwsBucketName,
-				Region: contractor.AwsBucketRegion,
+				Key:      key,
+				Bucket:   contractorBucket(contractor),
+				Region:   fs.bucketRegion(contractor),
+				Category: docGroup.Category,
 			})
 		}
 	}
 
-	return objects
+	return objects, nil
 }
@@ -0,0 +1,636 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/repository"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/gorm"
+)
+
+// newDBFileService builds a FileService backed by the real repositories on db
+func newDBFileService(db *gorm.DB) FileService {
+	return newDBFileServiceWithConfig(db, &config.Config{})
+}
+
+// newDBFileServiceWithConfig builds a FileService backed by the real repositories on db, configured from cfg
+func newDBFileServiceWithConfig(db *gorm.DB, cfg *config.Config) FileService {
+	return NewFileService(
+		repository.NewContractorRepository(db),
+		repository.NewContractorProjectRepository(db),
+		repository.NewProjectRepository(db),
+		repository.NewSiteRepository(db),
+		repository.NewDocumentGroupRepository(db),
+		repository.NewDocumentRepository(db),
+		repository.NewFileRepository(db),
+		repository.NewDocumentProcessRepository(db),
+		cfg,
+	)
+}
+
+// objectKeys returns the sorted keys of objects, failing if any object is outside the expected bucket
+func objectKeys(t *testing.T, objects []dto.S3Object, bucket string) []string {
+	t.Helper()
+
+	keys := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		if obj.Bucket != bucket || obj.Region != testutil.Region {
+			t.Errorf("Expected %s in %s/%s, got %s/%s", obj.Key, bucket, testutil.Region, obj.Bucket, obj.Region)
+		}
+		keys = append(keys, obj.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestFileService_DB_KeySets(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	fs := newDBFileService(db)
+	ctx := context.Background()
+
+	site100Keys := []string{
+		"PRJA/S100/00_Upload/depth.tif",
+		"PRJA/S100/00_Upload/line1/Raw/a.xtf",
+		"PRJA/S100/00_Upload/line1/Raw/b.xtf",
+		"PRJA/S100/01_Processed/depth.geojson",
+		"PRJA/S100/01_Processed/depth_B01.tif",
+		"PRJA/S100/01_Processed/depth_B02.tif",
+		"PRJA/S100/01_Processed/depth_B03.tif",
+	}
+	contractorKeys := append([]string{"PRJA/S101/00_Upload/photo.jpg"}, site100Keys...)
+	sort.Strings(contractorKeys)
+
+	tests := []struct {
+		name     string
+		list     func() ([]dto.S3Object, error)
+		bucket   string
+		wantKeys []string
+	}{
+		{
+			name:     "contractor",
+			list:     func() ([]dto.S3Object, error) { return fs.GetContractorFiles(ctx, testutil.ContractorID) },
+			bucket:   testutil.Bucket,
+			wantKeys: contractorKeys,
+		},
+		{
+			name:     "project",
+			list:     func() ([]dto.S3Object, error) { return fs.GetProjectFiles(ctx, testutil.ProjectID) },
+			bucket:   testutil.Bucket,
+			wantKeys: contractorKeys,
+		},
+		{
+			name:     "project without sites",
+			list:     func() ([]dto.S3Object, error) { return fs.GetProjectFiles(ctx, testutil.SecondProjectID) },
+			bucket:   testutil.Bucket,
+			wantKeys: []string{},
+		},
+		{
+			name:     "site",
+			list:     func() ([]dto.S3Object, error) { return fs.GetSiteFiles(ctx, testutil.SiteID) },
+			bucket:   testutil.Bucket,
+			wantKeys: site100Keys,
+		},
+		{
+			name:     "other contractor",
+			list:     func() ([]dto.S3Object, error) { return fs.GetContractorFiles(ctx, testutil.OtherContractorID) },
+			bucket:   testutil.OtherBucket,
+			wantKeys: []string{"PRJX/S200/00_Upload/vector.shp"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := tt.list()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			keys := objectKeys(t, objects, tt.bucket)
+			if len(keys) != len(tt.wantKeys) {
+				t.Fatalf("Expected keys %v, got %v", tt.wantKeys, keys)
+			}
+			for i := range keys {
+				if keys[i] != tt.wantKeys[i] {
+					t.Errorf("Expected key %s, got %s", tt.wantKeys[i], keys[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFileService_DB_Scope(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	fs := newDBFileService(db)
+	ctx := context.Background()
+
+	rawKeys := []string{
+		"PRJA/S100/00_Upload/depth.tif",
+		"PRJA/S100/00_Upload/line1/Raw/a.xtf",
+		"PRJA/S100/00_Upload/line1/Raw/b.xtf",
+	}
+	processedKeys := []string{
+		"PRJA/S100/01_Processed/depth.geojson",
+		"PRJA/S100/01_Processed/depth_B01.tif",
+		"PRJA/S100/01_Processed/depth_B02.tif",
+		"PRJA/S100/01_Processed/depth_B03.tif",
+	}
+	allKeys := append(append([]string{}, rawKeys...), processedKeys...)
+
+	tests := []struct {
+		scope    string
+		wantKeys []string
+	}{
+		{scope: "", wantKeys: allKeys},
+		{scope: dto.ScopeAll, wantKeys: allKeys},
+		{scope: dto.ScopeRaw, wantKeys: rawKeys},
+		{scope: dto.ScopeProcessed, wantKeys: processedKeys},
+	}
+
+	for _, tt := range tests {
+		t.Run("scope "+tt.scope, func(t *testing.T) {
+			objects, err := fs.GetSiteFiles(ctx, testutil.SiteID, WithScope(tt.scope))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			keys := objectKeys(t, objects, testutil.Bucket)
+			if len(keys) != len(tt.wantKeys) {
+				t.Fatalf("Expected keys %v, got %v", tt.wantKeys, keys)
+			}
+			for i := range keys {
+				if keys[i] != tt.wantKeys[i] {
+					t.Errorf("Expected key %s, got %s", tt.wantKeys[i], keys[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFileService_DB_InactiveGroups(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	// Group 1000 holds the sonar lines, group 1001 the depth raster
+	if err := db.Model(&entity.DocumentGroup{}).Where("id = ?", 1000).Update("status", entity.DocumentGroupStatusInactive).Error; err != nil {
+		t.Fatalf("Failed to deactivate group: %v", err)
+	}
+	fs := newDBFileService(db)
+	ctx := context.Background()
+
+	activeKeys := []string{
+		"PRJA/S100/00_Upload/depth.tif",
+		"PRJA/S100/01_Processed/depth.geojson",
+		"PRJA/S100/01_Processed/depth_B01.tif",
+		"PRJA/S100/01_Processed/depth_B02.tif",
+		"PRJA/S100/01_Processed/depth_B03.tif",
+	}
+	allKeys := []string{
+		"PRJA/S100/00_Upload/depth.tif",
+		"PRJA/S100/00_Upload/line1/Raw/a.xtf",
+		"PRJA/S100/00_Upload/line1/Raw/b.xtf",
+		"PRJA/S100/01_Processed/depth.geojson",
+		"PRJA/S100/01_Processed/depth_B01.tif",
+		"PRJA/S100/01_Processed/depth_B02.tif",
+		"PRJA/S100/01_Processed/depth_B03.tif",
+	}
+
+	tests := []struct {
+		name     string
+		opts     []FileOption
+		wantKeys []string
+	}{
+		{name: "active only by default", wantKeys: activeKeys},
+		{name: "include inactive", opts: []FileOption{WithIncludeInactive()}, wantKeys: allKeys},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := fs.GetSiteFiles(ctx, testutil.SiteID, tt.opts...)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			keys := objectKeys(t, objects, testutil.Bucket)
+			if len(keys) != len(tt.wantKeys) {
+				t.Fatalf("Expected keys %v, got %v", tt.wantKeys, keys)
+			}
+			for i := range keys {
+				if keys[i] != tt.wantKeys[i] {
+					t.Errorf("Expected key %s, got %s", tt.wantKeys[i], keys[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFileService_DB_DeletedProjects(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	// Project 10 holds both sites of the contractor; project 11 has none
+	if err := db.Model(&entity.Project{}).Where("id = ?", testutil.ProjectID).Update("is_deleted", true).Error; err != nil {
+		t.Fatalf("Failed to soft-delete project: %v", err)
+	}
+	fs := newDBFileService(db)
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		opts        []FileOption
+		wantObjects int
+	}{
+		{name: "skips soft-deleted projects by default", wantObjects: 0},
+		// 7 objects for site 100 and 1 photo for site 101
+		{name: "include deleted", opts: []FileOption{WithIncludeDeleted(), WithIncludeInactive()}, wantObjects: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := fs.GetContractorFiles(ctx, testutil.ContractorID, tt.opts...)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(objects) != tt.wantObjects {
+				t.Errorf("Expected %d objects, got %d", tt.wantObjects, len(objects))
+			}
+		})
+	}
+
+	// A project cleansing names its project explicitly, so the flag does not hide it
+	objects, err := fs.GetProjectFiles(ctx, testutil.ProjectID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(objects) != 8 {
+		t.Errorf("Expected 8 objects for the soft-deleted project, got %d", len(objects))
+	}
+}
+
+func TestFileService_DB_UnknownContractor(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+
+	if _, err := newDBFileService(db).GetContractorFiles(context.Background(), 999); err == nil {
+		t.Error("Expected error for unknown contractor")
+	}
+}
+
+func TestFileService_DB_CustomKeyTemplates(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	fs := newDBFileServiceWithConfig(db, &config.Config{
+		UploadKeyTemplate:    "projects/{{.ProjectCode}}/sites/{{.SiteCode}}/raw",
+		ProcessedKeyTemplate: "processed/{{.ProjectID}}-{{.SiteID}}/",
+	})
+
+	objects, err := fs.GetSiteFiles(context.Background(), testutil.SiteID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []string{
+		"processed/10-100/depth.geojson",
+		"processed/10-100/depth_B01.tif",
+		"processed/10-100/depth_B02.tif",
+		"processed/10-100/depth_B03.tif",
+		"projects/PRJA/sites/S100/raw/depth.tif",
+		"projects/PRJA/sites/S100/raw/line1/Raw/a.xtf",
+		"projects/PRJA/sites/S100/raw/line1/Raw/b.xtf",
+	}
+	keys := objectKeys(t, objects, testutil.Bucket)
+	if len(keys) != len(want) {
+		t.Fatalf("Expected keys %v, got %v", want, keys)
+	}
+	for i := range keys {
+		if keys[i] != want[i] {
+			t.Errorf("Expected key %s, got %s", want[i], keys[i])
+		}
+	}
+}
+
+func TestFileService_DB_CountFiles(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	fs := newDBFileService(db)
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		count     func() (int, int64, error)
+		wantCount int
+		wantBytes int64
+	}{
+		{"project", func() (int, int64, error) { return fs.CountProjectFiles(ctx, testutil.ProjectID) }, 4, 1000},
+		{"empty project", func() (int, int64, error) { return fs.CountProjectFiles(ctx, testutil.SecondProjectID) }, 0, 0},
+		{"site", func() (int, int64, error) { return fs.CountSiteFiles(ctx, testutil.SiteID) }, 3, 600},
+		{"other contractor's site", func() (int, int64, error) { return fs.CountSiteFiles(ctx, testutil.OtherSiteID) }, 1, 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, bytes, err := tt.count()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if count != tt.wantCount || bytes != tt.wantBytes {
+				t.Errorf("Expected %d files / %d bytes, got %d / %d", tt.wantCount, tt.wantBytes, count, bytes)
+			}
+		})
+	}
+}
+
+func TestFileService_DB_BucketRegion(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	if err := db.Model(&entity.Contractor{}).Where("id = ?", testutil.OtherContractorID).Update("aws_bucket_region", "").Error; err != nil {
+		t.Fatalf("failed to clear contractor region: %v", err)
+	}
+	fs := newDBFileServiceWithConfig(db, &config.Config{AWSRegion: "eu-west-1"})
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		list       func() ([]dto.S3Object, error)
+		wantRegion string
+	}{
+		{"contractor region", func() ([]dto.S3Object, error) { return fs.GetProjectFiles(ctx, testutil.ProjectID) }, testutil.Region},
+		{"default region", func() ([]dto.S3Object, error) { return fs.GetSiteFiles(ctx, testutil.OtherSiteID) }, "eu-west-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := tt.list()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(objects) == 0 {
+				t.Fatal("Expected objects")
+			}
+			for _, obj := range objects {
+				if obj.Region != tt.wantRegion {
+					t.Errorf("Expected %s in region %s, got %q", obj.Key, tt.wantRegion, obj.Region)
+				}
+			}
+		})
+	}
+}
+
+func TestFileService_DB_ProjectLocation(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	fs := newDBFileService(db)
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		projectID    int64
+		wantPrefixes []string
+	}{
+		{
+			name:      "project with sites",
+			projectID: testutil.ProjectID,
+			wantPrefixes: []string{
+				"PRJA/S100/00_Upload/", "PRJA/S100/01_Processed/",
+				"PRJA/S101/00_Upload/", "PRJA/S101/01_Processed/",
+			},
+		},
+		{name: "project without sites", projectID: testutil.SecondProjectID, wantPrefixes: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			location, err := fs.GetProjectLocation(ctx, tt.projectID)
+			if err != nil {
+				t.Fatalf("GetProjectLocation() unexpected error: %v", err)
+			}
+			if location.Bucket != testutil.Bucket || location.Region != testutil.Region {
+				t.Errorf("Expected %s in %s, got %s in %s", testutil.Bucket, testutil.Region, location.Bucket, location.Region)
+			}
+			prefixes := append([]string{}, location.Prefixes...)
+			sort.Strings(prefixes)
+			if len(prefixes) != len(tt.wantPrefixes) {
+				t.Fatalf("Expected prefixes %v, got %v", tt.wantPrefixes, prefixes)
+			}
+			for i := range prefixes {
+				if prefixes[i] != tt.wantPrefixes[i] {
+					t.Errorf("Expected prefix %s, got %s", tt.wantPrefixes[i], prefixes[i])
+				}
+			}
+		})
+	}
+
+	if _, err := fs.GetProjectLocation(ctx, 999); err == nil {
+		t.Error("Expected error for unknown project")
+	}
+}
+
+// countingDocumentRepository counts the per-group document reads of the group by group walk
+type countingDocumentRepository struct {
+	repository.DocumentRepository
+	groupReads int
+}
+
+func (r *countingDocumentRepository) GetByGroupID(ctx context.Context, groupID int64) (entity.Documents, error) {
+	r.groupReads++
+	return r.DocumentRepository.GetByGroupID(ctx, groupID)
+}
+
+// failingDocumentProcessRepository fails every bulk read
+type failingDocumentProcessRepository struct{}
+
+func (failingDocumentProcessRepository) GetBySiteID(ctx context.Context, siteID int64) (entity.DocumentProcesses, error) {
+	return nil, errors.New("join failed")
+}
+
+func (failingDocumentProcessRepository) GetByProjectID(ctx context.Context, projectID int64) (entity.DocumentProcesses, error) {
+	return nil, errors.New("join failed")
+}
+
+func TestFileService_DB_DocumentProcessBulkRead(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	wantKeys := []string{
+		"PRJA/S100/00_Upload/depth.tif",
+		"PRJA/S100/00_Upload/line1/Raw/a.xtf",
+		"PRJA/S100/00_Upload/line1/Raw/b.xtf",
+		"PRJA/S101/00_Upload/photo.jpg",
+	}
+
+	tests := []struct {
+		name           string
+		processRepo    repository.DocumentProcessRepository
+		batchSize      int
+		linkOther      bool
+		wantGroupReads bool
+	}{
+		{name: "bulk read", processRepo: repository.NewDocumentProcessRepository(db)},
+		{name: "bulk read in batches", processRepo: repository.NewDocumentProcessRepository(db), batchSize: 1},
+		// The join matches the other contractor's link too; its bucket must not get duplicate keys
+		{name: "project linked to another contractor", processRepo: repository.NewDocumentProcessRepository(db), linkOther: true},
+		{name: "no bulk repository", wantGroupReads: true},
+		{name: "bulk read fails", processRepo: failingDocumentProcessRepository{}, wantGroupReads: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.linkOther {
+				link := entity.ContractorProject{Id: 99, ContractorId: testutil.OtherContractorID, ProjectId: testutil.ProjectID}
+				if err := db.Create(&link).Error; err != nil {
+					t.Fatalf("Failed to link the other contractor: %v", err)
+				}
+				defer db.Delete(&link)
+			}
+
+			documentRepo := &countingDocumentRepository{DocumentRepository: repository.NewDocumentRepository(db)}
+			fs := NewFileService(
+				repository.NewContractorRepository(db),
+				repository.NewContractorProjectRepository(db),
+				repository.NewProjectRepository(db),
+				repository.NewSiteRepository(db),
+				repository.NewDocumentGroupRepository(db),
+				documentRepo,
+				repository.NewFileRepository(db),
+				tt.processRepo,
+				&config.Config{FileReadBatchSize: tt.batchSize},
+			)
+
+			objects, err := fs.GetProjectFiles(context.Background(), testutil.ProjectID, WithScope(dto.ScopeRaw))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			keys := objectKeys(t, objects, testutil.Bucket)
+			if len(keys) != len(wantKeys) {
+				t.Fatalf("Expected keys %v, got %v", wantKeys, keys)
+			}
+			for i := range keys {
+				if keys[i] != wantKeys[i] {
+					t.Errorf("Expected key %s, got %s", wantKeys[i], keys[i])
+				}
+			}
+
+			if tt.wantGroupReads != (documentRepo.groupReads > 0) {
+				t.Errorf("Expected per-group document reads %t, got %d reads", tt.wantGroupReads, documentRepo.groupReads)
+			}
+		})
+	}
+}
+
+func TestFileService_DB_CreatedWindow(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	// Only site 101's file was created within the window; created_at holds Unix seconds
+	if err := db.Model(&entity.File{}).Where("1 = 1").Update("created_at", 1767139200).Error; err != nil {
+		t.Fatalf("Failed to date files: %v", err)
+	}
+	if err := db.Model(&entity.File{}).Where("id = ?", 4).Update("created_at", 1767229200).Error; err != nil {
+		t.Fatalf("Failed to date file: %v", err)
+	}
+	wantKeys := []string{"PRJA/S101/00_Upload/photo.jpg"}
+
+	tests := []struct {
+		name        string
+		processRepo repository.DocumentProcessRepository
+		batchSize   int
+	}{
+		{name: "bulk read", processRepo: repository.NewDocumentProcessRepository(db)},
+		{name: "group walk"},
+		{name: "group walk in batches", batchSize: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := NewFileService(
+				repository.NewContractorRepository(db),
+				repository.NewContractorProjectRepository(db),
+				repository.NewProjectRepository(db),
+				repository.NewSiteRepository(db),
+				repository.NewDocumentGroupRepository(db),
+				repository.NewDocumentRepository(db),
+				repository.NewFileRepository(db),
+				tt.processRepo,
+				&config.Config{FileReadBatchSize: tt.batchSize},
+			)
+
+			objects, err := fs.GetProjectFiles(context.Background(), testutil.ProjectID, WithScope(dto.ScopeRaw), WithCreatedWindow(1767225600, 1767312000))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if keys := objectKeys(t, objects, testutil.Bucket); !reflect.DeepEqual(keys, wantKeys) {
+				t.Errorf("Expected keys %v, got %v", wantKeys, keys)
+			}
+		})
+	}
+}
+
+func TestFileService_DB_KeyPlanLogging(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	level := log.GetLevel()
+	log.SetLevel(log.DebugLevel)
+	defer log.SetLevel(level)
+
+	// Site 101 holds file 4 in group 1010; site 100's processed outputs come from group 1001
+	wantSources := map[string]log.Fields{
+		"PRJA/S100/00_Upload/depth.tif":        {"file_id": int64(3)},
+		"PRJA/S100/00_Upload/line1/Raw/a.xtf":  {"file_id": int64(1)},
+		"PRJA/S100/00_Upload/line1/Raw/b.xtf":  {"file_id": int64(2)},
+		"PRJA/S100/01_Processed/depth.geojson": {"document_group_id": int64(1001)},
+		"PRJA/S100/01_Processed/depth_B01.tif": {"document_group_id": int64(1001)},
+		"PRJA/S100/01_Processed/depth_B02.tif": {"document_group_id": int64(1001)},
+		"PRJA/S100/01_Processed/depth_B03.tif": {"document_group_id": int64(1001)},
+	}
+
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("enabled=%v", enabled), func(t *testing.T) {
+			hook := logtest.NewGlobal()
+			defer hook.Reset()
+
+			fs := newDBFileServiceWithConfig(db, &config.Config{LogKeyPlan: enabled})
+			if _, err := fs.GetSiteFiles(context.Background(), testutil.SiteID); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			logged := make(map[string]*log.Entry)
+			for _, entry := range hook.AllEntries() {
+				if entry.Message == "Computed S3 key" {
+					logged[entry.Data["key"].(string)] = entry
+				}
+			}
+			if !enabled {
+				if len(logged) != 0 {
+					t.Errorf("Expected no key plan logged when disabled, got %d keys", len(logged))
+				}
+				return
+			}
+
+			if len(logged) != len(wantSources) {
+				t.Fatalf("Expected %d logged keys, got %d", len(wantSources), len(logged))
+			}
+			for key, source := range wantSources {
+				entry, ok := logged[key]
+				if !ok {
+					t.Errorf("Expected key %s to be logged", key)
+					continue
+				}
+				if entry.Level != log.DebugLevel || entry.Data["bucket"] != testutil.Bucket {
+					t.Errorf("Expected %s at debug level in bucket %s, got %s in %v", key, testutil.Bucket, entry.Level, entry.Data["bucket"])
+				}
+				for field, want := range source {
+					if entry.Data[field] != want {
+						t.Errorf("Expected %s of %s to be %v, got %v", field, key, want, entry.Data[field])
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,571 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/repository"
+)
+
+// fileTreeProjectRepository returns a single project for the contractor
+type fileTreeProjectRepository struct {
+	mockProjectRepository
+}
+
+func (m *fileTreeProjectRepository) GetByID(ctx context.Context, id int64) (*entity.Project, error) {
+	return &entity.Project{Id: id, Code: "PRJ"}, nil
+}
+
+func (m *fileTreeProjectRepository) GetByContractorID(ctx context.Context, contractorID int64, includeDeleted bool) (entity.Projects, error) {
+	return entity.Projects{{Id: 1, Code: "PRJ"}}, nil
+}
+
+// fileTreeSiteRepository returns a single site for every project
+type fileTreeSiteRepository struct {
+	mockSiteRepository
+}
+
+func (m *fileTreeSiteRepository) GetByID(ctx context.Context, id int64) (*entity.Site, error) {
+	return &entity.Site{Id: id, Code: "SITE", ProjectId: 1}, nil
+}
+
+func (m *fileTreeSiteRepository) GetByProjectID(ctx context.Context, projectID int64) (entity.Sites, error) {
+	return entity.Sites{{Id: 10, Code: "SITE", ProjectId: projectID}}, nil
+}
+
+// fileTreeDocumentGroupRepository returns a single unprocessed group for every site
+type fileTreeDocumentGroupRepository struct {
+	mockDocumentGroupRepository
+}
+
+func (m *fileTreeDocumentGroupRepository) GetBySiteID(ctx context.Context, siteID int64) (entity.DocumentGroups, error) {
+	return entity.DocumentGroups{{Id: 100, SiteId: siteID, Category: "Other", Status: entity.DocumentGroupStatusActive}}, nil
+}
+
+// fileTreeDocumentRepository returns two documents for every group
+type fileTreeDocumentRepository struct {
+	mockDocumentRepository
+}
+
+func (m *fileTreeDocumentRepository) GetByGroupID(ctx context.Context, groupID int64) (entity.Documents, error) {
+	return entity.Documents{{Id: 1000}, {Id: 1001}}, nil
+}
+
+// fileTreeFileRepository returns one file per document and fails for failDocumentID
+type fileTreeFileRepository struct {
+	mockFileRepository
+	failDocumentID int64
+}
+
+func (m *fileTreeFileRepository) GetByDocumentID(ctx context.Context, documentID, createdAfter, createdBefore int64) (entity.Files, error) {
+	if documentID == m.failDocumentID {
+		return nil, errors.New("connection reset")
+	}
+	return entity.Files{{Id: documentID, DocumentId: documentID, Name: fmt.Sprintf("file-%d.ini", documentID-1000)}}, nil
+}
+
+func newFileTreeService(failDocumentID int64) FileService {
+	return NewFileService(
+		&mockContractorRepository{},
+		&mockContractorProjectRepository{},
+		&fileTreeProjectRepository{},
+		&fileTreeSiteRepository{},
+		&fileTreeDocumentGroupRepository{},
+		&fileTreeDocumentRepository{},
+		&fileTreeFileRepository{failDocumentID: failDocumentID},
+		nil,
+		&config.Config{},
+	)
+}
+
+func TestFileService_GetContractorFiles_FailFast(t *testing.T) {
+	tests := []struct {
+		name           string
+		failDocumentID int64
+		opts           []FileOption
+		wantErr        bool
+		wantKeys       []string
+	}{
+		{
+			name:     "no read errors",
+			wantKeys: []string{"PRJ/SITE/00_Upload/file-0.ini", "PRJ/SITE/00_Upload/file-1.ini"},
+		},
+		{
+			name:           "best effort skips failing document",
+			failDocumentID: 1001,
+			wantKeys:       []string{"PRJ/SITE/00_Upload/file-0.ini"},
+		},
+		{
+			name:           "fail fast returns document error",
+			failDocumentID: 1001,
+			opts:           []FileOption{WithFailFast()},
+			wantErr:        true,
+		},
+		{
+			name:     "fail fast without errors returns full listing",
+			opts:     []FileOption{WithFailFast()},
+			wantKeys: []string{"PRJ/SITE/00_Upload/file-0.ini", "PRJ/SITE/00_Upload/file-1.ini"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newFileTreeService(tt.failDocumentID)
+
+			objects, err := fs.GetContractorFiles(context.Background(), 1, tt.opts...)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Expected error, got %d objects", len(objects))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var keys []string
+			for _, object := range objects {
+				if object.Bucket != "test-bucket" {
+					t.Errorf("Expected bucket test-bucket, got %s", object.Bucket)
+				}
+				keys = append(keys, object.Key)
+			}
+			sort.Strings(keys)
+
+			if len(keys) != len(tt.wantKeys) {
+				t.Fatalf("Expected keys %v, got %v", tt.wantKeys, keys)
+			}
+			for i := range keys {
+				if keys[i] != tt.wantKeys[i] {
+					t.Errorf("Expected key %s, got %s", tt.wantKeys[i], keys[i])
+				}
+			}
+		})
+	}
+}
+
+// manySitesSiteRepository returns siteCount sites, numbered from 1, for every project
+type manySitesSiteRepository struct {
+	mockSiteRepository
+	siteCount int
+}
+
+func (m *manySitesSiteRepository) GetByProjectID(ctx context.Context, projectID int64) (entity.Sites, error) {
+	sites := make(entity.Sites, 0, m.siteCount)
+	for i := 1; i <= m.siteCount; i++ {
+		sites = append(sites, entity.Site{Id: int64(i), Code: fmt.Sprintf("S%02d", i), ProjectId: projectID})
+	}
+	return sites, nil
+}
+
+// failingSiteDocumentGroupRepository fails to list the groups of failSiteID
+type failingSiteDocumentGroupRepository struct {
+	fileTreeDocumentGroupRepository
+	failSiteID int64
+}
+
+func (m *failingSiteDocumentGroupRepository) GetBySiteID(ctx context.Context, siteID int64) (entity.DocumentGroups, error) {
+	if siteID == m.failSiteID {
+		return nil, errors.New("connection reset")
+	}
+	return m.fileTreeDocumentGroupRepository.GetBySiteID(ctx, siteID)
+}
+
+func TestFileService_GetContractorFiles_ConcurrentSites(t *testing.T) {
+	const siteCount = 50
+	const failSiteID = 17
+
+	tests := []struct {
+		name        string
+		concurrency int
+	}{
+		{name: "sequential", concurrency: 0},
+		{name: "concurrent", concurrency: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := NewFileService(
+				&mockContractorRepository{},
+				&mockContractorProjectRepository{},
+				&fileTreeProjectRepository{},
+				&manySitesSiteRepository{siteCount: siteCount},
+				&failingSiteDocumentGroupRepository{failSiteID: failSiteID},
+				&fileTreeDocumentRepository{},
+				&fileTreeFileRepository{},
+				nil,
+				&config.Config{SiteListConcurrency: tt.concurrency},
+			)
+
+			objects, err := fs.GetContractorFiles(context.Background(), 1)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// The failing site is skipped; every other site contributes its files in site order
+			var want []string
+			for i := 1; i <= siteCount; i++ {
+				if i == failSiteID {
+					continue
+				}
+				want = append(want, fmt.Sprintf("PRJ/S%02d/00_Upload/file-0.ini", i), fmt.Sprintf("PRJ/S%02d/00_Upload/file-1.ini", i))
+			}
+
+			if len(objects) != len(want) {
+				t.Fatalf("Expected %d objects, got %d", len(want), len(objects))
+			}
+			for i, object := range objects {
+				if object.Key != want[i] {
+					t.Errorf("Expected key %s at %d, got %s", want[i], i, object.Key)
+				}
+			}
+		})
+	}
+}
+
+func TestFileService_GetContractorFiles_ConcurrentSitesFailFast(t *testing.T) {
+	fs := NewFileService(
+		&mockContractorRepository{},
+		&mockContractorProjectRepository{},
+		&fileTreeProjectRepository{},
+		&manySitesSiteRepository{siteCount: 20},
+		&failingSiteDocumentGroupRepository{failSiteID: 5},
+		&fileTreeDocumentRepository{},
+		&fileTreeFileRepository{},
+		nil,
+		&config.Config{SiteListConcurrency: 4},
+	)
+
+	if _, err := fs.GetContractorFiles(context.Background(), 1, WithFailFast()); err == nil {
+		t.Fatal("Expected error for the failing site")
+	}
+}
+
+func TestFileService_SkipCounter(t *testing.T) {
+	tests := []struct {
+		name         string
+		groupRepo    repository.DocumentGroupRepository
+		failDocument int64
+		wantObjects  int
+		wantSkipped  int64
+	}{
+		{name: "complete traversal", groupRepo: &fileTreeDocumentGroupRepository{}, wantObjects: 2},
+		{name: "failing document", groupRepo: &fileTreeDocumentGroupRepository{}, failDocument: 1001, wantObjects: 1, wantSkipped: 1},
+		{name: "failing site", groupRepo: &failingSiteDocumentGroupRepository{failSiteID: 10}, wantSkipped: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := NewFileService(
+				&mockContractorRepository{},
+				&mockContractorProjectRepository{},
+				&fileTreeProjectRepository{},
+				&fileTreeSiteRepository{},
+				tt.groupRepo,
+				&fileTreeDocumentRepository{},
+				&fileTreeFileRepository{failDocumentID: tt.failDocument},
+				nil,
+				&config.Config{},
+			)
+
+			var skipped atomic.Int64
+			objects, err := fs.GetProjectFiles(context.Background(), 1, WithSkipCounter(&skipped))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(objects) != tt.wantObjects {
+				t.Errorf("Expected %d objects, got %d", tt.wantObjects, len(objects))
+			}
+			if got := skipped.Load(); got != tt.wantSkipped {
+				t.Errorf("Expected %d skipped entities, got %d", tt.wantSkipped, got)
+			}
+		})
+	}
+}
+
+func TestFileService_FailFast(t *testing.T) {
+	fs := NewFileService(
+		&mockContractorRepository{},
+		&mockContractorProjectRepository{},
+		&fileTreeProjectRepository{},
+		&fileTreeSiteRepository{},
+		&fileTreeDocumentGroupRepository{},
+		&fileTreeDocumentRepository{},
+		&fileTreeFileRepository{failDocumentID: 1001},
+		nil,
+		&config.Config{},
+	)
+
+	var skipped atomic.Int64
+	objects, err := fs.GetProjectFiles(context.Background(), 1, WithFailFast(), WithSkipCounter(&skipped))
+	if err == nil {
+		t.Fatal("Expected an error for the unreadable document")
+	}
+	if objects != nil {
+		t.Errorf("Expected no objects from a failed traversal, got %d", len(objects))
+	}
+	if got := skipped.Load(); got != 1 {
+		t.Errorf("Expected the traversal to stop at 1 unreadable record, got %d", got)
+	}
+}
+
+// cancellingDocumentGroupRepository cancels the traversal's context once it has listed the groups of cancelSiteID
+type cancellingDocumentGroupRepository struct {
+	fileTreeDocumentGroupRepository
+	cancel       context.CancelFunc
+	cancelSiteID int64
+	reads        atomic.Int64
+}
+
+func (m *cancellingDocumentGroupRepository) GetBySiteID(ctx context.Context, siteID int64) (entity.DocumentGroups, error) {
+	m.reads.Add(1)
+	if siteID == m.cancelSiteID {
+		m.cancel()
+	}
+	return m.fileTreeDocumentGroupRepository.GetBySiteID(ctx, siteID)
+}
+
+// cancellingFileRepository cancels the traversal's context once it has read the files of cancelDocumentID
+type cancellingFileRepository struct {
+	fileTreeFileRepository
+	cancel           context.CancelFunc
+	cancelDocumentID int64
+	reads            atomic.Int64
+}
+
+func (m *cancellingFileRepository) GetByDocumentID(ctx context.Context, documentID, createdAfter, createdBefore int64) (entity.Files, error) {
+	m.reads.Add(1)
+	if documentID == m.cancelDocumentID {
+		m.cancel()
+	}
+	return m.fileTreeFileRepository.GetByDocumentID(ctx, documentID, createdAfter, createdBefore)
+}
+
+func TestFileService_Cancellation(t *testing.T) {
+	t.Run("between sites", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		groupRepo := &cancellingDocumentGroupRepository{cancel: cancel, cancelSiteID: 5}
+		fs := NewFileService(
+			&mockContractorRepository{},
+			&mockContractorProjectRepository{},
+			&fileTreeProjectRepository{},
+			&manySitesSiteRepository{siteCount: 50},
+			groupRepo,
+			&fileTreeDocumentRepository{},
+			&fileTreeFileRepository{},
+			nil,
+			&config.Config{SiteListConcurrency: 1},
+		)
+
+		objects, err := fs.GetContractorFiles(ctx, 1)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected context.Canceled, got %v (%d objects)", err, len(objects))
+		}
+		if reads := groupRepo.reads.Load(); reads != 5 {
+			t.Errorf("Expected the traversal to stop after 5 sites, got %d read", reads)
+		}
+	})
+
+	t.Run("between documents", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		fileRepo := &cancellingFileRepository{cancel: cancel, cancelDocumentID: 1000}
+		fs := NewFileService(
+			&mockContractorRepository{},
+			&mockContractorProjectRepository{},
+			&fileTreeProjectRepository{},
+			&fileTreeSiteRepository{},
+			&fileTreeDocumentGroupRepository{},
+			&fileTreeDocumentRepository{},
+			fileRepo,
+			nil,
+			&config.Config{},
+		)
+
+		// Even without fail-fast, a cancelled traversal is an error rather than a skip
+		var skipped atomic.Int64
+		objects, err := fs.GetProjectFiles(ctx, 1, WithSkipCounter(&skipped))
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected context.Canceled, got %v (%d objects)", err, len(objects))
+		}
+		if reads := fileRepo.reads.Load(); reads != 1 {
+			t.Errorf("Expected document 1001 not to be read, got %d reads", reads)
+		}
+		if skipped.Load() != 0 {
+			t.Errorf("Expected nothing counted as skipped, got %d", skipped.Load())
+		}
+	})
+}
+
+// manyDocumentsDocumentRepository returns documentCount documents, numbered from 1000, for every group
+type manyDocumentsDocumentRepository struct {
+	mockDocumentRepository
+	documentCount int
+}
+
+func (m *manyDocumentsDocumentRepository) GetByGroupID(ctx context.Context, groupID int64) (entity.Documents, error) {
+	documents := make(entity.Documents, 0, m.documentCount)
+	for i := 0; i < m.documentCount; i++ {
+		documents = append(documents, entity.Document{Id: int64(1000 + i)})
+	}
+	return documents, nil
+}
+
+// countingFileRepository counts its queries. Like fileTreeFileRepository it returns one file per document and
+// fails for failDocumentID, alone or in a batch.
+type countingFileRepository struct {
+	fileTreeFileRepository
+	singleReads atomic.Int64
+	batchReads  atomic.Int64
+}
+
+func (m *countingFileRepository) GetByDocumentID(ctx context.Context, documentID, createdAfter, createdBefore int64) (entity.Files, error) {
+	m.singleReads.Add(1)
+	return m.fileTreeFileRepository.GetByDocumentID(ctx, documentID, createdAfter, createdBefore)
+}
+
+func (m *countingFileRepository) GetByDocumentIDs(ctx context.Context, documentIDs []int64, createdAfter, createdBefore int64) (entity.Files, error) {
+	m.batchReads.Add(1)
+	var files entity.Files
+	for _, documentID := range documentIDs {
+		if documentID == m.failDocumentID {
+			return nil, errors.New("connection reset")
+		}
+		files = append(files, entity.File{Id: documentID, DocumentId: documentID, Name: fmt.Sprintf("file-%d.ini", documentID-1000)})
+	}
+	return files, nil
+}
+
+func TestFileService_FileReadBatching(t *testing.T) {
+	const documentCount = 250
+
+	tests := []struct {
+		name            string
+		batchSize       int
+		failDocumentID  int64
+		wantSingleReads int64
+		wantBatchReads  int64
+		wantObjects     int
+		wantSkipped     int64
+	}{
+		{name: "one query per document", batchSize: 0, wantSingleReads: documentCount, wantObjects: documentCount},
+		{name: "batched", batchSize: 100, wantBatchReads: 3, wantObjects: documentCount},
+		{name: "single batch", batchSize: 500, wantBatchReads: 1, wantObjects: documentCount},
+		// Only the failing batch of 100 documents is read one by one, which isolates the unreadable document
+		{name: "failing batch", batchSize: 100, failDocumentID: 1150, wantSingleReads: 100, wantBatchReads: 3, wantObjects: documentCount - 1, wantSkipped: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileRepo := &countingFileRepository{fileTreeFileRepository: fileTreeFileRepository{failDocumentID: tt.failDocumentID}}
+			fs := NewFileService(
+				&mockContractorRepository{},
+				&mockContractorProjectRepository{},
+				&fileTreeProjectRepository{},
+				&fileTreeSiteRepository{},
+				&fileTreeDocumentGroupRepository{},
+				&manyDocumentsDocumentRepository{documentCount: documentCount},
+				fileRepo,
+				nil,
+				&config.Config{FileReadBatchSize: tt.batchSize},
+			)
+
+			var skipped atomic.Int64
+			objects, err := fs.GetSiteFiles(context.Background(), 10, WithSkipCounter(&skipped))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(objects) != tt.wantObjects {
+				t.Errorf("Expected %d objects, got %d", tt.wantObjects, len(objects))
+			}
+			if got := skipped.Load(); got != tt.wantSkipped {
+				t.Errorf("Expected %d skipped documents, got %d", tt.wantSkipped, got)
+			}
+			if got := fileRepo.singleReads.Load(); got != tt.wantSingleReads {
+				t.Errorf("Expected %d single document queries, got %d", tt.wantSingleReads, got)
+			}
+			if got := fileRepo.batchReads.Load(); got != tt.wantBatchReads {
+				t.Errorf("Expected %d batch queries, got %d", tt.wantBatchReads, got)
+			}
+
+			// Objects keep the order of the documents whichever way they were read
+			var wantKeys []string
+			for i := 0; i < documentCount; i++ {
+				if int64(1000+i) != tt.failDocumentID {
+					wantKeys = append(wantKeys, fmt.Sprintf("PRJ/SITE/00_Upload/file-%d.ini", i))
+				}
+			}
+			for i, object := range objects {
+				if i < len(wantKeys) && object.Key != wantKeys[i] {
+					t.Fatalf("Expected key %s at %d, got %s", wantKeys[i], i, object.Key)
+				}
+			}
+		})
+	}
+}
+
+// datedFileRepository returns one file per document, created at the document ID's offset from 1000 in hours, when
+// it falls within the creation window like the file queries
+type datedFileRepository struct {
+	mockFileRepository
+}
+
+func (m *datedFileRepository) GetByDocumentID(ctx context.Context, documentID, createdAfter, createdBefore int64) (entity.Files, error) {
+	file := entity.File{Id: documentID, DocumentId: documentID, Name: fmt.Sprintf("file-%d.ini", documentID-1000)}
+	file.CreatedAt = (documentID - 1000) * 3600
+	if (createdAfter != 0 && file.CreatedAt <= createdAfter) || (createdBefore != 0 && file.CreatedAt >= createdBefore) {
+		return entity.Files{}, nil
+	}
+	return entity.Files{file}, nil
+}
+
+func TestFileService_CreatedWindow(t *testing.T) {
+	tests := []struct {
+		name          string
+		createdAfter  int64
+		createdBefore int64
+		wantKeys      []string
+	}{
+		{name: "no bounds", wantKeys: []string{"PRJ/SITE/00_Upload/file-0.ini", "PRJ/SITE/00_Upload/file-1.ini"}},
+		{name: "after the first file", createdAfter: 1800, wantKeys: []string{"PRJ/SITE/00_Upload/file-1.ini"}},
+		{name: "before the second file", createdBefore: 1800, wantKeys: []string{"PRJ/SITE/00_Upload/file-0.ini"}},
+		{name: "bounds are exclusive", createdAfter: 0, createdBefore: 3600, wantKeys: []string{"PRJ/SITE/00_Upload/file-0.ini"}},
+		{name: "after every file", createdAfter: 3600, wantKeys: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := NewFileService(
+				&mockContractorRepository{},
+				&mockContractorProjectRepository{},
+				&fileTreeProjectRepository{},
+				&fileTreeSiteRepository{},
+				&fileTreeDocumentGroupRepository{},
+				&fileTreeDocumentRepository{},
+				&datedFileRepository{},
+				nil,
+				&config.Config{},
+			)
+
+			objects, err := fs.GetSiteFiles(context.Background(), 10, WithCreatedWindow(tt.createdAfter, tt.createdBefore))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var keys []string
+			for _, object := range objects {
+				keys = append(keys, object.Key)
+			}
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("Expected keys %v, got %v", tt.wantKeys, keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	log "github.com/sirupsen/logrus"
+)
+
+type allowedPrefixesKey struct{}
+
+// withAllowedPrefixes returns a context under which DeleteObjects only deletes, and QuarantineObjects only tags,
+// keys under one of prefixes, in its bucket. It guards against a key built for another tenant, independently of the protected prefixes.
+func withAllowedPrefixes(ctx context.Context, prefixes []BucketPrefix) context.Context {
+	return context.WithValue(ctx, allowedPrefixesKey{}, prefixes)
+}
+
+// allowedPrefixesFromContext returns the prefixes set by withAllowedPrefixes, and whether any were set
+func allowedPrefixesFromContext(ctx context.Context) ([]BucketPrefix, bool) {
+	prefixes, ok := ctx.Value(allowedPrefixesKey{}).([]BucketPrefix)
+	return prefixes, ok
+}
+
+// FilterAllowedPrefixes splits objects into those under one of the allowed bucket prefixes and those outside
+// all of them. An empty allowlist allows nothing.
+func FilterAllowedPrefixes(objects []dto.S3Object, allowed []BucketPrefix) (inside, outside []dto.S3Object) {
+	for _, obj := range objects {
+		if isUnderPrefix(obj, allowed) {
+			inside = append(inside, obj)
+			continue
+		}
+		outside = append(outside, obj)
+	}
+	return inside, outside
+}
+
+// isUnderPrefix reports whether the object's bucket and key fall under one of prefixes
+func isUnderPrefix(obj dto.S3Object, prefixes []BucketPrefix) bool {
+	for _, prefix := range prefixes {
+		if obj.Bucket == prefix.Bucket && strings.HasPrefix(obj.Key, prefix.Prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// logOutsidePrefixes logs every object skipped for being outside the operation's allowed prefixes
+func logOutsidePrefixes(ctx context.Context, outside []dto.S3Object) {
+	logger := workerLog.GetLoggerFromContext(ctx)
+	for _, obj := range outside {
+		logger.WithFields(log.Fields{
+			"bucket": obj.Bucket,
+			"key":    obj.Key,
+		}).Error("Skipping object outside the allowed key prefixes")
+	}
+}
+
+// allowedPrefixes computes, from the database rows and the key templates rather than from the files found, the
+// upload and processed prefixes of every site the message covers, in the bucket of the owning contractor, and for a
+// contractor the location of its lambda logs
+func (cs *CleansingServiceImpl) allowedPrefixes(ctx context.Context, message dto.CleansingMessage) ([]BucketPrefix, error) {
+	var (
+		contractor *entity.Contractor
+		projects   entity.Projects
+		err        error
+	)
+	switch message.Type {
+	case dto.CleansingTypeContractor:
+		contractor, err = retryRead(ctx, cs.readRetry, func() (*entity.Contractor, error) {
+			return cs.contractorRepo.GetByID(ctx, message.ID)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get contractor %d: %w", message.ID, err)
+		}
+		// A contractor purge covers its soft-deleted projects as well
+		projects, err = retryRead(ctx, cs.readRetry, func() (entity.Projects, error) {
+			return cs.projectRepo.GetByContractorID(ctx, message.ID, true)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get projects of contractor %d: %w", message.ID, err)
+		}
+	case dto.CleansingTypeProject:
+		project, err := retryRead(ctx, cs.readRetry, func() (*entity.Project, error) {
+			return cs.projectRepo.GetByID(ctx, message.ID)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get project %d: %w", message.ID, err)
+		}
+		if contractor, err = cs.projectContractor(ctx, project.Id); err != nil {
+			return nil, err
+		}
+		projects = entity.Projects{*project}
+	case dto.CleansingTypeSite:
+		site, err := retryRead(ctx, cs.readRetry, func() (*entity.Site, error) {
+			return cs.siteRepo.GetByID(ctx, message.ID)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get site %d: %w", message.ID, err)
+		}
+		project, err := retryRead(ctx, cs.readRetry, func() (*entity.Project, error) {
+			return cs.projectRepo.GetByID(ctx, site.ProjectId)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get project %d of site %d: %w", site.ProjectId, site.Id, err)
+		}
+		if contractor, err = cs.projectContractor(ctx, project.Id); err != nil {
+			return nil, err
+		}
+		return cs.sitePrefixes(contractorBucket(*contractor), *project, entity.Sites{*site})
+	default:
+		return nil, fmt.Errorf("invalid cleansing type: %s", message.Type)
+	}
+
+	bucket := contractorBucket(*contractor)
+	var prefixes []BucketPrefix
+	// A contractor's lambda logs are its own when they are in a folder named after it
+	if message.Type == dto.CleansingTypeContractor {
+		if location, skipReason := lambdaLogLocation(contractor); skipReason == "" {
+			prefixes = append(prefixes, location)
+		}
+	}
+	for _, project := range projects {
+		sites, err := retryRead(ctx, cs.readRetry, func() (entity.Sites, error) {
+			return cs.siteRepo.GetByProjectID(ctx, project.Id)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get sites for project %d: %w", project.Id, err)
+		}
+		projectPrefixes, err := cs.sitePrefixes(bucket, project, sites)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, projectPrefixes...)
+	}
+	return prefixes, nil
+}
+
+// sitePrefixes renders the upload and processed prefixes of each of the project's sites in bucket
+func (cs *CleansingServiceImpl) sitePrefixes(bucket string, project entity.Project, sites entity.Sites) ([]BucketPrefix, error) {
+	prefixes := make([]BucketPrefix, 0, 2*len(sites))
+	for _, site := range sites {
+		uploadPrefix, err := cs.keyTemplates.UploadPrefix(project, site)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render upload key for site %d: %w", site.Id, err)
+		}
+		processedPrefix, err := cs.keyTemplates.ProcessedPrefix(project, site)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render processed key for site %d: %w", site.Id, err)
+		}
+		prefixes = append(prefixes, BucketPrefix{Bucket: bucket, Prefix: uploadPrefix}, BucketPrefix{Bucket: bucket, Prefix: processedPrefix})
+	}
+	return prefixes, nil
+}
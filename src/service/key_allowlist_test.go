@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+)
+
+func TestFilterAllowedPrefixes(t *testing.T) {
+	allowed := []BucketPrefix{
+		{Bucket: "b", Prefix: "PRJ/S1/00_Upload/"},
+		{Bucket: "b", Prefix: "PRJ/S1/01_Processed/"},
+	}
+
+	tests := []struct {
+		name    string
+		object  dto.S3Object
+		allowed []BucketPrefix
+		want    bool
+	}{
+		{name: "upload key", object: dto.S3Object{Bucket: "b", Key: "PRJ/S1/00_Upload/a.xtf"}, allowed: allowed, want: true},
+		{name: "processed key", object: dto.S3Object{Bucket: "b", Key: "PRJ/S1/01_Processed/a.tif"}, allowed: allowed, want: true},
+		{name: "other site", object: dto.S3Object{Bucket: "b", Key: "PRJ/S2/00_Upload/a.xtf"}, allowed: allowed, want: false},
+		{name: "other project", object: dto.S3Object{Bucket: "b", Key: "PRJX/S1/00_Upload/a.xtf"}, allowed: allowed, want: false},
+		{name: "site code prefix of another", object: dto.S3Object{Bucket: "b", Key: "PRJ/S10/00_Upload/a.xtf"}, allowed: allowed, want: false},
+		{name: "other bucket", object: dto.S3Object{Bucket: "other", Key: "PRJ/S1/00_Upload/a.xtf"}, allowed: allowed, want: false},
+		{name: "empty allowlist", object: dto.S3Object{Bucket: "b", Key: "PRJ/S1/00_Upload/a.xtf"}, allowed: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inside, outside := FilterAllowedPrefixes([]dto.S3Object{tt.object}, tt.allowed)
+			if got := len(inside) == 1; got != tt.want || len(inside)+len(outside) != 1 {
+				t.Errorf("Expected allowed = %v, got inside %v, outside %v", tt.want, inside, outside)
+			}
+		})
+	}
+}
+
+func TestS3Service_DeleteObjects_SkipsKeysOutsideAllowedPrefixes(t *testing.T) {
+	client := &mockS3Client{}
+	objects := []dto.S3Object{
+		{Bucket: "b", Key: "PRJ/S1/00_Upload/a.txt"},
+		{Bucket: "b", Key: "PRJ/S2/00_Upload/b.txt"},
+		{Bucket: "other", Key: "PRJ/S1/00_Upload/c.txt"},
+	}
+
+	ctx := withAllowedPrefixes(context.Background(), []BucketPrefix{{Bucket: "b", Prefix: "PRJ/S1/"}})
+	deleted, err := newTestS3Service(client).DeleteObjects(ctx, objects)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("Expected 1 deleted object, got %d", deleted)
+	}
+	if len(client.deletedKeys) != 1 || client.deletedKeys[0] != "PRJ/S1/00_Upload/a.txt" {
+		t.Errorf("Expected only PRJ/S1/00_Upload/a.txt to be sent to DeleteObjects, got %q", client.deletedKeys)
+	}
+
+	// Without an allowlist in the context every safe key is deleted
+	client = &mockS3Client{}
+	if deleted, err := newTestS3Service(client).DeleteObjects(context.Background(), objects); err != nil || deleted != 3 {
+		t.Errorf("Expected 3 deleted objects without an allowlist, got %d (%v)", deleted, err)
+	}
+}
+
+// leakingS3Service lists a site's files with extra objects that belong to other tenants
+type leakingS3Service struct {
+	*S3ServiceImpl
+	extra []dto.S3Object
+}
+
+func (m *leakingS3Service) ListSiteFiles(ctx context.Context, siteID int64, opts ...FileOption) ([]dto.S3Object, error) {
+	objects, err := m.S3ServiceImpl.ListSiteFiles(ctx, siteID, opts...)
+	return append(objects, m.extra...), err
+}
+
+func TestCleansingService_DeleteSiteFiles_AllowedPrefixes(t *testing.T) {
+	client := &mockS3Client{}
+	fileService := newFileTreeService(0)
+	s3Service := &leakingS3Service{
+		S3ServiceImpl: NewS3Service(client, aws.Config{}, &config.Config{}, fileService).(*S3ServiceImpl),
+		extra: []dto.S3Object{
+			{Bucket: "test-bucket", Key: "OTHER/SITE/00_Upload/foreign.ini"},     // Another project
+			{Bucket: "test-bucket", Key: "PRJ/SITE2/00_Upload/sibling.ini"},      // Another site
+			{Bucket: "other-bucket", Key: "PRJ/SITE/00_Upload/other-bucket.ini"}, // Another bucket
+		},
+	}
+	service := NewCleansingService(s3Service, &mockContractorRepository{}, &mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{},
+		&fileTreeProjectRepository{}, &fileTreeSiteRepository{}, &fileTreeDocumentGroupRepository{}, &fileTreeDocumentRepository{}, &fileTreeFileRepository{}, &mockUploaderContractorUsageRepository{})
+
+	if _, err := service.DeleteSiteFiles(context.Background(), 10); err != nil {
+		t.Fatalf("DeleteSiteFiles() unexpected error: %v", err)
+	}
+
+	sort.Strings(client.deletedKeys)
+	want := []string{"PRJ/SITE/00_Upload/file-0.ini", "PRJ/SITE/00_Upload/file-1.ini"}
+	if strings.Join(client.deletedKeys, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected only the site's own keys %v to be deleted, got %v", want, client.deletedKeys)
+	}
+}
+
+func TestCleansingService_DB_AllowedPrefixes(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	service := newDBCleansingService(db, &config.Config{}).(*CleansingServiceImpl)
+
+	site100 := []string{"PRJA/S100/00_Upload/", "PRJA/S100/01_Processed/"}
+	site101 := []string{"PRJA/S101/00_Upload/", "PRJA/S101/01_Processed/"}
+	tests := []struct {
+		name    string
+		message dto.CleansingMessage
+		want    []string
+	}{
+		{name: "site", message: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: testutil.SiteID}, want: site100},
+		{name: "project", message: dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: testutil.ProjectID}, want: append(site100, site101...)},
+		{name: "project without sites", message: dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: testutil.SecondProjectID}, want: nil},
+		{name: "contractor", message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: testutil.ContractorID}, want: append(site100, site101...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefixes, err := service.allowedPrefixes(context.Background(), tt.message)
+			if err != nil {
+				t.Fatalf("allowedPrefixes() unexpected error: %v", err)
+			}
+			var got []string
+			for _, prefix := range prefixes {
+				if prefix.Bucket != testutil.Bucket {
+					t.Errorf("Expected prefix %s in %s, got %s", prefix.Prefix, testutil.Bucket, prefix.Bucket)
+				}
+				got = append(got, prefix.Prefix)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected prefixes %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := service.allowedPrefixes(context.Background(), dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: 999}); err == nil {
+		t.Error("Expected error for unknown site")
+	}
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"github.com/denys89/wadugs-worker-cleansing/src/repository"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxKeyManifestSize is the largest key manifest read, in bytes
+const maxKeyManifestSize = 64 << 20
+
+// ErrInvalidManifest is returned for a key manifest that is missing, too large, or has a line that is not a valid key
+// of the contractor's bucket. Nothing is deleted, and retrying cannot succeed until the manifest is fixed.
+var ErrInvalidManifest = errors.New("invalid key manifest")
+
+// ParseKeyManifest reads the keys a manifest lists for deletion from bucket. A manifest is either one key per line,
+// or CSV whose header row names a "key" column; a "bucket" column, as in the deletion manifests this worker writes,
+// must name bucket on every row. Blank lines and lines starting with # are ignored. Every key must be a file key
+// S3 accepts; the first line that is not fails the whole manifest with an ErrInvalidManifest error.
+func ParseKeyManifest(r io.Reader, bucket string) ([]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+
+	header := false
+	keyColumn, bucketColumn := 0, -1
+	var keys []string
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		if first {
+			if column, ok := manifestHeader(record); ok {
+				header = true
+				keyColumn = column["key"]
+				if i, ok := column["bucket"]; ok {
+					bucketColumn = i
+				}
+				continue
+			}
+		}
+
+		if !header && len(record) != 1 {
+			return nil, fmt.Errorf("%w: line %d has %d fields; quote keys containing commas or add a header naming the key column",
+				ErrInvalidManifest, line, len(record))
+		}
+		if keyColumn >= len(record) || bucketColumn >= len(record) {
+			return nil, fmt.Errorf("%w: line %d has %d fields, fewer than its header", ErrInvalidManifest, line, len(record))
+		}
+		if bucketColumn >= 0 && strings.TrimSpace(record[bucketColumn]) != bucket {
+			return nil, fmt.Errorf("%w: line %d names bucket %q, not the contractor's bucket %s", ErrInvalidManifest, line, record[bucketColumn], bucket)
+		}
+
+		key := record[keyColumn]
+		switch {
+		case isUnsafeKey(key):
+			return nil, fmt.Errorf("%w: line %d: %q is not a file key", ErrInvalidManifest, line, key)
+		case len(key) > maxKeyLength:
+			return nil, fmt.Errorf("%w: line %d: key is %d bytes, longer than S3 allows", ErrInvalidManifest, line, len(key))
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: it lists no keys", ErrInvalidManifest)
+	}
+	return keys, nil
+}
+
+// manifestHeader returns the column of each lower-cased field name when record is a header naming a key column
+func manifestHeader(record []string) (map[string]int, bool) {
+	columns := make(map[string]int, len(record))
+	for i, field := range record {
+		name := strings.ToLower(strings.TrimSpace(field))
+		if _, ok := columns[name]; !ok {
+			columns[name] = i
+		}
+	}
+	_, ok := columns["key"]
+	return columns, ok
+}
+
+// deleteManifestKeys deletes the keys listed in the message's manifest from the bucket of the contractor it names,
+// like DeleteObjectsDirect. The manifest is validated in full before anything is deleted.
+func (cs *CleansingServiceImpl) deleteManifestKeys(ctx context.Context, message dto.CleansingMessage) (*dto.CleansingResult, error) {
+	logger := workerLog.GetLoggerFromContext(ctx).WithFields(log.Fields{
+		"contractor_id": message.ID,
+		"manifest":      "s3://" + message.ManifestBucket + "/" + message.ManifestKey,
+	})
+
+	result := &dto.CleansingResult{
+		Type:        message.Type,
+		ID:          message.ID,
+		Success:     false,
+		Quarantined: cs.quarantines(message),
+	}
+
+	contractor, err := retryRead(ctx, cs.readRetry, func() (*entity.Contractor, error) {
+		return cs.contractorRepo.GetByID(ctx, message.ID)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		err = fmt.Errorf("%w: contractor %d", ErrContractorNotFound, message.ID)
+	}
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to get contractor: %v", err)
+		return result, err
+	}
+	bucket := contractorBucket(*contractor)
+
+	keys, err := cs.readKeyManifest(ctx, message.ManifestBucket, message.ManifestKey, bucket)
+	if err != nil {
+		logger.WithError(err).Error("Failed to read key manifest")
+		result.Error = err.Error()
+		return result, err
+	}
+
+	// A manifest naming more keys than allowed is refused before anything is deleted
+	if cs.maxObjects > 0 && len(keys) > cs.maxObjects {
+		if !message.OverrideObjectLimit {
+			err := fmt.Errorf("%w: manifest lists %d keys, limit is %d", ErrObjectLimitExceeded, len(keys), cs.maxObjects)
+			logger.WithError(err).Error("Refusing to delete manifest keys")
+			result.Error = err.Error()
+			return result, err
+		}
+		logger.WithFields(log.Fields{
+			"key_count": len(keys),
+			"limit":     cs.maxObjects,
+		}).Warn("Object limit overridden by message")
+	}
+
+	objects := make([]dto.S3Object, 0, len(keys))
+	for _, key := range keys {
+		objects = append(objects, dto.S3Object{Bucket: bucket, Key: key, Region: contractor.AwsBucketRegion})
+	}
+	objects = cs.deletableObjects(ctx, result, objects)
+
+	// Keys are deleted as for the contractor, so only keys under its sites' prefixes go
+	removeMessage := dto.CleansingMessage{
+		Type:                dto.CleansingTypeContractor,
+		ID:                  contractor.Id,
+		Quarantine:          message.Quarantine,
+		OverrideObjectLimit: message.OverrideObjectLimit,
+	}
+	deletedCount, err := cs.removeObjects(ctx, removeMessage, objects)
+	result.FilesDeleted = deletedCount
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to delete objects: %v", err)
+		return result, err
+	}
+	result.AddRemoved(objects)
+
+	result.Success = true
+	result.Message = fmt.Sprintf("Deleted %d of %d manifest keys from bucket %s", deletedCount, len(keys), bucket)
+	logger.WithFields(log.Fields{
+		"bucket":        bucket,
+		"files_deleted": deletedCount,
+		"files_skipped": result.FilesSkipped,
+	}).Info("Completed manifest key deletion")
+
+	return result, nil
+}
+
+// readKeyManifest downloads and parses the manifest at manifestBucket/manifestKey, listing keys of bucket
+func (cs *CleansingServiceImpl) readKeyManifest(ctx context.Context, manifestBucket, manifestKey, bucket string) ([]string, error) {
+	body, err := cs.s3Service.GetObject(ctx, manifestBucket, manifestKey)
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, fmt.Errorf("%w: s3://%s/%s does not exist", ErrInvalidManifest, manifestBucket, manifestKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(body, maxKeyManifestSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read s3://%s/%s: %w", manifestBucket, manifestKey, err)
+	}
+	if len(data) > maxKeyManifestSize {
+		return nil, fmt.Errorf("%w: s3://%s/%s is larger than %d bytes", ErrInvalidManifest, manifestBucket, manifestKey, maxKeyManifestSize)
+	}
+	return ParseKeyManifest(bytes.NewReader(data), bucket)
+}
+
+// GetObject reads bucket/key with the default client; the caller closes the body. Key manifests are supplied by
+// operators, so they are read with the worker's own credentials even for a contractor.
+func (s3s *S3ServiceImpl) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	if err := s3s.rateLimiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("rate limiter context cancelled: %w", err)
+	}
+	output, err := s3s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get s3://%s/%s: %w", bucket, key, err)
+	}
+	return output.Body, nil
+}
+
+func (ns *NullS3Service) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("")), nil
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+)
+
+func TestParseKeyManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		wantKeys []string
+		wantErr  string
+	}{
+		{
+			name:     "one key per line",
+			manifest: "PRJA/S100/00_Upload/a.tif\nPRJA/S100/00_Upload/b.tif\n",
+			wantKeys: []string{"PRJA/S100/00_Upload/a.tif", "PRJA/S100/00_Upload/b.tif"},
+		},
+		{
+			name:     "blank lines and comments",
+			manifest: "# audit 2026-10\n\nPRJA/S100/00_Upload/a.tif\r\n\n",
+			wantKeys: []string{"PRJA/S100/00_Upload/a.tif"},
+		},
+		{
+			name:     "quoted key with a comma",
+			manifest: "\"PRJA/S100/00_Upload/a,b.tif\"\n",
+			wantKeys: []string{"PRJA/S100/00_Upload/a,b.tif"},
+		},
+		{
+			name:     "deletion manifest CSV",
+			manifest: "bucket,key,size,region\ncontractor-bucket,PRJA/S100/00_Upload/a.tif,10,ap-southeast-1\n",
+			wantKeys: []string{"PRJA/S100/00_Upload/a.tif"},
+		},
+		{
+			name:     "key column only",
+			manifest: "Key\nPRJA/S100/00_Upload/a.tif\n",
+			wantKeys: []string{"PRJA/S100/00_Upload/a.tif"},
+		},
+		{
+			name:     "row of another bucket",
+			manifest: "key,bucket\nPRJA/S100/00_Upload/a.tif,contractor-bucket\nPRJX/S200/00_Upload/x.shp,other-bucket\n",
+			wantErr:  "line 3 names bucket \"other-bucket\"",
+		},
+		{
+			name:     "several fields without a header",
+			manifest: "PRJA/S100/00_Upload/a.tif,PRJA/S100/00_Upload/b.tif\n",
+			wantErr:  "line 1 has 2 fields",
+		},
+		{
+			name:     "row shorter than its header",
+			manifest: "bucket,key\ncontractor-bucket\n",
+			wantErr:  "line 2 has 1 fields",
+		},
+		{
+			name:     "directory key",
+			manifest: "PRJA/S100/00_Upload/a.tif\nPRJA/S100/\n",
+			wantErr:  "line 2: \"PRJA/S100/\" is not a file key",
+		},
+		{
+			name:     "blank key",
+			manifest: "key,size\n\" \",10\n",
+			wantErr:  "line 2: \" \" is not a file key",
+		},
+		{
+			name:     "key longer than S3 allows",
+			manifest: strings.Repeat("k", maxKeyLength+1) + "\n",
+			wantErr:  "longer than S3 allows",
+		},
+		{
+			name:     "no keys",
+			manifest: "# nothing to delete\n",
+			wantErr:  "it lists no keys",
+		},
+		{
+			name:     "malformed CSV",
+			manifest: "\"PRJA/S100/00_Upload/a.tif\n",
+			wantErr:  "extraneous or missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ParseKeyManifest(strings.NewReader(tt.manifest), testutil.Bucket)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrInvalidManifest) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected an ErrInvalidManifest error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if fmt.Sprint(keys) != fmt.Sprint(tt.wantKeys) {
+				t.Errorf("Expected keys %v, got %v", tt.wantKeys, keys)
+			}
+		})
+	}
+}
+
+func TestS3Service_GetObject(t *testing.T) {
+	client := &mockS3Client{objects: map[string]string{"audit-bucket/keys.txt": "PRJA/S100/00_Upload/a.tif\n"}}
+	s3s := NewS3Service(client, aws.Config{}, &config.Config{}, nil)
+
+	body, err := s3s.GetObject(context.Background(), "audit-bucket", "keys.txt")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer body.Close()
+	keys, err := ParseKeyManifest(body, testutil.Bucket)
+	if err != nil || len(keys) != 1 || keys[0] != "PRJA/S100/00_Upload/a.tif" {
+		t.Errorf("Expected the manifest key, got %v (%v)", keys, err)
+	}
+
+	if _, err := s3s.GetObject(context.Background(), "audit-bucket", "missing.txt"); err == nil {
+		t.Error("Expected an error for a missing object")
+	}
+}
+
+func TestCleansingService_DB_DeleteManifestKeys(t *testing.T) {
+	const manifestBucket = "audit-bucket"
+	manifests := map[string]string{
+		manifestBucket + "/keys.txt": "PRJA/S100/00_Upload/depth.tif\nPRJA/S101/00_Upload/photo.jpg\nPRJA/S100/00_Upload/depth.tif\n",
+		manifestBucket + "/keys.csv": "bucket,key,size,region\n" + testutil.Bucket + ",PRJA/S100/00_Upload/depth.tif,300," + testutil.Region + "\n",
+		manifestBucket + "/bad.txt":  "PRJA/S100/00_Upload/depth.tif\nPRJA/S100/\n",
+	}
+
+	tests := []struct {
+		name        string
+		cfg         config.Config
+		manifestKey string
+		override    bool
+		wantKeys    []string
+		wantSkipped int
+		wantErr     error
+	}{
+		{name: "key list", manifestKey: "keys.txt", wantKeys: []string{"PRJA/S100/00_Upload/depth.tif", "PRJA/S101/00_Upload/photo.jpg"}, wantSkipped: 1},
+		{name: "deletion manifest CSV", manifestKey: "keys.csv", wantKeys: []string{"PRJA/S100/00_Upload/depth.tif"}},
+		{name: "invalid line", manifestKey: "bad.txt", wantErr: ErrInvalidManifest},
+		{name: "missing manifest", manifestKey: "missing.txt", wantErr: ErrInvalidManifest},
+		{name: "over the object limit", cfg: config.Config{MaxObjectsPerOperation: 2}, manifestKey: "keys.txt", wantErr: ErrObjectLimitExceeded},
+		{name: "object limit overridden", cfg: config.Config{MaxObjectsPerOperation: 2}, manifestKey: "keys.txt", override: true,
+			wantKeys: []string{"PRJA/S100/00_Upload/depth.tif", "PRJA/S101/00_Upload/photo.jpg"}, wantSkipped: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewMigratedDB(t)
+			testutil.SeedTree(t, db)
+			s3Service := &mockS3Service{getObjects: manifests}
+			service := newDBCleansingServiceWithS3(db, &tt.cfg, s3Service)
+
+			result, err := service.ProcessCleansingMessage(context.Background(), dto.CleansingMessage{
+				Type:                dto.CleansingTypeManifest,
+				ID:                  testutil.ContractorID,
+				ManifestBucket:      manifestBucket,
+				ManifestKey:         tt.manifestKey,
+				OverrideObjectLimit: tt.override,
+			})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+				}
+				if len(s3Service.deleted) != 0 {
+					t.Errorf("Expected nothing deleted, got %v", s3Service.deleted)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(s3Service.deleted) != len(tt.wantKeys) {
+				t.Fatalf("Expected %d deleted objects, got %v", len(tt.wantKeys), s3Service.deleted)
+			}
+			for i, obj := range s3Service.deleted {
+				if obj.Key != tt.wantKeys[i] || obj.Bucket != testutil.Bucket || obj.Region != testutil.Region {
+					t.Errorf("Expected %s/%s in %s, got %+v", testutil.Bucket, tt.wantKeys[i], testutil.Region, obj)
+				}
+			}
+			if result.Type != dto.CleansingTypeManifest || result.FilesDeleted != len(tt.wantKeys) || result.FilesSkipped != tt.wantSkipped {
+				t.Errorf("Expected a manifest result with %d deleted and %d skipped, got %+v", len(tt.wantKeys), tt.wantSkipped, result)
+			}
+		})
+	}
+}
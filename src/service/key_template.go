@@ -0,0 +1,166 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+)
+
+const (
+	// Default S3 key prefixes: {projectCode}/{siteCode}/00_Upload/ and {projectCode}/{siteCode}/01_Processed/
+	DefaultUploadKeyTemplate    = "{{.ProjectCode}}/{{.SiteCode}}/00_Upload/"
+	DefaultProcessedKeyTemplate = "{{.ProjectCode}}/{{.SiteCode}}/01_Processed/"
+
+	// How a path separator in a project or site code is handled: rejected, or percent-encoded into the key segment
+	KeyCodeSeparatorsReject = "reject"
+	KeyCodeSeparatorsEncode = "encode"
+)
+
+// ErrUnusableKeyCode is returned when a project or site code cannot be used as a segment of an S3 key, such as an
+// empty code or one containing a path separator. The code must be fixed in the database, so it is not retried.
+var ErrUnusableKeyCode = errors.New("unusable key code")
+
+// keyCodeSeparatorEncoder percent-encodes the path separators of a code, as in KeyCodeSeparatorsEncode mode
+var keyCodeSeparatorEncoder = strings.NewReplacer("/", "%2F", `\`, "%5C")
+
+type (
+	// KeyTemplates renders the S3 key prefixes under which a site's uploaded and processed files live
+	KeyTemplates struct {
+		upload           *template.Template
+		processed        *template.Template
+		encodeSeparators bool // Path separators in codes are percent-encoded instead of rejected
+	}
+
+	// keyTemplateData holds the fields available to key templates
+	keyTemplateData struct {
+		ProjectID   int64
+		ProjectCode string
+		SiteID      int64
+		SiteCode    string
+	}
+)
+
+// NewKeyTemplates parses the upload and processed key templates from cfg, falling back to the defaults
+// for empty values. Templates are test-rendered so unknown fields are reported here rather than per file.
+func NewKeyTemplates(cfg *config.Config) (*KeyTemplates, error) {
+	separators, err := ParseKeyCodeSeparators(cfg.KeyCodeSeparators)
+	if err != nil {
+		return nil, err
+	}
+	upload, err := parseKeyTemplate("upload", cfg.UploadKeyTemplate, DefaultUploadKeyTemplate)
+	if err != nil {
+		return nil, err
+	}
+	processed, err := parseKeyTemplate("processed", cfg.ProcessedKeyTemplate, DefaultProcessedKeyTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyTemplates{upload: upload, processed: processed, encodeSeparators: separators == KeyCodeSeparatorsEncode}, nil
+}
+
+// ParseKeyCodeSeparators validates how path separators in codes are handled, falling back to KeyCodeSeparatorsReject
+// for an empty value
+func ParseKeyCodeSeparators(mode string) (string, error) {
+	switch mode {
+	case "":
+		return KeyCodeSeparatorsReject, nil
+	case KeyCodeSeparatorsReject, KeyCodeSeparatorsEncode:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid key code separators %q: expected %s or %s", mode, KeyCodeSeparatorsReject, KeyCodeSeparatorsEncode)
+	}
+}
+
+// parseKeyTemplate parses text (or fallback when empty) and checks that it renders
+func parseKeyTemplate(name, text, fallback string) (*template.Template, error) {
+	if strings.TrimSpace(text) == "" {
+		text = fallback
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s key template %q: %w", name, text, err)
+	}
+	if _, err := renderKeyPrefix(tmpl, keyTemplateData{ProjectCode: "PRJ", SiteCode: "SITE"}); err != nil {
+		return nil, fmt.Errorf("invalid %s key template %q: %w", name, text, err)
+	}
+	return tmpl, nil
+}
+
+// UploadPrefix returns the key prefix of a site's uploaded files
+func (kt *KeyTemplates) UploadPrefix(project entity.Project, site entity.Site) (string, error) {
+	data, err := kt.newKeyTemplateData(project, site)
+	if err != nil {
+		return "", err
+	}
+	return renderKeyPrefix(kt.upload, data)
+}
+
+// ProcessedPrefix returns the key prefix of a site's processed files
+func (kt *KeyTemplates) ProcessedPrefix(project entity.Project, site entity.Site) (string, error) {
+	data, err := kt.newKeyTemplateData(project, site)
+	if err != nil {
+		return "", err
+	}
+	return renderKeyPrefix(kt.processed, data)
+}
+
+// newKeyTemplateData returns the template fields of a site with its project and site codes sanitized
+func (kt *KeyTemplates) newKeyTemplateData(project entity.Project, site entity.Site) (keyTemplateData, error) {
+	projectCode, err := kt.sanitizeCode(project.Code)
+	if err != nil {
+		return keyTemplateData{}, fmt.Errorf("project %d code %q: %w", project.Id, project.Code, err)
+	}
+	siteCode, err := kt.sanitizeCode(site.Code)
+	if err != nil {
+		return keyTemplateData{}, fmt.Errorf("site %d code %q: %w", site.Id, site.Code, err)
+	}
+	return keyTemplateData{
+		ProjectID:   project.Id,
+		ProjectCode: projectCode,
+		SiteID:      site.Id,
+		SiteCode:    siteCode,
+	}, nil
+}
+
+// sanitizeCode turns a project or site code into a single key segment: surrounding whitespace is trimmed, and path
+// separators are rejected or percent-encoded. Other characters, Unicode included, are kept as they are. A code that
+// is empty, a relative path element or holds control characters is always rejected.
+func (kt *KeyTemplates) sanitizeCode(code string) (string, error) {
+	code = strings.TrimSpace(code)
+	switch code {
+	case "":
+		return "", fmt.Errorf("%w: empty", ErrUnusableKeyCode)
+	case ".", "..":
+		return "", fmt.Errorf("%w: relative path element", ErrUnusableKeyCode)
+	}
+	if strings.IndexFunc(code, unicode.IsControl) >= 0 {
+		return "", fmt.Errorf("%w: contains a control character", ErrUnusableKeyCode)
+	}
+	if strings.ContainsAny(code, `/\`) {
+		if !kt.encodeSeparators {
+			return "", fmt.Errorf("%w: contains a path separator", ErrUnusableKeyCode)
+		}
+		code = keyCodeSeparatorEncoder.Replace(code)
+	}
+	return code, nil
+}
+
+// renderKeyPrefix executes tmpl and ensures the result ends with a single "/"
+func renderKeyPrefix(tmpl *template.Template, data keyTemplateData) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+
+	prefix := strings.TrimSpace(sb.String())
+	if prefix == "" {
+		return "", fmt.Errorf("%s key template rendered an empty prefix", tmpl.Name())
+	}
+	return strings.TrimRight(prefix, "/") + "/", nil
+}
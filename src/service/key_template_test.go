@@ -0,0 +1,135 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+)
+
+func TestNewKeyTemplates(t *testing.T) {
+	project := entity.Project{Id: 7, Code: "PRJ"}
+	site := entity.Site{Id: 70, Code: "SITE"}
+
+	tests := []struct {
+		name          string
+		upload        string
+		processed     string
+		wantErr       bool
+		wantUpload    string
+		wantProcessed string
+	}{
+		{
+			name:          "defaults",
+			wantUpload:    "PRJ/SITE/00_Upload/",
+			wantProcessed: "PRJ/SITE/01_Processed/",
+		},
+		{
+			name:          "custom templates get a trailing slash",
+			upload:        "uploads/{{.ProjectCode}}/{{.SiteCode}}",
+			processed:     "{{.ProjectID}}/{{.SiteID}}/out//",
+			wantUpload:    "uploads/PRJ/SITE/",
+			wantProcessed: "7/70/out/",
+		},
+		{name: "syntax error", upload: "{{.ProjectCode", wantErr: true},
+		{name: "unknown field", processed: "{{.ContractorCode}}/", wantErr: true},
+		{name: "empty rendering", upload: "{{if false}}x{{end}}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templates, err := NewKeyTemplates(&config.Config{UploadKeyTemplate: tt.upload, ProcessedKeyTemplate: tt.processed})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected error for invalid template")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got, err := templates.UploadPrefix(project, site); err != nil || got != tt.wantUpload {
+				t.Errorf("UploadPrefix() = %q, %v; want %q", got, err, tt.wantUpload)
+			}
+			if got, err := templates.ProcessedPrefix(project, site); err != nil || got != tt.wantProcessed {
+				t.Errorf("ProcessedPrefix() = %q, %v; want %q", got, err, tt.wantProcessed)
+			}
+		})
+	}
+}
+
+func TestKeyTemplates_SanitizesCodes(t *testing.T) {
+	tests := []struct {
+		name        string
+		separators  string
+		projectCode string
+		siteCode    string
+		wantUpload  string
+		wantErr     string
+	}{
+		{name: "surrounding spaces trimmed", projectCode: "  PRJ ", siteCode: "\tSITE\n", wantUpload: "PRJ/SITE/00_Upload/"},
+		{name: "inner spaces kept", projectCode: "PRJ A", siteCode: "SITE 1", wantUpload: "PRJ A/SITE 1/00_Upload/"},
+		{name: "unicode kept", projectCode: "Projekt-Ünï", siteCode: "站点-1", wantUpload: "Projekt-Ünï/站点-1/00_Upload/"},
+		{name: "slash rejected", projectCode: "PRJ/A", siteCode: "SITE", wantErr: `project 7 code "PRJ/A": unusable key code: contains a path separator`},
+		{name: "backslash rejected", projectCode: "PRJ", siteCode: `SITE\1`, wantErr: `site 70 code "SITE\\1": unusable key code: contains a path separator`},
+		{name: "slash encoded", separators: KeyCodeSeparatorsEncode, projectCode: "PRJ/A", siteCode: ` SITE\1 `, wantUpload: "PRJ%2FA/SITE%5C1/00_Upload/"},
+		{name: "blank rejected", projectCode: "PRJ", siteCode: "   ", wantErr: "unusable key code: empty"},
+		{name: "relative element rejected", separators: KeyCodeSeparatorsEncode, projectCode: "..", siteCode: "SITE", wantErr: "unusable key code: relative path element"},
+		{name: "control character rejected", projectCode: "PRJ\x00", siteCode: "SITE", wantErr: "unusable key code: contains a control character"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templates, err := NewKeyTemplates(&config.Config{KeyCodeSeparators: tt.separators})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			project := entity.Project{Id: 7, Code: tt.projectCode}
+			site := entity.Site{Id: 70, Code: tt.siteCode}
+
+			got, err := templates.UploadPrefix(project, site)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrUnusableKeyCode) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected ErrUnusableKeyCode containing %q, got %v", tt.wantErr, err)
+				}
+				if _, err := templates.ProcessedPrefix(project, site); !errors.Is(err, ErrUnusableKeyCode) {
+					t.Errorf("Expected the processed prefix to fail too, got %v", err)
+				}
+				return
+			}
+			if err != nil || got != tt.wantUpload {
+				t.Errorf("UploadPrefix() = %q, %v; want %q", got, err, tt.wantUpload)
+			}
+		})
+	}
+}
+
+func TestNewKeyTemplates_InvalidSeparators(t *testing.T) {
+	if _, err := NewKeyTemplates(&config.Config{KeyCodeSeparators: "strip"}); err == nil {
+		t.Error("Expected error for an unknown separators mode")
+	}
+}
+
+func TestFileService_BuildS3ObjectsFromFile_UnusableCode(t *testing.T) {
+	fs := newFileTreeService(0).(*FileServiceImpl)
+	project := entity.Project{Id: 7, Code: "PRJ/A"}
+	site := entity.Site{Id: 70, Code: "SITE"}
+	contractor := entity.Contractor{AwsBucketName: "bucket"}
+
+	if _, err := fs.buildS3ObjectsFromFile(project, site, entity.DocumentGroup{}, entity.File{Name: "a.tif"}, contractor); !errors.Is(err, ErrUnusableKeyCode) {
+		t.Errorf("Expected ErrUnusableKeyCode for uploaded files, got %v", err)
+	}
+	if _, err := fs.buildProcessedS3Objects(project, site, entity.DocumentGroup{ProcessedName: "a"}, contractor); !errors.Is(err, ErrUnusableKeyCode) {
+		t.Errorf("Expected ErrUnusableKeyCode for processed files, got %v", err)
+	}
+
+	site.Code = " SITE "
+	project.Code = "PRJ"
+	objects, err := fs.buildS3ObjectsFromFile(project, site, entity.DocumentGroup{}, entity.File{Name: "a.tif"}, contractor)
+	if err != nil || len(objects) != 1 || objects[0].Key != "PRJ/SITE/00_Upload/a.tif" {
+		t.Errorf("Expected the trimmed key PRJ/SITE/00_Upload/a.tif, got %+v, %v", objects, err)
+	}
+}
@@ -0,0 +1,43 @@
+package service
+
+import "sync"
+
+// keyedMutex serializes work per key while letting different keys proceed in parallel.
+// Locks are reference counted and dropped once unused, so the map only holds keys in flight.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[int64]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: make(map[int64]*keyedLock)}
+}
+
+// Lock blocks until the lock for key is held and returns the function that releases it
+func (km *keyedMutex) Lock(key int64) (unlock func()) {
+	km.mu.Lock()
+	lock, ok := km.locks[key]
+	if !ok {
+		lock = &keyedLock{}
+		km.locks[key] = lock
+	}
+	lock.refs++
+	km.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		km.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(km.locks, key)
+		}
+		km.mu.Unlock()
+	}
+}
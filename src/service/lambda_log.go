@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	log "github.com/sirupsen/logrus"
+)
+
+// parseS3URI splits an s3://bucket/key URI into its bucket and key; ok is false for anything else
+func parseS3URI(raw string) (bucket, key string, ok bool) {
+	rest, found := strings.CutPrefix(strings.TrimSpace(raw), "s3://")
+	if !found {
+		return "", "", false
+	}
+	bucket, key, _ = strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", false
+	}
+	return bucket, key, true
+}
+
+// lambdaLogLocation returns the bucket and key the contractor's LambdaLog points at, or why it is not deleted.
+// An empty LambdaLog, one that is not an S3 URI, or one naming a whole bucket would only be a guess. A log
+// bucket is typically shared by every contractor, so the key must also be scoped to the contractor by a folder
+// named after its ID, e.g. s3://logs/lambda/42/ or s3://logs/lambda/42/run.log.
+func lambdaLogLocation(contractor *entity.Contractor) (location BucketPrefix, skipReason string) {
+	if strings.TrimSpace(contractor.LambdaLog) == "" {
+		return BucketPrefix{}, "no lambda log"
+	}
+	bucket, key, ok := parseS3URI(contractor.LambdaLog)
+	if !ok {
+		return BucketPrefix{}, "lambda log is not an S3 location"
+	}
+	if key == "" {
+		return BucketPrefix{}, "lambda log names a whole bucket"
+	}
+	bucket, err := NormalizeAndValidateBucketName(bucket)
+	if err != nil {
+		return BucketPrefix{}, fmt.Sprintf("lambda log names an invalid bucket: %v", err)
+	}
+	if !inContractorFolder(key, contractor.Id) {
+		return BucketPrefix{}, "lambda log is not in a folder named after the contractor"
+	}
+	return BucketPrefix{Bucket: bucket, Prefix: key}, ""
+}
+
+// inContractorFolder reports whether one of the folders of key, excluding its last segment unless key ends in
+// "/", is named after the contractor's ID
+func inContractorFolder(key string, contractorID int64) bool {
+	folders := strings.Split(key, "/")
+	folders = folders[:len(folders)-1]
+	id := strconv.FormatInt(contractorID, 10)
+	for _, folder := range folders {
+		if folder == id {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteLambdaLogs deletes the objects the contractor's LambdaLog points at, returning how many were deleted.
+// A key ending in "/" is a prefix whose objects are all deleted, any other key a single object. Only a location
+// lambdaLogLocation accepts is deleted, and like the contractor's files the logs go through removeObjects, so
+// they are listed in the deletion manifest, counted against the object limit and confined to allowedPrefixes.
+func (cs *CleansingServiceImpl) deleteLambdaLogs(ctx context.Context, message dto.CleansingMessage, contractor *entity.Contractor) (int, error) {
+	logger := workerLog.GetLoggerFromContext(ctx).WithFields(log.Fields{
+		"contractor_id": contractor.Id,
+		"lambda_log":    contractor.LambdaLog,
+	})
+	location, skipReason := lambdaLogLocation(contractor)
+	if skipReason != "" {
+		if strings.TrimSpace(contractor.LambdaLog) != "" {
+			logger.WithField("reason", skipReason).Warn("Skipping contractor lambda logs")
+		}
+		return 0, nil
+	}
+	bucket, key := location.Bucket, location.Prefix
+
+	listed, err := cs.s3Service.ListObjectsWithPrefix(ctx, bucket, key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list lambda logs under s3://%s/%s: %w", bucket, key, err)
+	}
+	var objects []dto.S3Object
+	for _, obj := range listed {
+		// A single object's key would also match its longer siblings as a prefix
+		if !strings.HasSuffix(key, "/") && obj.Key != key {
+			continue
+		}
+		if obj.Bucket == "" {
+			obj.Bucket = bucket
+		}
+		if obj.Region == "" && bucket == contractor.AwsBucketName {
+			obj.Region = contractor.AwsBucketRegion
+		}
+		objects = append(objects, obj)
+	}
+	if len(objects) == 0 {
+		return 0, nil
+	}
+
+	deleted, err := cs.removeObjects(ctx, message, objects)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to delete lambda logs under s3://%s/%s: %w", bucket, key, err)
+	}
+	logger.WithField("files_deleted", deleted).Info("Deleted contractor lambda logs")
+	return deleted, nil
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+)
+
+func TestParseS3URI(t *testing.T) {
+	tests := []struct {
+		raw        string
+		wantBucket string
+		wantKey    string
+		wantOK     bool
+	}{
+		{raw: "s3://logs-bucket/lambda/contractor-1/", wantBucket: "logs-bucket", wantKey: "lambda/contractor-1/", wantOK: true},
+		{raw: " s3://logs-bucket/lambda.log ", wantBucket: "logs-bucket", wantKey: "lambda.log", wantOK: true},
+		{raw: "s3://logs-bucket", wantBucket: "logs-bucket", wantKey: "", wantOK: true},
+		{raw: "s3:///lambda.log", wantOK: false},
+		{raw: "", wantOK: false},
+		{raw: "https://logs.example.com/contractor-1", wantOK: false},
+		{raw: "/aws/lambda/contractor-1", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			bucket, key, ok := parseS3URI(tt.raw)
+			if bucket != tt.wantBucket || key != tt.wantKey || ok != tt.wantOK {
+				t.Errorf("Expected (%q, %q, %v), got (%q, %q, %v)", tt.wantBucket, tt.wantKey, tt.wantOK, bucket, key, ok)
+			}
+		})
+	}
+}
+
+func TestCleansingService_DB_DeleteContractorFiles_LambdaLog(t *testing.T) {
+	bucketObjects := []dto.S3Object{
+		{Bucket: "logs-bucket", Key: "lambda/1/2024-01-01.log"},
+		{Bucket: "logs-bucket", Key: "lambda/1/2024-01-02.log"},
+		{Bucket: "logs-bucket", Key: "lambda/10/2024-01-01.log"}, // Another contractor's logs
+		{Bucket: "logs-bucket", Key: "lambda/1.log"},
+		{Bucket: "logs-bucket", Key: "lambda/1.log.bak"},
+		{Bucket: "logs-bucket", Key: "lambda/1/2024-01-01.log.bak"},
+	}
+
+	tests := []struct {
+		name        string
+		lambdaLog   string
+		wantDeleted []string
+	}{
+		{name: "empty", lambdaLog: ""},
+		{name: "not an S3 URI", lambdaLog: "/aws/lambda/contractor-1"},
+		{name: "whole bucket", lambdaLog: "s3://logs-bucket"},
+		{name: "S3 prefix", lambdaLog: "s3://logs-bucket/lambda/1/", wantDeleted: []string{"lambda/1/2024-01-01.log", "lambda/1/2024-01-01.log.bak", "lambda/1/2024-01-02.log"}},
+		{name: "S3 object", lambdaLog: "s3://logs-bucket/lambda/1/2024-01-01.log", wantDeleted: []string{"lambda/1/2024-01-01.log"}},
+		// Locations not scoped to the contractor could hold every contractor's logs
+		{name: "shared prefix", lambdaLog: "s3://logs-bucket/lambda/"},
+		{name: "object outside a contractor folder", lambdaLog: "s3://logs-bucket/lambda/1.log"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewMigratedDB(t)
+			testutil.SeedTree(t, db)
+			if err := db.Model(&entity.Contractor{}).Where("id = ?", testutil.ContractorID).UpdateColumn("lambda_log", tt.lambdaLog).Error; err != nil {
+				t.Fatalf("failed to set lambda_log: %v", err)
+			}
+			if err := db.Create(&entity.UserContractor{Id: 1, ContractorId: testutil.ContractorID, UserId: 5}).Error; err != nil {
+				t.Fatalf("failed to seed user_contractor: %v", err)
+			}
+			if err := db.Create(&entity.ViewerContractor{Id: 1, ContractorId: testutil.ContractorID, ViewerId: 7}).Error; err != nil {
+				t.Fatalf("failed to seed viewer_contractor: %v", err)
+			}
+
+			s3Service := &prefixS3Service{bucketObjects: bucketObjects}
+			service := newDBCleansingServiceWithS3(db, &config.Config{}, s3Service)
+
+			result, err := service.DeleteContractorFiles(context.Background(), testutil.ContractorID)
+			if err != nil || !result.Success {
+				t.Fatalf("DeleteContractorFiles() unexpected failure: %v %+v", err, result)
+			}
+
+			got := objectKeyList(s3Service.deleted)
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.wantDeleted, ",") {
+				t.Errorf("Expected lambda logs %v to be deleted, got %v", tt.wantDeleted, got)
+			}
+			if result.FilesDeleted != len(tt.wantDeleted) {
+				t.Errorf("Expected %d files deleted, got %d", len(tt.wantDeleted), result.FilesDeleted)
+			}
+
+			// The contractor's user and viewer associations go whatever its lambda log
+			if got := countRows(t, db, &entity.UserContractor{}, "contractor_id = ?", testutil.ContractorID); got != 0 {
+				t.Errorf("Expected user_contractor rows to be deleted, found %d", got)
+			}
+			if got := countRows(t, db, &entity.ViewerContractor{}, "contractor_id = ?", testutil.ContractorID); got != 0 {
+				t.Errorf("Expected viewer_contractor rows to be deleted, found %d", got)
+			}
+		})
+	}
+}
+
+func TestLambdaLogLocation(t *testing.T) {
+	tests := []struct {
+		lambdaLog string
+		want      BucketPrefix
+		wantSkip  bool
+	}{
+		{lambdaLog: "s3://logs-bucket/lambda/7/", want: BucketPrefix{Bucket: "logs-bucket", Prefix: "lambda/7/"}},
+		{lambdaLog: "s3://logs-bucket/7/run.log", want: BucketPrefix{Bucket: "logs-bucket", Prefix: "7/run.log"}},
+		{lambdaLog: "s3://logs-bucket/lambda/", wantSkip: true},
+		{lambdaLog: "s3://logs-bucket/lambda/7", wantSkip: true},
+		{lambdaLog: "s3://logs-bucket/lambda/17/", wantSkip: true},
+		{lambdaLog: "s3://logs-bucket", wantSkip: true},
+		{lambdaLog: "", wantSkip: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.lambdaLog, func(t *testing.T) {
+			got, skipReason := lambdaLogLocation(&entity.Contractor{Id: 7, LambdaLog: tt.lambdaLog})
+			if (skipReason != "") != tt.wantSkip {
+				t.Fatalf("Expected skip %v, got reason %q", tt.wantSkip, skipReason)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCleansingService_DB_AllowedPrefixes_LambdaLog(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	if err := db.Model(&entity.Contractor{}).Where("id = ?", testutil.ContractorID).UpdateColumn("lambda_log", "s3://logs-bucket/lambda/1/").Error; err != nil {
+		t.Fatalf("failed to set lambda_log: %v", err)
+	}
+	service := newDBCleansingService(db, &config.Config{}).(*CleansingServiceImpl)
+
+	lambdaLog := BucketPrefix{Bucket: "logs-bucket", Prefix: "lambda/1/"}
+	for _, message := range []dto.CleansingMessage{
+		{Type: dto.CleansingTypeContractor, ID: testutil.ContractorID},
+		{Type: dto.CleansingTypeProject, ID: testutil.ProjectID},
+	} {
+		prefixes, err := service.allowedPrefixes(context.Background(), message)
+		if err != nil {
+			t.Fatalf("allowedPrefixes(%s) unexpected error: %v", message.Type, err)
+		}
+		found := false
+		for _, prefix := range prefixes {
+			found = found || prefix == lambdaLog
+		}
+		if want := message.Type == dto.CleansingTypeContractor; found != want {
+			t.Errorf("Expected lambda log allowed for a %s = %v, got %v", message.Type, want, found)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// BucketCleanupDelete empties and deletes a contractor's dedicated bucket synchronously
+	BucketCleanupDelete = "delete"
+	// BucketCleanupLifecycle lets an expiration rule empty the bucket and deletes it from a later message
+	BucketCleanupLifecycle = "lifecycle"
+
+	// expirationRuleID identifies the lifecycle rule added by ExpireBucket
+	expirationRuleID = "wadugs-cleansing-expire"
+)
+
+// ErrLifecycleUnsafe is returned by ExpireBucket when protected prefixes are configured: a lifecycle rule
+// cannot exclude keys, so it would expire protected objects too
+var ErrLifecycleUnsafe = errors.New("bucket expiration would delete protected objects")
+
+// ParseBucketCleanupStrategy validates a bucket cleanup strategy, falling back to BucketCleanupDelete for an empty value
+func ParseBucketCleanupStrategy(strategy string) (string, error) {
+	switch strategy {
+	case "":
+		return BucketCleanupDelete, nil
+	case BucketCleanupDelete, BucketCleanupLifecycle:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("invalid bucket cleanup strategy %q: expected %s or %s", strategy, BucketCleanupDelete, BucketCleanupLifecycle)
+	}
+}
+
+// ExpireBucket replaces the bucket's lifecycle configuration with a rule expiring every object, noncurrent
+// version and incomplete upload after one day, and returns without waiting for S3 to apply it.
+// DeleteExpiredBucket removes the bucket once it is empty. Like DeleteBucket it refuses with
+// ErrBucketNotAllowed for a bucket outside the configured allow and deny lists and with ErrBucketNotOwned unless
+// the bucket is tagged as owned by the contractor.
+func (s3s *S3ServiceImpl) ExpireBucket(ctx context.Context, bucketName, region string, contractorID int64) error {
+	if err := s3s.buckets.check(bucketName); err != nil {
+		return err
+	}
+	if s3s.lifecycleUnsafe {
+		return fmt.Errorf("%w: bucket %s", ErrLifecycleUnsafe, bucketName)
+	}
+	client, err := s3s.getClientForRegion(ctx, region)
+	if err != nil {
+		return fmt.Errorf("failed to get S3 client for region %s: %w", region, err)
+	}
+	if err := s3s.verifyBucketOwner(ctx, client, bucketName, contractorID); err != nil {
+		return err
+	}
+
+	if err := s3s.rateLimiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter context cancelled: %w", err)
+	}
+	_, err = client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucketName),
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{
+			Rules: []types.LifecycleRule{
+				{
+					ID:                             aws.String(expirationRuleID),
+					Status:                         types.ExpirationStatusEnabled,
+					Filter:                         &types.LifecycleRuleFilter{Prefix: aws.String("")},
+					Expiration:                     &types.LifecycleExpiration{Days: aws.Int32(1)},
+					NoncurrentVersionExpiration:    &types.NoncurrentVersionExpiration{NoncurrentDays: aws.Int32(1)},
+					AbortIncompleteMultipartUpload: &types.AbortIncompleteMultipartUpload{DaysAfterInitiation: aws.Int32(1)},
+				},
+				{
+					// Expiring a versioned object leaves a delete marker, which would keep the bucket from being deleted
+					ID:         aws.String(expirationRuleID + "-markers"),
+					Status:     types.ExpirationStatusEnabled,
+					Filter:     &types.LifecycleRuleFilter{Prefix: aws.String("")},
+					Expiration: &types.LifecycleExpiration{ExpiredObjectDeleteMarker: aws.Bool(true)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set lifecycle configuration of bucket %s: %w", bucketName, err)
+	}
+
+	workerLog.GetLoggerFromContext(ctx).WithFields(log.Fields{
+		"bucket":        bucketName,
+		"contractor_id": contractorID,
+	}).Info("Applied expiration lifecycle rule to bucket")
+	return nil
+}
+
+// DeleteExpiredBucket deletes a bucket emptied by the rule of ExpireBucket. It reports false, without deleting
+// anything, while the bucket still holds objects, and true once the bucket is gone (including when it already was).
+// The bucket must still be tagged as owned by the contractor.
+func (s3s *S3ServiceImpl) DeleteExpiredBucket(ctx context.Context, bucketName, region string, contractorID int64) (bool, error) {
+	if err := s3s.buckets.check(bucketName); err != nil {
+		return false, err
+	}
+	exists, err := s3s.BucketExists(ctx, bucketName, region)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		return true, nil
+	}
+	client, err := s3s.getClientForRegion(ctx, region)
+	if err != nil {
+		return false, fmt.Errorf("failed to get S3 client for region %s: %w", region, err)
+	}
+	if err := s3s.verifyBucketOwner(ctx, client, bucketName, contractorID); err != nil {
+		return false, err
+	}
+
+	if err := s3s.rateLimiter.Wait(ctx); err != nil {
+		return false, fmt.Errorf("rate limiter context cancelled: %w", err)
+	}
+	page, err := callS3(ctx, s3s.breaker, func() (*s3.ListObjectsV2Output, error) {
+		return client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:  aws.String(bucketName),
+			MaxKeys: aws.Int32(1),
+		})
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to list objects of bucket %s: %w", bucketName, err)
+	}
+	if len(page.Contents) > 0 {
+		return false, nil
+	}
+
+	if err := s3s.rateLimiter.Wait(ctx); err != nil {
+		return false, fmt.Errorf("rate limiter context cancelled: %w", err)
+	}
+	_, err = client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(bucketName)})
+	if err != nil {
+		// Noncurrent versions and delete markers are not listed but still keep the bucket from being deleted
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "BucketNotEmpty" {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to delete bucket %s: %w", bucketName, err)
+	}
+
+	workerLog.GetLoggerFromContext(ctx).WithField("bucket", bucketName).Info("Deleted expired bucket")
+	return true, nil
+}
+
+func (ns *NullS3Service) ExpireBucket(ctx context.Context, bucketName, region string, contractorID int64) error {
+	return nil
+}
+
+func (ns *NullS3Service) DeleteExpiredBucket(ctx context.Context, bucketName, region string, contractorID int64) (bool, error) {
+	return true, nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestParseBucketCleanupStrategy(t *testing.T) {
+	tests := []struct {
+		strategy string
+		want     string
+		wantErr  bool
+	}{
+		{strategy: "", want: BucketCleanupDelete},
+		{strategy: "delete", want: BucketCleanupDelete},
+		{strategy: "lifecycle", want: BucketCleanupLifecycle},
+		{strategy: "Lifecycle", wantErr: true},
+		{strategy: "expire", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseBucketCleanupStrategy(tt.strategy)
+		if tt.wantErr != (err != nil) {
+			t.Errorf("ParseBucketCleanupStrategy(%q): expected error %v, got %v", tt.strategy, tt.wantErr, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseBucketCleanupStrategy(%q): expected %q, got %q", tt.strategy, tt.want, got)
+		}
+	}
+}
+
+func TestS3Service_ExpireBucket(t *testing.T) {
+	client := &mockS3Client{bucketTags: ownerTags("7")}
+	s3s := newTestS3Service(client)
+
+	if err := s3s.ExpireBucket(context.Background(), "test-bucket", "", 7); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(client.lifecycleInputs) != 1 {
+		t.Fatalf("Expected one lifecycle configuration request, got %d", len(client.lifecycleInputs))
+	}
+
+	input := client.lifecycleInputs[0]
+	if aws.ToString(input.Bucket) != "test-bucket" {
+		t.Errorf("Expected lifecycle configuration of test-bucket, got %s", aws.ToString(input.Bucket))
+	}
+	rules := input.LifecycleConfiguration.Rules
+	if len(rules) != 2 {
+		t.Fatalf("Expected an expiration and a delete marker rule, got %d rules", len(rules))
+	}
+
+	expire := rules[0]
+	if expire.Status != types.ExpirationStatusEnabled || expire.Filter == nil || aws.ToString(expire.Filter.Prefix) != "" {
+		t.Errorf("Expected an enabled rule matching every key, got %+v", expire)
+	}
+	if expire.Expiration == nil || aws.ToInt32(expire.Expiration.Days) != 1 {
+		t.Errorf("Expected objects to expire after 1 day, got %+v", expire.Expiration)
+	}
+	if expire.NoncurrentVersionExpiration == nil || aws.ToInt32(expire.NoncurrentVersionExpiration.NoncurrentDays) != 1 {
+		t.Errorf("Expected noncurrent versions to expire after 1 day, got %+v", expire.NoncurrentVersionExpiration)
+	}
+	if expire.AbortIncompleteMultipartUpload == nil || aws.ToInt32(expire.AbortIncompleteMultipartUpload.DaysAfterInitiation) != 1 {
+		t.Errorf("Expected incomplete uploads to be aborted after 1 day, got %+v", expire.AbortIncompleteMultipartUpload)
+	}
+	if markers := rules[1]; markers.Expiration == nil || !aws.ToBool(markers.Expiration.ExpiredObjectDeleteMarker) {
+		t.Errorf("Expected expired delete markers to be removed, got %+v", markers.Expiration)
+	}
+
+	// Nothing is deleted synchronously
+	if len(client.deletedKeys) != 0 || len(client.deletedBuckets) != 0 {
+		t.Errorf("Expected nothing deleted, got keys %v buckets %v", client.deletedKeys, client.deletedBuckets)
+	}
+}
+
+func TestS3Service_ExpireBucket_Refused(t *testing.T) {
+	tests := []struct {
+		name    string
+		s3s     func(client *mockS3Client) *S3ServiceImpl
+		tags    []types.Tag
+		wantErr error
+	}{
+		{
+			name:    "bucket of another contractor",
+			s3s:     func(client *mockS3Client) *S3ServiceImpl { return newTestS3Service(client) },
+			tags:    ownerTags("8"),
+			wantErr: ErrBucketNotOwned,
+		},
+		{
+			name:    "protected prefixes configured",
+			s3s:     func(client *mockS3Client) *S3ServiceImpl { return newProtectedTestS3Service(client, "P1/keep/") },
+			tags:    ownerTags("7"),
+			wantErr: ErrLifecycleUnsafe,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockS3Client{bucketTags: tt.tags}
+			err := tt.s3s(client).ExpireBucket(context.Background(), "test-bucket", "", 7)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if len(client.lifecycleInputs) != 0 {
+				t.Errorf("Expected no lifecycle configuration, got %d requests", len(client.lifecycleInputs))
+			}
+		})
+	}
+}
+
+func TestS3Service_DeleteExpiredBucket(t *testing.T) {
+	tests := []struct {
+		name              string
+		client            *mockS3Client
+		wantDeleted       bool
+		wantErr           bool
+		wantBucketDeleted bool
+	}{
+		{
+			name:              "empty bucket is deleted",
+			client:            &mockS3Client{bucketTags: ownerTags("7")},
+			wantDeleted:       true,
+			wantBucketDeleted: true,
+		},
+		{
+			name:   "objects not expired yet",
+			client: &mockS3Client{bucketTags: ownerTags("7"), listKeys: []string{"P1/S1/00_Upload/a.txt"}},
+		},
+		{
+			name:   "noncurrent versions left",
+			client: &mockS3Client{bucketTags: ownerTags("7"), deleteBucketErr: &smithy.GenericAPIError{Code: "BucketNotEmpty"}},
+		},
+		{
+			name:        "bucket already gone",
+			client:      &mockS3Client{headBucketErr: &types.NotFound{}},
+			wantDeleted: true,
+		},
+		{
+			name:    "bucket of another contractor",
+			client:  &mockS3Client{bucketTags: ownerTags("8")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deleted, err := newTestS3Service(tt.client).DeleteExpiredBucket(context.Background(), "test-bucket", "", 7)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if deleted != tt.wantDeleted {
+				t.Errorf("Expected deleted %v, got %v", tt.wantDeleted, deleted)
+			}
+			if bucketDeleted := len(tt.client.deletedBuckets) == 1; bucketDeleted != tt.wantBucketDeleted {
+				t.Errorf("Expected bucket deleted %v, got %v", tt.wantBucketDeleted, tt.client.deletedBuckets)
+			}
+			if len(tt.client.deletedKeys) != 0 {
+				t.Errorf("Expected no objects deleted, got %v", tt.client.deletedKeys)
+			}
+		})
+	}
+}
+
+func TestS3Service_ExpiredBucket_UsesRegionalClient(t *testing.T) {
+	defaultClient := &mockS3Client{}
+	regional := &mockS3Client{bucketTags: ownerTags("7")}
+	s3s := newTestS3Service(defaultClient)
+	s3s.regionClients["eu-west-1"] = regional
+
+	if err := s3s.ExpireBucket(context.Background(), "contractor-bucket", "eu-west-1", 7); err != nil {
+		t.Fatalf("Unexpected error expiring the bucket: %v", err)
+	}
+	deleted, err := s3s.DeleteExpiredBucket(context.Background(), "contractor-bucket", "eu-west-1", 7)
+	if err != nil || !deleted {
+		t.Fatalf("Expected the expired bucket to be deleted, got %v, %v", deleted, err)
+	}
+	if len(regional.lifecycleInputs) != 1 || len(regional.deletedBuckets) != 1 {
+		t.Errorf("Expected the regional client to expire and delete the bucket, got %d lifecycle requests and buckets %v", len(regional.lifecycleInputs), regional.deletedBuckets)
+	}
+	if len(defaultClient.lifecycleInputs) != 0 || len(defaultClient.deletedBuckets) != 0 {
+		t.Errorf("Expected the default client to be unused, got %d lifecycle requests and buckets %v", len(defaultClient.lifecycleInputs), defaultClient.deletedBuckets)
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
+)
+
+// BucketPrefix names a key prefix within a bucket
+type BucketPrefix struct {
+	Bucket string
+	Prefix string
+}
+
+// ListObjectsWithPrefixes lists several prefixes concurrently, at most listConcurrency at a time, and merges the
+// objects found. Prefixes may overlap, so each bucket and key is returned once; the result is sorted by bucket
+// and key. Every page request waits on the shared rate limiter, and the first failing prefix cancels the others.
+func (s3s *S3ServiceImpl) ListObjectsWithPrefixes(ctx context.Context, prefixes []BucketPrefix) (objects []dto.S3Object, err error) {
+	ctx, span := tracing.Start(ctx, "s3.list_objects_with_prefixes", attribute.Int("prefix_count", len(prefixes)))
+	defer func() { tracing.End(span, err) }()
+
+	type bucketKey struct {
+		bucket string
+		key    string
+	}
+
+	var mu sync.Mutex
+	merged := make(map[bucketKey]dto.S3Object)
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(s3s.listConcurrency, 1))
+	for _, bucketPrefix := range prefixes {
+		g.Go(func() error {
+			listed, err := s3s.listPrefix(gctx, bucketPrefix.Bucket, bucketPrefix.Prefix)
+			if err != nil {
+				return fmt.Errorf("failed to list s3://%s/%s: %w", bucketPrefix.Bucket, bucketPrefix.Prefix, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, obj := range listed {
+				merged[bucketKey{bucket: obj.Bucket, key: obj.Key}] = obj
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	objects = make([]dto.S3Object, 0, len(merged))
+	for _, obj := range merged {
+		objects = append(objects, obj)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].Bucket != objects[j].Bucket {
+			return objects[i].Bucket < objects[j].Bucket
+		}
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, nil
+}
+
+// listPrefix lists every object under a prefix, waiting on the rate limiter before each page. Under a context
+// carrying a contractor the listing uses the contractor's credentials.
+func (s3s *S3ServiceImpl) listPrefix(ctx context.Context, bucket, prefix string) ([]dto.S3Object, error) {
+	client, err := s3s.getClientForRegion(ctx, bucketRegion(ctx, bucket))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get S3 client for bucket %s: %w", bucket, err)
+	}
+
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	var objects []dto.S3Object
+	for paginator.HasMorePages() {
+		if err := s3s.rateLimiter.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("rate limiter context cancelled: %w", err)
+		}
+
+		page, err := callS3(ctx, s3s.breaker, func() (*s3.ListObjectsV2Output, error) {
+			return paginator.NextPage(ctx)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			objects = append(objects, dto.S3Object{
+				Bucket:       bucket,
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
+
+// filterLastModified keeps the objects S3 last modified within the creation window of options, listing each
+// directory the objects' keys fall under once. Processed outputs have no file record, so this is the only creation
+// time they have; raw uploads were already selected by their records' created_at, which S3 agrees with. An object
+// S3 does not hold is dropped, as there is nothing of it left to delete.
+func (s3s *S3ServiceImpl) filterLastModified(ctx context.Context, objects []dto.S3Object, options fileOptions) ([]dto.S3Object, error) {
+	if !options.hasCreatedWindow() || len(objects) == 0 {
+		return objects, nil
+	}
+
+	seen := make(map[BucketPrefix]bool)
+	var prefixes []BucketPrefix
+	for _, obj := range objects {
+		prefix := BucketPrefix{Bucket: obj.Bucket, Prefix: obj.Key[:strings.LastIndex(obj.Key, "/")+1]}
+		if !seen[prefix] {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	listed, err := s3s.ListObjectsWithPrefixes(ctx, prefixes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list last modified times: %w", err)
+	}
+	lastModified := make(map[BucketPrefix]time.Time, len(listed))
+	for _, obj := range listed {
+		lastModified[BucketPrefix{Bucket: obj.Bucket, Prefix: obj.Key}] = obj.LastModified
+	}
+
+	filtered := make([]dto.S3Object, 0, len(objects))
+	for _, obj := range objects {
+		modified, ok := lastModified[BucketPrefix{Bucket: obj.Bucket, Prefix: obj.Key}]
+		if ok && options.createdWithin(modified.Unix()) {
+			obj.LastModified = modified
+			filtered = append(filtered, obj)
+		}
+	}
+	return filtered, nil
+}
+
+func (ns *NullS3Service) ListObjectsWithPrefixes(ctx context.Context, prefixes []BucketPrefix) ([]dto.S3Object, error) {
+	return []dto.S3Object{}, nil
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+)
+
+// prefixListClient lists fixed keys per bucket from concurrent callers, recording the most listings in flight at once
+type prefixListClient struct {
+	mockS3Client
+	bucketKeys  map[string][]string
+	failPrefix  string // ListObjectsV2 fails for this prefix
+	inFlight    atomic.Int64
+	maxInFlight atomic.Int64
+}
+
+func (m *prefixListClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	current := m.inFlight.Add(1)
+	defer m.inFlight.Add(-1)
+	for {
+		peak := m.maxInFlight.Load()
+		if current <= peak || m.maxInFlight.CompareAndSwap(peak, current) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	prefix := aws.ToString(params.Prefix)
+	if m.failPrefix != "" && prefix == m.failPrefix {
+		return nil, errors.New("access denied")
+	}
+
+	var contents []types.Object
+	for _, key := range m.bucketKeys[aws.ToString(params.Bucket)] {
+		if strings.HasPrefix(key, prefix) {
+			contents = append(contents, types.Object{Key: aws.String(key), Size: aws.Int64(int64(len(key)))})
+		}
+	}
+	return &s3.ListObjectsV2Output{Contents: contents}, nil
+}
+
+func TestS3Service_ListObjectsWithPrefixes(t *testing.T) {
+	client := &prefixListClient{
+		bucketKeys: map[string][]string{
+			"bucket-a": {"P1/S1/00_Upload/a.xtf", "P1/S1/00_Upload/b.xtf", "P1/S1/01_Processed/a.tif", "P1/S2/00_Upload/c.xtf"},
+			"bucket-b": {"P1/S1/00_Upload/a.xtf", "P2/S1/00_Upload/d.xtf"},
+		},
+	}
+	s3s := NewS3Service(client, aws.Config{}, &config.Config{S3ListConcurrency: 2}, nil)
+
+	prefixes := []BucketPrefix{
+		{Bucket: "bucket-a", Prefix: "P1/S1/00_Upload/"},
+		{Bucket: "bucket-a", Prefix: "P1/S1/"}, // overlaps the upload prefix above
+		{Bucket: "bucket-a", Prefix: "P1/S2/00_Upload/"},
+		{Bucket: "bucket-a", Prefix: "P9/"}, // empty
+		{Bucket: "bucket-b", Prefix: "P1/S1/00_Upload/"},
+		{Bucket: "bucket-b", Prefix: "P2/"},
+	}
+
+	objects, err := s3s.ListObjectsWithPrefixes(context.Background(), prefixes)
+	if err != nil {
+		t.Fatalf("ListObjectsWithPrefixes() unexpected error: %v", err)
+	}
+
+	want := []string{
+		"bucket-a/P1/S1/00_Upload/a.xtf",
+		"bucket-a/P1/S1/00_Upload/b.xtf",
+		"bucket-a/P1/S1/01_Processed/a.tif",
+		"bucket-a/P1/S2/00_Upload/c.xtf",
+		"bucket-b/P1/S1/00_Upload/a.xtf",
+		"bucket-b/P2/S1/00_Upload/d.xtf",
+	}
+	if len(objects) != len(want) {
+		t.Fatalf("Expected %d objects, got %d: %+v", len(want), len(objects), objects)
+	}
+	for i, obj := range objects {
+		if got := obj.Bucket + "/" + obj.Key; got != want[i] {
+			t.Errorf("Expected %s, got %s", want[i], got)
+		}
+		if obj.Size != int64(len(obj.Key)) {
+			t.Errorf("Expected size %d for %s, got %d", len(obj.Key), obj.Key, obj.Size)
+		}
+	}
+
+	if peak := client.maxInFlight.Load(); peak > 2 {
+		t.Errorf("Expected at most 2 listings in flight, got %d", peak)
+	}
+}
+
+func TestS3Service_ListObjectsWithPrefixes_Error(t *testing.T) {
+	client := &prefixListClient{
+		bucketKeys: map[string][]string{"bucket-a": {"P1/a.txt", "P2/b.txt"}},
+		failPrefix: "P2/",
+	}
+	s3s := NewS3Service(client, aws.Config{}, &config.Config{S3ListConcurrency: 4}, nil)
+
+	_, err := s3s.ListObjectsWithPrefixes(context.Background(), []BucketPrefix{
+		{Bucket: "bucket-a", Prefix: "P1/"},
+		{Bucket: "bucket-a", Prefix: "P2/"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "s3://bucket-a/P2/") {
+		t.Errorf("Expected error naming the failing prefix, got %v", err)
+	}
+}
+
+// datedListClient lists fixed keys of one bucket with their last modified times, counting its listings
+type datedListClient struct {
+	mockS3Client
+	modified map[string]time.Time
+	listings atomic.Int64
+}
+
+func (m *datedListClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	m.listings.Add(1)
+	var contents []types.Object
+	for key, modified := range m.modified {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+			contents = append(contents, types.Object{Key: aws.String(key), LastModified: aws.Time(modified)})
+		}
+	}
+	return &s3.ListObjectsV2Output{Contents: contents}, nil
+}
+
+// fixedFileService returns fixed site objects, applying none of the traversal options
+type fixedFileService struct {
+	FileService
+	objects []dto.S3Object
+}
+
+func (m *fixedFileService) GetSiteFiles(ctx context.Context, siteID int64, opts ...FileOption) ([]dto.S3Object, error) {
+	return m.objects, nil
+}
+
+func TestS3Service_ListSiteFiles_CreatedWindow(t *testing.T) {
+	cutoff := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	client := &datedListClient{
+		modified: map[string]time.Time{
+			"P1/S1/00_Upload/old.xtf":        cutoff.Add(-time.Hour),
+			"P1/S1/00_Upload/new.xtf":        cutoff.Add(time.Hour),
+			"P1/S1/01_Processed/old.geojson": cutoff.Add(-time.Minute),
+			"P1/S1/01_Processed/new.geojson": cutoff.Add(time.Minute),
+		},
+	}
+	fileService := &fixedFileService{
+		objects: []dto.S3Object{
+			{Bucket: "bucket", Key: "P1/S1/00_Upload/old.xtf"},
+			{Bucket: "bucket", Key: "P1/S1/00_Upload/new.xtf"},
+			{Bucket: "bucket", Key: "P1/S1/01_Processed/old.geojson"},
+			{Bucket: "bucket", Key: "P1/S1/01_Processed/new.geojson"},
+			{Bucket: "bucket", Key: "P1/S1/01_Processed/gone.geojson"}, // no longer in S3
+		},
+	}
+	s3s := NewS3Service(client, aws.Config{}, &config.Config{}, fileService)
+
+	tests := []struct {
+		name         string
+		opts         []FileOption
+		wantKeys     []string
+		wantListings int64
+	}{
+		{
+			name:     "no bounds",
+			wantKeys: []string{"P1/S1/00_Upload/old.xtf", "P1/S1/00_Upload/new.xtf", "P1/S1/01_Processed/old.geojson", "P1/S1/01_Processed/new.geojson", "P1/S1/01_Processed/gone.geojson"},
+		},
+		{
+			name:         "created after the cutoff",
+			opts:         []FileOption{WithCreatedWindow(cutoff.Unix(), 0)},
+			wantKeys:     []string{"P1/S1/00_Upload/new.xtf", "P1/S1/01_Processed/new.geojson"},
+			wantListings: 2,
+		},
+		{
+			name:         "created before the cutoff",
+			opts:         []FileOption{WithCreatedWindow(0, cutoff.Unix())},
+			wantKeys:     []string{"P1/S1/00_Upload/old.xtf", "P1/S1/01_Processed/old.geojson"},
+			wantListings: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client.listings.Store(0)
+			objects, err := s3s.ListSiteFiles(context.Background(), 100, tt.opts...)
+			if err != nil {
+				t.Fatalf("ListSiteFiles() unexpected error: %v", err)
+			}
+			var keys []string
+			for _, object := range objects {
+				keys = append(keys, object.Key)
+			}
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("Expected keys %v, got %v", tt.wantKeys, keys)
+			}
+			// Each directory the keys fall under is listed once
+			if got := client.listings.Load(); got != tt.wantListings {
+				t.Errorf("Expected %d listings, got %d", tt.wantListings, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ManifestFormatJSON writes a deletion manifest as the JSON encoding of its DeletionContext
+	ManifestFormatJSON = "json"
+	// ManifestFormatCSV writes a deletion manifest as one bucket,key,size,region row per object
+	ManifestFormatCSV = "csv"
+)
+
+// manifestCSVHeader is the first row of a CSV deletion manifest
+var manifestCSVHeader = []string{"bucket", "key", "size", "region"}
+
+// manifestConfig says where the deletion manifest of every operation is uploaded before its objects are deleted
+type manifestConfig struct {
+	bucket string // Audit bucket; empty disables manifests
+	prefix string
+	format string // ManifestFormatJSON or ManifestFormatCSV
+}
+
+// ParseManifestFormat validates a deletion manifest format, falling back to ManifestFormatJSON for an empty value
+func ParseManifestFormat(format string) (string, error) {
+	switch format {
+	case "":
+		return ManifestFormatJSON, nil
+	case ManifestFormatJSON, ManifestFormatCSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid manifest format %q: expected %s or %s", format, ManifestFormatJSON, ManifestFormatCSV)
+	}
+}
+
+// WriteManifestJSON writes deletionContext to w as JSON
+func WriteManifestJSON(w io.Writer, deletionContext dto.DeletionContext) error {
+	return json.NewEncoder(w).Encode(deletionContext)
+}
+
+// WriteManifestCSV writes the objects of deletionContext to w as CSV, after a bucket,key,size,region header.
+// Keys containing commas, quotes or line breaks are quoted as RFC 4180 requires.
+func WriteManifestCSV(w io.Writer, deletionContext dto.DeletionContext) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(manifestCSVHeader); err != nil {
+		return err
+	}
+	for _, obj := range deletionContext.S3Objects {
+		if err := writer.Write([]string{obj.Bucket, obj.Key, strconv.FormatInt(obj.Size, 10), obj.Region}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// encodeManifest encodes deletionContext in format, returning the body and its content type
+func encodeManifest(deletionContext dto.DeletionContext, format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if format == ManifestFormatCSV {
+		if err := WriteManifestCSV(&buf, deletionContext); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "text/csv", nil
+	}
+	if err := WriteManifestJSON(&buf, deletionContext); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "application/json", nil
+}
+
+// manifestKey names the manifest of one operation: <prefix><type>/<id>/<UTC time>[-<correlation ID>].<format>.
+// The time has millisecond precision, as one message may upload several manifests, e.g. for a contractor's files
+// and then its lambda logs.
+func manifestKey(prefix string, deletionContext dto.DeletionContext, correlationID string, now time.Time, format string) string {
+	name := now.UTC().Format("20060102T150405.000Z")
+	if correlationID != "" {
+		name += "-" + correlationID
+	}
+	return fmt.Sprintf("%s%s/%d/%s.%s", prefix, deletionContext.Type, deletionContext.ID, name, format)
+}
+
+// uploadManifest uploads the manifest of the objects the message is about to delete to the audit bucket, when
+// one is configured. Deletion must not go ahead without its manifest, so callers stop on an error.
+func (cs *CleansingServiceImpl) uploadManifest(ctx context.Context, message dto.CleansingMessage, objects []dto.S3Object) error {
+	if cs.manifests.bucket == "" || len(objects) == 0 {
+		return nil
+	}
+
+	deletionContext := dto.DeletionContext{
+		Type:        message.Type,
+		ID:          message.ID,
+		S3Objects:   objects,
+		Description: message.GetDescription(),
+	}
+	body, contentType, err := encodeManifest(deletionContext, cs.manifests.format)
+	if err != nil {
+		return fmt.Errorf("failed to encode deletion manifest: %w", err)
+	}
+
+	key := manifestKey(cs.manifests.prefix, deletionContext, workerLog.CorrelationIDFromContext(ctx), time.Now(), cs.manifests.format)
+	if err := cs.s3Service.PutObject(ctx, cs.manifests.bucket, key, body, contentType); err != nil {
+		return fmt.Errorf("failed to upload deletion manifest: %w", err)
+	}
+
+	workerLog.GetLoggerFromContext(ctx).WithFields(log.Fields{
+		"bucket":       cs.manifests.bucket,
+		"key":          key,
+		"object_count": len(objects),
+	}).Info("Uploaded deletion manifest")
+	return nil
+}
+
+// PutObject uploads body as bucket/key with the default client. It writes to the worker's audit bucket, so it keeps
+// the worker's own credentials even for a contractor.
+func (s3s *S3ServiceImpl) PutObject(ctx context.Context, bucket, key string, body []byte, contentType string) error {
+	if err := s3s.rateLimiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter context cancelled: %w", err)
+	}
+	_, err := s3s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put s3://%s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+func (ns *NullS3Service) PutObject(ctx context.Context, bucket, key string, body []byte, contentType string) error {
+	return nil
+}
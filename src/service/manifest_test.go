@@ -0,0 +1,167 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+)
+
+func TestWriteManifestCSV(t *testing.T) {
+	deletionContext := dto.DeletionContext{
+		Type: dto.CleansingTypeSite,
+		ID:   3,
+		S3Objects: []dto.S3Object{
+			{Bucket: "b", Key: "P1/S1/00_Upload/a.txt", Size: 10, Region: "us-east-1"},
+			{Bucket: "b", Key: "P1/S1/00_Upload/report, final.pdf", Size: 20},
+			{Bucket: "b", Key: `P1/S1/00_Upload/"quoted".txt`, Size: 30},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteManifestCSV(&buf, deletionContext); err != nil {
+		t.Fatalf("WriteManifestCSV() unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if lines[0] != "bucket,key,size,region" {
+		t.Errorf("Expected header bucket,key,size,region, got %q", lines[0])
+	}
+	if want := `b,"P1/S1/00_Upload/report, final.pdf",20,`; lines[2] != want {
+		t.Errorf("Expected key with comma quoted as %q, got %q", want, lines[2])
+	}
+	if want := `b,"P1/S1/00_Upload/""quoted"".txt",30,`; lines[3] != want {
+		t.Errorf("Expected key with quotes escaped as %q, got %q", want, lines[3])
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read manifest back: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("Expected 4 records, got %d", len(records))
+	}
+	for i, obj := range deletionContext.S3Objects {
+		if records[i+1][1] != obj.Key {
+			t.Errorf("Expected key %q, got %q", obj.Key, records[i+1][1])
+		}
+	}
+	if want := []string{"b", "P1/S1/00_Upload/a.txt", "10", "us-east-1"}; !reflect.DeepEqual(records[1], want) {
+		t.Errorf("Expected record %v, got %v", want, records[1])
+	}
+}
+
+func TestWriteManifestJSON(t *testing.T) {
+	deletionContext := dto.DeletionContext{
+		Type:        dto.CleansingTypeProject,
+		ID:          10,
+		S3Objects:   []dto.S3Object{{Bucket: "b", Key: "P10/a,b.txt", Size: 5}},
+		Description: "project 10",
+	}
+
+	var buf bytes.Buffer
+	if err := WriteManifestJSON(&buf, deletionContext); err != nil {
+		t.Fatalf("WriteManifestJSON() unexpected error: %v", err)
+	}
+
+	var decoded dto.DeletionContext
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Failed to decode manifest: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, deletionContext) {
+		t.Errorf("Expected %+v, got %+v", deletionContext, decoded)
+	}
+}
+
+func TestParseManifestFormat(t *testing.T) {
+	tests := []struct {
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{"", ManifestFormatJSON, false},
+		{"json", ManifestFormatJSON, false},
+		{"csv", ManifestFormatCSV, false},
+		{"xml", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseManifestFormat(tt.format)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseManifestFormat(%q) error = %v, wantErr %v", tt.format, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseManifestFormat(%q): Expected %q, got %q", tt.format, tt.want, got)
+		}
+	}
+}
+
+func TestManifestKey(t *testing.T) {
+	deletionContext := dto.DeletionContext{Type: dto.CleansingTypeSite, ID: 3}
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	if got, want := manifestKey("m/", deletionContext, "abc", now, ManifestFormatCSV), "m/site/3/20240506T070809.000Z-abc.csv"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got, want := manifestKey("", deletionContext, "", now, ManifestFormatJSON), "site/3/20240506T070809.000Z.json"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestCleansingService_UploadsManifestBeforeDeleting(t *testing.T) {
+	s3Service := &mockS3Service{
+		siteObjects: []dto.S3Object{{Bucket: "b", Key: "P1/S1/00_Upload/a,b.txt", Size: 10}},
+	}
+	service := newTestCleansingService(s3Service).(*CleansingServiceImpl)
+	service.manifests = manifestConfig{bucket: "audit", prefix: "m/", format: ManifestFormatCSV}
+
+	if _, err := service.DeleteSiteFiles(context.Background(), 3); err != nil {
+		t.Fatalf("DeleteSiteFiles() unexpected error: %v", err)
+	}
+	if len(s3Service.putKeys) != 1 || !strings.HasPrefix(s3Service.putKeys[0], "audit/m/site/3/") || !strings.HasSuffix(s3Service.putKeys[0], ".csv") {
+		t.Fatalf("Expected one manifest under audit/m/site/3/, got %v", s3Service.putKeys)
+	}
+	if want := "bucket,key,size,region\nb,\"P1/S1/00_Upload/a,b.txt\",10,\n"; string(s3Service.putBodies[0]) != want {
+		t.Errorf("Expected manifest %q, got %q", want, s3Service.putBodies[0])
+	}
+	if len(s3Service.deleted) != 1 {
+		t.Errorf("Expected 1 object deleted, got %d", len(s3Service.deleted))
+	}
+}
+
+func TestCleansingService_ManifestUploadFailureStopsDeletion(t *testing.T) {
+	s3Service := &mockS3Service{
+		siteObjects: []dto.S3Object{{Bucket: "b", Key: "P1/S1/00_Upload/a.txt", Size: 10}},
+		putErr:      errors.New("access denied"),
+	}
+	service := newTestCleansingService(s3Service).(*CleansingServiceImpl)
+	service.manifests = manifestConfig{bucket: "audit", format: ManifestFormatJSON}
+
+	if _, err := service.DeleteSiteFiles(context.Background(), 3); err == nil {
+		t.Fatal("Expected an error when the manifest cannot be uploaded")
+	}
+	if len(s3Service.deleted) != 0 {
+		t.Errorf("Expected nothing deleted without a manifest, got %d objects", len(s3Service.deleted))
+	}
+}
+
+func TestCleansingService_NoManifestWithoutAuditBucket(t *testing.T) {
+	s3Service := &mockS3Service{
+		siteObjects: []dto.S3Object{{Bucket: "b", Key: "P1/S1/00_Upload/a.txt", Size: 10}},
+	}
+	service := newTestCleansingService(s3Service)
+
+	if _, err := service.DeleteSiteFiles(context.Background(), 3); err != nil {
+		t.Fatalf("DeleteSiteFiles() unexpected error: %v", err)
+	}
+	if len(s3Service.putKeys) != 0 {
+		t.Errorf("Expected no manifest uploaded, got %v", s3Service.putKeys)
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrNoBucket is returned when the contractor owning the entity being cleansed has no bucket name. Its files
+// cannot be addressed and retrying cannot help, so the contractor record needs fixing, or the worker can be
+// configured to delete only the database records of such entities.
+var ErrNoBucket = errors.New("contractor has no bucket")
+
+// checkContractorBucket returns an ErrNoBucket error when the contractor has an empty or blank bucket name.
+// A contractor that cannot be read is left for the cleanse itself to report.
+func (cs *CleansingServiceImpl) checkContractorBucket(ctx context.Context, contractorID int64) error {
+	contractor, err := retryRead(ctx, cs.readRetry, func() (*entity.Contractor, error) {
+		return cs.contractorRepo.GetByID(ctx, contractorID)
+	})
+	if err != nil {
+		return nil
+	}
+	if strings.TrimSpace(contractor.AwsBucketName) == "" {
+		return fmt.Errorf("%w: contractor %d", ErrNoBucket, contractorID)
+	}
+	return nil
+}
+
+// handleNoBucket answers a message whose contractor has no bucket. With emptyBucketRecords a full cleanse
+// deletes the database records only, as a skip_s3 message would; anything else fails with a NO_BUCKET result.
+func (cs *CleansingServiceImpl) handleNoBucket(ctx context.Context, message dto.CleansingMessage, err error) (*dto.CleansingResult, error) {
+	logger := workerLog.GetLoggerFromContext(ctx)
+
+	recordsOnly := message
+	recordsOnly.SkipS3 = true
+	if cs.emptyBucketRecords && recordsOnly.IsValidSkipS3() {
+		logger.WithError(err).WithFields(log.Fields{
+			"type": message.Type,
+			"id":   message.ID,
+		}).Warn("Contractor has no bucket, deleting database records only")
+		return cs.deleteRecordsOnly(ctx, recordsOnly)
+	}
+
+	logger.WithError(err).WithFields(log.Fields{
+		"type": message.Type,
+		"id":   message.ID,
+	}).Error("Refusing to cleanse without a contractor bucket")
+	return &dto.CleansingResult{
+		Type:      message.Type,
+		ID:        message.ID,
+		Success:   false,
+		Error:     err.Error(),
+		ErrorCode: dto.ErrorCodeNoBucket,
+	}, err
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+)
+
+func TestCleansingService_NoBucket(t *testing.T) {
+	tests := []struct {
+		name          string
+		message       dto.CleansingMessage
+		recordsOnly   bool
+		wantNoBucket  bool
+		wantS3Skipped bool
+	}{
+		{name: "site fails", message: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: 3}, wantNoBucket: true},
+		{name: "project fails", message: dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: 5}, wantNoBucket: true},
+		{name: "contractor fails", message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 1}, wantNoBucket: true},
+		{name: "site records only", message: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: 3}, recordsOnly: true, wantS3Skipped: true},
+		{name: "contractor records only", message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 1}, recordsOnly: true, wantS3Skipped: true},
+		{
+			// Only a full cleanse can fall back to the records; a partial one still needs the files
+			name:         "partial cleanse still fails",
+			message:      dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: 3, Scope: dto.ScopeRaw},
+			recordsOnly:  true,
+			wantNoBucket: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Service := &mockS3Service{siteObjects: []dto.S3Object{{Bucket: "", Key: "P1/S1/00_Upload/a.txt"}}}
+			service := newTestCleansingService(s3Service).(*CleansingServiceImpl)
+			service.contractorRepo.(*mockContractorRepository).bucketName = " "
+			service.emptyBucketRecords = tt.recordsOnly
+
+			result, err := service.ProcessCleansingMessage(context.Background(), tt.message)
+			if tt.wantNoBucket {
+				if !errors.Is(err, ErrNoBucket) {
+					t.Fatalf("Expected ErrNoBucket, got %v", err)
+				}
+				if result == nil || result.Success || result.ErrorCode != dto.ErrorCodeNoBucket {
+					t.Errorf("Expected a %s result, got %+v", dto.ErrorCodeNoBucket, result)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if !result.Success || result.S3Skipped != tt.wantS3Skipped || result.ErrorCode != "" {
+					t.Errorf("Expected a successful records-only result, got %+v", result)
+				}
+			}
+
+			// No S3 call is attempted without a bucket
+			if len(s3Service.deleted) != 0 {
+				t.Errorf("Expected nothing deleted, got %d objects", len(s3Service.deleted))
+			}
+		})
+	}
+}
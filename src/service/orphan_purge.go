@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// PurgeOption customizes a single PurgeOrphans call
+	PurgeOption func(*purgeOptions)
+
+	// purgeOptions holds the resolved purge options
+	purgeOptions struct {
+		execute bool
+	}
+)
+
+// WithPurgeExecute makes PurgeOrphans delete the orphans it finds instead of only reporting them
+func WithPurgeExecute() PurgeOption {
+	return func(o *purgeOptions) {
+		o.execute = true
+	}
+}
+
+// PurgeOrphans finds the objects under a site's upload and processed prefixes that no database row maps to, such as
+// those left by failed uploads, which the regular cleanse never deletes since it derives its keys from the database.
+// It is a dry run unless WithPurgeExecute is given; deletions still honour the protected and allowed prefixes, and
+// keep recent orphans and the outputs of groups still processing as ReconcileSite does.
+func (r *Reconciler) PurgeOrphans(ctx context.Context, siteID int64, opts ...PurgeOption) (*dto.OrphanPurge, error) {
+	var options purgeOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	reconciliation, err := r.ReconcileSite(ctx, siteID, options.execute)
+	if reconciliation == nil {
+		return nil, err
+	}
+	purge := &dto.OrphanPurge{
+		SiteID:         siteID,
+		Bucket:         reconciliation.Bucket,
+		DryRun:         !options.execute,
+		Orphans:        reconciliation.OrphanedInS3,
+		OrphansFound:   len(reconciliation.OrphanedInS3),
+		OrphansDeleted: reconciliation.OrphansDeleted,
+		OrphansKept:    reconciliation.OrphansKept,
+	}
+
+	workerLog.GetLoggerFromContext(ctx).WithFields(log.Fields{
+		"site_id":         siteID,
+		"dry_run":         purge.DryRun,
+		"orphans_found":   purge.OrphansFound,
+		"orphans_deleted": purge.OrphansDeleted,
+		"orphans_kept":    purge.OrphansKept,
+	}).Info("Purged orphaned site objects")
+	return purge, err
+}
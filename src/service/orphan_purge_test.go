@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+)
+
+func TestReconciler_PurgeOrphans(t *testing.T) {
+	// S3 holds two of site 100's expected keys plus two keys left behind by failed uploads
+	bucketObjects := []dto.S3Object{
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/00_Upload/depth.tif"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/00_Upload/failed-upload.xtf"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/01_Processed/depth.geojson"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/01_Processed/partial.tif"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S101/00_Upload/stray.jpg"}, // Another site's orphan
+	}
+	wantOrphans := []string{"PRJA/S100/00_Upload/failed-upload.xtf", "PRJA/S100/01_Processed/partial.tif"}
+
+	tests := []struct {
+		name        string
+		opts        []PurgeOption
+		wantDryRun  bool
+		wantDeleted int
+	}{
+		{name: "dry run by default", wantDryRun: true, wantDeleted: 0},
+		{name: "execute", opts: []PurgeOption{WithPurgeExecute()}, wantDryRun: false, wantDeleted: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewMigratedDB(t)
+			testutil.SeedTree(t, db)
+			s3Service := &prefixS3Service{bucketObjects: bucketObjects}
+
+			purge, err := NewReconciler(newDBFileService(db), s3Service).PurgeOrphans(context.Background(), testutil.SiteID, tt.opts...)
+			if err != nil {
+				t.Fatalf("PurgeOrphans() unexpected error: %v", err)
+			}
+
+			if purge.SiteID != testutil.SiteID || purge.Bucket != testutil.Bucket || purge.DryRun != tt.wantDryRun {
+				t.Errorf("Expected site %d in %s with dry run %v, got %+v", testutil.SiteID, testutil.Bucket, tt.wantDryRun, purge)
+			}
+			if got := objectKeyList(purge.Orphans); strings.Join(got, ",") != strings.Join(wantOrphans, ",") {
+				t.Errorf("Expected orphans %v, got %v", wantOrphans, got)
+			}
+			if purge.OrphansFound != 2 {
+				t.Errorf("Expected 2 orphans found, got %d", purge.OrphansFound)
+			}
+			if purge.OrphansDeleted != tt.wantDeleted {
+				t.Errorf("Expected %d orphans deleted, got %d", tt.wantDeleted, purge.OrphansDeleted)
+			}
+			if got := objectKeyList(s3Service.deleted); len(got) != tt.wantDeleted || (tt.wantDeleted > 0 && strings.Join(got, ",") != strings.Join(wantOrphans, ",")) {
+				t.Errorf("Expected %d orphans sent to S3 for deletion, got %v", tt.wantDeleted, got)
+			}
+		})
+	}
+}
+
+func TestReconciler_PurgeOrphans_Errors(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	s3Service := &prefixS3Service{}
+
+	if _, err := NewReconciler(newDBFileService(db), s3Service).PurgeOrphans(context.Background(), 999, WithPurgeExecute()); err == nil {
+		t.Error("Expected error for unknown site")
+	}
+	if len(s3Service.deleted) != 0 {
+		t.Errorf("Expected nothing deleted, got %v", objectKeyList(s3Service.deleted))
+	}
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// deleteCheckKey is the object, under the configured throwaway prefix, that CheckDeletePermission deletes.
+// It is never created, so the check removes nothing; in a versioned bucket it leaves a delete marker.
+const deleteCheckKey = "delete-permission-check"
+
+// CheckDeletePermission verifies that client may delete objects in bucket by deleting a key that does not exist
+// under prefix. S3 reports a missing key as deleted, so only a refusal, such as a missing s3:DeleteObject
+// permission, is returned as an error.
+func CheckDeletePermission(ctx context.Context, client S3API, bucket, prefix string) error {
+	key := prefix + deleteCheckKey
+	result, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &types.Delete{
+			Objects: []types.ObjectIdentifier{{Key: aws.String(key)}},
+			Quiet:   aws.Bool(true), // Only failures are reported
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete s3://%s/%s: %w", bucket, key, err)
+	}
+
+	if len(result.Errors) == 0 {
+		return nil
+	}
+	deleteError := result.Errors[0]
+	return &S3DeleteError{
+		Bucket: bucket,
+		Key:    aws.ToString(deleteError.Key),
+		Code:   aws.ToString(deleteError.Code),
+		Err:    errors.New(aws.ToString(deleteError.Message)),
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestCheckDeletePermission(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   *s3.DeleteObjectsOutput
+		err      error
+		wantCode string
+		wantErr  bool
+	}{
+		{
+			name:   "delete permitted",
+			output: &s3.DeleteObjectsOutput{},
+		},
+		{
+			name: "per-key access denied",
+			output: &s3.DeleteObjectsOutput{Errors: []types.Error{
+				{Key: aws.String(".wadugs-cleansing/delete-permission-check"), Code: aws.String("AccessDenied"), Message: aws.String("Access Denied")},
+			}},
+			wantCode: "AccessDenied",
+			wantErr:  true,
+		},
+		{
+			name:    "request denied",
+			err:     &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []*s3.DeleteObjectsInput
+			client := &mockS3Client{
+				deleteObjectsFn: func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+					requests = append(requests, params)
+					return tt.output, tt.err
+				},
+			}
+
+			err := CheckDeletePermission(context.Background(), client, "check-bucket", ".wadugs-cleansing/")
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantCode != "" {
+				var deleteErr *S3DeleteError
+				if !errors.As(err, &deleteErr) || deleteErr.Code != tt.wantCode {
+					t.Errorf("Expected an S3DeleteError with code %s, got %v", tt.wantCode, err)
+				}
+			}
+
+			// Exactly one never-created key under the throwaway prefix is deleted
+			if len(requests) != 1 {
+				t.Fatalf("Expected one DeleteObjects request, got %d", len(requests))
+			}
+			input := requests[0]
+			if aws.ToString(input.Bucket) != "check-bucket" || len(input.Delete.Objects) != 1 {
+				t.Fatalf("Expected one key deleted from check-bucket, got %s %+v", aws.ToString(input.Bucket), input.Delete.Objects)
+			}
+			if key := aws.ToString(input.Delete.Objects[0].Key); key != ".wadugs-cleansing/delete-permission-check" {
+				t.Errorf("Expected the check key under the prefix, got %s", key)
+			}
+		})
+	}
+}
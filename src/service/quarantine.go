@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"github.com/denys89/wadugs-worker-cleansing/src/tracing"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultQuarantineTag is the tag applied to quarantined objects when none is configured
+const DefaultQuarantineTag = "status=quarantined"
+
+// ParseQuarantineTag parses a "key=value" quarantine tag, falling back to DefaultQuarantineTag for an empty value
+func ParseQuarantineTag(tag string) (types.Tag, error) {
+	if strings.TrimSpace(tag) == "" {
+		tag = DefaultQuarantineTag
+	}
+
+	key, value, ok := strings.Cut(tag, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return types.Tag{}, fmt.Errorf("invalid quarantine tag %q: expected key=value", tag)
+	}
+	return types.Tag{Key: aws.String(key), Value: aws.String(strings.TrimSpace(value))}, nil
+}
+
+// QuarantineObjects makes objects inaccessible without destroying them by adding the quarantine tag, so a
+// bucket lifecycle rule can expire them once the retention window has passed. Existing tags are kept.
+// Protected objects and objects with unsafe keys are skipped, as with DeleteObjects, and objects in a bucket outside
+// the configured allow and deny lists refuse the whole call with ErrBucketNotAllowed before anything is tagged.
+func (s3s *S3ServiceImpl) QuarantineObjects(ctx context.Context, objects []dto.S3Object) (quarantined int, err error) {
+	ctx, span := tracing.Start(ctx, "s3.quarantine_objects", attribute.Int("object_count", len(objects)))
+	defer func() { tracing.End(span, err) }()
+
+	logger := workerLog.GetLoggerFromContext(ctx)
+	logger.WithFields(log.Fields{
+		"total_objects": len(objects),
+		"tag":           aws.ToString(s3s.quarantineTag.Key) + "=" + aws.ToString(s3s.quarantineTag.Value),
+	}).Info("Starting quarantine operation")
+	if err := s3s.buckets.checkObjects(objects); err != nil {
+		return 0, err
+	}
+
+	objects, protected := s3s.FilterProtected(objects)
+	if len(protected) > 0 {
+		logger.WithField("protected_objects", len(protected)).Warn("Skipping protected objects")
+	}
+	objects, unsafe := FilterUnsafeKeys(objects)
+	logUnsafeKeys(ctx, unsafe)
+	if allowed, ok := allowedPrefixesFromContext(ctx); ok {
+		var outside []dto.S3Object
+		objects, outside = FilterAllowedPrefixes(objects, allowed)
+		logOutsidePrefixes(ctx, outside)
+	}
+
+	// Objects are tagged one request at a time, so they share the delete concurrency and rate limits
+	var totalTagged atomic.Int64
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(s3s.deleteConcurrency())
+
+	for _, obj := range objects {
+		g.Go(func() error {
+			client, err := s3s.getClientForRegion(gctx, obj.Region)
+			if err != nil {
+				return fmt.Errorf("failed to get S3 client for region %s: %w", obj.Region, err)
+			}
+			if err := s3s.tagObject(gctx, client, obj); err != nil {
+				return fmt.Errorf("failed to quarantine %s in bucket %s: %w", obj.Key, obj.Bucket, err)
+			}
+			totalTagged.Add(1)
+			return nil
+		})
+	}
+
+	err = g.Wait()
+	logger.WithField("total_quarantined", totalTagged.Load()).Info("Completed quarantine operation")
+	return int(totalTagged.Load()), err
+}
+
+// tagObject adds the quarantine tag to an object's tag set, replacing any tag with the same key
+func (s3s *S3ServiceImpl) tagObject(ctx context.Context, client S3API, obj dto.S3Object) error {
+	if err := s3s.acquireDeleteSlot(ctx); err != nil {
+		return err
+	}
+	defer s3s.releaseDeleteSlot()
+
+	if err := s3s.rateLimiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter context cancelled: %w", err)
+	}
+	current, err := client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(obj.Bucket),
+		Key:    aws.String(obj.Key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read tags: %w", err)
+	}
+
+	tags := []types.Tag{s3s.quarantineTag}
+	for _, tag := range current.TagSet {
+		if aws.ToString(tag.Key) != aws.ToString(s3s.quarantineTag.Key) {
+			tags = append(tags, tag)
+		}
+	}
+
+	if err := s3s.rateLimiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter context cancelled: %w", err)
+	}
+	_, err = client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(obj.Bucket),
+		Key:     aws.String(obj.Key),
+		Tagging: &types.Tagging{TagSet: tags},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write tags: %w", err)
+	}
+	return nil
+}
+
+func (ns *NullS3Service) QuarantineObjects(ctx context.Context, objects []dto.S3Object) (int, error) {
+	return len(objects), nil
+}
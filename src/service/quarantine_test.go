@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+)
+
+func TestParseQuarantineTag(t *testing.T) {
+	tests := []struct {
+		tag       string
+		wantKey   string
+		wantValue string
+		wantErr   bool
+	}{
+		{tag: "", wantKey: "status", wantValue: "quarantined"},
+		{tag: "retention = legal-hold", wantKey: "retention", wantValue: "legal-hold"},
+		{tag: "quarantined=", wantKey: "quarantined", wantValue: ""},
+		{tag: "quarantined", wantErr: true},
+		{tag: "=quarantined", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tag, err := ParseQuarantineTag(tt.tag)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseQuarantineTag(%q): expected error", tt.tag)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseQuarantineTag(%q) unexpected error: %v", tt.tag, err)
+			continue
+		}
+		if aws.ToString(tag.Key) != tt.wantKey || aws.ToString(tag.Value) != tt.wantValue {
+			t.Errorf("ParseQuarantineTag(%q): expected %s=%s, got %s=%s", tt.tag, tt.wantKey, tt.wantValue, aws.ToString(tag.Key), aws.ToString(tag.Value))
+		}
+	}
+}
+
+func TestS3Service_QuarantineObjects(t *testing.T) {
+	client := &mockS3Client{objectTags: map[string][]types.Tag{
+		"P1/S1/a.txt": {{Key: aws.String("owner"), Value: aws.String("survey")}},
+		"P1/S1/b.txt": {{Key: aws.String("retention"), Value: aws.String("old")}},
+	}}
+	s3s := NewS3Service(client, aws.Config{}, &config.Config{QuarantineTag: "retention=quarantined", ProtectedPrefixes: []string{"P1/keep/"}}, nil).(*S3ServiceImpl)
+
+	tagged, err := s3s.QuarantineObjects(context.Background(), []dto.S3Object{
+		{Bucket: "test-bucket", Key: "P1/S1/a.txt"},
+		{Bucket: "test-bucket", Key: "P1/S1/b.txt"},
+		{Bucket: "test-bucket", Key: "P1/S1/c.txt"},
+		{Bucket: "test-bucket", Key: "P1/keep/d.txt"}, // protected
+		{Bucket: "test-bucket", Key: "P1/S1/"},        // unsafe
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tagged != 3 {
+		t.Errorf("Expected 3 quarantined objects, got %d", tagged)
+	}
+
+	want := map[string]map[string]string{
+		"P1/S1/a.txt": {"retention": "quarantined", "owner": "survey"}, // existing tags are kept
+		"P1/S1/b.txt": {"retention": "quarantined"},                    // same key is replaced
+		"P1/S1/c.txt": {"retention": "quarantined"},
+	}
+	if len(client.objectTags) != len(want) {
+		t.Errorf("Expected only %d objects tagged, got %v", len(want), client.objectTags)
+	}
+	for key, wantTags := range want {
+		got := make(map[string]string)
+		for _, tag := range client.objectTags[key] {
+			got[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+		if len(got) != len(wantTags) {
+			t.Errorf("Expected tags %v on %s, got %v", wantTags, key, got)
+			continue
+		}
+		for k, v := range wantTags {
+			if got[k] != v {
+				t.Errorf("Expected tags %v on %s, got %v", wantTags, key, got)
+				break
+			}
+		}
+	}
+}
+
+func TestS3Service_QuarantineObjects_AllowedPrefixes(t *testing.T) {
+	client := &mockS3Client{}
+	s3s := newTestS3Service(client)
+
+	ctx := withAllowedPrefixes(context.Background(), []BucketPrefix{{Bucket: "test-bucket", Prefix: "P1/S1/"}})
+	tagged, err := s3s.QuarantineObjects(ctx, []dto.S3Object{
+		{Bucket: "test-bucket", Key: "P1/S1/a.txt"},
+		{Bucket: "test-bucket", Key: "P2/S2/b.txt"},  // another site
+		{Bucket: "other-bucket", Key: "P1/S1/c.txt"}, // another bucket
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tagged != 1 || len(client.objectTags) != 1 || client.objectTags["P1/S1/a.txt"] == nil {
+		t.Errorf("Expected only P1/S1/a.txt quarantined, got %d tagged: %v", tagged, client.objectTags)
+	}
+}
+
+func TestS3Service_QuarantineObjects_Error(t *testing.T) {
+	client := &mockS3Client{putTagKeyErr: "P1/S1/b.txt"}
+	s3s := newTestS3Service(client)
+
+	tagged, err := s3s.QuarantineObjects(context.Background(), []dto.S3Object{
+		{Bucket: "test-bucket", Key: "P1/S1/a.txt"},
+		{Bucket: "test-bucket", Key: "P1/S1/b.txt"},
+	})
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+	if tagged != len(client.objectTags) {
+		t.Errorf("Expected the count to match the %d tagged objects, got %d", len(client.objectTags), tagged)
+	}
+	if _, ok := client.objectTags["P1/S1/b.txt"]; ok {
+		t.Error("Expected the failed object to stay untagged")
+	}
+}
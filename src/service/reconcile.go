@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	log "github.com/sirupsen/logrus"
+)
+
+// Reconciler compares the keys the database expects for a site with the objects S3 actually holds for it
+type Reconciler struct {
+	fileService  FileService
+	s3Service    S3Service
+	minOrphanAge time.Duration // Orphans modified more recently are never deleted; 0 disables the guard
+}
+
+// NewReconciler creates a new reconciler instance with optional behaviour disabled
+func NewReconciler(fileService FileService, s3Service S3Service) *Reconciler {
+	return NewReconcilerWithConfig(&config.Config{}, fileService, s3Service)
+}
+
+// NewReconcilerWithConfig creates a new reconciler instance configured from cfg
+func NewReconcilerWithConfig(cfg *config.Config, fileService FileService, s3Service S3Service) *Reconciler {
+	return &Reconciler{
+		fileService:  fileService,
+		s3Service:    s3Service,
+		minOrphanAge: cfg.OrphanMinAge,
+	}
+}
+
+// ReconcileSite lists the objects under a site's upload and processed prefixes and diffs them against the keys
+// built from its database rows. With deleteOrphans the objects only S3 knows about are deleted, except those
+// modified within the minimum orphan age and the outputs of groups still processing; files only the database
+// knows about are reported and never touched.
+func (r *Reconciler) ReconcileSite(ctx context.Context, siteID int64, deleteOrphans bool) (*dto.SiteReconciliation, error) {
+	logger := workerLog.GetLoggerFromContext(ctx)
+
+	location, err := r.fileService.GetSiteLocation(ctx, siteID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get location of site %d: %w", siteID, err)
+	}
+
+	// Every group counts, active or not, and an incomplete key set must not turn real files into orphans
+	expected, err := r.fileService.GetSiteFiles(ctx, siteID, WithFailFast(), WithIncludeInactive())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files of site %d: %w", siteID, err)
+	}
+
+	prefixes := make([]BucketPrefix, 0, len(location.Prefixes))
+	for _, prefix := range location.Prefixes {
+		prefixes = append(prefixes, BucketPrefix{Bucket: location.Bucket, Prefix: prefix})
+	}
+	objects, err := r.s3Service.ListObjectsWithPrefixes(ctx, prefixes)
+	if err != nil {
+		return nil, err
+	}
+	listed := make(map[string]dto.S3Object, len(objects))
+	for _, obj := range objects {
+		obj.Region = location.Region
+		listed[obj.Key] = obj
+	}
+
+	reconciliation := &dto.SiteReconciliation{
+		SiteID:   siteID,
+		Bucket:   location.Bucket,
+		Prefixes: location.Prefixes,
+	}
+	expectedKeys := make(map[string]bool, len(expected))
+	for _, obj := range expected {
+		if expectedKeys[obj.Key] {
+			continue
+		}
+		expectedKeys[obj.Key] = true
+		if _, ok := listed[obj.Key]; ok {
+			reconciliation.Matched++
+		} else {
+			reconciliation.MissingInS3 = append(reconciliation.MissingInS3, obj)
+		}
+	}
+	for key, obj := range listed {
+		if !expectedKeys[key] {
+			reconciliation.OrphanedInS3 = append(reconciliation.OrphanedInS3, obj)
+		}
+	}
+	sort.Slice(reconciliation.MissingInS3, func(i, j int) bool {
+		return reconciliation.MissingInS3[i].Key < reconciliation.MissingInS3[j].Key
+	})
+	sort.Slice(reconciliation.OrphanedInS3, func(i, j int) bool {
+		return reconciliation.OrphanedInS3[i].Key < reconciliation.OrphanedInS3[j].Key
+	})
+
+	logger.WithFields(log.Fields{
+		"site_id":        siteID,
+		"matched":        reconciliation.Matched,
+		"missing_in_s3":  len(reconciliation.MissingInS3),
+		"orphaned_in_s3": len(reconciliation.OrphanedInS3),
+	}).Info("Reconciled site files")
+
+	if !deleteOrphans || len(reconciliation.OrphanedInS3) == 0 {
+		return reconciliation, nil
+	}
+
+	deletable := make([]dto.S3Object, 0, len(reconciliation.OrphanedInS3))
+	for _, obj := range reconciliation.OrphanedInS3 {
+		if r.deletableOrphan(obj, location.Pending) {
+			deletable = append(deletable, obj)
+		}
+	}
+	reconciliation.OrphansKept = len(reconciliation.OrphanedInS3) - len(deletable)
+	if reconciliation.OrphansKept > 0 {
+		logger.WithFields(log.Fields{
+			"site_id":      siteID,
+			"orphans_kept": reconciliation.OrphansKept,
+		}).Info("Keeping recent orphans and outputs of groups still processing")
+	}
+	if len(deletable) > 0 {
+		deleted, err := r.s3Service.DeleteObjects(withAllowedPrefixes(ctx, prefixes), deletable)
+		reconciliation.OrphansDeleted = deleted
+		if err != nil {
+			return reconciliation, fmt.Errorf("failed to delete orphaned objects of site %d: %w", siteID, err)
+		}
+	}
+
+	return reconciliation, nil
+}
+
+// deletableOrphan reports whether an orphan may be deleted: it must be older than the minimum orphan age, since a
+// recent upload's row may not be committed yet, and not be the output of a group whose processing is pending
+func (r *Reconciler) deletableOrphan(obj dto.S3Object, pending []string) bool {
+	if r.minOrphanAge > 0 && (obj.LastModified.IsZero() || time.Since(obj.LastModified) < r.minOrphanAge) {
+		return false
+	}
+	for _, prefix := range pending {
+		if strings.HasPrefix(obj.Key, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// Diff reports, without deleting anything, what cleansing the site or project named by message would do: the
+// keys its database rows map to, the objects S3 holds under its prefixes, which of those the cleanse would delete
+// (honouring the message's category, scope and the protected prefixes) and the orphans it would leave behind
+func (r *Reconciler) Diff(ctx context.Context, message dto.CleansingMessage) (*dto.CleansingDiff, error) {
+	logger := workerLog.GetLoggerFromContext(ctx)
+
+	if !message.IsValidScope() {
+		return nil, fmt.Errorf("invalid cleansing scope: %s", message.Scope)
+	}
+
+	var (
+		location  *SiteLocation
+		listFiles func(ctx context.Context, id int64, opts ...FileOption) ([]dto.S3Object, error)
+		err       error
+	)
+	switch message.Type {
+	case dto.CleansingTypeSite:
+		location, err = r.fileService.GetSiteLocation(ctx, message.ID)
+		listFiles = r.fileService.GetSiteFiles
+	case dto.CleansingTypeProject:
+		location, err = r.fileService.GetProjectLocation(ctx, message.ID)
+		listFiles = r.fileService.GetProjectFiles
+	default:
+		return nil, fmt.Errorf("diff only covers sites and projects, not %q", message.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get location of %s %d: %w", message.Type, message.ID, err)
+	}
+
+	// As when reconciling, every group counts towards what the database expects
+	expected, err := listFiles(ctx, message.ID, WithFailFast(), WithIncludeInactive())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files of %s %d: %w", message.Type, message.ID, err)
+	}
+	planned, err := listFiles(ctx, message.ID, WithCategory(message.Category), WithScope(message.Scope))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files of %s %d: %w", message.Type, message.ID, err)
+	}
+	planned, _ = r.s3Service.FilterProtected(planned)
+
+	prefixes := make([]BucketPrefix, 0, len(location.Prefixes))
+	for _, prefix := range location.Prefixes {
+		prefixes = append(prefixes, BucketPrefix{Bucket: location.Bucket, Prefix: prefix})
+	}
+	present, err := r.s3Service.ListObjectsWithPrefixes(ctx, prefixes)
+	if err != nil {
+		return nil, err
+	}
+	listed := make(map[string]dto.S3Object, len(present))
+	for i := range present {
+		present[i].Region = location.Region
+		listed[present[i].Key] = present[i]
+	}
+
+	diff := &dto.CleansingDiff{
+		Type:     message.Type,
+		ID:       message.ID,
+		Bucket:   location.Bucket,
+		Prefixes: location.Prefixes,
+		Present:  present,
+	}
+	expectedKeys := make(map[string]bool, len(expected))
+	for _, obj := range expected {
+		if !expectedKeys[obj.Key] {
+			expectedKeys[obj.Key] = true
+			diff.Expected = append(diff.Expected, obj)
+		}
+	}
+	// Deleting a key S3 does not hold is a no-op, so only present objects are planned
+	plannedKeys := make(map[string]bool, len(planned))
+	for _, obj := range planned {
+		if listedObj, ok := listed[obj.Key]; ok && !plannedKeys[obj.Key] {
+			plannedKeys[obj.Key] = true
+			diff.PlannedDeletes = append(diff.PlannedDeletes, listedObj)
+		}
+	}
+	for _, obj := range present {
+		if !expectedKeys[obj.Key] {
+			diff.Orphans = append(diff.Orphans, obj)
+		}
+	}
+	for _, objects := range [][]dto.S3Object{diff.Expected, diff.Present, diff.PlannedDeletes, diff.Orphans} {
+		sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	}
+
+	logger.WithFields(log.Fields{
+		"type":            message.Type,
+		"id":              message.ID,
+		"expected":        len(diff.Expected),
+		"present":         len(diff.Present),
+		"planned_deletes": len(diff.PlannedDeletes),
+		"orphans":         len(diff.Orphans),
+	}).Info("Built cleansing diff")
+
+	return diff, nil
+}
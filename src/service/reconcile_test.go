@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+)
+
+// prefixS3Service lists the objects of a fixed bucket listing by prefix
+type prefixS3Service struct {
+	mockS3Service
+	bucketObjects []dto.S3Object
+	listErr       error // Returned by ListObjectsWithPrefix when set
+}
+
+func (m *prefixS3Service) ListObjectsWithPrefix(ctx context.Context, bucket, prefix string) ([]dto.S3Object, error) {
+	if m.listErr != nil {
+		return nil, m.listErr
+	}
+	var objects []dto.S3Object
+	for _, obj := range m.bucketObjects {
+		if obj.Bucket == bucket && strings.HasPrefix(obj.Key, prefix) {
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+func (m *prefixS3Service) ListObjectsWithPrefixes(ctx context.Context, prefixes []BucketPrefix) ([]dto.S3Object, error) {
+	var objects []dto.S3Object
+	for _, bucketPrefix := range prefixes {
+		listed, err := m.ListObjectsWithPrefix(ctx, bucketPrefix.Bucket, bucketPrefix.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, listed...)
+	}
+	return objects, nil
+}
+
+// objectKeyList returns the keys of objects in order
+func objectKeyList(objects []dto.S3Object) []string {
+	keys := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	return keys
+}
+
+func TestReconciler_ReconcileSite(t *testing.T) {
+	// Site 100 expects three uploads and four processed outputs; S3 lacks two of them and holds two strays
+	bucketObjects := []dto.S3Object{
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/00_Upload/depth.tif"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/00_Upload/line1/Raw/a.xtf"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/00_Upload/stale.xtf"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/01_Processed/depth.geojson"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/01_Processed/depth_B01.tif"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/01_Processed/depth_B02.tif"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/01_Processed/old.geojson"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S101/00_Upload/photo.jpg"},  // Another site
+		{Bucket: testutil.OtherBucket, Key: "PRJA/S100/00_Upload/x.xtf"}, // Another bucket
+	}
+	wantMissing := []string{"PRJA/S100/00_Upload/line1/Raw/b.xtf", "PRJA/S100/01_Processed/depth_B03.tif"}
+	wantOrphaned := []string{"PRJA/S100/00_Upload/stale.xtf", "PRJA/S100/01_Processed/old.geojson"}
+
+	tests := []struct {
+		name          string
+		deleteOrphans bool
+		wantDeleted   int
+	}{
+		{name: "report only", deleteOrphans: false, wantDeleted: 0},
+		{name: "delete orphans", deleteOrphans: true, wantDeleted: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewMigratedDB(t)
+			testutil.SeedTree(t, db)
+			s3Service := &prefixS3Service{bucketObjects: bucketObjects}
+			reconciler := NewReconciler(newDBFileService(db), s3Service)
+
+			reconciliation, err := reconciler.ReconcileSite(context.Background(), testutil.SiteID, tt.deleteOrphans)
+			if err != nil {
+				t.Fatalf("ReconcileSite() unexpected error: %v", err)
+			}
+
+			if reconciliation.Bucket != testutil.Bucket || len(reconciliation.Prefixes) != 2 {
+				t.Errorf("Expected both prefixes of %s, got %s %v", testutil.Bucket, reconciliation.Bucket, reconciliation.Prefixes)
+			}
+			if reconciliation.Matched != 5 {
+				t.Errorf("Expected 5 matched keys, got %d", reconciliation.Matched)
+			}
+			if got := objectKeyList(reconciliation.MissingInS3); strings.Join(got, ",") != strings.Join(wantMissing, ",") {
+				t.Errorf("Expected missing in S3 %v, got %v", wantMissing, got)
+			}
+			if got := objectKeyList(reconciliation.OrphanedInS3); strings.Join(got, ",") != strings.Join(wantOrphaned, ",") {
+				t.Errorf("Expected orphaned in S3 %v, got %v", wantOrphaned, got)
+			}
+			if reconciliation.OrphansDeleted != tt.wantDeleted {
+				t.Errorf("Expected %d orphans deleted, got %d", tt.wantDeleted, reconciliation.OrphansDeleted)
+			}
+
+			// Only S3-side orphans are ever deleted, in the contractor bucket's region
+			if got := objectKeyList(s3Service.deleted); len(got) != tt.wantDeleted {
+				t.Fatalf("Expected %d deleted objects, got %v", tt.wantDeleted, got)
+			}
+			for _, obj := range s3Service.deleted {
+				if obj.Region != testutil.Region {
+					t.Errorf("Expected orphan %s in region %s, got %q", obj.Key, testutil.Region, obj.Region)
+				}
+			}
+		})
+	}
+}
+
+func TestReconciler_ReconcileSite_KeepsRecentAndPendingOrphans(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	// Group 1001 is being reprocessed, so its depth outputs are not expected until it finishes
+	if err := db.Model(&entity.DocumentGroup{}).Where("id = ?", 1001).Update("progress", 20).Error; err != nil {
+		t.Fatalf("Failed to update group progress: %v", err)
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	bucketObjects := []dto.S3Object{
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/00_Upload/stale.xtf", LastModified: old},
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/00_Upload/uploading.xtf", LastModified: time.Now()},
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/01_Processed/depth.geojson", LastModified: old},
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/01_Processed/old.geojson", LastModified: old},
+	}
+	s3Service := &prefixS3Service{bucketObjects: bucketObjects}
+	reconciler := NewReconcilerWithConfig(&config.Config{OrphanMinAge: 24 * time.Hour}, newDBFileService(db), s3Service)
+
+	reconciliation, err := reconciler.ReconcileSite(context.Background(), testutil.SiteID, true)
+	if err != nil {
+		t.Fatalf("ReconcileSite() unexpected error: %v", err)
+	}
+	if len(reconciliation.OrphanedInS3) != 4 {
+		t.Errorf("Expected every listed object reported as orphaned, got %v", objectKeyList(reconciliation.OrphanedInS3))
+	}
+	want := []string{"PRJA/S100/00_Upload/stale.xtf", "PRJA/S100/01_Processed/old.geojson"}
+	if got := objectKeyList(s3Service.deleted); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected only old orphans of finished groups deleted %v, got %v", want, got)
+	}
+	if reconciliation.OrphansDeleted != 2 || reconciliation.OrphansKept != 2 {
+		t.Errorf("Expected 2 orphans deleted and 2 kept, got %d and %d", reconciliation.OrphansDeleted, reconciliation.OrphansKept)
+	}
+}
+
+func TestReconciler_ReconcileSite_Errors(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	fileService := newDBFileService(db)
+
+	if _, err := NewReconciler(fileService, &prefixS3Service{}).ReconcileSite(context.Background(), 999, true); err == nil {
+		t.Error("Expected error for unknown site")
+	}
+
+	s3Service := &prefixS3Service{listErr: errors.New("access denied")}
+	if _, err := NewReconciler(fileService, s3Service).ReconcileSite(context.Background(), testutil.SiteID, true); err == nil {
+		t.Error("Expected error when S3 cannot be listed")
+	}
+	if len(s3Service.deleted) != 0 {
+		t.Errorf("Expected nothing deleted, got %v", objectKeyList(s3Service.deleted))
+	}
+}
+
+func TestReconciler_Diff(t *testing.T) {
+	bucketObjects := []dto.S3Object{
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/00_Upload/depth.tif"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/00_Upload/line1/Raw/a.xtf"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/00_Upload/stale.xtf"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/01_Processed/depth.geojson"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/01_Processed/depth_B01.tif"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S100/01_Processed/depth_B02.tif"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S101/00_Upload/photo.jpg"},
+		{Bucket: testutil.Bucket, Key: "PRJA/S101/01_Processed/stray.jpg"},
+		{Bucket: testutil.OtherBucket, Key: "PRJA/S100/00_Upload/x.xtf"}, // Another bucket
+	}
+
+	tests := []struct {
+		name        string
+		message     dto.CleansingMessage
+		isProtected ObjectFilter
+		wantPresent int
+		wantPlanned []string
+		wantOrphans []string
+	}{
+		{
+			name:        "site",
+			message:     dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: testutil.SiteID},
+			wantPresent: 6,
+			wantPlanned: []string{
+				"PRJA/S100/00_Upload/depth.tif",
+				"PRJA/S100/00_Upload/line1/Raw/a.xtf",
+				"PRJA/S100/01_Processed/depth.geojson",
+				"PRJA/S100/01_Processed/depth_B01.tif",
+				"PRJA/S100/01_Processed/depth_B02.tif",
+			},
+			wantOrphans: []string{"PRJA/S100/00_Upload/stale.xtf"},
+		},
+		{
+			name:        "site raw scope",
+			message:     dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: testutil.SiteID, Scope: dto.ScopeRaw},
+			wantPresent: 6,
+			wantPlanned: []string{"PRJA/S100/00_Upload/depth.tif", "PRJA/S100/00_Upload/line1/Raw/a.xtf"},
+			wantOrphans: []string{"PRJA/S100/00_Upload/stale.xtf"},
+		},
+		{
+			name:        "site with protected objects",
+			message:     dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: testutil.SiteID},
+			isProtected: func(obj dto.S3Object) bool { return strings.HasPrefix(obj.Key, "PRJA/S100/01_Processed/") },
+			wantPresent: 6,
+			wantPlanned: []string{"PRJA/S100/00_Upload/depth.tif", "PRJA/S100/00_Upload/line1/Raw/a.xtf"},
+			wantOrphans: []string{"PRJA/S100/00_Upload/stale.xtf"},
+		},
+		{
+			name:        "project",
+			message:     dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: testutil.ProjectID},
+			wantPresent: 8,
+			wantPlanned: []string{
+				"PRJA/S100/00_Upload/depth.tif",
+				"PRJA/S100/00_Upload/line1/Raw/a.xtf",
+				"PRJA/S100/01_Processed/depth.geojson",
+				"PRJA/S100/01_Processed/depth_B01.tif",
+				"PRJA/S100/01_Processed/depth_B02.tif",
+				"PRJA/S101/00_Upload/photo.jpg",
+			},
+			wantOrphans: []string{"PRJA/S100/00_Upload/stale.xtf", "PRJA/S101/01_Processed/stray.jpg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewMigratedDB(t)
+			testutil.SeedTree(t, db)
+			s3Service := &prefixS3Service{bucketObjects: bucketObjects}
+			s3Service.isProtected = tt.isProtected
+			reconciler := NewReconciler(newDBFileService(db), s3Service)
+
+			diff, err := reconciler.Diff(context.Background(), tt.message)
+			if err != nil {
+				t.Fatalf("Diff() unexpected error: %v", err)
+			}
+
+			if diff.Bucket != testutil.Bucket {
+				t.Errorf("Expected bucket %s, got %s", testutil.Bucket, diff.Bucket)
+			}
+			if len(diff.Present) != tt.wantPresent {
+				t.Errorf("Expected %d present objects, got %v", tt.wantPresent, objectKeyList(diff.Present))
+			}
+			if got := objectKeyList(diff.PlannedDeletes); strings.Join(got, ",") != strings.Join(tt.wantPlanned, ",") {
+				t.Errorf("Expected planned deletes %v, got %v", tt.wantPlanned, got)
+			}
+			if got := objectKeyList(diff.Orphans); strings.Join(got, ",") != strings.Join(tt.wantOrphans, ",") {
+				t.Errorf("Expected orphans %v, got %v", tt.wantOrphans, got)
+			}
+			for _, obj := range diff.PlannedDeletes {
+				if obj.Region != testutil.Region {
+					t.Errorf("Expected planned delete %s in region %s, got %q", obj.Key, testutil.Region, obj.Region)
+				}
+			}
+
+			// A diff never deletes anything
+			if len(s3Service.deleted) != 0 {
+				t.Errorf("Expected nothing deleted, got %v", objectKeyList(s3Service.deleted))
+			}
+		})
+	}
+}
+
+func TestReconciler_Diff_Expected(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	reconciler := NewReconciler(newDBFileService(db), &prefixS3Service{})
+
+	diff, err := reconciler.Diff(context.Background(), dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: testutil.SiteID})
+	if err != nil {
+		t.Fatalf("Diff() unexpected error: %v", err)
+	}
+	// With S3 empty the database still expects every key, and nothing is planned
+	if len(diff.Expected) != 7 {
+		t.Errorf("Expected 7 expected keys, got %v", objectKeyList(diff.Expected))
+	}
+	if len(diff.PlannedDeletes) != 0 || len(diff.Orphans) != 0 {
+		t.Errorf("Expected no planned deletes or orphans, got %v and %v", objectKeyList(diff.PlannedDeletes), objectKeyList(diff.Orphans))
+	}
+}
+
+func TestReconciler_Diff_Errors(t *testing.T) {
+	db := testutil.NewMigratedDB(t)
+	testutil.SeedTree(t, db)
+	fileService := newDBFileService(db)
+
+	tests := []struct {
+		name      string
+		message   dto.CleansingMessage
+		s3Service *prefixS3Service
+	}{
+		{name: "contractor", message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: testutil.ContractorID}, s3Service: &prefixS3Service{}},
+		{name: "invalid scope", message: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: testutil.SiteID, Scope: "bogus"}, s3Service: &prefixS3Service{}},
+		{name: "unknown site", message: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: 999}, s3Service: &prefixS3Service{}},
+		{name: "unknown project", message: dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: 999}, s3Service: &prefixS3Service{}},
+		{name: "listing fails", message: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: testutil.SiteID}, s3Service: &prefixS3Service{listErr: errors.New("access denied")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewReconciler(fileService, tt.s3Service).Diff(context.Background(), tt.message); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	log "github.com/sirupsen/logrus"
+)
+
+// deleteRecordsOnly runs only the database cascade of a cleansing, for data whose S3 objects were already removed
+// out of band. No S3 call is made at all: nothing is listed, deleted or counted as deleted, and a contractor's
+// bucket is left alone. Usage counters are still adjusted, from the sizes the file records hold.
+func (cs *CleansingServiceImpl) deleteRecordsOnly(ctx context.Context, message dto.CleansingMessage) (*dto.CleansingResult, error) {
+	logger := workerLog.GetLoggerFromContext(ctx)
+	logger.WithFields(log.Fields{
+		"type": message.Type,
+		"id":   message.ID,
+	}).Info("Skipping S3, deleting database records only")
+
+	result := &dto.CleansingResult{
+		Type:      message.Type,
+		ID:        message.ID,
+		Success:   false,
+		S3Skipped: true,
+	}
+
+	var err error
+	switch message.Type {
+	case dto.CleansingTypeContractor:
+		err = cs.deleteContractorRecordsOnly(ctx, message, result)
+	case dto.CleansingTypeProject:
+		err = cs.deleteProjectRecordsOnly(ctx, message.ID, result)
+	case dto.CleansingTypeSite:
+		err = cs.deleteSiteRecordsOnly(ctx, message.ID, result)
+	default:
+		err = fmt.Errorf("unsupported cleansing type: %s", message.Type)
+		result.Error = err.Error()
+	}
+	if err != nil {
+		return result, err
+	}
+
+	result.Success = true
+	if result.Message == "" {
+		result.Message = fmt.Sprintf("Database records deleted for %s %d, S3 skipped", message.Type, message.ID)
+	} else {
+		result.Message += ", S3 skipped"
+	}
+	logger.WithFields(log.Fields{
+		"type": message.Type,
+		"id":   message.ID,
+	}).Info("Successfully deleted database records, S3 skipped")
+	return result, nil
+}
+
+// deleteContractorRecordsOnly deletes a contractor's records once it is known to exist
+func (cs *CleansingServiceImpl) deleteContractorRecordsOnly(ctx context.Context, message dto.CleansingMessage, result *dto.CleansingResult) error {
+	contractorID := message.ID
+	if _, err := retryRead(ctx, cs.readRetry, func() (*entity.Contractor, error) {
+		return cs.contractorRepo.GetByID(ctx, contractorID)
+	}); err != nil {
+		result.Error = fmt.Sprintf("failed to get contractor: %v", err)
+		return err
+	}
+
+	// Mark the contractor inactive so concurrent uploads stop while we cleanse
+	if err := cs.contractorRepo.SetStatus(ctx, contractorID, entity.ContractorStatusInactive); err != nil {
+		workerLog.GetLoggerFromContext(ctx).WithError(err).WithField("contractor_id", contractorID).Warn("Failed to mark contractor inactive before cleansing")
+	}
+	return cs.cascadeContractorRecords(ctx, message, result)
+}
+
+// deleteProjectRecordsOnly resets a project's usage and deletes its records
+func (cs *CleansingServiceImpl) deleteProjectRecordsOnly(ctx context.Context, projectID int64, result *dto.CleansingResult) error {
+	logger := workerLog.GetLoggerFromContext(ctx)
+	if err := cs.projectRepo.ResetFileSizeUsage(ctx, projectID); err != nil {
+		logger.WithError(err).WithField("project_id", projectID).Error("Failed to reset project usage")
+	}
+	if err := cs.uploaderUsageRepo.ResetByProjectID(ctx, projectID); err != nil {
+		logger.WithError(err).WithField("project_id", projectID).Error("Failed to reset uploader usage")
+	}
+	return cs.cascadeProjectRecords(ctx, projectID, result)
+}
+
+// deleteSiteRecordsOnly takes the size of a site's file records off its project's usage and deletes its records
+func (cs *CleansingServiceImpl) deleteSiteRecordsOnly(ctx context.Context, siteID int64, result *dto.CleansingResult) error {
+	logger := workerLog.GetLoggerFromContext(ctx)
+	site, err := retryRead(ctx, cs.readRetry, func() (*entity.Site, error) {
+		return cs.siteRepo.GetByID(ctx, siteID)
+	})
+	if err != nil {
+		logger.WithError(err).WithField("site_id", siteID).Error("Failed to get site information")
+		result.Error = fmt.Sprintf("failed to get site information: %v", err)
+		return err
+	}
+
+	// Continue with database cleanup even if the usage cannot be updated
+	if _, totalSize, err := cs.fileRepo.CountBySiteID(ctx, siteID); err != nil {
+		logger.WithError(err).WithField("site_id", siteID).Error("Failed to count site files, project usage not updated")
+	} else if err := cs.projectRepo.UpdateProjectUsage(ctx, site.ProjectId, -totalSize); err != nil {
+		logger.WithError(err).WithFields(log.Fields{
+			"site_id":    siteID,
+			"project_id": site.ProjectId,
+			"total_size": totalSize,
+		}).Error("Failed to update project usage")
+	}
+	return cs.cascadeSiteRecords(ctx, siteID, result)
+}
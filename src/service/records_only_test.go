@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/repository"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+	"gorm.io/gorm"
+)
+
+// unreachableS3Service fails the test on any call: its embedded S3Service is nil, so every method panics
+type unreachableS3Service struct {
+	S3Service
+}
+
+// newRecordsOnlyCleansingService builds a CleansingService on the real repositories of db that must not call S3
+func newRecordsOnlyCleansingService(db *gorm.DB) CleansingService {
+	return NewCleansingServiceWithConfig(&config.Config{}, &unreachableS3Service{},
+		repository.NewContractorRepository(db),
+		repository.NewUserContractorRepository(db),
+		repository.NewViewerContractorRepository(db),
+		repository.NewContractorProjectRepository(db),
+		repository.NewProjectRepository(db),
+		repository.NewSiteRepository(db),
+		repository.NewDocumentGroupRepository(db),
+		repository.NewDocumentRepository(db),
+		repository.NewFileRepository(db),
+		repository.NewUploaderContractorUsageRepository(db),
+		repository.NewTxManager(db),
+		nil,
+	)
+}
+
+func TestCleansingService_SkipS3(t *testing.T) {
+	tests := []struct {
+		name        string
+		message     dto.CleansingMessage
+		check       func(t *testing.T, db *gorm.DB)
+		wantMessage string
+	}{
+		{
+			name:    "site",
+			message: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: testutil.SiteID, SkipS3: true},
+			check: func(t *testing.T, db *gorm.DB) {
+				if got := countRows(t, db, &entity.Site{}, "id = ?", testutil.SiteID); got != 0 {
+					t.Errorf("Expected site %d to be deleted, found %d", testutil.SiteID, got)
+				}
+				if got := countRows(t, db, &entity.DocumentGroup{}, "site_id = ?", testutil.SiteID); got != 0 {
+					t.Errorf("Expected the site's document groups to be deleted, found %d", got)
+				}
+				// The site's file records held 600 of the project's 1000 bytes
+				var project entity.Project
+				if err := db.First(&project, testutil.ProjectID).Error; err != nil {
+					t.Fatalf("failed to read project: %v", err)
+				}
+				if project.FileSizeUsage != 400 {
+					t.Errorf("Expected project usage 400, got %d", project.FileSizeUsage)
+				}
+			},
+			wantMessage: "Database records deleted for site 100, S3 skipped",
+		},
+		{
+			name:    "project",
+			message: dto.CleansingMessage{Type: dto.CleansingTypeProject, ID: testutil.ProjectID, SkipS3: true},
+			check: func(t *testing.T, db *gorm.DB) {
+				if got := countRows(t, db, &entity.Project{}, "id = ?", testutil.ProjectID); got != 0 {
+					t.Errorf("Expected project %d to be deleted, found %d", testutil.ProjectID, got)
+				}
+				if got := countRows(t, db, &entity.Site{}, "project_id = ?", testutil.ProjectID); got != 0 {
+					t.Errorf("Expected the project's sites to be deleted, found %d", got)
+				}
+			},
+			wantMessage: "Database records deleted for project 10, S3 skipped",
+		},
+		{
+			name:    "contractor",
+			message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: testutil.ContractorID, SkipS3: true},
+			check: func(t *testing.T, db *gorm.DB) {
+				if got := countRows(t, db, &entity.Contractor{}, "id = ?", testutil.ContractorID); got != 0 {
+					t.Errorf("Expected contractor %d to be deleted, found %d", testutil.ContractorID, got)
+				}
+				if got := countRows(t, db, &entity.Project{}, "id IN ?", []int64{testutil.ProjectID, testutil.SecondProjectID}); got != 0 {
+					t.Errorf("Expected the contractor's projects to be deleted, found %d", got)
+				}
+			},
+			wantMessage: "Database records deleted for contractor 1, S3 skipped",
+		},
+		{
+			name:    "contractor preserved",
+			message: dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: testutil.ContractorID, SkipS3: true, PreserveEntity: true},
+			check: func(t *testing.T, db *gorm.DB) {
+				if got := countRows(t, db, &entity.Contractor{}, "id = ?", testutil.ContractorID); got != 1 {
+					t.Errorf("Expected contractor %d to be kept, found %d", testutil.ContractorID, got)
+				}
+				if got := countRows(t, db, &entity.Project{}, "id IN ?", []int64{testutil.ProjectID, testutil.SecondProjectID}); got != 0 {
+					t.Errorf("Expected the contractor's projects to be deleted, found %d", got)
+				}
+			},
+			wantMessage: "Contractor data purged, contractor record preserved, S3 skipped",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewMigratedDB(t)
+			testutil.SeedTree(t, db)
+
+			result, err := newRecordsOnlyCleansingService(db).ProcessCleansingMessage(context.Background(), tt.message)
+			if err != nil {
+				t.Fatalf("ProcessCleansingMessage() unexpected error: %v", err)
+			}
+			if !result.Success || !result.S3Skipped {
+				t.Errorf("Expected a successful result with S3 skipped, got %+v", result)
+			}
+			if result.FilesDeleted != 0 {
+				t.Errorf("Expected 0 files deleted, got %d", result.FilesDeleted)
+			}
+			if result.Message != tt.wantMessage {
+				t.Errorf("Expected message %q, got %q", tt.wantMessage, result.Message)
+			}
+			tt.check(t, db)
+
+			// The other contractor's tree is untouched
+			if got := countRows(t, db, &entity.File{}, "id = ?", 5); got != 1 {
+				t.Errorf("Expected the other contractor's file to remain, found %d", got)
+			}
+		})
+	}
+}
+
+func TestCleansingService_SkipS3_Refused(t *testing.T) {
+	tests := []struct {
+		name    string
+		message dto.CleansingMessage
+	}{
+		{name: "partial", message: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: testutil.SiteID, Scope: dto.ScopeRaw, SkipS3: true}},
+		{name: "quarantine", message: dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: testutil.SiteID, Quarantine: true, SkipS3: true}},
+		{name: "expired bucket", message: dto.CleansingMessage{Type: dto.CleansingTypeExpiredBucket, ID: testutil.ContractorID, BucketName: testutil.Bucket, SkipS3: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewMigratedDB(t)
+			testutil.SeedTree(t, db)
+
+			result, err := newRecordsOnlyCleansingService(db).ProcessCleansingMessage(context.Background(), tt.message)
+			if err == nil || result.Success {
+				t.Fatalf("Expected the message to be refused, got %+v", result)
+			}
+			if got := countRows(t, db, &entity.Site{}, "id = ?", testutil.SiteID); got != 1 {
+				t.Errorf("Expected site %d to be kept, found %d", testutil.SiteID, got)
+			}
+		})
+	}
+}
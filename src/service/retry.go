@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"github.com/denys89/wadugs-worker-cleansing/src/repository"
+	"github.com/go-sql-driver/mysql"
+	log "github.com/sirupsen/logrus"
+)
+
+// readRetryPolicy controls how repository reads are retried on transient errors.
+// The zero value performs a single attempt.
+type readRetryPolicy struct {
+	retries   int
+	baseDelay time.Duration
+}
+
+// newReadRetryPolicy builds a read retry policy from config
+func newReadRetryPolicy(cfg *config.Config) readRetryPolicy {
+	return readRetryPolicy{
+		retries:   cfg.DBReadRetries,
+		baseDelay: cfg.DBReadRetryDelay,
+	}
+}
+
+// retryRead runs a repository read, retrying transient errors with exponential backoff
+func retryRead[T any](ctx context.Context, policy readRetryPolicy, read func() (T, error)) (T, error) {
+	result, err := read()
+	for attempt := 1; attempt <= policy.retries && isTransientDBError(err); attempt++ {
+		delay := policy.baseDelay * time.Duration(1<<(attempt-1))
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+
+		workerLog.GetLoggerFromContext(ctx).WithError(err).WithFields(log.Fields{
+			"attempt": attempt,
+			"delay":   delay,
+		}).Warn("Transient database error, retrying read")
+
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		result, err = read()
+	}
+	return result, err
+}
+
+// isTransientDBError reports whether a database error is likely to succeed on retry
+func isTransientDBError(err error) bool {
+	if err == nil || errors.Is(err, repository.ErrNotFound) {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr *net.OpError
+	return errors.As(err, &netErr)
+}
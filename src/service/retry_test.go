@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/repository"
+)
+
+func TestIsTransientDBError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "record not found", err: repository.ErrNotFound, want: false},
+		{name: "wrapped record not found", err: fmt.Errorf("get site: %w", repository.ErrNotFound), want: false},
+		{name: "bad connection", err: driver.ErrBadConn, want: true},
+		{name: "wrapped bad connection", err: fmt.Errorf("query: %w", driver.ErrBadConn), want: true},
+		{name: "connection refused", err: syscall.ECONNREFUSED, want: true},
+		{name: "connection reset", err: syscall.ECONNRESET, want: true},
+		{name: "other error", err: errors.New("syntax error"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientDBError(tt.err); got != tt.want {
+				t.Errorf("isTransientDBError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryRead(t *testing.T) {
+	policy := readRetryPolicy{retries: 2, baseDelay: time.Millisecond}
+
+	tests := []struct {
+		name      string
+		policy    readRetryPolicy
+		errs      []error // Errors returned by successive calls; calls beyond the list succeed
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "succeeds first time", policy: policy, wantCalls: 1},
+		{name: "transient then success", policy: policy, errs: []error{driver.ErrBadConn}, wantCalls: 2},
+		{name: "transient until exhausted", policy: policy, errs: []error{driver.ErrBadConn, driver.ErrBadConn, driver.ErrBadConn}, wantErr: driver.ErrBadConn, wantCalls: 3},
+		{name: "record not found is not retried", policy: policy, errs: []error{repository.ErrNotFound}, wantErr: repository.ErrNotFound, wantCalls: 1},
+		{name: "zero policy does not retry", errs: []error{driver.ErrBadConn}, wantErr: driver.ErrBadConn, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			got, err := retryRead(context.Background(), tt.policy, func() (int, error) {
+				calls++
+				if calls <= len(tt.errs) {
+					return 0, tt.errs[calls-1]
+				}
+				return 42, nil
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil && got != 42 {
+				t.Errorf("Expected result 42, got %d", got)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("Expected %d calls, got %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestRetryRead_StopsOnContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	_, err := retryRead(ctx, readRetryPolicy{retries: 3, baseDelay: time.Hour}, func() (int, error) {
+		calls++
+		return 0, driver.ErrBadConn
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 call, got %d", calls)
+	}
+}
+
+// flakyFileRepository returns a transient error for the first reads of each document, up to failures times
+type flakyFileRepository struct {
+	fileTreeFileRepository
+	failures int
+	calls    map[int64]int
+}
+
+func (m *flakyFileRepository) GetByDocumentID(ctx context.Context, documentID, createdAfter, createdBefore int64) (entity.Files, error) {
+	m.calls[documentID]++
+	if m.calls[documentID] <= m.failures {
+		return nil, driver.ErrBadConn
+	}
+	return m.fileTreeFileRepository.GetByDocumentID(ctx, documentID, createdAfter, createdBefore)
+}
+
+func TestFileService_RetriesTransientReads(t *testing.T) {
+	fileRepo := &flakyFileRepository{failures: 1, calls: make(map[int64]int)}
+	fs := NewFileService(
+		&mockContractorRepository{},
+		&mockContractorProjectRepository{},
+		&fileTreeProjectRepository{},
+		&fileTreeSiteRepository{},
+		&fileTreeDocumentGroupRepository{},
+		&fileTreeDocumentRepository{},
+		fileRepo,
+		nil,
+		&config.Config{DBReadRetries: 2, DBReadRetryDelay: time.Millisecond},
+	)
+
+	// Fail fast so an unretried transient error would surface instead of being skipped
+	objects, err := fs.GetContractorFiles(context.Background(), 1, WithFailFast())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(objects) != 2 {
+		t.Errorf("Expected 2 objects after retries, got %d", len(objects))
+	}
+	for documentID, calls := range fileRepo.calls {
+		if calls != 2 {
+			t.Errorf("Expected 2 reads for document %d, got %d", documentID, calls)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+)
+
+// ErrRuntimeExceeded is returned when an operation ran past its runtime budget and paused. The work done so far
+// is kept, and a continuation message picks up the rest.
+var ErrRuntimeExceeded = errors.New("operation runtime exceeded")
+
+// RuntimeExceededError reports where emptying a bucket paused once the runtime budget ran out
+type RuntimeExceededError struct {
+	Bucket      string
+	ResumeAfter string // Last key of the last fully processed listing page
+}
+
+func (e *RuntimeExceededError) Error() string {
+	return fmt.Sprintf("%v: paused emptying bucket %s after key %s", ErrRuntimeExceeded, e.Bucket, e.ResumeAfter)
+}
+
+func (e *RuntimeExceededError) Unwrap() error {
+	return ErrRuntimeExceeded
+}
+
+type (
+	runtimeDeadlineKey struct{}
+	resumeAfterKey     struct{}
+)
+
+// withRuntimeDeadline returns a context carrying the time after which long operations pause. Unlike a context
+// deadline nothing is cancelled: operations check it between units of work and stop at a consistent point.
+// Only emptying a bucket checks it, as only its listing gives a continuation a key to resume after.
+func withRuntimeDeadline(ctx context.Context, deadline time.Time) context.Context {
+	return context.WithValue(ctx, runtimeDeadlineKey{}, deadline)
+}
+
+// runtimeExceeded reports whether the runtime deadline carried by ctx, if any, has passed
+func runtimeExceeded(ctx context.Context) bool {
+	deadline, ok := ctx.Value(runtimeDeadlineKey{}).(time.Time)
+	return ok && !time.Now().Before(deadline)
+}
+
+// withResumeAfter returns a context from which emptying a bucket starts after key, as a continuation message asks
+func withResumeAfter(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, resumeAfterKey{}, key)
+}
+
+// resumeAfterFromContext returns the key after which emptying a bucket resumes, or "" to start from the beginning
+func resumeAfterFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(resumeAfterKey{}).(string)
+	return key
+}
+
+// withoutPausing returns a context in which emptying a bucket neither pauses at the runtime deadline nor resumes
+// after a continuation's key
+func withoutPausing(ctx context.Context) context.Context {
+	return withResumeAfter(context.WithValue(ctx, runtimeDeadlineKey{}, nil), "")
+}
+
+// continuation returns the message that resumes a paused operation after resumeAfter. It keeps the options and
+// the correlation ID of the paused message, so its logs and checkpoints carry on from this one.
+func continuation(ctx context.Context, message dto.CleansingMessage, resumeAfter string) *dto.CleansingMessage {
+	next := message
+	next.ResumeAfter = resumeAfter
+	next.CorrelationID = workerLog.CorrelationIDFromContext(ctx)
+	return &next
+}
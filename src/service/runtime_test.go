@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+)
+
+func TestS3Service_EmptyBucket_PausesPastRuntime(t *testing.T) {
+	client := &mockS3Client{
+		bucketTags: ownerTags("7"),
+		listPages: [][]types.Object{
+			{{Key: aws.String("a")}, {Key: aws.String("b")}},
+			{{Key: aws.String("c")}, {Key: aws.String("d")}},
+		},
+	}
+	s3s := newTestS3Service(client)
+
+	// The deadline has already passed, so the first page is deleted and the run pauses before the second
+	ctx := withRuntimeDeadline(workerLog.WithLogger(context.Background(), "cleansing-1"), time.Now())
+	err := s3s.EmptyBucket(ctx, "contractor-bucket", "", 7)
+
+	var paused *RuntimeExceededError
+	if !errors.As(err, &paused) || !errors.Is(err, ErrRuntimeExceeded) {
+		t.Fatalf("Expected a RuntimeExceededError, got %v", err)
+	}
+	if paused.Bucket != "contractor-bucket" || paused.ResumeAfter != "b" {
+		t.Errorf("Expected to pause contractor-bucket after b, got %+v", paused)
+	}
+	if len(client.deletedKeys) != 2 || client.deletedKeys[0] != "a" || client.deletedKeys[1] != "b" {
+		t.Errorf("Expected only the first page deleted, got %v", client.deletedKeys)
+	}
+
+	// The continuation may be handled by another worker without the checkpoint, so it starts after its own key
+	client.deletedKeys = nil
+	ctx = withResumeAfter(workerLog.WithLogger(context.Background(), "cleansing-2"), paused.ResumeAfter)
+	if err := s3s.EmptyBucket(ctx, "contractor-bucket", "", 7); err != nil {
+		t.Fatalf("Unexpected error on continuation: %v", err)
+	}
+	if got := client.startAfters[len(client.startAfters)-1]; got != "b" {
+		t.Errorf("Expected the continuation to list after b, got %q", got)
+	}
+	if len(client.deletedKeys) != 2 || client.deletedKeys[0] != "c" || client.deletedKeys[1] != "d" {
+		t.Errorf("Expected only c and d deleted by the continuation, got %v", client.deletedKeys)
+	}
+}
+
+func TestS3Service_EmptyBucket_NoDeadline(t *testing.T) {
+	client := &mockS3Client{
+		bucketTags: ownerTags("7"),
+		listPages: [][]types.Object{
+			{{Key: aws.String("a")}},
+			{{Key: aws.String("b")}},
+		},
+	}
+
+	ctx := withRuntimeDeadline(context.Background(), time.Now().Add(time.Hour))
+	if err := newTestS3Service(client).EmptyBucket(ctx, "contractor-bucket", "", 7); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(client.deletedKeys) != 2 {
+		t.Errorf("Expected every page deleted within the runtime, got %v", client.deletedKeys)
+	}
+}
+
+func TestCleansingService_DeleteContractorFiles_PausesPastRuntime(t *testing.T) {
+	s3Service := &mockS3Service{
+		contractorObjects: []dto.S3Object{{Bucket: "test-bucket", Key: "P1/S1/00_Upload/a.txt"}},
+		deleteBucketErr: fmt.Errorf("failed to delete objects in bucket test-bucket: %w",
+			&RuntimeExceededError{Bucket: "test-bucket", ResumeAfter: "P7/S1/00_Upload/z.txt"}),
+	}
+	contractorRepo := &mockContractorRepository{bucketSharedBy: 1}
+	service := NewCleansingServiceWithConfig(&config.Config{MaxOperationRuntime: time.Minute}, s3Service, contractorRepo,
+		&mockUserContractorRepository{}, &mockViewerContractorRepository{}, &mockContractorProjectRepository{},
+		&mockProjectRepository{}, &mockSiteRepository{}, &mockDocumentGroupRepository{}, &mockDocumentRepository{},
+		&mockFileRepository{}, &mockUploaderContractorUsageRepository{}, nil, nil)
+
+	ctx := workerLog.WithLogger(context.Background(), "cleansing-1")
+	message := dto.CleansingMessage{Type: dto.CleansingTypeContractor, ID: 1, Priority: dto.PriorityLow, OverrideObjectLimit: true}
+	result, err := service.ProcessCleansingMessage(ctx, message)
+	if err != nil {
+		t.Fatalf("Expected a paused operation to succeed, got %v", err)
+	}
+	if !result.Success || !result.Paused || result.FilesDeleted != 1 {
+		t.Errorf("Expected a successful paused result with 1 file deleted, got %+v", result)
+	}
+
+	want := dto.CleansingMessage{
+		Type:                dto.CleansingTypeContractor,
+		ID:                  1,
+		Priority:            dto.PriorityLow,
+		OverrideObjectLimit: true,
+		CorrelationID:       "cleansing-1",
+		ResumeAfter:         "P7/S1/00_Upload/z.txt",
+	}
+	if result.FollowUp == nil || *result.FollowUp != want {
+		t.Fatalf("Expected continuation %+v, got %+v", want, result.FollowUp)
+	}
+	if len(contractorRepo.deleted) != 0 {
+		t.Errorf("Expected the contractor record kept until the bucket is gone, got %v deleted", contractorRepo.deleted)
+	}
+
+	// The continuation only finishes the bucket; the contractor's files were deleted before the pause
+	s3Service.deleted = nil
+	s3Service.deleteBucketErr = nil
+	result, err = service.ProcessCleansingMessage(ctx, *result.FollowUp)
+	if err != nil {
+		t.Fatalf("Unexpected error on continuation: %v", err)
+	}
+	if !result.Success || result.Paused || result.FollowUp != nil {
+		t.Errorf("Expected the continuation to complete, got %+v", result)
+	}
+	if len(s3Service.deleted) != 0 {
+		t.Errorf("Expected no files deleted again, got %+v", s3Service.deleted)
+	}
+	if len(s3Service.deletedBuckets) != 1 || len(contractorRepo.deleted) != 1 {
+		t.Errorf("Expected the bucket and contractor deleted, got buckets %v and contractors %v", s3Service.deletedBuckets, contractorRepo.deleted)
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// ErrS3Permanent is returned when S3 refused a request in a way another attempt cannot change, such as
+// AccessDenied or NoSuchBucket. The message is not requeued; the bucket or its permissions need fixing first.
+var ErrS3Permanent = errors.New("permanent S3 error")
+
+// permanentS3Codes are S3 error codes that fail the same way on every attempt
+var permanentS3Codes = map[string]bool{
+	"AccessDenied":          true,
+	"AllAccessDisabled":     true,
+	"AccountProblem":        true,
+	"InvalidAccessKeyId":    true,
+	"InvalidBucketName":     true,
+	"InvalidBucketState":    true,
+	"MethodNotAllowed":      true,
+	"NoSuchBucket":          true,
+	"SignatureDoesNotMatch": true,
+}
+
+// transientS3Codes are S3 error codes, besides the per-key retryableDeleteCodes, that may succeed on another attempt
+var transientS3Codes = map[string]bool{
+	"Throttling":           true,
+	"ThrottlingException":  true,
+	"TooManyRequests":      true,
+	"RequestTimeTooSkewed": true,
+}
+
+// isRetryableS3Error reports whether another attempt at the request that failed with err may succeed.
+// S3 API errors are classified by their code, falling back to their fault: a client fault is permanent, a server
+// fault transient. Errors that are not S3 API errors, such as network failures, are treated as transient.
+func isRetryableS3Error(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var partial *partialDeleteError
+	if errors.As(err, &partial) {
+		return partial.Retryable()
+	}
+
+	var deleteErr *S3DeleteError
+	if errors.As(err, &deleteErr) {
+		return deleteErr.Retryable()
+	}
+
+	var noSuchBucket *types.NoSuchBucket
+	if errors.As(err, &noSuchBucket) {
+		return false
+	}
+
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	code := apiErr.ErrorCode()
+	switch {
+	case permanentS3Codes[code]:
+		return false
+	case retryableDeleteCodes[code], transientS3Codes[code]:
+		return true
+	}
+	return apiErr.ErrorFault() != smithy.FaultClient
+}
+
+// classifyS3Error marks err as ErrS3Permanent when retrying the request cannot succeed, so callers up to the
+// message handler can tell a failure worth requeueing from one that is not
+func classifyS3Error(err error) error {
+	if err == nil || isRetryableS3Error(err) || errors.Is(err, ErrS3Permanent) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrS3Permanent, err)
+}
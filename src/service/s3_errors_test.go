@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+)
+
+func TestIsRetryableS3Error(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "AccessDenied", err: &smithy.GenericAPIError{Code: "AccessDenied"}, want: false},
+		{name: "NoSuchBucket code", err: &smithy.GenericAPIError{Code: "NoSuchBucket"}, want: false},
+		{name: "NoSuchBucket type", err: &types.NoSuchBucket{}, want: false},
+		{name: "InvalidAccessKeyId", err: &smithy.GenericAPIError{Code: "InvalidAccessKeyId"}, want: false},
+		{name: "SlowDown", err: &smithy.GenericAPIError{Code: "SlowDown"}, want: true},
+		{name: "InternalError", err: &smithy.GenericAPIError{Code: "InternalError"}, want: true},
+		{name: "ServiceUnavailable", err: &smithy.GenericAPIError{Code: "ServiceUnavailable"}, want: true},
+		{name: "Throttling", err: &smithy.GenericAPIError{Code: "Throttling"}, want: true},
+		{name: "unknown client fault", err: &smithy.GenericAPIError{Code: "Whatever", Fault: smithy.FaultClient}, want: false},
+		{name: "unknown server fault", err: &smithy.GenericAPIError{Code: "Whatever", Fault: smithy.FaultServer}, want: true},
+		{name: "unknown fault", err: &smithy.GenericAPIError{Code: "BucketNotEmpty"}, want: true},
+		{name: "wrapped AccessDenied", err: fmt.Errorf("failed to delete objects: %w", &smithy.GenericAPIError{Code: "AccessDenied"}), want: false},
+		{name: "network error", err: errors.New("connection reset by peer"), want: true},
+		{name: "retryable per-key error", err: &S3DeleteError{Code: "SlowDown", Err: errors.New("slow down")}, want: true},
+		{name: "permanent per-key error", err: &S3DeleteError{Code: "AccessDenied", Err: errors.New("denied")}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableS3Error(tt.err); got != tt.want {
+				t.Errorf("Expected %v, got %v for %v", tt.want, got, tt.err)
+			}
+		})
+	}
+}
+
+func TestClassifyS3Error(t *testing.T) {
+	if err := classifyS3Error(nil); err != nil {
+		t.Errorf("Expected nil, got %v", err)
+	}
+
+	transient := &smithy.GenericAPIError{Code: "SlowDown"}
+	if err := classifyS3Error(transient); errors.Is(err, ErrS3Permanent) {
+		t.Errorf("Expected a transient error to stay unmarked, got %v", err)
+	}
+
+	denied := &smithy.GenericAPIError{Code: "AccessDenied"}
+	err := classifyS3Error(denied)
+	if !errors.Is(err, ErrS3Permanent) {
+		t.Errorf("Expected ErrS3Permanent, got %v", err)
+	}
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "AccessDenied" {
+		t.Errorf("Expected the S3 error to stay reachable, got %v", err)
+	}
+	if again := classifyS3Error(err); again != err {
+		t.Errorf("Expected an already classified error to be returned unchanged, got %v", again)
+	}
+}
+
+func TestS3Service_DeleteBatchWithRetry_PermanentError(t *testing.T) {
+	requests := 0
+	client := &mockS3Client{
+		deleteObjectsFn: func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+			requests++
+			return nil, &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}
+		},
+	}
+
+	_, err := newTestS3Service(client).deleteBatchWithRetry(context.Background(), client, "test-bucket", []dto.S3Object{{Key: "a"}})
+	if !errors.Is(err, ErrS3Permanent) {
+		t.Fatalf("Expected ErrS3Permanent, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected 1 DeleteObjects request, got %d", requests)
+	}
+}
+
+func TestS3Service_DeleteBatchWithRetry_TransientError(t *testing.T) {
+	requests := 0
+	client := &mockS3Client{
+		deleteObjectsFn: func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+			requests++
+			if requests == 1 {
+				return nil, &smithy.GenericAPIError{Code: "SlowDown", Message: "Please reduce your request rate."}
+			}
+			return &s3.DeleteObjectsOutput{Deleted: []types.DeletedObject{{Key: params.Delete.Objects[0].Key}}}, nil
+		},
+	}
+
+	deleted, err := newTestS3Service(client).deleteBatchWithRetry(context.Background(), client, "test-bucket", []dto.S3Object{{Key: "a"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("Expected 1 deleted object, got %d", deleted)
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 DeleteObjects requests, got %d", requests)
+	}
+}
+
+func TestS3Service_DeleteBucketWithRetry_PermanentError(t *testing.T) {
+	client := &mockS3Client{deleteBucketErr: &types.NoSuchBucket{}}
+
+	err := newTestS3Service(client).deleteBucketWithRetry(context.Background(), client, "test-bucket")
+	if !errors.Is(err, ErrS3Permanent) {
+		t.Errorf("Expected ErrS3Permanent, got %v", err)
+	}
+}
@@ -2,8 +2,14 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -11,9 +17,15 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	appConfig "github.com/denys89/wadugs-worker-cleansing/src/config"
 	"github.com/denys89/wadugs-worker-cleansing/src/dto"
 	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"github.com/denys89/wadugs-worker-cleansing/src/metrics"
+	"github.com/denys89/wadugs-worker-cleansing/src/tracing"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/time/rate"
 )
@@ -21,23 +33,83 @@ import (
 type (
 	// S3Service defines the interface for S3 operations
 	S3Service interface {
-		ListContractorFiles(ctx context.Context, contractorID int64) ([]dto.S3Object, error)
-		ListProjectFiles(ctx context.Context, projectID int64) ([]dto.S3Object, error)
-		ListSiteFiles(ctx context.Context, siteID int64) ([]dto.S3Object, error)
+		ListContractorFiles(ctx context.Context, contractorID int64, opts ...FileOption) ([]dto.S3Object, error)
+		ListProjectFiles(ctx context.Context, projectID int64, opts ...FileOption) ([]dto.S3Object, error)
+		ListSiteFiles(ctx context.Context, siteID int64, opts ...FileOption) ([]dto.S3Object, error)
+		ListObjectsWithPrefix(ctx context.Context, bucket, prefix string) ([]dto.S3Object, error)
+		ListObjectsWithPrefixes(ctx context.Context, prefixes []BucketPrefix) ([]dto.S3Object, error)
+		BucketExists(ctx context.Context, bucket, region string) (bool, error)
+		FilterProtected(objects []dto.S3Object) (deletable, protected []dto.S3Object)
 		DeleteObjects(ctx context.Context, objects []dto.S3Object) (int, error)
-		DeleteBucket(ctx context.Context, bucketName string) error
+		DeleteObjectsByBucket(ctx context.Context, objects []dto.S3Object) ([]dto.BucketDeleteResult, error)
+		DeleteObjectsStream(ctx context.Context, objects <-chan dto.S3Object) (int, error)
+		VerifyBucketOwner(ctx context.Context, bucketName, region string, contractorID int64) error
+		DeleteBucket(ctx context.Context, bucketName, region string, contractorID int64) error
+		EmptyBucket(ctx context.Context, bucketName, region string, contractorID int64) error
+		ExpireBucket(ctx context.Context, bucketName, region string, contractorID int64) error
+		DeleteExpiredBucket(ctx context.Context, bucketName, region string, contractorID int64) (bool, error)
+		QuarantineObjects(ctx context.Context, objects []dto.S3Object) (int, error)
+		PutObject(ctx context.Context, bucket, key string, body []byte, contentType string) error
+		// GetObject reads bucket/key with the default client; the caller closes the body
+		GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+	}
+
+	// ObjectFilter reports whether an S3 object is protected and must never be deleted
+	ObjectFilter func(object dto.S3Object) bool
+
+	// S3API is the subset of the S3 client used by S3ServiceImpl, allowing it to be mocked
+	S3API interface {
+		ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+		DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+		ListBuckets(ctx context.Context, params *s3.ListBucketsInput, optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error)
+		DeleteBucket(ctx context.Context, params *s3.DeleteBucketInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketOutput, error)
+		HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+		HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+		GetBucketTagging(ctx context.Context, params *s3.GetBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error)
+		GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error)
+		PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error)
+		PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error)
+		PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+		GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
 	}
 
 	// S3ServiceImpl implements the S3Service interface
 	S3ServiceImpl struct {
-		client          *s3.Client            // Default client for backward compatibility
-		regionClients   map[string]*s3.Client // Cache of region-specific clients
-		clientMutex     sync.RWMutex          // Mutex for thread-safe client cache access
-		awsConfig       aws.Config            // AWS config for creating new clients
-		accessKeyID     string                // AWS credentials
+		client          S3API            // Default client for backward compatibility
+		regionClients   map[string]S3API // Cache of region-specific clients
+		clientMutex     sync.RWMutex     // Mutex for thread-safe client cache access
+		awsConfig       aws.Config       // AWS config for creating new clients
+		accessKeyID     string           // AWS credentials
 		secretAccessKey string
 		rateLimiter     *rate.Limiter
 		fileService     FileService
+		isProtected     ObjectFilter    // Objects matching this filter are never deleted
+		buckets         bucketPolicy    // Buckets that may be deleted from
+		lifecycleUnsafe bool            // Protected prefixes are configured, which a bucket lifecycle rule cannot exclude
+		bestEffort      bool            // DeleteObjects carries on past a failing bucket instead of cancelling the others
+		checkpoints     CheckpointStore // Progress of bucket emptying, keyed by bucket and correlation ID
+		quarantineTag   types.Tag       // Tag added by QuarantineObjects
+		deleteSlots     chan struct{}   // Shared by all concurrent calls, capping in-flight delete and tag requests
+		quietThreshold  int             // Batches of at least this many objects are deleted in quiet mode; 0 disables it
+		listConcurrency int             // Most prefixes listed at once by ListObjectsWithPrefixes
+
+		keyRetries    int           // Extra attempts at the keys of a batch that failed with a retryable error
+		keyRetryDelay time.Duration // Backoff before the first of those attempts, doubling up to maxDelay
+
+		deleteWarnThreshold int // DeleteObjects warns when handed more objects than this; 0 disables the warning
+		deleteHardMax       int // DeleteObjects rejects more objects than this unless the context allows it; 0 disables it
+		maxObjects          int // Emptying a bucket holding more objects than this is refused unless the context allows it; 0 disables it
+
+		verifyDeletes      bool // Each bucket's deleted keys are checked with HeadObject after the delete
+		verifyDeleteSample int  // Most keys checked per bucket by verifyDeletes; 0 checks all
+
+		breaker *circuitBreaker // Short-circuits delete and list calls while S3 is failing; nil when disabled
+
+		// Requests for a contractor set by withContractor use a role assumed through contractorRoleARNPattern, or the
+		// contractor's own keys with useContractorKeys; their clients are cached by credentials and region
+		contractorRoleARNPattern string
+		useContractorKeys        bool
+		contractorClients        map[string]S3API
 	}
 
 	// NullS3Service is a no-op implementation for testing
@@ -47,8 +119,6 @@ type (
 const (
 	// S3 batch delete limit (AWS maximum is 1000)
 	maxDeleteBatchSize = 1000
-	// Maximum concurrent delete operations (reduced for better rate limiting)
-	maxConcurrentDeletes = 3
 	// Rate limiting: 100 requests per second with burst of 10
 	// This is conservative to avoid throttling
 	requestsPerSecond = 100
@@ -59,19 +129,75 @@ const (
 	maxDelay   = 5 * time.Second
 )
 
-// NewS3Service creates a new S3 service instance with multi-region support
-func NewS3Service(client *s3.Client, awsConfig aws.Config, accessKeyID, secretAccessKey string, fileService FileService) S3Service {
+// NewS3Service creates a new S3 service instance with multi-region support, keeping bucket checkpoints in memory
+func NewS3Service(client S3API, awsConfig aws.Config, cfg *appConfig.Config, fileService FileService) S3Service {
+	return NewS3ServiceWithCheckpoints(client, awsConfig, cfg, fileService, NewMemoryCheckpointStore())
+}
+
+// NewS3ServiceWithCheckpoints creates a new S3 service instance recording the progress of emptying buckets in checkpoints
+func NewS3ServiceWithCheckpoints(client S3API, awsConfig aws.Config, cfg *appConfig.Config, fileService FileService, checkpoints CheckpointStore) S3Service {
 	// Create rate limiter: 100 requests per second with burst of 10
 	limiter := rate.NewLimiter(rate.Limit(requestsPerSecond), burstLimit)
 
+	// Startup validates the tag through the resolver; this only guards direct construction
+	quarantineTag, err := ParseQuarantineTag(cfg.QuarantineTag)
+	if err != nil {
+		log.WithError(err).Error("Invalid quarantine tag, using default")
+		quarantineTag, _ = ParseQuarantineTag(DefaultQuarantineTag)
+	}
+
 	return &S3ServiceImpl{
 		client:          client,
-		regionClients:   make(map[string]*s3.Client),
+		regionClients:   make(map[string]S3API),
 		awsConfig:       awsConfig,
-		accessKeyID:     accessKeyID,
-		secretAccessKey: secretAccessKey,
+		accessKeyID:     cfg.AWSAccessKeyID,
+		secretAccessKey: cfg.AWSSecretAccessKey,
 		rateLimiter:     limiter,
 		fileService:     fileService,
+		isProtected:     ProtectedPrefixFilter(cfg.ProtectedPrefixes),
+		buckets:         newBucketPolicy(cfg.S3AllowedBuckets, cfg.S3DeniedBuckets),
+		lifecycleUnsafe: strings.TrimSpace(strings.Join(cfg.ProtectedPrefixes, "")) != "",
+		checkpoints:     checkpoints,
+		quarantineTag:   quarantineTag,
+		deleteSlots:     make(chan struct{}, max(cfg.S3DeleteConcurrency, 1)),
+		bestEffort:      cfg.S3DeleteBestEffort,
+		quietThreshold:  cfg.S3DeleteQuietThreshold,
+		listConcurrency: max(cfg.S3ListConcurrency, 1),
+
+		keyRetries:    cfg.S3DeleteKeyRetries,
+		keyRetryDelay: baseDelay,
+
+		deleteWarnThreshold: cfg.S3DeleteWarnThreshold,
+		deleteHardMax:       cfg.S3DeleteHardMax,
+		maxObjects:          cfg.MaxObjectsPerOperation,
+
+		verifyDeletes:      cfg.S3DeleteVerify,
+		verifyDeleteSample: cfg.S3DeleteVerifySample,
+
+		breaker: newCircuitBreaker(cfg.S3BreakerThreshold, cfg.S3BreakerCooldown),
+
+		contractorRoleARNPattern: cfg.ContractorRoleARNPattern,
+		useContractorKeys:        cfg.UseContractorCredentials,
+		contractorClients:        make(map[string]S3API),
+	}
+}
+
+// ProtectedPrefixFilter returns an ObjectFilter matching objects whose key starts with any of the given prefixes
+func ProtectedPrefixFilter(prefixes []string) ObjectFilter {
+	var nonEmpty []string
+	for _, prefix := range prefixes {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			nonEmpty = append(nonEmpty, prefix)
+		}
+	}
+
+	return func(object dto.S3Object) bool {
+		for _, prefix := range nonEmpty {
+			if strings.HasPrefix(object.Key, prefix) {
+				return true
+			}
+		}
+		return false
 	}
 }
 
@@ -80,8 +206,15 @@ func NewNullS3Service() S3Service {
 	return &NullS3Service{}
 }
 
-// getClientForRegion gets or creates an S3 client for a specific region
-func (s3s *S3ServiceImpl) getClientForRegion(ctx context.Context, region string) (*s3.Client, error) {
+// getClientForRegion gets or creates an S3 client for a specific region. Under a context carrying a contractor, the
+// client uses the credentials selected for that contractor when they differ from the worker's.
+func (s3s *S3ServiceImpl) getClientForRegion(ctx context.Context, region string) (S3API, error) {
+	if contractor, ok := contractorFromContext(ctx); ok {
+		if creds := selectCredentials(contractor, s3s.contractorRoleARNPattern, s3s.useContractorKeys); creds.source != credentialSourceDefault {
+			return s3s.getContractorClient(ctx, creds, region)
+		}
+	}
+
 	// If region is empty, use default client
 	if region == "" {
 		return s3s.client, nil
@@ -115,6 +248,7 @@ func (s3s *S3ServiceImpl) getClientForRegion(ctx context.Context, region string)
 			s3s.secretAccessKey,
 			"", // session token
 		)),
+		config.WithAPIOptions([]func(*middleware.Stack) error{AddCorrelationIDMiddleware}),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create config for region %s: %w", region, err)
@@ -128,20 +262,22 @@ func (s3s *S3ServiceImpl) getClientForRegion(ctx context.Context, region string)
 	return client, nil
 }
 
-// ListContractorFiles lists all S3 objects for a contractor across all buckets
-func (s3s *S3ServiceImpl) ListContractorFiles(ctx context.Context, contractorID int64) ([]dto.S3Object, error) {
+// ListContractorFiles lists all S3 objects for a contractor in the contractor's bucket
+func (s3s *S3ServiceImpl) ListContractorFiles(ctx context.Context, contractorID int64, opts ...FileOption) ([]dto.S3Object, error) {
 	logger := workerLog.GetLoggerFromContext(ctx)
 	logger.WithField("contractor_id", contractorID).Info("Listing contractor files")
 
 	// Get file information from the file service
-	objects, err := s3s.fileService.GetContractorFiles(ctx, contractorID)
+	objects, err := s3s.fileService.GetContractorFiles(ctx, contractorID, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get contractor files: %w", err)
 	}
+	objects, err = s3s.filterLastModified(ctx, objects, newFileOptions(opts))
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter contractor files by creation time: %w", err)
+	}
 
-	// TODO: Populate bucket information for each object
-	// This would require additional logic to determine the correct bucket
-	// based on project/site configuration or environment settings
+	// Bucket and region come from the owning contractor's record, so only that bucket is ever touched
 
 	logger.WithFields(log.Fields{
 		"contractor_id": contractorID,
@@ -152,19 +288,21 @@ func (s3s *S3ServiceImpl) ListContractorFiles(ctx context.Context, contractorID
 }
 
 // ListProjectFiles lists all S3 objects for a project
-func (s3s *S3ServiceImpl) ListProjectFiles(ctx context.Context, projectID int64) ([]dto.S3Object, error) {
+func (s3s *S3ServiceImpl) ListProjectFiles(ctx context.Context, projectID int64, opts ...FileOption) ([]dto.S3Object, error) {
 	logger := workerLog.GetLoggerFromContext(ctx)
 	logger.WithField("project_id", projectID).Info("Listing project files")
 
 	// Get file information from the file service
-	objects, err := s3s.fileService.GetProjectFiles(ctx, projectID)
+	objects, err := s3s.fileService.GetProjectFiles(ctx, projectID, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get project files: %w", err)
 	}
+	objects, err = s3s.filterLastModified(ctx, objects, newFileOptions(opts))
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter project files by creation time: %w", err)
+	}
 
-	// TODO: Populate bucket information for each object
-	// This would require additional logic to determine the correct bucket
-	// based on project/site configuration or environment settings
+	// Bucket and region come from the owning contractor's record, so only that bucket is ever touched
 
 	logger.WithFields(log.Fields{
 		"project_id":  projectID,
@@ -175,19 +313,21 @@ func (s3s *S3ServiceImpl) ListProjectFiles(ctx context.Context, projectID int64)
 }
 
 // ListSiteFiles lists all S3 objects for a site
-func (s3s *S3ServiceImpl) ListSiteFiles(ctx context.Context, siteID int64) ([]dto.S3Object, error) {
+func (s3s *S3ServiceImpl) ListSiteFiles(ctx context.Context, siteID int64, opts ...FileOption) ([]dto.S3Object, error) {
 	logger := workerLog.GetLoggerFromContext(ctx)
 	logger.WithField("site_id", siteID).Info("Listing site files")
 
 	// Get file information from the file service
-	objects, err := s3s.fileService.GetSiteFiles(ctx, siteID)
+	objects, err := s3s.fileService.GetSiteFiles(ctx, siteID, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get site files: %w", err)
 	}
+	objects, err = s3s.filterLastModified(ctx, objects, newFileOptions(opts))
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter site files by creation time: %w", err)
+	}
 
-	// TODO: Populate bucket information for each object
-	// This would require additional logic to determine the correct bucket
-	// based on project/site configuration or environment settings
+	// Bucket and region come from the owning contractor's record, so only that bucket is ever touched
 
 	logger.WithFields(log.Fields{
 		"site_id":     siteID,
@@ -197,13 +337,109 @@ func (s3s *S3ServiceImpl) ListSiteFiles(ctx context.Context, siteID int64) ([]dt
 	return objects, nil
 }
 
-// DeleteObjects deletes multiple S3 objects in batches with concurrency control and multi-region support
+// FilterProtected splits objects into those that may be deleted and those protected by the configured filter
+func (s3s *S3ServiceImpl) FilterProtected(objects []dto.S3Object) (deletable, protected []dto.S3Object) {
+	if s3s.isProtected == nil {
+		return objects, nil
+	}
+
+	for _, obj := range objects {
+		if s3s.isProtected(obj) {
+			protected = append(protected, obj)
+			continue
+		}
+		deletable = append(deletable, obj)
+	}
+	return deletable, protected
+}
+
+// isUnsafeKey reports whether a key cannot name a single file: it is empty or ends in "/" like a directory
+func isUnsafeKey(key string) bool {
+	return strings.TrimSpace(key) == "" || strings.HasSuffix(key, "/")
+}
+
+// FilterUnsafeKeys splits objects into those that are safe to delete and those whose key looks like a
+// directory rather than a file: empty keys, keys ending in "/", and keys that are a directory prefix of
+// another object in the same bucket. Such keys point to a bug in key construction and are never deleted.
+func FilterUnsafeKeys(objects []dto.S3Object) (safe, unsafe []dto.S3Object) {
+	type bucketPrefix struct {
+		bucket string
+		prefix string
+	}
+
+	directories := make(map[bucketPrefix]bool)
+	for _, obj := range objects {
+		for i := 0; i < len(obj.Key); i++ {
+			if obj.Key[i] == '/' {
+				directories[bucketPrefix{bucket: obj.Bucket, prefix: obj.Key[:i]}] = true
+			}
+		}
+	}
+
+	for _, obj := range objects {
+		if isUnsafeKey(obj.Key) || directories[bucketPrefix{bucket: obj.Bucket, prefix: obj.Key}] {
+			unsafe = append(unsafe, obj)
+			continue
+		}
+		safe = append(safe, obj)
+	}
+	return safe, unsafe
+}
+
+// logUnsafeKeys warns about every object skipped by FilterUnsafeKeys
+func logUnsafeKeys(ctx context.Context, unsafe []dto.S3Object) {
+	logger := workerLog.GetLoggerFromContext(ctx)
+	for _, obj := range unsafe {
+		logger.WithFields(log.Fields{
+			"bucket": obj.Bucket,
+			"key":    obj.Key,
+		}).Warn("Skipping object with unsafe key")
+	}
+}
+
+// DeleteObjects deletes multiple S3 objects like DeleteObjectsByBucket, returning the total number deleted across
+// all buckets.
 func (s3s *S3ServiceImpl) DeleteObjects(ctx context.Context, objects []dto.S3Object) (int, error) {
+	results, err := s3s.DeleteObjectsByBucket(ctx, objects)
+	return TotalDeleted(results), err
+}
+
+// DeleteObjectsByBucket deletes multiple S3 objects in batches with concurrency control and multi-region support,
+// returning how many objects were deleted and how many were not in each bucket, ordered by bucket and region.
+// Inputs beyond the configured hard maximum are rejected with ErrDeleteInputTooLarge unless the context allows them,
+// and inputs with any object in a bucket outside the configured allow and deny lists with ErrBucketNotAllowed.
+// Protected objects and objects with unsafe keys are always skipped, even if the caller did not filter them out,
+// and so are objects outside the allowed prefixes when the context carries an allowlist.
+func (s3s *S3ServiceImpl) DeleteObjectsByBucket(ctx context.Context, objects []dto.S3Object) (results []dto.BucketDeleteResult, err error) {
+	ctx, span := tracing.Start(ctx, "s3.delete_objects", attribute.Int("object_count", len(objects)))
+	defer func() {
+		span.SetAttributes(attribute.Int("deleted_count", TotalDeleted(results)))
+		tracing.End(span, err)
+	}()
+
 	logger := workerLog.GetLoggerFromContext(ctx)
 	logger.WithField("total_objects", len(objects)).Info("Starting multi-region batch delete operation")
+	if err := s3s.checkDeleteInputSize(ctx, len(objects)); err != nil {
+		return nil, err
+	}
+	if err := s3s.buckets.checkObjects(objects); err != nil {
+		return nil, err
+	}
+
+	objects, protected := s3s.FilterProtected(objects)
+	if len(protected) > 0 {
+		logger.WithField("protected_objects", len(protected)).Warn("Skipping protected objects")
+	}
+	objects, unsafe := FilterUnsafeKeys(objects)
+	logUnsafeKeys(ctx, unsafe)
+	if allowed, ok := allowedPrefixesFromContext(ctx); ok {
+		var outside []dto.S3Object
+		objects, outside = FilterAllowedPrefixes(objects, allowed)
+		logOutsidePrefixes(ctx, outside)
+	}
 
 	if len(objects) == 0 {
-		return 0, nil
+		return nil, nil
 	}
 
 	// Group objects by region and bucket for efficient batch deletion
@@ -222,9 +458,14 @@ func (s3s *S3ServiceImpl) DeleteObjects(ctx context.Context, objects []dto.S3Obj
 
 	logger.WithField("regions_count", len(regionBucketObjects)).Info("Grouped objects by region")
 
-	totalDeleted := 0
+	// Buckets are deleted concurrently, so the results are shared between goroutines
+	var resultsMu sync.Mutex
 	g, ctx := errgroup.WithContext(ctx)
-	sem := make(chan struct{}, maxConcurrentDeletes)
+	sem := make(chan struct{}, s3s.deleteConcurrency())
+
+	// In best-effort mode a failing bucket is recorded instead of returned, so errgroup does not cancel the others
+	var failures []error
+	bucketCount := 0
 
 	// Process each region
 	for region, bucketObjects := range regionBucketObjects {
@@ -236,69 +477,248 @@ func (s3s *S3ServiceImpl) DeleteObjects(ctx context.Context, objects []dto.S3Obj
 			bucket := bucket
 			bucketObjs := bucketObjs
 
+			bucketCount++
 			sem <- struct{}{}
 			g.Go(func() error {
 				defer func() { <-sem }()
 
-				// Get region-specific client
-				client, err := s3s.getClientForRegion(ctx, region)
-				if err != nil {
-					return fmt.Errorf("failed to get S3 client for region %s: %w", region, err)
-				}
-
-				deleted, err := s3s.deleteBucketObjectsWithClient(ctx, client, bucket, bucketObjs)
-				if err != nil {
-					return fmt.Errorf("failed to delete objects in bucket %s (region %s): %w", bucket, region, err)
+				result, err := s3s.deleteRegionBucket(ctx, region, bucket, bucketObjs)
+				resultsMu.Lock()
+				defer resultsMu.Unlock()
+				results = append(results, result)
+				if err == nil || !s3s.bestEffort {
+					return err
 				}
-				totalDeleted += deleted
+				logger.WithError(err).WithField("bucket", bucket).Error("Failed to delete objects in bucket, continuing with the other buckets")
+				failures = append(failures, err)
 				return nil
 			})
 		}
 	}
 
-	if err := g.Wait(); err != nil {
-		return totalDeleted, err
+	err = g.Wait()
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Bucket != results[j].Bucket {
+			return results[i].Bucket < results[j].Bucket
+		}
+		return results[i].Region < results[j].Region
+	})
+	if err != nil {
+		return results, err
+	}
+	if len(failures) > 0 {
+		return results, fmt.Errorf("failed to delete objects in %d of %d buckets (%d objects deleted): %w",
+			len(failures), bucketCount, TotalDeleted(results), errors.Join(failures...))
 	}
 
-	logger.WithField("total_deleted", totalDeleted).Info("Completed multi-region batch delete operation")
-	return totalDeleted, nil
+	logger.WithField("total_deleted", TotalDeleted(results)).Info("Completed multi-region batch delete operation")
+	return results, nil
 }
 
-// deleteBucketObjects deletes objects in a specific bucket using batch operations
-func (s3s *S3ServiceImpl) deleteBucketObjects(ctx context.Context, bucket string, objects []dto.S3Object) (int, error) {
+// deleteRegionBucket deletes objects of one bucket with the client of its region. Objects deleted before a
+// failure are counted only in best-effort mode; every other object of the bucket counts as failed.
+func (s3s *S3ServiceImpl) deleteRegionBucket(ctx context.Context, region, bucket string, objects []dto.S3Object) (dto.BucketDeleteResult, error) {
+	result := dto.BucketDeleteResult{Bucket: bucket, Region: region}
+
+	// Get region-specific client
+	client, err := s3s.getClientForRegion(ctx, region)
+	if err != nil {
+		err = fmt.Errorf("failed to get S3 client for region %s: %w", region, err)
+		result.Failed = len(objects)
+		result.Error = err.Error()
+		return result, err
+	}
+
+	deleted, err := s3s.deleteBucketObjectsWithClient(ctx, client, bucket, objects)
+	if err != nil {
+		if s3s.bestEffort {
+			result.Deleted = deleted
+		}
+		err = fmt.Errorf("failed to delete objects in bucket %s (region %s): %w", bucket, region, err)
+		result.Failed = len(objects) - result.Deleted
+		result.Error = err.Error()
+		return result, err
+	}
+	result.Deleted = deleted
+
+	remaining, err := s3s.verifyDeleted(ctx, client, bucket, objects)
+	if err != nil {
+		err = fmt.Errorf("failed to verify deletes in bucket %s (region %s): %w", bucket, region, err)
+		result.Deleted -= remaining
+		result.Failed = remaining
+		result.Error = err.Error()
+		return result, err
+	}
+	return result, nil
+}
+
+// TotalDeleted sums the objects deleted across the buckets of a DeleteObjectsByBucket call
+func TotalDeleted(results []dto.BucketDeleteResult) int {
+	total := 0
+	for _, result := range results {
+		total += result.Deleted
+	}
+	return total
+}
+
+// deletedByBucket reports every object as deleted, grouped by bucket and region like DeleteObjectsByBucket
+func deletedByBucket(objects []dto.S3Object) []dto.BucketDeleteResult {
+	var results []dto.BucketDeleteResult
+	index := make(map[[2]string]int)
+	for _, obj := range objects {
+		key := [2]string{obj.Bucket, obj.Region}
+		i, ok := index[key]
+		if !ok {
+			i = len(results)
+			index[key] = i
+			results = append(results, dto.BucketDeleteResult{Bucket: obj.Bucket, Region: obj.Region})
+		}
+		results[i].Deleted++
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Bucket != results[j].Bucket {
+			return results[i].Bucket < results[j].Bucket
+		}
+		return results[i].Region < results[j].Region
+	})
+	return results
+}
+
+// DeleteObjectsStream deletes objects received on a channel without holding the whole set in memory.
+// Objects are buffered per region and bucket and deleted as soon as a batch of maxDeleteBatchSize fills;
+// partial batches are flushed once the channel is closed. Batches share the concurrency and rate limits
+// of DeleteObjects. After a failure, including an object in a bucket refused with ErrBucketNotAllowed, the channel
+// is drained without deleting so the producer never blocks.
+func (s3s *S3ServiceImpl) DeleteObjectsStream(ctx context.Context, objects <-chan dto.S3Object) (int, error) {
 	logger := workerLog.GetLoggerFromContext(ctx)
-	totalDeleted := 0
+	logger.Info("Starting streaming batch delete operation")
 
-	// Process objects in batches
-	for i := 0; i < len(objects); i += maxDeleteBatchSize {
-		end := i + maxDeleteBatchSize
-		if end > len(objects) {
-			end = len(objects)
+	type bucketKey struct {
+		region string
+		bucket string
+	}
+
+	var totalDeleted atomic.Int64
+	protectedCount := 0
+	batches := make(map[bucketKey][]dto.S3Object)
+
+	// SetLimit makes flush block while all workers are busy, so the producer is throttled too
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(s3s.deleteConcurrency())
+
+	flush := func(key bucketKey) {
+		batch := batches[key]
+		delete(batches, key)
+
+		g.Go(func() error {
+			if err := s3s.rateLimiter.Wait(gctx); err != nil {
+				return fmt.Errorf("rate limiter context cancelled: %w", err)
+			}
+
+			client, err := s3s.getClientForRegion(gctx, key.region)
+			if err != nil {
+				return fmt.Errorf("failed to get S3 client for region %s: %w", key.region, err)
+			}
+
+			deleted, err := s3s.deleteBatchRetryingKeys(gctx, client, key.bucket, batch)
+			totalDeleted.Add(int64(deleted))
+			if err != nil {
+				return fmt.Errorf("failed to delete objects in bucket %s (region %s): %w", key.bucket, key.region, err)
+			}
+			return nil
+		})
+	}
+
+receive:
+	for {
+		select {
+		case obj, ok := <-objects:
+			if !ok {
+				break receive
+			}
+			if s3s.isProtected(obj) {
+				protectedCount++
+				continue
+			}
+			// Directory prefixes need the whole set to detect, so only the per-key checks apply here
+			if isUnsafeKey(obj.Key) {
+				logUnsafeKeys(ctx, []dto.S3Object{obj})
+				continue
+			}
+			// A refused bucket fails the group, which stops the stream like a failed batch
+			if err := s3s.buckets.check(obj.Bucket); err != nil {
+				g.Go(func() error { return err })
+				continue
+			}
+
+			key := bucketKey{region: obj.Region, bucket: obj.Bucket}
+			batches[key] = append(batches[key], obj)
+			if len(batches[key]) >= maxDeleteBatchSize {
+				flush(key)
+			}
+		case <-gctx.Done():
+			// Keep the producer from blocking on a consumer that has stopped
+			go func() {
+				for range objects {
+				}
+			}()
+			break receive
 		}
+	}
 
-		batch := objects[i:end]
-		deleted, err := s3s.deleteBatch(ctx, bucket, batch)
-		if err != nil {
-			logger.WithError(err).WithFields(log.Fields{
-				"bucket":     bucket,
-				"batch_size": len(batch),
-			}).Error("Failed to delete batch")
-			return totalDeleted, err
+	if gctx.Err() == nil {
+		for key := range batches {
+			flush(key)
 		}
+	}
 
-		totalDeleted += deleted
-		logger.WithFields(log.Fields{
-			"bucket":        bucket,
-			"batch_deleted": deleted,
-			"total_deleted": totalDeleted,
-		}).Debug("Deleted batch of objects")
+	err := g.Wait()
+	if protectedCount > 0 {
+		logger.WithField("protected_objects", protectedCount).Warn("Skipping protected objects")
+	}
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return int(totalDeleted.Load()), err
 	}
 
-	return totalDeleted, nil
+	logger.WithField("total_deleted", totalDeleted.Load()).Info("Completed streaming batch delete operation")
+	return int(totalDeleted.Load()), nil
+}
+
+// deleteBucketObjects deletes objects in a specific bucket using batch operations
+func (s3s *S3ServiceImpl) deleteBucketObjects(ctx context.Context, bucket string, objects []dto.S3Object) (int, error) {
+	client, err := s3s.getClientForRegion(ctx, bucketRegion(ctx, bucket))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get S3 client for bucket %s: %w", bucket, err)
+	}
+	return s3s.deleteBucketObjectsWithClient(ctx, client, bucket, objects)
+}
+
+// deleteConcurrency is the most delete or tag requests the service has in flight at once, across all callers
+func (s3s *S3ServiceImpl) deleteConcurrency() int {
+	return cap(s3s.deleteSlots)
+}
+
+// acquireDeleteSlot blocks until fewer than deleteConcurrency delete or tag requests are in flight. Every
+// message handled concurrently shares these slots, so parallel messages cannot multiply the S3 concurrency.
+func (s3s *S3ServiceImpl) acquireDeleteSlot(ctx context.Context) error {
+	select {
+	case s3s.deleteSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for a delete slot: %w", ctx.Err())
+	}
+}
+
+// releaseDeleteSlot frees a slot taken by acquireDeleteSlot
+func (s3s *S3ServiceImpl) releaseDeleteSlot() {
+	<-s3s.deleteSlots
 }
 
 // deleteBucketObjectsWithClient deletes objects in a specific bucket using a specific S3 client
-func (s3s *S3ServiceImpl) deleteBucketObjectsWithClient(ctx context.Context, client *s3.Client, bucket string, objects []dto.S3Object) (int, error) {
+func (s3s *S3ServiceImpl) deleteBucketObjectsWithClient(ctx context.Context, client S3API, bucket string, objects []dto.S3Object) (int, error) {
 	logger := workerLog.GetLoggerFromContext(ctx)
 	totalDeleted := 0
 
@@ -310,7 +730,8 @@ func (s3s *S3ServiceImpl) deleteBucketObjectsWithClient(ctx context.Context, cli
 		}
 
 		batch := objects[i:end]
-		deleted, err := s3s.deleteBatchWithClient(ctx, client, bucket, batch)
+		deleted, err := s3s.deleteBatchRetryingKeys(ctx, client, bucket, batch)
+		totalDeleted += deleted
 		if err != nil {
 			logger.WithError(err).WithFields(log.Fields{
 				"bucket":     bucket,
@@ -319,7 +740,6 @@ func (s3s *S3ServiceImpl) deleteBucketObjectsWithClient(ctx context.Context, cli
 			return totalDeleted, err
 		}
 
-		totalDeleted += deleted
 		logger.WithFields(log.Fields{
 			"bucket":        bucket,
 			"batch_deleted": deleted,
@@ -332,6 +752,15 @@ func (s3s *S3ServiceImpl) deleteBucketObjectsWithClient(ctx context.Context, cli
 
 // deleteBatch deletes a batch of objects using S3 batch delete API
 func (s3s *S3ServiceImpl) deleteBatch(ctx context.Context, bucket string, objects []dto.S3Object) (int, error) {
+	client, err := s3s.getClientForRegion(ctx, bucketRegion(ctx, bucket))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get S3 client for bucket %s: %w", bucket, err)
+	}
+	return s3s.deleteBatchWithClient(ctx, client, bucket, objects)
+}
+
+// deleteBatchWithClient deletes a batch of objects using a specific S3 client
+func (s3s *S3ServiceImpl) deleteBatchWithClient(ctx context.Context, client S3API, bucket string, objects []dto.S3Object) (int, error) {
 	if len(objects) == 0 {
 		return 0, nil
 	}
@@ -344,133 +773,354 @@ func (s3s *S3ServiceImpl) deleteBatch(ctx context.Context, bucket string, object
 		})
 	}
 
-	// Perform batch delete
+	// Perform batch delete; in quiet mode S3 only reports the keys it failed to delete
+	quiet := s3s.quietDelete(len(objects))
 	input := &s3.DeleteObjectsInput{
 		Bucket: aws.String(bucket),
 		Delete: &types.Delete{
 			Objects: deleteObjects,
-			Quiet:   aws.Bool(false), // We want to see what was deleted
+			Quiet:   aws.Bool(quiet),
 		},
 	}
 
-	result, err := s3s.client.DeleteObjects(ctx, input)
+	if err := s3s.acquireDeleteSlot(ctx); err != nil {
+		return 0, err
+	}
+	result, err := callS3(ctx, s3s.breaker, func() (*s3.DeleteObjectsOutput, error) {
+		return client.DeleteObjects(ctx, input)
+	})
+	s3s.releaseDeleteSlot()
 	if err != nil {
 		return 0, fmt.Errorf("failed to delete objects: %w", err)
 	}
 
-	// Check for errors in the response
-	if len(result.Errors) > 0 {
+	deleted := deletedCount(quiet, len(objects), result)
+	recordDeleteMetrics(deleted, result)
+
+	return deleted, checkDeleteErrors(ctx, bucket, objects, result)
+}
+
+// deleteBatchRetryingKeys deletes a batch of objects, then sends only the keys that failed with a retryable per-key
+// error again, up to keyRetries times, so keys already gone are not deleted twice. Objects deleted by any attempt
+// are counted; a request-level error is returned at once. Keys that failed with a non-retryable error are not
+// attempted again but still fail the batch, as ErrS3Permanent.
+func (s3s *S3ServiceImpl) deleteBatchRetryingKeys(ctx context.Context, client S3API, bucket string, objects []dto.S3Object) (int, error) {
+	deleted, err := s3s.deleteBatchWithClient(ctx, client, bucket, objects)
+
+	var permanent []*S3DeleteError
+	delay := s3s.keyRetryDelay
+	for attempt := 1; attempt <= s3s.keyRetries; attempt++ {
+		var partial *partialDeleteError
+		if !errors.As(err, &partial) || len(partial.retryable) == 0 {
+			break
+		}
+		permanent = append(permanent, partial.permanent()...)
+
 		logger := workerLog.GetLoggerFromContext(ctx)
-		for _, deleteError := range result.Errors {
-			logger.WithFields(log.Fields{
-				"key":   aws.ToString(deleteError.Key),
-				"code":  aws.ToString(deleteError.Code),
-				"error": aws.ToString(deleteError.Message),
-			}).Error("Failed to delete object")
+		logger.WithFields(log.Fields{
+			"bucket":       bucket,
+			"attempt":      attempt,
+			"max_attempts": s3s.keyRetries,
+			"failed_keys":  len(partial.retryable),
+			"retry_delay":  delay,
+		}).Warn("Retrying keys that failed to delete")
+
+		select {
+		case <-ctx.Done():
+			return deleted, ctx.Err()
+		case <-time.After(delay):
 		}
+		delay = min(delay*2, maxDelay)
+
+		var retried int
+		retried, err = s3s.deleteBatchWithClient(ctx, client, bucket, partial.retryable)
+		deleted += retried
 	}
 
-	return len(result.Deleted), nil
+	return deleted, classifyS3Error(withPermanentDeleteErrors(err, permanent))
 }
 
-// deleteBatchWithClient deletes a batch of objects using a specific S3 client
-func (s3s *S3ServiceImpl) deleteBatchWithClient(ctx context.Context, client *s3.Client, bucket string, objects []dto.S3Object) (int, error) {
-	if len(objects) == 0 {
-		return 0, nil
+// quietDelete reports whether a batch of the given size is deleted in quiet mode. Small batches stay verbose so
+// every deleted key is visible in the response; larger ones skip materialising up to a thousand deleted keys.
+func (s3s *S3ServiceImpl) quietDelete(batchSize int) bool {
+	return s3s.quietThreshold > 0 && batchSize >= s3s.quietThreshold
+}
+
+// deletedCount returns how many objects a DeleteObjects response deleted. A quiet response lists no deleted keys,
+// so every requested key that is not reported as an error counts as deleted.
+func deletedCount(quiet bool, requested int, result *s3.DeleteObjectsOutput) int {
+	if quiet {
+		return max(requested-len(result.Errors), 0)
 	}
+	return len(result.Deleted)
+}
 
-	// Prepare delete objects
-	var deleteObjects []types.ObjectIdentifier
-	for _, obj := range objects {
-		deleteObjects = append(deleteObjects, types.ObjectIdentifier{
-			Key: aws.String(obj.Key),
-		})
+// retryableDeleteCodes are per-key DeleteObjects error codes that may succeed on another attempt
+var retryableDeleteCodes = map[string]bool{
+	"InternalError":      true,
+	"SlowDown":           true,
+	"ServiceUnavailable": true,
+	"RequestTimeout":     true,
+}
+
+// S3DeleteError describes a single object that S3 refused to delete
+type S3DeleteError struct {
+	Bucket string
+	Key    string
+	Code   string
+	Err    error
+}
+
+func (e *S3DeleteError) Error() string {
+	return fmt.Sprintf("failed to delete s3://%s/%s (%s): %v", e.Bucket, e.Key, e.Code, e.Err)
+}
+
+func (e *S3DeleteError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether another attempt at deleting the object may succeed
+func (e *S3DeleteError) Retryable() bool {
+	return retryableDeleteCodes[e.Code]
+}
+
+// FailedDeletes returns the per-object failures carried by an error returned from DeleteObjects,
+// so callers can log them or queue a targeted retry. Failures of every bucket in a best-effort error are returned.
+func FailedDeletes(err error) []*S3DeleteError {
+	switch e := err.(type) {
+	case *partialDeleteError:
+		return e.errs
+	case interface{ Unwrap() error }:
+		return FailedDeletes(e.Unwrap())
+	case interface{ Unwrap() []error }:
+		var failed []*S3DeleteError
+		for _, err := range e.Unwrap() {
+			failed = append(failed, FailedDeletes(err)...)
+		}
+		return failed
 	}
+	return nil
+}
 
-	// Perform batch delete
-	input := &s3.DeleteObjectsInput{
-		Bucket: aws.String(bucket),
-		Delete: &types.Delete{
-			Objects: deleteObjects,
-			Quiet:   aws.Bool(false), // We want to see what was deleted
-		},
+// partialDeleteError reports every per-key failure of a batch, keeping the objects worth another attempt apart
+type partialDeleteError struct {
+	retryable []dto.S3Object // Objects that failed with a retryable error
+	errs      []*S3DeleteError
+}
+
+func (e *partialDeleteError) Error() string {
+	return fmt.Sprintf("%d objects failed to delete, %d with retryable errors", len(e.errs), len(e.retryable))
+}
+
+// Retryable reports whether another attempt at the failed objects may delete them all
+func (e *partialDeleteError) Retryable() bool {
+	for _, err := range e.errs {
+		if !err.Retryable() {
+			return false
+		}
 	}
+	return true
+}
 
-	result, err := client.DeleteObjects(ctx, input)
-	if err != nil {
-		return 0, fmt.Errorf("failed to delete objects: %w", err)
+// permanent returns the failures another attempt cannot fix
+func (e *partialDeleteError) permanent() []*S3DeleteError {
+	var permanent []*S3DeleteError
+	for _, err := range e.errs {
+		if !err.Retryable() {
+			permanent = append(permanent, err)
+		}
+	}
+	return permanent
+}
+
+// withPermanentDeleteErrors adds failures of earlier attempts that were not retried to the error of the last attempt
+func withPermanentDeleteErrors(err error, permanent []*S3DeleteError) error {
+	if len(permanent) == 0 {
+		return err
+	}
+	var partial *partialDeleteError
+	switch {
+	case err == nil:
+		return &partialDeleteError{errs: permanent}
+	case errors.As(err, &partial):
+		return &partialDeleteError{retryable: partial.retryable, errs: append(permanent, partial.errs...)}
+	default:
+		return errors.Join(err, &partialDeleteError{errs: permanent})
 	}
+}
 
-	// Check for errors in the response
-	if len(result.Errors) > 0 {
-		logger := workerLog.GetLoggerFromContext(ctx)
-		for _, deleteError := range result.Errors {
-			logger.WithFields(log.Fields{
-				"key":   aws.ToString(deleteError.Key),
-				"code":  aws.ToString(deleteError.Code),
-				"error": aws.ToString(deleteError.Message),
-			}).Error("Failed to delete object")
+func (e *partialDeleteError) Unwrap() []error {
+	errs := make([]error, len(e.errs))
+	for i, err := range e.errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+// checkDeleteErrors logs the per-key errors of a DeleteObjects response and returns them all as a
+// *partialDeleteError. Only the objects of retryable failures are kept for another attempt; a non-retryable
+// failure (e.g. AccessDenied) would fail the same way again.
+func checkDeleteErrors(ctx context.Context, bucket string, objects []dto.S3Object, result *s3.DeleteObjectsOutput) error {
+	if len(result.Errors) == 0 {
+		return nil
+	}
+
+	byKey := make(map[string]dto.S3Object, len(objects))
+	for _, obj := range objects {
+		byKey[obj.Key] = obj
+	}
+
+	logger := workerLog.GetLoggerFromContext(ctx)
+	partial := &partialDeleteError{}
+	for _, deleteError := range result.Errors {
+		deleteErr := &S3DeleteError{
+			Bucket: bucket,
+			Key:    aws.ToString(deleteError.Key),
+			Code:   aws.ToString(deleteError.Code),
+			Err:    errors.New(aws.ToString(deleteError.Message)),
+		}
+		logger.WithFields(log.Fields{
+			"bucket": deleteErr.Bucket,
+			"key":    deleteErr.Key,
+			"code":   deleteErr.Code,
+			"error":  deleteErr.Err.Error(),
+		}).Error("Failed to delete object")
+
+		partial.errs = append(partial.errs, deleteErr)
+		if obj, ok := byKey[deleteErr.Key]; ok && deleteErr.Retryable() {
+			partial.retryable = append(partial.retryable, obj)
 		}
 	}
+	return partial
+}
+
+// recordDeleteMetrics feeds the per-key outcome of a DeleteObjects response into the metrics registry
+func recordDeleteMetrics(deleted int, result *s3.DeleteObjectsOutput) {
+	metrics.S3ObjectsDeleted.Add(float64(deleted))
+	for _, deleteError := range result.Errors {
+		code := aws.ToString(deleteError.Code)
+		if code == "" {
+			code = "Unknown"
+		}
+		metrics.S3DeleteErrors.WithLabelValues(code).Inc()
+	}
+}
 
-	return len(result.Deleted), nil
+// ListObjectsWithPrefix lists all objects in a bucket with a specific prefix, including their size and last modified time
+func (s3s *S3ServiceImpl) ListObjectsWithPrefix(ctx context.Context, bucket, prefix string) (objects []dto.S3Object, err error) {
+	ctx, span := tracing.Start(ctx, "s3.list_objects", attribute.String("bucket", bucket), attribute.String("prefix", prefix))
+	defer func() { tracing.End(span, err) }()
+
+	return s3s.listPrefix(ctx, bucket, prefix)
 }
 
-// listAllBuckets lists all S3 buckets accessible to the service
-func (s3s *S3ServiceImpl) listAllBuckets(ctx context.Context) ([]string, error) {
-	result, err := s3s.client.ListBuckets(ctx, &s3.ListBucketsInput{})
+// BucketExists reports whether a bucket exists. A missing bucket is not an error; any other
+// HeadBucket failure (e.g. access denied) is returned so callers do not mistake it for absence.
+func (s3s *S3ServiceImpl) BucketExists(ctx context.Context, bucket, region string) (bool, error) {
+	client, err := s3s.getClientForRegion(ctx, region)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list buckets: %w", err)
+		return false, fmt.Errorf("failed to get S3 client for region %s: %w", region, err)
 	}
 
-	var buckets []string
-	for _, bucket := range result.Buckets {
-		buckets = append(buckets, aws.ToString(bucket.Name))
+	_, err = client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if err == nil {
+		return true, nil
 	}
 
-	return buckets, nil
+	var notFound *types.NotFound
+	var noSuchBucket *types.NoSuchBucket
+	if errors.As(err, &notFound) || errors.As(err, &noSuchBucket) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check bucket %s: %w", bucket, err)
 }
 
-// listObjectsWithPrefix lists all objects in a bucket with a specific prefix
-func (s3s *S3ServiceImpl) listObjectsWithPrefix(ctx context.Context, bucket, prefix string) ([]dto.S3Object, error) {
-	var objects []dto.S3Object
+// BucketOwnerTag is the bucket tag that must name the owning contractor before a bucket is deleted
+const BucketOwnerTag = "wadugs:contractor_id"
 
-	paginator := s3.NewListObjectsV2Paginator(s3s.client, &s3.ListObjectsV2Input{
-		Bucket: aws.String(bucket),
-		Prefix: aws.String(prefix),
-	})
+// ErrBucketNotOwned is returned when a bucket is not tagged as belonging to the contractor being cleansed.
+// The contractor's bucket name is stale or wrong, so retrying cannot succeed.
+var ErrBucketNotOwned = errors.New("bucket not owned by contractor")
 
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("failed to list objects: %w", err)
+// verifyBucketOwner checks that the bucket carries BucketOwnerTag with the contractor's ID
+func (s3s *S3ServiceImpl) verifyBucketOwner(ctx context.Context, client S3API, bucketName string, contractorID int64) error {
+	output, err := client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(bucketName)})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchTagSet" {
+			return fmt.Errorf("%w: bucket %s has no tags", ErrBucketNotOwned, bucketName)
 		}
+		return fmt.Errorf("failed to get tags of bucket %s: %w", bucketName, err)
+	}
 
-		for _, obj := range page.Contents {
-			objects = append(objects, dto.S3Object{
-				Bucket: bucket,
-				Key:    aws.ToString(obj.Key),
-			})
+	for _, tag := range output.TagSet {
+		if aws.ToString(tag.Key) != BucketOwnerTag {
+			continue
 		}
+		if owner := aws.ToString(tag.Value); owner != strconv.FormatInt(contractorID, 10) {
+			return fmt.Errorf("%w: bucket %s is tagged for contractor %q, not %d", ErrBucketNotOwned, bucketName, owner, contractorID)
+		}
+		return nil
 	}
+	return fmt.Errorf("%w: bucket %s has no %s tag", ErrBucketNotOwned, bucketName, BucketOwnerTag)
+}
 
-	return objects, nil
+// VerifyBucketOwner checks, with the client of region, that a bucket may be deleted on behalf of the contractor:
+// it refuses with ErrBucketNotAllowed for a bucket outside the configured allow and deny lists and with
+// ErrBucketNotOwned unless the bucket is tagged as owned by the contractor. DeleteBucket and EmptyBucket check the
+// same; checking up front lets a cleanse stop before it deletes any of the bucket's objects.
+func (s3s *S3ServiceImpl) VerifyBucketOwner(ctx context.Context, bucketName, region string, contractorID int64) error {
+	if err := s3s.buckets.check(bucketName); err != nil {
+		return err
+	}
+	client, err := s3s.getClientForRegion(ctx, region)
+	if err != nil {
+		return fmt.Errorf("failed to get S3 client for region %s: %w", region, err)
+	}
+	return s3s.verifyBucketOwner(ctx, client, bucketName, contractorID)
 }
 
-// DeleteBucket deletes an S3 bucket after ensuring it's empty
+// DeleteBucket deletes an S3 bucket in region (the default region when empty) after ensuring it's empty.
+// The bucket must be tagged as owned by the contractor, otherwise nothing is deleted and ErrBucketNotOwned is returned;
+// a bucket outside the configured allow and deny lists is refused with ErrBucketNotAllowed, and one holding more
+// objects than the object limit with ErrObjectLimitExceeded.
 // This implementation uses optimized batch operations, rate limiting, and retry logic
-func (s3s *S3ServiceImpl) DeleteBucket(ctx context.Context, bucketName string) error {
+func (s3s *S3ServiceImpl) DeleteBucket(ctx context.Context, bucketName, region string, contractorID int64) (err error) {
+	ctx, span := tracing.Start(ctx, "s3.delete_bucket", attribute.String("bucket", bucketName))
+	defer func() { tracing.End(span, err) }()
+
 	logger := workerLog.GetLoggerFromContext(ctx)
+
+	if err := s3s.buckets.check(bucketName); err != nil {
+		return err
+	}
+	client, err := s3s.getClientForRegion(ctx, region)
+	if err != nil {
+		return fmt.Errorf("failed to get S3 client for region %s: %w", region, err)
+	}
+	if err := s3s.verifyBucketOwner(ctx, client, bucketName, contractorID); err != nil {
+		return err
+	}
+
 	logger.WithField("bucket", bucketName).Info("Starting optimized bucket deletion")
 
 	// Step 1: Delete all objects in the bucket using optimized batch operations
-	err := s3s.deleteAllObjectsInBucket(ctx, bucketName)
+	protectedCount, err := s3s.deleteAllObjectsInBucket(ctx, client, bucketName)
 	if err != nil {
 		return fmt.Errorf("failed to delete objects in bucket %s: %w", bucketName, err)
 	}
 
+	// A bucket still holding protected objects cannot (and must not) be removed
+	if protectedCount > 0 {
+		logger.WithFields(log.Fields{
+			"bucket":            bucketName,
+			"protected_objects": protectedCount,
+		}).Warn("Keeping bucket because it still holds protected objects")
+		return nil
+	}
+
 	// Step 2: Delete the bucket itself with retry logic
-	err = s3s.deleteBucketWithRetry(ctx, bucketName)
+	err = s3s.deleteBucketWithRetry(ctx, client, bucketName)
 	if err != nil {
 		return fmt.Errorf("failed to delete bucket %s: %w", bucketName, err)
 	}
@@ -479,27 +1129,99 @@ func (s3s *S3ServiceImpl) DeleteBucket(ctx context.Context, bucketName string) e
 	return nil
 }
 
-// deleteAllObjectsInBucket deletes all objects in a bucket using optimized pagination and batching
-func (s3s *S3ServiceImpl) deleteAllObjectsInBucket(ctx context.Context, bucketName string) error {
+// EmptyBucket deletes every unprotected object in a bucket but keeps the bucket itself.
+// Like DeleteBucket it refuses with ErrBucketNotOwned unless the bucket is tagged as owned by the contractor,
+// with ErrBucketNotAllowed for a bucket outside the configured allow and deny lists, and with
+// ErrObjectLimitExceeded for a bucket holding more objects than the object limit.
+func (s3s *S3ServiceImpl) EmptyBucket(ctx context.Context, bucketName, region string, contractorID int64) (err error) {
+	ctx, span := tracing.Start(ctx, "s3.empty_bucket", attribute.String("bucket", bucketName))
+	defer func() { tracing.End(span, err) }()
+
+	if err := s3s.buckets.check(bucketName); err != nil {
+		return err
+	}
+	client, err := s3s.getClientForRegion(ctx, region)
+	if err != nil {
+		return fmt.Errorf("failed to get S3 client for region %s: %w", region, err)
+	}
+	if err := s3s.verifyBucketOwner(ctx, client, bucketName, contractorID); err != nil {
+		return err
+	}
+
+	if _, err := s3s.deleteAllObjectsInBucket(ctx, client, bucketName); err != nil {
+		return fmt.Errorf("failed to delete objects in bucket %s: %w", bucketName, err)
+	}
+	return nil
+}
+
+// deleteAllObjectsInBucket deletes all unprotected objects in a bucket using optimized pagination and batching.
+// Progress is checkpointed after every page, so a retry with the same correlation ID resumes after the last
+// processed key; without a checkpoint a continuation message resumes after its own key instead. Once the
+// runtime deadline carried by ctx passes, it stops between pages with a RuntimeExceededError.
+// The objects left to process are counted up front, which seeds the bucket's objects remaining gauge, and nothing
+// is deleted when more than the object limit are left, unless ctx allows it.
+// It returns the number of protected objects left in place.
+func (s3s *S3ServiceImpl) deleteAllObjectsInBucket(ctx context.Context, client S3API, bucketName string) (int, error) {
 	logger := workerLog.GetLoggerFromContext(ctx)
+	correlationID := workerLog.CorrelationIDFromContext(ctx)
 	totalDeleted := 0
+	totalProtected := 0
 
-	// Use paginated listing to handle large numbers of objects efficiently
-	paginator := s3.NewListObjectsV2Paginator(s3s.client, &s3.ListObjectsV2Input{
+	input := &s3.ListObjectsV2Input{
 		Bucket:  aws.String(bucketName),
 		MaxKeys: aws.Int32(1000), // Maximum page size for efficiency
-	})
+	}
+
+	checkpoint, err := s3s.checkpoints.Load(ctx, bucketName, correlationID)
+	if err != nil {
+		logger.WithError(err).WithField("bucket", bucketName).Warn("Failed to load bucket checkpoint, starting from the beginning")
+	} else if checkpoint != nil {
+		input.StartAfter = aws.String(checkpoint.StartAfter)
+		totalDeleted = checkpoint.Deleted
+		totalProtected = checkpoint.Protected
+		logger.WithFields(log.Fields{
+			"bucket":        bucketName,
+			"start_after":   checkpoint.StartAfter,
+			"total_deleted": totalDeleted,
+		}).Info("Resuming bucket deletion from checkpoint")
+	} else if resumeAfter := resumeAfterFromContext(ctx); resumeAfter != "" {
+		input.StartAfter = aws.String(resumeAfter)
+		logger.WithFields(log.Fields{
+			"bucket":      bucketName,
+			"start_after": resumeAfter,
+		}).Info("Resuming bucket deletion from continuation")
+	}
+
+	left, err := s3s.countBucketObjects(ctx, client, bucketName, aws.ToString(input.StartAfter))
+	if err != nil {
+		return totalProtected, err
+	}
+
+	remaining := metrics.S3BucketObjectsRemaining.WithLabelValues(bucketName)
+	remaining.Set(float64(left))
+	defer metrics.S3BucketObjectsRemaining.DeleteLabelValues(bucketName)
+
+	// Use paginated listing to handle large numbers of objects efficiently
+	paginator := s3.NewListObjectsV2Paginator(client, input)
 
 	// Process objects in batches as we paginate
+	lastKey := ""
 	for paginator.HasMorePages() {
+		// Every run deletes at least one page before it may pause, so continuations always make progress
+		if lastKey != "" && runtimeExceeded(ctx) {
+			return totalProtected, &RuntimeExceededError{Bucket: bucketName, ResumeAfter: lastKey}
+		}
+
 		// Rate limit the listing operation
 		if err := s3s.rateLimiter.Wait(ctx); err != nil {
-			return fmt.Errorf("rate limiter context cancelled: %w", err)
+			return totalProtected, fmt.Errorf("rate limiter context cancelled: %w", err)
 		}
 
-		page, err := paginator.NextPage(ctx)
+		page, err := callS3(ctx, s3s.breaker, func() (*s3.ListObjectsV2Output, error) {
+			return paginator.NextPage(ctx)
+		})
 		if err != nil {
-			return fmt.Errorf("failed to list objects page: %w", err)
+			return totalProtected, fmt.Errorf("failed to list objects page: %w", err)
 		}
 
 		if len(page.Contents) == 0 {
@@ -515,13 +1237,37 @@ func (s3s *S3ServiceImpl) deleteAllObjectsInBucket(ctx context.Context, bucketNa
 			})
 		}
 
+		objects, protected := s3s.FilterProtected(objects)
+		totalProtected += len(protected)
+
 		// Delete this batch of objects
-		deleted, err := s3s.deleteBucketObjectsOptimized(ctx, bucketName, objects)
+		deleted, err := s3s.deleteBucketObjectsOptimized(ctx, client, bucketName, objects)
 		if err != nil {
-			return fmt.Errorf("failed to delete batch of %d objects: %w", len(objects), err)
+			return totalProtected, fmt.Errorf("failed to delete batch of %d objects: %w", len(objects), err)
 		}
 
+		// A page is only checkpointed once its deletes are verified, so a failed check lists it again
+		if _, err := s3s.verifyDeleted(ctx, client, bucketName, objects); err != nil {
+			return totalProtected, fmt.Errorf("failed to verify deletes in bucket %s: %w", bucketName, err)
+		}
+
+		// Protected objects stay but are no longer waiting; objects uploaded since the count cannot take it below 0
 		totalDeleted += deleted
+		left = max(left-len(page.Contents), 0)
+		remaining.Set(float64(left))
+		lastKey = aws.ToString(page.Contents[len(page.Contents)-1].Key)
+
+		err = s3s.checkpoints.Save(ctx, BucketCheckpoint{
+			Bucket:        bucketName,
+			CorrelationID: correlationID,
+			StartAfter:    lastKey,
+			Deleted:       totalDeleted,
+			Protected:     totalProtected,
+		})
+		if err != nil {
+			logger.WithError(err).WithField("bucket", bucketName).Warn("Failed to save bucket checkpoint")
+		}
+
 		logger.WithFields(log.Fields{
 			"bucket":        bucketName,
 			"batch_deleted": deleted,
@@ -529,16 +1275,53 @@ func (s3s *S3ServiceImpl) deleteAllObjectsInBucket(ctx context.Context, bucketNa
 		}).Info("Deleted batch of objects")
 	}
 
+	if err := s3s.checkpoints.Delete(ctx, bucketName, correlationID); err != nil {
+		logger.WithError(err).WithField("bucket", bucketName).Warn("Failed to clear bucket checkpoint")
+	}
+
 	logger.WithFields(log.Fields{
-		"bucket":        bucketName,
-		"total_deleted": totalDeleted,
+		"bucket":          bucketName,
+		"total_deleted":   totalDeleted,
+		"total_protected": totalProtected,
 	}).Info("Completed deletion of all objects in bucket")
 
-	return nil
+	return totalProtected, nil
+}
+
+// countBucketObjects returns the number of objects the bucket holds after startAfter. Unless ctx allows a large
+// delete, it refuses with ErrObjectLimitExceeded as soon as the count passes the object limit, so a bucket too large
+// to empty costs no more than that to list.
+func (s3s *S3ServiceImpl) countBucketObjects(ctx context.Context, client S3API, bucketName, startAfter string) (int, error) {
+	limited := s3s.maxObjects > 0 && !largeDeleteAllowed(ctx)
+
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucketName)}
+	if startAfter != "" {
+		input.StartAfter = aws.String(startAfter)
+	}
+	paginator := s3.NewListObjectsV2Paginator(client, input)
+
+	count := 0
+	for paginator.HasMorePages() {
+		if err := s3s.rateLimiter.Wait(ctx); err != nil {
+			return 0, fmt.Errorf("rate limiter context cancelled: %w", err)
+		}
+		page, err := callS3(ctx, s3s.breaker, func() (*s3.ListObjectsV2Output, error) {
+			return paginator.NextPage(ctx)
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to count objects of bucket %s: %w", bucketName, err)
+		}
+
+		count += len(page.Contents)
+		if limited && count > s3s.maxObjects {
+			return 0, fmt.Errorf("%w: bucket %s holds more than %d objects", ErrObjectLimitExceeded, bucketName, s3s.maxObjects)
+		}
+	}
+	return count, nil
 }
 
 // deleteBucketObjectsOptimized deletes objects with improved error handling and rate limiting
-func (s3s *S3ServiceImpl) deleteBucketObjectsOptimized(ctx context.Context, bucket string, objects []dto.S3Object) (int, error) {
+func (s3s *S3ServiceImpl) deleteBucketObjectsOptimized(ctx context.Context, client S3API, bucket string, objects []dto.S3Object) (int, error) {
 	if len(objects) == 0 {
 		return 0, nil
 	}
@@ -554,7 +1337,7 @@ func (s3s *S3ServiceImpl) deleteBucketObjectsOptimized(ctx context.Context, buck
 		}
 
 		batch := objects[i:end]
-		deleted, err := s3s.deleteBatchWithRetry(ctx, bucket, batch)
+		deleted, err := s3s.deleteBatchWithRetry(ctx, client, bucket, batch)
 		if err != nil {
 			logger.WithError(err).WithFields(log.Fields{
 				"bucket":      bucket,
@@ -576,8 +1359,10 @@ func (s3s *S3ServiceImpl) deleteBucketObjectsOptimized(ctx context.Context, buck
 	return totalDeleted, nil
 }
 
-// deleteBatchWithRetry implements exponential backoff retry for batch deletions
-func (s3s *S3ServiceImpl) deleteBatchWithRetry(ctx context.Context, bucket string, objects []dto.S3Object) (int, error) {
+// deleteBatchWithRetry deletes a batch of objects, sending the whole request again with exponential backoff when it
+// fails at the request level with a retryable error. Keys that fail on their own are retried by
+// deleteBatchRetryingKeys, as on every other delete path; a request-level error of a permanent kind is returned at once.
+func (s3s *S3ServiceImpl) deleteBatchWithRetry(ctx context.Context, client S3API, bucket string, objects []dto.S3Object) (int, error) {
 	var lastErr error
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
@@ -586,11 +1371,16 @@ func (s3s *S3ServiceImpl) deleteBatchWithRetry(ctx context.Context, bucket strin
 			return 0, fmt.Errorf("rate limiter context cancelled: %w", err)
 		}
 
-		deleted, err := s3s.deleteBatch(ctx, bucket, objects)
-		if err == nil {
+		// Per-key failures were already retried, and a request that fails once some keys are gone cannot be sent
+		// again whole without counting them twice, so both are left to the retry of the message
+		deleted, err := s3s.deleteBatchRetryingKeys(ctx, client, bucket, objects)
+		var partial *partialDeleteError
+		if err == nil || deleted > 0 || errors.As(err, &partial) || !isRetryableS3Error(err) {
+			if err != nil {
+				return deleted, fmt.Errorf("batch delete failed: %w", err)
+			}
 			return deleted, nil
 		}
-
 		lastErr = err
 
 		// Don't retry on the last attempt
@@ -625,8 +1415,9 @@ func (s3s *S3ServiceImpl) deleteBatchWithRetry(ctx context.Context, bucket strin
 	return 0, fmt.Errorf("batch delete failed after %d attempts: %w", maxRetries+1, lastErr)
 }
 
-// deleteBucketWithRetry deletes the bucket itself with retry logic
-func (s3s *S3ServiceImpl) deleteBucketWithRetry(ctx context.Context, bucketName string) error {
+// deleteBucketWithRetry deletes the bucket itself with retry logic. Like batch deletions, a permanent
+// error is returned at once as ErrS3Permanent.
+func (s3s *S3ServiceImpl) deleteBucketWithRetry(ctx context.Context, client S3API, bucketName string) error {
 	var lastErr error
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
@@ -635,12 +1426,15 @@ func (s3s *S3ServiceImpl) deleteBucketWithRetry(ctx context.Context, bucketName
 			return fmt.Errorf("rate limiter context cancelled: %w", err)
 		}
 
-		_, err := s3s.client.DeleteBucket(ctx, &s3.DeleteBucketInput{
+		_, err := client.DeleteBucket(ctx, &s3.DeleteBucketInput{
 			Bucket: aws.String(bucketName),
 		})
 		if err == nil {
 			return nil
 		}
+		if !isRetryableS3Error(err) {
+			return fmt.Errorf("bucket deletion failed: %w", classifyS3Error(err))
+		}
 
 		lastErr = err
 
@@ -676,22 +1470,54 @@ func (s3s *S3ServiceImpl) deleteBucketWithRetry(ctx context.Context, bucketName
 }
 
 // Null implementation methods for testing
-func (ns *NullS3Service) ListContractorFiles(ctx context.Context, contractorID int64) ([]dto.S3Object, error) {
+func (ns *NullS3Service) ListContractorFiles(ctx context.Context, contractorID int64, opts ...FileOption) ([]dto.S3Object, error) {
 	return []dto.S3Object{}, nil
 }
 
-func (ns *NullS3Service) ListProjectFiles(ctx context.Context, projectID int64) ([]dto.S3Object, error) {
+func (ns *NullS3Service) ListProjectFiles(ctx context.Context, projectID int64, opts ...FileOption) ([]dto.S3Object, error) {
 	return []dto.S3Object{}, nil
 }
 
-func (ns *NullS3Service) ListSiteFiles(ctx context.Context, siteID int64) ([]dto.S3Object, error) {
+func (ns *NullS3Service) ListSiteFiles(ctx context.Context, siteID int64, opts ...FileOption) ([]dto.S3Object, error) {
 	return []dto.S3Object{}, nil
 }
 
+func (ns *NullS3Service) ListObjectsWithPrefix(ctx context.Context, bucket, prefix string) ([]dto.S3Object, error) {
+	return []dto.S3Object{}, nil
+}
+
+func (ns *NullS3Service) BucketExists(ctx context.Context, bucket, region string) (bool, error) {
+	return true, nil
+}
+
+func (ns *NullS3Service) FilterProtected(objects []dto.S3Object) (deletable, protected []dto.S3Object) {
+	return objects, nil
+}
+
 func (ns *NullS3Service) DeleteObjects(ctx context.Context, objects []dto.S3Object) (int, error) {
 	return len(objects), nil
 }
 
-func (ns *NullS3Service) DeleteBucket(ctx context.Context, bucketName string) error {
+func (ns *NullS3Service) DeleteObjectsByBucket(ctx context.Context, objects []dto.S3Object) ([]dto.BucketDeleteResult, error) {
+	return deletedByBucket(objects), nil
+}
+
+func (ns *NullS3Service) DeleteObjectsStream(ctx context.Context, objects <-chan dto.S3Object) (int, error) {
+	count := 0
+	for range objects {
+		count++
+	}
+	return count, nil
+}
+
+func (ns *NullS3Service) VerifyBucketOwner(ctx context.Context, bucketName, region string, contractorID int64) error {
+	return nil
+}
+
+func (ns *NullS3Service) DeleteBucket(ctx context.Context, bucketName, region string, contractorID int64) error {
+	return nil
+}
+
+func (ns *NullS3Service) EmptyBucket(ctx context.Context, bucketName, region string, contractorID int64) error {
 	return nil
 }
@@ -2,11 +2,194 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
 	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"github.com/denys89/wadugs-worker-cleansing/src/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
+// mockS3Client is a configurable S3API implementation for exercising S3ServiceImpl
+type mockS3Client struct {
+	deleteObjectsFn func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error)
+	listKeys        []string         // Keys returned by ListObjectsV2 as a single page
+	listPages       [][]types.Object // When set, pages returned by ListObjectsV2 in order, taking precedence over listKeys
+	listedPrefixes  []string         // Prefixes sent to ListObjectsV2
+	startAfters     []string         // StartAfter values sent to ListObjectsV2; listed keys honour it
+	deleteMu        sync.Mutex       // Guards deletedKeys; batches are deleted concurrently
+	deletedKeys     []string         // Keys sent to DeleteObjects
+	deletedBuckets  []string         // Buckets sent to DeleteBucket
+	listedBuckets   []string         // Buckets sent to ListObjectsV2
+	listBucketCalls int              // Number of ListBuckets calls
+	headBucketErr   error            // Error returned by HeadBucket
+	bucketTags      []types.Tag      // Tags returned by GetBucketTagging
+	bucketTagErr    error            // Error returned by GetBucketTagging
+	deleteBucketErr error            // Error returned by DeleteBucket
+
+	lifecycleInputs []*s3.PutBucketLifecycleConfigurationInput // Requests sent to PutBucketLifecycleConfiguration
+	putInputs       []*s3.PutObjectInput                       // Requests sent to PutObject
+
+	headObjectFn func(key string) (*s3.HeadObjectOutput, error) // When set, answers HeadObject; otherwise every key is gone
+	objects      map[string]string                              // Bodies returned by GetObject, keyed by bucket/key
+
+	tagMu        sync.Mutex             // Guards objectTags; objects are tagged concurrently
+	objectTags   map[string][]types.Tag // Tags per object key, read by GetObjectTagging and written by PutObjectTagging
+	putTagKeyErr string                 // Key for which PutObjectTagging fails
+}
+
+func (m *mockS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	m.listedBuckets = append(m.listedBuckets, aws.ToString(params.Bucket))
+	m.listedPrefixes = append(m.listedPrefixes, aws.ToString(params.Prefix))
+	m.startAfters = append(m.startAfters, aws.ToString(params.StartAfter))
+	startAfter := aws.ToString(params.StartAfter)
+
+	if m.listPages != nil {
+		page := 0
+		if token := aws.ToString(params.ContinuationToken); token != "" {
+			page, _ = strconv.Atoi(token)
+		}
+		output := &s3.ListObjectsV2Output{}
+		if page < len(m.listPages) {
+			for _, obj := range m.listPages[page] {
+				if aws.ToString(obj.Key) > startAfter {
+					output.Contents = append(output.Contents, obj)
+				}
+			}
+		}
+		if page+1 < len(m.listPages) {
+			output.IsTruncated = aws.Bool(true)
+			output.NextContinuationToken = aws.String(strconv.Itoa(page + 1))
+		}
+		return output, nil
+	}
+
+	contents := make([]types.Object, 0, len(m.listKeys))
+	for _, key := range m.listKeys {
+		if key > startAfter {
+			contents = append(contents, types.Object{Key: aws.String(key)})
+		}
+	}
+	return &s3.ListObjectsV2Output{Contents: contents}, nil
+}
+
+func (m *mockS3Client) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	m.deleteMu.Lock()
+	for _, obj := range params.Delete.Objects {
+		m.deletedKeys = append(m.deletedKeys, aws.ToString(obj.Key))
+	}
+	m.deleteMu.Unlock()
+	if m.deleteObjectsFn != nil {
+		return m.deleteObjectsFn(ctx, params)
+	}
+	deleted := make([]types.DeletedObject, 0, len(params.Delete.Objects))
+	for _, obj := range params.Delete.Objects {
+		deleted = append(deleted, types.DeletedObject{Key: obj.Key})
+	}
+	return &s3.DeleteObjectsOutput{Deleted: deleted}, nil
+}
+
+func (m *mockS3Client) ListBuckets(ctx context.Context, params *s3.ListBucketsInput, optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error) {
+	m.listBucketCalls++
+	return &s3.ListBucketsOutput{}, nil
+}
+
+func (m *mockS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	m.putInputs = append(m.putInputs, params)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (m *mockS3Client) DeleteBucket(ctx context.Context, params *s3.DeleteBucketInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketOutput, error) {
+	if m.deleteBucketErr != nil {
+		return nil, m.deleteBucketErr
+	}
+	m.deletedBuckets = append(m.deletedBuckets, aws.ToString(params.Bucket))
+	return &s3.DeleteBucketOutput{}, nil
+}
+
+func (m *mockS3Client) PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	m.lifecycleInputs = append(m.lifecycleInputs, params)
+	return &s3.PutBucketLifecycleConfigurationOutput{}, nil
+}
+
+func (m *mockS3Client) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	if m.headBucketErr != nil {
+		return nil, m.headBucketErr
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (m *mockS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	body, ok := m.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func (m *mockS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if m.headObjectFn != nil {
+		return m.headObjectFn(aws.ToString(params.Key))
+	}
+	return nil, &types.NotFound{}
+}
+
+func (m *mockS3Client) GetBucketTagging(ctx context.Context, params *s3.GetBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error) {
+	if m.bucketTagErr != nil {
+		return nil, m.bucketTagErr
+	}
+	return &s3.GetBucketTaggingOutput{TagSet: m.bucketTags}, nil
+}
+
+func (m *mockS3Client) GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	m.tagMu.Lock()
+	defer m.tagMu.Unlock()
+	return &s3.GetObjectTaggingOutput{TagSet: m.objectTags[aws.ToString(params.Key)]}, nil
+}
+
+func (m *mockS3Client) PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error) {
+	key := aws.ToString(params.Key)
+	if key == m.putTagKeyErr {
+		return nil, errors.New("access denied")
+	}
+
+	m.tagMu.Lock()
+	defer m.tagMu.Unlock()
+	if m.objectTags == nil {
+		m.objectTags = make(map[string][]types.Tag)
+	}
+	m.objectTags[key] = params.Tagging.TagSet
+	return &s3.PutObjectTaggingOutput{}, nil
+}
+
+// ownerTags tags a bucket as owned by contractorID
+func ownerTags(contractorID string) []types.Tag {
+	return []types.Tag{{Key: aws.String(BucketOwnerTag), Value: aws.String(contractorID)}}
+}
+
+func newTestS3Service(client S3API) *S3ServiceImpl {
+	return NewS3Service(client, aws.Config{}, &config.Config{}, nil).(*S3ServiceImpl)
+}
+
+func newProtectedTestS3Service(client S3API, prefixes ...string) *S3ServiceImpl {
+	return NewS3Service(client, aws.Config{}, &config.Config{ProtectedPrefixes: prefixes}, nil).(*S3ServiceImpl)
+}
+
 func TestNullS3Service_ListContractorFiles(t *testing.T) {
 	service := NewNullS3Service()
 	ctx := context.Background()
@@ -158,6 +341,116 @@ func TestS3ServiceHelpers(t *testing.T) {
 	}
 }
 
+func TestS3Service_DeleteBucketObjects_Batches(t *testing.T) {
+	tests := []struct {
+		name        string
+		objectCount int
+		failBatch   int // 1-based batch whose request fails; 0 fails none
+		wantBatches []int
+		wantDeleted int
+		wantErr     bool
+	}{
+		{name: "single partial batch", objectCount: 3, wantBatches: []int{3}, wantDeleted: 3},
+		{name: "exact batch", objectCount: 1000, wantBatches: []int{1000}, wantDeleted: 1000},
+		{name: "batches in order", objectCount: 2500, wantBatches: []int{1000, 1000, 500}, wantDeleted: 2500},
+		{name: "stops at failing batch", objectCount: 2500, failBatch: 2, wantBatches: []int{1000, 1000}, wantDeleted: 1000, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var batches []int
+			client := &mockS3Client{
+				deleteObjectsFn: func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+					batches = append(batches, len(params.Delete.Objects))
+					if len(batches) == tt.failBatch {
+						return nil, errors.New("access denied")
+					}
+					output := &s3.DeleteObjectsOutput{}
+					for _, obj := range params.Delete.Objects {
+						output.Deleted = append(output.Deleted, types.DeletedObject{Key: obj.Key})
+					}
+					return output, nil
+				},
+			}
+
+			objects := make([]dto.S3Object, tt.objectCount)
+			for i := range objects {
+				objects[i] = dto.S3Object{Bucket: "test-bucket", Key: fmt.Sprintf("P1/S1/file-%04d.txt", i)}
+			}
+
+			deleted, err := newTestS3Service(client).deleteBucketObjects(context.Background(), "test-bucket", objects)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if deleted != tt.wantDeleted {
+				t.Errorf("Expected %d deleted, got %d", tt.wantDeleted, deleted)
+			}
+			if fmt.Sprint(batches) != fmt.Sprint(tt.wantBatches) {
+				t.Errorf("Expected batches of %v, got %v", tt.wantBatches, batches)
+			}
+			// Batches are sent one after another, each with the next run of keys
+			for i, key := range client.deletedKeys {
+				if key != objects[i].Key {
+					t.Errorf("Expected key %s sent at %d, got %s", objects[i].Key, i, key)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestS3Service_DeleteBatch_RecordsMetrics(t *testing.T) {
+	client := &mockS3Client{
+		deleteObjectsFn: func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+			return &s3.DeleteObjectsOutput{
+				Deleted: []types.DeletedObject{{Key: aws.String("a")}, {Key: aws.String("b")}},
+				Errors: []types.Error{
+					{Key: aws.String("c"), Code: aws.String("SlowDown")},
+					{Key: aws.String("d"), Code: aws.String("SlowDown")},
+					{Key: aws.String("e"), Code: aws.String("AccessDenied")},
+					{Key: aws.String("f")},
+				},
+			}, nil
+		},
+	}
+	service := newTestS3Service(client)
+
+	deletedBefore := testutil.ToFloat64(metrics.S3ObjectsDeleted)
+	slowDownBefore := testutil.ToFloat64(metrics.S3DeleteErrors.WithLabelValues("SlowDown"))
+	accessDeniedBefore := testutil.ToFloat64(metrics.S3DeleteErrors.WithLabelValues("AccessDenied"))
+	unknownBefore := testutil.ToFloat64(metrics.S3DeleteErrors.WithLabelValues("Unknown"))
+
+	objects := []dto.S3Object{
+		{Bucket: "test-bucket", Key: "a"},
+		{Bucket: "test-bucket", Key: "b"},
+		{Bucket: "test-bucket", Key: "c"},
+		{Bucket: "test-bucket", Key: "d"},
+		{Bucket: "test-bucket", Key: "e"},
+		{Bucket: "test-bucket", Key: "f"},
+	}
+	deleted, err := service.deleteBatch(context.Background(), "test-bucket", objects)
+	var partial *partialDeleteError
+	if !errors.As(err, &partial) || len(partial.retryable) != 2 {
+		t.Fatalf("deleteBatch() expected the 2 SlowDown keys as a partial error, got %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 deleted objects, got %d", deleted)
+	}
+
+	if got := testutil.ToFloat64(metrics.S3ObjectsDeleted) - deletedBefore; got != 2 {
+		t.Errorf("Expected deleted counter to increase by 2, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.S3DeleteErrors.WithLabelValues("SlowDown")) - slowDownBefore; got != 2 {
+		t.Errorf("Expected SlowDown counter to increase by 2, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.S3DeleteErrors.WithLabelValues("AccessDenied")) - accessDeniedBefore; got != 1 {
+		t.Errorf("Expected AccessDenied counter to increase by 1, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.S3DeleteErrors.WithLabelValues("Unknown")) - unknownBefore; got != 1 {
+		t.Errorf("Expected Unknown counter to increase by 1, got %v", got)
+	}
+}
+
 // Benchmark tests
 func BenchmarkNullS3Service_ListContractorFiles(b *testing.B) {
 	service := NewNullS3Service()
@@ -233,4 +526,1180 @@ func TestS3Service_EdgeCases(t *testing.T) {
 	if err != nil {
 		t.Errorf("Should handle negative ID gracefully: %v", err)
 	}
-}
\ No newline at end of file
+}
+
+func TestS3Service_FilterProtected(t *testing.T) {
+	s3s := newProtectedTestS3Service(&mockS3Client{}, "legal_hold/", " ", "P1/S1/keep/")
+
+	objects := []dto.S3Object{
+		{Bucket: "b", Key: "legal_hold/contract.pdf"},
+		{Bucket: "b", Key: "P1/S1/00_Upload/a.txt"},
+		{Bucket: "b", Key: "P1/S1/keep/b.txt"},
+		{Bucket: "b", Key: "P1/legal_hold/c.txt"},
+	}
+
+	deletable, protected := s3s.FilterProtected(objects)
+	if len(deletable) != 2 || deletable[0].Key != "P1/S1/00_Upload/a.txt" || deletable[1].Key != "P1/legal_hold/c.txt" {
+		t.Errorf("Unexpected deletable objects: %+v", deletable)
+	}
+	if len(protected) != 2 || protected[0].Key != "legal_hold/contract.pdf" || protected[1].Key != "P1/S1/keep/b.txt" {
+		t.Errorf("Unexpected protected objects: %+v", protected)
+	}
+
+	// Without configured prefixes nothing is protected
+	deletable, protected = newTestS3Service(&mockS3Client{}).FilterProtected(objects)
+	if len(deletable) != len(objects) || len(protected) != 0 {
+		t.Errorf("Expected all objects deletable, got %d deletable and %d protected", len(deletable), len(protected))
+	}
+}
+
+func TestS3Service_DeleteObjects_SkipsProtected(t *testing.T) {
+	client := &mockS3Client{}
+	s3s := newProtectedTestS3Service(client, "legal_hold/")
+
+	deleted, err := s3s.DeleteObjects(context.Background(), []dto.S3Object{
+		{Bucket: "b", Key: "legal_hold/contract.pdf"},
+		{Bucket: "b", Key: "P1/S1/00_Upload/a.txt"},
+		{Bucket: "b", Key: "P1/S1/00_Upload/b.txt"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if deleted != 2 {
+		t.Errorf("Expected 2 deleted objects, got %d", deleted)
+	}
+	for _, key := range client.deletedKeys {
+		if key == "legal_hold/contract.pdf" {
+			t.Errorf("Protected key %s was sent to DeleteObjects", key)
+		}
+	}
+}
+
+func TestFilterUnsafeKeys(t *testing.T) {
+	objects := []dto.S3Object{
+		{Bucket: "b", Key: "PRJ/S1/00_Upload/line1/Raw/a.xtf"},
+		{Bucket: "b", Key: ""},
+		{Bucket: "b", Key: "   "},
+		{Bucket: "b", Key: "PRJ/S1/00_Upload/"},
+		{Bucket: "b", Key: "PRJ/S1/00_Upload"},
+		{Bucket: "b", Key: "PRJ/S1/00_Upload/line1"},
+		{Bucket: "other", Key: "PRJ/S1/00_Upload"}, // Only a directory in bucket b
+		{Bucket: "b", Key: "PRJ/S1/00_Upload/line1.txt"},
+	}
+
+	safe, unsafe := FilterUnsafeKeys(objects)
+
+	wantSafe := []string{"PRJ/S1/00_Upload/line1/Raw/a.xtf", "PRJ/S1/00_Upload", "PRJ/S1/00_Upload/line1.txt"}
+	if len(safe) != len(wantSafe) {
+		t.Fatalf("Expected safe keys %v, got %+v", wantSafe, safe)
+	}
+	for i, key := range wantSafe {
+		if safe[i].Key != key {
+			t.Errorf("Expected safe key %q, got %q", key, safe[i].Key)
+		}
+	}
+	if safe[1].Bucket != "other" {
+		t.Errorf("Expected the prefix-like key to be safe only in bucket other, got %s", safe[1].Bucket)
+	}
+
+	wantUnsafe := []string{"", "   ", "PRJ/S1/00_Upload/", "PRJ/S1/00_Upload", "PRJ/S1/00_Upload/line1"}
+	if len(unsafe) != len(wantUnsafe) {
+		t.Fatalf("Expected unsafe keys %q, got %+v", wantUnsafe, unsafe)
+	}
+	for i, key := range wantUnsafe {
+		if unsafe[i].Key != key {
+			t.Errorf("Expected unsafe key %q, got %q", key, unsafe[i].Key)
+		}
+	}
+}
+
+func TestS3Service_DeleteObjects_RoutesByRegion(t *testing.T) {
+	defaultClient := &mockS3Client{}
+	euClient := &mockS3Client{}
+	s3s := newTestS3Service(defaultClient)
+	s3s.regionClients["eu-west-1"] = euClient
+
+	deleted, err := s3s.DeleteObjects(context.Background(), []dto.S3Object{
+		{Bucket: "eu-bucket", Key: "P1/S1/a.txt", Region: "eu-west-1"},
+		{Bucket: "default-bucket", Key: "P2/S2/b.txt"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 deleted, got %d", deleted)
+	}
+	if len(euClient.deletedKeys) != 1 || euClient.deletedKeys[0] != "P1/S1/a.txt" {
+		t.Errorf("Expected the eu-west-1 client to delete P1/S1/a.txt, got %v", euClient.deletedKeys)
+	}
+	if len(defaultClient.deletedKeys) != 1 || defaultClient.deletedKeys[0] != "P2/S2/b.txt" {
+		t.Errorf("Expected the default client to delete P2/S2/b.txt, got %v", defaultClient.deletedKeys)
+	}
+}
+
+func TestS3Service_DeleteObjects_SkipsUnsafeKeys(t *testing.T) {
+	client := &mockS3Client{}
+
+	deleted, err := newTestS3Service(client).DeleteObjects(context.Background(), []dto.S3Object{
+		{Bucket: "b", Key: ""},
+		{Bucket: "b", Key: "PRJ/S1/00_Upload/"},
+		{Bucket: "b", Key: "PRJ/S1"},
+		{Bucket: "b", Key: "PRJ/S1/00_Upload/a.txt"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if deleted != 1 {
+		t.Errorf("Expected 1 deleted object, got %d", deleted)
+	}
+	if len(client.deletedKeys) != 1 || client.deletedKeys[0] != "PRJ/S1/00_Upload/a.txt" {
+		t.Errorf("Expected only PRJ/S1/00_Upload/a.txt to be sent to DeleteObjects, got %q", client.deletedKeys)
+	}
+}
+
+func TestS3Service_DeleteBucket_KeepsProtected(t *testing.T) {
+	tests := []struct {
+		name             string
+		listKeys         []string
+		wantDeletedKeys  int
+		wantBucketDelete bool
+	}{
+		{
+			name:             "bucket with protected objects is kept",
+			listKeys:         []string{"legal_hold/contract.pdf", "P1/S1/00_Upload/a.txt"},
+			wantDeletedKeys:  1,
+			wantBucketDelete: false,
+		},
+		{
+			name:             "bucket without protected objects is removed",
+			listKeys:         []string{"P1/S1/00_Upload/a.txt", "P1/S1/00_Upload/b.txt"},
+			wantDeletedKeys:  2,
+			wantBucketDelete: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockS3Client{listKeys: tt.listKeys, bucketTags: ownerTags("1")}
+			s3s := newProtectedTestS3Service(client, "legal_hold/")
+
+			if err := s3s.DeleteBucket(context.Background(), "contractor-bucket", "", 1); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(client.deletedKeys) != tt.wantDeletedKeys {
+				t.Errorf("Expected %d deleted keys, got %v", tt.wantDeletedKeys, client.deletedKeys)
+			}
+			for _, key := range client.deletedKeys {
+				if key == "legal_hold/contract.pdf" {
+					t.Errorf("Protected key %s was deleted", key)
+				}
+			}
+			if gotBucketDelete := len(client.deletedBuckets) > 0; gotBucketDelete != tt.wantBucketDelete {
+				t.Errorf("Expected bucket deletion %v, got %v", tt.wantBucketDelete, gotBucketDelete)
+			}
+		})
+	}
+}
+
+func TestS3Service_ListFiles_OnlyContractorBucket(t *testing.T) {
+	client := &mockS3Client{}
+	s3s := NewS3Service(client, aws.Config{}, &config.Config{}, newFileTreeService(0))
+	ctx := context.Background()
+
+	listers := map[string]func() ([]dto.S3Object, error){
+		"contractor": func() ([]dto.S3Object, error) { return s3s.ListContractorFiles(ctx, 1) },
+		"project":    func() ([]dto.S3Object, error) { return s3s.ListProjectFiles(ctx, 1) },
+		"site":       func() ([]dto.S3Object, error) { return s3s.ListSiteFiles(ctx, 10) },
+	}
+
+	for name, list := range listers {
+		t.Run(name, func(t *testing.T) {
+			objects, err := list()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(objects) == 0 {
+				t.Fatal("Expected objects to be listed")
+			}
+			for _, obj := range objects {
+				if obj.Bucket != "test-bucket" {
+					t.Errorf("Expected only the contractor bucket, got %s for key %s", obj.Bucket, obj.Key)
+				}
+			}
+		})
+	}
+
+	// Keys are resolved from the database; no bucket scan or prefix listing should happen
+	if client.listBucketCalls != 0 {
+		t.Errorf("Expected no ListBuckets calls, got %d", client.listBucketCalls)
+	}
+	if len(client.listedBuckets) != 0 {
+		t.Errorf("Expected no ListObjectsV2 calls, got buckets %v", client.listedBuckets)
+	}
+}
+
+func TestS3Service_ListObjectsWithPrefix(t *testing.T) {
+	modified := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	client := &mockS3Client{
+		listPages: [][]types.Object{
+			{
+				{Key: aws.String("P1/S1/00_Upload/a.txt"), Size: aws.Int64(100), LastModified: aws.Time(modified)},
+				{Key: aws.String("P1/S1/00_Upload/b.txt"), Size: aws.Int64(200), LastModified: aws.Time(modified)},
+			},
+			{
+				{Key: aws.String("P1/S1/01_Processed/c.tif"), Size: aws.Int64(300)},
+			},
+		},
+	}
+
+	objects, err := newTestS3Service(client).ListObjectsWithPrefix(context.Background(), "contractor-bucket", "P1/S1/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []dto.S3Object{
+		{Bucket: "contractor-bucket", Key: "P1/S1/00_Upload/a.txt", Size: 100, LastModified: modified},
+		{Bucket: "contractor-bucket", Key: "P1/S1/00_Upload/b.txt", Size: 200, LastModified: modified},
+		{Bucket: "contractor-bucket", Key: "P1/S1/01_Processed/c.tif", Size: 300},
+	}
+	if len(objects) != len(want) {
+		t.Fatalf("Expected %d objects across pages, got %d", len(want), len(objects))
+	}
+	for i := range want {
+		if objects[i] != want[i] {
+			t.Errorf("Expected object %+v, got %+v", want[i], objects[i])
+		}
+	}
+
+	for _, prefix := range client.listedPrefixes {
+		if prefix != "P1/S1/" {
+			t.Errorf("Expected listing with prefix P1/S1/, got %q", prefix)
+		}
+	}
+	if len(client.listedPrefixes) != 2 {
+		t.Errorf("Expected 2 page requests, got %d", len(client.listedPrefixes))
+	}
+}
+
+func TestS3Service_BucketExists(t *testing.T) {
+	tests := []struct {
+		name       string
+		headErr    error
+		wantExists bool
+		wantErr    bool
+	}{
+		{name: "existing bucket", wantExists: true},
+		{name: "missing bucket (NotFound)", headErr: &types.NotFound{}},
+		{name: "missing bucket (NoSuchBucket)", headErr: &types.NoSuchBucket{}},
+		{name: "access denied", headErr: errors.New("api error AccessDenied: Access Denied"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3s := newTestS3Service(&mockS3Client{headBucketErr: tt.headErr})
+
+			exists, err := s3s.BucketExists(context.Background(), "contractor-bucket", "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BucketExists() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if exists != tt.wantExists {
+				t.Errorf("Expected exists %v, got %v", tt.wantExists, exists)
+			}
+		})
+	}
+}
+
+func TestS3Service_DeleteBucket_VerifiesOwner(t *testing.T) {
+	tests := []struct {
+		name         string
+		bucketTags   []types.Tag
+		bucketTagErr error
+		wantNotOwned bool
+		wantErr      bool
+	}{
+		{name: "matching tag", bucketTags: ownerTags("7")},
+		{name: "matching tag among others", bucketTags: append([]types.Tag{{Key: aws.String("env"), Value: aws.String("prod")}}, ownerTags("7")...)},
+		{name: "mismatched tag", bucketTags: ownerTags("8"), wantNotOwned: true, wantErr: true},
+		{name: "owner tag missing", bucketTags: []types.Tag{{Key: aws.String("env"), Value: aws.String("prod")}}, wantNotOwned: true, wantErr: true},
+		{name: "untagged bucket", bucketTagErr: &smithy.GenericAPIError{Code: "NoSuchTagSet"}, wantNotOwned: true, wantErr: true},
+		{name: "tagging lookup fails", bucketTagErr: errors.New("connection reset"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockS3Client{listKeys: []string{"P1/S1/00_Upload/a.txt"}, bucketTags: tt.bucketTags, bucketTagErr: tt.bucketTagErr}
+
+			err := newTestS3Service(client).DeleteBucket(context.Background(), "contractor-bucket", "", 7)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if len(client.deletedBuckets) != 1 {
+					t.Errorf("Expected bucket to be deleted, got %v", client.deletedBuckets)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			if got := errors.Is(err, ErrBucketNotOwned); got != tt.wantNotOwned {
+				t.Errorf("Expected ErrBucketNotOwned %v, got %v", tt.wantNotOwned, err)
+			}
+			if len(client.deletedKeys) != 0 || len(client.deletedBuckets) != 0 {
+				t.Errorf("Expected nothing deleted, got keys %v and buckets %v", client.deletedKeys, client.deletedBuckets)
+			}
+		})
+	}
+}
+
+func TestS3Service_EmptyBucket(t *testing.T) {
+	tests := []struct {
+		name        string
+		bucketTags  []types.Tag
+		wantErr     bool
+		wantDeleted int
+	}{
+		{name: "owned bucket is emptied", bucketTags: ownerTags("7"), wantDeleted: 1},
+		{name: "not owned bucket is left alone", bucketTags: ownerTags("8"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockS3Client{listKeys: []string{"legal_hold/contract.pdf", "P1/S1/00_Upload/a.txt"}, bucketTags: tt.bucketTags}
+			s3s := newProtectedTestS3Service(client, "legal_hold/")
+
+			err := s3s.EmptyBucket(context.Background(), "contractor-bucket", "", 7)
+			if tt.wantErr {
+				if !errors.Is(err, ErrBucketNotOwned) {
+					t.Fatalf("Expected ErrBucketNotOwned, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(client.deletedKeys) != tt.wantDeleted {
+				t.Errorf("Expected %d deleted keys, got %v", tt.wantDeleted, client.deletedKeys)
+			}
+			if len(client.deletedBuckets) != 0 {
+				t.Errorf("Expected bucket to be kept, got %v", client.deletedBuckets)
+			}
+		})
+	}
+}
+
+func TestS3Service_EmptyBucket_RetriesFailedKeys(t *testing.T) {
+	tests := []struct {
+		name         string
+		keyRetries   int
+		wantRequests int
+		wantErr      bool
+	}{
+		{name: "failed key is retried", keyRetries: 1, wantRequests: 2},
+		// Like every other delete path, the key is left to the retry of the message
+		{name: "retries disabled", keyRetries: 0, wantRequests: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests [][]string
+			client := &mockS3Client{
+				listKeys:   []string{"P1/S1/a.txt", "P1/S1/b.txt"},
+				bucketTags: ownerTags("7"),
+				deleteObjectsFn: func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+					var keys []string
+					output := &s3.DeleteObjectsOutput{}
+					for _, obj := range params.Delete.Objects {
+						keys = append(keys, aws.ToString(obj.Key))
+						if len(requests) == 0 && aws.ToString(obj.Key) == "P1/S1/b.txt" {
+							output.Errors = append(output.Errors, types.Error{Key: obj.Key, Code: aws.String("SlowDown")})
+							continue
+						}
+						output.Deleted = append(output.Deleted, types.DeletedObject{Key: obj.Key})
+					}
+					requests = append(requests, keys)
+					return output, nil
+				},
+			}
+			s3s := NewS3Service(client, aws.Config{}, &config.Config{S3DeleteKeyRetries: tt.keyRetries}, nil).(*S3ServiceImpl)
+			s3s.keyRetryDelay = time.Millisecond
+
+			err := s3s.EmptyBucket(context.Background(), "contractor-bucket", "", 7)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if len(requests) != tt.wantRequests {
+				t.Fatalf("Expected %d DeleteObjects requests, got %v", tt.wantRequests, requests)
+			}
+			if tt.wantRequests > 1 && (len(requests[1]) != 1 || requests[1][0] != "P1/S1/b.txt") {
+				t.Errorf("Expected only the failed key to be retried, got %v", requests[1])
+			}
+		})
+	}
+}
+
+func TestS3Service_EmptyBucket_ObjectLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		override    bool
+		wantErr     bool
+		wantDeleted int
+	}{
+		{name: "bucket over the limit is left alone", wantErr: true},
+		{name: "override empties the bucket", override: true, wantDeleted: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockS3Client{listKeys: []string{"a", "b", "c"}, bucketTags: ownerTags("7")}
+			s3s := newTestS3Service(client)
+			s3s.maxObjects = 2
+
+			ctx := context.Background()
+			if tt.override {
+				ctx = withLargeDeleteAllowed(ctx)
+			}
+			err := s3s.EmptyBucket(ctx, "contractor-bucket", "", 7)
+			if tt.wantErr {
+				if !errors.Is(err, ErrObjectLimitExceeded) {
+					t.Fatalf("Expected ErrObjectLimitExceeded, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(client.deletedKeys) != tt.wantDeleted {
+				t.Errorf("Expected %d deleted keys, got %v", tt.wantDeleted, client.deletedKeys)
+			}
+		})
+	}
+}
+
+func TestS3Service_EmptyBucket_ObjectsRemainingGauge(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxObjects int
+	}{
+		{name: "counted without a limit"},
+		{name: "counted by the limit check", maxObjects: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gauge := metrics.S3BucketObjectsRemaining.WithLabelValues("contractor-bucket")
+			var seen []float64
+			client := &mockS3Client{
+				bucketTags: ownerTags("7"),
+				listPages: [][]types.Object{
+					{{Key: aws.String("a")}, {Key: aws.String("b")}},
+					{{Key: aws.String("c")}, {Key: aws.String("legal_hold/d")}},
+					{{Key: aws.String("m")}},
+				},
+				// Each page's delete sees what is left before it
+				deleteObjectsFn: func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+					seen = append(seen, testutil.ToFloat64(gauge))
+					deleted := make([]types.DeletedObject, 0, len(params.Delete.Objects))
+					for _, obj := range params.Delete.Objects {
+						deleted = append(deleted, types.DeletedObject{Key: obj.Key})
+					}
+					return &s3.DeleteObjectsOutput{Deleted: deleted}, nil
+				},
+			}
+			s3s := newProtectedTestS3Service(client, "legal_hold/")
+			s3s.maxObjects = tt.maxObjects
+
+			if err := s3s.EmptyBucket(context.Background(), "contractor-bucket", "", 7); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// The protected object is never deleted but no longer counts once its page is done
+			if want := []float64{5, 3, 1}; !reflect.DeepEqual(seen, want) {
+				t.Errorf("Expected the gauge at each page to be %v, got %v", want, seen)
+			}
+			if count := testutil.CollectAndCount(metrics.S3BucketObjectsRemaining); count != 0 {
+				t.Errorf("Expected the bucket's series to be removed once emptied, got %d series", count)
+			}
+		})
+	}
+}
+
+func TestS3Service_DeleteBucket_UsesRegionalClient(t *testing.T) {
+	defaultClient := &mockS3Client{}
+	regional := &mockS3Client{listKeys: []string{"a"}, bucketTags: ownerTags("7")}
+	s3s := newTestS3Service(defaultClient)
+	s3s.regionClients["eu-west-1"] = regional
+
+	if err := s3s.DeleteBucket(context.Background(), "contractor-bucket", "eu-west-1", 7); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(regional.deletedKeys) != 1 || len(regional.deletedBuckets) != 1 {
+		t.Errorf("Expected the regional client to empty and delete the bucket, got keys %v and buckets %v", regional.deletedKeys, regional.deletedBuckets)
+	}
+	if len(defaultClient.deletedKeys) != 0 || len(defaultClient.deletedBuckets) != 0 {
+		t.Errorf("Expected the default client to be unused, got keys %v and buckets %v", defaultClient.deletedKeys, defaultClient.deletedBuckets)
+	}
+}
+
+// fakeCheckpointStore is an in-memory CheckpointStore that records every saved checkpoint
+type fakeCheckpointStore struct {
+	MemoryCheckpointStore
+	saved []BucketCheckpoint
+}
+
+func newFakeCheckpointStore() *fakeCheckpointStore {
+	return &fakeCheckpointStore{MemoryCheckpointStore: *NewMemoryCheckpointStore()}
+}
+
+func (s *fakeCheckpointStore) Save(ctx context.Context, checkpoint BucketCheckpoint) error {
+	s.saved = append(s.saved, checkpoint)
+	return s.MemoryCheckpointStore.Save(ctx, checkpoint)
+}
+
+func TestS3Service_EmptyBucket_ResumesFromCheckpoint(t *testing.T) {
+	ctx := workerLog.WithLogger(context.Background(), "cleansing-1")
+	client := &mockS3Client{
+		bucketTags: ownerTags("7"),
+		listPages: [][]types.Object{
+			{{Key: aws.String("a")}, {Key: aws.String("b")}},
+			{{Key: aws.String("c")}, {Key: aws.String("d")}},
+		},
+	}
+
+	// The second page fails, leaving a checkpoint after the first
+	failing := true
+	client.deleteObjectsFn = func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+		if failing && aws.ToString(params.Delete.Objects[0].Key) == "c" {
+			return nil, errors.New("connection reset")
+		}
+		deleted := make([]types.DeletedObject, 0, len(params.Delete.Objects))
+		for _, obj := range params.Delete.Objects {
+			deleted = append(deleted, types.DeletedObject{Key: obj.Key})
+		}
+		return &s3.DeleteObjectsOutput{Deleted: deleted}, nil
+	}
+
+	store := newFakeCheckpointStore()
+	s3s := newTestS3Service(client)
+	s3s.checkpoints = store
+
+	if err := s3s.EmptyBucket(ctx, "contractor-bucket", "", 7); err == nil {
+		t.Fatal("Expected the first attempt to fail")
+	}
+	checkpoint, _ := store.Load(ctx, "contractor-bucket", "cleansing-1")
+	if checkpoint == nil || checkpoint.StartAfter != "b" || checkpoint.Deleted != 2 {
+		t.Fatalf("Expected checkpoint after b with 2 deleted, got %+v", checkpoint)
+	}
+
+	// A retry with the same correlation ID resumes after the checkpoint
+	failing = false
+	client.deletedKeys = nil
+	if err := s3s.EmptyBucket(ctx, "contractor-bucket", "", 7); err != nil {
+		t.Fatalf("Unexpected error on retry: %v", err)
+	}
+	if got := client.startAfters[len(client.startAfters)-1]; got != "b" {
+		t.Errorf("Expected retry to list after b, got %q", got)
+	}
+	if len(client.deletedKeys) != 2 || client.deletedKeys[0] != "c" || client.deletedKeys[1] != "d" {
+		t.Errorf("Expected only c and d to be deleted on retry, got %v", client.deletedKeys)
+	}
+	if last := store.saved[len(store.saved)-1]; last.Deleted != 4 {
+		t.Errorf("Expected the resumed run to count 4 deleted objects, got %+v", last)
+	}
+
+	// A completed run clears its checkpoint
+	if checkpoint, _ := store.Load(ctx, "contractor-bucket", "cleansing-1"); checkpoint != nil {
+		t.Errorf("Expected checkpoint to be cleared, got %+v", checkpoint)
+	}
+}
+
+func TestS3Service_EmptyBucket_CheckpointIsPerCorrelationID(t *testing.T) {
+	client := &mockS3Client{bucketTags: ownerTags("7"), listKeys: []string{"a", "b", "c"}}
+	store := newFakeCheckpointStore()
+	store.Save(context.Background(), BucketCheckpoint{Bucket: "contractor-bucket", CorrelationID: "cleansing-other", StartAfter: "b"})
+
+	s3s := newTestS3Service(client)
+	s3s.checkpoints = store
+
+	if err := s3s.EmptyBucket(workerLog.WithLogger(context.Background(), "cleansing-2"), "contractor-bucket", "", 7); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(client.deletedKeys) != 3 {
+		t.Errorf("Expected a fresh run to delete every key, got %v", client.deletedKeys)
+	}
+}
+
+func TestS3Service_DeleteBatch_PartialErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		errors        []types.Error
+		wantErrs      int
+		wantRetryable []string // Keys reported for retry
+	}{
+		{
+			name: "retryable and non-retryable codes",
+			errors: []types.Error{
+				{Key: aws.String("b"), Code: aws.String("InternalError")},
+				{Key: aws.String("c"), Code: aws.String("AccessDenied")},
+				{Key: aws.String("d"), Code: aws.String("SlowDown")},
+			},
+			wantErrs:      3,
+			wantRetryable: []string{"b", "d"},
+		},
+		{
+			name: "only non-retryable codes",
+			errors: []types.Error{
+				{Key: aws.String("b"), Code: aws.String("AccessDenied")},
+				{Key: aws.String("c")},
+			},
+			wantErrs: 2,
+		},
+		{
+			name: "no errors",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockS3Client{
+				deleteObjectsFn: func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+					return &s3.DeleteObjectsOutput{Deleted: []types.DeletedObject{{Key: aws.String("a")}}, Errors: tt.errors}, nil
+				},
+			}
+			objects := []dto.S3Object{{Key: "a"}, {Key: "b"}, {Key: "c"}, {Key: "d"}}
+
+			deleted, err := newTestS3Service(client).deleteBatch(context.Background(), "test-bucket", objects)
+			if deleted != 1 {
+				t.Errorf("Expected 1 deleted object, got %d", deleted)
+			}
+
+			if tt.wantErrs == 0 {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+
+			var partial *partialDeleteError
+			if !errors.As(err, &partial) {
+				t.Fatalf("Expected partialDeleteError, got %v", err)
+			}
+			if len(partial.errs) != tt.wantErrs {
+				t.Errorf("Expected %d per-key failures, got %+v", tt.wantErrs, partial.errs)
+			}
+			if isRetryableS3Error(err) {
+				t.Error("Expected a batch with a non-retryable failure not to be retryable")
+			}
+			if len(partial.retryable) != len(tt.wantRetryable) {
+				t.Fatalf("Expected retryable keys %v, got %+v", tt.wantRetryable, partial.retryable)
+			}
+			for i, key := range tt.wantRetryable {
+				if partial.retryable[i].Key != key {
+					t.Errorf("Expected retryable key %s, got %s", key, partial.retryable[i].Key)
+				}
+			}
+		})
+	}
+}
+
+func TestS3Service_DeleteObjects_ReportsFailedDeletes(t *testing.T) {
+	client := &mockS3Client{
+		deleteObjectsFn: func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+			return &s3.DeleteObjectsOutput{
+				Deleted: []types.DeletedObject{{Key: aws.String("P1/S1/00_Upload/a.txt")}},
+				Errors: []types.Error{
+					{Key: aws.String("P1/S1/00_Upload/b.txt"), Code: aws.String("SlowDown"), Message: aws.String("Please reduce your request rate.")},
+					{Key: aws.String("P1/S1/00_Upload/c.txt"), Code: aws.String("AccessDenied"), Message: aws.String("Access Denied")},
+				},
+			}, nil
+		},
+	}
+
+	_, err := newTestS3Service(client).DeleteObjects(context.Background(), []dto.S3Object{
+		{Bucket: "contractor-bucket", Key: "P1/S1/00_Upload/a.txt"},
+		{Bucket: "contractor-bucket", Key: "P1/S1/00_Upload/b.txt"},
+		{Bucket: "contractor-bucket", Key: "P1/S1/00_Upload/c.txt"},
+	})
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+
+	if !errors.Is(err, ErrS3Permanent) {
+		t.Errorf("Expected the AccessDenied key to fail permanently, got %v", err)
+	}
+
+	failed := FailedDeletes(err)
+	if len(failed) != 2 {
+		t.Fatalf("Expected 2 failed deletes, got %+v", failed)
+	}
+	if denied := failed[1]; denied.Key != "P1/S1/00_Upload/c.txt" || denied.Code != "AccessDenied" || denied.Retryable() {
+		t.Errorf("Expected a non-retryable AccessDenied failure for c.txt, got %+v", denied)
+	}
+	got := failed[0]
+	if got.Bucket != "contractor-bucket" || got.Key != "P1/S1/00_Upload/b.txt" || got.Code != "SlowDown" {
+		t.Errorf("Expected contractor-bucket/P1/S1/00_Upload/b.txt SlowDown, got %s/%s %s", got.Bucket, got.Key, got.Code)
+	}
+	if got.Err == nil || got.Err.Error() != "Please reduce your request rate." {
+		t.Errorf("Expected S3 message as cause, got %v", got.Err)
+	}
+	if !got.Retryable() {
+		t.Error("Expected SlowDown to be retryable")
+	}
+
+	var deleteErr *S3DeleteError
+	if !errors.As(err, &deleteErr) || deleteErr != got {
+		t.Errorf("Expected errors.As to find the S3DeleteError, got %v", deleteErr)
+	}
+}
+
+func TestFailedDeletes_OtherErrors(t *testing.T) {
+	if got := FailedDeletes(nil); got != nil {
+		t.Errorf("Expected nil for nil error, got %+v", got)
+	}
+	if got := FailedDeletes(errors.New("failed to delete objects: connection reset")); got != nil {
+		t.Errorf("Expected nil for a request-level error, got %+v", got)
+	}
+}
+
+func TestS3Service_DeleteBatchWithRetry_RetriesFailedKeys(t *testing.T) {
+	var requests [][]string
+	client := &mockS3Client{
+		deleteObjectsFn: func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+			var keys []string
+			output := &s3.DeleteObjectsOutput{}
+			for _, obj := range params.Delete.Objects {
+				keys = append(keys, aws.ToString(obj.Key))
+				// The first attempt fails key b transiently and key c permanently
+				switch {
+				case len(requests) == 0 && aws.ToString(obj.Key) == "b":
+					output.Errors = append(output.Errors, types.Error{Key: obj.Key, Code: aws.String("SlowDown")})
+				case aws.ToString(obj.Key) == "c":
+					output.Errors = append(output.Errors, types.Error{Key: obj.Key, Code: aws.String("AccessDenied")})
+				default:
+					output.Deleted = append(output.Deleted, types.DeletedObject{Key: obj.Key})
+				}
+			}
+			requests = append(requests, keys)
+			return output, nil
+		},
+	}
+	objects := []dto.S3Object{{Key: "a"}, {Key: "b"}, {Key: "c"}}
+
+	service := newTestS3Service(client)
+	service.keyRetries = 2
+	service.keyRetryDelay = time.Millisecond
+
+	deleted, err := service.deleteBatchWithRetry(context.Background(), client, "test-bucket", objects)
+	if !errors.Is(err, ErrS3Permanent) {
+		t.Fatalf("Expected key c to fail the batch permanently, got %v", err)
+	}
+	if failed := FailedDeletes(err); len(failed) != 1 || failed[0].Key != "c" {
+		t.Errorf("Expected only key c to be reported, got %+v", failed)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 deleted objects, got %d", deleted)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 DeleteObjects requests, got %v", requests)
+	}
+	if len(requests[1]) != 1 || requests[1][0] != "b" {
+		t.Errorf("Expected only key b to be retried, got %v", requests[1])
+	}
+}
+
+func TestS3Service_DeleteBucketObjects_RetriesFailedKeys(t *testing.T) {
+	tests := []struct {
+		name         string
+		keyRetries   int
+		failAttempts int    // Attempts on which every even-numbered key fails with SlowDown
+		deniedKey    string // Key failing with AccessDenied on every attempt
+		wantDeleted  int
+		wantRequests []int
+		wantFailed   int
+		wantErr      error
+	}{
+		{name: "retry succeeds", keyRetries: 2, failAttempts: 1, wantDeleted: 6, wantRequests: []int{6, 3}},
+		{name: "retries exhausted", keyRetries: 2, failAttempts: 3, wantDeleted: 3, wantRequests: []int{6, 3, 3}, wantFailed: 3},
+		{name: "retries disabled", keyRetries: 0, failAttempts: 1, wantDeleted: 3, wantRequests: []int{6}, wantFailed: 3},
+		{name: "denied key fails after the retry", keyRetries: 2, failAttempts: 1, deniedKey: "key-5", wantDeleted: 5, wantRequests: []int{6, 3}, wantFailed: 1, wantErr: ErrS3Permanent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []int
+			client := &mockS3Client{
+				deleteObjectsFn: func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+					requests = append(requests, len(params.Delete.Objects))
+					output := &s3.DeleteObjectsOutput{}
+					for _, obj := range params.Delete.Objects {
+						if aws.ToString(obj.Key) == tt.deniedKey {
+							output.Errors = append(output.Errors, types.Error{Key: obj.Key, Code: aws.String("AccessDenied")})
+							continue
+						}
+						n, _ := strconv.Atoi(strings.TrimPrefix(aws.ToString(obj.Key), "key-"))
+						if len(requests) <= tt.failAttempts && n%2 == 0 {
+							output.Errors = append(output.Errors, types.Error{Key: obj.Key, Code: aws.String("SlowDown")})
+							continue
+						}
+						output.Deleted = append(output.Deleted, types.DeletedObject{Key: obj.Key})
+					}
+					return output, nil
+				},
+			}
+			service := newTestS3Service(client)
+			service.keyRetries = tt.keyRetries
+			service.keyRetryDelay = time.Millisecond
+
+			var objects []dto.S3Object
+			for i := 0; i < 6; i++ {
+				objects = append(objects, dto.S3Object{Bucket: "test-bucket", Key: fmt.Sprintf("key-%d", i)})
+			}
+
+			deleted, err := service.deleteBucketObjects(context.Background(), "test-bucket", objects)
+			if deleted != tt.wantDeleted {
+				t.Errorf("Expected %d deleted objects, got %d", tt.wantDeleted, deleted)
+			}
+			if !reflect.DeepEqual(requests, tt.wantRequests) {
+				t.Errorf("Expected DeleteObjects requests of %v keys, got %v", tt.wantRequests, requests)
+			}
+			if failed := FailedDeletes(err); len(failed) != tt.wantFailed {
+				t.Errorf("Expected %d failed keys, got %v", tt.wantFailed, err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestS3Service_DeleteObjectsStream(t *testing.T) {
+	var mu sync.Mutex
+	deletedByBucket := make(map[string]int)
+	var batchSizes []int
+	client := &mockS3Client{
+		deleteObjectsFn: func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			deletedByBucket[aws.ToString(params.Bucket)] += len(params.Delete.Objects)
+			batchSizes = append(batchSizes, len(params.Delete.Objects))
+
+			deleted := make([]types.DeletedObject, 0, len(params.Delete.Objects))
+			for _, obj := range params.Delete.Objects {
+				deleted = append(deleted, types.DeletedObject{Key: obj.Key})
+			}
+			return &s3.DeleteObjectsOutput{Deleted: deleted}, nil
+		},
+	}
+	s3s := newProtectedTestS3Service(client, "legal_hold/")
+
+	// Interleave two buckets so both fill batches while the stream is still open
+	objects := make(chan dto.S3Object)
+	go func() {
+		defer close(objects)
+		for i := 0; i < 2500; i++ {
+			bucket := "bucket-a"
+			if i%5 == 0 {
+				bucket = "bucket-b"
+			}
+			objects <- dto.S3Object{Bucket: bucket, Key: fmt.Sprintf("P1/S1/00_Upload/%d.txt", i)}
+		}
+		objects <- dto.S3Object{Bucket: "bucket-a", Key: "legal_hold/contract.pdf"}
+	}()
+
+	deleted, err := s3s.DeleteObjectsStream(context.Background(), objects)
+	if err != nil {
+		t.Fatalf("DeleteObjectsStream() unexpected error: %v", err)
+	}
+	if deleted != 2500 {
+		t.Errorf("Expected 2500 deleted objects, got %d", deleted)
+	}
+	if deletedByBucket["bucket-a"] != 2000 || deletedByBucket["bucket-b"] != 500 {
+		t.Errorf("Expected 2000/500 deletions for bucket-a/bucket-b, got %v", deletedByBucket)
+	}
+
+	sort.Ints(batchSizes)
+	wantSizes := []int{500, 1000, 1000}
+	if len(batchSizes) != len(wantSizes) {
+		t.Fatalf("Expected batches of %v, got %v", wantSizes, batchSizes)
+	}
+	for i := range wantSizes {
+		if batchSizes[i] != wantSizes[i] {
+			t.Errorf("Expected batches of %v, got %v", wantSizes, batchSizes)
+			break
+		}
+	}
+}
+
+func TestS3Service_DeleteObjectsStream_StopsOnError(t *testing.T) {
+	client := &mockS3Client{
+		deleteObjectsFn: func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+			return nil, errors.New("access denied")
+		},
+	}
+	s3s := newTestS3Service(client)
+
+	// The producer must be able to finish sending even though deletion has failed
+	objects := make(chan dto.S3Object)
+	go func() {
+		defer close(objects)
+		for i := 0; i < 3000; i++ {
+			objects <- dto.S3Object{Bucket: "bucket-a", Key: fmt.Sprintf("%d.txt", i)}
+		}
+	}()
+
+	if _, err := s3s.DeleteObjectsStream(context.Background(), objects); err == nil {
+		t.Fatal("Expected error from failing batch")
+	}
+}
+
+// inFlightS3Client records the most DeleteObjects requests it ever had in flight at once
+type inFlightS3Client struct {
+	mockS3Client
+	inFlight    atomic.Int64
+	maxInFlight atomic.Int64
+}
+
+func (m *inFlightS3Client) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	current := m.inFlight.Add(1)
+	defer m.inFlight.Add(-1)
+	for {
+		peak := m.maxInFlight.Load()
+		if current <= peak || m.maxInFlight.CompareAndSwap(peak, current) {
+			break
+		}
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	return m.mockS3Client.DeleteObjects(ctx, params, optFns...)
+}
+
+func TestS3Service_DeleteObjects_SharedConcurrencyCap(t *testing.T) {
+	const deleteConcurrency = 2
+
+	client := &inFlightS3Client{}
+	s3s := NewS3Service(client, aws.Config{}, &config.Config{S3DeleteConcurrency: deleteConcurrency}, nil).(*S3ServiceImpl)
+
+	// Each call spans three buckets, so a single call alone would already use more than the cap
+	const calls = 6
+	var wg sync.WaitGroup
+	var totalDeleted atomic.Int64
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var objects []dto.S3Object
+			for _, bucket := range []string{"bucket-a", "bucket-b", "bucket-c"} {
+				objects = append(objects, dto.S3Object{Bucket: bucket, Key: fmt.Sprintf("P%d/S1/a.txt", i)})
+			}
+			deleted, err := s3s.DeleteObjects(context.Background(), objects)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			totalDeleted.Add(int64(deleted))
+		}()
+	}
+	wg.Wait()
+
+	if got := totalDeleted.Load(); got != calls*3 {
+		t.Errorf("Expected %d objects deleted, got %d", calls*3, got)
+	}
+	if peak := client.maxInFlight.Load(); peak > deleteConcurrency {
+		t.Errorf("Expected at most %d delete requests in flight across all calls, got %d", deleteConcurrency, peak)
+	}
+}
+
+func TestS3Service_DeleteObjects_BestEffort(t *testing.T) {
+	objects := []dto.S3Object{
+		{Bucket: "bucket-a", Key: "P1/S1/a.txt"},
+		{Bucket: "broken-bucket", Key: "P1/S1/b.txt"},
+		{Bucket: "bucket-c", Key: "P1/S1/c.txt"},
+	}
+
+	tests := []struct {
+		name        string
+		bestEffort  bool
+		wantDeleted int
+		wantError   string
+	}{
+		{name: "best effort cleans the other buckets", bestEffort: true, wantDeleted: 2, wantError: "failed to delete objects in 1 of 3 buckets (2 objects deleted)"},
+		{name: "strict abandons the other buckets", bestEffort: false, wantDeleted: 0, wantError: "broken-bucket"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockS3Client{
+				deleteObjectsFn: func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+					if aws.ToString(params.Bucket) == "broken-bucket" {
+						return nil, errors.New("access denied")
+					}
+					if !tt.bestEffort {
+						// Hold the healthy buckets until the failure cancels them
+						select {
+						case <-ctx.Done():
+							return nil, ctx.Err()
+						case <-time.After(5 * time.Second):
+							t.Error("Expected the failing bucket to cancel the others")
+						}
+					}
+					return &s3.DeleteObjectsOutput{Deleted: []types.DeletedObject{{Key: params.Delete.Objects[0].Key}}}, nil
+				},
+			}
+			s3s := NewS3Service(client, aws.Config{}, &config.Config{S3DeleteConcurrency: 3, S3DeleteBestEffort: tt.bestEffort}, nil)
+
+			deleted, err := s3s.DeleteObjects(context.Background(), objects)
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantError, err)
+			}
+			if deleted != tt.wantDeleted {
+				t.Errorf("Expected %d objects deleted, got %d", tt.wantDeleted, deleted)
+			}
+		})
+	}
+}
+
+func TestS3Service_DeleteObjectsByBucket(t *testing.T) {
+	objects := []dto.S3Object{
+		{Bucket: "bucket-c", Key: "P1/S1/c1.txt", Region: "eu-west-1"},
+		{Bucket: "bucket-a", Key: "P1/S1/a1.txt"},
+		{Bucket: "broken-bucket", Key: "P1/S1/b1.txt"},
+		{Bucket: "bucket-a", Key: "P1/S1/a2.txt"},
+		{Bucket: "broken-bucket", Key: "P1/S1/b2.txt"},
+		{Bucket: "bucket-a", Key: "P1/S1/a3.txt"},
+	}
+	client := &mockS3Client{
+		deleteObjectsFn: func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+			if aws.ToString(params.Bucket) == "broken-bucket" {
+				return nil, errors.New("access denied")
+			}
+			output := &s3.DeleteObjectsOutput{}
+			for _, obj := range params.Delete.Objects {
+				output.Deleted = append(output.Deleted, types.DeletedObject{Key: obj.Key})
+			}
+			return output, nil
+		},
+	}
+	s3s := NewS3Service(client, aws.Config{}, &config.Config{S3DeleteConcurrency: 3, S3DeleteBestEffort: true}, nil).(*S3ServiceImpl)
+	// Every region shares the mock client
+	s3s.regionClients["eu-west-1"] = client
+
+	results, err := s3s.DeleteObjectsByBucket(context.Background(), objects)
+	if err == nil || !strings.Contains(err.Error(), "failed to delete objects in 1 of 3 buckets (4 objects deleted)") {
+		t.Fatalf("Expected the broken bucket to fail, got %v", err)
+	}
+
+	want := []struct {
+		bucket, region  string
+		deleted, failed int
+	}{
+		{bucket: "broken-bucket", deleted: 0, failed: 2},
+		{bucket: "bucket-a", deleted: 3, failed: 0},
+		{bucket: "bucket-c", region: "eu-west-1", deleted: 1, failed: 0},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("Expected %d bucket results, got %+v", len(want), results)
+	}
+	for i, w := range want {
+		got := results[i]
+		if got.Bucket != w.bucket || got.Region != w.region || got.Deleted != w.deleted || got.Failed != w.failed {
+			t.Errorf("Expected %s/%s with %d deleted and %d failed, got %+v", w.bucket, w.region, w.deleted, w.failed, got)
+		}
+		if (got.Failed > 0) != (got.Error != "") {
+			t.Errorf("Expected an error only for the failed bucket, got %+v", got)
+		}
+	}
+	if total := TotalDeleted(results); total != 4 {
+		t.Errorf("Expected 4 objects deleted in total, got %d", total)
+	}
+
+	// DeleteObjects reports the same total
+	client.deletedKeys = nil
+	deleted, _ := s3s.DeleteObjects(context.Background(), objects)
+	if deleted != 4 {
+		t.Errorf("Expected DeleteObjects to report 4 objects deleted, got %d", deleted)
+	}
+}
+
+func TestFailedDeletes_BestEffort(t *testing.T) {
+	first := &S3DeleteError{Bucket: "bucket-a", Key: "a", Code: "SlowDown"}
+	second := &S3DeleteError{Bucket: "bucket-b", Key: "b", Code: "SlowDown"}
+	err := fmt.Errorf("failed to delete objects in 2 of 3 buckets (1 objects deleted): %w", errors.Join(
+		fmt.Errorf("failed to delete objects in bucket bucket-a: %w", &partialDeleteError{errs: []*S3DeleteError{first}}),
+		fmt.Errorf("failed to delete objects in bucket bucket-b: %w", &partialDeleteError{errs: []*S3DeleteError{second}}),
+	))
+
+	failed := FailedDeletes(err)
+	if len(failed) != 2 || failed[0] != first || failed[1] != second {
+		t.Errorf("Expected the failures of both buckets, got %+v", failed)
+	}
+}
+
+func TestS3Service_DeleteObjects_QuietMode(t *testing.T) {
+	objects := []dto.S3Object{
+		{Bucket: "bucket-a", Key: "P1/S1/a.txt"},
+		{Bucket: "bucket-a", Key: "P1/S1/b.txt"},
+		{Bucket: "bucket-a", Key: "P1/S1/denied.txt"},
+	}
+
+	tests := []struct {
+		name           string
+		quietThreshold int
+		wantQuiet      bool
+	}{
+		{name: "verbose when disabled", quietThreshold: 0, wantQuiet: false},
+		{name: "verbose below threshold", quietThreshold: 4, wantQuiet: false},
+		{name: "quiet at threshold", quietThreshold: 3, wantQuiet: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var quiet bool
+			client := &mockS3Client{
+				deleteObjectsFn: func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+					quiet = aws.ToBool(params.Delete.Quiet)
+					output := &s3.DeleteObjectsOutput{}
+					for _, obj := range params.Delete.Objects {
+						if aws.ToString(obj.Key) == "P1/S1/denied.txt" {
+							output.Errors = append(output.Errors, types.Error{Key: obj.Key, Code: aws.String("AccessDenied")})
+						} else if !quiet {
+							// A quiet response omits the deleted keys
+							output.Deleted = append(output.Deleted, types.DeletedObject{Key: obj.Key})
+						}
+					}
+					return output, nil
+				},
+			}
+			// Best effort keeps the count of a bucket with a failed key
+			s3s := NewS3Service(client, aws.Config{}, &config.Config{S3DeleteConcurrency: 1, S3DeleteQuietThreshold: tt.quietThreshold, S3DeleteBestEffort: true}, nil)
+
+			deleted, err := s3s.DeleteObjects(context.Background(), objects)
+			if !errors.Is(err, ErrS3Permanent) {
+				t.Fatalf("Expected the denied key to fail permanently, got %v", err)
+			}
+			if quiet != tt.wantQuiet {
+				t.Errorf("Expected quiet %v, got %v", tt.wantQuiet, quiet)
+			}
+			if deleted != 2 {
+				t.Errorf("Expected 2 objects deleted, got %d", deleted)
+			}
+		})
+	}
+}
+
+func TestDeletedCount(t *testing.T) {
+	result := &s3.DeleteObjectsOutput{
+		Deleted: []types.DeletedObject{{Key: aws.String("a")}},
+		Errors:  []types.Error{{Key: aws.String("b")}, {Key: aws.String("c")}},
+	}
+
+	if got := deletedCount(false, 3, result); got != 1 {
+		t.Errorf("Expected verbose count 1, got %d", got)
+	}
+	if got := deletedCount(true, 5, result); got != 3 {
+		t.Errorf("Expected quiet count 3, got %d", got)
+	}
+	if got := deletedCount(true, 1, result); got != 0 {
+		t.Errorf("Expected quiet count 0, got %d", got)
+	}
+}
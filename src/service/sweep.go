@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	log "github.com/sirupsen/logrus"
+)
+
+// lastChanged returns when a record was last updated, falling back to its creation time for records that
+// were never updated
+func lastChanged(metaData entity.MetaData) int64 {
+	if metaData.UpdatedAt != 0 {
+		return metaData.UpdatedAt
+	}
+	return metaData.CreatedAt
+}
+
+// inactiveCandidates returns the IDs of the inactive entities of cleansingType last changed before olderThan
+func (cs *CleansingServiceImpl) inactiveCandidates(ctx context.Context, cleansingType string, olderThan int64) ([]int64, error) {
+	var ids []int64
+	switch cleansingType {
+	case dto.CleansingTypeContractor:
+		contractors, err := retryRead(ctx, cs.readRetry, func() (entity.Contractors, error) {
+			return cs.contractorRepo.GetByStatus(ctx, entity.ContractorStatusInactive)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get inactive contractors: %w", err)
+		}
+		for _, contractor := range contractors {
+			if lastChanged(contractor.MetaData) < olderThan {
+				ids = append(ids, contractor.Id)
+			}
+		}
+	case dto.CleansingTypeProject:
+		projects, err := retryRead(ctx, cs.readRetry, func() (entity.Projects, error) {
+			return cs.projectRepo.GetByStatus(ctx, entity.ProjectStatusInactive)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get inactive projects: %w", err)
+		}
+		for _, project := range projects {
+			if lastChanged(project.MetaData) < olderThan {
+				ids = append(ids, project.Id)
+			}
+		}
+	case dto.CleansingTypeSite:
+		sites, err := retryRead(ctx, cs.readRetry, func() (entity.Sites, error) {
+			return cs.siteRepo.GetByStatus(ctx, entity.SiteStatusInactive)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get inactive sites: %w", err)
+		}
+		for _, site := range sites {
+			if lastChanged(site.MetaData) < olderThan {
+				ids = append(ids, site.Id)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid cleansing type: %s", cleansingType)
+	}
+	return ids, nil
+}
+
+// SweepInactive cleanses every inactive contractor, project or site (status 0) last changed before olderThan,
+// a Unix timestamp, through the same flow as a cleansing message for it. A failing entity does not stop the
+// sweep; the results of every entity processed are returned along with the joined errors of those that failed.
+func (cs *CleansingServiceImpl) SweepInactive(ctx context.Context, cleansingType string, olderThan int64) ([]*dto.CleansingResult, error) {
+	logger := workerLog.GetLoggerFromContext(ctx)
+
+	ids, err := cs.inactiveCandidates(ctx, cleansingType, olderThan)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.WithFields(log.Fields{
+		"type":            cleansingType,
+		"older_than":      olderThan,
+		"candidate_count": len(ids),
+	}).Info("Sweeping inactive entities")
+
+	var results []*dto.CleansingResult
+	var errs []error
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		// The sweep is configured explicitly, so it confirms its own contractor messages
+		message := dto.CleansingMessage{Type: cleansingType, ID: id}
+		if cleansingType == dto.CleansingTypeContractor && cs.confirmSecret != "" {
+			message.ConfirmToken = ContractorConfirmToken(cs.confirmSecret, id)
+		}
+		result, err := cs.ProcessCleansingMessage(ctx, message)
+		if result != nil {
+			results = append(results, result)
+		}
+		if err != nil {
+			logger.WithError(err).WithFields(log.Fields{
+				"type": cleansingType,
+				"id":   id,
+			}).Error("Failed to sweep inactive entity")
+			errs = append(errs, fmt.Errorf("%s %d: %w", cleansingType, id, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return results, fmt.Errorf("failed to sweep %d of %d inactive %ss: %w", len(errs), len(ids), cleansingType, errors.Join(errs...))
+	}
+
+	logger.WithFields(log.Fields{
+		"type":        cleansingType,
+		"swept_count": len(results),
+	}).Info("Swept inactive entities")
+	return results, nil
+}
+
+func (ncs *NullCleansingService) SweepInactive(ctx context.Context, cleansingType string, olderThan int64) ([]*dto.CleansingResult, error) {
+	return nil, nil
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/denys89/wadugs-worker-cleansing/src/testutil"
+	"gorm.io/gorm"
+)
+
+// setStatus sets the status and timestamps of the row of model with the given ID, bypassing gorm's update time tracking
+func setStatus(t *testing.T, db *gorm.DB, model interface{}, id int64, status int8, createdAt, updatedAt int64) {
+	t.Helper()
+
+	err := db.Model(model).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"status":     status,
+		"created_at": createdAt,
+		"updated_at": updatedAt,
+	}).Error
+	if err != nil {
+		t.Fatalf("failed to update %T %d: %v", model, id, err)
+	}
+}
+
+func TestCleansingService_SweepInactive(t *testing.T) {
+	const cutoff = int64(1000)
+
+	tests := []struct {
+		name      string
+		sweepType string
+		seed      func(t *testing.T, db *gorm.DB)
+		wantIDs   []int64
+		model     interface{}
+	}{
+		{
+			name:      "projects",
+			sweepType: dto.CleansingTypeProject,
+			model:     &entity.Project{},
+			seed: func(t *testing.T, db *gorm.DB) {
+				setStatus(t, db, &entity.Project{}, testutil.ProjectID, entity.ProjectStatusInactive, 100, 500)        // Inactive, old
+				setStatus(t, db, &entity.Project{}, testutil.SecondProjectID, entity.ProjectStatusInactive, 100, 2000) // Inactive, recent
+				setStatus(t, db, &entity.Project{}, testutil.OtherProjectID, entity.ProjectStatusActive, 100, 500)     // Active, old
+			},
+			wantIDs: []int64{testutil.ProjectID},
+		},
+		{
+			name:      "sites",
+			sweepType: dto.CleansingTypeSite,
+			model:     &entity.Site{},
+			seed: func(t *testing.T, db *gorm.DB) {
+				setStatus(t, db, &entity.Site{}, testutil.SiteID, entity.SiteStatusInactive, 500, 0)        // Inactive, never updated, created long ago
+				setStatus(t, db, &entity.Site{}, testutil.SecondSiteID, entity.SiteStatusInactive, 2000, 0) // Inactive, created recently
+				setStatus(t, db, &entity.Site{}, testutil.OtherSiteID, entity.SiteStatusInactive, 100, 999) // Inactive, just before the cutoff
+			},
+			wantIDs: []int64{testutil.SiteID, testutil.OtherSiteID},
+		},
+		{
+			name:      "contractors",
+			sweepType: dto.CleansingTypeContractor,
+			model:     &entity.Contractor{},
+			seed: func(t *testing.T, db *gorm.DB) {
+				setStatus(t, db, &entity.Contractor{}, testutil.ContractorID, entity.ContractorStatusActive, 100, 100)
+				setStatus(t, db, &entity.Contractor{}, testutil.OtherContractorID, entity.ContractorStatusInactive, 100, 100)
+			},
+			wantIDs: []int64{testutil.OtherContractorID},
+		},
+		{
+			name:      "nothing inactive",
+			sweepType: dto.CleansingTypeProject,
+			model:     &entity.Project{},
+			seed:      func(t *testing.T, db *gorm.DB) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewMigratedDB(t)
+			testutil.SeedTree(t, db)
+			tt.seed(t, db)
+			before := countRows(t, db, tt.model, "1 = 1")
+
+			// With a confirmation secret set the sweep still cleanses contractors, confirming them itself
+			results, err := newDBCleansingService(db, &config.Config{ContractorConfirmSecret: "secret"}).SweepInactive(context.Background(), tt.sweepType, cutoff)
+			if err != nil {
+				t.Fatalf("SweepInactive() unexpected error: %v", err)
+			}
+
+			var ids []int64
+			for _, result := range results {
+				if !result.Success || result.Type != tt.sweepType {
+					t.Errorf("Expected a successful %s result, got %+v", tt.sweepType, result)
+				}
+				ids = append(ids, result.ID)
+			}
+			sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+			if len(ids) != len(tt.wantIDs) {
+				t.Fatalf("Expected swept IDs %v, got %v", tt.wantIDs, ids)
+			}
+			for i := range ids {
+				if ids[i] != tt.wantIDs[i] {
+					t.Errorf("Expected swept ID %d, got %d", tt.wantIDs[i], ids[i])
+				}
+			}
+
+			for _, id := range tt.wantIDs {
+				if got := countRows(t, db, tt.model, "id = ?", id); got != 0 {
+					t.Errorf("Expected %s %d to be deleted, %d rows remain", tt.sweepType, id, got)
+				}
+			}
+			if got := countRows(t, db, tt.model, "1 = 1"); got != before-int64(len(tt.wantIDs)) {
+				t.Errorf("Expected %d %s rows left, got %d", before-int64(len(tt.wantIDs)), tt.sweepType, got)
+			}
+		})
+	}
+}
+
+func TestCleansingService_SweepInactive_InvalidType(t *testing.T) {
+	service := newTestCleansingService(&mockS3Service{})
+
+	if _, err := service.SweepInactive(context.Background(), "invalid", 1000); err == nil {
+		t.Error("Expected error for invalid cleansing type")
+	}
+}
+
+func TestCleansingService_SweepInactive_NoBucket(t *testing.T) {
+	tests := []struct {
+		name        string
+		recordsOnly bool
+		wantErr     bool
+	}{
+		{name: "fails the contractor without a bucket", recordsOnly: false, wantErr: true},
+		{name: "deletes only the records of the contractor without a bucket", recordsOnly: true, wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewMigratedDB(t)
+			testutil.SeedTree(t, db)
+			setStatus(t, db, &entity.Contractor{}, testutil.ContractorID, entity.ContractorStatusInactive, 100, 100)
+			setStatus(t, db, &entity.Contractor{}, testutil.OtherContractorID, entity.ContractorStatusInactive, 100, 100)
+			if err := db.Model(&entity.Contractor{}).Where("id = ?", testutil.ContractorID).UpdateColumn("aws_bucket_name", " ").Error; err != nil {
+				t.Fatalf("failed to clear contractor bucket: %v", err)
+			}
+
+			cfg := &config.Config{EmptyBucketRecordsOnly: tt.recordsOnly}
+			results, err := newDBCleansingService(db, cfg).SweepInactive(context.Background(), dto.CleansingTypeContractor, 1000)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SweepInactive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrNoBucket) {
+				t.Errorf("Expected ErrNoBucket, got %v", err)
+			}
+			if len(results) != 2 {
+				t.Fatalf("Expected a result per contractor, got %+v", results)
+			}
+
+			byID := make(map[int64]*dto.CleansingResult, len(results))
+			for _, result := range results {
+				byID[result.ID] = result
+			}
+
+			// The contractor with a bucket is cleansed either way
+			if result := byID[testutil.OtherContractorID]; !result.Success || result.ErrorCode != "" {
+				t.Errorf("Expected contractor %d cleansed, got %+v", testutil.OtherContractorID, result)
+			}
+			if got := countRows(t, db, &entity.Contractor{}, "id = ?", testutil.OtherContractorID); got != 0 {
+				t.Errorf("Expected contractor %d deleted, %d rows remain", testutil.OtherContractorID, got)
+			}
+
+			noBucket := byID[testutil.ContractorID]
+			remaining := countRows(t, db, &entity.Contractor{}, "id = ?", testutil.ContractorID)
+			if tt.recordsOnly {
+				if !noBucket.Success || !noBucket.S3Skipped {
+					t.Errorf("Expected a records-only result, got %+v", noBucket)
+				}
+				if remaining != 0 {
+					t.Errorf("Expected contractor %d deleted, %d rows remain", testutil.ContractorID, remaining)
+				}
+				return
+			}
+			if noBucket.Success || noBucket.ErrorCode != dto.ErrorCodeNoBucket {
+				t.Errorf("Expected a %s failure, got %+v", dto.ErrorCodeNoBucket, noBucket)
+			}
+			if remaining != 1 {
+				t.Errorf("Expected contractor %d kept, %d rows remain", testutil.ContractorID, remaining)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/dto"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestCleansingService_ProcessCleansingMessage_Spans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	s3Service := &mockS3Service{siteObjects: []dto.S3Object{{Bucket: "b", Key: "P1/S1/00_Upload/a.txt", Size: 10}}}
+	ctx := workerLog.WithLogger(context.Background(), "cleansing-spans")
+	if _, err := newTestCleansingService(s3Service).ProcessCleansingMessage(ctx, dto.CleansingMessage{Type: dto.CleansingTypeSite, ID: 3}); err != nil {
+		t.Fatalf("ProcessCleansingMessage() unexpected error: %v", err)
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	process, ok := spans["cleansing.process"]
+	if !ok {
+		t.Fatalf("Expected a cleansing.process span, got %v", spans)
+	}
+	for _, name := range []string{"cleansing.build_deletion_context", "cleansing.remove_objects", "cleansing.verify_cascade"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("Expected a %s span", name)
+			continue
+		}
+		if span.Parent().SpanID() != process.SpanContext().SpanID() {
+			t.Errorf("Expected %s to be a child of cleansing.process", name)
+		}
+		if span.SpanContext().TraceID() != process.SpanContext().TraceID() {
+			t.Errorf("Expected %s in the trace of cleansing.process", name)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Package testutil provides shared helpers for tests that run against a real in-memory database
+package testutil
+
+import (
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// associationTables are project join tables without an entity in this worker; they only need to
+// exist so cascade deletes against them succeed
+var associationTables = []string{
+	"CREATE TABLE IF NOT EXISTS client_project (id INTEGER PRIMARY KEY, client_id INTEGER, project_id INTEGER)",
+	"CREATE TABLE IF NOT EXISTS uploader_project (id INTEGER PRIMARY KEY, uploader_id INTEGER, project_id INTEGER)",
+	"CREATE TABLE IF NOT EXISTS vessel_project (id INTEGER PRIMARY KEY, vessel_id INTEGER, project_id INTEGER)",
+}
+
+// NewDB opens an isolated in-memory SQLite database and migrates the given models
+func NewDB(t testing.TB, models ...interface{}) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open in-memory database: %v", err)
+	}
+
+	// A single connection keeps every query on the same in-memory database
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get underlying sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("failed to migrate test models: %v", err)
+	}
+
+	return db
+}
+
+// NewMigratedDB opens an in-memory database with every entity table and the project association tables
+func NewMigratedDB(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	db := NewDB(t, entity.Models()...)
+	for _, statement := range associationTables {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("failed to create association table: %v", err)
+		}
+	}
+	return db
+}
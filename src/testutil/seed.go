@@ -0,0 +1,85 @@
+package testutil
+
+import (
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/entity"
+	"gorm.io/gorm"
+)
+
+// Seeded IDs and storage settings of the tree created by SeedTree
+const (
+	ContractorID      = int64(1)
+	OtherContractorID = int64(2)
+	ProjectID         = int64(10)
+	SecondProjectID   = int64(11)
+	OtherProjectID    = int64(20)
+	SiteID            = int64(100)
+	SecondSiteID      = int64(101)
+	OtherSiteID       = int64(200)
+
+	Bucket      = "contractor-bucket"
+	OtherBucket = "other-bucket"
+	Region      = "ap-southeast-1"
+)
+
+// SeedTree inserts a small contractor → project → site → document group → document → file tree:
+//
+//	contractor 1 (contractor-bucket)
+//	  project 10 "PRJA"
+//	    site 100 "S100": SSS group (2 split files), processed RasterD group (1 file)
+//	    site 101 "S101": Image group (1 file)
+//	  project 11 "PRJB" (no sites)
+//	contractor 2 (other-bucket)
+//	  project 20 "PRJX"
+//	    site 200 "S200": Vector group (1 file)
+func SeedTree(t testing.TB, db *gorm.DB) {
+	t.Helper()
+
+	records := []interface{}{
+		&entity.Contractors{
+			{Id: ContractorID, Name: "Contractor", Status: entity.ContractorStatusActive, AwsBucketName: Bucket, AwsBucketRegion: Region},
+			{Id: OtherContractorID, Name: "Other Contractor", Status: entity.ContractorStatusActive, AwsBucketName: OtherBucket, AwsBucketRegion: Region},
+		},
+		&entity.Projects{
+			{Id: ProjectID, Name: "Project A", Code: "PRJA", Status: 1, FileSizeUsage: 1000},
+			{Id: SecondProjectID, Name: "Project B", Code: "PRJB", Status: 1},
+			{Id: OtherProjectID, Name: "Project X", Code: "PRJX", Status: 1, FileSizeUsage: 500},
+		},
+		&entity.ContractorProjects{
+			{Id: 1, ContractorId: ContractorID, ProjectId: ProjectID},
+			{Id: 2, ContractorId: ContractorID, ProjectId: SecondProjectID},
+			{Id: 3, ContractorId: OtherContractorID, ProjectId: OtherProjectID},
+		},
+		&entity.Sites{
+			{Id: SiteID, Code: "S100", Name: "Site 100", ProjectId: ProjectID, Status: 1},
+			{Id: SecondSiteID, Code: "S101", Name: "Site 101", ProjectId: ProjectID, Status: 1},
+			{Id: OtherSiteID, Code: "S200", Name: "Site 200", ProjectId: OtherProjectID, Status: 1},
+		},
+		&entity.DocumentGroups{
+			{Id: 1000, SiteId: SiteID, Name: "Sonar", Category: "SSS", Status: 1},
+			{Id: 1001, SiteId: SiteID, Name: "Depth", Category: "RasterD", Status: 1, Progress: 40, ProcessedName: "depth"},
+			{Id: 1010, SiteId: SecondSiteID, Name: "Photos", Category: "Image", Status: 1},
+			{Id: 2000, SiteId: OtherSiteID, Name: "Vectors", Category: "Vector", Status: 1},
+		},
+		&entity.Documents{
+			{Id: 5000, GroupID: 1000, Name: "line1", Attachment: "line1"},
+			{Id: 5001, GroupID: 1001, Name: "depth", Attachment: "depth"},
+			{Id: 5010, GroupID: 1010, Name: "photo", Attachment: "photo"},
+			{Id: 6000, GroupID: 2000, Name: "vector", Attachment: "vector"},
+		},
+		&entity.Files{
+			{Id: 1, DocumentId: 5000, Name: "line1/a.xtf", Size: 100},
+			{Id: 2, DocumentId: 5000, Name: "line1/b.xtf", Size: 200},
+			{Id: 3, DocumentId: 5001, Name: "depth.tif", Size: 300},
+			{Id: 4, DocumentId: 5010, Name: "photo.jpg", Size: 400},
+			{Id: 5, DocumentId: 6000, Name: "vector.shp", Size: 500},
+		},
+	}
+
+	for _, record := range records {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("failed to seed %T: %v", record, err)
+		}
+	}
+}
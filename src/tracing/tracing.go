@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the worker's spans
+const instrumentationName = "github.com/denys89/wadugs-worker-cleansing"
+
+// Setup installs a tracer provider exporting spans over OTLP/HTTP to cfg.OTLPEndpoint, and returns a function
+// flushing and stopping it. Without an endpoint the global no-op provider is kept and the shutdown does nothing.
+func Setup(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	if cfg.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(cfg.AppName),
+			semconv.ServiceVersion(cfg.AppVersion),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span named name, as a child of the span in ctx if there is one, tagged with the correlation ID of ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if correlationID := workerLog.CorrelationIDFromContext(ctx); correlationID != "" {
+		attrs = append(attrs, attribute.String("correlation_id", correlationID))
+	}
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err, if any, on span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// RecordError marks the span in ctx as failed with err
+func RecordError(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
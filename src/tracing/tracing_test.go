@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/denys89/wadugs-worker-cleansing/src/config"
+	workerLog "github.com/denys89/wadugs-worker-cleansing/src/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs a tracer provider recording every span for the rest of the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+// attributeValue returns the value of the attribute key of attrs, or "" if it is missing
+func attributeValue(attrs []attribute.KeyValue, key string) string {
+	for _, attr := range attrs {
+		if string(attr.Key) == key {
+			return attr.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestStart_NestsSpansWithCorrelationID(t *testing.T) {
+	recorder := recordSpans(t)
+
+	ctx := workerLog.WithLogger(context.Background(), "cleansing-abc")
+	ctx, parent := Start(ctx, "parent")
+	_, child := Start(ctx, "child", attribute.Int64("site_id", 3))
+	End(child, errors.New("boom"))
+	End(parent, nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	childSpan, parentSpan := spans[0], spans[1]
+	if childSpan.Name() != "child" || parentSpan.Name() != "parent" {
+		t.Fatalf("Expected spans child and parent, got %s and %s", childSpan.Name(), parentSpan.Name())
+	}
+	if childSpan.Parent().SpanID() != parentSpan.SpanContext().SpanID() {
+		t.Error("Expected child span to descend from the parent span")
+	}
+	for _, span := range spans {
+		if got := attributeValue(span.Attributes(), "correlation_id"); got != "cleansing-abc" {
+			t.Errorf("Expected %s span correlation_id cleansing-abc, got %q", span.Name(), got)
+		}
+	}
+	if got := attributeValue(childSpan.Attributes(), "site_id"); got != "3" {
+		t.Errorf("Expected site_id 3, got %q", got)
+	}
+	if childSpan.Status().Code != codes.Error || parentSpan.Status().Code != codes.Unset {
+		t.Errorf("Expected only the child span to fail, got %v and %v", childSpan.Status(), parentSpan.Status())
+	}
+}
+
+func TestSetup_NoEndpoint(t *testing.T) {
+	previous := otel.GetTracerProvider()
+
+	shutdown, err := Setup(context.Background(), &config.Config{})
+	if err != nil {
+		t.Fatalf("Setup() unexpected error: %v", err)
+	}
+	if otel.GetTracerProvider() != previous {
+		t.Error("Expected the tracer provider to be left alone without an endpoint")
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Expected a no-op shutdown, got %v", err)
+	}
+}